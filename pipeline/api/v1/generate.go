@@ -0,0 +1,5 @@
+// Package pipelinev1 holds the generated gRPC API of the pipeline engine.
+// Regenerate after editing pipeline.proto with `go generate ./api/...`.
+package pipelinev1
+
+//go:generate sh -c "cd ../.. && buf generate"
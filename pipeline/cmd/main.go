@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -13,6 +16,7 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/database"
 	"github.com/devmind-pipeline/pipeline/internal/server"
 	"github.com/devmind-pipeline/pipeline/pkg/logging"
 	"github.com/devmind-pipeline/pipeline/pkg/metrics"
@@ -22,6 +26,8 @@ import (
 var (
 	cfgFile string
 	logger  *logrus.Logger
+	// shutdownTracing flushes the spans buffered for export.
+	shutdownTracing = func(context.Context) error { return nil }
 )
 
 func main() {
@@ -59,9 +65,11 @@ Features:
 		}
 
 		// Initialize tracing
-		if err := tracing.Initialize(); err != nil {
+		shutdown, err := tracing.Initialize()
+		if err != nil {
 			logger.WithError(err).Warn("Failed to initialize tracing")
 		}
+		shutdownTracing = shutdown
 
 		return nil
 	},
@@ -73,8 +81,17 @@ Features:
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start the pipeline engine server",
-	Long:  "Start the pipeline engine server with gRPC and HTTP APIs",
+	Long: `Start the pipeline engine server with gRPC and HTTP APIs.
+
+With --dry-run the server is not started: every configured backend is probed
+instead and a pass/fail table is printed. The command exits non-zero when a
+backend the configuration depends on is unreachable.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return runDryRun()
+		}
 		return runServer()
 	},
 }
@@ -90,9 +107,71 @@ var versionCmd = &cobra.Command{
 	},
 }
 
-func init() {
-	cobra.OnInitialize(initConfig)
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration without starting the server",
+	Long: `Validate loads the configuration the server would use and reports every
+problem found: unknown keys, values that cannot be decoded such as malformed
+durations, out-of-range ports and unknown enum values. It exits non-zero when
+any problem is found.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		strict, _ := cmd.Flags().GetBool("strict")
+		cmd.SilenceUsage = true
+		cmd.SilenceErrors = true
+		return runValidate(strict)
+	},
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply, revert or list the database schema migrations",
+	Long: `Migrate manages the schema of the database runs are kept in, for operators
+who migrate out of band with database.auto_migrate off. Each migration is
+applied or reverted in a transaction of its own.`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply every pending migration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMigrate("up")
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert the latest applied migration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMigrate("down")
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List the migrations and when each was applied",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMigrate("status")
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration format",
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the configuration as a JSON Schema",
+	Long: `Schema prints a JSON Schema of the configuration file, generated from the
+configuration the engine decodes: the type of every setting, its description
+and its default. Validate .pipeline-engine.yaml files against it with any JSON
+Schema validator to catch mistakes before they reach a running engine.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfigSchema()
+	},
+}
 
+func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.pipeline-engine.yaml)")
 	rootCmd.PersistentFlags().String("log-level", "info", "log level (debug, info, warn, error)")
@@ -105,15 +184,27 @@ func init() {
 	serverCmd.Flags().String("http-port", "8081", "HTTP server port")
 	serverCmd.Flags().String("metrics-port", "9090", "metrics server port")
 	serverCmd.Flags().Int("max-concurrent-pipelines", 100, "maximum concurrent pipelines")
-	serverCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "graceful shutdown timeout")
+	serverCmd.Flags().Duration("shutdown-timeout", 30*time.Second, "how long shutdown waits for in-flight pipelines and requests")
+	serverCmd.Flags().Bool("dry-run", false, "probe the configured backends and exit instead of serving")
+
+	// Validate flags
+	validateCmd.Flags().Bool("strict", false, "also reject unrecognized top-level keys")
 
 	// Bind flags to viper
 	viper.BindPFlags(rootCmd.PersistentFlags())
 	viper.BindPFlags(serverCmd.Flags())
+	// These flags' own keys are not read anywhere; they set the config settings.
+	viper.BindPFlag("server.max_concurrent_pipelines", serverCmd.Flags().Lookup("max-concurrent-pipelines"))
+	viper.BindPFlag("server.shutdown_timeout", serverCmd.Flags().Lookup("shutdown-timeout"))
 
 	// Add subcommands
 	rootCmd.AddCommand(serverCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(validateCmd)
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+	configCmd.AddCommand(configSchemaCmd)
+	rootCmd.AddCommand(configCmd)
 }
 
 func initConfig() error {
@@ -137,7 +228,7 @@ func initConfig() error {
 	viper.AutomaticEnv()
 
 	// Default values
-	setDefaults()
+	setDefaults(viper.GetViper())
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -148,54 +239,191 @@ func initConfig() error {
 	return nil
 }
 
-func setDefaults() {
+func setDefaults(v *viper.Viper) {
 	// Server defaults
-	viper.SetDefault("server.grpc_port", "8080")
-	viper.SetDefault("server.http_port", "8081")
-	viper.SetDefault("server.metrics_port", "9090")
-	viper.SetDefault("server.max_concurrent_pipelines", 100)
-	viper.SetDefault("server.shutdown_timeout", "30s")
+	v.SetDefault("server.grpc_port", "8080")
+	v.SetDefault("server.http_port", "8081")
+	v.SetDefault("server.metrics_port", "9090")
+	v.SetDefault("server.max_concurrent_pipelines", 100)
+	v.SetDefault("server.shutdown_timeout", "30s")
+	v.SetDefault("server.reload_grace", "10s")
+	v.SetDefault("server.read_header_timeout", "10s")
+	v.SetDefault("server.body_read_timeout", "30s")
+	v.SetDefault("server.maintenance.enabled", false)
+	v.SetDefault("server.maintenance.message", "")
+	v.SetDefault("server.maintenance.retry_after", "5m")
+	v.SetDefault("server.admin_token", "")
+	v.SetDefault("server.advertise_address", "")
+	v.SetDefault("server.readiness.interval", "5s")
+	v.SetDefault("server.rate_limit_enabled", true)
+	v.SetDefault("server.rate_limit_rps", 20)
+	v.SetDefault("server.rate_limit_burst", 40)
 
 	// Logging defaults
-	viper.SetDefault("logging.level", "info")
-	viper.SetDefault("logging.format", "json")
+	v.SetDefault("logging.level", "info")
+	v.SetDefault("logging.format", "json")
+	v.SetDefault("logging.exporter", "stdout")
+	v.SetDefault("logging.otlp.endpoint", "http://otel-collector:4318")
+	v.SetDefault("logging.otlp.timeout", "10s")
+	v.SetDefault("logging.redact.fields", []string{})
+	v.SetDefault("logging.redact.patterns", []string{})
 
 	// Tekton defaults
-	viper.SetDefault("tekton.namespace", "tekton-pipelines")
-	viper.SetDefault("tekton.timeout", "30m")
-	viper.SetDefault("tekton.retry_count", 3)
+	v.SetDefault("tekton.namespace", "tekton-pipelines")
+	v.SetDefault("tekton.timeout", "30m")
+	v.SetDefault("tekton.retry_count", 3)
+	v.SetDefault("tekton.retry_base_delay", "500ms")
+	v.SetDefault("tekton.retry_max_delay", "10s")
+	v.SetDefault("tekton.api_qps", 20)
+	v.SetDefault("tekton.api_burst", 40)
+	v.SetDefault("tekton.api_timeout", "30s")
+	v.SetDefault("tekton.connect_timeout", "10s")
+	v.SetDefault("tekton.require_crds", false)
+	v.SetDefault("tekton.accept_stale_events", false)
+	v.SetDefault("tekton.build_metadata", true)
+	v.SetDefault("tekton.cache_claim", "")
 
 	// ArgoCD defaults
-	viper.SetDefault("argocd.server", "argocd-server:443")
-	viper.SetDefault("argocd.timeout", "5m")
-	viper.SetDefault("argocd.insecure", false)
+	v.SetDefault("argocd.server", "argocd-server:443")
+	v.SetDefault("argocd.timeout", "5m")
+	v.SetDefault("argocd.insecure", false)
+	v.SetDefault("argocd.reauth_retry", true)
+	v.SetDefault("argocd.token_secret_key", "token")
+	v.SetDefault("argocd.rollback_enabled", false)
+	v.SetDefault("argocd.health_grace_period", "1m")
+	v.SetDefault("argocd.health_watch_window", "5m")
 
 	// AI service defaults
-	viper.SetDefault("ai_service.url", "http://ml-service:8000")
-	viper.SetDefault("ai_service.timeout", "30s")
-	viper.SetDefault("ai_service.enabled", true)
+	v.SetDefault("ai_service.url", "http://ml-service:8000")
+	v.SetDefault("ai_service.timeout", "30s")
+	v.SetDefault("ai_service.enabled", true)
+	v.SetDefault("ai_service.strict_schema", false)
+	v.SetDefault("ai_service.min_confidence", 0.6)
+	v.SetDefault("ai_service.test_selection_threshold", 0.8)
+	v.SetDefault("ai_service.block_on_prediction", false)
+	v.SetDefault("ai_service.failure_block_threshold", 0.9)
+	v.SetDefault("ai_service.build_optimization", false)
+	v.SetDefault("ai_service.failover", "ordered")
+	v.SetDefault("ai_service.breaker.failure_threshold", 3)
+	v.SetDefault("ai_service.breaker.open_duration", "30s")
+	v.SetDefault("ai_service.rate_limit.retries", 2)
+	v.SetDefault("ai_service.rate_limit.max_wait", "10s")
+	v.SetDefault("ai_service.audit_payloads", false)
+	v.SetDefault("ai_service.audit_max_bytes", 65536)
+	v.SetDefault("ai_service.audit_retention", "168h")
 
 	// Database defaults
-	viper.SetDefault("database.type", "postgresql")
-	viper.SetDefault("database.host", "localhost")
-	viper.SetDefault("database.port", 5432)
-	viper.SetDefault("database.name", "pipeline_engine")
-	viper.SetDefault("database.ssl_mode", "disable")
+	v.SetDefault("database.type", "postgresql")
+	v.SetDefault("database.host", "localhost")
+	v.SetDefault("database.port", 5432)
+	v.SetDefault("database.name", "pipeline_engine")
+	v.SetDefault("database.ssl_mode", "disable")
+	v.SetDefault("database.auto_migrate", true)
+	v.SetDefault("database.max_open_conns", 25)
+	v.SetDefault("database.max_idle_conns", 5)
+	v.SetDefault("database.conn_max_lifetime", "30m")
+	v.SetDefault("database.read_breaker.enabled", true)
+	v.SetDefault("database.read_breaker.failure_threshold", 5)
+	v.SetDefault("database.read_breaker.open_duration", "30s")
+	v.SetDefault("database.read_breaker.timeout", "2s")
+	v.SetDefault("database.read_breaker.serve_stale", true)
+	v.SetDefault("database.status_cache.enabled", false)
+	v.SetDefault("database.status_cache.ttl", "2s")
+	v.SetDefault("database.status_cache.terminal_ttl", "1h")
+	v.SetDefault("database.status_cache.event_dedup_window", "5s")
+	v.SetDefault("database.archive.enabled", false)
+	v.SetDefault("database.archive.max_age", "168h")
+	v.SetDefault("database.archive.interval", "10m")
+	v.SetDefault("database.archive.path", "/var/lib/pipeline-engine/archive")
+	v.SetDefault("database.pool_size", 0)
 
 	// Redis defaults
-	viper.SetDefault("redis.host", "localhost")
-	viper.SetDefault("redis.port", 6379)
-	viper.SetDefault("redis.db", 0)
+	v.SetDefault("redis.host", "localhost")
+	v.SetDefault("redis.port", 6379)
+	v.SetDefault("redis.db", 0)
+	v.SetDefault("redis.lock_ttl", "30s")
+	v.SetDefault("redis.lock_refresh_interval", "10s")
+	v.SetDefault("redis.dedup_runs", false)
+	v.SetDefault("redis.cancel_broadcast", false)
+	v.SetDefault("redis.record_orphans", false)
+	v.SetDefault("redis.orphan_reconcile_interval", "1m")
+	v.SetDefault("redis.cancel_channel", "devmind:pipeline:cancel")
+	v.SetDefault("redis.cancel_ack_timeout", "10s")
+	v.SetDefault("redis.health_interval", "5s")
+	v.SetDefault("redis.assume_single_replica", false)
 
 	// Metrics defaults
-	viper.SetDefault("metrics.enabled", true)
-	viper.SetDefault("metrics.path", "/metrics")
-	viper.SetDefault("metrics.namespace", "devmind_pipeline")
+	v.SetDefault("metrics.enabled", true)
+	v.SetDefault("metrics.path", "/metrics")
+	v.SetDefault("metrics.namespace", "devmind_pipeline")
+	v.SetDefault("metrics.max_stage_labels", 200)
+	v.SetDefault("metrics.max_pipeline_labels", 200)
+	v.SetDefault("metrics.max_tenant_labels", 200)
 
 	// Tracing defaults
-	viper.SetDefault("tracing.enabled", true)
-	viper.SetDefault("tracing.jaeger_endpoint", "http://jaeger:14268/api/traces")
-	viper.SetDefault("tracing.service_name", "pipeline-engine")
+	v.SetDefault("tracing.enabled", true)
+	v.SetDefault("tracing.exporter", "jaeger")
+	v.SetDefault("tracing.jaeger_endpoint", "http://jaeger:14268/api/traces")
+	v.SetDefault("tracing.otlp_endpoint", "http://otel-collector:4317")
+	v.SetDefault("tracing.service_name", "pipeline-engine")
+	v.SetDefault("tracing.timeline_endpoint", "http://otel-collector:4318")
+	v.SetDefault("tracing.timeline_timeout", "10s")
+
+	// Artifacts defaults
+	v.SetDefault("artifacts.backend", "filesystem")
+	v.SetDefault("artifacts.path", "/var/lib/pipeline-engine/artifacts")
+	v.SetDefault("artifacts.presign_expiry", "15m")
+	v.SetDefault("artifacts.s3.use_ssl", true)
+
+	// Pipeline log defaults
+	v.SetDefault("logs.path", "/var/lib/pipeline-engine/logs")
+	v.SetDefault("logs.retention_days", 0)
+	v.SetDefault("logs.purge_interval", "1h")
+
+	// Pipeline admission defaults
+	v.SetDefault("pipeline.preflight", "off")
+	v.SetDefault("pipeline.preflight_timeout", "30m")
+	v.SetDefault("pipeline.preflight_interval", "30s")
+	v.SetDefault("pipeline.min_resubmit_interval", "0s")
+	v.SetDefault("pipeline.max_stages", 0)
+	v.SetDefault("pipeline.max_artifact_bytes", 0)
+	v.SetDefault("pipeline.secret_scan", "warn")
+	v.SetDefault("pipeline.hard_timeout", "0s")
+	v.SetDefault("pipeline.max_chain_depth", 5)
+
+	// Admission policy defaults
+	v.SetDefault("policy.enabled", false)
+	v.SetDefault("policy.query", "data.devmind.admission")
+	v.SetDefault("policy.timeout", "5s")
+	v.SetDefault("policy.fail_open", false)
+
+	// Stats snapshot defaults
+	v.SetDefault("stats.enabled", false)
+	v.SetDefault("stats.interval", "1m")
+	v.SetDefault("stats.window", "24h")
+	v.SetDefault("queue.max_age", "0s")
+	v.SetDefault("webhooks.github_secret", "")
+	v.SetDefault("webhooks.gitlab_secret", "")
+	v.SetDefault("auth.mode", "none")
+	v.SetDefault("auth.jwt.jwks_refresh", "10m")
+	v.SetDefault("auth.jwt.leeway", "1m")
+	v.SetDefault("queue.backpressure.busy_utilization", 0.8)
+	v.SetDefault("queue.backpressure.overloaded_queue_ratio", 1.0)
+
+	// Scheduler defaults
+	v.SetDefault("scheduler.distributed", false)
+	v.SetDefault("scheduler.mode", "fifo")
+	v.SetDefault("scheduler.tenant_label", "tenant")
+	v.SetDefault("scheduler.priority_label", "priority")
+
+	// Pipeline credential defaults
+	v.SetDefault("credentials.provider", "none")
+	v.SetDefault("credentials.ttl", "1h")
+	v.SetDefault("credentials.http.timeout", "10s")
+
+	// Outbound network defaults: an empty proxy defers to the environment
+	v.SetDefault("network.http_proxy", "")
+	v.SetDefault("network.no_proxy", []string{})
 }
 
 func runServer() error {
@@ -220,6 +448,17 @@ func runServer() error {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.WithError(err).Warn("Failed to flush traces")
+		}
+		if err := logging.Shutdown(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}()
+
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -232,16 +471,25 @@ func runServer() error {
 		}
 	}()
 
-	// Wait for interrupt signal
+	// Wait for interrupt signal, reloading the configuration on SIGHUP
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-
-	select {
-	case err := <-errCh:
-		logger.WithError(err).Error("Server error")
-		return err
-	case sig := <-sigCh:
-		logger.WithField("signal", sig).Info("Received shutdown signal")
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case err := <-errCh:
+			logger.WithError(err).Error("Server error")
+			return err
+		case <-hupCh:
+			// In the background so a slow drain never delays shutdown.
+			go reloadConfig(ctx, srv)
+		case sig := <-sigCh:
+			logger.WithField("signal", sig).Info("Received shutdown signal")
+			break wait
+		}
 	}
 
 	// Graceful shutdown
@@ -256,4 +504,186 @@ func runServer() error {
 
 	logger.Info("Server shutdown complete")
 	return nil
-}
\ No newline at end of file
+}
+
+// reloadConfig re-reads the configuration file and hands the result to srv.
+// A configuration that fails to load leaves the current one in place.
+func reloadConfig(ctx context.Context, srv *server.Server) {
+	logger.Info("Received SIGHUP, reloading configuration")
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			logger.WithError(err).Error("Failed to reload configuration, keeping the current one")
+			return
+		}
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		logger.WithError(err).Error("Failed to reload configuration, keeping the current one")
+		return
+	}
+	if _, err := srv.Reload(ctx, cfg); err != nil {
+		logger.WithError(err).Error("Rejected the reloaded configuration, keeping the current one")
+	}
+}
+
+// runValidate prints a report of every configuration problem and fails when
+// there is any.
+func runValidate(strict bool) error {
+	var problems []config.Problem
+	collect := func(err error) {
+		var verr *config.ValidationError
+		if errors.As(err, &verr) {
+			problems = append(problems, verr.Problems...)
+		} else if err != nil {
+			problems = append(problems, config.Problem{Message: err.Error()})
+		}
+	}
+
+	path := viper.ConfigFileUsed()
+	if path != "" {
+		collect(config.CheckFile(path, strict))
+	}
+	// A value CheckFile already reported usually fails decoding as well; only
+	// report the decoder's less specific error when nothing else explains it.
+	cfg, err := config.Load()
+	if err != nil && len(problems) == 0 {
+		collect(err)
+	}
+	reported := make(map[string]bool, len(problems))
+	for _, p := range problems {
+		reported[p.Key] = true
+	}
+	var verr *config.ValidationError
+	if errors.As(cfg.Validate(), &verr) {
+		for _, p := range verr.Problems {
+			if !reported[p.Key] {
+				problems = append(problems, p)
+			}
+		}
+	}
+
+	source := path
+	if source == "" {
+		source = "defaults and environment (no config file found)"
+	}
+	if len(problems) == 0 {
+		fmt.Printf("Configuration OK: %s\n", source)
+		return nil
+	}
+
+	fmt.Printf("Configuration has %d problem(s): %s\n", len(problems), source)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tPROBLEM")
+	for _, p := range problems {
+		key := p.Key
+		if key == "" {
+			key = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", key, p.Message)
+	}
+	w.Flush()
+	return fmt.Errorf("invalid configuration")
+}
+
+// runMigrate applies every pending migration ("up"), reverts the latest
+// ("down") or lists them all ("status").
+func runMigrate(action string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	switch action {
+	case "up":
+		applied, err := db.MigrateUp(ctx)
+		for _, m := range applied {
+			fmt.Printf("Applied %04d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("Database schema is up to date")
+		}
+		return err
+	case "down":
+		m, err := db.MigrateDown(ctx)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			fmt.Println("No migration is applied")
+		} else {
+			fmt.Printf("Reverted %04d %s\n", m.Version, m.Name)
+		}
+		return nil
+	default:
+		status, err := db.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if !s.AppliedAt.IsZero() {
+				applied = s.AppliedAt.Local().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}
+}
+
+// runConfigSchema prints the JSON Schema of the configuration, with the
+// built-in defaults rather than those of any config file found.
+func runConfigSchema() error {
+	defaults := viper.New()
+	setDefaults(defaults)
+	out, err := json.MarshalIndent(config.Schema(defaults.AllSettings()), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// runDryRun probes every configured backend and prints the outcome, failing
+// when a required backend is unreachable.
+func runDryRun() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	checks := server.CheckBackends(context.Background(), cfg, logger)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BACKEND\tREQUIRED\tSTATUS\tLATENCY\tDETAIL")
+	failed := 0
+	for _, c := range checks {
+		required := "no"
+		if c.Required {
+			required = "yes"
+		}
+		status, latency, detail := "pass", c.Latency.Round(time.Millisecond).String(), ""
+		switch {
+		case c.Skipped != "":
+			status, latency, detail = "skip", "-", c.Skipped
+		case c.Err != nil:
+			status, detail = "fail", c.Err.Error()
+			if c.Required {
+				failed++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Name, required, status, latency, detail)
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("%d required backend(s) unreachable", failed)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+const (
+	// DefaultAuditMaxBytes is used when ai_service.audit_max_bytes is not
+	// set.
+	DefaultAuditMaxBytes = 64 << 10
+	// DefaultAuditRetention is used when ai_service.audit_retention is not
+	// set.
+	DefaultAuditRetention = 7 * 24 * time.Hour
+)
+
+// auditRedactor removes the secrets the logs are always redacted of from
+// recorded exchanges.
+var auditRedactor, _ = logging.NewRedactHook(nil, nil)
+
+type auditKey struct{}
+
+// WithAudit returns a context whose AI calls hand their exchanges to record
+// once they complete, for ai_service.audit_payloads.
+func WithAudit(ctx context.Context, record func(pipeline.AIExchange)) context.Context {
+	return context.WithValue(ctx, auditKey{}, record)
+}
+
+func auditFrom(ctx context.Context) func(pipeline.AIExchange) {
+	record, _ := ctx.Value(auditKey{}).(func(pipeline.AIExchange))
+	return record
+}
+
+// exchange is the audit record of a call to endpoint: its payloads
+// redacted, then each cut at ai_service.audit_max_bytes.
+func (c *Client) exchange(endpoint string, request, response []byte, err error) pipeline.AIExchange {
+	x := pipeline.AIExchange{Endpoint: endpoint, At: time.Now().UTC()}
+	var cutRequest, cutResponse bool
+	x.Request, cutRequest = capBytes(auditRedactor.RedactJSON(request), c.auditMaxBytes)
+	if len(response) > 0 {
+		x.Response, cutResponse = capBytes(auditRedactor.RedactJSON(response), c.auditMaxBytes)
+	}
+	x.Truncated = cutRequest || cutResponse
+	if err != nil {
+		x.Error = auditRedactor.RedactString(err.Error())
+	}
+	return x
+}
+
+// capBytes cuts s to at most n bytes without splitting a character.
+func capBytes(s string, n int) (string, bool) {
+	if len(s) <= n {
+		return s, false
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n], true
+}
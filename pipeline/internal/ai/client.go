@@ -0,0 +1,330 @@
+// Package ai is the engine's client for the DevMind ml-service.
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+var (
+	// ErrUnavailable means no usable AI result could be obtained. Callers
+	// must continue without AI enhancements rather than fail the pipeline.
+	ErrUnavailable = errors.New("ai service unavailable")
+	// ErrSchemaMismatch means the ai-service answered with a schema this
+	// engine does not understand. In strict mode it is returned on its own
+	// and should fail the caller; otherwise it is wrapped with ErrUnavailable.
+	ErrSchemaMismatch = errors.New("ai service schema mismatch")
+)
+
+// Client talks to the ml-service HTTP API. Requests fail over across the
+// configured endpoints, skipping those whose circuit breaker is open.
+type Client struct {
+	endpoints     []*endpoint
+	roundRobin    bool
+	next          atomic.Uint32
+	apiKey        string
+	enabled       bool
+	strictSchema  bool
+	minConfidence float64
+	// selectionThreshold is the confidence a test selection needs.
+	selectionThreshold float64
+	// rateLimitRetries and rateLimitMaxWait bound the retries of requests
+	// rejected with 429.
+	rateLimitRetries int
+	rateLimitMaxWait time.Duration
+	// auditMaxBytes caps each payload of the exchanges recorded for
+	// ai_service.audit_payloads.
+	auditMaxBytes int
+	httpClient    *http.Client
+	logger        *logrus.Logger
+}
+
+// New creates a Client from cfg, reaching the endpoints through the proxy
+// network configures for it.
+func New(cfg config.AIServiceConfig, network egress.Config, logger *logrus.Logger) *Client {
+	maxWait := cfg.RateLimit.MaxWait
+	if maxWait <= 0 {
+		maxWait = DefaultRateLimitMaxWait
+	}
+	auditMax := cfg.AuditMaxBytes
+	if auditMax <= 0 {
+		auditMax = DefaultAuditMaxBytes
+	}
+	threshold := cfg.TestSelectionThreshold
+	if threshold <= 0 {
+		threshold = cfg.MinConfidence
+	}
+	return &Client{
+		endpoints:          newEndpoints(cfg),
+		roundRobin:         cfg.Failover == FailoverRoundRobin,
+		apiKey:             cfg.APIKey,
+		enabled:            cfg.Enabled,
+		strictSchema:       cfg.StrictSchema,
+		minConfidence:      cfg.MinConfidence,
+		selectionThreshold: threshold,
+		rateLimitRetries:   cfg.RateLimit.Retries,
+		rateLimitMaxWait:   maxWait,
+		auditMaxBytes:      auditMax,
+		httpClient:         network.Client(egress.ClientAIService, cfg.Timeout),
+		logger:             logger,
+	}
+}
+
+// post sends in to endpoint and decodes the reply into out, enforcing schema
+// compatibility. Every failure is reported as ErrUnavailable except schema
+// mismatches in strict mode. The exchange is recorded when ctx asks for it;
+// see WithAudit.
+func (c *Client) post(ctx context.Context, endpoint string, in interface{}, out response) (err error) {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", endpoint, err)
+	}
+	var answer []byte
+	if record := auditFrom(ctx); record != nil {
+		defer func() { record(c.exchange(endpoint, body, answer, err)) }()
+	}
+
+	resp, err := c.send(ctx, endpoint, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	serviceVersion := resp.Header.Get(schemaHeader)
+	if serviceVersion == "" {
+		serviceVersion = legacySchemaVersion
+	}
+	if answer, err = io.ReadAll(resp.Body); err != nil {
+		return c.schemaMismatch(ctx, endpoint, "decode", serviceVersion, err)
+	}
+	if err := checkVersion(serviceVersion); err != nil {
+		return c.schemaMismatch(ctx, endpoint, "version", serviceVersion, err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(answer, &raw); err != nil {
+		return c.schemaMismatch(ctx, endpoint, "decode", serviceVersion, err)
+	}
+	if missing := missingFields(raw, out); len(missing) > 0 {
+		return c.schemaMismatch(ctx, endpoint, "missing_fields", serviceVersion,
+			fmt.Errorf("response lacks required fields %s", strings.Join(missing, ", ")))
+	}
+
+	// Re-marshalling the raw map is cheap next to the network round trip and
+	// keeps field-level decoding in encoding/json.
+	buf, _ := json.Marshal(raw)
+	if err := json.Unmarshal(buf, out); err != nil {
+		return c.schemaMismatch(ctx, endpoint, "decode", serviceVersion, err)
+	}
+	return nil
+}
+
+// send posts body to endpoint on the first healthy ml-service endpoint that
+// answers, failing over to the next on transport errors, 5xx and 429. A 429
+// is first retried on the same endpoint after its Retry-After, within the
+// request's ai_service.rate_limit budget, and does not count against the
+// endpoint's breaker. Other error statuses are the same on every endpoint
+// and are returned at once. The returned response always has status 200.
+func (c *Client) send(ctx context.Context, endpoint string, body []byte) (*http.Response, error) {
+	n := len(c.endpoints)
+	if n == 0 {
+		return nil, fmt.Errorf("%w: no ai_service.url configured", ErrUnavailable)
+	}
+	start := 0
+	if c.roundRobin {
+		start = int((c.next.Add(1) - 1) % uint32(n))
+	}
+
+	var lastErr error
+	retries := c.rateLimitRetries
+	for i := 0; i < n; i++ {
+		ep := c.endpoints[(start+i)%n]
+		if !ep.allow() {
+			continue
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.url+endpoint, bytes.NewReader(body))
+		if err != nil {
+			ep.release()
+			return nil, fmt.Errorf("failed to build %s request: %w", endpoint, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(schemaHeader, SchemaVersion)
+		if c.apiKey != "" {
+			req.Header.Set("X-API-Key", c.apiKey)
+		}
+		if id := logging.RequestID(ctx); id != "" {
+			req.Header.Set(logging.RequestIDHeader, id)
+		}
+		tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				ep.release()
+				return nil, fmt.Errorf("%w: %s: %v", ErrUnavailable, endpoint, err)
+			}
+			lastErr = fmt.Errorf("%w: %s: %v", ErrUnavailable, endpoint, err)
+			c.failed(ctx, ep, endpoint, lastErr)
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			ep.record(false)
+			return resp, nil
+		}
+
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		err = fmt.Errorf("%w: %s returned %s", ErrUnavailable, endpoint, resp.Status)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			// The endpoint is healthy, only busy.
+			ep.record(false)
+			metrics.AIRateLimited.WithLabelValues(ep.url).Inc()
+			lastErr = err
+			wait := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+			if retries == 0 || wait > c.rateLimitMaxWait {
+				continue
+			}
+			retries--
+			logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{
+				"url":         ep.url,
+				"endpoint":    endpoint,
+				"retry_after": wait,
+			}).Info("AI service endpoint is rate limiting, retrying after the requested delay")
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil, fmt.Errorf("%w: %s: %v", ErrUnavailable, endpoint, ctx.Err())
+			case <-t.C:
+			}
+			i-- // the same endpoint again
+			continue
+		}
+		if resp.StatusCode < 500 {
+			ep.record(false)
+			return nil, err
+		}
+		lastErr = err
+		c.failed(ctx, ep, endpoint, lastErr)
+	}
+
+	if lastErr == nil {
+		return nil, fmt.Errorf("%w: %s: every endpoint's circuit breaker is open", ErrUnavailable, endpoint)
+	}
+	return nil, lastErr
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as an HTTP
+// date, into a delay. A missing or unparseable one yields
+// DefaultRetryAfter.
+func retryAfter(header string, now time.Time) time.Duration {
+	if secs, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0)
+	}
+	return DefaultRetryAfter
+}
+
+// failed records a failed request against ep.
+func (c *Client) failed(ctx context.Context, ep *endpoint, endpoint string, err error) {
+	ep.record(true)
+	metrics.AIEndpointFailures.WithLabelValues(ep.url).Inc()
+	logging.FromContext(ctx, c.logger).WithError(err).WithFields(logrus.Fields{
+		"url":      ep.url,
+		"endpoint": endpoint,
+	}).Warn("AI service endpoint failed")
+}
+
+// Health asks every configured endpoint for GET /health and returns an error
+// naming those that do not answer 200. It bypasses the circuit breakers, so
+// an open breaker neither hides an endpoint nor is affected by the check.
+func (c *Client) Health(ctx context.Context) error {
+	if len(c.endpoints) == 0 {
+		return fmt.Errorf("%w: no ai_service.url configured", ErrUnavailable)
+	}
+	var failed []string
+	for _, ep := range c.endpoints {
+		if err := c.health(ctx, ep.url); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnavailable, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (c *Client) health(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/health", nil)
+	if err != nil {
+		return fmt.Errorf("%s: %v", url, err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s/health returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+func checkVersion(serviceVersion string) error {
+	want, err := schemaMajor(SchemaVersion)
+	if err != nil {
+		return err
+	}
+	got, err := schemaMajor(serviceVersion)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("service speaks schema %s, engine speaks %s", serviceVersion, SchemaVersion)
+	}
+	return nil
+}
+
+// schemaMismatch records an incompatible response loudly and decides, based
+// on strict mode, whether the caller fails or falls back.
+func (c *Client) schemaMismatch(ctx context.Context, endpoint, reason, serviceVersion string, cause error) error {
+	metrics.AISchemaMismatches.WithLabelValues(endpoint, reason).Inc()
+
+	logging.FromContext(ctx, c.logger).WithError(cause).WithFields(logrus.Fields{
+		"endpoint":       endpoint,
+		"reason":         reason,
+		"engine_schema":  SchemaVersion,
+		"service_schema": serviceVersion,
+		"strict":         c.strictSchema,
+	}).Error("AI service response schema is incompatible")
+
+	if c.strictSchema {
+		return fmt.Errorf("%w: %s: %v", ErrSchemaMismatch, endpoint, cause)
+	}
+	return fmt.Errorf("%w: %w: %s: %v", ErrUnavailable, ErrSchemaMismatch, endpoint, cause)
+}
@@ -0,0 +1,369 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+func newTestClient(t *testing.T, strict bool, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return New(config.AIServiceConfig{URL: []string{srv.URL}, StrictSchema: strict}, egress.Config{}, logger)
+}
+
+const selectionBody = `{"project_name":"p","total_tests":3,"selected_tests":["a"],"skipped_tests":["b","c"],"confidence":0.9}`
+
+func TestPostAcceptsCompatibleMinorVersion(t *testing.T) {
+	c := newTestClient(t, false, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(schemaHeader); got != SchemaVersion {
+			t.Errorf("request schema header = %q", got)
+		}
+		w.Header().Set(schemaHeader, "1.3")
+		io.WriteString(w, `{"project_name":"p","total_tests":3,"selected_tests":["a"],"confidence":0.9,"new_field":true}`)
+	})
+
+	var out TestSelectionResponse
+	if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+	if out.TotalTests != 3 || out.Confidence != 0.9 {
+		t.Errorf("unexpected response %+v", out)
+	}
+}
+
+func TestPostForwardsRequestID(t *testing.T) {
+	c := newTestClient(t, false, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(logging.RequestIDHeader); got != "req-42" {
+			t.Errorf("request ID header = %q, want req-42", got)
+		}
+		io.WriteString(w, selectionBody)
+	})
+
+	var out TestSelectionResponse
+	if err := c.post(logging.WithRequestID(context.Background(), "req-42"), "/select", TestSelectionRequest{}, &out); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+}
+
+func TestPostTreatsUnversionedServiceAsLegacy(t *testing.T) {
+	c := newTestClient(t, true, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, selectionBody)
+	})
+
+	var out TestSelectionResponse
+	if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+}
+
+func TestPostFallsBackOnMajorMismatch(t *testing.T) {
+	c := newTestClient(t, false, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(schemaHeader, "2.0")
+		io.WriteString(w, selectionBody)
+	})
+
+	var out TestSelectionResponse
+	err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out)
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("post() error = %v, want ErrUnavailable wrapping ErrSchemaMismatch", err)
+	}
+}
+
+func TestPostStrictFailsOnMissingFields(t *testing.T) {
+	c := newTestClient(t, true, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"project_name":"p","selected_tests":["a"]}`)
+	})
+
+	var out TestSelectionResponse
+	err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out)
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("post() error = %v, want ErrSchemaMismatch", err)
+	}
+	if errors.Is(err, ErrUnavailable) {
+		t.Fatalf("strict mode must not fall back: %v", err)
+	}
+}
+
+func TestLowConfidenceFallsBackToSafeDefault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != endpointSelect {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		io.WriteString(w, `{"project_name":"p","total_tests":3,"selected_tests":["a"],"confidence":0.4}`)
+	}))
+	t.Cleanup(srv.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// The test selection threshold overrides min_confidence.
+	c := New(config.AIServiceConfig{URL: []string{srv.URL}, Enabled: true, MinConfidence: 0.3, TestSelectionThreshold: 0.6}, egress.Config{}, logger)
+	resp, err := c.SelectTests(context.Background(), TestSelectionRequest{ProjectName: "p"})
+	if resp != nil || !errors.Is(err, ErrLowConfidence) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("SelectTests() = %v, %v; want ErrLowConfidence wrapped as ErrUnavailable", resp, err)
+	}
+
+	d := Decide(KindTestSelection, 0, err)
+	if d.Applied || d.Confidence != 0.4 || d.Reason == "" {
+		t.Fatalf("decision = %+v", d)
+	}
+
+	c.selectionThreshold = 0.3
+	resp, err = c.SelectTests(context.Background(), TestSelectionRequest{ProjectName: "p"})
+	if err != nil {
+		t.Fatalf("SelectTests() error = %v", err)
+	}
+	if d := Decide(KindTestSelection, resp.Confidence, nil); !d.Applied {
+		t.Fatalf("decision = %+v, want applied", d)
+	}
+}
+
+func TestPostFailsOverAndSkipsOpenEndpoint(t *testing.T) {
+	var downHits, upHits int
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downHits++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upHits++
+		io.WriteString(w, selectionBody)
+	}))
+	t.Cleanup(up.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	c := New(config.AIServiceConfig{
+		URL:     []string{down.URL, up.URL},
+		Breaker: config.AIBreakerConfig{FailureThreshold: 2},
+	}, egress.Config{}, logger)
+	for i := 0; i < 4; i++ {
+		var out TestSelectionResponse
+		if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); err != nil {
+			t.Fatalf("post() #%d error = %v", i, err)
+		}
+	}
+	if downHits != 2 || upHits != 4 {
+		t.Fatalf("hits = down %d, up %d; want the open endpoint skipped after 2 failures", downHits, upHits)
+	}
+	if got := testutil.ToFloat64(metrics.AIBreakerState.WithLabelValues(down.URL)); got != float64(breakerOpen) {
+		t.Errorf("down breaker state = %v, want open", got)
+	}
+	if got := testutil.ToFloat64(metrics.AIBreakerState.WithLabelValues(up.URL)); got != float64(breakerClosed) {
+		t.Errorf("up breaker state = %v, want closed", got)
+	}
+}
+
+func TestPostDoesNotFailOverOnClientError(t *testing.T) {
+	var secondHits int
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	t.Cleanup(bad.Close)
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondHits++
+		io.WriteString(w, selectionBody)
+	}))
+	t.Cleanup(second.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	c := New(config.AIServiceConfig{URL: []string{bad.URL, second.URL}}, egress.Config{}, logger)
+	var out TestSelectionResponse
+	err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out)
+	if !errors.Is(err, ErrUnavailable) || secondHits != 0 {
+		t.Fatalf("post() error = %v, second hits = %d; want ErrUnavailable without failover", err, secondHits)
+	}
+}
+
+func TestPostRetriesRateLimitedRequest(t *testing.T) {
+	var hits int
+	c := newTestClient(t, false, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		io.WriteString(w, selectionBody)
+	})
+	c.rateLimitRetries = 1
+	limited := testutil.ToFloat64(metrics.AIRateLimited.WithLabelValues(c.endpoints[0].url))
+	failures := testutil.ToFloat64(metrics.AIEndpointFailures.WithLabelValues(c.endpoints[0].url))
+
+	var out TestSelectionResponse
+	if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+	if hits != 2 {
+		t.Errorf("hits = %d, want the rate limited request retried once", hits)
+	}
+	if got := testutil.ToFloat64(metrics.AIRateLimited.WithLabelValues(c.endpoints[0].url)); got != limited+1 {
+		t.Errorf("rate limited counter = %v, want %v", got, limited+1)
+	}
+	if got := testutil.ToFloat64(metrics.AIEndpointFailures.WithLabelValues(c.endpoints[0].url)); got != failures {
+		t.Errorf("failure counter = %v, want a 429 not counted as a failure", got)
+	}
+}
+
+func TestPostFallsBackWhenRateLimitOutlastsBudget(t *testing.T) {
+	var hits int
+	wait := "0"
+	c := newTestClient(t, false, func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Retry-After", wait)
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	c.rateLimitRetries = 2
+	c.rateLimitMaxWait = time.Minute
+
+	var out TestSelectionResponse
+	if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("post() error = %v, want ErrUnavailable", err)
+	}
+	if hits != 3 {
+		t.Errorf("hits = %d, want the first attempt and 2 retries", hits)
+	}
+
+	// A Retry-After beyond max_wait is not waited for at all.
+	hits, wait = 0, "120"
+	if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("post() error = %v, want ErrUnavailable", err)
+	}
+	if hits != 1 {
+		t.Errorf("hits = %d, want no retry past max_wait", hits)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for header, want := range map[string]time.Duration{
+		"7":                             7 * time.Second,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+		"":                              DefaultRetryAfter,
+		"soon":                          DefaultRetryAfter,
+	} {
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("retryAfter(%q) = %s, want %s", header, got, want)
+		}
+	}
+}
+
+func TestRoundRobinRotatesFirstEndpoint(t *testing.T) {
+	hits := map[string]int{}
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+			io.WriteString(w, selectionBody)
+		}
+	}
+	a := httptest.NewServer(handler("a"))
+	t.Cleanup(a.Close)
+	b := httptest.NewServer(handler("b"))
+	t.Cleanup(b.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	c := New(config.AIServiceConfig{URL: []string{a.URL, b.URL}, Failover: FailoverRoundRobin}, egress.Config{}, logger)
+	for i := 0; i < 4; i++ {
+		var out TestSelectionResponse
+		if err := c.post(context.Background(), "/select", TestSelectionRequest{}, &out); err != nil {
+			t.Fatalf("post() error = %v", err)
+		}
+	}
+	if hits["a"] != 2 || hits["b"] != 2 {
+		t.Fatalf("hits = %v, want 2 each", hits)
+	}
+}
+
+func TestHealthNamesFailingEndpoints(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			t.Errorf("path = %q, want /health", r.URL.Path)
+		}
+	}))
+	defer healthy.Close()
+	sick := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer sick.Close()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c := New(config.AIServiceConfig{URL: []string{healthy.URL}}, egress.Config{}, logger)
+	if err := c.Health(context.Background()); err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+
+	c = New(config.AIServiceConfig{URL: []string{healthy.URL, sick.URL}}, egress.Config{}, logger)
+	err := c.Health(context.Background())
+	if !errors.Is(err, ErrUnavailable) || !strings.Contains(err.Error(), sick.URL) || strings.Contains(err.Error(), healthy.URL+"/") {
+		t.Errorf("Health() error = %v, want ErrUnavailable naming only %s", err, sick.URL)
+	}
+}
+
+func TestPostRecordsRedactedExchange(t *testing.T) {
+	c := newTestClient(t, false, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"project_name":"p","total_tests":3,"selected_tests":["a"],"confidence":0.9,"service_token":"s3cr3t"}`)
+	})
+	var got []pipeline.AIExchange
+	ctx := WithAudit(context.Background(), func(x pipeline.AIExchange) { got = append(got, x) })
+
+	secret := "ghp_" + strings.Repeat("a", 36)
+	var out TestSelectionResponse
+	if err := c.post(ctx, "/select", TestSelectionRequest{ProjectName: "p", ChangedFiles: []string{"deploy.sh", secret}}, &out); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("recorded %d exchanges, want 1", len(got))
+	}
+	x := got[0]
+	if x.Endpoint != "/select" || !strings.Contains(x.Request, "deploy.sh") || x.Truncated || x.Error != "" {
+		t.Errorf("exchange = %+v", x)
+	}
+	if strings.Contains(x.Request, secret) || strings.Contains(x.Response, "s3cr3t") || !strings.Contains(x.Response, logging.Redacted) {
+		t.Errorf("exchange not redacted: request %s, response %s", x.Request, x.Response)
+	}
+
+	c.auditMaxBytes = 16
+	got = nil
+	if err := c.post(ctx, "/select", TestSelectionRequest{ProjectName: "p"}, &out); err != nil {
+		t.Fatalf("post() error = %v", err)
+	}
+	if x := got[0]; !x.Truncated || len(x.Request) > 16 || len(x.Response) > 16 {
+		t.Errorf("exchange over audit_max_bytes = %+v, want both payloads cut at 16 bytes", x)
+	}
+}
+
+func TestBreakerSettingsTopLevelKeys(t *testing.T) {
+	cfg := config.AIServiceConfig{URL: []string{"http://ml"}, Breaker: config.AIBreakerConfig{FailureThreshold: 5, OpenDuration: time.Minute}}
+	if ep := newEndpoints(cfg)[0]; ep.threshold != 5 || ep.openFor != time.Minute {
+		t.Errorf("breaker keys: threshold = %d, open for %s; want 5, 1m", ep.threshold, ep.openFor)
+	}
+
+	cfg.FailureThreshold, cfg.Cooldown = 2, 10*time.Second
+	if ep := newEndpoints(cfg)[0]; ep.threshold != 2 || ep.openFor != 10*time.Second {
+		t.Errorf("failure_threshold and cooldown: threshold = %d, open for %s; want 2, 10s", ep.threshold, ep.openFor)
+	}
+}
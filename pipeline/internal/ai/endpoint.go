@@ -0,0 +1,154 @@
+package ai
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	// DefaultFailureThreshold is used when neither
+	// ai_service.failure_threshold nor ai_service.breaker.failure_threshold
+	// is set.
+	DefaultFailureThreshold = 3
+	// DefaultOpenDuration is used when neither ai_service.cooldown nor
+	// ai_service.breaker.open_duration is set.
+	DefaultOpenDuration = 30 * time.Second
+	// DefaultRateLimitMaxWait is used when ai_service.rate_limit.max_wait is
+	// not set.
+	DefaultRateLimitMaxWait = 10 * time.Second
+	// DefaultRetryAfter is waited on a 429 without a usable Retry-After.
+	DefaultRetryAfter = time.Second
+
+	// FailoverOrdered tries the endpoints in the listed order.
+	FailoverOrdered = "ordered"
+	// FailoverRoundRobin rotates the first endpoint tried.
+	FailoverRoundRobin = "round_robin"
+)
+
+// breakerState values are those reported by metrics.AIBreakerState.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// endpoint is one ml-service base URL with its own circuit breaker. After
+// threshold consecutive failures the endpoint is skipped for openFor, then a
+// single probe request decides whether it is healthy again.
+type endpoint struct {
+	url       string
+	threshold int
+	openFor   time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newEndpoints builds the endpoints listed by cfg.URL, ignoring blanks.
+func newEndpoints(cfg config.AIServiceConfig) []*endpoint {
+	threshold := cfg.Breaker.FailureThreshold
+	if cfg.FailureThreshold > 0 {
+		threshold = cfg.FailureThreshold
+	}
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	openFor := cfg.Breaker.OpenDuration
+	if cfg.Cooldown > 0 {
+		openFor = cfg.Cooldown
+	}
+	if openFor <= 0 {
+		openFor = DefaultOpenDuration
+	}
+
+	var eps []*endpoint
+	for _, u := range cfg.URL {
+		u = strings.TrimRight(strings.TrimSpace(u), "/")
+		if u == "" {
+			continue
+		}
+		eps = append(eps, &endpoint{url: u, threshold: threshold, openFor: openFor, now: time.Now})
+		metrics.AIBreakerState.WithLabelValues(u).Set(float64(breakerClosed))
+	}
+	return eps
+}
+
+// allow reports whether a request may be sent to the endpoint. A true result
+// in the half-open state claims the probe, so the caller must record the
+// outcome.
+func (e *endpoint) allow() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch e.state {
+	case breakerOpen:
+		if e.now().Sub(e.openedAt) < e.openFor {
+			return false
+		}
+		e.setState(breakerHalfOpen)
+		e.probing = true
+		return true
+	case breakerHalfOpen:
+		if e.probing {
+			return false
+		}
+		e.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a request.
+func (e *endpoint) record(failed bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.state == breakerHalfOpen {
+		e.probing = false
+		if failed {
+			e.setState(breakerOpen)
+			e.openedAt = e.now()
+			return
+		}
+		e.setState(breakerClosed)
+		e.failures = 0
+		return
+	}
+
+	if !failed {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if e.failures >= e.threshold {
+		e.setState(breakerOpen)
+		e.openedAt = e.now()
+	}
+}
+
+// setState moves the breaker to state. The caller holds e.mu.
+func (e *endpoint) setState(state breakerState) {
+	e.state = state
+	metrics.AIBreakerState.WithLabelValues(e.url).Set(float64(state))
+}
+
+// release gives back a claimed probe without a verdict, for requests
+// abandoned by the caller.
+func (e *endpoint) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state == breakerHalfOpen {
+		e.probing = false
+	}
+}
@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// EnvironmentLabel is the spec label naming the environment a run targets,
+// matched by the environment of ai_service.gates rules.
+const EnvironmentLabel = "environment"
+
+// Kinds lists the AI features that can be gated, by decision kind.
+var Kinds = []string{KindBuildOptimization, KindFailurePrediction, KindTestSelection}
+
+// Gates decides which AI features are enabled for a run from the
+// ai_service.gates rules. For each feature the first rule matching the run
+// that sets it wins; a feature no matching rule sets follows
+// ai_service.enabled.
+type Gates struct {
+	enabled bool
+	rules   []config.AIGateConfig
+}
+
+// NewGates checks the gate rules of cfg and compiles them.
+func NewGates(cfg config.AIServiceConfig) (*Gates, error) {
+	for i, rule := range cfg.Gates {
+		if rule.Branch != "" {
+			if _, err := path.Match(rule.Branch, ""); err != nil {
+				return nil, fmt.Errorf("ai_service.gates[%d].branch: invalid pattern %q: %w", i, rule.Branch, err)
+			}
+		}
+		for kind := range rule.Features {
+			if !knownKind(kind) {
+				return nil, fmt.Errorf("ai_service.gates[%d].features: unknown feature %q (%v)", i, kind, Kinds)
+			}
+		}
+	}
+	return &Gates{enabled: cfg.Enabled, rules: cfg.Gates}, nil
+}
+
+// Resolve returns whether each AI feature is enabled for runs of spec.
+func (g *Gates) Resolve(spec *pipeline.Spec) map[string]bool {
+	out := make(map[string]bool, len(Kinds))
+	for _, kind := range Kinds {
+		out[kind] = g.enabled
+		for _, rule := range g.rules {
+			if on, ok := rule.Features[kind]; ok && matches(rule, spec) {
+				out[kind] = on
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Gated returns an error wrapping ErrUnavailable when the gates recorded on
+// run disable the feature of the given kind, so callers fall back to the
+// safe default as they do when the service is down. Runs recorded without
+// gates are not restricted.
+func Gated(run *pipeline.Run, kind string) error {
+	if on, ok := run.AIGates[kind]; ok && !on {
+		return fmt.Errorf("%w: %s disabled for this run by ai_service.gates", ErrUnavailable, kind)
+	}
+	return nil
+}
+
+func matches(rule config.AIGateConfig, spec *pipeline.Spec) bool {
+	if rule.Environment != "" && spec.Labels[EnvironmentLabel] != rule.Environment {
+		return false
+	}
+	if rule.Branch != "" {
+		if ok, _ := path.Match(rule.Branch, spec.Branch); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func knownKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestGatesResolve(t *testing.T) {
+	gates, err := NewGates(config.AIServiceConfig{
+		Enabled: true,
+		Gates: []config.AIGateConfig{
+			{Environment: "production", Features: map[string]bool{KindBuildOptimization: false}},
+			{Branch: "release/*", Features: map[string]bool{KindTestSelection: false}},
+			{Features: map[string]bool{KindBuildOptimization: true, KindTestSelection: true}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewGates: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		spec pipeline.Spec
+		want map[string]bool
+	}{
+		{
+			name: "production release branch",
+			spec: pipeline.Spec{Branch: "release/1.2", Labels: map[string]string{EnvironmentLabel: "production"}},
+			want: map[string]bool{KindBuildOptimization: false, KindFailurePrediction: true, KindTestSelection: false},
+		},
+		{
+			name: "staging main",
+			spec: pipeline.Spec{Branch: "main", Labels: map[string]string{EnvironmentLabel: "staging"}},
+			want: map[string]bool{KindBuildOptimization: true, KindFailurePrediction: true, KindTestSelection: true},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := gates.Resolve(&tc.spec)
+			for kind, want := range tc.want {
+				if got[kind] != want {
+					t.Errorf("%s = %v, want %v", kind, got[kind], want)
+				}
+			}
+		})
+	}
+}
+
+func TestGatesDefaultToEnabled(t *testing.T) {
+	gates, err := NewGates(config.AIServiceConfig{
+		Gates: []config.AIGateConfig{{Branch: "main", Features: map[string]bool{KindFailurePrediction: true}}},
+	})
+	if err != nil {
+		t.Fatalf("NewGates: %v", err)
+	}
+	got := gates.Resolve(&pipeline.Spec{Branch: "main"})
+	if !got[KindFailurePrediction] || got[KindTestSelection] || got[KindBuildOptimization] {
+		t.Fatalf("unexpected gates with ai_service disabled: %v", got)
+	}
+}
+
+func TestNewGatesRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []config.AIGateConfig{
+		{Branch: "release/[", Features: map[string]bool{KindTestSelection: true}},
+		{Features: map[string]bool{"flaky_detection": true}},
+	} {
+		if _, err := NewGates(config.AIServiceConfig{Gates: []config.AIGateConfig{rule}}); err == nil {
+			t.Errorf("expected %+v to be rejected", rule)
+		}
+	}
+}
+
+func TestGated(t *testing.T) {
+	run := &pipeline.Run{AIGates: map[string]bool{KindTestSelection: false, KindFailurePrediction: true}}
+	if err := Gated(run, KindTestSelection); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable for a disabled feature, got %v", err)
+	}
+	if err := Gated(run, KindFailurePrediction); err != nil {
+		t.Fatalf("enabled feature gated: %v", err)
+	}
+	if err := Gated(&pipeline.Run{}, KindTestSelection); err != nil {
+		t.Fatalf("run without gates restricted: %v", err)
+	}
+}
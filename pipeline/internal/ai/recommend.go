@@ -0,0 +1,115 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	endpointOptimize = "/api/v1/build-optimizer/optimize"
+	endpointPredict  = "/api/v1/failure-predictor/predict"
+	endpointSelect   = "/api/v1/test-intelligence/select"
+)
+
+// Decision kinds recorded on runs.
+const (
+	KindBuildOptimization = "build_optimization"
+	KindFailurePrediction = "failure_prediction"
+	KindTestSelection     = "test_selection"
+)
+
+// ErrLowConfidence means the service answered but with a confidence below
+// ai_service.min_confidence, or ai_service.test_selection_threshold for test
+// selections. It is always wrapped with ErrUnavailable, so
+// callers fall back to the safe default exactly as if the service were down.
+var ErrLowConfidence = errors.New("ai recommendation below minimum confidence")
+
+// LowConfidenceError carries the rejected confidence so it can be recorded.
+type LowConfidenceError struct {
+	Endpoint   string
+	Confidence float64
+	Minimum    float64
+}
+
+func (e *LowConfidenceError) Error() string {
+	return fmt.Sprintf("%s: confidence %.2f below minimum %.2f", e.Endpoint, e.Confidence, e.Minimum)
+}
+
+// Is makes errors.Is match both ErrLowConfidence and ErrUnavailable.
+func (e *LowConfidenceError) Is(target error) bool {
+	return target == ErrLowConfidence || target == ErrUnavailable
+}
+
+// OptimizeBuild asks for a build strategy.
+func (c *Client) OptimizeBuild(ctx context.Context, req BuildOptimizationRequest) (*BuildOptimizationResponse, error) {
+	var out BuildOptimizationResponse
+	if err := c.recommend(ctx, endpointOptimize, req, &out, c.minConfidence, func() float64 { return out.ConfidenceScore }); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// PredictFailure asks how likely a pipeline is to fail.
+func (c *Client) PredictFailure(ctx context.Context, req FailurePredictionRequest) (*FailurePredictionResponse, error) {
+	var out FailurePredictionResponse
+	if err := c.recommend(ctx, endpointPredict, req, &out, c.minConfidence, func() float64 { return out.Confidence }); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SelectTests asks which tests a change needs. Selections below
+// ai_service.test_selection_threshold are rejected with a
+// LowConfidenceError, so callers run the whole suite.
+func (c *Client) SelectTests(ctx context.Context, req TestSelectionRequest) (*TestSelectionResponse, error) {
+	var out TestSelectionResponse
+	if err := c.recommend(ctx, endpointSelect, req, &out, c.selectionThreshold, func() float64 { return out.Confidence }); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) recommend(ctx context.Context, endpoint string, in interface{}, out response, minimum float64, confidence func() float64) error {
+	if !c.enabled {
+		return fmt.Errorf("%w: disabled by ai_service.enabled", ErrUnavailable)
+	}
+	if err := c.post(ctx, endpoint, in, out); err != nil {
+		return err
+	}
+
+	if got := confidence(); got < minimum {
+		metrics.AILowConfidence.WithLabelValues(endpoint).Inc()
+		logging.FromContext(ctx, c.logger).WithFields(logrus.Fields{
+			"endpoint":       endpoint,
+			"confidence":     got,
+			"min_confidence": minimum,
+		}).Info("Ignoring low-confidence AI recommendation")
+		return &LowConfidenceError{Endpoint: endpoint, Confidence: got, Minimum: minimum}
+	}
+	return nil
+}
+
+// Decide builds the run record for a recommendation of the given kind from
+// the confidence it was returned with and the error of the call, if any.
+func Decide(kind string, confidence float64, err error) pipeline.AIDecision {
+	d := pipeline.AIDecision{Kind: kind, Confidence: confidence, Applied: err == nil, At: time.Now().UTC()}
+
+	var low *LowConfidenceError
+	switch {
+	case err == nil:
+	case errors.As(err, &low):
+		d.Confidence = low.Confidence
+		d.Reason = fmt.Sprintf("confidence %.2f below minimum %.2f; using safe default", low.Confidence, low.Minimum)
+	default:
+		d.Reason = fmt.Sprintf("no usable recommendation; using safe default: %v", err)
+	}
+	return d
+}
@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the ai-service request/response schema version spoken by
+// this engine. Versions are "major.minor": a response is compatible when it
+// carries the same major version, and a newer minor version may only add
+// fields. Services that predate versioning do not send a version and are
+// treated as 1.0.
+const SchemaVersion = "1.0"
+
+const (
+	schemaHeader        = "X-DevMind-Schema-Version"
+	legacySchemaVersion = "1.0"
+)
+
+// response is implemented by every ai-service response type so the client
+// can tell a truncated payload from a complete one.
+type response interface {
+	requiredFields() []string
+}
+
+// BuildOptimizationRequest is sent to /api/v1/build-optimizer/optimize.
+type BuildOptimizationRequest struct {
+	ProjectName          string                 `json:"project_name"`
+	DependencyGraph      map[string][]string    `json:"dependency_graph,omitempty"`
+	HistoricalBuildTimes []float64              `json:"historical_build_times,omitempty"`
+	ResourceConstraints  map[string]interface{} `json:"resource_constraints,omitempty"`
+	CacheStats           *CacheStats            `json:"cache_stats,omitempty"`
+}
+
+// CacheStats summarizes how often the jobs of recent runs were satisfied
+// from cache.
+type CacheStats struct {
+	Jobs    int     `json:"jobs"`
+	Hits    int     `json:"hits"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// CacheKeySuggestion is a build cache suggested for the jobs of a stage.
+type CacheKeySuggestion struct {
+	Stage string `json:"stage"`
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+}
+
+// BuildOptimizationResponse is returned by /api/v1/build-optimizer/optimize.
+type BuildOptimizationResponse struct {
+	ProjectName         string                   `json:"project_name"`
+	RecommendedStrategy string                   `json:"recommended_strategy"`
+	EstimatedBuildTime  float64                  `json:"estimated_build_time"`
+	EstimatedSavings    float64                  `json:"estimated_savings"`
+	Optimizations       []map[string]interface{} `json:"optimizations"`
+	ConfidenceScore     float64                  `json:"confidence_score"`
+	CacheKeys           []CacheKeySuggestion     `json:"cache_keys,omitempty"`
+	// Parallelization suggests how many jobs of each stage to run at once.
+	Parallelization map[string]int `json:"parallelization,omitempty"`
+}
+
+func (BuildOptimizationResponse) requiredFields() []string {
+	return []string{"recommended_strategy", "estimated_build_time", "optimizations", "confidence_score"}
+}
+
+// FailurePredictionRequest is sent to /api/v1/failure-predictor/predict.
+type FailurePredictionRequest struct {
+	PipelineID        string                 `json:"pipeline_id"`
+	CommitHash        string                 `json:"commit_hash,omitempty"`
+	CodeChanges       map[string]interface{} `json:"code_changes,omitempty"`
+	HistoricalMetrics map[string]interface{} `json:"historical_metrics,omitempty"`
+}
+
+// FailurePredictionResponse is returned by /api/v1/failure-predictor/predict.
+type FailurePredictionResponse struct {
+	PipelineID          string                   `json:"pipeline_id"`
+	FailureProbability  float64                  `json:"failure_probability"`
+	RiskLevel           string                   `json:"risk_level"`
+	ContributingFactors []map[string]interface{} `json:"contributing_factors"`
+	Recommendations     []string                 `json:"recommendations"`
+	Confidence          float64                  `json:"confidence"`
+}
+
+func (FailurePredictionResponse) requiredFields() []string {
+	return []string{"failure_probability", "risk_level", "confidence"}
+}
+
+// TestSelectionRequest is sent to /api/v1/test-intelligence/select.
+type TestSelectionRequest struct {
+	ProjectName  string   `json:"project_name"`
+	CommitHash   string   `json:"commit_hash"`
+	ChangedFiles []string `json:"changed_files"`
+	AllTests     []string `json:"all_tests,omitempty"`
+	// TestHistory holds the test results of the stage in recent runs of the
+	// pipeline, newest first.
+	TestHistory []TestHistory `json:"test_history,omitempty"`
+}
+
+// TestHistory is the outcome of a stage's tests in a past run.
+type TestHistory struct {
+	CommitHash  string   `json:"commit_hash"`
+	Status      string   `json:"status"`
+	Tests       int      `json:"tests"`
+	Failed      int      `json:"failed"`
+	FailedTests []string `json:"failed_tests,omitempty"`
+}
+
+// TestSelectionResponse is returned by /api/v1/test-intelligence/select.
+type TestSelectionResponse struct {
+	ProjectName          string   `json:"project_name"`
+	TotalTests           int      `json:"total_tests"`
+	SelectedTests        []string `json:"selected_tests"`
+	SkippedTests         []string `json:"skipped_tests"`
+	EstimatedTimeSavings float64  `json:"estimated_time_savings"`
+	CoverageRetention    float64  `json:"coverage_retention"`
+	Confidence           float64  `json:"confidence"`
+}
+
+func (TestSelectionResponse) requiredFields() []string {
+	return []string{"total_tests", "selected_tests", "confidence"}
+}
+
+// schemaMajor extracts the major component of a "major.minor" version.
+func schemaMajor(version string) (int, error) {
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", version)
+	}
+	return n, nil
+}
+
+// missingFields reports which of out's required fields are absent from raw.
+func missingFields(raw map[string]json.RawMessage, out response) []string {
+	var missing []string
+	for _, f := range out.requiredFields() {
+		if v, ok := raw[f]; !ok || string(v) == "null" {
+			missing = append(missing, f)
+		}
+	}
+	return missing
+}
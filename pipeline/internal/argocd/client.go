@@ -0,0 +1,446 @@
+// Package argocd is a minimal client for the ArgoCD REST API.
+//
+// Authentication uses a static API token, a token read from a Kubernetes
+// secret, or a username/password session. Secret tokens and sessions are
+// tracked by the expiry embedded in their JWT and renewed shortly before it;
+// if the server still rejects one (revoked, rotated, server restarted, clock
+// skew) the client reads the secret or logs in again and retries the request
+// once.
+package argocd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+// sessionRefreshMargin is how long before expiry a session is renewed.
+const sessionRefreshMargin = time.Minute
+
+var (
+	// ErrUnauthorized is returned when ArgoCD rejects the credentials.
+	ErrUnauthorized = errors.New("argocd: unauthorized")
+	// ErrNotFound is returned when the requested resource does not exist.
+	ErrNotFound = errors.New("argocd: not found")
+)
+
+// SecretReader reads a key of a Kubernetes secret. It is satisfied by
+// *tekton.Client.
+type SecretReader interface {
+	SecretValue(ctx context.Context, namespace, name, key string) (string, error)
+}
+
+// Client talks to a single ArgoCD server.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *logrus.Logger
+	// timeout bounds how long SyncAndWait waits for an application and
+	// pollInterval how often it checks on it.
+	timeout      time.Duration
+	pollInterval time.Duration
+	// rollback and grace configure WatchHealth.
+	rollback bool
+	grace    time.Duration
+
+	staticToken string
+	secrets     SecretReader
+	secretNS    string
+	secretName  string
+	secretKey   string
+	username    string
+	password    string
+	reauthRetry bool
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// New creates a Client from cfg. argocd.server may be given with or without
+// a scheme; https is assumed. Requests go through the proxy network
+// configures for ArgoCD. secrets reads argocd.token_secret and is only
+// needed when it is set.
+func New(cfg config.ArgoCDConfig, network egress.Config, secrets SecretReader, logger *logrus.Logger) (*Client, error) {
+	if cfg.Server == "" {
+		return nil, fmt.Errorf("argocd.server is required")
+	}
+	if cfg.Token == "" && cfg.TokenSecret == "" && (cfg.Username == "" || cfg.Password == "") {
+		return nil, fmt.Errorf("argocd.token, argocd.token_secret or argocd.username and argocd.password are required")
+	}
+	var secretNS, secretName string
+	if cfg.Token == "" && cfg.TokenSecret != "" {
+		var ok bool
+		if secretNS, secretName, ok = strings.Cut(cfg.TokenSecret, "/"); !ok {
+			return nil, fmt.Errorf("argocd.token_secret must be namespace/name, got %q", cfg.TokenSecret)
+		}
+		if secrets == nil {
+			return nil, fmt.Errorf("argocd.token_secret requires access to Kubernetes secrets")
+		}
+	}
+	secretKey := cfg.TokenSecretKey
+	if secretKey == "" {
+		secretKey = "token"
+	}
+
+	base := cfg.Server
+	if !strings.Contains(base, "://") {
+		base = "https://" + base
+	}
+
+	transport := network.Transport(egress.ClientArgoCD)
+	if cfg.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- opt-in via argocd.insecure
+	}
+
+	return &Client{
+		baseURL:     strings.TrimRight(base, "/"),
+		httpClient:  &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		logger:      logger,
+		timeout:     cfg.Timeout,
+		rollback:    cfg.RollbackEnabled,
+		grace:       cfg.HealthGracePeriod,
+		staticToken: cfg.Token,
+		secretName:  secretName,
+		secretNS:    secretNS,
+		secretKey:   secretKey,
+		secrets:     secrets,
+		username:    cfg.Username,
+		password:    cfg.Password,
+		reauthRetry: cfg.ReauthRetry,
+	}, nil
+}
+
+// Ping checks that the server is reachable and accepts the configured
+// credentials, logging in first when they are a username and password.
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/api/v1/session/userinfo", nil, nil)
+}
+
+// Application is the subset of an ArgoCD Application the engine uses.
+type Application struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Status ApplicationStatus `json:"status"`
+}
+
+// ApplicationStatus holds an application's sync and health state.
+type ApplicationStatus struct {
+	Sync struct {
+		Status   string `json:"status"`
+		Revision string `json:"revision"`
+	} `json:"sync"`
+	Health struct {
+		Status  string `json:"status"`
+		Message string `json:"message,omitempty"`
+	} `json:"health"`
+	// OperationState is the state of the latest sync operation, if any.
+	OperationState *OperationState `json:"operationState,omitempty"`
+	// History lists the revisions the application was synced to, oldest
+	// first.
+	History []RevisionHistory `json:"history,omitempty"`
+}
+
+// RevisionHistory is a revision an application was synced to.
+type RevisionHistory struct {
+	ID         int64     `json:"id"`
+	Revision   string    `json:"revision"`
+	DeployedAt time.Time `json:"deployedAt"`
+}
+
+// OperationState is the state of an ArgoCD sync operation.
+type OperationState struct {
+	// Phase is Running, Terminating, Succeeded, Failed or Error.
+	Phase     string    `json:"phase"`
+	Message   string    `json:"message,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// GetApplication fetches an application by name.
+func (c *Client) GetApplication(ctx context.Context, name string) (*Application, error) {
+	var app Application
+	if err := c.do(ctx, http.MethodGet, "/api/v1/applications/"+url.PathEscape(name), nil, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// SyncRequest holds the options of an application sync.
+type SyncRequest struct {
+	Revision string `json:"revision,omitempty"`
+	Prune    bool   `json:"prune,omitempty"`
+}
+
+// Sync starts a sync of the named application.
+func (c *Client) Sync(ctx context.Context, name string, req SyncRequest) (*Application, error) {
+	var app Application
+	if err := c.do(ctx, http.MethodPost, "/api/v1/applications/"+url.PathEscape(name)+"/sync", req, &app); err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// Sync and health states SyncAndWait waits for.
+const (
+	SyncStatusSynced     = "Synced"
+	HealthStatusHealthy  = "Healthy"
+	HealthStatusDegraded = "Degraded"
+)
+
+// DefaultPollInterval is how often SyncAndWait checks on the application.
+const DefaultPollInterval = 5 * time.Second
+
+var (
+	// ErrSyncFailed is returned by SyncAndWait when the sync operation
+	// fails or the application ends up degraded.
+	ErrSyncFailed = errors.New("argocd: sync failed")
+	// ErrSyncTimeout is returned by SyncAndWait when the application is not
+	// synced and healthy within argocd.timeout.
+	ErrSyncTimeout = errors.New("argocd: sync timed out")
+)
+
+// SyncAndWait starts a sync of the named application and waits, up to
+// argocd.timeout, for the sync operation to succeed with the application
+// Synced and Healthy. It returns the application as last seen, also with
+// the errors matching ErrSyncFailed and ErrSyncTimeout.
+func (c *Client) SyncAndWait(ctx context.Context, name string, req SyncRequest) (*Application, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	app, err := c.Sync(ctx, name, req)
+	if err != nil {
+		return nil, err
+	}
+	// The operation state the sync response reports may still be that of
+	// an earlier sync; only a newer one belongs to this sync.
+	var previous time.Time
+	if op := app.Status.OperationState; op != nil {
+		previous = op.StartedAt
+	}
+	interval := c.pollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return app, fmt.Errorf("%w after %s: sync %s, health %s", ErrSyncTimeout, c.timeout, app.Status.Sync.Status, app.Status.Health.Status)
+			}
+			return app, ctx.Err()
+		case <-ticker.C:
+		}
+		current, err := c.GetApplication(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			return app, err
+		}
+		app = current
+		op := app.Status.OperationState
+		if op == nil || !op.StartedAt.After(previous) {
+			continue
+		}
+		switch op.Phase {
+		case "Failed", "Error":
+			return app, fmt.Errorf("%w: operation %s: %s", ErrSyncFailed, op.Phase, op.Message)
+		case "Succeeded":
+			switch {
+			case app.Status.Health.Status == HealthStatusDegraded:
+				return app, fmt.Errorf("%w: application is degraded: %s", ErrSyncFailed, app.Status.Health.Message)
+			case app.Status.Sync.Status == SyncStatusSynced && app.Status.Health.Status == HealthStatusHealthy:
+				return app, nil
+			}
+		}
+	}
+}
+
+// do performs an authenticated request. With argocd.reauth_retry set, a 401
+// on a session token triggers one re-login and retry.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return fmt.Errorf("failed to encode argocd request: %w", err)
+		}
+	}
+
+	token, err := c.sessionToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.send(ctx, method, path, token, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && c.staticToken == "" && c.reauthRetry {
+		drain(resp)
+		c.logger.WithField("path", path).Info("ArgoCD session rejected, re-authenticating")
+		c.invalidate(token)
+		if token, err = c.sessionToken(ctx); err != nil {
+			return err
+		}
+		if resp, err = c.send(ctx, method, path, token, body); err != nil {
+			return err
+		}
+	}
+	defer drain(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s %s returned %s", ErrUnauthorized, method, path, resp.Status)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, path)
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("argocd: %s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode argocd response: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) send(ctx context.Context, method, path, token string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("argocd: %s %s: %w", method, path, err)
+	}
+	return resp, nil
+}
+
+// sessionToken returns a token valid for at least sessionRefreshMargin,
+// reading the token secret or logging in when there is none or it is about
+// to expire.
+func (c *Client) sessionToken(ctx context.Context) (string, error) {
+	if c.staticToken != "" {
+		return c.staticToken, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiresAt.IsZero() || time.Now().Add(sessionRefreshMargin).Before(c.expiresAt)) {
+		return c.token, nil
+	}
+	if c.token != "" {
+		c.logger.WithField("expires_at", c.expiresAt).Debug("ArgoCD session about to expire, renewing")
+	}
+
+	var token string
+	var err error
+	if c.secretName != "" {
+		token, err = c.secrets.SecretValue(ctx, c.secretNS, c.secretName, c.secretKey)
+		if err == nil && token == "" {
+			err = fmt.Errorf("argocd: secret %s/%s holds an empty token", c.secretNS, c.secretName)
+		}
+	} else {
+		token, err = c.login(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	c.expiresAt = tokenExpiry(token)
+	return token, nil
+}
+
+// invalidate drops the cached session if it is still the given token, so
+// concurrent callers that hit the same 401 only log in once.
+func (c *Client) invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+		c.expiresAt = time.Time{}
+	}
+}
+
+func (c *Client) login(ctx context.Context) (string, error) {
+	body, _ := json.Marshal(map[string]string{"username": c.username, "password": c.password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/api/v1/session", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("argocd: login: %w", err)
+	}
+	defer drain(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: login returned %s", ErrUnauthorized, resp.Status)
+	}
+
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || out.Token == "" {
+		return "", fmt.Errorf("argocd: login returned no token")
+	}
+	return out.Token, nil
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it; the server
+// does that. A zero time means the expiry is unknown.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,367 @@
+package argocd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+func testJWT(exp time.Time, n int) string {
+	enc := base64.RawURLEncoding
+	payload, _ := json.Marshal(map[string]int64{"exp": exp.Unix(), "n": int64(n)})
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString(payload) + ".sig"
+}
+
+// fakeArgoCD issues sessions with the given lifetime and accepts only the
+// most recently issued one, as a restarted server would.
+type fakeArgoCD struct {
+	mu       sync.Mutex
+	lifetime time.Duration
+	current  string
+	logins   int
+}
+
+func (f *fakeArgoCD) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/api/v1/session" {
+		f.logins++
+		f.current = testJWT(time.Now().Add(f.lifetime), f.logins)
+		json.NewEncoder(w).Encode(map[string]string{"token": f.current})
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer "+f.current {
+		http.Error(w, `{"error":"token is expired"}`, http.StatusUnauthorized)
+		return
+	}
+	fmt.Fprint(w, `{"metadata":{"name":"app"},"status":{"health":{"status":"Healthy"}}}`)
+}
+
+func (f *fakeArgoCD) expireSessions() {
+	f.mu.Lock()
+	f.current = "revoked"
+	f.mu.Unlock()
+}
+
+func newTestClient(t *testing.T, h http.Handler, cfg config.ArgoCDConfig) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg.Server = srv.URL
+	cfg.Timeout = 5 * time.Second
+	c, err := New(cfg, egress.Config{}, nil, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+func TestReauthenticatesOnExpiredSession(t *testing.T) {
+	fake := &fakeArgoCD{lifetime: time.Hour}
+	c := newTestClient(t, fake, config.ArgoCDConfig{Username: "admin", Password: "pw", ReauthRetry: true})
+	ctx := context.Background()
+
+	if _, err := c.GetApplication(ctx, "app"); err != nil {
+		t.Fatalf("GetApplication() error = %v", err)
+	}
+	fake.expireSessions()
+
+	app, err := c.GetApplication(ctx, "app")
+	if err != nil {
+		t.Fatalf("GetApplication() after expiry error = %v", err)
+	}
+	if app.Status.Health.Status != "Healthy" {
+		t.Fatalf("health = %q, want Healthy", app.Status.Health.Status)
+	}
+	if fake.logins != 2 {
+		t.Fatalf("logins = %d, want 2", fake.logins)
+	}
+}
+
+func TestNoRetryWhenDisabled(t *testing.T) {
+	fake := &fakeArgoCD{lifetime: time.Hour}
+	c := newTestClient(t, fake, config.ArgoCDConfig{Username: "admin", Password: "pw"})
+	ctx := context.Background()
+
+	if _, err := c.GetApplication(ctx, "app"); err != nil {
+		t.Fatalf("GetApplication() error = %v", err)
+	}
+	fake.expireSessions()
+
+	if _, err := c.GetApplication(ctx, "app"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("GetApplication() error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestRefreshesSessionBeforeExpiry(t *testing.T) {
+	// Sessions that expire inside the refresh margin are renewed up front,
+	// so no request is ever sent with them.
+	fake := &fakeArgoCD{lifetime: sessionRefreshMargin / 2}
+	var rejected int
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		fake.ServeHTTP(rec, r)
+		if rec.Code == http.StatusUnauthorized {
+			rejected++
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	})
+	c := newTestClient(t, h, config.ArgoCDConfig{Username: "admin", Password: "pw", ReauthRetry: true})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetApplication(ctx, "app"); err != nil {
+			t.Fatalf("GetApplication() error = %v", err)
+		}
+	}
+	if fake.logins != 3 {
+		t.Fatalf("logins = %d, want 3", fake.logins)
+	}
+	if rejected != 0 {
+		t.Fatalf("rejected = %d, want 0", rejected)
+	}
+}
+
+func TestStaticTokenIsNotRefreshed(t *testing.T) {
+	var logins int
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/session" {
+			logins++
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+	c := newTestClient(t, h, config.ArgoCDConfig{Token: "static", ReauthRetry: true})
+
+	if _, err := c.GetApplication(context.Background(), "app"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("GetApplication() error = %v, want ErrUnauthorized", err)
+	}
+	if logins != 0 {
+		t.Fatalf("logins = %d, want 0", logins)
+	}
+}
+
+// syncingArgoCD answers a sync with the application's previous operation
+// state and then reports the new operation through states, one per poll.
+type syncingArgoCD struct {
+	mu     sync.Mutex
+	states []string
+	synced SyncRequest
+}
+
+func (f *syncingArgoCD) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	earlier := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	app := map[string]interface{}{"metadata": map[string]string{"name": "web"}}
+	status := func(phase, sync, health string, started time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"sync":           map[string]string{"status": sync, "revision": "abc123"},
+			"health":         map[string]string{"status": health},
+			"operationState": map[string]interface{}{"phase": phase, "startedAt": started},
+		}
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/applications/web/sync":
+		json.NewDecoder(r.Body).Decode(&f.synced)
+		// Synced and healthy from an earlier sync, which must not count.
+		app["status"] = status("Succeeded", "Synced", "Healthy", earlier)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/applications/web":
+		state := f.states[0]
+		if len(f.states) > 1 {
+			f.states = f.states[1:]
+		}
+		phase, health := "Running", "Progressing"
+		switch state {
+		case "healthy":
+			phase, health = "Succeeded", "Healthy"
+		case "degraded":
+			phase, health = "Succeeded", "Degraded"
+		}
+		app["status"] = status(phase, "Synced", health, earlier.Add(time.Hour))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	json.NewEncoder(w).Encode(app)
+}
+
+func TestSyncAndWait(t *testing.T) {
+	for _, tc := range []struct {
+		states []string
+		want   error
+	}{
+		{[]string{"running", "running", "healthy"}, nil},
+		{[]string{"running", "degraded"}, ErrSyncFailed},
+		{[]string{"running"}, ErrSyncTimeout},
+	} {
+		fake := &syncingArgoCD{states: tc.states}
+		c := newTestClient(t, fake, config.ArgoCDConfig{Token: "static"})
+		c.pollInterval = 10 * time.Millisecond
+		c.timeout = 200 * time.Millisecond
+
+		app, err := c.SyncAndWait(context.Background(), "web", SyncRequest{Revision: "abc123", Prune: true})
+		if !errors.Is(err, tc.want) || (tc.want == nil && err != nil) {
+			t.Errorf("%v: SyncAndWait() error = %v, want %v", tc.states, err, tc.want)
+		}
+		if app == nil || app.Status.Sync.Revision != "abc123" {
+			t.Errorf("%v: SyncAndWait() app = %+v", tc.states, app)
+		}
+		if fake.synced != (SyncRequest{Revision: "abc123", Prune: true}) {
+			t.Errorf("sync request = %+v", fake.synced)
+		}
+	}
+}
+
+// secretTokens serves the token of a Kubernetes secret that rotates.
+type secretTokens struct {
+	mu    sync.Mutex
+	token string
+	reads int
+}
+
+func (s *secretTokens) SecretValue(ctx context.Context, namespace, name, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if namespace != "argocd" || name != "devmind-token" || key != "token" {
+		return "", fmt.Errorf("unexpected secret %s/%s key %s", namespace, name, key)
+	}
+	s.reads++
+	return s.token, nil
+}
+
+func TestTokenFromSecretIsReadAgainWhenRejected(t *testing.T) {
+	var mu sync.Mutex
+	accepted := "first"
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+accepted {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	secrets := &secretTokens{token: "first"}
+	c, err := New(config.ArgoCDConfig{Server: srv.URL, TokenSecret: "argocd/devmind-token", TokenSecretKey: "token", ReauthRetry: true}, egress.Config{}, secrets, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+
+	// The secret is rotated.
+	mu.Lock()
+	accepted = "second"
+	mu.Unlock()
+	secrets.mu.Lock()
+	secrets.token = "second"
+	secrets.mu.Unlock()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping() after rotation error = %v", err)
+	}
+	if secrets.reads != 2 {
+		t.Errorf("secret read %d times, want 2", secrets.reads)
+	}
+
+	if _, err := New(config.ArgoCDConfig{Server: srv.URL, TokenSecret: "argocd/devmind-token"}, egress.Config{}, nil, logger); err == nil {
+		t.Error("New() with a token secret and no secret reader succeeded")
+	}
+}
+
+// degradedArgoCD serves an application that is Degraded after its sync to
+// the last revision of history, recording the rollbacks asked for.
+type degradedArgoCD struct {
+	mu         sync.Mutex
+	history    string
+	rolledBack []int64
+}
+
+func (f *degradedArgoCD) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/applications/web":
+		fmt.Fprintf(w, `{"metadata":{"name":"web"},"status":{"sync":{"status":"Synced","revision":"v2"},"health":{"status":"Degraded","message":"crash loop"},"history":%s}}`, f.history)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/applications/web/rollback":
+		var req struct {
+			ID int64 `json:"id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		f.rolledBack = append(f.rolledBack, req.ID)
+		fmt.Fprint(w, `{}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestWatchHealthRollsBackDegradedApplication(t *testing.T) {
+	for _, tc := range []struct {
+		history  string
+		want     Rollback
+		rollback []int64
+	}{
+		{`[{"id":1,"revision":"v1"},{"id":2,"revision":"v2"}]`, Rollback{From: "v2", To: "v1"}, []int64{1}},
+		{`[{"id":2,"revision":"v2"}]`, Rollback{From: "v2", Err: ErrNoPreviousRevision}, nil},
+	} {
+		fake := &degradedArgoCD{history: tc.history}
+		c := newTestClient(t, fake, config.ArgoCDConfig{Token: "static", RollbackEnabled: true})
+		c.pollInterval = 10 * time.Millisecond
+		c.grace = 30 * time.Millisecond
+
+		var events []HealthEvent
+		for ev := range c.WatchHealth(context.Background(), "web", 5*time.Second) {
+			events = append(events, ev)
+		}
+		last := events[len(events)-1]
+		if len(events) < 3 || last.Health != HealthStatusDegraded || last.Rollback == nil {
+			t.Fatalf("%s: watch ended with %+v after %d events, want a rollback", tc.history, last, len(events))
+		}
+		if rb := *last.Rollback; rb.From != tc.want.From || rb.To != tc.want.To || !errors.Is(rb.Err, tc.want.Err) {
+			t.Errorf("%s: rollback = %+v, want %+v", tc.history, rb, tc.want)
+		}
+		if !slices.Equal(fake.rolledBack, tc.rollback) {
+			t.Errorf("%s: rolled back to ids %v, want %v", tc.history, fake.rolledBack, tc.rollback)
+		}
+	}
+}
+
+func TestWatchHealthWithoutRollbackEndsWithWindow(t *testing.T) {
+	fake := &degradedArgoCD{history: `[{"id":1,"revision":"v1"},{"id":2,"revision":"v2"}]`}
+	c := newTestClient(t, fake, config.ArgoCDConfig{Token: "static"})
+	c.pollInterval = 10 * time.Millisecond
+	c.grace = time.Millisecond
+
+	for ev := range c.WatchHealth(context.Background(), "web", 100*time.Millisecond) {
+		if ev.Rollback != nil {
+			t.Fatalf("rolled back with rollback_enabled off: %+v", ev.Rollback)
+		}
+	}
+	if len(fake.rolledBack) != 0 {
+		t.Errorf("rolled back to ids %v", fake.rolledBack)
+	}
+}
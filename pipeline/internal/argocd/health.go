@@ -0,0 +1,132 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultHealthGracePeriod is used when argocd.health_grace_period is not
+// configured.
+const DefaultHealthGracePeriod = time.Minute
+
+// ErrNoPreviousRevision is returned by RollbackToPrevious for an
+// application synced to a single revision.
+var ErrNoPreviousRevision = errors.New("argocd: no previous revision to roll back to")
+
+// HealthEvent is one observation of an application's health by
+// WatchHealth.
+type HealthEvent struct {
+	At      time.Time
+	Health  string
+	Message string
+	// Rollback is set on the last event of a watch that rolled the
+	// application back.
+	Rollback *Rollback
+	// Err is set when the application could not be read. The watch goes
+	// on.
+	Err error
+}
+
+// Rollback is a rollback of an application to its previous synced
+// revision.
+type Rollback struct {
+	From string
+	To   string
+	// Err is set when the rollback was refused.
+	Err error
+}
+
+// WatchHealth streams the health of the named application, checked every
+// poll interval, until window has passed or ctx is done, then closes the
+// channel. With argocd.rollback_enabled, an application that stays
+// Degraded for longer than argocd.health_grace_period is rolled back to its
+// previous synced revision, which ends the watch.
+func (c *Client) WatchHealth(ctx context.Context, name string, window time.Duration) <-chan HealthEvent {
+	events := make(chan HealthEvent)
+	go func() {
+		defer close(events)
+		ctx, cancel := context.WithTimeout(ctx, window)
+		defer cancel()
+		interval := c.pollInterval
+		if interval <= 0 {
+			interval = DefaultPollInterval
+		}
+		grace := c.grace
+		if grace <= 0 {
+			grace = DefaultHealthGracePeriod
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var degradedSince time.Time
+		for {
+			app, err := c.GetApplication(ctx, name)
+			if ctx.Err() != nil {
+				return
+			}
+			ev := HealthEvent{At: time.Now(), Err: err}
+			if err == nil {
+				ev.Health, ev.Message = app.Status.Health.Status, app.Status.Health.Message
+				switch {
+				case ev.Health != HealthStatusDegraded:
+					degradedSince = time.Time{}
+				case degradedSince.IsZero():
+					degradedSince = ev.At
+				case c.rollback && ev.At.Sub(degradedSince) > grace:
+					ev.Rollback = c.rollbackDegraded(ctx, app, ev.At.Sub(degradedSince))
+				}
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+			if ev.Rollback != nil {
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// rollbackDegraded rolls app back after it stayed degraded for longer than
+// the grace period.
+func (c *Client) rollbackDegraded(ctx context.Context, app *Application, degraded time.Duration) *Rollback {
+	log := c.logger.WithFields(logrus.Fields{"application": app.Metadata.Name, "degraded_for": degraded.Round(time.Second)})
+	rb, err := c.RollbackToPrevious(ctx, app)
+	if err != nil {
+		log.WithError(err).Error("Failed to roll back degraded ArgoCD application")
+		return &Rollback{From: app.Status.Sync.Revision, Err: err}
+	}
+	log.WithFields(logrus.Fields{"from": rb.From, "to": rb.To}).Warn("Rolled back degraded ArgoCD application")
+	return rb
+}
+
+// RollbackToPrevious rolls app back to the revision it was synced to
+// before its latest sync.
+func (c *Client) RollbackToPrevious(ctx context.Context, app *Application) (*Rollback, error) {
+	h := app.Status.History
+	if len(h) < 2 {
+		return nil, ErrNoPreviousRevision
+	}
+	current, previous := h[len(h)-1], h[len(h)-2]
+	req := struct {
+		ID int64 `json:"id"`
+	}{previous.ID}
+	path := "/api/v1/applications/" + url.PathEscape(app.Metadata.Name) + "/rollback"
+	if err := c.do(ctx, http.MethodPost, path, req, nil); err != nil {
+		return nil, fmt.Errorf("failed to roll back to revision %s: %w", previous.Revision, err)
+	}
+	return &Rollback{From: current.Revision, To: previous.Revision}, nil
+}
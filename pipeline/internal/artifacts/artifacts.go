@@ -0,0 +1,132 @@
+// Package artifacts provides access to the files produced by pipeline runs.
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+)
+
+// ErrNotFound is returned when a run or artifact does not exist.
+var ErrNotFound = perrors.New(perrors.ErrNotFound, "artifact not found")
+
+// Artifact describes a single file produced by a run.
+type Artifact struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	ModifiedAt  time.Time `json:"modified_at"`
+}
+
+// Object is an open artifact. It is seekable so it can serve range requests.
+type Object interface {
+	io.ReadSeekCloser
+	Info() Artifact
+}
+
+// Store lists and opens the artifacts of a run.
+type Store interface {
+	List(ctx context.Context, runID string) ([]Artifact, error)
+	Open(ctx context.Context, runID, name string) (Object, error)
+}
+
+// Writer is implemented by stores that accept uploads. size is the length
+// of r, or -1 when unknown. A failed upload leaves no partial artifact.
+type Writer interface {
+	Store
+	Put(ctx context.Context, runID, name, contentType string, r io.Reader, size int64) (Artifact, error)
+}
+
+// LimitError is returned by PutLimited when an upload would take the total
+// size of a run's artifacts past the limit.
+type LimitError struct {
+	RunID string
+	Name  string
+	Limit int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("artifact %s of run %s rejected: the run's artifacts would exceed %d bytes (pipeline.max_artifact_bytes)",
+		e.Name, e.RunID, e.Limit)
+}
+
+// PutLimited stores an artifact unless it would take the run's artifacts
+// past limit bytes in total, counting a replaced artifact as freed. The body
+// is counted as it streams, so an oversized upload is aborted as soon as it
+// crosses the limit rather than after it was stored; a known size rejects it
+// before anything is read. A limit of zero or less disables the check.
+//
+// Concurrent uploads to the same run are each checked against the usage at
+// their start.
+func PutLimited(ctx context.Context, s Writer, runID, name, contentType string, body io.Reader, size, limit int64) (Artifact, error) {
+	if limit <= 0 {
+		return s.Put(ctx, runID, name, contentType, body, size)
+	}
+
+	existing, err := s.List(ctx, runID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return Artifact{}, err
+	}
+	var used int64
+	for _, a := range existing {
+		if a.Name != name {
+			used += a.Size
+		}
+	}
+	limitErr := &LimitError{RunID: runID, Name: name, Limit: limit}
+	remaining := limit - used
+	if remaining < 0 || size > remaining {
+		return Artifact{}, limitErr
+	}
+
+	capped := &capReader{r: body, remaining: remaining, err: limitErr}
+	a, err := s.Put(ctx, runID, name, contentType, capped, size)
+	if capped.exceeded {
+		return Artifact{}, limitErr
+	}
+	return a, err
+}
+
+// capReader fails once more than remaining bytes were read through it.
+type capReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+	exceeded  bool
+}
+
+func (c *capReader) Read(p []byte) (int, error) {
+	if c.exceeded {
+		return 0, c.err
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining < 0 {
+		c.exceeded = true
+		return n, c.err
+	}
+	return n, err
+}
+
+// Presigner is implemented by stores that can hand out direct, time-limited
+// download URLs so clients fetch artifacts without going through the engine.
+type Presigner interface {
+	PresignGet(ctx context.Context, runID, name string, expiry time.Duration) (string, error)
+}
+
+// New creates the Store selected by cfg.Backend.
+func New(cfg config.ArtifactsConfig) (Store, error) {
+	switch cfg.Backend {
+	case "", "filesystem":
+		return NewFilesystemStore(cfg.Path), nil
+	case "s3":
+		return NewS3Store(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unsupported artifacts backend %q", cfg.Backend)
+	}
+}
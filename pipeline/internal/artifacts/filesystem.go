@@ -0,0 +1,163 @@
+package artifacts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FilesystemStore keeps artifacts on local disk under <root>/<run id>/.
+type FilesystemStore struct {
+	root string
+}
+
+// NewFilesystemStore creates a FilesystemStore rooted at root.
+func NewFilesystemStore(root string) *FilesystemStore {
+	return &FilesystemStore{root: root}
+}
+
+// List returns every artifact stored for the run, sorted by name.
+func (s *FilesystemStore) List(ctx context.Context, runID string) ([]Artifact, error) {
+	dir, err := s.runDir(runID)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Artifact
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		list = append(list, fileArtifact(filepath.ToSlash(rel), info))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list artifacts for run %s: %w", runID, err)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Open opens a single artifact for reading.
+func (s *FilesystemStore) Open(ctx context.Context, runID, name string) (Object, error) {
+	p, err := s.artifactPath(runID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact %s of run %s: %w", name, runID, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to stat artifact %s of run %s: %w", name, runID, err)
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, ErrNotFound
+	}
+
+	return &fileObject{File: f, info: fileArtifact(name, info)}, nil
+}
+
+// Put implements Writer. The artifact is written to a temporary file and
+// renamed into place, so readers never see a partial upload.
+func (s *FilesystemStore) Put(ctx context.Context, runID, name, contentType string, r io.Reader, size int64) (Artifact, error) {
+	p, err := s.artifactPath(runID, name)
+	if err != nil {
+		return Artifact{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact %s of run %s: %w", name, runID, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact %s of run %s: %w", name, runID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return Artifact{}, fmt.Errorf("failed to store artifact %s of run %s: %w", name, runID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact %s of run %s: %w", name, runID, err)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact %s of run %s: %w", name, runID, err)
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to stat artifact %s of run %s: %w", name, runID, err)
+	}
+	return fileArtifact(strings.TrimPrefix(path.Clean("/"+name), "/"), info), nil
+}
+
+func (s *FilesystemStore) runDir(runID string) (string, error) {
+	if runID == "" || strings.ContainsAny(runID, `/\`) || runID == "." || runID == ".." {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.root, runID), nil
+}
+
+// artifactPath resolves name inside the run directory, refusing anything
+// that would escape it.
+func (s *FilesystemStore) artifactPath(runID, name string) (string, error) {
+	dir, err := s.runDir(runID)
+	if err != nil {
+		return "", err
+	}
+	clean := path.Clean("/" + name)
+	if clean == "/" {
+		return "", ErrNotFound
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean[1:])), nil
+}
+
+func fileArtifact(name string, info fs.FileInfo) Artifact {
+	return Artifact{
+		Name:        name,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+		ModifiedAt:  info.ModTime().UTC(),
+	}
+}
+
+type fileObject struct {
+	*os.File
+	info Artifact
+}
+
+func (o *fileObject) Info() Artifact {
+	return o.info
+}
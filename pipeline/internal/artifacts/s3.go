@@ -0,0 +1,135 @@
+package artifacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+// S3Store keeps artifacts in an S3-compatible bucket under <prefix>/<run id>/.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Store creates an S3Store from cfg.
+func NewS3Store(cfg config.S3Config) (*S3Store, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("artifacts.s3.bucket is required for the s3 backend")
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	return &S3Store{
+		client: client,
+		bucket: cfg.Bucket,
+		prefix: strings.Trim(cfg.Prefix, "/"),
+	}, nil
+}
+
+// List returns every artifact stored for the run.
+func (s *S3Store) List(ctx context.Context, runID string) ([]Artifact, error) {
+	prefix := s.runPrefix(runID)
+
+	var list []Artifact
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list artifacts for run %s: %w", runID, obj.Err)
+		}
+		list = append(list, Artifact{
+			Name:        strings.TrimPrefix(obj.Key, prefix),
+			Size:        obj.Size,
+			ContentType: obj.ContentType,
+			ModifiedAt:  obj.LastModified.UTC(),
+		})
+	}
+	return list, nil
+}
+
+// Open opens a single artifact for reading.
+func (s *S3Store) Open(ctx context.Context, runID, name string) (Object, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(runID, name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact %s of run %s: %w", name, runID, err)
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat artifact %s of run %s: %w", name, runID, err)
+	}
+
+	return &s3Object{Object: obj, info: Artifact{
+		Name:        name,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		ModifiedAt:  info.LastModified.UTC(),
+	}}, nil
+}
+
+// Put implements Writer. A failed upload of unknown size aborts its
+// multipart upload, so no partial object is left behind.
+func (s *S3Store) Put(ctx context.Context, runID, name, contentType string, r io.Reader, size int64) (Artifact, error) {
+	info, err := s.client.PutObject(ctx, s.bucket, s.key(runID, name), r, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return Artifact{}, fmt.Errorf("failed to store artifact %s of run %s: %w", name, runID, err)
+	}
+	return Artifact{
+		Name:        strings.TrimPrefix(path.Clean("/"+name), "/"),
+		Size:        info.Size,
+		ContentType: contentType,
+		ModifiedAt:  info.LastModified.UTC(),
+	}, nil
+}
+
+// PresignGet returns a URL that downloads the artifact directly from the bucket.
+func (s *S3Store) PresignGet(ctx context.Context, runID, name string, expiry time.Duration) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=%q", path.Base(name)))
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, s.key(runID, name), expiry, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign artifact %s of run %s: %w", name, runID, err)
+	}
+	return u.String(), nil
+}
+
+func (s *S3Store) runPrefix(runID string) string {
+	if s.prefix == "" {
+		return runID + "/"
+	}
+	return s.prefix + "/" + runID + "/"
+}
+
+func (s *S3Store) key(runID, name string) string {
+	return s.runPrefix(runID) + strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+type s3Object struct {
+	*minio.Object
+	info Artifact
+}
+
+func (o *s3Object) Info() Artifact {
+	return o.info
+}
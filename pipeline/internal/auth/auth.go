@@ -0,0 +1,80 @@
+// Package auth authenticates the callers of the HTTP and gRPC APIs by the
+// bearer token of their requests: one of the static keys of auth.api_keys,
+// or a JWT signed by a key of the JWKS at auth.jwt.jwks_url.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+// The modes of auth.mode.
+const (
+	ModeNone   = "none"
+	ModeAPIKey = "api_key"
+	ModeJWT    = "jwt"
+)
+
+const (
+	// DefaultJWKSRefresh is how often the key set is fetched again when
+	// auth.jwt.jwks_refresh is unset.
+	DefaultJWKSRefresh = 10 * time.Minute
+	// DefaultLeeway is the clock skew tolerated when auth.jwt.leeway is
+	// unset.
+	DefaultLeeway = time.Minute
+	// jwksTimeout bounds each fetch of the key set.
+	jwksTimeout = 10 * time.Second
+)
+
+// Authenticator verifies bearer tokens.
+type Authenticator interface {
+	// Authenticate returns the subject token identifies. Tokens that are
+	// not valid fail with an error of kind ErrUnauthenticated; a JWT that
+	// cannot be checked for want of the key set fails with ErrUnavailable.
+	Authenticate(ctx context.Context, token string) (string, error)
+}
+
+// New returns the Authenticator of cfg's mode, or nil in mode none.
+func New(cfg config.AuthConfig, network egress.Config) (Authenticator, error) {
+	switch cfg.Mode {
+	case "", ModeNone:
+		return nil, nil
+	case ModeAPIKey:
+		if len(cfg.APIKeys) == 0 {
+			return nil, fmt.Errorf("auth mode %s requires auth.api_keys", ModeAPIKey)
+		}
+		return apiKeys(cfg.APIKeys), nil
+	case ModeJWT:
+		if cfg.JWT.JWKSURL == "" {
+			return nil, fmt.Errorf("auth mode %s requires auth.jwt.jwks_url", ModeJWT)
+		}
+		return newJWTVerifier(cfg.JWT, network.Client(egress.ClientAuth, jwksTimeout)), nil
+	default:
+		return nil, fmt.Errorf("auth.mode: unknown mode %q (%s, %s, %s)", cfg.Mode, ModeNone, ModeAPIKey, ModeJWT)
+	}
+}
+
+// apiKeys accepts the keys of auth.api_keys, each as the subject of its
+// name.
+type apiKeys []config.AuthAPIKeyConfig
+
+func (keys apiKeys) Authenticate(_ context.Context, token string) (string, error) {
+	subject := ""
+	// Every key is compared, so the time taken tells nothing of which
+	// matched.
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(k.Key)) == 1 && subject == "" {
+			subject = k.Name
+		}
+	}
+	if subject == "" {
+		return "", perrors.New(perrors.ErrUnauthenticated, "invalid API key")
+	}
+	return subject, nil
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+func TestAPIKeys(t *testing.T) {
+	a, err := New(config.AuthConfig{Mode: ModeAPIKey, APIKeys: []config.AuthAPIKeyConfig{
+		{Name: "ci", Key: "k-ci"},
+		{Name: "dashboard", Key: "k-dash"},
+	}}, egress.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub, err := a.Authenticate(context.Background(), "k-dash"); err != nil || sub != "dashboard" {
+		t.Errorf("Authenticate(k-dash) = %q, %v", sub, err)
+	}
+	if _, err := a.Authenticate(context.Background(), "k-other"); !errors.Is(err, perrors.ErrUnauthenticated) {
+		t.Errorf("Authenticate(k-other) error = %v, want unauthenticated", err)
+	}
+	if a, err := New(config.AuthConfig{Mode: ModeNone}, egress.Config{}); a != nil || err != nil {
+		t.Errorf("New(none) = %v, %v", a, err)
+	}
+	if _, err := New(config.AuthConfig{Mode: "oauth"}, egress.Config{}); err == nil {
+		t.Error("New(oauth) succeeded")
+	}
+}
+
+// issuer signs tokens and serves its keys as a JWKS.
+type issuer struct {
+	rsa     *rsa.PrivateKey
+	ec      *ecdsa.PrivateKey
+	fetches atomic.Int32
+	srv     *httptest.Server
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &issuer{rsa: rk, ec: ek}
+	iss.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		size := 32
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rk.N.Bytes()), "e": b64(big.NewInt(int64(rk.E)).Bytes())},
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ek.X.FillBytes(make([]byte, size))), "y": b64(ek.Y.FillBytes(make([]byte, size)))},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	}))
+	t.Cleanup(iss.srv.Close)
+	return iss
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (iss *issuer) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsa, crypto.SHA256, digest.Sum(nil)); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ec, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func (iss *issuer) verifier(t *testing.T, now time.Time) *jwtVerifier {
+	t.Helper()
+	a, err := New(config.AuthConfig{Mode: ModeJWT, JWT: config.AuthJWTConfig{
+		JWKSURL:  iss.srv.URL,
+		Issuer:   "https://id.example.com",
+		Audience: "devmind-pipeline",
+	}}, egress.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := a.(*jwtVerifier)
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestJWTVerifiesSignatureAndClaims(t *testing.T) {
+	iss := newIssuer(t)
+	now := time.Unix(1_700_000_000, 0)
+	v := iss.verifier(t, now)
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss": "https://id.example.com",
+			"aud": []string{"other", "devmind-pipeline"},
+			"sub": "alice",
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+		sub, err := v.Authenticate(context.Background(), iss.sign(t, alg, kid, claims(nil)))
+		if err != nil || sub != "alice" {
+			t.Errorf("%s: Authenticate() = %q, %v", alg, sub, err)
+		}
+	}
+
+	tampered := iss.sign(t, "RS256", "rsa-1", claims(nil))
+	tampered = tampered[:len(tampered)-4] + "AAAA"
+	for name, token := range map[string]string{
+		"tampered":       tampered,
+		"wrong key type": iss.sign(t, "ES256", "rsa-1", claims(nil)),
+		"expired":        iss.sign(t, "RS256", "rsa-1", claims(func(c map[string]interface{}) { c["exp"] = now.Add(-2 * time.Minute).Unix() })),
+		"not yet valid":  iss.sign(t, "RS256", "rsa-1", claims(func(c map[string]interface{}) { c["nbf"] = now.Add(5 * time.Minute).Unix() })),
+		"no exp":         iss.sign(t, "RS256", "rsa-1", claims(func(c map[string]interface{}) { delete(c, "exp") })),
+		"issuer":         iss.sign(t, "RS256", "rsa-1", claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" })),
+		"audience":       iss.sign(t, "RS256", "rsa-1", claims(func(c map[string]interface{}) { c["aud"] = "other" })),
+		"alg none":       b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{"sub":"alice"}`)) + ".",
+		"garbage":        "not-a-jwt",
+	} {
+		if _, err := v.Authenticate(context.Background(), token); !errors.Is(err, perrors.ErrUnauthenticated) {
+			t.Errorf("%s: error = %v, want unauthenticated", name, err)
+		}
+	}
+
+	// A minute of clock skew is tolerated.
+	skewed := iss.sign(t, "RS256", "rsa-1", claims(func(c map[string]interface{}) { c["exp"] = now.Add(-30 * time.Second).Unix() }))
+	if _, err := v.Authenticate(context.Background(), skewed); err != nil {
+		t.Errorf("token expired within the leeway: %v", err)
+	}
+}
+
+func TestJWKSIsCachedAndRefetchedForUnknownKeys(t *testing.T) {
+	iss := newIssuer(t)
+	now := time.Unix(1_700_000_000, 0)
+	v := iss.verifier(t, now)
+	token := iss.sign(t, "RS256", "rsa-1", map[string]interface{}{
+		"iss": "https://id.example.com", "aud": "devmind-pipeline", "sub": "alice", "exp": now.Add(time.Hour).Unix(),
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.Authenticate(context.Background(), token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := iss.fetches.Load(); n != 1 {
+		t.Errorf("fetched the key set %d times, want once", n)
+	}
+
+	unknown := iss.sign(t, "RS256", "rsa-2", map[string]interface{}{})
+	for i := 0; i < 3; i++ {
+		if _, err := v.Authenticate(context.Background(), unknown); !errors.Is(err, perrors.ErrUnauthenticated) {
+			t.Errorf("unknown key: error = %v", err)
+		}
+	}
+	if n := iss.fetches.Load(); n != 1 {
+		t.Errorf("unknown keys refetched the key set within %s: %d fetches", jwksMinRefetch, n)
+	}
+	v.now = func() time.Time { return now.Add(jwksMinRefetch) }
+	_, _ = v.Authenticate(context.Background(), unknown)
+	if n := iss.fetches.Load(); n != 2 {
+		t.Errorf("unknown key: %d fetches, want 2", n)
+	}
+
+	// A key set that cannot be fetched keeps the last one in use.
+	iss.srv.Close()
+	v.now = func() time.Time { return now.Add(2 * DefaultJWKSRefresh) }
+	if _, err := v.Authenticate(context.Background(), token); err != nil {
+		t.Errorf("JWKS endpoint down: %v", err)
+	}
+}
+
+// blockingTransport holds every request until release is closed.
+type blockingTransport struct{ release chan struct{} }
+
+func (b blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	<-b.release
+	return nil, errors.New("released")
+}
+
+func TestJWKSRefreshDoesNotBlockKnownKeys(t *testing.T) {
+	iss := newIssuer(t)
+	now := time.Unix(1_700_000_000, 0)
+	v := iss.verifier(t, now)
+	token := iss.sign(t, "RS256", "rsa-1", map[string]interface{}{
+		"iss": "https://id.example.com", "aud": "devmind-pipeline", "sub": "alice", "exp": now.Add(3 * DefaultJWKSRefresh).Unix(),
+	})
+	if _, err := v.Authenticate(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+
+	// The refresh is due but hangs; requests for the known key go on.
+	release := make(chan struct{})
+	defer close(release)
+	v.client = &http.Client{Transport: blockingTransport{release}}
+	v.now = func() time.Time { return now.Add(2 * DefaultJWKSRefresh) }
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := v.Authenticate(context.Background(), token)
+			done <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("known key during a refresh: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a request for a known key waited for the JWKS fetch")
+		}
+	}
+}
+
+func TestJWKSUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	a, err := New(config.AuthConfig{Mode: ModeJWT, JWT: config.AuthJWTConfig{JWKSURL: srv.URL}}, egress.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := b64([]byte(`{"alg":"RS256","kid":"rsa-1"}`)) + "." + b64([]byte(`{}`)) + "." + b64([]byte("sig"))
+	if _, err := a.Authenticate(context.Background(), token); !errors.Is(err, perrors.ErrUnavailable) {
+		t.Errorf("error = %v, want unavailable", err)
+	}
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // SHA-256 for RS256 and ES256
+	_ "crypto/sha512" // SHA-384 and SHA-512 for the others
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+)
+
+const (
+	// jwksMinRefetch is the least time between two fetches of the key set,
+	// so tokens naming unknown keys cannot flood the JWKS endpoint.
+	jwksMinRefetch = 30 * time.Second
+	// maxJWKSBytes bounds the size of a key set.
+	maxJWKSBytes = 1 << 20
+)
+
+// algorithm is a JWS signature algorithm: RSASSA-PKCS1-v1_5 or, with a
+// curve, ECDSA.
+type algorithm struct {
+	hash  crypto.Hash
+	curve elliptic.Curve
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"ES256": {hash: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, curve: elliptic.P521()},
+}
+
+// jwtVerifier accepts the JWTs of auth.mode jwt.
+type jwtVerifier struct {
+	cfg     config.AuthJWTConfig
+	refresh time.Duration
+	leeway  time.Duration
+	client  *http.Client
+	now     func() time.Time
+	// fetches shares a fetch of the key set between the requests waiting
+	// for it.
+	fetches singleflight.Group
+
+	mu sync.Mutex
+	// keys are the keys of the last key set fetched, by key ID.
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+	tried   time.Time
+	err     error
+}
+
+func newJWTVerifier(cfg config.AuthJWTConfig, client *http.Client) *jwtVerifier {
+	v := &jwtVerifier{cfg: cfg, refresh: cfg.JWKSRefresh, leeway: cfg.Leeway, client: client, now: time.Now}
+	if v.refresh <= 0 {
+		v.refresh = DefaultJWKSRefresh
+	}
+	if v.leeway <= 0 {
+		v.leeway = DefaultLeeway
+	}
+	return v
+}
+
+// claims are the registered claims checked.
+type claims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  audience `json:"aud"`
+	Expires   *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// audience is an aud claim, which is a single string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return perrors.New(perrors.ErrUnauthenticated, "invalid token: "+fmt.Sprintf(format, args...))
+}
+
+func (v *jwtVerifier) Authenticate(ctx context.Context, token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", invalidToken("not a JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return "", invalidToken("malformed header: %v", err)
+	}
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return "", invalidToken("unsupported algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", invalidToken("malformed signature")
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return "", err
+	}
+	if !alg.verify(key, parts[0]+"."+parts[1], sig) {
+		return "", invalidToken("bad signature")
+	}
+
+	var c claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return "", invalidToken("malformed claims: %v", err)
+	}
+	now := v.now()
+	switch {
+	case c.Expires == nil:
+		return "", invalidToken("no exp claim")
+	case now.After(unixTime(*c.Expires).Add(v.leeway)):
+		return "", invalidToken("expired")
+	case c.NotBefore != nil && now.Add(v.leeway).Before(unixTime(*c.NotBefore)):
+		return "", invalidToken("not valid yet")
+	case c.Issuer != v.cfg.Issuer:
+		return "", invalidToken("issuer %q is not trusted", c.Issuer)
+	case !c.Audience.contains(v.cfg.Audience):
+		return "", invalidToken("not issued for audience %q", v.cfg.Audience)
+	case c.Subject == "":
+		return "", invalidToken("no sub claim")
+	}
+	return c.Subject, nil
+}
+
+func (a audience) contains(aud string) bool {
+	for _, s := range a {
+		if s == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func unixTime(secs float64) time.Time {
+	return time.Unix(0, int64(secs*float64(time.Second)))
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// verify reports whether sig signs signed under key.
+func (alg algorithm) verify(key crypto.PublicKey, signed string, sig []byte) bool {
+	h := alg.hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return alg.curve == nil && rsa.VerifyPKCS1v15(key, alg.hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		if alg.curve == nil || key.Curve != alg.curve {
+			return false
+		}
+		// The signature is R and S, each as long as the curve's order.
+		size := (alg.curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// key returns the key of the key set with ID kid. The key set is fetched
+// again once auth.jwt.jwks_refresh has passed, or early for a key it does
+// not have; while the endpoint fails, the last key set fetched is kept.
+// Only requests for a key not yet known wait for the fetch, and none holds
+// mu while it is in flight.
+func (v *jwtVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	now := v.now()
+	_, known := v.keys[kid]
+	due := (!known || now.Sub(v.fetched) >= v.refresh) && now.Sub(v.tried) >= jwksMinRefetch
+	v.mu.Unlock()
+	if due {
+		// Not bound to this request, which may not wait for it.
+		fetched := v.fetches.DoChan("jwks", func() (interface{}, error) {
+			v.refetch(context.WithoutCancel(ctx))
+			return nil, nil
+		})
+		if !known {
+			select {
+			case <-fetched:
+			case <-ctx.Done():
+				return nil, perrors.Wrap(perrors.ErrUnavailable, fmt.Errorf("failed to fetch JWKS: %w", ctx.Err()))
+			}
+		}
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if v.keys == nil {
+		return nil, perrors.Wrap(perrors.ErrUnavailable, fmt.Errorf("failed to fetch JWKS: %w", v.err))
+	}
+	return nil, invalidToken("unknown signing key %q", kid)
+}
+
+// refetch fetches the key set unless a fetch already started within
+// jwksMinRefetch, and swaps it in if it could be fetched.
+func (v *jwtVerifier) refetch(ctx context.Context) {
+	v.mu.Lock()
+	now := v.now()
+	if now.Sub(v.tried) < jwksMinRefetch {
+		v.mu.Unlock()
+		return
+	}
+	v.tried = now
+	v.mu.Unlock()
+
+	keys, err := v.fetch(ctx)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err == nil {
+		v.keys, v.fetched = keys, now
+	}
+	v.err = err
+}
+
+// jwk is a JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of an RSA key.
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of an EC key.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// fetch gets the key set and returns its signing keys by ID. Keys of other
+// types and uses are left out.
+func (v *jwtVerifier) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key := k.publicKey(); key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey returns the key k describes, or nil when it is no RSA or EC
+// key or malformed.
+func (k jwk) publicKey() crypto.PublicKey {
+	switch k.Kty {
+	case "RSA":
+		n, e := decodeInt(k.N), decodeInt(k.E)
+		if n == nil || e == nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		curve, ok := curves[k.Crv]
+		x, y := decodeInt(k.X), decodeInt(k.Y)
+		if !ok || x == nil || y == nil || !curve.IsOnCurve(x, y) {
+			return nil
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+	}
+	return nil
+}
+
+func decodeInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
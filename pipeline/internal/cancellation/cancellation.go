@@ -0,0 +1,188 @@
+// Package cancellation relays pipeline cancel requests between engine
+// replicas over Redis pub/sub, so a cancel received by any replica reaches
+// the one actually executing the run.
+//
+// A request is published on a shared channel together with a per-request
+// reply channel. The replica running the pipeline cancels it and publishes
+// an acknowledgement on the reply channel; the requester waits for that
+// acknowledgement or gives up after the configured timeout.
+package cancellation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+const (
+	// DefaultChannel is used when redis.cancel_channel is not configured.
+	DefaultChannel = "devmind:pipeline:cancel"
+	// DefaultAckTimeout is used when redis.cancel_ack_timeout is not
+	// configured.
+	DefaultAckTimeout = 10 * time.Second
+)
+
+// ErrNotAcknowledged is returned when no replica confirmed the cancellation
+// in time, for instance because none of them is running the pipeline.
+var ErrNotAcknowledged = errors.New("no replica acknowledged the cancellation")
+
+type request struct {
+	RunID   string `json:"run_id"`
+	ReplyTo string `json:"reply_to"`
+}
+
+type ack struct {
+	RunID   string `json:"run_id"`
+	Replica string `json:"replica"`
+}
+
+// Bus publishes and serves cancel requests.
+type Bus struct {
+	client     redis.UniversalClient
+	channel    string
+	ackTimeout time.Duration
+	replica    string
+	logger     *logrus.Logger
+}
+
+// New creates a Bus using the channel and timeout from cfg, falling back to
+// the defaults for unset values.
+func New(client redis.UniversalClient, cfg config.RedisConfig, logger *logrus.Logger) (*Bus, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate replica id: %w", err)
+	}
+	host, _ := os.Hostname()
+	b := &Bus{
+		client:     client,
+		channel:    cfg.CancelChannel,
+		ackTimeout: cfg.CancelAckTimeout,
+		replica:    host + "-" + id,
+		logger:     logger,
+	}
+	if b.channel == "" {
+		b.channel = DefaultChannel
+	}
+	if b.ackTimeout <= 0 {
+		b.ackTimeout = DefaultAckTimeout
+	}
+	return b, nil
+}
+
+// RequestCancel asks every replica to cancel the run and waits until the one
+// running it acknowledges. It returns ErrNotAcknowledged if that does not
+// happen within the ack timeout.
+func (b *Bus) RequestCancel(ctx context.Context, runID string) error {
+	id, err := randomID()
+	if err != nil {
+		return fmt.Errorf("failed to generate request id: %w", err)
+	}
+	replyTo := b.channel + ":ack:" + id
+
+	ctx, cancel := context.WithTimeout(ctx, b.ackTimeout)
+	defer cancel()
+
+	// Subscribe before publishing so a fast acknowledgement is not missed.
+	sub := b.client.Subscribe(ctx, replyTo)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to cancel acknowledgements: %w", err)
+	}
+
+	payload, err := json.Marshal(request{RunID: runID, ReplyTo: replyTo})
+	if err != nil {
+		return fmt.Errorf("failed to encode cancel request: %w", err)
+	}
+	if err := b.client.Publish(ctx, b.channel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish cancel request: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrNotAcknowledged
+			}
+			return ctx.Err()
+		case msg, ok := <-sub.Channel():
+			if !ok {
+				return ErrNotAcknowledged
+			}
+			var a ack
+			if err := json.Unmarshal([]byte(msg.Payload), &a); err != nil || a.RunID != runID {
+				continue
+			}
+			b.logger.WithFields(logrus.Fields{
+				"pipeline_id": runID,
+				"replica":     a.Replica,
+			}).Info("Cancellation acknowledged")
+			return nil
+		}
+	}
+}
+
+// Listen serves cancel requests until ctx is done. cancel is called for
+// every requested run and reports whether this replica was running it; only
+// then is the request acknowledged.
+func (b *Bus) Listen(ctx context.Context, cancel func(runID string) bool) error {
+	sub := b.client.Subscribe(ctx, b.channel)
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("failed to subscribe to cancel requests: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-sub.Channel():
+			if !ok {
+				return nil
+			}
+			var req request
+			if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil || req.RunID == "" {
+				b.logger.WithField("payload", msg.Payload).Warn("Ignoring malformed cancel request")
+				continue
+			}
+			if !cancel(req.RunID) {
+				continue
+			}
+			b.acknowledge(ctx, req)
+		}
+	}
+}
+
+func (b *Bus) acknowledge(ctx context.Context, req request) {
+	log := b.logger.WithField("pipeline_id", req.RunID)
+	if req.ReplyTo == "" {
+		return
+	}
+	payload, err := json.Marshal(ack{RunID: req.RunID, Replica: b.replica})
+	if err != nil {
+		log.WithError(err).Error("Failed to encode cancel acknowledgement")
+		return
+	}
+	if err := b.client.Publish(ctx, req.ReplyTo, payload).Err(); err != nil {
+		log.WithError(err).Warn("Failed to acknowledge cancellation")
+		return
+	}
+	log.Info("Pipeline cancelled on request from another replica")
+}
+
+func randomID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
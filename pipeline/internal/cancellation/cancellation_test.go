@@ -0,0 +1,88 @@
+package cancellation
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func newTestBuses(t *testing.T, n int) []*Bus {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	var buses []*Bus
+	for i := 0; i < n; i++ {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		b, err := New(client, config.RedisConfig{CancelAckTimeout: 500 * time.Millisecond}, logger)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		buses = append(buses, b)
+	}
+	return buses
+}
+
+// listen starts b.Listen and waits until it is subscribed.
+func listen(t *testing.T, ctx context.Context, b *Bus, cancel func(string) bool) {
+	t.Helper()
+	go b.Listen(ctx, cancel)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, err := b.client.PubSubNumSub(ctx, b.channel).Result()
+		if err == nil && n[b.channel] > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("listener never subscribed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRequestCancelReachesOwningReplica(t *testing.T) {
+	buses := newTestBuses(t, 2)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	cancelled := make(chan string, 1)
+	listen(t, ctx, buses[1], func(runID string) bool {
+		if runID != "run-1" {
+			return false
+		}
+		cancelled <- runID
+		return true
+	})
+
+	if err := buses[0].RequestCancel(ctx, "run-1"); err != nil {
+		t.Fatalf("RequestCancel() error = %v", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("owning replica was not asked to cancel")
+	}
+}
+
+func TestRequestCancelTimesOutWithoutOwner(t *testing.T) {
+	buses := newTestBuses(t, 2)
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	listen(t, ctx, buses[1], func(string) bool { return false })
+
+	if err := buses[0].RequestCancel(ctx, "run-1"); !errors.Is(err, ErrNotAcknowledged) {
+		t.Fatalf("RequestCancel() error = %v, want ErrNotAcknowledged", err)
+	}
+}
@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeFiresTimersAndTickersWhenAdvanced(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	timer := f.NewTimer(time.Minute)
+	ticker := f.NewTicker(20 * time.Second)
+	defer ticker.Stop()
+
+	f.Advance(30 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+	if at := <-ticker.C(); !at.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("tick at %s, want %s", at, start.Add(20*time.Second))
+	}
+
+	f.Advance(30 * time.Second)
+	if at := <-timer.C(); !at.Equal(start.Add(time.Minute)) {
+		t.Errorf("timer fired at %s, want %s", at, start.Add(time.Minute))
+	}
+	if timer.Stop() {
+		t.Error("Stop() = true for a timer that already fired")
+	}
+	if got := f.Now(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("Now() = %s, want %s", got, start.Add(time.Minute))
+	}
+
+	// An unreceived tick is dropped rather than queued, as with time.Ticker.
+	<-ticker.C()
+	f.Advance(time.Hour)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("ticker queued more than one pending tick")
+	default:
+	}
+}
+
+func TestFakeStoppedTimerNeverFires(t *testing.T) {
+	f := NewFake(time.Now())
+	timer := f.NewTimer(time.Second)
+	if !timer.Stop() {
+		t.Fatal("Stop() = false for a pending timer")
+	}
+	f.Advance(time.Minute)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(time.Now())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.BlockUntil(2)
+	}()
+	f.NewTimer(time.Second)
+	f.NewTicker(time.Second).Stop()
+	f.NewTimer(time.Second)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("BlockUntil(2) did not return with two pending timers")
+	}
+}
@@ -0,0 +1,754 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+// Build information, overridden at link time via -ldflags.
+var (
+	Version   = "dev"
+	BuildDate = "unknown"
+	GitCommit = "unknown"
+)
+
+// Config is the complete pipeline engine configuration.
+type Config struct {
+	Server    ServerConfig    `mapstructure:"server"`
+	Logging   LoggingConfig   `mapstructure:"logging"`
+	Tekton    TektonConfig    `mapstructure:"tekton"`
+	ArgoCD    ArgoCDConfig    `mapstructure:"argocd"`
+	AIService AIServiceConfig `mapstructure:"ai_service"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
+	Tracing   TracingConfig   `mapstructure:"tracing"`
+	Artifacts ArtifactsConfig `mapstructure:"artifacts"`
+	Logs      LogsConfig      `mapstructure:"logs"`
+
+	Credentials CredentialsConfig `mapstructure:"credentials"`
+	Pipeline    PipelineConfig    `mapstructure:"pipeline"`
+	Scheduler   SchedulerConfig   `mapstructure:"scheduler"`
+	Policy      PolicyConfig      `mapstructure:"policy"`
+	Stats       StatsConfig       `mapstructure:"stats"`
+	Queue       QueueConfig       `mapstructure:"queue"`
+	Webhooks    WebhooksConfig    `mapstructure:"webhooks"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+
+	// Network holds the outbound proxy settings shared by every HTTP
+	// client; see package egress.
+	Network egress.Config `mapstructure:"network"`
+}
+
+// ServerConfig holds the gRPC, HTTP and metrics server settings.
+type ServerConfig struct {
+	GRPCPort               string        `mapstructure:"grpc_port"`
+	HTTPPort               string        `mapstructure:"http_port"`
+	MetricsPort            string        `mapstructure:"metrics_port"`
+	MaxConcurrentPipelines int           `mapstructure:"max_concurrent_pipelines"`
+	ShutdownTimeout        time.Duration `mapstructure:"shutdown_timeout"`
+	// ReloadGrace bounds how long a SIGHUP reload waits for requests still
+	// running on the previous configuration.
+	ReloadGrace time.Duration `mapstructure:"reload_grace"`
+
+	// ReadHeaderTimeout bounds how long a client may take to send the
+	// request headers of an HTTP API call.
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	// BodyReadTimeout bounds how long a client may take to send the body
+	// of a JSON API request; slower requests are answered with 408.
+	// Artifact uploads are only bounded by the artifact size cap.
+	BodyReadTimeout time.Duration `mapstructure:"body_read_timeout"`
+
+	// Maintenance refuses submissions during planned downtime.
+	Maintenance MaintenanceConfig `mapstructure:"maintenance"`
+	// AdminToken is the bearer token of the /admin endpoints. Empty
+	// disables them.
+	AdminToken string `mapstructure:"admin_token"`
+
+	// AdvertiseAddress is the host other replicas' clients reach this
+	// replica at, such as its pod's DNS name behind a headless service. It
+	// is recorded on the runs executed here so streaming clients can
+	// connect directly. Empty uses the hostname.
+	AdvertiseAddress string `mapstructure:"advertise_address"`
+
+	// Readiness decides when /readyz reports the replica ready for traffic.
+	Readiness ReadinessConfig `mapstructure:"readiness"`
+
+	// RateLimitEnabled limits the HTTP and gRPC API requests of each
+	// client, by IP and by peer address, to RateLimitRPS a second with
+	// bursts of RateLimitBurst. Requests over the limit are answered with
+	// 429 or ResourceExhausted and a Retry-After hint. Health probes and
+	// metrics are never limited.
+	RateLimitEnabled bool    `mapstructure:"rate_limit_enabled"`
+	RateLimitRPS     float64 `mapstructure:"rate_limit_rps"`
+	RateLimitBurst   int     `mapstructure:"rate_limit_burst"`
+}
+
+// ReadinessConfig lists the dependencies a replica must have reached before
+// it is ready. Each is probed every Interval until it has answered once.
+type ReadinessConfig struct {
+	// Required names the dependencies among tekton, argocd, ai_service,
+	// database and redis. Empty requires those the enabled features depend
+	// on: Tekton, and ArgoCD, the AI service and Redis when in use.
+	Required []string      `mapstructure:"required"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// MaintenanceConfig holds the maintenance mode settings. While enabled,
+// submissions are answered with 503, Message and a Retry-After header, or
+// over gRPC with Unavailable and a retry-after trailer; reads, cancellation
+// and running pipelines are unaffected.
+type MaintenanceConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Message    string        `mapstructure:"message"`
+	RetryAfter time.Duration `mapstructure:"retry_after"`
+}
+
+// LoggingConfig holds the logger settings.
+type LoggingConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+
+	// Exporter is "stdout" (the default) or "otlp", which additionally ships
+	// every entry to OTLP.Endpoint with the active trace and span IDs.
+	Exporter string            `mapstructure:"exporter"`
+	OTLP     LoggingOTLPConfig `mapstructure:"otlp"`
+
+	// Redact adds to the fields and token formats removed from every entry;
+	// see logging.RedactHook.
+	Redact LoggingRedactConfig `mapstructure:"redact"`
+}
+
+// LoggingRedactConfig extends the redaction of password, token, secret and
+// authorization fields and of known token formats, which is always on.
+type LoggingRedactConfig struct {
+	// Fields are more field names whose values are redacted, also as a
+	// word of a longer name.
+	Fields []string `mapstructure:"fields"`
+	// Patterns are regular expressions whose matches are redacted from
+	// messages and string values.
+	Patterns []string `mapstructure:"patterns"`
+}
+
+// LoggingOTLPConfig holds the OTLP/HTTP log exporter settings.
+type LoggingOTLPConfig struct {
+	Endpoint string            `mapstructure:"endpoint"`
+	Headers  map[string]string `mapstructure:"headers"`
+	Timeout  time.Duration     `mapstructure:"timeout"`
+}
+
+// TektonConfig holds the Tekton integration settings.
+type TektonConfig struct {
+	Namespace  string        `mapstructure:"namespace"`
+	Timeout    time.Duration `mapstructure:"timeout"`
+	RetryCount int           `mapstructure:"retry_count"`
+
+	// RetryBaseDelay is the backoff before the first retry of a TaskRun
+	// create, get or watch that failed with a timeout, throttling or a
+	// server error; it doubles per retry up to RetryMaxDelay. Client errors
+	// are never retried. RetryCount bounds the retries per call.
+	RetryBaseDelay time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `mapstructure:"retry_max_delay"`
+
+	// APIQPS and APIBurst bound the rate of Kubernetes API requests made for
+	// TaskRuns, so bursts of runs stay within the API server's budget.
+	APIQPS   float32 `mapstructure:"api_qps"`
+	APIBurst int     `mapstructure:"api_burst"`
+
+	// APITimeout bounds each Kubernetes API call other than a watch, and
+	// ConnectTimeout establishing a connection to the API server, so a
+	// slow API server fails calls instead of hanging pipelines.
+	APITimeout     time.Duration `mapstructure:"api_timeout"`
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+
+	// RequireCRDs fails startup when the Tekton CRDs the engine needs are
+	// missing or unreachable. Otherwise the problem is only logged.
+	RequireCRDs bool `mapstructure:"require_crds"`
+
+	// AcceptStaleEvents applies TaskRun watch events in the order they
+	// arrive, even when one is older than a state already seen. By default
+	// such events are ignored so a late event cannot revert a finished job.
+	AcceptStaleEvents bool `mapstructure:"accept_stale_events"`
+
+	// BuildMetadata sets the run's commit, branch, ID and trigger in the
+	// environment of every TaskRun as DEVMIND_COMMIT, DEVMIND_BRANCH,
+	// DEVMIND_RUN_ID and DEVMIND_TRIGGERED_BY.
+	BuildMetadata bool `mapstructure:"build_metadata"`
+
+	// CacheClaim is the PersistentVolumeClaim holding the build caches of
+	// ai_service.build_optimization, one directory per cache key.
+	CacheClaim string `mapstructure:"cache_claim"`
+}
+
+// ArgoCDConfig holds the ArgoCD integration settings.
+type ArgoCDConfig struct {
+	Server   string        `mapstructure:"server"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	Insecure bool          `mapstructure:"insecure"`
+
+	// Token is a static API token. When empty, the token is read from the
+	// Kubernetes secret TokenSecret names, as namespace/name, under
+	// TokenSecretKey; without one either, Username and Password are used to
+	// open a session that is renewed as it expires.
+	Token          string `mapstructure:"token"`
+	TokenSecret    string `mapstructure:"token_secret"`
+	TokenSecretKey string `mapstructure:"token_secret_key"`
+	Username       string `mapstructure:"username"`
+	Password       string `mapstructure:"password"`
+
+	// ReauthRetry re-authenticates and retries a request once when ArgoCD
+	// rejects an expired session.
+	ReauthRetry bool `mapstructure:"reauth_retry"`
+
+	// RollbackEnabled watches the health of each application a pipeline
+	// deployed for HealthWatchWindow after the sync, and rolls it back to
+	// its previous synced revision when it stays Degraded for longer than
+	// HealthGracePeriod.
+	RollbackEnabled   bool          `mapstructure:"rollback_enabled"`
+	HealthGracePeriod time.Duration `mapstructure:"health_grace_period"`
+	HealthWatchWindow time.Duration `mapstructure:"health_watch_window"`
+}
+
+// Configured reports whether credentials are set, so that pipelines can be
+// deployed through ArgoCD.
+func (c ArgoCDConfig) Configured() bool {
+	return c.Server != "" && (c.Token != "" || c.TokenSecret != "" || c.Username != "")
+}
+
+// AIServiceConfig holds the ml-service client settings.
+type AIServiceConfig struct {
+	// URL lists the ml-service endpoints. A single URL or a comma-separated
+	// string is accepted as well as a list.
+	URL     []string      `mapstructure:"url"`
+	APIKey  string        `mapstructure:"api_key"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	Enabled bool          `mapstructure:"enabled"`
+
+	// StrictSchema fails AI-assisted operations on an incompatible response
+	// schema instead of falling back to non-AI behaviour.
+	StrictSchema bool `mapstructure:"strict_schema"`
+
+	// MinConfidence is the confidence below which a recommendation is
+	// ignored in favour of the safe default: every test, no optimization.
+	MinConfidence float64 `mapstructure:"min_confidence"`
+
+	// TestSelectionThreshold is the confidence a test selection needs for
+	// test_selection stages to run only the selected tests instead of their
+	// whole suite. Zero uses MinConfidence.
+	TestSelectionThreshold float64 `mapstructure:"test_selection_threshold"`
+
+	// BlockOnPrediction keeps runs whose predicted failure probability
+	// exceeds FailureBlockThreshold from starting; they end as
+	// PredictedFailure. Otherwise the prediction is only recorded.
+	BlockOnPrediction     bool    `mapstructure:"block_on_prediction"`
+	FailureBlockThreshold float64 `mapstructure:"failure_block_threshold"`
+
+	// BuildOptimization asks the AI service for build advice as runs start
+	// and gives their jobs the build caches it suggests, kept on the
+	// tekton.cache_claim volume.
+	BuildOptimization bool `mapstructure:"build_optimization"`
+
+	// Failover chooses how requests spread over the endpoints: "ordered"
+	// tries them in the listed order, "round_robin" rotates the first one
+	// tried. Either way a failed endpoint is skipped for the next.
+	Failover string `mapstructure:"failover"`
+
+	// Breaker is the circuit breaker kept for each endpoint.
+	Breaker AIBreakerConfig `mapstructure:"breaker"`
+	// FailureThreshold and Cooldown, when set, take precedence over
+	// Breaker.FailureThreshold and Breaker.OpenDuration.
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	Cooldown         time.Duration `mapstructure:"cooldown"`
+
+	// RateLimit governs requests an endpoint rejects with 429.
+	RateLimit AIRateLimitConfig `mapstructure:"rate_limit"`
+
+	// Gates turn individual AI features on or off by environment and
+	// branch, so the same spec behaves differently per environment.
+	Gates []AIGateConfig `mapstructure:"gates"`
+
+	// AuditPayloads records the raw request and response of every AI call
+	// a run makes, secrets redacted, for GET
+	// /admin/pipelines/{id}/ai-exchanges. Payloads are sensitive and
+	// voluminous, so it is off by default.
+	AuditPayloads bool `mapstructure:"audit_payloads"`
+	// AuditMaxBytes caps each recorded request and response; longer ones
+	// are truncated. AuditRetention is how long exchanges are kept.
+	AuditMaxBytes  int           `mapstructure:"audit_max_bytes"`
+	AuditRetention time.Duration `mapstructure:"audit_retention"`
+}
+
+// AIGateConfig is one rule of ai_service.gates. A rule matches the runs
+// whose environment label and branch match it; empty fields match any.
+type AIGateConfig struct {
+	// Environment is matched against the spec's "environment" label.
+	Environment string `mapstructure:"environment"`
+	// Branch is a glob such as "release/*" matched against the spec's
+	// branch.
+	Branch string `mapstructure:"branch"`
+	// Features maps build_optimization, failure_prediction and
+	// test_selection to whether the feature is enabled.
+	Features map[string]bool `mapstructure:"features"`
+}
+
+// DatabaseConfig holds the database connection settings.
+type DatabaseConfig struct {
+	// Type is the database runs are kept in: "postgresql", or "sqlite"
+	// for a single replica and local development.
+	Type     string `mapstructure:"type"`
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Name     string `mapstructure:"name"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	SSLMode  string `mapstructure:"ssl_mode"`
+	// Path is the SQLite database file, or ":memory:". Only used when Type
+	// is "sqlite".
+	Path string `mapstructure:"path"`
+	// AutoMigrate applies pending schema migrations at startup. When off,
+	// startup fails while any is pending; see the migrate command.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+
+	// MaxOpenConns caps the connections open to PostgreSQL; zero is no cap.
+	// MaxIdleConns is how many of them are kept open while idle; zero
+	// keeps database/sql's default of 2. ConnMaxLifetime closes
+	// connections once they are that old; zero never does. SQLite always
+	// uses a single connection.
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+
+	ReadBreaker ReadBreakerConfig `mapstructure:"read_breaker"`
+	StatusCache StatusCacheConfig `mapstructure:"status_cache"`
+	Archive     ArchiveConfig     `mapstructure:"archive"`
+
+	// PoolSize is the number of connections run store operations may hold
+	// at once. Zero leaves it unbounded.
+	PoolSize int `mapstructure:"pool_size"`
+	// PoolPartitions splits the pool by operation class: "write" (run
+	// state), "read" (status lookups) and "list" (history and stats).
+	PoolPartitions map[string]PoolPartitionConfig `mapstructure:"pool_partitions"`
+}
+
+// PoolPartitionConfig is the share of database.pool_size of one operation
+// class.
+type PoolPartitionConfig struct {
+	// Reserved connections are only ever used by this class, so it gets
+	// them even while the others have exhausted the rest of the pool.
+	Reserved int `mapstructure:"reserved"`
+	// Max caps the connections this class holds at once. Zero is no cap
+	// beyond the pool itself.
+	Max int `mapstructure:"max"`
+}
+
+// ArchiveConfig configures moving finished runs out of the primary run store
+// into an archive once they are older than MaxAge. Run lookups and history
+// listings fall back to the archive transparently.
+type ArchiveConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxAge is how long a run stays in the primary store after finishing.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// Interval is how often due runs are moved.
+	Interval time.Duration `mapstructure:"interval"`
+	// Path is the directory archived runs are written to.
+	Path string `mapstructure:"path"`
+}
+
+// StatusCacheConfig configures the Redis read-through cache for run status
+// queries.
+type StatusCacheConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL bounds how stale the status of an unfinished run may be served;
+	// TerminalTTL applies to finished runs, which no longer change.
+	TTL         time.Duration `mapstructure:"ttl"`
+	TerminalTTL time.Duration `mapstructure:"terminal_ttl"`
+	// EventDedupWindow suppresses a run event already published, by any
+	// replica, within this window. Zero publishes every event.
+	EventDedupWindow time.Duration `mapstructure:"event_dedup_window"`
+}
+
+// AIBreakerConfig configures the per-endpoint circuit breaker of the AI
+// client.
+type AIBreakerConfig struct {
+	// FailureThreshold consecutive failed requests open an endpoint's
+	// breaker for OpenDuration, during which the endpoint is skipped.
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	OpenDuration     time.Duration `mapstructure:"open_duration"`
+}
+
+// AIRateLimitConfig configures how requests rate limited by an ml-service
+// endpoint are retried. A 429 is retried on the same endpoint once its
+// Retry-After has passed, up to Retries times per request; a request still
+// rate limited then, or asked to wait longer than MaxWait, fails over to the
+// next endpoint and finally falls back to non-AI behaviour.
+type AIRateLimitConfig struct {
+	Retries int           `mapstructure:"retries"`
+	MaxWait time.Duration `mapstructure:"max_wait"`
+}
+
+// ReadBreakerConfig configures the circuit breaker on non-critical reads of
+// the run store (history, status). Writes are never broken.
+type ReadBreakerConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// FailureThreshold consecutive failed reads open the breaker for
+	// OpenDuration.
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	OpenDuration     time.Duration `mapstructure:"open_duration"`
+	// Timeout bounds each read; a read that exceeds it counts as failed.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// ServeStale answers single-run reads from the last known copy while
+	// the breaker is open.
+	ServeStale bool `mapstructure:"serve_stale"`
+}
+
+// RedisConfig holds the Redis connection and distributed lock settings.
+type RedisConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	DB       int    `mapstructure:"db"`
+	Password string `mapstructure:"password"`
+
+	// LockTTL is how long a distributed lock survives without being
+	// refreshed. LockRefreshInterval must be well below it so a healthy
+	// holder never lets the lock lapse.
+	LockTTL             time.Duration `mapstructure:"lock_ttl"`
+	LockRefreshInterval time.Duration `mapstructure:"lock_refresh_interval"`
+	// DedupRuns holds a lock per pipeline, repo and commit from submission
+	// until the run finishes, so replicas given the same webhook start it
+	// once. Later submissions are refused as duplicates.
+	DedupRuns bool `mapstructure:"dedup_runs"`
+
+	// CancelBroadcast relays cancel requests to every replica over
+	// CancelChannel so the one running the pipeline acts on them. The
+	// requester waits up to CancelAckTimeout for its acknowledgement.
+	CancelBroadcast  bool          `mapstructure:"cancel_broadcast"`
+	CancelChannel    string        `mapstructure:"cancel_channel"`
+	CancelAckTimeout time.Duration `mapstructure:"cancel_ack_timeout"`
+
+	// RecordOrphans keeps the runs a replica leaves unfinished at shutdown
+	// in Redis. Every replica checks for them at startup and then every
+	// OrphanReconcileInterval, cancels their TaskRuns and records them as
+	// cancelled. Otherwise nothing follows their TaskRuns any more.
+	RecordOrphans           bool          `mapstructure:"record_orphans"`
+	OrphanReconcileInterval time.Duration `mapstructure:"orphan_reconcile_interval"`
+
+	// HealthInterval is how often Redis is pinged to detect an outage, and
+	// the recovery from it, for local-only mode.
+	HealthInterval time.Duration `mapstructure:"health_interval"`
+	// AssumeSingleReplica grants schedule claims locally while Redis is
+	// unreachable. Only safe when no other replica fires the schedules.
+	AssumeSingleReplica bool `mapstructure:"assume_single_replica"`
+}
+
+// Addr returns the host:port address of the Redis server.
+func (c RedisConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// MetricsConfig holds the Prometheus metrics settings.
+type MetricsConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Path      string `mapstructure:"path"`
+	Namespace string `mapstructure:"namespace"`
+
+	// MaxStageLabels caps the distinct stage names used as metric labels;
+	// further names are reported as "other".
+	MaxStageLabels int `mapstructure:"max_stage_labels"`
+	// MaxPipelineLabels does the same for pipeline names.
+	MaxPipelineLabels int `mapstructure:"max_pipeline_labels"`
+	// MaxTenantLabels does the same for tenants.
+	MaxTenantLabels int `mapstructure:"max_tenant_labels"`
+}
+
+// StatsConfig configures the periodic per-pipeline stats snapshots.
+type StatsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval is how often a snapshot is taken; Window is how far back
+	// runs are aggregated, by creation time.
+	Interval time.Duration `mapstructure:"interval"`
+	Window   time.Duration `mapstructure:"window"`
+	// HistoryFile, when set, receives every snapshot as a JSON line.
+	HistoryFile string `mapstructure:"history_file"`
+}
+
+// QueueConfig bounds how long a run may wait to start.
+type QueueConfig struct {
+	// MaxAge drops a run still queued this long after its submission
+	// instead of starting it. Zero keeps queued runs indefinitely.
+	MaxAge time.Duration `mapstructure:"max_age"`
+	// Backpressure sets how full the run slots must be before submissions
+	// are told to slow down.
+	Backpressure BackpressureConfig `mapstructure:"backpressure"`
+}
+
+// BackpressureConfig derives the backpressure level reported on /backpressure
+// and on submissions from the run slots of server.max_concurrent_pipelines.
+// With unlimited slots the level is always ok.
+type BackpressureConfig struct {
+	// BusyUtilization is the fraction of the slots in use from which the
+	// level is busy. A run waiting for a slot makes it busy too. Zero
+	// uses 0.8.
+	BusyUtilization float64 `mapstructure:"busy_utilization"`
+	// OverloadedQueueRatio is the number of queued runs per slot from which
+	// the level is overloaded. Zero uses 1: as many runs queued as there
+	// are slots.
+	OverloadedQueueRatio float64 `mapstructure:"overloaded_queue_ratio"`
+}
+
+// TracingConfig holds the distributed tracing settings.
+type TracingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter is "jaeger" (the default), exporting live spans to
+	// JaegerEndpoint, or "otlp", exporting them over OTLP/gRPC to
+	// OTLPEndpoint.
+	Exporter       string `mapstructure:"exporter"`
+	JaegerEndpoint string `mapstructure:"jaeger_endpoint"`
+	OTLPEndpoint   string `mapstructure:"otlp_endpoint"`
+	ServiceName    string `mapstructure:"service_name"`
+
+	// TimelineEndpoint is the OTLP/HTTP collector reconstructed run
+	// timelines are exported to on request, whether or not live tracing is
+	// enabled.
+	TimelineEndpoint string        `mapstructure:"timeline_endpoint"`
+	TimelineTimeout  time.Duration `mapstructure:"timeline_timeout"`
+}
+
+// ArtifactsConfig selects where run artifacts are stored.
+type ArtifactsConfig struct {
+	// Backend is either "filesystem" (streamed through the engine) or "s3"
+	// (served through presigned URLs).
+	Backend       string        `mapstructure:"backend"`
+	Path          string        `mapstructure:"path"`
+	PresignExpiry time.Duration `mapstructure:"presign_expiry"`
+	S3            S3Config      `mapstructure:"s3"`
+}
+
+// S3Config holds the settings for an S3-compatible object store.
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	Bucket    string `mapstructure:"bucket"`
+	Prefix    string `mapstructure:"prefix"`
+	Region    string `mapstructure:"region"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+}
+
+// LogsConfig holds the pipeline log capture settings.
+type LogsConfig struct {
+	Path string `mapstructure:"path"`
+
+	// RetentionDays is how many days a stage's log is kept after its last
+	// line, independently of how long the run is kept. Zero keeps logs
+	// forever.
+	RetentionDays int `mapstructure:"retention_days"`
+	// StageRetentionDays overrides RetentionDays by stage name, e.g. to drop
+	// verbose integration test output sooner. Zero keeps that stage's logs
+	// forever.
+	StageRetentionDays map[string]int `mapstructure:"stage_retention_days"`
+	// PurgeInterval is how often expired logs are purged.
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+// CredentialsConfig selects the provider minting pipeline-scoped credentials.
+type CredentialsConfig struct {
+	// Provider is "none" (disabled) or "http".
+	Provider string                `mapstructure:"provider"`
+	TTL      time.Duration         `mapstructure:"ttl"`
+	HTTP     CredentialsHTTPConfig `mapstructure:"http"`
+}
+
+// CredentialsHTTPConfig configures the HTTP credential broker.
+type CredentialsHTTPConfig struct {
+	MintURL   string        `mapstructure:"mint_url"`
+	RevokeURL string        `mapstructure:"revoke_url"`
+	Token     string        `mapstructure:"token"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+}
+
+// PipelineConfig holds the rules applied to every pipeline spec.
+type PipelineConfig struct {
+	// AllowedRegistries restricts stage images to these registry prefixes.
+	// Empty allows any registry.
+	AllowedRegistries []string `mapstructure:"allowed_registries"`
+
+	// AllowedServiceAccounts lists the Kubernetes service accounts a stage
+	// may request with service_account. Empty forbids the field.
+	AllowedServiceAccounts []string `mapstructure:"allowed_service_accounts"`
+
+	// PropagatedParams lists the spec parameters attached to every span and
+	// log line of a run. Only list parameters that are neither secret nor
+	// high-cardinality; anything not listed is never propagated.
+	PropagatedParams []string `mapstructure:"propagated_params"`
+
+	// Preflight checks a pipeline's resource requests against the quota
+	// left in the Tekton namespace before admitting it: "off", "reject"
+	// (refuse the submission) or "queue" (hold the run until capacity frees
+	// up or PreflightTimeout passes).
+	Preflight         string        `mapstructure:"preflight"`
+	PreflightTimeout  time.Duration `mapstructure:"preflight_timeout"`
+	PreflightInterval time.Duration `mapstructure:"preflight_interval"`
+
+	// MinResubmitInterval rejects a submission of a pipeline for a repo and
+	// commit that was already submitted less than this long ago. Zero
+	// disables the check.
+	MinResubmitInterval time.Duration `mapstructure:"min_resubmit_interval"`
+
+	// MaxStages caps the number of stages a pipeline may execute, counted
+	// after matrix expansion and including finally stages and the post-run
+	// hook. Larger specs are rejected at submission. Zero means no limit.
+	MaxStages int `mapstructure:"max_stages"`
+
+	// MaxArtifactBytes caps the total size of the artifacts uploaded for a
+	// run. Zero means no limit.
+	MaxArtifactBytes int64 `mapstructure:"max_artifact_bytes"`
+
+	// SecretScan looks for secrets pasted into spec fields and submitted
+	// params, such as tokens and private keys: "off", "warn" (report them
+	// as validation warnings) or "reject" (refuse the spec). A value that
+	// only looks like a secret is accepted when its path is listed in the
+	// spec's pipeline.devmind.io/allow-secrets annotation.
+	SecretScan string `mapstructure:"secret_scan"`
+
+	// HardTimeout is the longest a pipeline may execute, however its stage
+	// timeouts and Tekton's own behave. A run exceeding it is force-cancelled
+	// and recorded as timed out with reason hard_timeout. Zero means no
+	// limit.
+	HardTimeout time.Duration `mapstructure:"hard_timeout"`
+
+	// MaxChainDepth caps how many runs deep the on_success and on_failure
+	// triggers of pipelines may chain; triggers past it are skipped. Zero
+	// uses 5.
+	MaxChainDepth int `mapstructure:"max_chain_depth"`
+}
+
+// PolicyConfig configures the OPA/Rego admission policy evaluated against
+// every valid submission. The policy is loaded from File or evaluated by the
+// OPA server at URL; exactly one must be set when Enabled.
+type PolicyConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	File    string `mapstructure:"file"`
+	URL     string `mapstructure:"url"`
+	// Query names the decision document, e.g. data.devmind.admission.
+	Query   string        `mapstructure:"query"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	// FailOpen admits submissions when the policy cannot be evaluated.
+	FailOpen bool `mapstructure:"fail_open"`
+}
+
+// SchedulerConfig lists the pipelines submitted on a schedule and decides
+// how runs share the engine.
+type SchedulerConfig struct {
+	// Distributed claims each firing in Redis so that only one of several
+	// replicas submits it.
+	Distributed bool             `mapstructure:"distributed"`
+	Schedules   []ScheduleConfig `mapstructure:"schedules"`
+
+	// Mode decides which queued run gets the next of the
+	// server.max_concurrent_pipelines run slots: "fifo" hands them out in
+	// submission order, "fair" round-robin across tenants.
+	Mode string `mapstructure:"mode"`
+	// TenantLabel is the spec label naming a run's tenant, for fair mode and
+	// the queue wait metric; runs without it are grouped by repo.
+	TenantLabel string `mapstructure:"tenant_label"`
+	// PriorityLabel is the spec label naming a run's priority for the queue
+	// wait metric.
+	PriorityLabel string `mapstructure:"priority_label"`
+}
+
+// WebhooksConfig holds the source control webhooks served on
+// POST /webhooks/{provider}. A provider without a secret refuses every
+// delivery.
+type WebhooksConfig struct {
+	// GitHubSecret verifies the X-Hub-Signature-256 HMAC of GitHub
+	// deliveries.
+	GitHubSecret string `mapstructure:"github_secret"`
+	// GitLabSecret is the secret token GitLab sends in X-Gitlab-Token.
+	GitLabSecret string `mapstructure:"gitlab_secret"`
+	// Triggers decide which pipelines an event submits; every matching
+	// trigger submits one run.
+	Triggers []WebhookTriggerConfig `mapstructure:"triggers"`
+}
+
+// WebhookTriggerConfig submits the pipeline of SpecFile, at the event's repo,
+// branch and commit, for the events it matches.
+type WebhookTriggerConfig struct {
+	// Repo is the repository as host/path, e.g. github.com/org/app.
+	Repo string `mapstructure:"repo"`
+	// Branches are path.Match patterns of the branches matched; empty
+	// matches every branch. For pull and merge requests the branch is the
+	// source branch.
+	Branches []string `mapstructure:"branches"`
+	// Events are "push" and "pull_request", which includes GitLab merge
+	// requests; empty matches pushes only.
+	Events   []string          `mapstructure:"events"`
+	SpecFile string            `mapstructure:"spec_file"`
+	Params   map[string]string `mapstructure:"params"`
+}
+
+// AuthConfig decides how callers of the HTTP and gRPC APIs authenticate.
+// Every call but the health probes, webhook deliveries and the admin
+// endpoints, which have credentials of their own, must carry an
+// "Authorization: Bearer" token; calls without a valid one are answered
+// with 401 or Unauthenticated.
+type AuthConfig struct {
+	// Mode is "none", "api_key" or "jwt".
+	Mode string `mapstructure:"mode"`
+	// APIKeys are the tokens accepted in api_key mode. The name of the key
+	// a caller presented is its subject in the access log.
+	APIKeys []AuthAPIKeyConfig `mapstructure:"api_keys"`
+	// JWT verifies the tokens of jwt mode.
+	JWT AuthJWTConfig `mapstructure:"jwt"`
+}
+
+// AuthAPIKeyConfig is one key of auth.api_keys.
+type AuthAPIKeyConfig struct {
+	Name string `mapstructure:"name"`
+	Key  string `mapstructure:"key"`
+}
+
+// AuthJWTConfig holds the settings of auth.mode jwt. A token is accepted
+// when it is signed (RS256, RS384, RS512, ES256, ES384 or ES512) by a key
+// of the JWKS served at JWKSURL, has not expired, and names Issuer as its
+// iss claim and Audience among its aud claim. Its sub claim is the
+// caller's subject.
+type AuthJWTConfig struct {
+	JWKSURL  string `mapstructure:"jwks_url"`
+	Issuer   string `mapstructure:"issuer"`
+	Audience string `mapstructure:"audience"`
+	// JWKSRefresh is how often the key set is fetched again; a token
+	// signed by a key not yet known fetches it early.
+	JWKSRefresh time.Duration `mapstructure:"jwks_refresh"`
+	// Leeway is the clock skew tolerated on the exp and nbf claims.
+	Leeway time.Duration `mapstructure:"leeway"`
+}
+
+// ScheduleConfig is a single schedule.
+type ScheduleConfig struct {
+	Name string `mapstructure:"name"`
+	// Cron is a standard five-field expression or a descriptor such as
+	// "@daily".
+	Cron     string            `mapstructure:"cron"`
+	SpecFile string            `mapstructure:"spec_file"`
+	Params   map[string]string `mapstructure:"params"`
+
+	// Jitter spreads firings over a window of this size. Each schedule gets
+	// a fixed offset within it derived from its name.
+	Jitter time.Duration `mapstructure:"jitter"`
+}
+
+// Load decodes the configuration registered with viper (defaults, config
+// file, environment and flags) into a Config. When some settings fail to
+// decode the error is returned together with the Config decoded from the
+// others, so every remaining problem can still be reported.
+func Load() (*Config, error) {
+	var cfg Config
+	if err := viper.Unmarshal(&cfg); err != nil {
+		return &cfg, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	return &cfg, nil
+}
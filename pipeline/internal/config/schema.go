@@ -0,0 +1,134 @@
+package config
+
+import (
+	_ "embed"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+// SchemaURI is the JSON Schema dialect of Schema.
+const SchemaURI = "https://json-schema.org/draft/2020-12/schema"
+
+// durationPattern matches the durations time.ParseDuration accepts, less the
+// negative ones Validate rejects.
+const durationPattern = `^(0|([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|ms|s|m|h))+$`
+
+// configSource is parsed for the doc comments of the Config fields, so the
+// schema's descriptions are those of the code.
+//
+//go:embed config.go
+var configSource string
+
+// Schema describes Config as a JSON Schema: the type of every setting, its
+// doc comment as description and its value in defaults, the nested settings
+// registered as viper defaults, as default. Unknown keys are rejected below
+// the top level only, as CheckFile does without strict.
+func Schema(defaults map[string]interface{}) map[string]interface{} {
+	docs := fieldDocs()
+	s := schemaFor(reflect.TypeOf(Config{}), docs, defaults)
+	s["$schema"] = SchemaURI
+	s["title"] = "DevMind Pipeline Engine configuration"
+	s["additionalProperties"] = true
+	return s
+}
+
+// schemaFor returns the schema of a value of type t whose default, when it
+// has one, is def.
+func schemaFor(t reflect.Type, docs map[string]map[string]string, def interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		// Numbers decode as nanoseconds.
+		return map[string]interface{}{"type": []string{"string", "integer"}, "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), docs, nil)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), docs, nil)}
+	case reflect.Struct:
+		defs, _ := def.(map[string]interface{})
+		props := make(map[string]interface{}, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			fd, hasDefault := defs[name]
+			p := schemaFor(f.Type, docs, fd)
+			if doc := docs[t.Name()][f.Name]; doc != "" {
+				p["description"] = doc
+			}
+			if _, nested := fd.(map[string]interface{}); hasDefault && !nested {
+				p["default"] = fd
+			}
+			props[name] = p
+		}
+		s := map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+		if doc := docs[t.Name()][""]; doc != "" {
+			s["description"] = doc
+		}
+		return s
+	}
+	return map[string]interface{}{}
+}
+
+// fieldDocs returns the doc comments of the struct types of configSource by
+// type and field name; the type's own doc is under "".
+func fieldDocs() map[string]map[string]string {
+	f, err := parser.ParseFile(token.NewFileSet(), "config.go", configSource, parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	docs := make(map[string]map[string]string)
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			typeDoc := ts.Doc
+			if typeDoc == nil {
+				typeDoc = gen.Doc
+			}
+			fields := map[string]string{"": commentText(typeDoc)}
+			for _, field := range st.Fields.List {
+				doc := field.Doc
+				if doc == nil {
+					doc = field.Comment
+				}
+				for _, name := range field.Names {
+					fields[name.Name] = commentText(doc)
+				}
+			}
+			docs[ts.Name.Name] = fields
+		}
+	}
+	return docs
+}
+
+// commentText joins the lines of a comment into one.
+func commentText(c *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(c.Text()), " ")
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSchemaDescribesConfig(t *testing.T) {
+	s := Schema(map[string]interface{}{
+		"queue": map[string]interface{}{"max_age": "10m"},
+	})
+	if s["$schema"] != SchemaURI || s["additionalProperties"] != true {
+		t.Errorf("top level = %v", s)
+	}
+
+	queue := s["properties"].(map[string]interface{})["queue"].(map[string]interface{})
+	if queue["additionalProperties"] != false || queue["description"] == "" {
+		t.Errorf("queue = %v, want a closed object with a description", queue)
+	}
+	props := queue["properties"].(map[string]interface{})
+	maxAge := props["max_age"].(map[string]interface{})
+	if maxAge["default"] != "10m" {
+		t.Errorf("queue.max_age default = %v, want 10m", maxAge["default"])
+	}
+	if maxAge["description"] != "MaxAge drops a run still queued this long after its submission instead of starting it. Zero keeps queued runs indefinitely." {
+		t.Errorf("queue.max_age description = %q", maxAge["description"])
+	}
+	ratio := props["backpressure"].(map[string]interface{})["properties"].(map[string]interface{})["busy_utilization"].(map[string]interface{})
+	if ratio["type"] != "number" {
+		t.Errorf("queue.backpressure.busy_utilization type = %v, want number", ratio["type"])
+	}
+
+	pattern := regexp.MustCompile(maxAge["pattern"].(string))
+	for d, want := range map[string]bool{"0": true, "30s": true, "1h30m": true, "1.5s": true, "5 minutes": false, "-1s": false, "10": false} {
+		if got := pattern.MatchString(d); got != want {
+			t.Errorf("duration pattern matches %q = %t, want %t", d, got, want)
+		}
+	}
+}
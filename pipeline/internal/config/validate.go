@@ -0,0 +1,410 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Problem is a single invalid setting.
+type Problem struct {
+	// Key is the dotted configuration key, e.g. tekton.api_timeout. It is
+	// empty for problems not tied to one key.
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return fmt.Sprintf("invalid configuration: %s", e.Problems[0].describe())
+	}
+	return fmt.Sprintf("invalid configuration: %d problems, first: %s", len(e.Problems), e.Problems[0].describe())
+}
+
+func (p Problem) describe() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + ": " + p.Message
+}
+
+// problems collects Problems and returns them as a ValidationError.
+type problems []Problem
+
+func (ps *problems) add(key, format string, args ...interface{}) {
+	*ps = append(*ps, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps problems) err() error {
+	if len(ps) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: ps}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// CheckFile checks every key set in the config file at path against the
+// Config schema: keys Config has no field for and values that cannot be
+// decoded into their field, such as a malformed duration. Unknown top-level
+// keys are only reported when strict is set, since a file shared with other
+// tools may carry sections of its own.
+func CheckFile(path string, strict bool) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return &ValidationError{Problems: []Problem{{Message: fmt.Sprintf("failed to read config file: %v", err)}}}
+	}
+
+	keys := v.AllKeys()
+	sort.Strings(keys)
+	var ps problems
+	unknownTop := make(map[string]bool)
+	for _, key := range keys {
+		path := strings.Split(key, ".")
+		t, known, top := lookupKey(reflect.TypeOf(Config{}), path)
+		switch {
+		case !known && top:
+			if strict && !unknownTop[path[0]] {
+				unknownTop[path[0]] = true
+				ps.add(path[0], "unknown top-level key")
+			}
+		case !known:
+			ps.add(key, "unknown key")
+		case known && t != nil:
+			if msg := checkValue(t, v.Get(key)); msg != "" {
+				ps.add(key, "%s", msg)
+			}
+		}
+	}
+	return ps.err()
+}
+
+// lookupKey resolves the path of a key in the struct type t. It returns the
+// type of the field the key sets, or nil when the key lies under a map whose
+// keys are free-form; top reports that the first segment was already
+// unknown.
+func lookupKey(t reflect.Type, path []string) (field reflect.Type, known, top bool) {
+	for i, seg := range path {
+		if t.Kind() == reflect.Map {
+			return nil, true, false
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, false, false
+		}
+		f, ok := fieldByTag(t, seg)
+		if !ok {
+			return nil, false, i == 0
+		}
+		t = f.Type
+	}
+	return t, true, false
+}
+
+func fieldByTag(t reflect.Type, tag string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if name == tag {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// checkValue reports why v cannot be decoded into a field of type t, or ""
+// when it can. Strings are accepted for numbers and booleans as long as they
+// parse, as the decoder does.
+func checkValue(t reflect.Type, v interface{}) string {
+	s, isString := v.(string)
+	if t == durationType {
+		if !isString {
+			return ""
+		}
+		if _, err := time.ParseDuration(s); err != nil {
+			return fmt.Sprintf("invalid duration %q, want e.g. \"30s\" or \"5m\"", s)
+		}
+		return ""
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if isString {
+			if _, err := strconv.ParseInt(s, 0, 64); err != nil {
+				return fmt.Sprintf("invalid integer %q", s)
+			}
+		} else if !isNumber(v) {
+			return "must be an integer"
+		}
+	case reflect.Float32, reflect.Float64:
+		if isString {
+			if _, err := strconv.ParseFloat(s, 64); err != nil {
+				return fmt.Sprintf("invalid number %q", s)
+			}
+		} else if !isNumber(v) {
+			return "must be a number"
+		}
+	case reflect.Bool:
+		if isString {
+			if _, err := strconv.ParseBool(s); err != nil {
+				return fmt.Sprintf("invalid boolean %q", s)
+			}
+		} else if _, ok := v.(bool); !ok {
+			return "must be true or false"
+		}
+	case reflect.String:
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return "must be a string"
+		}
+	case reflect.Struct, reflect.Map:
+		if _, ok := v.(map[string]interface{}); !ok {
+			return "must be a mapping"
+		}
+	}
+	return ""
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// Validate checks the decoded configuration for values the engine would
+// reject or misbehave on: out-of-range ports, negative durations and limits,
+// and unknown enum values.
+func (c *Config) Validate() error {
+	var ps problems
+
+	ps.port("server.grpc_port", c.Server.GRPCPort)
+	ps.port("server.http_port", c.Server.HTTPPort)
+	if c.Metrics.Enabled {
+		ps.port("server.metrics_port", c.Server.MetricsPort)
+	}
+	if c.Redis.Port < 1 || c.Redis.Port > 65535 {
+		ps.add("redis.port", "must be a port between 1 and 65535, got %d", c.Redis.Port)
+	}
+	if c.Database.Port < 0 || c.Database.Port > 65535 {
+		ps.add("database.port", "must be a port between 1 and 65535, got %d", c.Database.Port)
+	}
+
+	negativeDurations(&ps, "", reflect.ValueOf(*c))
+	ps.nonNegative("server.max_concurrent_pipelines", int64(c.Server.MaxConcurrentPipelines))
+	ps.nonNegative("pipeline.max_stages", int64(c.Pipeline.MaxStages))
+	ps.nonNegative("pipeline.max_chain_depth", int64(c.Pipeline.MaxChainDepth))
+	ps.nonNegative("pipeline.max_artifact_bytes", c.Pipeline.MaxArtifactBytes)
+	ps.nonNegative("logs.retention_days", int64(c.Logs.RetentionDays))
+	stages := make([]string, 0, len(c.Logs.StageRetentionDays))
+	for stage := range c.Logs.StageRetentionDays {
+		stages = append(stages, stage)
+	}
+	sort.Strings(stages)
+	for _, stage := range stages {
+		ps.nonNegative("logs.stage_retention_days."+stage, int64(c.Logs.StageRetentionDays[stage]))
+	}
+	if b := c.Queue.Backpressure; b.BusyUtilization < 0 || b.BusyUtilization > 1 {
+		ps.add("queue.backpressure.busy_utilization", "must be between 0 and 1, got %g", b.BusyUtilization)
+	}
+	if r := c.Queue.Backpressure.OverloadedQueueRatio; r < 0 {
+		ps.add("queue.backpressure.overloaded_queue_ratio", "must not be negative, got %g", r)
+	}
+	if c.Server.RateLimitEnabled {
+		if c.Server.RateLimitRPS <= 0 {
+			ps.add("server.rate_limit_rps", "must be positive, got %g", c.Server.RateLimitRPS)
+		}
+		if c.Server.RateLimitBurst < 1 {
+			ps.add("server.rate_limit_burst", "must be at least 1, got %d", c.Server.RateLimitBurst)
+		}
+	}
+	if c.AIService.MinConfidence < 0 || c.AIService.MinConfidence > 1 {
+		ps.add("ai_service.min_confidence", "must be between 0 and 1, got %g", c.AIService.MinConfidence)
+	}
+	if c.AIService.TestSelectionThreshold < 0 || c.AIService.TestSelectionThreshold > 1 {
+		ps.add("ai_service.test_selection_threshold", "must be between 0 and 1, got %g", c.AIService.TestSelectionThreshold)
+	}
+	if c.AIService.FailureBlockThreshold < 0 || c.AIService.FailureBlockThreshold > 1 {
+		ps.add("ai_service.failure_block_threshold", "must be between 0 and 1, got %g", c.AIService.FailureBlockThreshold)
+	}
+	if c.AIService.BuildOptimization && c.Tekton.CacheClaim == "" {
+		ps.add("ai_service.build_optimization", "requires tekton.cache_claim to keep the build caches on")
+	}
+
+	ps.oneOf("logging.level", strings.ToLower(c.Logging.Level), "panic", "fatal", "error", "warn", "warning", "info", "debug", "trace")
+	ps.oneOf("logging.format", c.Logging.Format, "", "json", "text")
+	ps.oneOf("logging.exporter", c.Logging.Exporter, "", "stdout", "otlp")
+	for _, p := range c.Logging.Redact.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			ps.add("logging.redact.patterns", "must be regular expressions, got %q: %v", p, err)
+		}
+	}
+	ps.oneOf("tracing.exporter", c.Tracing.Exporter, "", "jaeger", "otlp")
+	ps.oneOf("artifacts.backend", c.Artifacts.Backend, "", "filesystem", "s3")
+	ps.oneOf("credentials.provider", c.Credentials.Provider, "", "none", "http")
+	ps.oneOf("pipeline.preflight", c.Pipeline.Preflight, "", "off", "reject", "queue")
+	ps.oneOf("pipeline.secret_scan", c.Pipeline.SecretScan, "", "off", "warn", "reject")
+	ps.nonNegative("ai_service.audit_max_bytes", int64(c.AIService.AuditMaxBytes))
+	ps.nonNegative("database.max_open_conns", int64(c.Database.MaxOpenConns))
+	ps.nonNegative("database.max_idle_conns", int64(c.Database.MaxIdleConns))
+	ps.oneOf("database.type", c.Database.Type, "", "postgresql", "sqlite")
+	if c.Database.Type == "sqlite" && c.Database.Path == "" {
+		ps.add("database.path", "is required when database.type is sqlite")
+	}
+	ps.oneOf("scheduler.mode", c.Scheduler.Mode, "", "fifo", "fair")
+	ps.oneOf("ai_service.failover", c.AIService.Failover, "", "ordered", "round_robin")
+	ps.nonNegative("ai_service.rate_limit.retries", int64(c.AIService.RateLimit.Retries))
+	ps.nonNegative("ai_service.failure_threshold", int64(c.AIService.FailureThreshold))
+	ps.nonNegative("ai_service.cooldown", int64(c.AIService.Cooldown))
+	for _, dep := range c.Server.Readiness.Required {
+		ps.oneOf("server.readiness.required", dep, "tekton", "argocd", "ai_service", "database", "redis")
+	}
+	if s := c.ArgoCD.TokenSecret; s != "" {
+		if ns, name, ok := strings.Cut(s, "/"); !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+			ps.add("argocd.token_secret", "must be namespace/name, got %q", s)
+		}
+	}
+	c.Database.validatePool(&ps)
+	c.Auth.validate(&ps)
+	for i, t := range c.Webhooks.Triggers {
+		key := fmt.Sprintf("webhooks.triggers[%d]", i)
+		if t.Repo == "" {
+			ps.add(key+".repo", "is required")
+		}
+		if t.SpecFile == "" {
+			ps.add(key+".spec_file", "is required")
+		}
+		for _, b := range t.Branches {
+			if _, err := path.Match(b, ""); err != nil {
+				ps.add(key+".branches", "must be path patterns, got %q", b)
+			}
+		}
+		for _, e := range t.Events {
+			ps.oneOf(key+".events", e, "push", "pull_request")
+		}
+	}
+
+	return ps.err()
+}
+
+// validate checks that the credentials of the auth mode are set.
+func (a AuthConfig) validate(ps *problems) {
+	ps.oneOf("auth.mode", a.Mode, "", "none", "api_key", "jwt")
+	switch a.Mode {
+	case "api_key":
+		if len(a.APIKeys) == 0 {
+			ps.add("auth.api_keys", "is required in api_key mode")
+		}
+		for i, k := range a.APIKeys {
+			key := fmt.Sprintf("auth.api_keys[%d]", i)
+			if k.Name == "" {
+				ps.add(key+".name", "is required")
+			}
+			if k.Key == "" {
+				ps.add(key+".key", "is required")
+			}
+		}
+	case "jwt":
+		if u, err := url.Parse(a.JWT.JWKSURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			ps.add("auth.jwt.jwks_url", "must be an http or https URL, got %q", a.JWT.JWKSURL)
+		}
+		if a.JWT.Issuer == "" {
+			ps.add("auth.jwt.issuer", "is required in jwt mode")
+		}
+		if a.JWT.Audience == "" {
+			ps.add("auth.jwt.audience", "is required in jwt mode")
+		}
+	}
+}
+
+// validatePool checks that the pool partitions name known operation
+// classes and reserve no more connections than the pool holds.
+func (d DatabaseConfig) validatePool(ps *problems) {
+	ps.nonNegative("database.pool_size", int64(d.PoolSize))
+	classes := make([]string, 0, len(d.PoolPartitions))
+	for class := range d.PoolPartitions {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	reserved := 0
+	for _, class := range classes {
+		key := "database.pool_partitions." + class
+		p := d.PoolPartitions[class]
+		ps.oneOf(key, class, "write", "read", "list")
+		ps.nonNegative(key+".reserved", int64(p.Reserved))
+		ps.nonNegative(key+".max", int64(p.Max))
+		if p.Max > 0 && p.Reserved > p.Max {
+			ps.add(key+".reserved", "must not exceed max (%d), got %d", p.Max, p.Reserved)
+		}
+		reserved += p.Reserved
+	}
+	switch {
+	case reserved > 0 && d.PoolSize <= 0:
+		ps.add("database.pool_partitions", "reserving connections requires database.pool_size")
+	case d.PoolSize > 0 && reserved > d.PoolSize:
+		ps.add("database.pool_partitions", "reserve %d connections, more than database.pool_size (%d)", reserved, d.PoolSize)
+	}
+}
+
+func (ps *problems) port(key, port string) {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		ps.add(key, "must be a port between 1 and 65535, got %q", port)
+	}
+}
+
+func (ps *problems) nonNegative(key string, n int64) {
+	if n < 0 {
+		ps.add(key, "must not be negative, got %v", n)
+	}
+}
+
+func (ps *problems) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	var shown []string
+	for _, a := range allowed {
+		if a != "" {
+			shown = append(shown, strconv.Quote(a))
+		}
+	}
+	ps.add(key, "must be one of %s, got %q", strings.Join(shown, ", "), value)
+}
+
+// negativeDurations reports every negative duration in the struct value v,
+// whose key prefix is prefix. No duration setting means anything when
+// negative.
+func negativeDurations(ps *problems, prefix string, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		switch fv := v.Field(i); {
+		case fv.Type() == durationType:
+			if d := time.Duration(fv.Int()); d < 0 {
+				ps.add(key, "must not be negative, got %s", d)
+			}
+		case fv.Kind() == reflect.Struct:
+			negativeDurations(ps, key, fv)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func problemKeys(t *testing.T, err error) map[string]bool {
+	t.Helper()
+	keys := make(map[string]bool)
+	if err == nil {
+		return keys
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want a ValidationError", err)
+	}
+	for _, p := range verr.Problems {
+		keys[p.Key] = true
+	}
+	return keys
+}
+
+func TestCheckFileReportsUnknownKeysAndBadValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+tekton:
+  namesapce: ci
+  api_timeout: 3x
+  api_burst: lots
+logs:
+  stage_retention_days:
+    integration: 1
+network:
+  overrides:
+    ml-service: http://proxy
+helm:
+  replicas: 3
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := problemKeys(t, CheckFile(path, false))
+	for _, want := range []string{"tekton.namesapce", "tekton.api_timeout", "tekton.api_burst"} {
+		if !keys[want] {
+			t.Errorf("no problem reported for %s", want)
+		}
+	}
+	if len(keys) != 3 {
+		t.Errorf("problems = %v, want only the three tekton keys", keys)
+	}
+
+	if keys := problemKeys(t, CheckFile(path, true)); !keys["helm"] || len(keys) != 4 {
+		t.Errorf("strict problems = %v, want the tekton keys and helm", keys)
+	}
+}
+
+func TestValidateRanges(t *testing.T) {
+	cfg := &Config{
+		Server:    ServerConfig{GRPCPort: "8080", HTTPPort: "70000", MaxConcurrentPipelines: -1, RateLimitEnabled: true},
+		Redis:     RedisConfig{Port: 6379},
+		Tekton:    TektonConfig{APITimeout: -1},
+		ArgoCD:    ArgoCDConfig{TokenSecret: "devmind-token"},
+		AIService: AIServiceConfig{BuildOptimization: true},
+		Logging:   LoggingConfig{Level: "info", Format: "yaml"},
+	}
+	keys := problemKeys(t, cfg.Validate())
+	for _, want := range []string{"server.http_port", "server.max_concurrent_pipelines", "tekton.api_timeout", "server.rate_limit_rps", "server.rate_limit_burst", "argocd.token_secret", "ai_service.build_optimization", "logging.format"} {
+		if !keys[want] {
+			t.Errorf("no problem reported for %s", want)
+		}
+	}
+	if len(keys) != 8 {
+		t.Errorf("problems = %v", keys)
+	}
+
+	cfg = &Config{
+		Server:  ServerConfig{GRPCPort: "8080", HTTPPort: "8081"},
+		Redis:   RedisConfig{Port: 6379},
+		Logging: LoggingConfig{Level: "debug"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want nil", err)
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	cfg := &Config{
+		Server:  ServerConfig{GRPCPort: "8080", HTTPPort: "8081"},
+		Redis:   RedisConfig{Port: 6379},
+		Logging: LoggingConfig{Level: "info"},
+		Auth:    AuthConfig{Mode: "api_key", APIKeys: []AuthAPIKeyConfig{{Name: "ci"}}},
+	}
+	if keys := problemKeys(t, cfg.Validate()); !keys["auth.api_keys[0].key"] || len(keys) != 1 {
+		t.Errorf("api_key mode: problems = %v", keys)
+	}
+
+	cfg.Auth = AuthConfig{Mode: "jwt", JWT: AuthJWTConfig{JWKSURL: "id.example.com/jwks", Issuer: "https://id.example.com"}}
+	keys := problemKeys(t, cfg.Validate())
+	for _, want := range []string{"auth.jwt.jwks_url", "auth.jwt.audience"} {
+		if !keys[want] {
+			t.Errorf("no problem reported for %s", want)
+		}
+	}
+	if len(keys) != 2 {
+		t.Errorf("jwt mode: problems = %v", keys)
+	}
+
+	cfg.Auth = AuthConfig{Mode: "oauth"}
+	if keys := problemKeys(t, cfg.Validate()); !keys["auth.mode"] || len(keys) != 1 {
+		t.Errorf("unknown mode: problems = %v", keys)
+	}
+}
+
+func TestValidatePoolPartitions(t *testing.T) {
+	cfg := &Config{
+		Server:  ServerConfig{GRPCPort: "8080", HTTPPort: "8081"},
+		Redis:   RedisConfig{Port: 6379},
+		Logging: LoggingConfig{Level: "info"},
+		Database: DatabaseConfig{PoolSize: 4, PoolPartitions: map[string]PoolPartitionConfig{
+			"write":     {Reserved: 3},
+			"list":      {Reserved: 2, Max: 1},
+			"analytics": {Max: 2},
+		}},
+	}
+	keys := problemKeys(t, cfg.Validate())
+	for _, want := range []string{"database.pool_partitions.analytics", "database.pool_partitions.list.reserved", "database.pool_partitions"} {
+		if !keys[want] {
+			t.Errorf("no problem reported for %s", want)
+		}
+	}
+	if len(keys) != 3 {
+		t.Errorf("problems = %v", keys)
+	}
+
+	cfg.Database = DatabaseConfig{PoolPartitions: map[string]PoolPartitionConfig{"write": {Reserved: 1}}}
+	if keys := problemKeys(t, cfg.Validate()); !keys["database.pool_partitions"] || len(keys) != 1 {
+		t.Errorf("reservation without a pool size: problems = %v", keys)
+	}
+}
+
+func TestValidateDatabaseType(t *testing.T) {
+	cfg := &Config{
+		Server:   ServerConfig{GRPCPort: "8080", HTTPPort: "8081"},
+		Redis:    RedisConfig{Port: 6379},
+		Logging:  LoggingConfig{Level: "info"},
+		Database: DatabaseConfig{Type: "sqlite"},
+	}
+	if keys := problemKeys(t, cfg.Validate()); !keys["database.path"] || len(keys) != 1 {
+		t.Errorf("sqlite without a path: problems = %v", keys)
+	}
+	cfg.Database = DatabaseConfig{Type: "mysql"}
+	if keys := problemKeys(t, cfg.Validate()); !keys["database.type"] || len(keys) != 1 {
+		t.Errorf("unknown type: problems = %v", keys)
+	}
+}
+
+func TestCheckFileAcceptsAIBreakerKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "ai_service:\n  failure_threshold: 5\n  cooldown: 1m\n  breaker:\n    open_duration: 30s\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if keys := problemKeys(t, CheckFile(path, true)); len(keys) != 0 {
+		t.Errorf("problems = %v, want none", keys)
+	}
+}
@@ -0,0 +1,61 @@
+// Package credentials mints short-lived, pipeline-scoped credentials (cloud
+// STS tokens, registry tokens) at pipeline start and revokes them when the
+// pipeline ends.
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+const redacted = "[REDACTED]"
+
+// Credential is a minted secret. Its values are exposed to stages as
+// environment variables and are redacted from every string and JSON
+// representation so that logging a Credential never leaks it.
+type Credential struct {
+	// ID is the provider's handle used to revoke the credential.
+	ID        string
+	Env       map[string]string
+	ExpiresAt time.Time
+}
+
+// String implements fmt.Stringer without revealing the secret values. Value
+// receivers keep both Credential and *Credential redacted.
+func (c Credential) String() string {
+	return fmt.Sprintf("Credential{ID: %s, Env: %s, ExpiresAt: %s}", c.ID, redacted, c.ExpiresAt.Format(time.RFC3339))
+}
+
+// GoString implements fmt.GoStringer so %#v is redacted as well.
+func (c Credential) GoString() string {
+	return c.String()
+}
+
+// MarshalJSON keeps the secret values out of serialized output.
+func (c Credential) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"id":%q,"env":%q,"expires_at":%q}`, c.ID, redacted, c.ExpiresAt.Format(time.RFC3339))), nil
+}
+
+// Provider mints and revokes pipeline-scoped credentials.
+type Provider interface {
+	Mint(ctx context.Context, run *pipeline.Run) (*Credential, error)
+	Revoke(ctx context.Context, cred *Credential) error
+}
+
+// New creates the Provider selected by cfg.Provider. It returns nil when no
+// provider is configured.
+func New(cfg config.CredentialsConfig, network egress.Config) (Provider, error) {
+	switch cfg.Provider {
+	case "", "none":
+		return nil, nil
+	case "http":
+		return NewHTTPProvider(cfg, network)
+	default:
+		return nil, fmt.Errorf("unsupported credentials provider %q", cfg.Provider)
+	}
+}
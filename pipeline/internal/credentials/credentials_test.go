@@ -0,0 +1,32 @@
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCredentialIsRedacted(t *testing.T) {
+	cred := &Credential{ID: "c1", Env: map[string]string{"TOKEN": "s3cr3t"}}
+
+	for name, out := range map[string]string{
+		"%v":  fmt.Sprintf("%v", cred),
+		"%+v": fmt.Sprintf("%+v", cred),
+		"%#v": fmt.Sprintf("%#v", cred),
+		"%s":  fmt.Sprintf("%s", cred),
+		"val": fmt.Sprintf("%+v", *cred),
+	} {
+		if strings.Contains(out, "s3cr3t") {
+			t.Errorf("%s leaked secret: %s", name, out)
+		}
+	}
+
+	buf, err := json.Marshal(cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), "s3cr3t") {
+		t.Errorf("json leaked secret: %s", buf)
+	}
+}
@@ -0,0 +1,120 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+// HTTPProvider delegates minting and revocation to an external credential
+// broker. Credentials are minted with POST <mint_url> and revoked with
+// DELETE <revoke_url>/<id>.
+type HTTPProvider struct {
+	mintURL    string
+	revokeURL  string
+	token      string
+	ttl        time.Duration
+	httpClient *http.Client
+}
+
+// NewHTTPProvider creates an HTTPProvider from cfg, reaching the broker
+// through the proxy network configures for it.
+func NewHTTPProvider(cfg config.CredentialsConfig, network egress.Config) (*HTTPProvider, error) {
+	if cfg.HTTP.MintURL == "" || cfg.HTTP.RevokeURL == "" {
+		return nil, fmt.Errorf("credentials.http.mint_url and credentials.http.revoke_url are required")
+	}
+	return &HTTPProvider{
+		mintURL:    cfg.HTTP.MintURL,
+		revokeURL:  strings.TrimRight(cfg.HTTP.RevokeURL, "/"),
+		token:      cfg.HTTP.Token,
+		ttl:        cfg.TTL,
+		httpClient: network.Client(egress.ClientCredentials, cfg.HTTP.Timeout),
+	}, nil
+}
+
+type mintRequest struct {
+	PipelineID string `json:"pipeline_id"`
+	Repo       string `json:"repo,omitempty"`
+	Scope      string `json:"scope"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+type mintResponse struct {
+	ID        string            `json:"id"`
+	Env       map[string]string `json:"env"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Mint requests a credential scoped to the run.
+func (p *HTTPProvider) Mint(ctx context.Context, run *pipeline.Run) (*Credential, error) {
+	body, err := json.Marshal(mintRequest{
+		PipelineID: run.ID,
+		Repo:       run.Spec.Repo,
+		Scope:      run.Spec.Credential.Scope,
+		TTLSeconds: int64(p.ttl.Seconds()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.do(ctx, http.MethodPost, p.mintURL, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mint credential: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to mint credential: broker returned %s", resp.Status)
+	}
+
+	var out mintResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode minted credential: %w", err)
+	}
+	if out.ID == "" || len(out.Env) == 0 {
+		return nil, fmt.Errorf("broker returned an empty credential")
+	}
+	return &Credential{ID: out.ID, Env: out.Env, ExpiresAt: out.ExpiresAt}, nil
+}
+
+// Revoke invalidates the credential. Revoking an already expired or unknown
+// credential is not an error.
+func (p *HTTPProvider) Revoke(ctx context.Context, cred *Credential) error {
+	resp, err := p.do(ctx, http.MethodDelete, p.revokeURL+"/"+url.PathEscape(cred.ID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to revoke credential %s: %w", cred.ID, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound, http.StatusGone:
+		return nil
+	default:
+		return fmt.Errorf("failed to revoke credential %s: broker returned %s", cred.ID, resp.Status)
+	}
+}
+
+func (p *HTTPProvider) do(ctx context.Context, method, target string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	return p.httpClient.Do(req)
+}
@@ -0,0 +1,140 @@
+// Package database opens the SQL database pipeline runs are kept in:
+// PostgreSQL, or SQLite for a single replica and local development.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	// Registers the "postgres" driver.
+	_ "github.com/lib/pq"
+	// Registers the "sqlite" driver.
+	_ "modernc.org/sqlite"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// The database types of database.type.
+const (
+	Postgres = "postgresql"
+	SQLite   = "sqlite"
+)
+
+// sqliteTime is how SQLite stores timestamps: fixed width UTC text, so they
+// order as strings the way they do as times.
+const sqliteTime = "2006-01-02T15:04:05.000000000Z"
+
+// DB is an open database and the dialect its statements are written in.
+// Statements use ? placeholders, which Rebind turns into PostgreSQL's.
+type DB struct {
+	*sql.DB
+	Type string
+}
+
+// Open opens the database cfg describes. It does not connect; Ping does.
+func Open(cfg config.DatabaseConfig) (*DB, error) {
+	typ := cfg.Type
+	if typ == "" {
+		typ = Postgres
+	}
+	switch typ {
+	case Postgres:
+		db, err := sql.Open("postgres", postgresURL(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open postgresql database: %w", err)
+		}
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+		if cfg.MaxIdleConns > 0 {
+			db.SetMaxIdleConns(cfg.MaxIdleConns)
+		}
+		db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		return &DB{DB: db, Type: typ}, nil
+	case SQLite:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("database.path is required for sqlite")
+		}
+		db, err := sql.Open("sqlite", cfg.Path+"?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sqlite database %s: %w", cfg.Path, err)
+		}
+		// SQLite serializes writers anyway, and every connection to
+		// ":memory:" would be a database of its own, so the one connection
+		// is also never closed for its age.
+		db.SetMaxOpenConns(1)
+		return &DB{DB: db, Type: typ}, nil
+	default:
+		return nil, fmt.Errorf("unknown database type %q", cfg.Type)
+	}
+}
+
+func postgresURL(cfg config.DatabaseConfig) string {
+	host := cfg.Host
+	if cfg.Port != 0 {
+		host = net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	}
+	u := url.URL{Scheme: "postgres", Host: host, Path: "/" + cfg.Name}
+	if cfg.User != "" {
+		u.User = url.UserPassword(cfg.User, cfg.Password)
+	}
+	if cfg.SSLMode != "" {
+		u.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+	}
+	return u.String()
+}
+
+// ReportStats samples the connection pool into the database connection
+// gauges every interval until ctx is done.
+func (db *DB) ReportStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		db.recordStats()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (db *DB) recordStats() {
+	st := db.Stats()
+	metrics.DatabaseConnectionsInUse.Set(float64(st.InUse))
+	metrics.DatabaseConnectionsIdle.Set(float64(st.Idle))
+}
+
+// Rebind rewrites the ? placeholders of query for the database.
+func (db *DB) Rebind(query string) string {
+	if db.Type != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Time is the argument t is bound as. The zero time is NULL.
+func (db *DB) Time(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	if db.Type == SQLite {
+		return t.UTC().Format(sqliteTime)
+	}
+	return t.UTC()
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+func TestOpenAppliesPoolSettings(t *testing.T) {
+	// Opening does not connect, so no server is needed.
+	db, err := Open(config.DatabaseConfig{Host: "localhost", Port: 5432, Name: "pipeline_engine", MaxOpenConns: 25, MaxIdleConns: 5, ConnMaxLifetime: 30 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if db.Type != Postgres || db.Stats().MaxOpenConnections != 25 {
+		t.Errorf("Open() = %s with %d max open connections, want postgresql with 25", db.Type, db.Stats().MaxOpenConnections)
+	}
+
+	lite, err := Open(config.DatabaseConfig{Type: SQLite, Path: ":memory:", MaxOpenConns: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lite.Close()
+	if n := lite.Stats().MaxOpenConnections; n != 1 {
+		t.Errorf("sqlite max open connections = %d, want 1", n)
+	}
+}
+
+func TestRecordStatsSamplesThePool(t *testing.T) {
+	db := openTestDB(t)
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.recordStats()
+	if got := testutil.ToFloat64(metrics.DatabaseConnectionsInUse); got != 1 {
+		t.Errorf("in use = %v, want 1", got)
+	}
+	conn.Close()
+	db.recordStats()
+	if in, idle := testutil.ToFloat64(metrics.DatabaseConnectionsInUse), testutil.ToFloat64(metrics.DatabaseConnectionsIdle); in != 0 || idle != 1 {
+		t.Errorf("after release: in use = %v, idle = %v; want 0 and 1", in, idle)
+	}
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLock is the PostgreSQL advisory lock a migration holds, so
+// replicas starting together apply each version once.
+const migrationLock = 4_172_653_262
+
+// Migration is one version of the schema: migrations/<type>/NNNN_name.up.sql
+// and its .down.sql.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is a migration and whether it is applied.
+type MigrationStatus struct {
+	Migration
+	// AppliedAt is when the migration was applied; zero while pending.
+	AppliedAt time.Time
+}
+
+// Migrations returns the migrations of the database's type, oldest first.
+func (db *DB) Migrations() ([]Migration, error) {
+	dir := path.Join("migrations", db.Type)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %w", db.Type, err)
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		num, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 || direction != "up" && direction != "down" {
+			return nil, fmt.Errorf("malformed migration file name %s", e.Name())
+		}
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// MigrateUp applies the pending migrations in order, each in a transaction
+// of its own, and returns those it applied. It stops at the first that
+// fails, whose changes are rolled back.
+func (db *DB) MigrateUp(ctx context.Context) ([]Migration, error) {
+	ms, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return db.migrateUp(ctx, ms)
+}
+
+func (db *DB) migrateUp(ctx context.Context, ms []Migration) ([]Migration, error) {
+	var applied []Migration
+	for _, m := range ms {
+		ran := false
+		err := db.migrate(ctx, func(tx *sql.Tx) error {
+			var n int
+			if err := tx.QueryRowContext(ctx, db.Rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), m.Version).Scan(&n); err != nil || n > 0 {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, m.up); err != nil {
+				return err
+			}
+			ran = true
+			_, err := tx.ExecContext(ctx, db.Rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+				m.Version, m.Name, db.Time(time.Now()))
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Name, err)
+		}
+		if ran {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the latest applied migration and returns it, or nil
+// when none is applied.
+func (db *DB) MigrateDown(ctx context.Context) (*Migration, error) {
+	ms, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return db.migrateDown(ctx, ms)
+}
+
+func (db *DB) migrateDown(ctx context.Context, ms []Migration) (*Migration, error) {
+	var reverted *Migration
+	err := db.migrate(ctx, func(tx *sql.Tx) error {
+		var version sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil || !version.Valid {
+			return err
+		}
+		for i := range ms {
+			if ms[i].Version == int(version.Int64) {
+				reverted = &ms[i]
+			}
+		}
+		if reverted == nil {
+			return fmt.Errorf("the database is at version %d, which this engine has no migration for", version.Int64)
+		}
+		if _, err := tx.ExecContext(ctx, reverted.down); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, db.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), reverted.Version)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revert migration: %w", err)
+	}
+	return reverted, nil
+}
+
+// Status returns every migration with when it was applied.
+func (db *DB) Status(ctx context.Context) ([]MigrationStatus, error) {
+	ms, err := db.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var out []MigrationStatus
+	err = db.migrate(ctx, func(tx *sql.Tx) error {
+		applied, err := appliedAt(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			out = append(out, MigrationStatus{Migration: m, AppliedAt: applied[m.Version]})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration status: %w", err)
+	}
+	return out, nil
+}
+
+// CheckSchema fails unless every migration is applied, for servers that
+// leave migrating to the migrate command.
+func (db *DB) CheckSchema(ctx context.Context) error {
+	status, err := db.Status(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range status {
+		if s.AppliedAt.IsZero() {
+			pending = append(pending, fmt.Sprintf("%d (%s)", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database migrations %s are pending: run pipeline-engine migrate up, or set database.auto_migrate", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// migrate runs fn in a transaction holding the migration lock, with the
+// schema_migrations table created.
+func (db *DB) migrate(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	table := `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL)`
+	if db.Type == Postgres {
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+			return err
+		}
+		table = `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL)`
+	}
+	if _, err := tx.ExecContext(ctx, table); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func appliedAt(ctx context.Context, tx *sql.Tx) (map[int]time.Time, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			return nil, fmt.Errorf("migration %d has a malformed applied_at %q", version, at)
+		}
+		out[version] = t
+	}
+	return out, rows.Err()
+}
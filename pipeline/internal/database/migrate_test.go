@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := Open(config.DatabaseConfig{Type: SQLite, Path: filepath.Join(t.TempDir(), "pipeline.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	ms, err := db.Migrations()
+	if err != nil || len(ms) == 0 {
+		t.Fatalf("Migrations() = %v, %v", ms, err)
+	}
+
+	if err := db.CheckSchema(ctx); err == nil || !strings.Contains(err.Error(), "migrate up") {
+		t.Errorf("CheckSchema() on an empty database = %v, want the pending migrations", err)
+	}
+	applied, err := db.MigrateUp(ctx)
+	if err != nil || len(applied) != len(ms) {
+		t.Fatalf("MigrateUp() = %d migrations, %v; want %d", len(applied), err, len(ms))
+	}
+	if applied, err := db.MigrateUp(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second MigrateUp() = %d migrations, %v; want none", len(applied), err)
+	}
+	if err := db.CheckSchema(ctx); err != nil {
+		t.Errorf("CheckSchema() after migrating = %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT id FROM pipelines`); err != nil {
+		t.Errorf("pipelines table missing after migrating: %v", err)
+	}
+
+	last := ms[len(ms)-1]
+	reverted, err := db.MigrateDown(ctx)
+	if err != nil || reverted == nil || reverted.Version != last.Version {
+		t.Fatalf("MigrateDown() = %v, %v; want version %d", reverted, err, last.Version)
+	}
+	status, err := db.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := status[len(status)-1]; !s.AppliedAt.IsZero() {
+		t.Errorf("status of the reverted migration = %+v, want pending", s)
+	}
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	ms := []Migration{
+		{Version: 1, Name: "widgets", up: `CREATE TABLE widgets (id TEXT)`, down: `DROP TABLE widgets`},
+		{Version: 2, Name: "broken", up: `CREATE TABLE gadgets (id TEXT); INSERT INTO nowhere VALUES (1)`, down: `DROP TABLE gadgets`},
+	}
+
+	applied, err := db.migrateUp(ctx, ms)
+	if err == nil || len(applied) != 1 {
+		t.Fatalf("migrateUp() = %d migrations, %v; want the first applied and an error", len(applied), err)
+	}
+	if _, err := db.ExecContext(ctx, `SELECT id FROM gadgets`); err == nil {
+		t.Error("the failed migration's first statement was kept")
+	}
+	var version int
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil || version != 1 {
+		t.Errorf("recorded version = %d, %v; want 1", version, err)
+	}
+}
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS pipelines (
+    id           TEXT PRIMARY KEY,
+    name         TEXT NOT NULL,
+    repo         TEXT NOT NULL,
+    branch       TEXT NOT NULL,
+    commit_sha   TEXT NOT NULL,
+    triggered_by TEXT NOT NULL,
+    status       TEXT NOT NULL,
+    created_at   TEXT NOT NULL,
+    started_at   TEXT,
+    finished_at  TEXT,
+    run          TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS pipelines_created_at ON pipelines (created_at DESC, id);
+CREATE INDEX IF NOT EXISTS pipelines_repo_branch ON pipelines (repo, branch, created_at DESC);
+CREATE INDEX IF NOT EXISTS pipelines_status ON pipelines (status);
@@ -0,0 +1,13 @@
+CREATE TABLE ai_exchanges (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id    TEXT NOT NULL,
+    endpoint  TEXT NOT NULL,
+    request   TEXT NOT NULL,
+    response  TEXT NOT NULL,
+    error     TEXT NOT NULL,
+    truncated BOOLEAN NOT NULL,
+    at        TEXT NOT NULL
+);
+
+CREATE INDEX ai_exchanges_run_id ON ai_exchanges (run_id, id);
+CREATE INDEX ai_exchanges_at ON ai_exchanges (at);
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// DefaultMaxChainDepth is the chain depth used when Options.MaxChainDepth is
+// zero.
+const DefaultMaxChainDepth = 5
+
+// Outcomes of a downstream trigger, as counted by metrics.ChainTriggers.
+const (
+	chainSubmitted = "submitted"
+	chainRejected  = "rejected"
+	chainLoop      = "loop"
+	chainTooDeep   = "too_deep"
+)
+
+// triggerDownstream submits the downstream pipelines of a run that has
+// executed, according to the outcome recorded for it. Triggers that would
+// exceed the chain depth or run a pipeline of the chain again are refused,
+// and submissions may be rejected; each such failure is logged and recorded
+// among the upstream run's warnings, whose outcome stands.
+func (e *Engine) triggerDownstream(id string) {
+	ctx := e.ctx
+	run, err := e.store.GetRun(ctx, id)
+	if err != nil {
+		e.logger.WithError(err).WithField("pipeline_id", id).Error("Failed to read run to trigger downstream pipelines")
+		return
+	}
+	triggers := run.Spec.Triggers(run.Status)
+	if len(triggers) == 0 {
+		return
+	}
+
+	depth, chain := 1, []string{run.Spec.Name}
+	if run.Upstream != nil {
+		depth, chain = run.Upstream.Depth+1, append(slices.Clone(run.Upstream.Chain), run.Spec.Name)
+	}
+	if run.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, run.RequestID)
+	}
+	for _, t := range triggers {
+		log := logging.FromContext(ctx, e.logger).WithFields(logrus.Fields{
+			"pipeline_id": run.ID,
+			"downstream":  t.Pipeline.Name,
+			"depth":       depth,
+		})
+		switch {
+		case depth > e.maxChainDepth:
+			e.refuseTrigger(ctx, run, log, chainTooDeep, fmt.Sprintf("downstream pipeline %q not triggered: it would be %d runs deep, past pipeline.max_chain_depth (%d)", t.Pipeline.Name, depth, e.maxChainDepth))
+			continue
+		case slices.Contains(chain, t.Pipeline.Name):
+			e.refuseTrigger(ctx, run, log, chainLoop, fmt.Sprintf("downstream pipeline %q not triggered: it already ran in this chain (%s)", t.Pipeline.Name, strings.Join(chain, " -> ")))
+			continue
+		}
+
+		spec, err := json.Marshal(t.Pipeline)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode downstream pipeline")
+			continue
+		}
+		downstream, err := e.Submit(ctx, SubmitRequest{
+			Spec:        spec,
+			Params:      t.ExpandParams(run),
+			TriggeredBy: "pipeline:" + run.Spec.Name,
+			Upstream:    &pipeline.Upstream{RunID: run.ID, Pipeline: run.Spec.Name, Depth: depth, Chain: chain},
+		})
+		if err != nil {
+			e.refuseTrigger(ctx, run, log, chainRejected, fmt.Sprintf("downstream pipeline %q rejected: %v", t.Pipeline.Name, err))
+			continue
+		}
+		metrics.ChainTriggers.WithLabelValues(chainSubmitted).Inc()
+		log.WithField("downstream_id", downstream.ID).Info("Triggered downstream pipeline")
+	}
+}
+
+// refuseTrigger logs why a downstream trigger of run failed, records it
+// among the run's warnings and counts it as result.
+func (e *Engine) refuseTrigger(ctx context.Context, run *pipeline.Run, log *logrus.Entry, result, reason string) {
+	log.WithField("reason", reason).Warn("Downstream pipeline not triggered")
+	if err := e.Warn(ctx, run.ID, reason); err != nil {
+		log.WithError(err).Error("Failed to record run warnings")
+	}
+	metrics.ChainTriggers.WithLabelValues(result).Inc()
+}
@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const chainSpec = `
+name: build
+commit: abc123
+stages:
+- name: compile
+  image: golang:1.22
+on_success:
+  trigger:
+  - params: {upstream: "$(run.name)@$(run.commit)"}
+    pipeline:
+      name: integration
+      stages:
+      - name: test
+        image: golang:1.22
+      on_success:
+        trigger:
+        - pipeline:
+            name: build
+            stages:
+            - name: compile
+              image: golang:1.22
+`
+
+// waitForTriggers waits until the chain trigger counter of result has grown
+// by n from before.
+func waitForTriggers(t *testing.T, result string, before float64, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(metrics.ChainTriggers.WithLabelValues(result)) < before+float64(n) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no %s chain trigger recorded", result)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSuccessTriggersDownstreamPipelineOnce(t *testing.T) {
+	submitted := testutil.ToFloat64(metrics.ChainTriggers.WithLabelValues(chainSubmitted))
+	loops := testutil.ToFloat64(metrics.ChainTriggers.WithLabelValues(chainLoop))
+
+	e, runs := newTestEngine(&paramsRunner{params: make(chan map[string]string, 10)})
+	defer e.Close()
+	upstream, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(chainSpec)})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	// build triggers integration, whose trigger of build again closes a loop.
+	waitForTriggers(t, chainSubmitted, submitted, 1)
+	waitForTriggers(t, chainLoop, loops, 1)
+
+	all, err := runs.ListRuns(context.Background(), store.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var downstream *pipeline.Run
+	for _, r := range all {
+		if r.Spec.Name == "integration" {
+			downstream = r
+		}
+	}
+	if len(all) != 2 || downstream == nil {
+		t.Fatalf("recorded %d runs, want build and integration", len(all))
+	}
+	want := pipeline.Upstream{RunID: upstream.ID, Pipeline: "build", Chain: []string{"build"}}
+	if up := downstream.Upstream; up == nil || up.RunID != want.RunID || up.Pipeline != want.Pipeline || len(up.Chain) != 1 {
+		t.Errorf("downstream upstream = %+v, want %+v", downstream.Upstream, want)
+	}
+	if got := downstream.Spec.Params["upstream"]; got != "build@abc123" {
+		t.Errorf("downstream param upstream = %q, want build@abc123", got)
+	}
+	if downstream.TriggeredBy != "pipeline:build" {
+		t.Errorf("downstream TriggeredBy = %q", downstream.TriggeredBy)
+	}
+}
+
+func TestChainStopsAtMaxDepth(t *testing.T) {
+	tooDeep := testutil.ToFloat64(metrics.ChainTriggers.WithLabelValues(chainTooDeep))
+
+	e, runs := newTestEngine(&paramsRunner{params: make(chan map[string]string, 10)})
+	e.maxChainDepth = 1
+	defer e.Close()
+	spec := `
+name: a
+stages: [{name: s, image: alpine:3}]
+on_success:
+  trigger:
+  - pipeline:
+      name: b
+      stages: [{name: s, image: alpine:3}]
+      on_success:
+        trigger:
+        - pipeline: {name: c, stages: [{name: s, image: alpine:3}]}
+`
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(spec)}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	waitForTriggers(t, chainTooDeep, tooDeep, 1)
+	all, _ := runs.ListRuns(context.Background(), store.ListOptions{})
+	if len(all) != 2 {
+		t.Fatalf("recorded %d runs, want a and b only", len(all))
+	}
+	for _, r := range all {
+		if r.Spec.Name != "b" {
+			continue
+		}
+		if r.Upstream == nil || r.Upstream.Depth != 1 {
+			t.Errorf("b upstream = %+v, want depth 1", r.Upstream)
+		}
+		want := `downstream pipeline "c" not triggered: it would be 2 runs deep, past pipeline.max_chain_depth (1)`
+		if len(r.Warnings) != 1 || r.Warnings[0] != want {
+			t.Errorf("b warnings = %q, want %q", r.Warnings, want)
+		}
+	}
+}
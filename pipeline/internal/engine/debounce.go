@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// TooSoonError is returned by Submit when the same pipeline was admitted for
+// the same repo and commit less than the minimum resubmit interval ago.
+type TooSoonError struct {
+	Pipeline string
+	Repo     string
+	Commit   string
+	// RetryAfter is how long until a resubmission will be accepted.
+	RetryAfter time.Duration
+	Interval   time.Duration
+}
+
+func (e *TooSoonError) Error() string {
+	return fmt.Sprintf("pipeline %s was already submitted for %s@%s within the last %s; resubmit in %s",
+		e.Pipeline, e.Repo, e.Commit, e.Interval, e.RetryAfter.Round(time.Second))
+}
+
+// debouncer enforces a minimum interval between admitted attempts of a
+// pipeline at one commit, so a flapping trigger cannot retry it in a tight
+// loop. Attempts are tracked by this replica only.
+type debouncer struct {
+	interval time.Duration
+	clock    clock.Clock
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	pruneAt int
+}
+
+func newDebouncer(interval time.Duration, clk clock.Clock) *debouncer {
+	if interval <= 0 {
+		return nil
+	}
+	return &debouncer{interval: interval, clock: clk, last: make(map[string]time.Time), pruneAt: 1024}
+}
+
+// admit records an attempt for spec unless the previous one is too recent.
+// Specs without a commit do not identify a retry and are always admitted.
+func (d *debouncer) admit(spec *pipeline.Spec) error {
+	if d == nil || spec.Commit == "" {
+		return nil
+	}
+	key := spec.Repo + "\x00" + spec.Commit + "\x00" + spec.Name
+	now := d.clock.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if last, ok := d.last[key]; ok {
+		if wait := d.interval - now.Sub(last); wait > 0 {
+			return &TooSoonError{Pipeline: spec.Name, Repo: spec.Repo, Commit: spec.Commit, RetryAfter: wait, Interval: d.interval}
+		}
+	}
+	d.last[key] = now
+
+	if len(d.last) >= d.pruneAt {
+		for k, t := range d.last {
+			if now.Sub(t) >= d.interval {
+				delete(d.last, k)
+			}
+		}
+		d.pruneAt = 2 * len(d.last)
+		if d.pruneAt < 1024 {
+			d.pruneAt = 1024
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/lock"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+// RunLocker hands out the distributed locks that keep two replicas from
+// starting the same run, as when both receive one webhook. It is satisfied
+// by *lock.Locker.
+type RunLocker interface {
+	Acquire(ctx context.Context, name string) (*lock.Lease, error)
+}
+
+// DuplicateRunError is returned by Submit when the pipeline is already
+// queued or executing for the same repo and commit, on this replica or
+// another.
+type DuplicateRunError struct {
+	Pipeline string
+	Repo     string
+	Commit   string
+}
+
+func (e *DuplicateRunError) Error() string {
+	return fmt.Sprintf("pipeline %s is already running for %s@%s", e.Pipeline, e.Repo, e.Commit)
+}
+
+// lockRun takes the lock of spec's pipeline at its repo and commit, held
+// until the run finishes. Specs without a commit are not deduplicated, and
+// neither is anything while Redis cannot be reached: a possible duplicate
+// is better than refusing every submission.
+func (e *Engine) lockRun(ctx context.Context, spec *pipeline.Spec) (*lock.Lease, error) {
+	if e.locker == nil || spec.Commit == "" {
+		return nil, nil
+	}
+	lease, err := e.locker.Acquire(ctx, "run:"+spec.Repo+"@"+spec.Commit+":"+spec.Name)
+	switch {
+	case errors.Is(err, lock.ErrNotAcquired):
+		return nil, &DuplicateRunError{Pipeline: spec.Name, Repo: spec.Repo, Commit: spec.Commit}
+	case err != nil:
+		logging.FromContext(ctx, e.logger).WithError(err).WithFields(logrus.Fields{
+			"pipeline": spec.Name,
+			"repo":     spec.Repo,
+			"commit":   spec.Commit,
+		}).Warn("Failed to lock pipeline run, admitting it without deduplication")
+		return nil, nil
+	}
+	return lease, nil
+}
+
+// unlockRun releases the lock taken by lockRun, if any.
+func (e *Engine) unlockRun(lease *lock.Lease) {
+	if lease == nil {
+		return
+	}
+	if err := lease.Release(context.WithoutCancel(e.ctx)); err != nil {
+		e.logger.WithError(err).Warn("Failed to release pipeline run lock")
+	}
+}
+
+// watchLease cancels the run once its lock is lost. Its fence already keeps
+// the executor from recording anything by then; cancelling stops its
+// TaskRuns too, as the run now belongs to whoever holds the lock.
+func (e *Engine) watchLease(ctx context.Context, id string, lease *lock.Lease, cancel context.CancelFunc) {
+	defer e.wg.Done()
+	select {
+	case <-lease.Lost():
+		e.logger.WithField("pipeline_id", id).Warn("Lost the pipeline run lock, cancelling the run")
+		cancel()
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/lock"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestLockerDeduplicatesRunsAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := store.NewMemory()
+	runner := &stubbornRunner{started: make(chan string, 2), release: make(chan struct{})}
+	replica := func() *Engine {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		locker, err := lock.New(client, config.RedisConfig{}, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := New(Options{
+			Executor: executor.New(executor.Options{Runner: runner, Recorder: runs, Logger: logger}),
+			Store:    runs,
+			Logger:   logger,
+			Locker:   locker,
+		})
+		t.Cleanup(e.Close)
+		return e
+	}
+	a, b := replica(), replica()
+
+	spec := []byte("name: build\nrepo: github.com/org/app\ncommit: abc123\nstages:\n- name: compile\n  image: ghcr.io/org/go:1.21\n")
+	run, err := a.Submit(context.Background(), SubmitRequest{Spec: spec})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-runner.started
+
+	_, err = b.Submit(context.Background(), SubmitRequest{Spec: spec})
+	var dup *DuplicateRunError
+	if !errors.As(err, &dup) || dup.Commit != "abc123" {
+		t.Fatalf("duplicate Submit() error = %v, want DuplicateRunError", err)
+	}
+
+	close(runner.release)
+	deadline := time.Now().Add(5 * time.Second)
+	for mr.Exists("devmind:lock:run:github.com/org/app@abc123:build") {
+		if time.Now().After(deadline) {
+			t.Fatal("lock not released once the run finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, _ := runs.GetRun(context.Background(), run.ID); !got.Status.Terminal() {
+		t.Errorf("lock released while the run is %s", got.Status)
+	}
+	if _, err := b.Submit(context.Background(), SubmitRequest{Spec: spec}); err != nil {
+		t.Fatalf("Submit() after the run finished error = %v", err)
+	}
+}
+
+// lockedEngine returns an engine deduplicating runs with a lock in mr, and
+// its run store.
+func lockedEngine(t *testing.T, mr *miniredis.Miniredis, r executor.Runner, cfg config.RedisConfig) (*Engine, *countingStore) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	locker, err := lock.New(client, cfg, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := &countingStore{Memory: store.NewMemory()}
+	e := New(Options{
+		Executor: executor.New(executor.Options{Runner: r, Recorder: runs, Logger: logger}),
+		Store:    runs,
+		Logger:   logger,
+		Locker:   locker,
+	})
+	t.Cleanup(e.Close)
+	return e, runs
+}
+
+// takeOver hands the lock of the build pipeline at abc123 to another
+// holder, as when this replica paused past the lock TTL.
+func takeOver(t *testing.T, mr *miniredis.Miniredis) {
+	t.Helper()
+	mr.Del("devmind:lock:run:github.com/org/app@abc123:build")
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	locker, err := lock.New(client, config.RedisConfig{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locker.Acquire(context.Background(), "run:github.com/org/app@abc123:build"); err != nil {
+		t.Fatalf("Acquire() by the new holder error = %v", err)
+	}
+}
+
+const lockedSpec = "name: build\nrepo: github.com/org/app\ncommit: abc123\nstages:\n- name: compile\n  image: ghcr.io/org/go:1.21\n"
+
+func TestSupersededLeaseStopsRecordingTheRun(t *testing.T) {
+	mr := miniredis.RunT(t)
+	runner := &stubbornRunner{started: make(chan string, 1), release: make(chan struct{})}
+	e, runs := lockedEngine(t, mr, runner, config.RedisConfig{})
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(lockedSpec)})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-runner.started
+	takeOver(t, mr)
+	runs.mu.Lock()
+	saves := runs.saves
+	runs.mu.Unlock()
+
+	close(runner.release)
+	e.Close()
+	if runs.saves != saves {
+		t.Errorf("run saved %d times after its lease was superseded", runs.saves-saves)
+	}
+	if got, _ := runs.GetRun(context.Background(), run.ID); got.Status != pipeline.StatusRunning {
+		t.Errorf("status = %s, want the last state recorded under the lease (%s)", got.Status, pipeline.StatusRunning)
+	}
+}
+
+func TestLostLeaseCancelsTheRun(t *testing.T) {
+	mr := miniredis.RunT(t)
+	runner := &blockingRunner{started: make(chan struct{}, 1)}
+	e, _ := lockedEngine(t, mr, runner, config.RedisConfig{LockTTL: time.Second, LockRefreshInterval: 20 * time.Millisecond})
+
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(lockedSpec)}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-runner.started
+	takeOver(t, mr)
+
+	// The job only returns once its context is cancelled.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		e.mu.Lock()
+		active := len(e.active)
+		e.mu.Unlock()
+		if active == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run not cancelled once its lease was lost")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// OrphanedReason is the reason of runs left behind by a replica that shut
+// down before they finished.
+const OrphanedReason = "orphaned: the replica executing this run shut down before it finished; its TaskRuns may still be running"
+
+// OrphanCancelledReason is the reason of orphaned runs cancelled by
+// ReconcileOrphans.
+const OrphanCancelledReason = "orphaned: the replica executing this run shut down before it finished, so its TaskRuns were cancelled"
+
+// OrphanLedger keeps the runs orphaned at shutdown where another replica,
+// or this one once restarted, can reconcile them. It is satisfied by
+// *store.OrphanLedger.
+type OrphanLedger interface {
+	Record(ctx context.Context, run *pipeline.Run) error
+	// Claim takes the recorded runs out of the ledger, so each is
+	// reconciled once.
+	Claim(ctx context.Context) ([]*pipeline.Run, error)
+}
+
+// TaskRunCanceller cancels the unfinished TaskRuns of a pipeline run and
+// returns how many it cancelled. It is satisfied by *tekton.Client.
+type TaskRunCanceller interface {
+	CancelTaskRuns(ctx context.Context, pipelineID string) (int, error)
+}
+
+var (
+	// ErrDraining is returned by Submit once the engine is shutting down.
+	ErrDraining = perrors.New(perrors.ErrUnavailable, "the pipeline engine is shutting down, not accepting new pipelines")
+	// ErrOrphaned fences off the executor of a run orphaned at shutdown.
+	ErrOrphaned = errors.New("run orphaned at shutdown")
+)
+
+// drainState is guarded by Engine.mu.
+type drainState struct {
+	// total counts the runs the drain waited for: those active when it
+	// started and those admitted since.
+	total int
+	// idle is closed once no run is active.
+	idle chan struct{}
+	// deadlinePassed is set once the drain gave up on the runs left.
+	deadlinePassed bool
+}
+
+// DrainResult is the outcome of Drain.
+type DrainResult struct {
+	// Drained runs finished before the deadline.
+	Drained int
+	// Orphaned runs were still queued or executing at the deadline.
+	Orphaned int
+}
+
+// Draining reports whether Drain has been called.
+func (e *Engine) Draining() bool {
+	return e.draining.Load()
+}
+
+// Drain stops admitting runs, with ErrDraining, and waits until the runs
+// queued or executing here have finished or ctx is done. Runs left then are
+// recorded as Orphaned, in the run store and the OrphanLedger, so another
+// replica can reconcile them: their executors are fenced off the run
+// record, but neither they nor their TaskRuns are cancelled. Without a
+// ledger the record is lost with this replica's run store.
+func (e *Engine) Drain(ctx context.Context) DrainResult {
+	e.mu.Lock()
+	if !e.draining.Swap(true) {
+		e.drain.total = len(e.active)
+		e.drain.idle = make(chan struct{})
+		e.idleLocked()
+	}
+	idle := e.drain.idle
+	e.mu.Unlock()
+	e.logger.Info("Draining pipelines, no longer accepting new ones")
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+
+	e.mu.Lock()
+	e.drain.deadlinePassed = true
+	left := make(map[string]activeRun, len(e.active))
+	for id, a := range e.active {
+		left[id] = a
+	}
+	total := e.drain.total
+	e.mu.Unlock()
+
+	// Fence every executor before recording any run, so one still saving
+	// its progress stops before the orphaned state is written.
+	for _, a := range left {
+		a.fence.trip(ErrOrphaned)
+	}
+	for id := range left {
+		e.recordOrphaned(id, e.logger.WithField("pipeline_id", id))
+	}
+	return DrainResult{Drained: total - len(left), Orphaned: len(left)}
+}
+
+// idleLocked closes the drain's idle channel once no run is active.
+func (e *Engine) idleLocked() {
+	if e.drain.idle != nil && len(e.active) == 0 {
+		select {
+		case <-e.drain.idle:
+		default:
+			close(e.drain.idle)
+		}
+	}
+}
+
+// trackDrainedLocked counts a run admitted while draining.
+func (e *Engine) trackDrainedLocked() {
+	if e.draining.Load() {
+		e.drain.total++
+	}
+}
+
+// recordOrphaned marks the last recorded state of the run as orphaned,
+// unless it had already finished. Its stages are left as they were, since
+// their TaskRuns keep going.
+func (e *Engine) recordOrphaned(id string, log *logrus.Entry) {
+	ctx := context.WithoutCancel(e.ctx)
+	run, err := e.store.GetRun(ctx, id)
+	if err != nil {
+		log.WithError(err).Error("Failed to read run to record it as orphaned")
+		return
+	}
+	if run.Status.Terminal() {
+		return
+	}
+	run.Status = pipeline.StatusOrphaned
+	run.Reason = OrphanedReason
+	if err := e.store.SaveRun(ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record run")
+		return
+	}
+	metrics.RunsOrphaned.Inc()
+	if e.orphans != nil {
+		if err := e.orphans.Record(ctx, run); err != nil {
+			log.WithError(err).Error("Failed to record orphaned run for reconciliation")
+		}
+	}
+	log.Warn("Recorded pipeline as orphaned at shutdown")
+}
+
+// ReconcileOrphans cancels the runs of the OrphanLedger. Nothing follows
+// their TaskRuns any more, so those still running are cancelled first; the
+// run is then recorded as Cancelled with OrphanCancelledReason. Runs whose
+// TaskRuns could not be cancelled, or that could not be recorded, go back
+// to the ledger for the next reconciliation. It returns how many runs it
+// cancelled.
+func (e *Engine) ReconcileOrphans(ctx context.Context) (int, error) {
+	if e.orphans == nil || e.taskRuns == nil {
+		return 0, nil
+	}
+	runs, err := e.orphans.Claim(ctx)
+	cancelled := 0
+	for _, run := range runs {
+		log := e.logger.WithField("pipeline_id", run.ID)
+		if !e.reconcileOrphan(ctx, run, log) {
+			if err := e.orphans.Record(ctx, run); err != nil {
+				log.WithError(err).Error("Failed to record orphaned run for reconciliation")
+			}
+			continue
+		}
+		cancelled++
+	}
+	return cancelled, err
+}
+
+// reconcileOrphan cancels the TaskRuns of run and records it as cancelled,
+// reporting whether both succeeded.
+func (e *Engine) reconcileOrphan(ctx context.Context, run *pipeline.Run, log *logrus.Entry) bool {
+	n, err := e.taskRuns.CancelTaskRuns(ctx, run.ID)
+	if err != nil {
+		log.WithError(err).Error("Failed to cancel the TaskRuns of an orphaned run")
+		return false
+	}
+	now := e.clock.Now().UTC()
+	run.Status = pipeline.StatusCancelled
+	run.Reason = OrphanCancelledReason
+	run.FinishedAt = &now
+	finishStages(run, now, pipeline.StatusCancelled, OrphanCancelledReason)
+	if err := e.store.SaveRun(ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record orphaned run as cancelled")
+		return false
+	}
+	log.WithField("taskruns_cancelled", n).Warn("Cancelled pipeline orphaned by a replica that shut down")
+	return true
+}
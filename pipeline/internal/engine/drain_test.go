@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestDrainWaitsForRunsInFlight(t *testing.T) {
+	runner := &stubbornRunner{started: make(chan string, 1), release: make(chan struct{})}
+	e, runs := newTestEngine(runner)
+	defer e.Close()
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-runner.started
+
+	done := make(chan DrainResult, 1)
+	go func() { done <- e.Drain(context.Background()) }()
+	for !e.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}}); !errors.Is(err, ErrDraining) {
+		t.Fatalf("Submit() while draining error = %v, want ErrDraining", err)
+	}
+	close(runner.release)
+
+	select {
+	case res := <-done:
+		if res != (DrainResult{Drained: 1}) {
+			t.Errorf("Drain() = %+v, want 1 drained", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain() did not return once the run finished")
+	}
+	got, err := runs.GetRun(context.Background(), run.ID)
+	if err != nil {
+		t.Fatalf("GetRun() error = %v", err)
+	}
+	if got.Status != pipeline.StatusSucceeded {
+		t.Errorf("status = %s, want %s", got.Status, pipeline.StatusSucceeded)
+	}
+}
+
+func TestDrainRecordsStragglersAsOrphaned(t *testing.T) {
+	runner := &stubbornRunner{started: make(chan string, 1), release: make(chan struct{})}
+	e, runs := newTestEngine(runner)
+	e.slots = newSlots(1, SchedulingFIFO, "")
+	defer e.Close()
+
+	submit := func() *pipeline.Run {
+		run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		return run
+	}
+	running := submit()
+	<-runner.started
+	queued := submit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if res := e.Drain(ctx); res != (DrainResult{Orphaned: 2}) {
+		t.Errorf("Drain() = %+v, want 2 orphaned", res)
+	}
+
+	// The executor winding down afterwards must not overwrite the record.
+	close(runner.release)
+	e.Close()
+	for _, id := range []string{running.ID, queued.ID} {
+		got, err := runs.GetRun(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetRun() error = %v", err)
+		}
+		if got.Status != pipeline.StatusOrphaned || got.Reason != OrphanedReason {
+			t.Errorf("run %s: status = %s (%q), want %s", id, got.Status, got.Reason, pipeline.StatusOrphaned)
+		}
+	}
+}
+
+// memoryLedger is an OrphanLedger shared by the engines of a test.
+type memoryLedger struct {
+	mu   sync.Mutex
+	runs map[string]*pipeline.Run
+}
+
+func (l *memoryLedger) Record(_ context.Context, run *pipeline.Run) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.runs == nil {
+		l.runs = map[string]*pipeline.Run{}
+	}
+	l.runs[run.ID] = run
+	return nil
+}
+
+func (l *memoryLedger) Claim(context.Context) ([]*pipeline.Run, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var runs []*pipeline.Run
+	for _, run := range l.runs {
+		runs = append(runs, run)
+	}
+	l.runs = nil
+	return runs, nil
+}
+
+// fakeTaskRuns records the pipelines whose TaskRuns were cancelled, or
+// fails with err.
+type fakeTaskRuns struct {
+	cancelled []string
+	err       error
+}
+
+func (f *fakeTaskRuns) CancelTaskRuns(_ context.Context, id string) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.cancelled = append(f.cancelled, id)
+	return 1, nil
+}
+
+// orphanRun drains an engine recording to ledger with one run executing,
+// and returns that run.
+func orphanRun(t *testing.T, ledger OrphanLedger) *pipeline.Run {
+	t.Helper()
+	runner := &stubbornRunner{started: make(chan string, 1), release: make(chan struct{})}
+	e, _ := newTestEngine(runner)
+	e.orphans = ledger
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-runner.started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if res := e.Drain(ctx); res != (DrainResult{Orphaned: 1}) {
+		t.Fatalf("Drain() = %+v, want 1 orphaned", res)
+	}
+	close(runner.release)
+	e.Close()
+	return run
+}
+
+func TestReconcileOrphansCancelsRunsOfAnotherReplica(t *testing.T) {
+	ledger := &memoryLedger{}
+	run := orphanRun(t, ledger)
+
+	taskRuns := &fakeTaskRuns{}
+	e, runs := newTestEngine(&stubbornRunner{})
+	e.orphans, e.taskRuns = ledger, taskRuns
+	defer e.Close()
+	n, err := e.ReconcileOrphans(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("ReconcileOrphans() = %d, %v; want 1", n, err)
+	}
+	if len(taskRuns.cancelled) != 1 || taskRuns.cancelled[0] != run.ID {
+		t.Errorf("TaskRuns cancelled for %v, want %s", taskRuns.cancelled, run.ID)
+	}
+	got, err := runs.GetRun(context.Background(), run.ID)
+	if err != nil {
+		t.Fatalf("GetRun() error = %v", err)
+	}
+	if got.Status != pipeline.StatusCancelled || got.Reason != OrphanCancelledReason || got.FinishedAt == nil {
+		t.Errorf("status = %s (%q), want %s", got.Status, got.Reason, pipeline.StatusCancelled)
+	}
+	if job := got.Stages[0].Jobs[0]; job.Status != pipeline.StatusCancelled {
+		t.Errorf("job status = %s, want %s", job.Status, pipeline.StatusCancelled)
+	}
+	if n, _ := e.ReconcileOrphans(context.Background()); n != 0 {
+		t.Errorf("second ReconcileOrphans() = %d, want 0", n)
+	}
+}
+
+func TestReconcileOrphansKeepsRunsWhoseTaskRunsWereNotCancelled(t *testing.T) {
+	ledger := &memoryLedger{}
+	run := orphanRun(t, ledger)
+
+	e, runs := newTestEngine(&stubbornRunner{})
+	e.orphans, e.taskRuns = ledger, &fakeTaskRuns{err: errors.New("apiserver unavailable")}
+	defer e.Close()
+	if n, _ := e.ReconcileOrphans(context.Background()); n != 0 {
+		t.Fatalf("ReconcileOrphans() = %d, want 0", n)
+	}
+	if _, err := runs.GetRun(context.Background(), run.ID); err == nil {
+		t.Error("run recorded although its TaskRuns were not cancelled")
+	}
+	if ledger.runs[run.ID] == nil {
+		t.Error("run dropped from the ledger, want it kept for the next reconciliation")
+	}
+}
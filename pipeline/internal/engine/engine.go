@@ -0,0 +1,999 @@
+// Package engine admits pipeline submissions and drives their runs.
+//
+// Submit validates the spec and its params, records the run as queued and
+// hands it to the executor in the background. Callers observe progress
+// through the store.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/cancellation"
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/lock"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/policy"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+// ValidationError is returned by Submit when the spec or its params are
+// rejected. Issues holds every finding, warnings included.
+type ValidationError struct {
+	Issues pipeline.Issues
+}
+
+func (e *ValidationError) Error() string {
+	return e.Issues.Err().Error()
+}
+
+// Is makes a ValidationError an invalid argument.
+func (e *ValidationError) Is(target error) bool { return target == perrors.ErrInvalidArgument }
+
+// QueueStaleReason prefixes the reason of runs dropped for waiting in the
+// queue longer than the maximum queue age.
+const QueueStaleReason = "queue_stale"
+
+// HardTimeoutReason prefixes the reason of runs force-cancelled for running
+// longer than the hard timeout.
+const HardTimeoutReason = "hard_timeout"
+
+// ErrHardTimeout is the cause of the cancellation of a run that exceeded the
+// hard timeout.
+var ErrHardTimeout = errors.New("pipeline exceeded its hard timeout")
+
+// hardTimeoutGrace is how long a run that exceeded the hard timeout is given
+// to wind down after being cancelled before the engine records it as timed
+// out without waiting any longer.
+var hardTimeoutGrace = 30 * time.Second
+
+// PolicyError is returned by Submit when the admission policy denies a
+// submission. Reasons are the policy's own explanations.
+type PolicyError struct {
+	Reasons []string
+}
+
+func (e *PolicyError) Error() string {
+	return "denied by admission policy: " + strings.Join(e.Reasons, "; ")
+}
+
+// ErrPolicyUnavailable is returned by Submit when the admission policy could
+// not be evaluated and fail-open is off.
+var ErrPolicyUnavailable = perrors.New(perrors.ErrUnavailable, "admission policy unavailable")
+
+// CapacityChecker reports whether the cluster can run a spec. An error
+// wrapping pipeline.ErrInsufficientCapacity means it clearly cannot; any
+// other error means the check itself failed.
+type CapacityChecker interface {
+	CheckCapacity(ctx context.Context, spec *pipeline.Spec) error
+}
+
+// CancelRelay forwards a cancel request to whichever replica is running a
+// run and returns once that replica has acknowledged it.
+type CancelRelay interface {
+	RequestCancel(ctx context.Context, runID string) error
+}
+
+var (
+	// ErrRunFinished is matched by the RunFinishedError Cancel returns for
+	// runs that already finished.
+	ErrRunFinished = perrors.New(perrors.ErrConflict, "run already finished")
+	// ErrRunNotActive is returned by Cancel when no replica can be asked to
+	// cancel an unfinished run.
+	ErrRunNotActive = perrors.New(perrors.ErrConflict, "run is not active on this replica")
+)
+
+// RunFinishedError is returned by Cancel for a run that already finished,
+// with the status it finished in, so callers can treat cancelling it as
+// done rather than failed.
+type RunFinishedError struct {
+	Status pipeline.Status
+}
+
+func (e *RunFinishedError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrRunFinished, e.Status)
+}
+
+func (e *RunFinishedError) Unwrap() error { return ErrRunFinished }
+
+// Preflight modes.
+const (
+	PreflightOff    = "off"
+	PreflightReject = "reject"
+	PreflightQueue  = "queue"
+)
+
+// Options configures an Engine. Executor, Store and Logger are required.
+type Options struct {
+	Executor *executor.Executor
+	Store    store.Store
+	Policy   pipeline.Policy
+	Logger   *logrus.Logger
+
+	// Capacity is consulted before admitting a run according to Preflight.
+	// A nil checker disables the pre-flight check.
+	Capacity CapacityChecker
+	// Preflight is PreflightOff, PreflightReject or PreflightQueue.
+	Preflight string
+	// PreflightTimeout bounds how long a queued run waits for capacity.
+	PreflightTimeout time.Duration
+	// PreflightInterval is how often a queued run re-checks capacity.
+	PreflightInterval time.Duration
+
+	// CancelRelay reaches the other replicas when a run to cancel is not
+	// executing on this one. Nil limits Cancel to local runs.
+	CancelRelay CancelRelay
+
+	// Orphans records the runs left behind by Drain for ReconcileOrphans.
+	// Nil keeps them in Store only.
+	Orphans OrphanLedger
+	// TaskRuns cancels the TaskRuns of the runs ReconcileOrphans takes
+	// from Orphans. ReconcileOrphans does nothing without it.
+	TaskRuns TaskRunCanceller
+
+	// Admission evaluates every valid submission before it is admitted.
+	// A nil evaluator admits everything.
+	Admission policy.Evaluator
+	// AdmissionFailOpen admits submissions the policy could not evaluate
+	// instead of refusing them.
+	AdmissionFailOpen bool
+
+	// Locker deduplicates runs of a pipeline at one repo and commit across
+	// replicas. Nil leaves deduplication to MinResubmitInterval.
+	Locker RunLocker
+
+	// MinResubmitInterval is the minimum time between admitted submissions
+	// of the same pipeline for the same repo and commit. Zero disables the
+	// check.
+	MinResubmitInterval time.Duration
+
+	// QueueMaxAge drops a run that is still queued this long after it was
+	// submitted instead of starting it. Zero disables the check.
+	QueueMaxAge time.Duration
+
+	// HardTimeout force-cancels a run still executing this long after it
+	// started, whatever its stage timeouts and Tekton's, and records it as
+	// timed out with HardTimeoutReason. Zero disables the cap.
+	HardTimeout time.Duration
+
+	// Clock stamps submissions and times queue ages, hard timeouts and
+	// capacity polls. Nil uses the wall clock.
+	Clock clock.Clock
+
+	// MaxChainDepth caps how many runs deep on_success and on_failure
+	// triggers may chain. Zero uses DefaultMaxChainDepth.
+	MaxChainDepth int
+
+	// AIGates decides the AI features enabled for each admitted run, which
+	// are recorded on it. Nil records none.
+	AIGates *ai.Gates
+
+	// MaxConcurrentRuns caps how many runs execute at once here; the others
+	// stay queued until a slot frees up. Zero means no limit.
+	MaxConcurrentRuns int
+	// SchedulingMode is SchedulingFIFO or SchedulingFair and decides which
+	// queued run gets the next slot.
+	SchedulingMode string
+	// TenantLabel is the spec label naming a run's tenant for
+	// SchedulingFair and the queue wait metric. Runs without it are grouped
+	// by repo.
+	TenantLabel string
+	// PriorityLabel is the spec label naming a run's priority for the queue
+	// wait metric.
+	PriorityLabel string
+}
+
+// Engine owns the lifecycle of submitted runs.
+type Engine struct {
+	executor *executor.Executor
+	store    store.Store
+	policy   pipeline.Policy
+	logger   *logrus.Logger
+
+	capacity          CapacityChecker
+	preflight         string
+	preflightTimeout  time.Duration
+	preflightInterval time.Duration
+	relay             CancelRelay
+	orphans           OrphanLedger
+	taskRuns          TaskRunCanceller
+	admission         policy.Evaluator
+	admissionFailOpen bool
+	locker            RunLocker
+	debounce          *debouncer
+	queueMaxAge       time.Duration
+	hardTimeout       time.Duration
+	clock             clock.Clock
+	maxChainDepth     int
+	aiGates           atomic.Pointer[ai.Gates]
+	slots             *slots
+	priorityLabel     string
+
+	// pauses holds the tenants whose submissions are refused.
+	pauses tenantPauses
+	// quiet holds the runs waiting out their debounce period.
+	quiet quietPeriods
+
+	// active holds every run queued or executing here.
+	mu     sync.Mutex
+	active map[string]activeRun
+	// drain tracks a Drain in progress; draining is set once it started.
+	drain    drainState
+	draining atomic.Bool
+
+	// ctx outlives the requests that submit runs; it is cancelled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates an Engine from opts.
+func New(opts Options) *Engine {
+	ctx, cancel := context.WithCancel(context.Background())
+	clk := clock.Or(opts.Clock)
+	e := &Engine{
+		executor:          opts.Executor,
+		store:             opts.Store,
+		policy:            opts.Policy,
+		logger:            opts.Logger,
+		capacity:          opts.Capacity,
+		preflight:         opts.Preflight,
+		preflightTimeout:  opts.PreflightTimeout,
+		preflightInterval: opts.PreflightInterval,
+		relay:             opts.CancelRelay,
+		orphans:           opts.Orphans,
+		taskRuns:          opts.TaskRuns,
+		admission:         opts.Admission,
+		admissionFailOpen: opts.AdmissionFailOpen,
+		locker:            opts.Locker,
+		debounce:          newDebouncer(opts.MinResubmitInterval, clk),
+		queueMaxAge:       opts.QueueMaxAge,
+		hardTimeout:       opts.HardTimeout,
+		clock:             clk,
+		maxChainDepth:     opts.MaxChainDepth,
+		slots:             newSlots(opts.MaxConcurrentRuns, opts.SchedulingMode, opts.TenantLabel),
+		priorityLabel:     opts.PriorityLabel,
+		active:            make(map[string]activeRun),
+		ctx:               ctx,
+		cancel:            cancel,
+	}
+	e.aiGates.Store(opts.AIGates)
+	if e.capacity == nil || e.preflight == "" {
+		e.preflight = PreflightOff
+	}
+	if e.preflightInterval <= 0 {
+		e.preflightInterval = 30 * time.Second
+	}
+	if e.maxChainDepth <= 0 {
+		e.maxChainDepth = DefaultMaxChainDepth
+	}
+	return e
+}
+
+// SetMaxConcurrentRuns changes how many runs may execute at once; zero or
+// less is unlimited. Raising the limit starts queued runs at once; lowering
+// it lets the runs already executing finish.
+func (e *Engine) SetMaxConcurrentRuns(n int) {
+	e.slots.setLimit(n)
+}
+
+// Load reports how many runs hold and wait for a run slot on this replica.
+func (e *Engine) Load() Load {
+	return e.slots.load()
+}
+
+// SetAIGates replaces the AI gates applied to runs admitted from now on.
+func (e *Engine) SetAIGates(gates *ai.Gates) {
+	e.aiGates.Store(gates)
+}
+
+// SubmitRequest is a pipeline submission.
+type SubmitRequest struct {
+	// Spec is the pipeline definition as YAML or JSON.
+	Spec []byte
+	// Params override the spec's params for this run.
+	Params map[string]string
+	// Schedule is set when a schedule rather than a client submits the run.
+	Schedule *pipeline.ScheduleTrigger
+	// TriggeredBy names the user or system submitting the run. It defaults
+	// to schedule:<name> for scheduled runs.
+	TriggeredBy string
+	// Repo, Branch and Commit override those of the spec when set, for
+	// runs triggered by source control.
+	Repo   string
+	Branch string
+	Commit string
+	// Upstream links a run submitted by a downstream trigger to the run
+	// that triggered it.
+	Upstream *pipeline.Upstream
+	// RerunOf and ReusedStages are set for runs submitted by Rerun.
+	RerunOf      string
+	ReusedStages []pipeline.StageResult
+}
+
+// MaxBatchSize caps the number of items of a SubmitBatch call.
+const MaxBatchSize = 1000
+
+// ErrBatchTooLarge is returned by SubmitBatch for more than MaxBatchSize
+// items.
+var ErrBatchTooLarge = fmt.Errorf("batch exceeds %d items", MaxBatchSize)
+
+// Submit validates req and starts a run for it. Invalid specs and params are
+// reported as a *ValidationError; nothing is recorded for them.
+func (e *Engine) Submit(ctx context.Context, req SubmitRequest) (*pipeline.Run, error) {
+	a, err := e.admit(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.store.SaveRun(ctx, a.run); err != nil {
+		e.unlockRun(a.lease)
+		return nil, fmt.Errorf("failed to record run: %w", err)
+	}
+	return e.start(a), nil
+}
+
+// BatchResult is the outcome of one item of a batch. Exactly one of Run and
+// Err is set.
+type BatchResult struct {
+	Run *pipeline.Run
+	Err error
+}
+
+// SubmitBatch admits every item on its own, exactly as Submit would, and
+// starts the accepted ones. Items sharing a spec document are parsed and
+// validated once, and all accepted runs are recorded in a single store
+// write. results[i] reports the outcome of reqs[i]; a rejected item never
+// affects the others.
+func (e *Engine) SubmitBatch(ctx context.Context, reqs []SubmitRequest) ([]BatchResult, error) {
+	if len(reqs) > MaxBatchSize {
+		return nil, ErrBatchTooLarge
+	}
+
+	results := make([]BatchResult, len(reqs))
+	specs := make(map[string]*validatedSpec)
+	var admitted []*admission
+	var index []int
+	for i, req := range reqs {
+		a, err := e.admit(ctx, req, specs)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		admitted = append(admitted, a)
+		index = append(index, i)
+	}
+	if len(admitted) == 0 {
+		return results, nil
+	}
+
+	runs := make([]*pipeline.Run, len(admitted))
+	for k, a := range admitted {
+		runs[k] = a.run
+	}
+	if err := e.store.SaveRuns(ctx, runs); err != nil {
+		err = fmt.Errorf("failed to record run: %w", err)
+		for k, i := range index {
+			e.unlockRun(admitted[k].lease)
+			results[i].Err = err
+		}
+		return results, nil
+	}
+	for k, a := range admitted {
+		results[index[k]].Run = e.start(a)
+	}
+
+	logging.FromContext(ctx, e.logger).WithFields(logrus.Fields{
+		"items":    len(reqs),
+		"accepted": len(admitted),
+	}).Info("Pipeline batch submitted")
+	return results, nil
+}
+
+// admission is a submission that passed validation and pre-flight and is
+// ready to be recorded.
+type admission struct {
+	run  *pipeline.Run
+	wait bool
+	// lease is the run's deduplication lock, held until it finishes.
+	lease *lock.Lease
+}
+
+// validatedSpec is the parse and validation outcome of a spec document.
+type validatedSpec struct {
+	spec   *pipeline.Spec
+	issues pipeline.Issues
+	err    error
+}
+
+// admit validates req, evaluates the admission policy, runs the pre-flight
+// check and enforces the minimum resubmit interval. specs, when not nil,
+// memoizes validation by spec document across the items of a batch.
+func (e *Engine) admit(ctx context.Context, req SubmitRequest, specs map[string]*validatedSpec) (*admission, error) {
+	if e.Draining() {
+		return nil, ErrDraining
+	}
+	v := e.validate(req.Spec, specs)
+	if v.err != nil {
+		return nil, &ValidationError{Issues: pipeline.Issues{{Severity: pipeline.SeverityError, Message: v.err.Error()}}}
+	}
+	// Copy so per-run changes never leak into the memoized spec.
+	spec := *v.spec
+	if req.Repo != "" {
+		spec.Repo = req.Repo
+	}
+	if req.Branch != "" {
+		spec.Branch = req.Branch
+	}
+	if req.Commit != "" {
+		spec.Commit = req.Commit
+	}
+
+	issues := append(pipeline.Issues(nil), v.issues...)
+	params, paramIssues := pipeline.ResolveParams(&spec, req.Params)
+	issues = append(issues, paramIssues...)
+	issues = append(issues, pipeline.ScanParams(&spec, req.Params, e.policy)...)
+	if issues.HasErrors() {
+		return nil, &ValidationError{Issues: issues}
+	}
+	spec.Params = params
+
+	if p, paused := e.pauses.matching(e.slots.tenantOf(&spec), &spec); paused {
+		return nil, &TenantPausedError{Pause: p}
+	}
+
+	if err := e.evaluatePolicy(ctx, &spec); err != nil {
+		return nil, err
+	}
+
+	// In reject mode a clear shortfall refuses the submission outright; in
+	// queue mode the run is admitted and waits in execute.
+	var waitReason string
+	if e.preflight != PreflightOff {
+		if err := e.checkCapacity(ctx, &spec); err != nil {
+			if e.preflight == PreflightReject {
+				return nil, err
+			}
+			waitReason = "waiting for capacity: " + err.Error()
+		}
+	}
+	lease, err := e.lockRun(ctx, &spec)
+	if err != nil {
+		return nil, err
+	}
+	// Last, so only submissions that are otherwise admitted count as
+	// attempts.
+	if err := e.debounce.admit(&spec); err != nil {
+		e.unlockRun(lease)
+		return nil, err
+	}
+
+	run := &pipeline.Run{
+		ID:           uuid.NewString(),
+		Spec:         spec,
+		Status:       pipeline.StatusQueued,
+		Reason:       waitReason,
+		Schedule:     req.Schedule,
+		TriggeredBy:  req.TriggeredBy,
+		TraceParent:  tracing.TraceParent(ctx),
+		RequestID:    logging.RequestID(ctx),
+		Upstream:     req.Upstream,
+		RerunOf:      req.RerunOf,
+		ReusedStages: req.ReusedStages,
+		CreatedAt:    e.clock.Now().UTC(),
+	}
+	if run.TriggeredBy == "" && req.Schedule != nil {
+		run.TriggeredBy = "schedule:" + req.Schedule.Name
+	}
+	if gates := e.aiGates.Load(); gates != nil {
+		run.AIGates = gates.Resolve(&spec)
+	}
+	return &admission{run: run, wait: waitReason != "", lease: lease}, nil
+}
+
+// evaluatePolicy runs the admission policy against spec and applies the
+// annotations of an allowed decision to it.
+func (e *Engine) evaluatePolicy(ctx context.Context, spec *pipeline.Spec) error {
+	if e.admission == nil {
+		return nil
+	}
+	log := logging.FromContext(ctx, e.logger).WithField("pipeline", spec.Name)
+
+	d, err := e.admission.Evaluate(ctx, policy.Input{Spec: spec, Params: spec.Params})
+	if err != nil {
+		metrics.PolicyDecisions.WithLabelValues("error").Inc()
+		if e.admissionFailOpen {
+			log.WithError(err).Warn("Admission policy unavailable, admitting pipeline")
+			return nil
+		}
+		log.WithError(err).Error("Admission policy unavailable, refusing pipeline")
+		return ErrPolicyUnavailable
+	}
+	if !d.Allowed {
+		metrics.PolicyDecisions.WithLabelValues("denied").Inc()
+		log.WithField("reasons", d.Reasons).Info("Pipeline denied by admission policy")
+		return &PolicyError{Reasons: d.Reasons}
+	}
+	metrics.PolicyDecisions.WithLabelValues("allowed").Inc()
+
+	if len(d.Annotations) > 0 {
+		annotations := make(map[string]string, len(spec.Annotations)+len(d.Annotations))
+		for k, v := range spec.Annotations {
+			annotations[k] = v
+		}
+		for k, v := range d.Annotations {
+			annotations[k] = v
+		}
+		spec.Annotations = annotations
+	}
+	return nil
+}
+
+func (e *Engine) validate(data []byte, specs map[string]*validatedSpec) *validatedSpec {
+	if v, ok := specs[string(data)]; ok {
+		return v
+	}
+	v := &validatedSpec{}
+	if v.spec, v.err = pipeline.Parse(data); v.err == nil {
+		pipeline.Normalize(v.spec)
+		v.issues = pipeline.Validate(v.spec, e.policy)
+	}
+	if specs != nil {
+		specs[string(data)] = v
+	}
+	return v
+}
+
+// start hands a recorded run to the executor and returns its queued state.
+func (e *Engine) start(a *admission) *pipeline.Run {
+	run := a.run
+	queued := run.Clone()
+
+	log := e.logger.WithFields(logrus.Fields{
+		"pipeline_id": run.ID,
+		"pipeline":    run.Spec.Name,
+	})
+	if run.RequestID != "" {
+		log = log.WithField("request_id", run.RequestID)
+	}
+	log.Info("Pipeline submitted")
+
+	runCtx, cancel := context.WithCancel(e.ctx)
+	fence := &runFence{lease: a.lease}
+	e.mu.Lock()
+	if e.drain.deadlinePassed {
+		// Admitted while the drain gave up on the runs left; nobody will
+		// execute this one either.
+		e.mu.Unlock()
+		cancel()
+		e.recordOrphaned(run.ID, e.logger.WithField("pipeline_id", run.ID))
+		e.unlockRun(a.lease)
+		return queued
+	}
+	e.active[run.ID] = activeRun{cancel: cancel, fence: fence, tenant: e.slots.tenantOf(&run.Spec), repo: run.Spec.Repo, lease: a.lease}
+	e.trackDrainedLocked()
+	e.mu.Unlock()
+
+	if a.lease != nil {
+		e.wg.Add(1)
+		go e.watchLease(runCtx, run.ID, a.lease, cancel)
+	}
+	quiet := e.enterQuietPeriod(run)
+	e.wg.Add(1)
+	go e.execute(runCtx, run, fence, quiet, a.wait)
+	return queued
+}
+
+// Get returns the current state of a run.
+func (e *Engine) Get(ctx context.Context, id string) (*pipeline.Run, error) {
+	return e.store.GetRun(ctx, id)
+}
+
+// List returns the runs matching opts, newest first.
+func (e *Engine) List(ctx context.Context, opts store.ListOptions) ([]*pipeline.Run, error) {
+	return e.store.ListRuns(ctx, opts)
+}
+
+// Count returns how many runs match opts, regardless of its Offset and
+// Limit.
+func (e *Engine) Count(ctx context.Context, opts store.ListOptions) (int, error) {
+	return e.store.CountRuns(ctx, opts)
+}
+
+// Cancel stops a run wherever it executes. Runs on this replica are
+// cancelled directly; others are relayed through the CancelRelay, which
+// waits for the executing replica to acknowledge. A run missing from this
+// replica's store may be recorded by the replica running it, so it is
+// relayed too; it is only reported not found when no replica acknowledges.
+func (e *Engine) Cancel(ctx context.Context, id string) error {
+	run, err := e.store.GetRun(ctx, id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		if e.relay == nil {
+			return err
+		}
+		if rerr := e.relay.RequestCancel(ctx, id); !errors.Is(rerr, cancellation.ErrNotAcknowledged) {
+			return rerr
+		}
+		return err
+	case err != nil:
+		return err
+	case run.Status.Terminal():
+		return &RunFinishedError{Status: run.Status}
+	}
+	if e.CancelLocal(id) {
+		return nil
+	}
+	if e.relay == nil {
+		return ErrRunNotActive
+	}
+	return e.relay.RequestCancel(ctx, id)
+}
+
+// Warn records msg among the warnings of a run. A run executing on this
+// replica records it with its next state change; a finished run is updated
+// in place. Warnings for runs queued or executing elsewhere are refused with
+// ErrRunNotActive, since saving them here would race the owner's updates.
+func (e *Engine) Warn(ctx context.Context, id, msg string) error {
+	if e.executor.Warn(id, msg) {
+		return nil
+	}
+	run, err := e.store.GetRun(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !run.Status.Terminal() {
+		return ErrRunNotActive
+	}
+	run.Warnings = append(run.Warnings, msg)
+	if err := e.store.SaveRun(ctx, run); err != nil {
+		return fmt.Errorf("failed to record run: %w", err)
+	}
+	return nil
+}
+
+// CancelLocal cancels the run if it executes on this replica and reports
+// whether it did. The run's slot is released at once so a queued run can
+// start while this one winds down.
+func (e *Engine) CancelLocal(id string) bool {
+	e.mu.Lock()
+	a, ok := e.active[id]
+	e.mu.Unlock()
+	if !ok {
+		return false
+	}
+	e.logger.WithField("pipeline_id", id).Info("Cancelling pipeline")
+	a.stop()
+	return true
+}
+
+// Close cancels every active run and waits for them to record their final
+// state.
+func (e *Engine) Close() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+func (e *Engine) execute(ctx context.Context, run *pipeline.Run, fence *runFence, quiet *quietRun, waitForCapacity bool) {
+	defer e.wg.Done()
+	defer func() {
+		e.mu.Lock()
+		a := e.active[run.ID]
+		delete(e.active, run.ID)
+		e.idleLocked()
+		e.mu.Unlock()
+		a.cancel()
+		e.unlockRun(a.lease)
+	}()
+
+	if !e.awaitQuietPeriod(ctx, run, quiet) {
+		return
+	}
+	if waitForCapacity && !e.awaitCapacity(ctx, run) {
+		return
+	}
+	if e.dropStale(run) {
+		return
+	}
+	if !e.awaitSlot(ctx, run) {
+		return
+	}
+	release := sync.OnceFunc(e.slots.release)
+	defer release()
+	e.mu.Lock()
+	if a, ok := e.active[run.ID]; ok {
+		a.release = release
+		e.active[run.ID] = a
+	}
+	e.mu.Unlock()
+	metrics.QueueWait.WithLabelValues(
+		metrics.TenantLabel(e.slots.tenantOf(&run.Spec)),
+		metrics.PriorityLabel(e.priorityOf(&run.Spec)),
+	).Observe(e.clock.Now().Sub(run.CreatedAt).Seconds())
+	if e.hardTimeout > 0 {
+		e.executeBounded(ctx, run, fence)
+	} else if err := e.executor.Execute(ctx, run, fence); err != nil {
+		e.logger.WithError(err).WithField("pipeline_id", run.ID).Error("Pipeline execution failed")
+	}
+	e.triggerDownstream(run.ID)
+}
+
+// executeBounded executes run, force-cancelling it once it has run for the
+// hard timeout. On enforcement the executor is fenced off the run record
+// before its context is cancelled, so nothing it does afterwards, including
+// a post-run hook, can overwrite the timed-out state; the engine waits up to
+// hardTimeoutGrace for it to stop and then records that state from the
+// store, whether or not it did.
+func (e *Engine) executeBounded(ctx context.Context, run *pipeline.Run, fence *runFence) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	log := e.logger.WithField("pipeline_id", run.ID)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.executor.Execute(ctx, run, fence)
+	}()
+
+	timer := e.clock.NewTimer(e.hardTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.WithError(err).Error("Pipeline execution failed")
+		}
+		return
+	case <-timer.C():
+	}
+
+	fence.trip(ErrHardTimeout)
+	cancel(ErrHardTimeout)
+	log.WithField("hard_timeout", e.hardTimeout).Error("Pipeline exceeded the hard timeout, force-cancelling it")
+	grace := e.clock.NewTimer(hardTimeoutGrace)
+	defer grace.Stop()
+	select {
+	case <-done:
+	case <-grace.C():
+		log.WithField("grace", hardTimeoutGrace).Error("Pipeline did not stop within the grace period after its hard timeout, recording it as timed out anyway")
+	}
+	e.recordHardTimeout(run.ID, log)
+}
+
+// recordHardTimeout marks the last recorded state of the run as timed out
+// with HardTimeoutReason, unless it had already finished.
+func (e *Engine) recordHardTimeout(id string, log *logrus.Entry) {
+	ctx := context.WithoutCancel(e.ctx)
+	run, err := e.store.GetRun(ctx, id)
+	if err != nil {
+		log.WithError(err).Error("Failed to read run to record its hard timeout")
+		return
+	}
+	if run.Status.Terminal() {
+		return
+	}
+
+	now := e.clock.Now().UTC()
+	ran := e.hardTimeout
+	if run.StartedAt != nil {
+		ran = now.Sub(*run.StartedAt)
+	}
+	run.Status = pipeline.StatusTimedOut
+	run.Reason = fmt.Sprintf("%s: ran for %s, longer than the maximum pipeline duration of %s",
+		HardTimeoutReason, ran.Round(time.Second), e.hardTimeout)
+	run.FinishedAt = &now
+	finishStages(run, now, pipeline.StatusTimedOut, ErrHardTimeout.Error())
+	if err := e.store.SaveRun(ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record run")
+		return
+	}
+	metrics.RunsHardTimeout.Inc()
+	log.WithField("reason", run.Reason).Warn("Recorded pipeline as timed out by the hard timeout")
+}
+
+// finishStage finishes the unfinished jobs of st: those running with
+// status, those not started as skipped, all with msg.
+func finishStage(st *pipeline.StageResult, now time.Time, status pipeline.Status, msg string) {
+	if st.Status.Terminal() {
+		return
+	}
+	for j := range st.Jobs {
+		job := &st.Jobs[j]
+		switch {
+		case job.Status.Terminal():
+			continue
+		case job.Status == pipeline.StatusRunning:
+			job.Status = status
+			job.FinishedAt = &now
+		default:
+			job.Status = pipeline.StatusSkipped
+		}
+		job.Message = msg
+	}
+	if st.Status == pipeline.StatusRunning {
+		st.Status = status
+	} else {
+		st.Status = pipeline.StatusSkipped
+	}
+}
+
+// finishStages applies finishStage to every stage of run.
+func finishStages(run *pipeline.Run, now time.Time, status pipeline.Status, msg string) {
+	for i := range run.Stages {
+		finishStage(&run.Stages[i], now, status, msg)
+	}
+	for i := range run.Finally {
+		finishStage(&run.Finally[i], now, status, msg)
+	}
+	if run.PostRun != nil {
+		finishStage(run.PostRun, now, status, msg)
+	}
+}
+
+// runFence fails once tripped, so an executor the engine has given up on,
+// past its hard timeout or orphaned at shutdown, stops recording its
+// progress. The first trip's cause wins. With a lease it also fails once
+// the run's deduplication lock expired or was taken over, since another
+// replica may be executing the run by then.
+type runFence struct {
+	cause atomic.Pointer[error]
+	lease *lock.Lease
+}
+
+func (f *runFence) trip(cause error) {
+	f.cause.CompareAndSwap(nil, &cause)
+}
+
+func (f *runFence) Check(ctx context.Context) error {
+	if cause := f.cause.Load(); cause != nil {
+		return *cause
+	}
+	if f.lease != nil {
+		return f.lease.Check(ctx)
+	}
+	return nil
+}
+
+// priorityOf returns the priority spec names in the priority label, or ""
+// without one.
+func (e *Engine) priorityOf(spec *pipeline.Spec) string {
+	if e.priorityLabel == "" {
+		return ""
+	}
+	return spec.Labels[e.priorityLabel]
+}
+
+// dropStale records run as cancelled with QueueStaleReason and reports true
+// when it has been queued longer than the maximum queue age. It is checked
+// each time the run could leave the queue, so stale work never starts.
+func (e *Engine) dropStale(run *pipeline.Run) bool {
+	if e.queueMaxAge <= 0 {
+		return false
+	}
+	now := e.clock.Now().UTC()
+	age := now.Sub(run.CreatedAt)
+	if age <= e.queueMaxAge {
+		return false
+	}
+
+	run.Status = pipeline.StatusCancelled
+	run.Reason = fmt.Sprintf("%s: queued for %s, longer than the maximum queue age of %s",
+		QueueStaleReason, age.Round(time.Second), e.queueMaxAge)
+	run.FinishedAt = &now
+	log := e.logger.WithField("pipeline_id", run.ID)
+	if err := e.store.SaveRun(e.ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record run")
+	}
+	metrics.RunsQueueStale.Inc()
+	log.WithField("age", age.Round(time.Second)).Warn("Dropped stale queued pipeline")
+	return true
+}
+
+// awaitSlot holds a queued run until it gets one of the run slots. It
+// reports false, holding no slot, when the run was cancelled, went stale or
+// the engine closed instead.
+func (e *Engine) awaitSlot(ctx context.Context, run *pipeline.Run) bool {
+	if e.slots.tryAcquire() {
+		return true
+	}
+
+	log := e.logger.WithField("pipeline_id", run.ID)
+	run.Reason = fmt.Sprintf("waiting for one of %d run slots", e.slots.capacity())
+	if err := e.store.SaveRun(e.ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record run")
+	}
+	log.WithField("tenant", e.slots.tenant(&run.Spec)).Info("Pipeline queued for a run slot")
+
+	if err := e.slots.acquire(ctx, &run.Spec); err != nil {
+		if e.ctx.Err() == nil {
+			now := e.clock.Now().UTC()
+			run.Status = pipeline.StatusCancelled
+			run.Reason = "cancelled while waiting for a run slot"
+			run.FinishedAt = &now
+			if err := e.store.SaveRun(e.ctx, run); err != nil {
+				log.WithError(err).Error("Failed to record run")
+			}
+		}
+		return false
+	}
+	run.Reason = ""
+	if e.dropStale(run) {
+		e.slots.release()
+		return false
+	}
+	return true
+}
+
+// checkCapacity runs the capacity check, returning only shortfalls. A check
+// that cannot be performed does not hold up pipelines.
+func (e *Engine) checkCapacity(ctx context.Context, spec *pipeline.Spec) error {
+	err := e.capacity.CheckCapacity(ctx, spec)
+	if err != nil && !errors.Is(err, pipeline.ErrInsufficientCapacity) {
+		logging.FromContext(ctx, e.logger).WithError(err).WithField("pipeline", spec.Name).Warn("Pre-flight capacity check failed, admitting pipeline")
+		return nil
+	}
+	return err
+}
+
+// awaitCapacity holds a queued run until it fits. It reports false when the
+// run was failed, cancelled or the engine closed instead.
+func (e *Engine) awaitCapacity(ctx context.Context, run *pipeline.Run) bool {
+	log := e.logger.WithField("pipeline_id", run.ID)
+	log.WithField("reason", run.Reason).Info("Pipeline queued for capacity")
+
+	ticker := e.clock.NewTicker(e.preflightInterval)
+	defer ticker.Stop()
+	var deadline <-chan time.Time
+	if e.preflightTimeout > 0 {
+		timer := e.clock.NewTimer(e.preflightTimeout)
+		defer timer.Stop()
+		deadline = timer.C()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if e.ctx.Err() == nil {
+				now := e.clock.Now().UTC()
+				run.Status = pipeline.StatusCancelled
+				run.Reason = "cancelled while waiting for capacity"
+				run.FinishedAt = &now
+				if err := e.store.SaveRun(e.ctx, run); err != nil {
+					log.WithError(err).Error("Failed to record run")
+				}
+			}
+			return false
+		case <-deadline:
+			now := e.clock.Now().UTC()
+			run.Status = pipeline.StatusFailed
+			run.Reason = fmt.Sprintf("gave up after %s %s", e.preflightTimeout, run.Reason)
+			run.FinishedAt = &now
+			if err := e.store.SaveRun(e.ctx, run); err != nil {
+				log.WithError(err).Error("Failed to record run")
+			}
+			log.Warn("Pipeline never got the capacity it needs")
+			return false
+		case <-ticker.C():
+			if e.dropStale(run) {
+				return false
+			}
+			err := e.checkCapacity(ctx, &run.Spec)
+			if err == nil {
+				run.Reason = ""
+				return true
+			}
+			run.Reason = "waiting for capacity: " + err.Error()
+		}
+	}
+}
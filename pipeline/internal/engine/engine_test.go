@@ -0,0 +1,633 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/cancellation"
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/policy"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+type paramsRunner struct {
+	params chan map[string]string
+}
+
+func (r *paramsRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	r.params <- run.Spec.Params
+	return nil
+}
+
+// countingStore counts saves so tests can assert nothing was recorded.
+type countingStore struct {
+	*store.Memory
+	mu    sync.Mutex
+	saves int
+}
+
+func (c *countingStore) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	c.mu.Lock()
+	c.saves++
+	c.mu.Unlock()
+	return c.Memory.SaveRun(ctx, run)
+}
+
+func newTestEngine(r executor.Runner) (*Engine, *countingStore) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := &countingStore{Memory: store.NewMemory()}
+	e := New(Options{
+		Executor: executor.New(executor.Options{Runner: r, Recorder: runs, Logger: logger}),
+		Store:    runs,
+		Logger:   logger,
+	})
+	return e, runs
+}
+
+const schemaSpec = `
+name: deploy
+params_schema:
+  type: object
+  required: [env]
+  properties:
+    env: {type: string}
+    replicas: {type: integer, default: 3}
+stages:
+- name: apply
+  image: ghcr.io/org/deploy:1.0
+`
+
+func TestSubmitRunsWithResolvedParams(t *testing.T) {
+	runner := &paramsRunner{params: make(chan map[string]string, 1)}
+	e, _ := newTestEngine(runner)
+	defer e.Close()
+
+	run, err := e.Submit(context.Background(), SubmitRequest{
+		Spec:   []byte(schemaSpec),
+		Params: map[string]string{"env": "staging"},
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if run.Status != pipeline.StatusQueued {
+		t.Errorf("status = %s, want Queued", run.Status)
+	}
+
+	select {
+	case params := <-runner.params:
+		if params["env"] != "staging" || params["replicas"] != "3" {
+			t.Fatalf("params = %v", params)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never ran")
+	}
+}
+
+func TestQueueWaitIsRecordedByTenantAndPriority(t *testing.T) {
+	runner := &paramsRunner{params: make(chan map[string]string, 1)}
+	e, _ := newTestEngine(runner)
+	e.slots.tenantLabel = "team"
+	e.priorityLabel = "priority"
+	defer e.Close()
+
+	// QueueWait is global; start from no series so -count runs agree.
+	metrics.QueueWait.Reset()
+	spec := schemaSpec + "labels:\n  team: queue-wait-test\n  priority: high\n"
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(spec), Params: map[string]string{"env": "qa"}}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	select {
+	case <-runner.params:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never ran")
+	}
+	if got := testutil.CollectAndCount(metrics.QueueWait); got != 1 {
+		t.Errorf("queue wait series = %d, want 1 for the tenant", got)
+	}
+	if !metrics.QueueWait.DeleteLabelValues("queue-wait-test", "high") {
+		t.Error("queue wait not recorded for tenant queue-wait-test and priority high")
+	}
+}
+
+func TestSubmitRejectsInvalidParams(t *testing.T) {
+	e, runs := newTestEngine(&paramsRunner{params: make(chan map[string]string, 1)})
+	defer e.Close()
+
+	_, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec)})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Submit() error = %v, want ValidationError", err)
+	}
+	if !verr.Issues.HasErrors() {
+		t.Fatalf("issues = %v", verr.Issues)
+	}
+	if runs.saves != 0 {
+		t.Fatal("rejected submission was recorded")
+	}
+}
+
+// fakeCapacity reports a shortfall until enough is set.
+type fakeCapacity struct {
+	mu     sync.Mutex
+	enough bool
+}
+
+func (f *fakeCapacity) CheckCapacity(ctx context.Context, spec *pipeline.Spec) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.enough {
+		return nil
+	}
+	return fmt.Errorf("%w: stage apply requests 8 cpu but quota ci has 2 left", pipeline.ErrInsufficientCapacity)
+}
+
+func newPreflightEngine(r executor.Runner, capacity CapacityChecker, mode string) *Engine {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := store.NewMemory()
+	return New(Options{
+		Executor:          executor.New(executor.Options{Runner: r, Recorder: runs, Logger: logger}),
+		Store:             runs,
+		Logger:            logger,
+		Capacity:          capacity,
+		Preflight:         mode,
+		PreflightTimeout:  time.Minute,
+		PreflightInterval: 10 * time.Millisecond,
+	})
+}
+
+func TestPreflightRejectRefusesSubmission(t *testing.T) {
+	e := newPreflightEngine(&paramsRunner{params: make(chan map[string]string, 1)}, &fakeCapacity{}, PreflightReject)
+	defer e.Close()
+
+	_, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if !errors.Is(err, pipeline.ErrInsufficientCapacity) {
+		t.Fatalf("Submit() error = %v, want ErrInsufficientCapacity", err)
+	}
+}
+
+func TestPreflightQueueWaitsForCapacity(t *testing.T) {
+	runner := &paramsRunner{params: make(chan map[string]string, 1)}
+	capacity := &fakeCapacity{}
+	e := newPreflightEngine(runner, capacity, PreflightQueue)
+	defer e.Close()
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if run.Status != pipeline.StatusQueued || !strings.Contains(run.Reason, "waiting for capacity") {
+		t.Fatalf("run = %s %q, want queued for capacity", run.Status, run.Reason)
+	}
+
+	select {
+	case <-runner.params:
+		t.Fatal("job ran before capacity was available")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	capacity.mu.Lock()
+	capacity.enough = true
+	capacity.mu.Unlock()
+	select {
+	case <-runner.params:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never ran once capacity freed up")
+	}
+}
+
+func TestQueueMaxAgeDropsStaleRun(t *testing.T) {
+	runner := &paramsRunner{params: make(chan map[string]string, 1)}
+	e := newPreflightEngine(runner, &fakeCapacity{}, PreflightQueue)
+	clk := clock.NewFake(time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC))
+	e.clock, e.queueMaxAge = clk, 30*time.Second
+	defer e.Close()
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	// The capacity poll and the pre-flight timeout.
+	clk.BlockUntil(2)
+	clk.Advance(45 * time.Second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := e.Get(context.Background(), run.ID)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if got.Status.Terminal() {
+			if got.Status != pipeline.StatusCancelled || !strings.HasPrefix(got.Reason, QueueStaleReason) || !strings.Contains(got.Reason, "queued for 45s") {
+				t.Fatalf("run = %s %q, want cancelled as %s after 45s", got.Status, got.Reason, QueueStaleReason)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale run was never dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-runner.params:
+		t.Fatal("stale run was started")
+	default:
+	}
+}
+
+// blockingRunner holds every job until its context is cancelled.
+type blockingRunner struct {
+	started chan struct{}
+}
+
+func (r *blockingRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	r.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// fakeRelay records relayed cancel requests and answers them with err.
+type fakeRelay struct {
+	ids chan string
+	err error
+}
+
+func (f *fakeRelay) RequestCancel(ctx context.Context, runID string) error {
+	f.ids <- runID
+	return f.err
+}
+
+func TestCancelStopsLocalRun(t *testing.T) {
+	runner := &blockingRunner{started: make(chan struct{}, 1)}
+	e, runs := newTestEngine(runner)
+	defer e.Close()
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-runner.started
+	if err := e.Cancel(context.Background(), run.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := runs.GetRun(context.Background(), run.ID)
+		if got.Status == pipeline.StatusCancelled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s, want Cancelled", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var finished *RunFinishedError
+	if err := e.Cancel(context.Background(), run.ID); !errors.As(err, &finished) || finished.Status != pipeline.StatusCancelled {
+		t.Fatalf("second Cancel() error = %v, want RunFinishedError for Cancelled", err)
+	}
+}
+
+// stubbornRunner reports each job it starts and ignores cancellation until
+// released, like a TaskRun slow to wind down.
+type stubbornRunner struct {
+	started chan string
+	release chan struct{}
+}
+
+func (r *stubbornRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	r.started <- run.ID
+	<-r.release
+	return ctx.Err()
+}
+
+func TestCancelReleasesSlotAtOnce(t *testing.T) {
+	runner := &stubbornRunner{started: make(chan string, 2), release: make(chan struct{})}
+	e, _ := newTestEngine(runner)
+	e.slots = newSlots(1, SchedulingFIFO, "")
+	defer e.Close()
+	defer close(runner.release)
+
+	submit := func() *pipeline.Run {
+		run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		return run
+	}
+	first := submit()
+	if id := <-runner.started; id != first.ID {
+		t.Fatalf("started %s, want %s", id, first.ID)
+	}
+	second := submit()
+	if err := e.Cancel(context.Background(), first.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+
+	// The first run's job is still winding down; the second starts anyway.
+	select {
+	case id := <-runner.started:
+		if id != second.ID {
+			t.Fatalf("started %s, want %s", id, second.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued run did not start after the running one was cancelled")
+	}
+}
+
+// stuckRunner ignores cancellation, like a TaskRun whose timeout never
+// fires, until released.
+type stuckRunner struct {
+	started chan error
+	release chan struct{}
+}
+
+func (r *stuckRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	go func() {
+		<-ctx.Done()
+		r.started <- context.Cause(ctx)
+	}()
+	<-r.release
+	return ctx.Err()
+}
+
+func TestHardTimeoutForceCancelsStuckRun(t *testing.T) {
+	defer func(d time.Duration) { hardTimeoutGrace = d }(hardTimeoutGrace)
+	hardTimeoutGrace = 20 * time.Millisecond
+
+	runner := &stuckRunner{started: make(chan error, 1), release: make(chan struct{})}
+	e, runs := newTestEngine(runner)
+	e.hardTimeout = 50 * time.Millisecond
+	defer e.Close()
+	defer close(runner.release)
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := runs.GetRun(context.Background(), run.ID)
+		if got.Status.Terminal() {
+			if got.Status != pipeline.StatusTimedOut || !strings.HasPrefix(got.Reason, HardTimeoutReason) {
+				t.Fatalf("run = %s %q, want timed out as %s", got.Status, got.Reason, HardTimeoutReason)
+			}
+			if job := got.Stages[0].Jobs[0]; job.Status != pipeline.StatusTimedOut {
+				t.Errorf("job status = %s, want TimedOut", job.Status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s, want TimedOut", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cause := <-runner.started; !errors.Is(cause, ErrHardTimeout) {
+		t.Errorf("job cancelled with cause %v, want ErrHardTimeout", cause)
+	}
+	if err := e.Cancel(context.Background(), run.ID); !errors.Is(err, ErrRunFinished) {
+		t.Errorf("Cancel() error = %v, want ErrRunFinished", err)
+	}
+}
+
+func TestCancelRelaysRunsOfOtherReplicas(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := store.NewMemory()
+	relay := &fakeRelay{ids: make(chan string, 1)}
+	e := New(Options{
+		Executor:    executor.New(executor.Options{Runner: &paramsRunner{}, Recorder: runs, Logger: logger}),
+		Store:       runs,
+		Logger:      logger,
+		CancelRelay: relay,
+	})
+	defer e.Close()
+
+	// A run recorded by another replica.
+	if err := runs.SaveRun(context.Background(), &pipeline.Run{ID: "elsewhere", Status: pipeline.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Cancel(context.Background(), "elsewhere"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if id := <-relay.ids; id != "elsewhere" {
+		t.Fatalf("relayed %q, want elsewhere", id)
+	}
+}
+
+func TestCancelRelaysRunsMissingFromLocalStore(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := store.NewMemory()
+	relay := &fakeRelay{ids: make(chan string, 1)}
+	e := New(Options{
+		Executor:    executor.New(executor.Options{Runner: &paramsRunner{}, Recorder: runs, Logger: logger}),
+		Store:       runs,
+		Logger:      logger,
+		CancelRelay: relay,
+	})
+	defer e.Close()
+
+	// The run is only recorded in the store of the replica running it.
+	if err := e.Cancel(context.Background(), "owned-elsewhere"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if id := <-relay.ids; id != "owned-elsewhere" {
+		t.Fatalf("relayed %q, want owned-elsewhere", id)
+	}
+
+	// Without any replica acknowledging, the run does not exist.
+	relay.err = cancellation.ErrNotAcknowledged
+	if err := e.Cancel(context.Background(), "nowhere"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Cancel() error = %v, want ErrNotFound", err)
+	}
+	<-relay.ids
+}
+
+// batchStore counts batched writes.
+type batchStore struct {
+	*store.Memory
+	batches int
+}
+
+func (b *batchStore) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	b.batches++
+	return b.Memory.SaveRuns(ctx, runs)
+}
+
+func TestSubmitBatchReportsPartialSuccess(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := &batchStore{Memory: store.NewMemory()}
+	runner := &paramsRunner{params: make(chan map[string]string, 3)}
+	e := New(Options{
+		Executor: executor.New(executor.Options{Runner: runner, Recorder: runs, Logger: logger}),
+		Store:    runs,
+		Logger:   logger,
+	})
+	defer e.Close()
+
+	results, err := e.SubmitBatch(context.Background(), []SubmitRequest{
+		{Spec: []byte(schemaSpec), Params: map[string]string{"env": "a"}},
+		{Spec: []byte(schemaSpec)},
+		{Spec: []byte("not: [valid")},
+		{Spec: []byte(schemaSpec), Params: map[string]string{"env": "b"}},
+	})
+	if err != nil {
+		t.Fatalf("SubmitBatch() error = %v", err)
+	}
+	var verr *ValidationError
+	if results[0].Run == nil || results[3].Run == nil {
+		t.Fatalf("valid items rejected: %+v", results)
+	}
+	if !errors.As(results[1].Err, &verr) || !errors.As(results[2].Err, &verr) {
+		t.Fatalf("invalid items not rejected with ValidationError: %v, %v", results[1].Err, results[2].Err)
+	}
+	if results[0].Run.Spec.Params["env"] != "a" || results[3].Run.Spec.Params["env"] != "b" {
+		t.Fatal("params leaked between items sharing a spec")
+	}
+	if runs.batches != 1 {
+		t.Fatalf("accepted runs recorded in %d batches, want 1", runs.batches)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runner.params:
+		case <-time.After(5 * time.Second):
+			t.Fatal("accepted run never executed")
+		}
+	}
+}
+
+func TestSubmitBatchRejectsOversizedBatch(t *testing.T) {
+	e, _ := newTestEngine(&paramsRunner{})
+	defer e.Close()
+	if _, err := e.SubmitBatch(context.Background(), make([]SubmitRequest, MaxBatchSize+1)); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("SubmitBatch() error = %v, want ErrBatchTooLarge", err)
+	}
+}
+
+const admissionPolicy = `
+package devmind.admission
+
+import future.keywords.contains
+import future.keywords.if
+
+deny contains msg if {
+	input.params.env == "prod"
+	msg := "prod deploys need a change ticket"
+}
+
+annotations := {"policy.devmind.io/reviewed": "true"}
+`
+
+// brokenPolicy fails every evaluation.
+type brokenPolicy struct{}
+
+func (brokenPolicy) Evaluate(ctx context.Context, in policy.Input) (policy.Decision, error) {
+	return policy.Decision{}, errors.New("opa unreachable")
+}
+
+func newPolicyEngine(admission policy.Evaluator, failOpen bool) (*Engine, *countingStore) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := &countingStore{Memory: store.NewMemory()}
+	return New(Options{
+		Executor:          executor.New(executor.Options{Runner: &paramsRunner{params: make(chan map[string]string, 1)}, Recorder: runs, Logger: logger}),
+		Store:             runs,
+		Logger:            logger,
+		Admission:         admission,
+		AdmissionFailOpen: failOpen,
+	}), runs
+}
+
+func TestAdmissionPolicyDeniesAndAnnotates(t *testing.T) {
+	eval, err := policy.NewRego(context.Background(), "admission.rego", admissionPolicy, policy.DefaultQuery, time.Second)
+	if err != nil {
+		t.Fatalf("NewRego() error = %v", err)
+	}
+	e, runs := newPolicyEngine(eval, false)
+	defer e.Close()
+
+	_, err = e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "prod"}})
+	var perr *PolicyError
+	if !errors.As(err, &perr) || len(perr.Reasons) != 1 || perr.Reasons[0] != "prod deploys need a change ticket" {
+		t.Fatalf("Submit() error = %v, want policy denial with its reason", err)
+	}
+	if runs.saves != 0 {
+		t.Fatalf("denied submission recorded %d saves, want none", runs.saves)
+	}
+
+	run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if got := run.Spec.Annotations["policy.devmind.io/reviewed"]; got != "true" {
+		t.Fatalf("annotations = %v, want the policy's annotation", run.Spec.Annotations)
+	}
+}
+
+func TestAdmissionPolicyFailure(t *testing.T) {
+	closed, _ := newPolicyEngine(brokenPolicy{}, false)
+	defer closed.Close()
+	if _, err := closed.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}}); !errors.Is(err, ErrPolicyUnavailable) {
+		t.Fatalf("fail-closed Submit() error = %v, want ErrPolicyUnavailable", err)
+	}
+
+	open, _ := newPolicyEngine(brokenPolicy{}, true)
+	defer open.Close()
+	if _, err := open.Submit(context.Background(), SubmitRequest{Spec: []byte(schemaSpec), Params: map[string]string{"env": "qa"}}); err != nil {
+		t.Fatalf("fail-open Submit() error = %v, want admitted", err)
+	}
+}
+
+func TestMinResubmitIntervalRejectsRetryStorm(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	runs := store.NewMemory()
+	clk := clock.NewFake(time.Now())
+	e := New(Options{
+		Executor:            executor.New(executor.Options{Runner: &paramsRunner{params: make(chan map[string]string, 8)}, Recorder: runs, Logger: logger}),
+		Store:               runs,
+		Logger:              logger,
+		MinResubmitInterval: time.Minute,
+		Clock:               clk,
+	})
+	defer e.Close()
+
+	spec := func(commit string) []byte {
+		return []byte("name: build\nrepo: github.com/org/app\ncommit: " + commit + "\nstages:\n- name: compile\n  image: ghcr.io/org/go:1.21\n")
+	}
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: spec("abc123")}); err != nil {
+		t.Fatalf("first Submit() error = %v", err)
+	}
+
+	clk.Advance(20 * time.Second)
+	_, err := e.Submit(context.Background(), SubmitRequest{Spec: spec("abc123")})
+	var soon *TooSoonError
+	if !errors.As(err, &soon) || soon.RetryAfter != 40*time.Second {
+		t.Fatalf("resubmit error = %v, want TooSoonError retrying after 40s", err)
+	}
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: spec("def456")}); err != nil {
+		t.Fatalf("Submit() for another commit error = %v", err)
+	}
+
+	clk.Advance(time.Minute)
+	if _, err := e.Submit(context.Background(), SubmitRequest{Spec: spec("abc123")}); err != nil {
+		t.Fatalf("Submit() after the interval error = %v", err)
+	}
+}
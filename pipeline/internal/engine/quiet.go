@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// quietPeriods coalesces rapid submissions. A run whose spec sets debounce
+// waits that long before it starts, and is superseded if a newer run of its
+// concurrency group arrives meanwhile, so a flurry of commits runs only the
+// latest. Runs are coalesced on this replica only.
+type quietPeriods struct {
+	mu     sync.Mutex
+	latest map[string]*quietRun
+}
+
+// quietRun is the run waiting out the quiet period of a group.
+type quietRun struct {
+	id string
+	// superseded receives the ID of the run that replaced this one.
+	superseded chan string
+}
+
+// concurrencyGroup identifies the runs a quiet period coalesces: those of
+// the same pipeline on the same repo branch.
+func concurrencyGroup(spec *pipeline.Spec) string {
+	return spec.Name + "\x00" + spec.Repo + "\x00" + spec.Branch
+}
+
+// enter makes run the latest of its group, superseding the run waiting
+// there, and returns its place for wait. Runs enter as they are admitted,
+// so the latest is the last submitted whatever order they start in.
+func (q *quietPeriods) enter(run *pipeline.Run) *quietRun {
+	group := concurrencyGroup(&run.Spec)
+	me := &quietRun{id: run.ID, superseded: make(chan string, 1)}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.latest == nil {
+		q.latest = make(map[string]*quietRun)
+	}
+	if prev := q.latest[group]; prev != nil {
+		prev.superseded <- run.ID
+	}
+	q.latest[group] = me
+	return me
+}
+
+// wait holds the run that entered as me until timer fires, or until a newer
+// run of its group supersedes it or ctx is done. It returns the ID of the
+// superseding run, if any, and whether the run may start.
+func (q *quietPeriods) wait(ctx context.Context, run *pipeline.Run, me *quietRun, timer clock.Timer) (string, bool) {
+	group := concurrencyGroup(&run.Spec)
+	defer timer.Stop()
+	select {
+	case by := <-me.superseded:
+		return by, false
+	case <-timer.C():
+	case <-ctx.Done():
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.latest[group] == me {
+		delete(q.latest, group)
+	}
+	select {
+	case by := <-me.superseded:
+		// Superseded as the period ended: the newer run wins.
+		return by, false
+	default:
+	}
+	return "", ctx.Err() == nil
+}
+
+// enterQuietPeriod enters run into its group's quiet period when its spec
+// sets debounce, returning nil otherwise. It must be called as the run is
+// admitted, before it starts executing.
+func (e *Engine) enterQuietPeriod(run *pipeline.Run) *quietRun {
+	if run.Spec.Debounce <= 0 {
+		return nil
+	}
+	return e.quiet.enter(run)
+}
+
+// awaitQuietPeriod holds a queued run through its spec's debounce period,
+// given the place it entered with. It reports false when the run was
+// debounced by a newer submission, was cancelled or the engine closed
+// instead.
+func (e *Engine) awaitQuietPeriod(ctx context.Context, run *pipeline.Run, quiet *quietRun) bool {
+	if quiet == nil {
+		return true
+	}
+	period := time.Duration(run.Spec.Debounce)
+
+	log := e.logger.WithField("pipeline_id", run.ID)
+	run.Reason = fmt.Sprintf("waiting %s for newer submissions to debounce", period)
+	if err := e.store.SaveRun(e.ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record run")
+	}
+
+	by, ok := e.quiet.wait(ctx, run, quiet, e.clock.NewTimer(period))
+	if ok {
+		run.Reason = ""
+		return true
+	}
+	if e.ctx.Err() != nil {
+		return false
+	}
+	now := e.clock.Now().UTC()
+	run.FinishedAt = &now
+	if by != "" {
+		run.Status = pipeline.StatusDebounced
+		run.Reason = fmt.Sprintf("superseded by run %s within the debounce period of %s", by, period)
+		metrics.RunsDebounced.Inc()
+		log.WithField("superseded_by", by).Info("Pipeline debounced by a newer submission")
+	} else {
+		run.Status = pipeline.StatusCancelled
+		run.Reason = "cancelled while waiting for its debounce period"
+	}
+	if err := e.store.SaveRun(e.ctx, run); err != nil {
+		log.WithError(err).Error("Failed to record run")
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+const debounceSpec = `
+name: build
+repo: github.com/org/app
+branch: main
+debounce: 100ms
+stages:
+- name: compile
+  image: golang:1.22
+`
+
+// waitTerminal waits for the run to finish and returns its final state.
+func waitTerminal(t *testing.T, e *Engine, id string) *pipeline.Run {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run, err := e.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if run.Status.Terminal() {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s never finished, last %s", id, run.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDebounceRunsOnlyTheLatestSubmission(t *testing.T) {
+	runner := &paramsRunner{params: make(chan map[string]string, 10)}
+	e, _ := newTestEngine(runner)
+	defer e.Close()
+
+	var ids []string
+	for _, commit := range []string{"a1", "b2", "c3"} {
+		run, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(debounceSpec), Commit: commit})
+		if err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+		ids = append(ids, run.ID)
+	}
+	// Another branch is another concurrency group.
+	other, err := e.Submit(context.Background(), SubmitRequest{Spec: []byte(debounceSpec), Branch: "dev"})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	for _, id := range ids[:2] {
+		run := waitTerminal(t, e, id)
+		if run.Status != pipeline.StatusDebounced || !strings.Contains(run.Reason, "superseded by run") || run.StartedAt != nil {
+			t.Errorf("run %s = %s %q, want debounced without starting", run.Spec.Commit, run.Status, run.Reason)
+		}
+	}
+	if run := waitTerminal(t, e, ids[2]); run.Status != pipeline.StatusSucceeded || run.Spec.Commit != "c3" {
+		t.Errorf("latest run = %s at %s, want succeeded at c3", run.Status, run.Spec.Commit)
+	}
+	if run := waitTerminal(t, e, other.ID); run.Status != pipeline.StatusSucceeded {
+		t.Errorf("run on dev = %s, want succeeded", run.Status)
+	}
+	if n := len(runner.params); n != 2 {
+		t.Errorf("started %d jobs, want 2", n)
+	}
+}
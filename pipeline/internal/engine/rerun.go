@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// ErrRunNotFinished is returned by Rerun for runs that have not finished.
+var ErrRunNotFinished = perrors.New(perrors.ErrConflict, "run has not finished")
+
+// RerunRequest asks for a finished run to be run again.
+type RerunRequest struct {
+	ID string
+	// FailedOnly reuses the results of the stages that succeeded instead of
+	// running them again, when the run allows it.
+	FailedOnly bool
+	// TriggeredBy names the user or system asking for the rerun. It
+	// defaults to that of the original run.
+	TriggeredBy string
+}
+
+// RerunResult is the outcome of a rerun.
+type RerunResult struct {
+	Run *pipeline.Run
+	// FullRerunReason says why a failed-only rerun runs every stage.
+	FullRerunReason string
+}
+
+// Rerun submits a fresh run of a finished run's stored definition with the
+// same params, linked to it by RerunOf. A failed-only rerun reuses the
+// results of the stages that succeeded, so only the stages that failed or
+// never ran run again; finally stages and the post-run hook always run.
+// When the run has no such stages the rerun runs every stage, and the
+// result says why. The submission is admitted like any other.
+func (e *Engine) Rerun(ctx context.Context, req RerunRequest) (*RerunResult, error) {
+	orig, err := e.store.GetRun(ctx, req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !orig.Status.Terminal() {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFinished, orig.Status)
+	}
+	spec, err := json.Marshal(orig.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode run spec: %w", err)
+	}
+
+	sub := SubmitRequest{
+		Spec:        spec,
+		Params:      orig.Spec.Params,
+		TriggeredBy: req.TriggeredBy,
+		RerunOf:     orig.ID,
+	}
+	if sub.TriggeredBy == "" {
+		sub.TriggeredBy = orig.TriggeredBy
+	}
+	var reason string
+	if req.FailedOnly {
+		sub.ReusedStages, reason = reusableStages(orig)
+	}
+	run, err := e.Submit(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := "full"
+	if len(run.ReusedStages) > 0 {
+		mode = "failed_only"
+	}
+	metrics.Reruns.WithLabelValues(mode).Inc()
+	log := logging.FromContext(ctx, e.logger).WithFields(logrus.Fields{
+		"pipeline_id": run.ID,
+		"rerun_of":    orig.ID,
+		"reused":      len(run.ReusedStages),
+	})
+	if reason != "" {
+		log = log.WithField("full_rerun_reason", reason)
+	}
+	log.Info("Pipeline rerun submitted")
+	return &RerunResult{Run: run, FullRerunReason: reason}, nil
+}
+
+// reusableStages returns the results of the stages of run that succeeded,
+// or why a failed-only rerun of it has to run every stage. Stages only run
+// once the stages they depend on succeeded, so the stages returned never
+// depend on one that runs again.
+func reusableStages(run *pipeline.Run) ([]pipeline.StageResult, string) {
+	if run.Status.Successful() {
+		return nil, "the run succeeded, so no stage failed"
+	}
+	if len(run.Stages) != len(run.Spec.Stages) {
+		return nil, "the run recorded no stage results"
+	}
+	var reused []pipeline.StageResult
+	for _, st := range run.Stages {
+		if st.Status.Successful() {
+			reused = append(reused, st)
+		}
+	}
+	if len(reused) == 0 {
+		return nil, "no stage of the run succeeded"
+	}
+	if len(reused) == len(run.Stages) {
+		return nil, "every stage of the run succeeded"
+	}
+	return reused, ""
+}
@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// flakyRunner fails the jobs of the stages named in fail, and records the
+// stages it ran.
+type flakyRunner struct {
+	mu   sync.Mutex
+	fail map[string]bool
+	ran  []string
+}
+
+func (r *flakyRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ran = append(r.ran, job.Stage.Name)
+	if r.fail[job.Stage.Name] {
+		return errors.New("connection reset by peer")
+	}
+	return nil
+}
+
+func (r *flakyRunner) reset(fail map[string]bool) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ran := r.ran
+	r.ran, r.fail = nil, fail
+	return ran
+}
+
+const rerunSpec = `
+name: build
+params: {target: linux}
+stages:
+- name: compile
+  image: golang:1.22
+- name: test
+  image: golang:1.22
+  depends_on: [compile]
+- name: package
+  image: golang:1.22
+  depends_on: [test]
+`
+
+func TestRerunFailedOnlyReusesSucceededStages(t *testing.T) {
+	runner := &flakyRunner{fail: map[string]bool{"test": true}}
+	e, _ := newTestEngine(runner)
+	defer e.Close()
+	ctx := context.Background()
+
+	orig, err := e.Submit(ctx, SubmitRequest{Spec: []byte(rerunSpec), Params: map[string]string{"target": "arm64"}, TriggeredBy: "alice"})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if got := waitTerminal(t, e, orig.ID); got.Status != pipeline.StatusFailed {
+		t.Fatalf("original run status = %s, want Failed", got.Status)
+	}
+	runner.reset(nil)
+
+	res, err := e.Rerun(ctx, RerunRequest{ID: orig.ID, FailedOnly: true})
+	if err != nil {
+		t.Fatalf("Rerun() error = %v", err)
+	}
+	if res.FullRerunReason != "" {
+		t.Errorf("FullRerunReason = %q, want a failed-only rerun", res.FullRerunReason)
+	}
+	rerun := waitTerminal(t, e, res.Run.ID)
+	if rerun.Status != pipeline.StatusSucceeded || rerun.RerunOf != orig.ID || rerun.TriggeredBy != "alice" {
+		t.Errorf("rerun = %s, rerun_of %q, triggered by %q", rerun.Status, rerun.RerunOf, rerun.TriggeredBy)
+	}
+	if rerun.Spec.Params["target"] != "arm64" {
+		t.Errorf("rerun params = %v, want the original's", rerun.Spec.Params)
+	}
+	if ran := runner.reset(nil); !slices.Equal(ran, []string{"test", "package"}) {
+		t.Errorf("rerun ran stages %v, want test and package", ran)
+	}
+	if rerun.Stages[0].Status != pipeline.StatusSucceeded {
+		t.Errorf("reused compile stage = %s", rerun.Stages[0].Status)
+	}
+
+	// Nothing failed in the rerun, so a failed-only rerun of it runs it all.
+	res, err = e.Rerun(ctx, RerunRequest{ID: rerun.ID, FailedOnly: true})
+	if err != nil {
+		t.Fatalf("Rerun() error = %v", err)
+	}
+	if res.FullRerunReason == "" || len(res.Run.ReusedStages) != 0 {
+		t.Errorf("rerun of a succeeded run = %+v, want a full rerun", res)
+	}
+	waitTerminal(t, e, res.Run.ID)
+	if ran := runner.reset(nil); len(ran) != 3 {
+		t.Errorf("full rerun ran stages %v", ran)
+	}
+}
+
+func TestRerunRefusesUnfinishedRuns(t *testing.T) {
+	e, runs := newTestEngine(&flakyRunner{})
+	defer e.Close()
+	if err := runs.SaveRun(context.Background(), &pipeline.Run{ID: "run-1", Status: pipeline.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Rerun(context.Background(), RerunRequest{ID: "run-1"}); !errors.Is(err, ErrRunNotFinished) {
+		t.Errorf("Rerun() of a running run error = %v, want ErrRunNotFinished", err)
+	}
+}
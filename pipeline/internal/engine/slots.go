@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"context"
+	"sync"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// Scheduling modes.
+const (
+	// SchedulingFIFO grants run slots in submission order.
+	SchedulingFIFO = "fifo"
+	// SchedulingFair grants run slots round-robin across tenants, in
+	// submission order within each tenant, so one tenant's burst cannot
+	// starve the others.
+	SchedulingFair = "fair"
+)
+
+// slots bounds how many runs execute at once on this replica. Runs waiting
+// for a slot queue per tenant; in FIFO mode every run shares one tenant.
+type slots struct {
+	fair        bool
+	tenantLabel string
+
+	mu sync.Mutex
+	// limit is the number of slots; zero or less means unlimited. Running
+	// runs are counted either way so the limit can change at any time.
+	limit   int
+	running int
+	queues  map[string][]*slotWaiter
+	// tenants is the round-robin order of the tenants with waiters; next
+	// is the position of the tenant served next.
+	tenants []string
+	next    int
+}
+
+type slotWaiter struct {
+	granted chan struct{}
+}
+
+// newSlots returns slots of the given limit; zero or less is unlimited.
+func newSlots(limit int, mode, tenantLabel string) *slots {
+	return &slots{
+		limit:       limit,
+		fair:        mode == SchedulingFair,
+		tenantLabel: tenantLabel,
+		queues:      make(map[string][]*slotWaiter),
+	}
+}
+
+// tenant returns the tenant runs of spec are scheduled as: the tenant label
+// when set, otherwise the repo.
+func (s *slots) tenant(spec *pipeline.Spec) string {
+	if !s.fair {
+		return ""
+	}
+	return s.tenantOf(spec)
+}
+
+// tenantOf returns the tenant of spec whatever the scheduling mode.
+func (s *slots) tenantOf(spec *pipeline.Spec) string {
+	if t := spec.Labels[s.tenantLabel]; s.tenantLabel != "" && t != "" {
+		return t
+	}
+	return spec.Repo
+}
+
+// setLimit changes the number of slots. Raising it grants the new slots to
+// waiters at once; lowering it lets the runs holding slots finish.
+func (s *slots) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.grantLocked()
+}
+
+// Load is how busy the run slots of a replica are.
+type Load struct {
+	// Running is the number of runs holding a slot.
+	Running int `json:"running"`
+	// Queued is the number of runs waiting for one.
+	Queued int `json:"queued"`
+	// Slots is the number of slots; zero means unlimited.
+	Slots int `json:"slots"`
+}
+
+// load returns the runs holding and waiting for a slot.
+func (s *slots) load() Load {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := Load{Running: s.running, Queued: s.queuedLocked(), Slots: s.limit}
+	if l.Slots < 0 {
+		l.Slots = 0
+	}
+	return l
+}
+
+// capacity returns the current limit.
+func (s *slots) capacity() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+func (s *slots) freeLocked() bool {
+	return s.limit <= 0 || s.running < s.limit
+}
+
+// tryAcquire takes a slot when one is free and nobody is waiting for it.
+func (s *slots) tryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.freeLocked() && len(s.tenants) == 0 {
+		s.running++
+		s.observeLocked()
+		return true
+	}
+	return false
+}
+
+// acquire waits for a slot for a run of spec. It fails with ctx's error when
+// ctx is done first, leaving no slot taken.
+func (s *slots) acquire(ctx context.Context, spec *pipeline.Spec) error {
+	if s.tryAcquire() {
+		return nil
+	}
+
+	tenant := s.tenant(spec)
+	w := &slotWaiter{granted: make(chan struct{})}
+	s.mu.Lock()
+	if len(s.queues[tenant]) == 0 {
+		s.tenants = append(s.tenants, tenant)
+	}
+	s.queues[tenant] = append(s.queues[tenant], w)
+	s.grantLocked()
+	s.mu.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-w.granted:
+		// Granted while giving up: hand the slot on.
+		s.running--
+		s.grantLocked()
+	default:
+		s.removeLocked(tenant, w)
+	}
+	return ctx.Err()
+}
+
+// release frees a slot taken by acquire.
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.grantLocked()
+}
+
+// grantLocked hands free slots to waiters, taking the first waiter of each
+// tenant in turn.
+func (s *slots) grantLocked() {
+	for s.freeLocked() && len(s.tenants) > 0 {
+		if s.next >= len(s.tenants) {
+			s.next = 0
+		}
+		tenant := s.tenants[s.next]
+		queue := s.queues[tenant]
+		w := queue[0]
+		if len(queue) == 1 {
+			delete(s.queues, tenant)
+			s.tenants = append(s.tenants[:s.next], s.tenants[s.next+1:]...)
+		} else {
+			s.queues[tenant] = queue[1:]
+			s.next++
+		}
+		s.running++
+		close(w.granted)
+	}
+	s.observeLocked()
+}
+
+func (s *slots) removeLocked(tenant string, w *slotWaiter) {
+	queue := s.queues[tenant]
+	for i, q := range queue {
+		if q != w {
+			continue
+		}
+		queue = append(queue[:i], queue[i+1:]...)
+		break
+	}
+	defer s.observeLocked()
+	if len(queue) > 0 {
+		s.queues[tenant] = queue
+		return
+	}
+	delete(s.queues, tenant)
+	for i, t := range s.tenants {
+		if t != tenant {
+			continue
+		}
+		s.tenants = append(s.tenants[:i], s.tenants[i+1:]...)
+		if i < s.next {
+			s.next--
+		}
+		break
+	}
+}
+
+// observeLocked publishes the number of runs holding and waiting for a
+// slot.
+func (s *slots) observeLocked() {
+	metrics.RunSlotsActive.Set(float64(s.running))
+	metrics.RunSlotsQueued.Set(float64(s.queuedLocked()))
+}
+
+func (s *slots) queuedLocked() int {
+	queued := 0
+	for _, q := range s.queues {
+		queued += len(q)
+	}
+	return queued
+}
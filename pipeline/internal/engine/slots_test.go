@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// grantOrder queues one run per spec behind a held slot and returns the
+// order they were granted in as the slot is released again and again.
+func grantOrder(t *testing.T, s *slots, specs []pipeline.Spec) []string {
+	t.Helper()
+	if !s.tryAcquire() {
+		t.Fatal("first slot not free")
+	}
+
+	granted := make(chan string, len(specs))
+	for i := range specs {
+		spec := &specs[i]
+		go func() {
+			if err := s.acquire(context.Background(), spec); err != nil {
+				t.Error(err)
+			}
+			granted <- spec.Name
+		}()
+		waitQueued(t, s, i+1)
+	}
+
+	var order []string
+	for range specs {
+		s.release()
+		select {
+		case name := <-granted:
+			order = append(order, name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no run granted a slot")
+		}
+	}
+	return order
+}
+
+func waitQueued(t *testing.T, s *slots, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		queued := 0
+		for _, q := range s.queues {
+			queued += len(q)
+		}
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d runs queued, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func burst() []pipeline.Spec {
+	return []pipeline.Spec{
+		{Name: "a1", Repo: "org/a"},
+		{Name: "a2", Repo: "org/a"},
+		{Name: "a3", Repo: "org/a"},
+		{Name: "b1", Repo: "org/b"},
+		{Name: "c1", Repo: "org/a", Labels: map[string]string{"tenant": "c"}},
+	}
+}
+
+func TestFairSlotsRoundRobinAcrossTenants(t *testing.T) {
+	got := grantOrder(t, newSlots(1, SchedulingFair, "tenant"), burst())
+	want := []string{"a1", "b1", "c1", "a2", "a3"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("grant order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFIFOSlotsFollowSubmissionOrder(t *testing.T) {
+	got := grantOrder(t, newSlots(1, SchedulingFIFO, "tenant"), burst())
+	want := []string{"a1", "a2", "a3", "b1", "c1"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("grant order = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSlotWaiterGivesUpOnCancel(t *testing.T) {
+	s := newSlots(1, SchedulingFair, "")
+	s.tryAcquire()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.acquire(ctx, &pipeline.Spec{Repo: "org/a"}) }()
+	waitQueued(t, s, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("acquire() = %v, want context.Canceled", err)
+	}
+
+	s.release()
+	if !s.tryAcquire() {
+		t.Fatal("slot still held after the only waiter gave up")
+	}
+}
+
+func TestRaisingSlotLimitGrantsWaiters(t *testing.T) {
+	s := newSlots(1, SchedulingFIFO, "")
+	s.tryAcquire()
+
+	done := make(chan error, 1)
+	go func() { done <- s.acquire(context.Background(), &pipeline.Spec{Repo: "org/a"}) }()
+	waitQueued(t, s, 1)
+
+	s.setLimit(2)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter not granted the new slot")
+	}
+
+	s.setLimit(0)
+	if !s.tryAcquire() {
+		t.Fatal("unlimited slots refused a run")
+	}
+}
+
+func TestSlotGaugesTrackActiveAndQueuedRuns(t *testing.T) {
+	s := newSlots(1, SchedulingFIFO, "")
+	s.tryAcquire()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.acquire(ctx, &pipeline.Spec{Repo: "org/a"}) }()
+	waitQueued(t, s, 1)
+	if active, queued := testutil.ToFloat64(metrics.RunSlotsActive), testutil.ToFloat64(metrics.RunSlotsQueued); active != 1 || queued != 1 {
+		t.Errorf("active = %v, queued = %v, want 1 and 1", active, queued)
+	}
+
+	cancel()
+	<-done
+	s.release()
+	if active, queued := testutil.ToFloat64(metrics.RunSlotsActive), testutil.ToFloat64(metrics.RunSlotsQueued); active != 0 || queued != 0 {
+		t.Errorf("after cancel and release: active = %v, queued = %v, want 0 and 0", active, queued)
+	}
+}
+
+func TestSlotLoadCountsRunningAndQueuedRuns(t *testing.T) {
+	s := newSlots(1, SchedulingFair, "")
+	s.tryAcquire()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 2)
+	for _, repo := range []string{"org/a", "org/b"} {
+		repo := repo
+		go func() { done <- s.acquire(ctx, &pipeline.Spec{Repo: repo}) }()
+	}
+	waitQueued(t, s, 2)
+	if got, want := s.load(), (Load{Running: 1, Queued: 2, Slots: 1}); got != want {
+		t.Errorf("load() = %+v, want %+v", got, want)
+	}
+
+	cancel()
+	<-done
+	<-done
+	s.setLimit(-1)
+	if got, want := s.load(), (Load{Running: 1}); got != want {
+		t.Errorf("load() with unlimited slots = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/lock"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// TenantSelector picks the runs of a tenant. Every field set must match;
+// at least one must be set.
+type TenantSelector struct {
+	// Tenant matches the value of the tenant label, or the repo of runs
+	// without one, as scheduling groups them.
+	Tenant string `json:"tenant,omitempty"`
+	// Repo matches the spec's repo.
+	Repo string `json:"repo,omitempty"`
+}
+
+// ErrEmptySelector is returned for a TenantSelector that sets no field.
+var ErrEmptySelector = perrors.New(perrors.ErrInvalidArgument, "tenant selector must set tenant or repo")
+
+func (s TenantSelector) String() string {
+	var parts []string
+	if s.Tenant != "" {
+		parts = append(parts, "tenant "+s.Tenant)
+	}
+	if s.Repo != "" {
+		parts = append(parts, "repo "+s.Repo)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TenantPause is a selector whose submissions are refused.
+type TenantPause struct {
+	TenantSelector
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+}
+
+// TenantPausedError is returned by Submit for a run matching a paused
+// selector.
+type TenantPausedError struct {
+	Pause TenantPause
+}
+
+func (e *TenantPausedError) Error() string {
+	msg := fmt.Sprintf("admission is paused for %s", e.Pause.TenantSelector)
+	if e.Pause.Reason != "" {
+		msg += ": " + e.Pause.Reason
+	}
+	return msg
+}
+
+// tenantPauses holds the paused selectors of this replica.
+type tenantPauses struct {
+	mu     sync.Mutex
+	pauses []TenantPause
+}
+
+// add pauses p's selector, replacing an earlier pause of the same one.
+func (t *tenantPauses) add(p TenantPause) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.pauses {
+		if t.pauses[i].TenantSelector == p.TenantSelector {
+			t.pauses[i] = p
+			return
+		}
+	}
+	t.pauses = append(t.pauses, p)
+}
+
+// remove resumes sel and reports whether it was paused.
+func (t *tenantPauses) remove(sel TenantSelector) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.pauses {
+		if t.pauses[i].TenantSelector == sel {
+			t.pauses = append(t.pauses[:i], t.pauses[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the pauses sorted by selector.
+func (t *tenantPauses) list() []TenantPause {
+	t.mu.Lock()
+	pauses := append([]TenantPause{}, t.pauses...)
+	t.mu.Unlock()
+	sort.Slice(pauses, func(i, j int) bool {
+		if pauses[i].Tenant != pauses[j].Tenant {
+			return pauses[i].Tenant < pauses[j].Tenant
+		}
+		return pauses[i].Repo < pauses[j].Repo
+	})
+	return pauses
+}
+
+// matching returns the pause covering a run of tenant and spec, if any.
+func (t *tenantPauses) matching(tenant string, spec *pipeline.Spec) (TenantPause, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.pauses {
+		if p.matches(tenant, spec.Repo) {
+			return p, true
+		}
+	}
+	return TenantPause{}, false
+}
+
+func (s TenantSelector) matches(tenant, repo string) bool {
+	return (s.Tenant == "" || s.Tenant == tenant) && (s.Repo == "" || s.Repo == repo)
+}
+
+// activeRun is a run queued or executing on this replica.
+type activeRun struct {
+	cancel context.CancelFunc
+	fence  *runFence
+	tenant string
+	repo   string
+	// release frees the run's slot once it holds one; nil while queued.
+	release func()
+	// lease is the run's deduplication lock; nil without one.
+	lease *lock.Lease
+}
+
+// stop cancels the run and frees its slot.
+func (a activeRun) stop() {
+	a.cancel()
+	if a.release != nil {
+		a.release()
+	}
+}
+
+// PauseTenant refuses the submissions matching sel on this replica from now
+// on, with reason, until ResumeTenant. With cancelRunning, the matching runs
+// queued or executing here are cancelled too; it returns how many were.
+// Other tenants are unaffected.
+func (e *Engine) PauseTenant(sel TenantSelector, reason string, cancelRunning bool) (int, error) {
+	if sel == (TenantSelector{}) {
+		return 0, ErrEmptySelector
+	}
+	e.pauses.add(TenantPause{TenantSelector: sel, Reason: reason, Since: e.clock.Now().UTC()})
+
+	cancelled := 0
+	if cancelRunning {
+		e.mu.Lock()
+		for id, a := range e.active {
+			if sel.matches(a.tenant, a.repo) {
+				e.logger.WithFields(logrus.Fields{"pipeline_id": id, "selector": sel.String()}).Warn("Cancelling pipeline of paused tenant")
+				a.stop()
+				cancelled++
+			}
+		}
+		e.mu.Unlock()
+	}
+	e.logger.WithFields(logrus.Fields{
+		"selector":  sel.String(),
+		"reason":    reason,
+		"cancelled": cancelled,
+	}).Warn("Paused admission for tenant")
+	return cancelled, nil
+}
+
+// ResumeTenant admits the submissions matching sel again and reports
+// whether it was paused.
+func (e *Engine) ResumeTenant(sel TenantSelector) bool {
+	if !e.pauses.remove(sel) {
+		return false
+	}
+	e.logger.WithField("selector", sel.String()).Info("Resumed admission for tenant")
+	return true
+}
+
+// PausedTenants returns the tenants paused on this replica.
+func (e *Engine) PausedTenants() []TenantPause {
+	return e.pauses.list()
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+const tenantSpec = `
+name: build
+repo: %s
+labels:
+  team: %s
+stages:
+- name: compile
+  image: golang:1.21
+`
+
+func TestPauseTenantRefusesAndCancelsOnlyItsRuns(t *testing.T) {
+	runner := &blockingRunner{started: make(chan struct{}, 2)}
+	e, runs := newTestEngine(runner)
+	e.slots.tenantLabel = "team"
+	defer e.Close()
+
+	ctx := context.Background()
+	submit := func(repo, team string) (*pipeline.Run, error) {
+		return e.Submit(ctx, SubmitRequest{Spec: []byte(fmt.Sprintf(tenantSpec, repo, team))})
+	}
+	payments, err := submit("org/payments", "payments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	search, err := submit("org/search", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-runner.started
+	<-runner.started
+
+	cancelled, err := e.PauseTenant(TenantSelector{Tenant: "payments"}, "incident 42", true)
+	if err != nil || cancelled != 1 {
+		t.Fatalf("PauseTenant() = %d, %v, want 1 run cancelled", cancelled, err)
+	}
+	var paused *TenantPausedError
+	if _, err := submit("org/payments", "payments"); !errors.As(err, &paused) || paused.Pause.Reason != "incident 42" {
+		t.Fatalf("Submit() for paused tenant error = %v, want TenantPausedError", err)
+	}
+	if _, err := submit("org/search", "search"); err != nil {
+		t.Fatalf("Submit() for another tenant error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, _ := runs.GetRun(ctx, payments.ID)
+		if got.Status == pipeline.StatusCancelled {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("paused tenant's run status = %s, want Cancelled", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, _ := runs.GetRun(ctx, search.ID); got.Status.Terminal() {
+		t.Errorf("other tenant's run status = %s, want still running", got.Status)
+	}
+
+	if got := e.PausedTenants(); len(got) != 1 || got[0].Tenant != "payments" {
+		t.Errorf("PausedTenants() = %+v", got)
+	}
+	if !e.ResumeTenant(TenantSelector{Tenant: "payments"}) {
+		t.Fatal("ResumeTenant() = false")
+	}
+	if _, err := submit("org/payments", "payments"); err != nil {
+		t.Fatalf("Submit() after resume error = %v", err)
+	}
+	if _, err := e.PauseTenant(TenantSelector{}, "", false); !errors.Is(err, ErrEmptySelector) {
+		t.Errorf("PauseTenant() with empty selector error = %v", err)
+	}
+}
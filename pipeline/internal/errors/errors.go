@@ -0,0 +1,117 @@
+// Package errors defines the kinds of error the pipeline service reports to
+// its clients, and maps them to gRPC codes and HTTP statuses so both APIs
+// answer a failure alike.
+//
+// Packages give their errors a kind by wrapping them with Wrap or creating
+// them with New; errors.Is(err, ErrNotFound) then holds for them and for
+// every error wrapping them. Errors without a kind are internal.
+package errors
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The kinds of error.
+var (
+	// ErrNotFound is the kind of errors for a resource that does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidArgument is the kind of errors for a request that is wrong
+	// whatever the state of the service.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrConflict is the kind of errors for a request the current state of
+	// its resource does not allow.
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable is the kind of errors for a request that may succeed
+	// if retried later.
+	ErrUnavailable = errors.New("unavailable")
+	// ErrUnauthenticated is the kind of errors for a request without valid
+	// credentials.
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// kinds lists the kinds of error with the gRPC code and HTTP status each
+// is answered with.
+var kinds = []struct {
+	kind error
+	code codes.Code
+	http int
+}{
+	{ErrNotFound, codes.NotFound, http.StatusNotFound},
+	{ErrInvalidArgument, codes.InvalidArgument, http.StatusBadRequest},
+	{ErrConflict, codes.FailedPrecondition, http.StatusConflict},
+	{ErrUnavailable, codes.Unavailable, http.StatusServiceUnavailable},
+	{ErrUnauthenticated, codes.Unauthenticated, http.StatusUnauthorized},
+}
+
+// kindError gives err a kind while keeping its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// Wrap returns err with the given kind, one of the Err kinds of this
+// package. It returns nil for a nil err.
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// New returns an error of the given kind with text for message.
+func New(kind error, text string) error {
+	return Wrap(kind, errors.New(text))
+}
+
+// Kind returns the kind of err, or nil for an internal error.
+func Kind(err error) error {
+	for _, k := range kinds {
+		if errors.Is(err, k.kind) {
+			return k.kind
+		}
+	}
+	return nil
+}
+
+// Code returns the gRPC code err is answered with: the code of a gRPC
+// status error, Canceled or DeadlineExceeded for context errors, the code
+// of err's kind, or Internal.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	}
+	for _, k := range kinds {
+		if errors.Is(err, k.kind) {
+			return k.code
+		}
+	}
+	return codes.Internal
+}
+
+// HTTPStatus returns the HTTP status err is answered with: the status of
+// err's kind, or 500.
+func HTTPStatus(err error) int {
+	for _, k := range kinds {
+		if errors.Is(err, k.kind) {
+			return k.http
+		}
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,44 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCodeAndHTTPStatusFollowKind(t *testing.T) {
+	notFound := New(ErrNotFound, "run not found")
+	for _, tc := range []struct {
+		err  error
+		code codes.Code
+		http int
+	}{
+		{notFound, codes.NotFound, http.StatusNotFound},
+		{fmt.Errorf("failed to get run: %w", notFound), codes.NotFound, http.StatusNotFound},
+		{Wrap(ErrInvalidArgument, errors.New("bad spec")), codes.InvalidArgument, http.StatusBadRequest},
+		{New(ErrConflict, "run has not finished"), codes.FailedPrecondition, http.StatusConflict},
+		{New(ErrUnavailable, "store down"), codes.Unavailable, http.StatusServiceUnavailable},
+		{New(ErrUnauthenticated, "token expired"), codes.Unauthenticated, http.StatusUnauthorized},
+		{errors.New("boom"), codes.Internal, http.StatusInternalServerError},
+		{fmt.Errorf("call: %w", context.DeadlineExceeded), codes.DeadlineExceeded, http.StatusInternalServerError},
+		{status.Error(codes.AlreadyExists, "dup"), codes.AlreadyExists, http.StatusInternalServerError},
+	} {
+		if got := Code(tc.err); got != tc.code {
+			t.Errorf("Code(%v) = %s, want %s", tc.err, got, tc.code)
+		}
+		if got := HTTPStatus(tc.err); got != tc.http {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", tc.err, got, tc.http)
+		}
+	}
+	if notFound.Error() != "run not found" || Kind(notFound) != ErrNotFound || Kind(errors.New("boom")) != nil {
+		t.Errorf("New() = %q of kind %v", notFound, Kind(notFound))
+	}
+	if Wrap(ErrNotFound, nil) != nil {
+		t.Error("Wrap(nil) != nil")
+	}
+}
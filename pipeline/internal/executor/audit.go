@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+// AIAuditor keeps the raw AI exchanges of runs for
+// ai_service.audit_payloads. It is satisfied by *store.SQL.
+type AIAuditor interface {
+	SaveAIExchange(ctx context.Context, runID string, x pipeline.AIExchange) error
+}
+
+// auditContext returns ctx with the AI calls made under it recorded as
+// exchanges of run, when there is an AIAuditor. An exchange that cannot be
+// recorded is logged and otherwise ignored: auditing never fails a run.
+func (e *Executor) auditContext(ctx context.Context, run *pipeline.Run) context.Context {
+	if e.aiAudit == nil {
+		return ctx
+	}
+	// The exchange of a call cut short by cancellation is still recorded.
+	saveCtx := context.WithoutCancel(ctx)
+	return ai.WithAudit(ctx, func(x pipeline.AIExchange) {
+		if err := e.aiAudit.SaveAIExchange(saveCtx, run.ID, x); err != nil {
+			logging.FromContext(saveCtx, e.logger).WithError(err).Warn("Failed to record AI exchange")
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+// maxParamValueLen caps propagated parameter values so one long value cannot
+// bloat every span and log line of a run.
+const maxParamValueLen = 256
+
+// runContext attaches the run identity and the allowlisted spec parameters
+// to ctx as log fields and span attributes.
+func (e *Executor) runContext(ctx context.Context, run *pipeline.Run) context.Context {
+	fields := logrus.Fields{"pipeline_id": run.ID}
+	if run.RequestID != "" {
+		fields["request_id"] = run.RequestID
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("pipeline.id", run.ID),
+		attribute.String("pipeline.name", run.Spec.Name),
+	}
+	fields, attrs = e.appendParams(fields, attrs, run.Spec.Params)
+
+	ctx = logging.WithFields(ctx, fields)
+	return tracing.WithAttributes(ctx, attrs...)
+}
+
+// jobContext adds the job identity and its allowlisted matrix values, which
+// override run-level parameters of the same name.
+func (e *Executor) jobContext(ctx context.Context, job pipeline.Job) context.Context {
+	fields := logrus.Fields{"stage": job.Stage.Name, "job": job.DisplayName()}
+	attrs := []attribute.KeyValue{
+		attribute.String("pipeline.stage", job.Stage.Name),
+		attribute.String("pipeline.job", job.DisplayName()),
+	}
+	fields, attrs = e.appendParams(fields, attrs, job.Matrix)
+
+	ctx = logging.WithFields(ctx, fields)
+	return tracing.WithAttributes(ctx, attrs...)
+}
+
+func (e *Executor) appendParams(fields logrus.Fields, attrs []attribute.KeyValue, params map[string]string) (logrus.Fields, []attribute.KeyValue) {
+	for _, name := range e.propagated {
+		v, ok := params[name]
+		if !ok {
+			continue
+		}
+		if len(v) > maxParamValueLen {
+			v = v[:maxParamValueLen]
+		}
+		fields["param."+name] = v
+		attrs = append(attrs, attribute.String("pipeline.param."+name, v))
+	}
+	return fields, attrs
+}
+
+// sortedSet returns the distinct names in sorted order.
+func sortedSet(names []string) []string {
+	set := make(map[string]struct{}, len(names))
+	for _, n := range names {
+		if n != "" {
+			set[n] = struct{}{}
+		}
+	}
+	out := make([]string, 0, len(set))
+	for n := range set {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
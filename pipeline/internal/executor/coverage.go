@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// recordCoverage records the coverage reported by the spec's coverage stage
+// on run and, for a run that would succeed, applies the coverage gates. It
+// returns the status and reason the run ends with.
+func (e *Executor) recordCoverage(ctx context.Context, run *pipeline.Run, status pipeline.Status, reason string) (pipeline.Status, string) {
+	c := run.Spec.Coverage
+	if c == nil {
+		return status, reason
+	}
+	cov, ok := pipeline.StageCoverage(run, c.Stage)
+	if !ok {
+		if status == pipeline.StatusSucceeded {
+			e.Warn(run.ID, fmt.Sprintf("coverage not recorded: stage %s reported none", c.Stage))
+		}
+		return status, reason
+	}
+	run.Coverage = &cov
+	metrics.PipelineCoverage.WithLabelValues(metrics.PipelineLabel(run.Spec.Name)).Set(cov)
+	if status != pipeline.StatusSucceeded {
+		return status, reason
+	}
+
+	if c.Min > 0 && cov < c.Min {
+		return pipeline.StatusFailed, fmt.Sprintf("coverage %.1f%% is below coverage.min of %.1f%%", cov, c.Min)
+	}
+	if c.MaxDrop > 0 {
+		if base, baseRun := e.coverageBaseline(ctx, run); baseRun != "" && base-cov > c.MaxDrop {
+			return pipeline.StatusFailed, fmt.Sprintf("coverage %.1f%% dropped %.1f points from %.1f%% in run %s, more than coverage.max_drop of %.1f", cov, base-cov, base, baseRun, c.MaxDrop)
+		}
+	}
+	return status, reason
+}
+
+// coverageBaseline returns the coverage of the last succeeded run of run's
+// pipeline on its branch, with that run's ID, or an empty ID when there is
+// none among the recent runs.
+func (e *Executor) coverageBaseline(ctx context.Context, run *pipeline.Run) (float64, string) {
+	for _, r := range e.recentRuns(ctx, run) {
+		if r.Status == pipeline.StatusSucceeded && r.Spec.Branch == run.Spec.Branch && r.Coverage != nil {
+			return *r.Coverage, r.ID
+		}
+	}
+	logging.FromContext(ctx, e.logger).Info("No coverage baseline for this branch, skipping coverage.max_drop")
+	return 0, ""
+}
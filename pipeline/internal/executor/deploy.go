@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/argocd"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// Deployer syncs ArgoCD applications and watches their health, rolling
+// them back when they degrade. It is satisfied by *argocd.Client.
+type Deployer interface {
+	SyncAndWait(ctx context.Context, name string, req argocd.SyncRequest) (*argocd.Application, error)
+	WatchHealth(ctx context.Context, name string, window time.Duration) <-chan argocd.HealthEvent
+}
+
+// deploy syncs the spec's ArgoCD application for a run whose stages
+// succeeded and records the outcome on run.Deploy. It returns the status
+// and reason the run ends with: a failed or timed-out deploy fails the
+// run, and cancelling the run while it deploys cancels it. Without a
+// Deployer the deploy is skipped with a warning.
+func (e *Executor) deploy(ctx context.Context, run *pipeline.Run, fence Fence) (pipeline.Status, string, error) {
+	d := run.Spec.Deploy
+	if e.deployer == nil {
+		run.Deploy = &pipeline.DeployResult{Application: d.Application, Status: pipeline.StatusSkipped, Message: "argocd is not configured"}
+		metrics.ArgoCDSyncs.WithLabelValues("skipped").Inc()
+		e.Warn(run.ID, fmt.Sprintf("deploy of application %s skipped: argocd is not configured", d.Application))
+		return pipeline.StatusSucceeded, "", nil
+	}
+	log := logging.FromContext(ctx, e.logger).WithField("application", d.Application)
+	now := e.clock.Now().UTC()
+	run.Deploy = &pipeline.DeployResult{
+		Application: d.Application,
+		Status:      pipeline.StatusRunning,
+		Revision:    d.SyncRevision(run),
+		StartedAt:   &now,
+	}
+	if err := e.save(ctx, run, fence); err != nil {
+		return "", "", err
+	}
+
+	log.Info("Syncing ArgoCD application")
+	app, err := e.deployer.SyncAndWait(ctx, d.Application, argocd.SyncRequest{Revision: run.Deploy.Revision, Prune: d.Prune})
+	finished := e.clock.Now().UTC()
+	run.Deploy.FinishedAt = &finished
+	if app != nil {
+		run.Deploy.SyncStatus = app.Status.Sync.Status
+		run.Deploy.HealthStatus = app.Status.Health.Status
+		if app.Status.Sync.Revision != "" {
+			run.Deploy.Revision = app.Status.Sync.Revision
+		}
+	}
+
+	result := "succeeded"
+	switch {
+	case err == nil:
+		run.Deploy.Status = pipeline.StatusSucceeded
+	case ctx.Err() != nil:
+		run.Deploy.Status = pipeline.StatusCancelled
+		run.Deploy.Message = "cancelled"
+		log.Info("Pipeline cancelled while waiting for the ArgoCD application")
+		return pipeline.StatusCancelled, "", nil
+	case errors.Is(err, argocd.ErrSyncTimeout):
+		result = "timed_out"
+		run.Deploy.Status = pipeline.StatusTimedOut
+	default:
+		result = "failed"
+		run.Deploy.Status = pipeline.StatusFailed
+	}
+	metrics.ArgoCDSyncs.WithLabelValues(result).Inc()
+	log = log.WithFields(logrus.Fields{
+		"sync_status":   run.Deploy.SyncStatus,
+		"health_status": run.Deploy.HealthStatus,
+		"revision":      run.Deploy.Revision,
+	})
+	if err != nil {
+		run.Deploy.Message = err.Error()
+		log.WithError(err).Error("ArgoCD application deploy failed")
+		return pipeline.StatusFailed, fmt.Sprintf("deploy of application %s failed: %v", d.Application, err), nil
+	}
+	log.Info("ArgoCD application synced and healthy")
+	if e.healthWatch <= 0 {
+		return pipeline.StatusSucceeded, "", nil
+	}
+	return e.watchHealth(ctx, run, fence, log)
+}
+
+// watchHealth follows the health of the application run deployed for the
+// health watch window, recording changes on run.Deploy. A run whose
+// application was rolled back fails.
+func (e *Executor) watchHealth(ctx context.Context, run *pipeline.Run, fence Fence, log *logrus.Entry) (pipeline.Status, string, error) {
+	d := run.Deploy
+	if err := e.save(ctx, run, fence); err != nil {
+		return "", "", err
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	log.WithField("window", e.healthWatch).Info("Watching ArgoCD application health")
+
+	for ev := range e.deployer.WatchHealth(watchCtx, d.Application, e.healthWatch) {
+		if ev.Err != nil {
+			log.WithError(ev.Err).Warn("Failed to check ArgoCD application health")
+			continue
+		}
+		rb := ev.Rollback
+		if ev.Health != d.HealthStatus {
+			d.HealthStatus = ev.Health
+			log.WithField("health_status", ev.Health).Info("ArgoCD application health changed")
+			if rb == nil {
+				if err := e.save(ctx, run, fence); err != nil {
+					return "", "", err
+				}
+			}
+		}
+		if rb == nil {
+			continue
+		}
+
+		d.Status = pipeline.StatusFailed
+		d.Rollback = &pipeline.DeployRollback{Status: pipeline.StatusSucceeded, From: rb.From, To: rb.To, At: e.clock.Now().UTC()}
+		reason := fmt.Sprintf("application %s stayed %s after the deploy and was rolled back from %s to %s", d.Application, ev.Health, rb.From, rb.To)
+		result := "succeeded"
+		if rb.Err != nil {
+			result = "failed"
+			d.Rollback.Status = pipeline.StatusFailed
+			d.Rollback.Message = rb.Err.Error()
+			reason = fmt.Sprintf("application %s stayed %s after the deploy and could not be rolled back: %v", d.Application, ev.Health, rb.Err)
+		}
+		metrics.ArgoCDRollbacks.WithLabelValues(result).Inc()
+		d.Message = reason
+		return pipeline.StatusFailed, reason, nil
+	}
+	if ctx.Err() != nil {
+		return pipeline.StatusCancelled, "", nil
+	}
+	return pipeline.StatusSucceeded, "", nil
+}
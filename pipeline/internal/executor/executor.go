@@ -0,0 +1,916 @@
+// Package executor runs a pipeline's stages in dependency order.
+//
+// Stages form a DAG through depends_on. A stage starts once every stage it
+// depends on has succeeded and is skipped if any of them did not. Matrix
+// stages fan out into one job per combination; how many of those run at once
+// is bounded both by the matrix's max_parallel and by the pipeline-wide
+// parallelism limit. Finally stages run once every stage has finished,
+// whatever its outcome, and the post-run hook runs last, even for cancelled
+// runs.
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/devmind-pipeline/pipeline/internal/artifacts"
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/credentials"
+	"github.com/devmind-pipeline/pipeline/internal/healthcheck"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+// revokeTimeout bounds how long revoking a pipeline credential may take once
+// the run is over.
+const revokeTimeout = 30 * time.Second
+
+// DefaultPostRunTimeout bounds each job of a post-run hook that sets no
+// timeout of its own. The hook outlives cancellation of the run, so it is
+// never left unbounded.
+const DefaultPostRunTimeout = 10 * time.Minute
+
+// DefaultHealthCheckTimeout bounds a health_check stage that sets no timeout
+// of its own, so an endpoint that never comes up cannot hold the run
+// forever.
+const DefaultHealthCheckTimeout = 10 * time.Minute
+
+// ErrCached is returned by a Runner when the job's result was served from
+// cache without executing. The job counts as successful.
+var ErrCached = errors.New("job satisfied from cache")
+
+// Runner executes a single job, typically as a Tekton TaskRun, and blocks
+// until it finishes. A nil error means the job succeeded.
+type Runner interface {
+	RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error
+}
+
+// Recorder persists run state as execution progresses.
+type Recorder interface {
+	SaveRun(ctx context.Context, run *pipeline.Run) error
+}
+
+// Fence guards mutations of shared run state. It is satisfied by
+// lock.Lease: once the lease is lost, Check fails and the executor stops
+// touching the run so that a stale replica cannot overwrite the new owner's
+// progress.
+type Fence interface {
+	Check(ctx context.Context) error
+}
+
+// Options configures an Executor. Runner and Logger are required.
+type Options struct {
+	Runner Runner
+	// Recorder may be nil when run state does not need to be persisted.
+	Recorder Recorder
+	// Credentials mints the pipeline-scoped credential requested by a spec.
+	// Nil disables the feature.
+	Credentials credentials.Provider
+	// PropagatedParams lists the spec and matrix parameters attached to the
+	// run's spans and log lines. Parameters not listed are never propagated.
+	PropagatedParams []string
+	// HealthChecks sends the requests of health_check stages. Nil uses
+	// http.DefaultClient.
+	HealthChecks *http.Client
+	// Artifacts holds the result files parsed for stages with a
+	// result_parser. Nil disables result parsing.
+	Artifacts artifacts.Store
+	// Replica is recorded on every run executed here; see
+	// server.advertise_address.
+	Replica string
+	// Tests selects the tests of test_selection stages. Nil runs their
+	// whole suite.
+	Tests TestSelector
+	// Predictions predicts whether each run will fail as it starts. Nil
+	// skips failure prediction.
+	Predictions FailurePredictor
+	// BlockThreshold is the predicted failure probability above which a
+	// run is not started but ends as PredictedFailure. Zero never blocks.
+	BlockThreshold float64
+	// Optimizer advises on the build of each run as it starts, suggesting
+	// the build caches of its stages. Nil skips build optimization.
+	Optimizer BuildOptimizer
+	// AIAudit records the raw exchanges of the AI calls a run makes. Nil
+	// records none.
+	AIAudit AIAuditor
+	// History provides the past runs whose results are sent with test
+	// selection, failure prediction and build optimization requests. Nil
+	// sends none.
+	History History
+	// Deployer syncs the ArgoCD application of specs with a deploy. Nil
+	// skips their deploys with a warning.
+	Deployer Deployer
+	// HealthWatchWindow is how long the health of a deployed application
+	// is watched after the sync, the run still running, for the Deployer
+	// to roll it back if it degrades. Zero does not watch.
+	HealthWatchWindow time.Duration
+	// Clock stamps run, stage and job times. Nil uses the wall clock.
+	Clock  clock.Clock
+	Logger *logrus.Logger
+}
+
+// Executor runs pipeline DAGs.
+type Executor struct {
+	runner      Runner
+	recorder    Recorder
+	credentials credentials.Provider
+	propagated  []string
+	health      *http.Client
+	artifacts   artifacts.Store
+	replica     string
+	tests       TestSelector
+	predictions FailurePredictor
+	blockAbove  float64
+	optimizer   BuildOptimizer
+	aiAudit     AIAuditor
+	history     History
+	deployer    Deployer
+	healthWatch time.Duration
+	clock       clock.Clock
+	logger      *logrus.Logger
+
+	// warnings holds the warnings not yet recorded for every run executing
+	// here; see Warn.
+	warnMu   sync.Mutex
+	warnings map[string][]string
+}
+
+// New creates an Executor from opts.
+func New(opts Options) *Executor {
+	return &Executor{
+		runner:      opts.Runner,
+		recorder:    opts.Recorder,
+		credentials: opts.Credentials,
+		propagated:  sortedSet(opts.PropagatedParams),
+		health:      opts.HealthChecks,
+		artifacts:   opts.Artifacts,
+		replica:     opts.Replica,
+		tests:       opts.Tests,
+		predictions: opts.Predictions,
+		blockAbove:  opts.BlockThreshold,
+		optimizer:   opts.Optimizer,
+		aiAudit:     opts.AIAudit,
+		history:     opts.History,
+		deployer:    opts.Deployer,
+		healthWatch: opts.HealthWatchWindow,
+		clock:       clock.Or(opts.Clock),
+		logger:      opts.Logger,
+		warnings:    make(map[string][]string),
+	}
+}
+
+// Warn adds msg to the warnings of the run if it is executing here, to be
+// recorded with its next state change, and reports whether it was.
+func (e *Executor) Warn(runID, msg string) bool {
+	e.warnMu.Lock()
+	defer e.warnMu.Unlock()
+	pending, ok := e.warnings[runID]
+	if !ok {
+		return false
+	}
+	e.warnings[runID] = append(pending, msg)
+	return true
+}
+
+// takeWarnings moves the pending warnings of run onto it.
+func (e *Executor) takeWarnings(run *pipeline.Run) {
+	e.warnMu.Lock()
+	defer e.warnMu.Unlock()
+	if pending := e.warnings[run.ID]; len(pending) > 0 {
+		run.Warnings = append(run.Warnings, pending...)
+		e.warnings[run.ID] = nil
+	}
+}
+
+// untrack stops accepting warnings for run and records those that arrived
+// after its final state.
+func (e *Executor) untrack(ctx context.Context, run *pipeline.Run, fence Fence) {
+	e.warnMu.Lock()
+	pending := e.warnings[run.ID]
+	delete(e.warnings, run.ID)
+	e.warnMu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	run.Warnings = append(run.Warnings, pending...)
+	if err := e.save(ctx, run, fence); err != nil {
+		logging.FromContext(ctx, e.logger).WithError(err).Error("Failed to record run warnings")
+	}
+}
+
+type jobEvent struct {
+	stage   int
+	job     int
+	started bool
+	err     error
+	at      time.Time
+	results *pipeline.Results
+	// retries counts the runs of the job after its first.
+	retries int
+}
+
+type stageState struct {
+	jobs      []pipeline.Job
+	started   bool
+	finished  bool
+	remaining int
+	failedJob string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    semaphore
+	// span covers the stage from its start until its last job finishes.
+	span trace.Span
+}
+
+// phase is a set of stages executed as one DAG: first the spec's stages,
+// then its finally stages, then its post-run hook.
+type phase struct {
+	stages  []pipeline.Stage
+	results []pipeline.StageResult
+	states  []*stageState
+	index   map[string]int
+	total   int
+	finally bool
+	postRun bool
+}
+
+func newPhase(stages []pipeline.Stage, finally bool) *phase {
+	p := &phase{
+		stages:  stages,
+		results: make([]pipeline.StageResult, len(stages)),
+		states:  make([]*stageState, len(stages)),
+		index:   make(map[string]int, len(stages)),
+		finally: finally,
+	}
+	for i := range stages {
+		st := &stages[i]
+		jobs := st.Jobs()
+		p.states[i] = &stageState{jobs: jobs, remaining: len(jobs)}
+		p.index[st.Name] = i
+		p.total += len(jobs)
+
+		results := make([]pipeline.JobResult, len(jobs))
+		for j, job := range jobs {
+			results[j] = pipeline.JobResult{
+				ID:     job.ID,
+				Name:   job.DisplayName(),
+				Matrix: job.Matrix,
+				Status: pipeline.StatusPending,
+			}
+		}
+		p.results[i] = pipeline.StageResult{Name: st.Name, Status: pipeline.StatusPending, Jobs: results}
+	}
+	return p
+}
+
+// reuse records the given results of a rerun's original run as those of
+// the stages of the same name, which are then never started.
+func (p *phase) reuse(results []pipeline.StageResult) {
+	for _, r := range results {
+		i, ok := p.index[r.Name]
+		if !ok {
+			continue
+		}
+		r.Jobs = append([]pipeline.JobResult(nil), r.Jobs...)
+		p.results[i] = r
+		p.states[i].started, p.states[i].finished = true, true
+	}
+}
+
+// Execute runs every stage of run and then its finally stages, and records
+// the outcome on it. fence may be nil; when set, it is checked before each
+// state change is persisted and execution is abandoned with its error if the
+// check fails.
+//
+// Finally stages run whatever the outcome of the stages, unless the run is
+// cancelled. A failing finally stage fails an otherwise successful run with
+// a reason naming it, so it is never mistaken for a stage failure.
+//
+// The post-run hook runs after both, cancelled runs included, detached from
+// the run's cancellation and bounded by its own timeout. Its result is
+// reported on the run but never changes the run's status.
+func (e *Executor) Execute(ctx context.Context, run *pipeline.Run, fence Fence) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e.warnMu.Lock()
+	e.warnings[run.ID] = nil
+	e.warnMu.Unlock()
+	defer e.untrack(ctx, run, fence)
+
+	ctx, span := tracing.Tracer().Start(tracing.WithTraceParent(e.runContext(ctx, run), run.TraceParent), "pipeline.run")
+	ctx = e.auditContext(ctx, run)
+	defer func() {
+		if run.Status != pipeline.StatusSucceeded {
+			span.SetStatus(codes.Error, string(run.Status))
+		}
+		span.End()
+	}()
+
+	spec := &run.Spec
+	log := logging.FromContext(ctx, e.logger)
+
+	if e.predictFailure(ctx, run) {
+		now := e.clock.Now().UTC()
+		run.Status = pipeline.StatusPredictedFailure
+		run.Reason = fmt.Sprintf("not started: predicted failure probability %.2f exceeds ai_service.failure_block_threshold (%.2f)", run.Prediction.Probability, e.blockAbove)
+		run.FinishedAt = &now
+		log.WithField("reason", run.Reason).Warn("Pipeline blocked by failure prediction")
+		return e.save(ctx, run, fence)
+	}
+
+	now := e.clock.Now().UTC()
+	run.Status = pipeline.StatusRunning
+	run.StartedAt = &now
+	run.Replica = e.replica
+	stages := newPhase(e.optimizeBuild(ctx, run, e.selectTests(ctx, run)), false)
+	stages.reuse(run.ReusedStages)
+	run.Stages = stages.results
+	var finally *phase
+	if len(spec.Finally) > 0 {
+		finally = newPhase(spec.Finally, true)
+		run.Finally = finally.results
+	}
+	var post *phase
+	if spec.PostRun != nil {
+		hook := *spec.PostRun
+		if hook.Timeout <= 0 {
+			hook.Timeout = pipeline.Duration(DefaultPostRunTimeout)
+		}
+		post = newPhase([]pipeline.Stage{hook}, false)
+		post.postRun = true
+		run.PostRun = &post.results[0]
+	}
+	if err := e.save(ctx, run, fence); err != nil {
+		return err
+	}
+
+	cred, err := e.mintCredential(ctx, run)
+	if err != nil {
+		log.WithError(err).Error("Failed to mint pipeline credential")
+		e.failRun(run, fmt.Sprintf("failed to mint pipeline credential: %v", err))
+		return e.save(ctx, run, fence)
+	}
+	var secrets map[string]string
+	if cred != nil {
+		// Deferred so the credential is revoked however the run ends,
+		// including fence failures and cancellation.
+		defer e.revokeCredential(ctx, run, cred)
+		secrets = cred.Env
+	}
+
+	global := newSemaphore(spec.Parallelism)
+	unresolved, err := e.runPhase(ctx, run, stages, secrets, global, fence, log)
+	if err != nil {
+		return err
+	}
+	if finally != nil {
+		if ctx.Err() != nil {
+			for i := range finally.results {
+				skipStage(&finally.results[i], "pipeline was cancelled")
+			}
+		} else {
+			log.Info("Running finally stages")
+			if _, err := e.runPhase(ctx, run, finally, secrets, global, fence, log); err != nil {
+				return err
+			}
+		}
+	}
+
+	// The outcome is settled before the post-run hook so the hook cannot
+	// change it, but applied after so the run is not reported finished
+	// while its teardown is still running.
+	status, reason := outcome(ctx, run, unresolved)
+	status, reason = e.recordCoverage(ctx, run, status, reason)
+	if status == pipeline.StatusSucceeded {
+		observeBuildTime(run, e.clock.Now().Sub(*run.StartedAt))
+	}
+	if status == pipeline.StatusSucceeded && run.Spec.Deploy != nil {
+		if status, reason, err = e.deploy(ctx, run, fence); err != nil {
+			return err
+		}
+	}
+	if post != nil {
+		// The hook outlives cancellation, so make sure the run is still ours
+		// to tear down before starting it.
+		if err := e.checkFence(ctx, run, fence); err != nil {
+			return err
+		}
+		log.Info("Running post-run hook")
+		if _, err := e.runPhase(context.WithoutCancel(ctx), run, post, secrets, newSemaphore(0), fence, log); err != nil {
+			return err
+		}
+		if !run.PostRun.Status.Successful() {
+			log.WithField("post_run_status", run.PostRun.Status).Warn("Post-run hook did not succeed")
+		}
+	}
+
+	finished := e.clock.Now().UTC()
+	run.FinishedAt = &finished
+	run.Status = status
+	if reason != "" {
+		run.Reason = reason
+	}
+	log.WithField("status", run.Status).Info("Pipeline finished")
+	return e.save(ctx, run, fence)
+}
+
+// outcome derives the status of run from its stages and finally stages,
+// with the reason to record when one is needed.
+func outcome(ctx context.Context, run *pipeline.Run, unresolved bool) (pipeline.Status, string) {
+	status := pipeline.StatusSucceeded
+	for _, st := range run.Stages {
+		if st.Status == pipeline.StatusFailed || st.Status == pipeline.StatusTimedOut {
+			status = pipeline.StatusFailed
+			break
+		}
+		if st.Status == pipeline.StatusCancelled {
+			status = pipeline.StatusCancelled
+		}
+	}
+	if ctx.Err() != nil {
+		return pipeline.StatusCancelled, ""
+	}
+	if unresolved && status == pipeline.StatusSucceeded {
+		return pipeline.StatusFailed, "unresolvable stage dependencies"
+	}
+	if status == pipeline.StatusSucceeded {
+		for _, st := range run.Finally {
+			if !st.Status.Successful() {
+				return pipeline.StatusFailed, fmt.Sprintf("finally stage %s did not succeed", st.Name)
+			}
+		}
+	}
+	return status, ""
+}
+
+// runPhase runs the stages of p until none is left to start and reports
+// whether some could never start because their dependencies can never be
+// satisfied.
+func (e *Executor) runPhase(ctx context.Context, run *pipeline.Run, p *phase, secrets map[string]string, global semaphore, fence Fence, log *logrus.Entry) (unresolved bool, err error) {
+	// Buffered for every possible event so job goroutines never block on an
+	// executor that has returned early.
+	events := make(chan jobEvent, 2*p.total)
+	active := 0
+	// An early return leaves stages running; their spans end with it.
+	defer func() {
+		for _, s := range p.states {
+			if s.span != nil && !s.finished {
+				s.span.End()
+			}
+		}
+	}()
+
+	for {
+		for progressed := true; progressed; {
+			progressed = false
+			for i, s := range p.states {
+				if s.started {
+					continue
+				}
+				ready, blocked := p.dependencies(i)
+				switch {
+				case blocked:
+					s.started, s.finished = true, true
+					skipStage(&p.results[i], "upstream stage did not succeed")
+					progressed = true
+				case ready:
+					s.started = true
+					e.startStage(ctx, run, p, i, secrets, global, events)
+					p.results[i].Status = pipeline.StatusRunning
+					active++
+				}
+			}
+		}
+
+		if active == 0 {
+			break
+		}
+		if err := e.save(ctx, run, fence); err != nil {
+			return false, err
+		}
+
+		ev := <-events
+		s := p.states[ev.stage]
+		stage := &p.stages[ev.stage]
+		result := &p.results[ev.stage].Jobs[ev.job]
+		at := ev.at
+
+		if ev.started {
+			result.Status = pipeline.StatusRunning
+			result.StartedAt = &at
+			continue
+		}
+
+		result.FinishedAt = &at
+		result.Results = ev.results
+		result.Retries = ev.retries
+		switch {
+		case ev.err == nil:
+			result.Status = pipeline.StatusSucceeded
+		case errors.Is(ev.err, ErrCached):
+			result.Status = pipeline.StatusCached
+		case errors.Is(ev.err, errJobTimeout):
+			result.Status = pipeline.StatusTimedOut
+			result.Message = fmt.Sprintf("exceeded stage timeout of %s", jobTimeout(stage))
+			if detail := strings.TrimPrefix(ev.err.Error(), errJobTimeout.Error()); detail != "" {
+				result.Message += detail
+			}
+			result.ErrorClass = pipeline.ErrorClassTimeout
+			s.noteFailure(result.Name, stage.Matrix, log)
+		case s.ctx.Err() != nil:
+			result.Status = pipeline.StatusCancelled
+			if s.failedJob != "" {
+				result.Message = fmt.Sprintf("cancelled by fail_fast after %s failed", s.failedJob)
+			} else {
+				result.Message = "cancelled"
+			}
+		default:
+			result.Status = pipeline.StatusFailed
+			result.Message = ev.err.Error()
+			result.ErrorClass = errorClass(ev.err)
+			s.noteFailure(result.Name, stage.Matrix, log)
+		}
+		log.WithFields(logrus.Fields{
+			"stage":    stage.Name,
+			"finally":  p.finally,
+			"post_run": p.postRun,
+			"job":      result.Name,
+			"status":   result.Status,
+		}).Info("Job finished")
+		recordJob(stage.Name, *result)
+
+		s.remaining--
+		if s.remaining == 0 {
+			s.finished = true
+			s.cancel()
+			p.results[ev.stage].Status = stageStatus(p.results[ev.stage].Jobs)
+			recordStage(p.results[ev.stage])
+			endStageSpan(s.span, p.results[ev.stage].Status)
+			active--
+		}
+	}
+
+	// Stages that never became ready sit on a dependency cycle or reference
+	// a stage that does not exist.
+	for i, s := range p.states {
+		if !s.started {
+			unresolved = true
+			skipStage(&p.results[i], "dependencies can never be satisfied")
+		}
+	}
+	return unresolved, nil
+}
+
+func (e *Executor) startStage(ctx context.Context, run *pipeline.Run, p *phase, i int, secrets map[string]string, global semaphore, events chan<- jobEvent) {
+	stage := &p.stages[i]
+	s := p.states[i]
+	ctx, s.span = tracing.Tracer().Start(ctx, "pipeline.stage", trace.WithAttributes(attribute.String("pipeline.stage", stage.Name)))
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	if stage.Matrix != nil {
+		s.sem = newSemaphore(stage.Matrix.MaxParallel)
+	}
+
+	for j, job := range s.jobs {
+		job.Secrets = secrets
+		job.Finally = p.finally
+		job.PostRun = p.postRun
+		go func(j int, job pipeline.Job) {
+			ev := jobEvent{stage: i, job: j}
+
+			// Take the matrix slot before the pipeline-wide one so a
+			// throttled matrix never holds global capacity while waiting.
+			if err := s.sem.acquire(s.ctx); err != nil {
+				ev.err, ev.at = err, e.clock.Now().UTC()
+				events <- ev
+				return
+			}
+			defer s.sem.release()
+			if err := global.acquire(s.ctx); err != nil {
+				ev.err, ev.at = err, e.clock.Now().UTC()
+				events <- ev
+				return
+			}
+			defer global.release()
+
+			events <- jobEvent{stage: i, job: j, started: true, at: e.clock.Now().UTC()}
+			jobCtx, span := tracing.Tracer().Start(e.jobContext(s.ctx, job), "pipeline.job")
+			ev.retries, ev.err = e.runAttempts(jobCtx, run, job)
+			if ev.err != nil && !errors.Is(ev.err, ErrCached) {
+				span.SetStatus(codes.Error, ev.err.Error())
+			}
+			span.End()
+			ev.at = e.clock.Now().UTC()
+			// Failed jobs are parsed too: their results say what failed.
+			if s.ctx.Err() == nil && !errors.Is(ev.err, ErrCached) && !errors.Is(ev.err, errJobTimeout) {
+				ev.results = e.parseResults(s.ctx, run, job)
+			}
+			events <- ev
+		}(j, job)
+	}
+}
+
+// runAttempts runs job, and again after each failure its stage's retry
+// policy retries, up to the policy's attempts. It returns the number of
+// retries and the last error.
+func (e *Executor) runAttempts(ctx context.Context, run *pipeline.Run, job pipeline.Job) (int, error) {
+	for {
+		err := e.runJob(ctx, run, job)
+		if err == nil || errors.Is(err, ErrCached) || ctx.Err() != nil || job.Stage.Retry == nil || job.Attempt >= job.Stage.Retry.Attempts {
+			return job.Attempt, err
+		}
+		class := errorClass(err)
+		if !job.Stage.Retry.Retries(class) {
+			return job.Attempt, err
+		}
+		job.Attempt++
+		metrics.JobRetries.WithLabelValues(metrics.StageLabel(job.Stage.Name), class).Inc()
+		logging.FromContext(ctx, e.logger).WithError(err).WithFields(logrus.Fields{
+			"job":         job.ID,
+			"error_class": class,
+			"attempt":     job.Attempt,
+		}).Warn("Job failed, retrying")
+	}
+}
+
+// errorClass classifies the failure of a job: stage timeouts are enforced
+// here, everything else is classified by the runner.
+func errorClass(err error) string {
+	if errors.Is(err, errJobTimeout) {
+		return pipeline.ErrorClassTimeout
+	}
+	return pipeline.ErrorClass(err)
+}
+
+// runJob runs a job under its stage timeout. Exceeding the timeout is
+// reported as errJobTimeout so it is not confused with cancellation of the
+// whole stage.
+func (e *Executor) runJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	timeout := jobTimeout(job.Stage)
+	if timeout <= 0 {
+		return e.dispatch(ctx, run, job)
+	}
+
+	jobCtx, cancel := context.WithTimeoutCause(ctx, timeout, errJobTimeout)
+	defer cancel()
+	err := e.dispatch(jobCtx, run, job)
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(jobCtx), errJobTimeout) {
+		if job.Stage.HealthCheck != nil {
+			// Keep the last check's outcome: it says why the endpoint
+			// never became healthy.
+			return fmt.Errorf("%w: %v", errJobTimeout, err)
+		}
+		return errJobTimeout
+	}
+	return err
+}
+
+// dispatch runs health_check jobs in-process and every other job on the
+// runner.
+func (e *Executor) dispatch(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	if hc := job.Stage.HealthCheck; hc != nil {
+		return healthcheck.Wait(ctx, e.health, hc)
+	}
+	return e.runner.RunJob(ctx, run, job)
+}
+
+// jobTimeout returns the timeout each job of stage runs under, zero meaning
+// none.
+func jobTimeout(stage *pipeline.Stage) time.Duration {
+	if stage.Timeout <= 0 && stage.HealthCheck != nil {
+		return DefaultHealthCheckTimeout
+	}
+	return time.Duration(stage.Timeout)
+}
+
+var errJobTimeout = errors.New("job timed out")
+
+// noteFailure remembers the first failing job of a stage and applies the
+// matrix fail_fast policy.
+func (s *stageState) noteFailure(job string, m *pipeline.Matrix, log *logrus.Entry) {
+	if s.failedJob != "" {
+		return
+	}
+	s.failedJob = job
+	if m != nil && m.FailFast {
+		log.WithField("job", job).Info("Matrix job failed, cancelling remaining combinations")
+		s.cancel()
+	}
+}
+
+// mintCredential mints the credential requested by the spec, if any.
+func (e *Executor) mintCredential(ctx context.Context, run *pipeline.Run) (*credentials.Credential, error) {
+	if run.Spec.Credential == nil {
+		return nil, nil
+	}
+	if e.credentials == nil {
+		return nil, fmt.Errorf("spec requests a credential but no credentials provider is configured")
+	}
+
+	cred, err := e.credentials.Mint(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	logging.FromContext(ctx, e.logger).WithField("credential_id", cred.ID).Info("Minted pipeline credential")
+	return cred, nil
+}
+
+func (e *Executor) revokeCredential(ctx context.Context, run *pipeline.Run, cred *credentials.Credential) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revokeTimeout)
+	defer cancel()
+
+	log := logging.FromContext(ctx, e.logger).WithField("credential_id", cred.ID)
+	if err := e.credentials.Revoke(ctx, cred); err != nil {
+		log.WithError(err).Error("Failed to revoke pipeline credential")
+		return
+	}
+	log.Info("Revoked pipeline credential")
+}
+
+func (e *Executor) failRun(run *pipeline.Run, reason string) {
+	now := e.clock.Now().UTC()
+	run.Status = pipeline.StatusFailed
+	run.Reason = reason
+	run.FinishedAt = &now
+	for i := range run.Stages {
+		skipStage(&run.Stages[i], "pipeline did not start")
+	}
+	for i := range run.Finally {
+		skipStage(&run.Finally[i], "pipeline did not start")
+	}
+	if run.PostRun != nil {
+		skipStage(run.PostRun, "pipeline did not start")
+	}
+}
+
+func skipStage(st *pipeline.StageResult, reason string) {
+	st.Status = pipeline.StatusSkipped
+	for j := range st.Jobs {
+		st.Jobs[j].Status = pipeline.StatusSkipped
+		st.Jobs[j].Message = reason
+	}
+	recordStage(*st)
+}
+
+// stageOutcomes maps stage and job statuses to the outcome label of
+// metrics.StageTotal and metrics.StageDuration.
+var stageOutcomes = map[pipeline.Status]string{
+	pipeline.StatusSucceeded: "success",
+	pipeline.StatusFailed:    "failure",
+	pipeline.StatusSkipped:   "skipped",
+	pipeline.StatusCached:    "cached",
+	pipeline.StatusTimedOut:  "timed_out",
+	pipeline.StatusCancelled: "cancelled",
+}
+
+// endStageSpan ends the span of a finished stage, marking it failed unless
+// the stage succeeded.
+func endStageSpan(span trace.Span, status pipeline.Status) {
+	if !status.Successful() {
+		span.SetStatus(codes.Error, string(status))
+	}
+	span.End()
+}
+
+func recordStage(st pipeline.StageResult) {
+	if outcome, ok := stageOutcomes[st.Status]; ok {
+		metrics.StageTotal.WithLabelValues(metrics.StageLabel(st.Name), outcome).Inc()
+	}
+}
+
+// recordJob observes the duration of a finished job of stage. Jobs that
+// never started, such as those cancelled while waiting, are not observed.
+func recordJob(stage string, job pipeline.JobResult) {
+	outcome, ok := stageOutcomes[job.Status]
+	if !ok || job.StartedAt == nil || job.FinishedAt == nil {
+		return
+	}
+	metrics.StageDuration.WithLabelValues(metrics.StageLabel(stage), outcome).Observe(job.FinishedAt.Sub(*job.StartedAt).Seconds())
+}
+
+// save checks the fence and then persists a snapshot of the run.
+func (e *Executor) save(ctx context.Context, run *pipeline.Run, fence Fence) error {
+	if err := e.checkFence(ctx, run, fence); err != nil {
+		return err
+	}
+	if e.recorder == nil {
+		return nil
+	}
+	e.takeWarnings(run)
+	if err := e.recorder.SaveRun(context.WithoutCancel(ctx), run.Clone()); err != nil {
+		return fmt.Errorf("failed to save run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// checkFence fails once fence no longer lets this executor touch run.
+func (e *Executor) checkFence(ctx context.Context, run *pipeline.Run, fence Fence) error {
+	if fence == nil {
+		return nil
+	}
+	// Use a context that survives cancellation so the final state of a
+	// cancelled run can still be recorded.
+	if err := fence.Check(context.WithoutCancel(ctx)); err != nil {
+		logging.FromContext(ctx, e.logger).WithError(err).Error("Fence check failed, abandoning run")
+		return fmt.Errorf("run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// dependencies reports whether stage i can start (every dependency
+// succeeded) or never will (a dependency finished without succeeding, or
+// does not exist).
+func (p *phase) dependencies(i int) (ready, blocked bool) {
+	ready = true
+	for _, dep := range p.stages[i].DependsOn {
+		d, ok := p.index[dep]
+		if !ok {
+			return false, true
+		}
+		if !p.states[d].finished {
+			ready = false
+			continue
+		}
+		if !p.results[d].Status.Successful() {
+			return false, true
+		}
+	}
+	return ready, false
+}
+
+// stageStatus derives a stage's status from its jobs: any failure fails the
+// stage, then timeouts, then cancellations; a stage is cached only when every
+// job was.
+func stageStatus(jobs []pipeline.JobResult) pipeline.Status {
+	var failed, timedOut, cancelled bool
+	cached := len(jobs) > 0
+	for _, j := range jobs {
+		switch j.Status {
+		case pipeline.StatusFailed:
+			failed = true
+		case pipeline.StatusTimedOut:
+			timedOut = true
+		case pipeline.StatusCancelled, pipeline.StatusSkipped:
+			cancelled = true
+		}
+		if j.Status != pipeline.StatusCached {
+			cached = false
+		}
+	}
+	switch {
+	case failed:
+		return pipeline.StatusFailed
+	case timedOut:
+		return pipeline.StatusTimedOut
+	case cancelled:
+		return pipeline.StatusCancelled
+	case cached:
+		return pipeline.StatusCached
+	}
+	return pipeline.StatusSucceeded
+}
+
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore with n slots, or an unlimited one when n
+// is not positive.
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s == nil {
+		return nil
+	}
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
@@ -0,0 +1,1047 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/argocd"
+	"github.com/devmind-pipeline/pipeline/internal/artifacts"
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/credentials"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// fakeRunner runs jobs through fn and tracks peak concurrency.
+type fakeRunner struct {
+	fn func(ctx context.Context, job pipeline.Job) error
+
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func (f *fakeRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	f.mu.Lock()
+	f.current++
+	if f.current > f.peak {
+		f.peak = f.current
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.current--
+		f.mu.Unlock()
+	}()
+
+	if f.fn == nil {
+		return nil
+	}
+	return f.fn(ctx, job)
+}
+
+func newTestExecutor(r Runner) *Executor {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return New(Options{Runner: r, Logger: logger})
+}
+
+func sleepJob(d time.Duration) func(context.Context, pipeline.Job) error {
+	return func(ctx context.Context, job pipeline.Job) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func matrixSpec(m *pipeline.Matrix) pipeline.Spec {
+	m.Params = map[string][]string{"shard": {"1", "2", "3", "4", "5", "6"}}
+	return pipeline.Spec{
+		Name: "matrix",
+		Stages: []pipeline.Stage{
+			{Name: "test", Matrix: m},
+			{Name: "report", DependsOn: []string{"test"}},
+		},
+	}
+}
+
+func TestMatrixMaxParallel(t *testing.T) {
+	runner := &fakeRunner{fn: sleepJob(10 * time.Millisecond)}
+	run := &pipeline.Run{ID: "r", Spec: matrixSpec(&pipeline.Matrix{MaxParallel: 2})}
+
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != pipeline.StatusSucceeded {
+		t.Fatalf("status = %s", run.Status)
+	}
+	if runner.peak > 2 {
+		t.Fatalf("peak concurrency = %d, want <= 2", runner.peak)
+	}
+}
+
+func TestMatrixComposesWithPipelineParallelism(t *testing.T) {
+	runner := &fakeRunner{fn: sleepJob(10 * time.Millisecond)}
+	spec := matrixSpec(&pipeline.Matrix{MaxParallel: 4})
+	spec.Parallelism = 1
+	run := &pipeline.Run{ID: "r", Spec: spec}
+
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+	if runner.peak != 1 {
+		t.Fatalf("peak concurrency = %d, want 1", runner.peak)
+	}
+}
+
+func TestMatrixFailFastCancelsRemaining(t *testing.T) {
+	var started atomic.Int32
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		if started.Add(1) == 1 {
+			return errors.New("boom")
+		}
+		return sleepJob(time.Second)(ctx, job)
+	}}
+	run := &pipeline.Run{ID: "r", Spec: matrixSpec(&pipeline.Matrix{FailFast: true, MaxParallel: 2})}
+
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != pipeline.StatusFailed {
+		t.Fatalf("status = %s, want Failed", run.Status)
+	}
+
+	test := run.Stages[0]
+	var failed, cancelled int
+	for _, j := range test.Jobs {
+		switch j.Status {
+		case pipeline.StatusFailed:
+			failed++
+		case pipeline.StatusCancelled:
+			cancelled++
+		}
+	}
+	if failed != 1 || cancelled != 5 {
+		t.Fatalf("failed=%d cancelled=%d, want 1 and 5: %+v", failed, cancelled, test.Jobs)
+	}
+	// The failing job's slot may be picked up before cancellation lands, but
+	// the queued combinations must never start.
+	if started.Load() > 3 {
+		t.Fatalf("%d jobs started, fail_fast should have stopped queued ones", started.Load())
+	}
+	if run.Stages[1].Status != pipeline.StatusSkipped {
+		t.Fatalf("downstream status = %s, want Skipped", run.Stages[1].Status)
+	}
+}
+
+func TestMatrixWithoutFailFastRunsAll(t *testing.T) {
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		if job.Matrix["shard"] == "1" {
+			return errors.New("boom")
+		}
+		return nil
+	}}
+	run := &pipeline.Run{ID: "r", Spec: matrixSpec(&pipeline.Matrix{})}
+
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+	succeeded := 0
+	for _, j := range run.Stages[0].Jobs {
+		if j.Status == pipeline.StatusSucceeded {
+			succeeded++
+		}
+	}
+	if succeeded != 5 {
+		t.Fatalf("succeeded = %d, want 5", succeeded)
+	}
+}
+
+type lostFence struct{ calls int }
+
+func (f *lostFence) Check(context.Context) error {
+	f.calls++
+	if f.calls > 1 {
+		return errors.New("lock lost")
+	}
+	return nil
+}
+
+func TestFenceFailureAbandonsRun(t *testing.T) {
+	runner := &fakeRunner{fn: sleepJob(10 * time.Millisecond)}
+	run := &pipeline.Run{ID: "r", Spec: matrixSpec(&pipeline.Matrix{})}
+
+	err := newTestExecutor(runner).Execute(context.Background(), run, &lostFence{})
+	if err == nil {
+		t.Fatal("expected error after fence check failed")
+	}
+	if run.Status.Terminal() {
+		t.Fatalf("abandoned run must not be marked terminal, got %s", run.Status)
+	}
+}
+
+type fakeProvider struct {
+	revoked []string
+}
+
+func (p *fakeProvider) Mint(ctx context.Context, run *pipeline.Run) (*credentials.Credential, error) {
+	return &credentials.Credential{ID: "cred-1", Env: map[string]string{"REGISTRY_TOKEN": "s3cr3t"}}, nil
+}
+
+func (p *fakeProvider) Revoke(ctx context.Context, cred *credentials.Credential) error {
+	p.revoked = append(p.revoked, cred.ID)
+	return nil
+}
+
+func TestCredentialInjectedAndRevokedOnFailure(t *testing.T) {
+	var seen atomic.Value
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		seen.Store(job.Secrets["REGISTRY_TOKEN"])
+		return errors.New("boom")
+	}}
+	provider := &fakeProvider{}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := New(Options{Runner: runner, Credentials: provider, Logger: logger})
+
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Credential: &pipeline.CredentialRequest{Scope: "registry:push"},
+		Stages:     []pipeline.Stage{{Name: "push"}},
+	}}
+	if err := e.Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Status != pipeline.StatusFailed {
+		t.Fatalf("status = %s, want Failed", run.Status)
+	}
+	if seen.Load() != "s3cr3t" {
+		t.Fatalf("stage did not receive the credential")
+	}
+	if len(provider.revoked) != 1 || provider.revoked[0] != "cred-1" {
+		t.Fatalf("revoked = %v, want [cred-1]", provider.revoked)
+	}
+}
+
+func TestStageTimeoutAndCachedOutcomes(t *testing.T) {
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		if job.Stage.Name == "restore" {
+			return ErrCached
+		}
+		return sleepJob(time.Second)(ctx, job)
+	}}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Stages: []pipeline.Stage{
+		{Name: "restore"},
+		{Name: "slow-integration", DependsOn: []string{"restore"}, Timeout: pipeline.Duration(10 * time.Millisecond)},
+	}}}
+
+	timedOut := testutil.ToFloat64(metrics.StageTotal.WithLabelValues("slow-integration", "timed_out"))
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := run.Stages[0].Status; got != pipeline.StatusCached {
+		t.Errorf("restore status = %s, want Cached", got)
+	}
+	if got := run.Stages[1].Status; got != pipeline.StatusTimedOut {
+		t.Errorf("integration status = %s, want TimedOut", got)
+	}
+	if run.Status != pipeline.StatusFailed {
+		t.Errorf("run status = %s, want Failed", run.Status)
+	}
+	if got := testutil.ToFloat64(metrics.StageTotal.WithLabelValues("slow-integration", "timed_out")); got != timedOut+1 {
+		t.Errorf("timed_out counter = %v, want %v", got, timedOut+1)
+	}
+}
+
+func TestStageDurationObservesEachJob(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		clk.Advance(90 * time.Second)
+		return nil
+	}}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Stages: []pipeline.Stage{{Name: "timed-build"}}}}
+	if err := New(Options{Runner: runner, Clock: clk, Logger: logger}).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	observed := metrics.StageDuration.WithLabelValues("timed-build", "success").(prometheus.Histogram)
+	want := `
+# HELP devmind_pipeline_stage_duration_seconds Time pipeline stage jobs ran, by stage name and outcome.
+# TYPE devmind_pipeline_stage_duration_seconds histogram
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="1"} 0
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="5"} 0
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="15"} 0
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="30"} 0
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="60"} 0
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="120"} 1
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="300"} 1
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="600"} 1
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="900"} 1
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="1200"} 1
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="1800"} 1
+devmind_pipeline_stage_duration_seconds_bucket{stage="timed-build",status="success",le="+Inf"} 1
+devmind_pipeline_stage_duration_seconds_sum{stage="timed-build",status="success"} 90
+devmind_pipeline_stage_duration_seconds_count{stage="timed-build",status="success"} 1
+`
+	if err := testutil.CollectAndCompare(observed, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunSpansJoinTheSubmittersTrace(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	defer func(tp trace.TracerProvider) { otel.SetTracerProvider(tp) }(otel.GetTracerProvider())
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	run := &pipeline.Run{
+		ID:          "r",
+		TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		Spec:        pipeline.Spec{Stages: []pipeline.Stage{{Name: "build"}}},
+	}
+	if err := newTestExecutor(&fakeRunner{}).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	runSpan, stage, job := spans["pipeline.run"], spans["pipeline.stage"], spans["pipeline.job"]
+	if runSpan == nil || stage == nil || job == nil {
+		t.Fatalf("spans = %v, want a run, a stage and a job span", spans)
+	}
+	if got := runSpan.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("run trace ID = %s, want the submitter's", got)
+	}
+	if stage.Parent().SpanID() != runSpan.SpanContext().SpanID() || job.Parent().SpanID() != stage.SpanContext().SpanID() {
+		t.Error("want the job span under the stage span under the run span")
+	}
+}
+
+func TestAllowlistedParamsPropagateThroughContext(t *testing.T) {
+	var mu sync.Mutex
+	got := map[string]logrus.Fields{}
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		mu.Lock()
+		got[job.DisplayName()] = logging.Fields(ctx)
+		mu.Unlock()
+		return nil
+	}}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := New(Options{Runner: runner, Logger: logger, PropagatedParams: []string{"env", "shard"}})
+
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Name:   "p",
+		Params: map[string]string{"env": "staging", "token": "s3cret"},
+		Stages: []pipeline.Stage{
+			{Name: "test", Matrix: &pipeline.Matrix{Params: map[string][]string{"shard": {"1"}}}},
+		},
+	}}
+	if err := e.Execute(context.Background(), run, nil); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("jobs run = %d, want 1", len(got))
+	}
+	for name, fields := range got {
+		if fields["pipeline_id"] != "r" || fields["stage"] != "test" || fields["job"] != name {
+			t.Errorf("identity fields = %v", fields)
+		}
+		if fields["param.env"] != "staging" || fields["param.shard"] != "1" {
+			t.Errorf("allowlisted params missing: %v", fields)
+		}
+		if _, ok := fields["param.token"]; ok {
+			t.Errorf("non-allowlisted param leaked: %v", fields)
+		}
+	}
+}
+
+func TestFinallyStagesRunAfterFailure(t *testing.T) {
+	var finallyJobs atomic.Int32
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		switch job.Stage.Name {
+		case "deploy":
+			return errors.New("rollout stalled")
+		case "teardown":
+			if !job.Finally {
+				t.Errorf("teardown job not marked as finally")
+			}
+			finallyJobs.Add(1)
+		}
+		return nil
+	}}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Stages: []pipeline.Stage{
+			{Name: "deploy"},
+			{Name: "verify", DependsOn: []string{"deploy"}},
+		},
+		Finally: []pipeline.Stage{{Name: "teardown"}},
+	}}
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if finallyJobs.Load() != 1 {
+		t.Fatalf("teardown ran %d times, want once", finallyJobs.Load())
+	}
+	if len(run.Stages) != 2 || len(run.Finally) != 1 || run.Finally[0].Status != pipeline.StatusSucceeded {
+		t.Fatalf("stages = %+v, finally = %+v, want teardown reported separately as succeeded", run.Stages, run.Finally)
+	}
+	if run.Status != pipeline.StatusFailed || run.Reason != "" {
+		t.Fatalf("run = %s %q, want the stage failure without a finally reason", run.Status, run.Reason)
+	}
+}
+
+func TestFailingFinallyStageFailsRunWithReason(t *testing.T) {
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		if job.Finally {
+			return errors.New("namespace still terminating")
+		}
+		return nil
+	}}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Stages:  []pipeline.Stage{{Name: "build"}},
+		Finally: []pipeline.Stage{{Name: "cleanup"}},
+	}}
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Stages[0].Status != pipeline.StatusSucceeded {
+		t.Fatalf("build status = %s, want Succeeded", run.Stages[0].Status)
+	}
+	if run.Status != pipeline.StatusFailed || run.Reason != "finally stage cleanup did not succeed" {
+		t.Fatalf("run = %s %q, want failed by the finally stage", run.Status, run.Reason)
+	}
+}
+
+func TestPostRunHookRunsAfterCancellationWithoutChangingOutcome(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &fakeRunner{fn: func(jobCtx context.Context, job pipeline.Job) error {
+		if job.PostRun {
+			if jobCtx.Err() != nil {
+				t.Errorf("post-run hook started with a cancelled context")
+			}
+			if _, ok := jobCtx.Deadline(); !ok {
+				t.Errorf("post-run hook has no timeout")
+			}
+			return errors.New("lock already released")
+		}
+		cancel()
+		<-jobCtx.Done()
+		return jobCtx.Err()
+	}}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Stages:  []pipeline.Stage{{Name: "deploy"}},
+		Finally: []pipeline.Stage{{Name: "cleanup"}},
+		PostRun: &pipeline.Stage{Name: "release-lock"},
+	}}
+	if err := newTestExecutor(runner).Execute(ctx, run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.PostRun == nil || run.PostRun.Status != pipeline.StatusFailed {
+		t.Fatalf("post_run = %+v, want failed", run.PostRun)
+	}
+	if run.Finally[0].Status != pipeline.StatusSkipped {
+		t.Fatalf("finally status = %s, want Skipped for a cancelled run", run.Finally[0].Status)
+	}
+	if run.Status != pipeline.StatusCancelled || run.Reason != "" {
+		t.Fatalf("run = %s %q, want cancelled regardless of the hook", run.Status, run.Reason)
+	}
+}
+
+func TestHealthCheckStageRunsInEngine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		t.Errorf("health check job %s reached the runner", job.ID)
+		return nil
+	}}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Name: "deploy",
+		Stages: []pipeline.Stage{{
+			Name:        "wait",
+			Timeout:     pipeline.Duration(30 * time.Millisecond),
+			HealthCheck: &pipeline.HealthCheck{HTTP: srv.URL, Interval: pipeline.Duration(5 * time.Millisecond)},
+		}},
+	}}
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	job := run.Stages[0].Jobs[0]
+	if job.Status != pipeline.StatusTimedOut || !strings.Contains(job.Message, "status 503, want 2xx") {
+		t.Fatalf("job = %s %q, want timed out naming the last check", job.Status, job.Message)
+	}
+	if run.Status != pipeline.StatusFailed {
+		t.Fatalf("run status = %s, want failed", run.Status)
+	}
+}
+
+func TestResultParserPopulatesJobResults(t *testing.T) {
+	store := artifacts.NewFilesystemStore(t.TempDir())
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		if job.Matrix["shard"] == "2" {
+			return nil // uploads nothing
+		}
+		report := `{"Action":"pass","Package":"p","Test":"TestA"}` + "\n" +
+			`{"Action":"fail","Package":"p","Test":"TestB"}` + "\n"
+		_, err := store.Put(ctx, "r", job.ResultArtifact(), "application/json", strings.NewReader(report), -1)
+		if err != nil {
+			return err
+		}
+		return errors.New("tests failed")
+	}}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	exec := New(Options{Runner: runner, Artifacts: store, Logger: logger})
+
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+		Name: "test",
+		Stages: []pipeline.Stage{{
+			Name:         "unit",
+			Image:        "golang:1.21",
+			Matrix:       &pipeline.Matrix{Params: map[string][]string{"shard": {"1", "2"}}},
+			ResultParser: "gotest-json",
+			ResultFile:   "unit.json",
+		}},
+	}}
+	if err := exec.Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := run.Stages[0].Jobs
+	res := jobs[0].Results
+	if res == nil || res.Parser != "gotest-json" || res.Tests != 2 || res.Failed != 1 || res.FailedTests[0] != "p.TestB" {
+		t.Fatalf("results of failed shard = %+v", res)
+	}
+	if jobs[1].Results != nil {
+		t.Fatalf("results recorded without a result file: %+v", jobs[1].Results)
+	}
+	if len(run.Warnings) != 1 || !strings.Contains(run.Warnings[0], "unit-1/unit.json was not uploaded") {
+		t.Fatalf("warnings = %v", run.Warnings)
+	}
+}
+
+func TestRetryPolicyRetriesOnlyItsErrorClasses(t *testing.T) {
+	var mu sync.Mutex
+	attempts := make(map[string][]int)
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		mu.Lock()
+		attempts[job.ID] = append(attempts[job.ID], job.Attempt)
+		mu.Unlock()
+		switch {
+		case job.Stage.Name == "deploy" && job.Attempt < 2:
+			return &pipeline.JobError{Class: pipeline.ErrorClassInfra, Err: errors.New("image pull failed")}
+		case job.Stage.Name == "compile":
+			return errors.New("exit status 2")
+		case job.Stage.Name == "integration":
+			return sleepJob(time.Second)(ctx, job)
+		}
+		return nil
+	}}
+	policy := &pipeline.RetryPolicy{Attempts: 3, On: []string{pipeline.ErrorClassInfra, pipeline.ErrorClassTimeout}}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Stages: []pipeline.Stage{
+		{Name: "deploy", Retry: policy},
+		{Name: "compile", Retry: policy},
+		{Name: "integration", Retry: &pipeline.RetryPolicy{Attempts: 1, On: []string{pipeline.ErrorClassTimeout}}, Timeout: pipeline.Duration(10 * time.Millisecond)},
+	}}}
+
+	retried := testutil.ToFloat64(metrics.JobRetries.WithLabelValues("deploy", pipeline.ErrorClassInfra))
+	if err := newTestExecutor(runner).Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	deploy := run.Stages[0].Jobs[0]
+	if deploy.Status != pipeline.StatusSucceeded || deploy.Retries != 2 {
+		t.Errorf("deploy = %s after %d retries, want Succeeded after 2", deploy.Status, deploy.Retries)
+	}
+	if got := testutil.ToFloat64(metrics.JobRetries.WithLabelValues("deploy", pipeline.ErrorClassInfra)); got != retried+2 {
+		t.Errorf("retries counter = %v, want %v", got, retried+2)
+	}
+	compile := run.Stages[1].Jobs[0]
+	if compile.Status != pipeline.StatusFailed || compile.Retries != 0 || compile.ErrorClass != pipeline.ErrorClassFailed {
+		t.Errorf("compile = %s, %d retries, class %q; want Failed without retries, class failed", compile.Status, compile.Retries, compile.ErrorClass)
+	}
+	integration := run.Stages[2].Jobs[0]
+	if integration.Status != pipeline.StatusTimedOut || integration.Retries != 1 || integration.ErrorClass != pipeline.ErrorClassTimeout {
+		t.Errorf("integration = %s, %d retries, class %q; want TimedOut after 1 retry, class timeout", integration.Status, integration.Retries, integration.ErrorClass)
+	}
+	if got := attempts["deploy"]; len(got) != 3 || got[2] != 2 {
+		t.Errorf("deploy attempts = %v, want 0, 1 and 2", got)
+	}
+}
+
+// fakeSelector answers test selection requests with resp or err.
+type fakeSelector struct {
+	resp *ai.TestSelectionResponse
+	err  error
+	req  ai.TestSelectionRequest
+}
+
+func (f *fakeSelector) SelectTests(ctx context.Context, req ai.TestSelectionRequest) (*ai.TestSelectionResponse, error) {
+	f.req = req
+	return f.resp, f.err
+}
+
+func TestTestSelectionFiltersTestsOrRunsWholeSuite(t *testing.T) {
+	var mu sync.Mutex
+	var got string
+	runner := &fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		mu.Lock()
+		got = job.Params()["TESTS"]
+		mu.Unlock()
+		return nil
+	}}
+	history := store.NewMemory()
+	past := &pipeline.Run{ID: "past", Status: pipeline.StatusFailed, Spec: pipeline.Spec{Name: "app", Commit: "old"},
+		Stages: []pipeline.StageResult{{Name: "unit", Status: pipeline.StatusFailed, Jobs: []pipeline.JobResult{
+			{Results: &pipeline.Results{Tests: 3, Failed: 1, FailedTests: []string{"TestB"}}},
+		}}}}
+	if err := history.SaveRun(context.Background(), past); err != nil {
+		t.Fatal(err)
+	}
+	newRun := func() *pipeline.Run {
+		return &pipeline.Run{ID: "r", Spec: pipeline.Spec{Name: "app", Commit: "new", ChangedFiles: []string{"b.go"}, Stages: []pipeline.Stage{{
+			Name:          "unit",
+			Params:        map[string]string{"GOFLAGS": "-race"},
+			TestSelection: &pipeline.TestSelection{Tests: []string{"TestA", "TestB", "TestC"}, Param: "TESTS"},
+		}}}}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		sel     *fakeSelector
+		want    string
+		applied bool
+	}{
+		{"confident", &fakeSelector{resp: &ai.TestSelectionResponse{SelectedTests: []string{"TestB", "TestX"}, Confidence: 0.9}}, "TestB", true},
+		{"unavailable", &fakeSelector{err: ai.ErrUnavailable}, "TestA TestB TestC", false},
+		{"low confidence", &fakeSelector{err: &ai.LowConfidenceError{Confidence: 0.3, Minimum: 0.8}}, "TestA TestB TestC", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			skipped := testutil.ToFloat64(metrics.TestSelectionTests.WithLabelValues("skipped"))
+			e := newTestExecutor(runner)
+			e.tests, e.history = tc.sel, history
+			run := newRun()
+			if err := e.Execute(context.Background(), run, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tc.want {
+				t.Errorf("TESTS = %q, want %q", got, tc.want)
+			}
+			if d := run.AIDecisions; len(d) != 1 || d[0].Kind != ai.KindTestSelection || d[0].Applied != tc.applied {
+				t.Errorf("AI decisions = %+v, want one test_selection decision applied=%v", d, tc.applied)
+			}
+			wantSkipped := skipped
+			if tc.applied {
+				wantSkipped += 2
+			}
+			if got := testutil.ToFloat64(metrics.TestSelectionTests.WithLabelValues("skipped")); got != wantSkipped {
+				t.Errorf("skipped tests = %v, want %v", got, wantSkipped)
+			}
+			if run.Spec.Stages[0].Params["TESTS"] != "" {
+				t.Error("test selection modified the spec")
+			}
+			if h := tc.sel.req.TestHistory; len(h) != 1 || h[0].CommitHash != "old" || h[0].FailedTests[0] != "TestB" {
+				t.Errorf("test history = %+v, want the past run's results", h)
+			}
+		})
+	}
+}
+
+// fakePredictor predicts every run to fail with probability.
+type fakePredictor struct {
+	probability float64
+}
+
+func (f *fakePredictor) PredictFailure(ctx context.Context, req ai.FailurePredictionRequest) (*ai.FailurePredictionResponse, error) {
+	return &ai.FailurePredictionResponse{
+		PipelineID:          req.PipelineID,
+		FailureProbability:  f.probability,
+		RiskLevel:           "high",
+		ContributingFactors: []map[string]interface{}{{"factor": "large change"}},
+		Confidence:          0.9,
+	}, nil
+}
+
+// fakeOptimizer answers build optimization requests with resp or err,
+// recording the last request.
+type fakeOptimizer struct {
+	resp *ai.BuildOptimizationResponse
+	err  error
+	req  ai.BuildOptimizationRequest
+}
+
+func (f *fakeOptimizer) OptimizeBuild(ctx context.Context, req ai.BuildOptimizationRequest) (*ai.BuildOptimizationResponse, error) {
+	f.req = req
+	return f.resp, f.err
+}
+
+func TestBuildOptimizationAppliesUsableCaches(t *testing.T) {
+	var mu sync.Mutex
+	caches := map[string]*pipeline.BuildCache{}
+	e := newTestExecutor(&fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		mu.Lock()
+		defer mu.Unlock()
+		caches[job.ID] = job.Stage.Cache
+		return nil
+	}})
+	opt := &fakeOptimizer{resp: &ai.BuildOptimizationResponse{
+		RecommendedStrategy: "cache_dependencies",
+		EstimatedBuildTime:  120,
+		ConfidenceScore:     0.9,
+		CacheKeys: []ai.CacheKeySuggestion{
+			{Stage: "build", Key: "go-mod-v1", Path: "/go/pkg/mod"},
+			{Stage: "build", Key: "go-build", Path: "/root/.cache/go-build"},
+			{Stage: "lint", Key: "lint", Path: "/cache"},
+			{Stage: "test", Key: "../escape", Path: "/cache"},
+			{Stage: "missing", Key: "x", Path: "/cache"},
+		},
+		Parallelization: map[string]int{"test": 4, "missing": 2},
+	}}
+	e.optimizer = opt
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Name: "app", Stages: []pipeline.Stage{
+		{Name: "build", Image: "golang:1.22"},
+		{Name: "lint", TaskRef: "golangci-lint"},
+		{Name: "test", Image: "golang:1.22", DependsOn: []string{"build"}},
+	}}}
+	if err := e.Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if run.Status != pipeline.StatusSucceeded {
+		t.Fatalf("run = %s %q, want Succeeded", run.Status, run.Reason)
+	}
+	if got := opt.req.DependencyGraph["test"]; len(got) != 1 || got[0] != "build" {
+		t.Errorf("dependency graph = %v", opt.req.DependencyGraph)
+	}
+	want := pipeline.BuildCache{Stage: "build", Key: "go-mod-v1", Path: "/go/pkg/mod"}
+	if c := caches["build"]; c == nil || *c != want || caches["lint"] != nil || caches["test"] != nil {
+		t.Errorf("job caches = %v, want build's only", caches)
+	}
+	o := run.BuildOptimization
+	if o == nil || len(o.Caches) != 1 || o.Caches[0] != want || o.EstimatedSeconds != 120 || len(o.Ignored) != 5 {
+		t.Fatalf("build optimization = %+v", o)
+	}
+	if len(o.Parallelism) != 1 || o.Parallelism["test"] != 4 {
+		t.Errorf("parallelism = %v", o.Parallelism)
+	}
+	if run.Spec.Stages[0].Cache != nil {
+		t.Error("the spec's stages were changed")
+	}
+	if d := run.AIDecisions; len(d) != 1 || d[0].Kind != ai.KindBuildOptimization || !d[0].Applied {
+		t.Errorf("AI decisions = %+v", d)
+	}
+}
+
+func TestBuildOptimizationUnavailableBuildsWithDefaults(t *testing.T) {
+	e := newTestExecutor(&fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+		if job.Stage.Cache != nil {
+			t.Errorf("job %s given cache %+v", job.ID, job.Stage.Cache)
+		}
+		return nil
+	}})
+	e.optimizer = &fakeOptimizer{err: ai.ErrUnavailable}
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Name: "app", Stages: []pipeline.Stage{{Name: "build", Image: "golang:1.22"}}}}
+	if err := e.Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != pipeline.StatusSucceeded || run.BuildOptimization != nil {
+		t.Errorf("run = %s with build optimization %+v", run.Status, run.BuildOptimization)
+	}
+	if d := run.AIDecisions; len(d) != 1 || d[0].Applied {
+		t.Errorf("AI decisions = %+v", d)
+	}
+}
+
+func TestFailurePredictionBlocksOnlyWhenOptedIn(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		probability float64
+		block       float64
+		want        pipeline.Status
+	}{
+		{"blocked", 0.95, 0.9, pipeline.StatusPredictedFailure},
+		{"below threshold", 0.5, 0.9, pipeline.StatusSucceeded},
+		{"not opted in", 0.95, 0, pipeline.StatusSucceeded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var started atomic.Int32
+			e := newTestExecutor(&fakeRunner{fn: func(context.Context, pipeline.Job) error {
+				started.Add(1)
+				return nil
+			}})
+			e.predictions, e.blockAbove = &fakePredictor{probability: tc.probability}, tc.block
+			run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Name: "app", Stages: []pipeline.Stage{{Name: "build"}}}}
+			if err := e.Execute(context.Background(), run, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if run.Status != tc.want {
+				t.Errorf("status = %s, want %s", run.Status, tc.want)
+			}
+			blocked := tc.want == pipeline.StatusPredictedFailure
+			if p := run.Prediction; p == nil || p.Probability != tc.probability || p.Blocked != blocked || len(p.Factors) != 1 {
+				t.Errorf("prediction = %+v", run.Prediction)
+			}
+			if n := started.Load(); blocked != (n == 0) {
+				t.Errorf("started %d jobs, blocked = %v", n, blocked)
+			}
+			if d := run.AIDecisions; len(d) != 1 || d[0].Kind != ai.KindFailurePrediction || !d[0].Applied {
+				t.Errorf("AI decisions = %+v", d)
+			}
+		})
+	}
+}
+
+// fakeAuditor records the AI exchanges saved for each run.
+type fakeAuditor struct {
+	mu        sync.Mutex
+	exchanges map[string][]pipeline.AIExchange
+}
+
+func (f *fakeAuditor) SaveAIExchange(ctx context.Context, runID string, x pipeline.AIExchange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.exchanges[runID] = append(f.exchanges[runID], x)
+	return nil
+}
+
+func TestAIExchangesRecordedForRun(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"pipeline_id":"r","failure_probability":0.1,"risk_level":"low","confidence":0.9}`)
+	}))
+	defer srv.Close()
+
+	e := newTestExecutor(&fakeRunner{})
+	audit := &fakeAuditor{exchanges: map[string][]pipeline.AIExchange{}}
+	e.predictions, e.aiAudit = ai.New(config.AIServiceConfig{Enabled: true, URL: []string{srv.URL}}, egress.Config{}, e.logger), audit
+	run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Name: "app", Stages: []pipeline.Stage{{Name: "build"}}}}
+	if err := e.Execute(context.Background(), run, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	got := audit.exchanges["r"]
+	if len(got) != 1 || !strings.Contains(got[0].Request, `"pipeline_id":"r"`) || !strings.Contains(got[0].Response, "failure_probability") {
+		t.Errorf("exchanges of run = %+v, want the failure prediction", got)
+	}
+}
+
+func TestCoverageGates(t *testing.T) {
+	cov := func(v float64) *float64 { return &v }
+	history := store.NewMemory()
+	base := &pipeline.Run{ID: "base", Status: pipeline.StatusSucceeded, Spec: pipeline.Spec{Name: "app", Branch: "main"}, Coverage: cov(80)}
+	if err := history.SaveRun(context.Background(), base); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		gate   pipeline.Coverage
+		branch string
+		want   pipeline.Status
+	}{
+		{"passes", pipeline.Coverage{Min: 70, MaxDrop: 5}, "main", pipeline.StatusSucceeded},
+		{"below min", pipeline.Coverage{Min: 76}, "main", pipeline.StatusFailed},
+		{"regressed", pipeline.Coverage{MaxDrop: 2}, "main", pipeline.StatusFailed},
+		{"no baseline on branch", pipeline.Coverage{MaxDrop: 2}, "dev", pipeline.StatusSucceeded},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := artifacts.NewFilesystemStore(t.TempDir())
+			e := newTestExecutor(&fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error {
+				// Three of four statements covered.
+				profile := "mode: set\np/a.go:1.1,2.2 3 1\np/a.go:3.1,4.2 1 0\n"
+				_, err := files.Put(ctx, "r", job.ResultArtifact(), "text/plain", strings.NewReader(profile), -1)
+				return err
+			}})
+			e.history, e.artifacts = history, files
+			gate := tc.gate
+			gate.Stage = "unit"
+			run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{Name: "app", Branch: tc.branch, Coverage: &gate, Stages: []pipeline.Stage{
+				{Name: "unit", ResultParser: "go-cover", ResultFile: "cover.out"},
+			}}}
+			if err := e.Execute(context.Background(), run, nil); err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != tc.want || run.Coverage == nil || *run.Coverage != 75 {
+				t.Errorf("run = %s %q, coverage %v; want %s at 75", run.Status, run.Reason, run.Coverage, tc.want)
+			}
+			if got := testutil.ToFloat64(metrics.PipelineCoverage.WithLabelValues("app")); got != 75 {
+				t.Errorf("coverage gauge = %v, want 75", got)
+			}
+		})
+	}
+}
+
+// fakeDeployer answers syncs with app and err, recording the requests, and
+// health watches with events.
+type fakeDeployer struct {
+	app    *argocd.Application
+	err    error
+	reqs   []argocd.SyncRequest
+	events []argocd.HealthEvent
+}
+
+func (f *fakeDeployer) SyncAndWait(ctx context.Context, name string, req argocd.SyncRequest) (*argocd.Application, error) {
+	f.reqs = append(f.reqs, req)
+	return f.app, f.err
+}
+
+func (f *fakeDeployer) WatchHealth(ctx context.Context, name string, window time.Duration) <-chan argocd.HealthEvent {
+	ch := make(chan argocd.HealthEvent, len(f.events))
+	for _, ev := range f.events {
+		ch <- ev
+	}
+	close(ch)
+	return ch
+}
+
+func TestDeploySyncsApplicationOfSucceededRuns(t *testing.T) {
+	healthy := &argocd.Application{}
+	healthy.Status.Sync.Status, healthy.Status.Sync.Revision, healthy.Status.Health.Status = "Synced", "abc123", "Healthy"
+	degraded := &argocd.Application{}
+	degraded.Status.Sync.Status, degraded.Status.Health.Status = "Synced", "Degraded"
+
+	for _, tc := range []struct {
+		name     string
+		deployer *fakeDeployer
+		stageErr error
+		want     pipeline.Status
+		deploy   pipeline.Status
+	}{
+		{"healthy", &fakeDeployer{app: healthy}, nil, pipeline.StatusSucceeded, pipeline.StatusSucceeded},
+		{"degraded", &fakeDeployer{app: degraded, err: argocd.ErrSyncFailed}, nil, pipeline.StatusFailed, pipeline.StatusFailed},
+		{"timed out", &fakeDeployer{app: degraded, err: argocd.ErrSyncTimeout}, nil, pipeline.StatusFailed, pipeline.StatusTimedOut},
+		{"not configured", nil, nil, pipeline.StatusSucceeded, pipeline.StatusSkipped},
+		{"stage failed", &fakeDeployer{app: healthy}, errors.New("boom"), pipeline.StatusFailed, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestExecutor(&fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error { return tc.stageErr }})
+			if tc.deployer != nil {
+				e.deployer = tc.deployer
+			}
+			run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+				Name:   "app",
+				Commit: "abc123",
+				Stages: []pipeline.Stage{{Name: "build", Image: "golang:1.22"}},
+				Deploy: &pipeline.Deploy{Application: "app-prod", Revision: pipeline.RunCommitRef, Prune: true},
+			}}
+			if err := e.Execute(context.Background(), run, nil); err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != tc.want {
+				t.Errorf("run = %s %q, want %s", run.Status, run.Reason, tc.want)
+			}
+			if tc.deploy == "" {
+				if run.Deploy != nil || len(tc.deployer.reqs) != 0 {
+					t.Errorf("run whose stages failed deployed: %+v", run.Deploy)
+				}
+				return
+			}
+			if run.Deploy == nil || run.Deploy.Status != tc.deploy || run.Deploy.Application != "app-prod" {
+				t.Fatalf("deploy = %+v, want %s", run.Deploy, tc.deploy)
+			}
+			if tc.deployer != nil {
+				if len(tc.deployer.reqs) != 1 || tc.deployer.reqs[0] != (argocd.SyncRequest{Revision: "abc123", Prune: true}) {
+					t.Errorf("sync requests = %+v", tc.deployer.reqs)
+				}
+				if run.Deploy.HealthStatus != tc.deployer.app.Status.Health.Status {
+					t.Errorf("deploy health = %q", run.Deploy.HealthStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestDeployRollsBackDegradedApplication(t *testing.T) {
+	healthy := &argocd.Application{}
+	healthy.Status.Sync.Status, healthy.Status.Sync.Revision, healthy.Status.Health.Status = "Synced", "v2", "Healthy"
+	rollbacks := func(result string) float64 {
+		return testutil.ToFloat64(metrics.ArgoCDRollbacks.WithLabelValues(result))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		events   []argocd.HealthEvent
+		want     pipeline.Status
+		rollback pipeline.Status
+	}{
+		{"recovered", []argocd.HealthEvent{{Health: "Degraded"}, {Err: errors.New("unreachable")}, {Health: "Healthy"}}, pipeline.StatusSucceeded, ""},
+		{"rolled back", []argocd.HealthEvent{{Health: "Degraded"}, {Health: "Degraded", Rollback: &argocd.Rollback{From: "v2", To: "v1"}}}, pipeline.StatusFailed, pipeline.StatusSucceeded},
+		{"rollback refused", []argocd.HealthEvent{{Health: "Degraded", Rollback: &argocd.Rollback{From: "v2", Err: argocd.ErrNoPreviousRevision}}}, pipeline.StatusFailed, pipeline.StatusFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			before := rollbacks(strings.ToLower(string(tc.rollback)))
+			e := newTestExecutor(&fakeRunner{fn: func(ctx context.Context, job pipeline.Job) error { return nil }})
+			e.deployer = &fakeDeployer{app: healthy, events: tc.events}
+			e.healthWatch = time.Minute
+			run := &pipeline.Run{ID: "r", Spec: pipeline.Spec{
+				Name:   "app",
+				Stages: []pipeline.Stage{{Name: "build", Image: "golang:1.22"}},
+				Deploy: &pipeline.Deploy{Application: "app-prod"},
+			}}
+			if err := e.Execute(context.Background(), run, nil); err != nil {
+				t.Fatal(err)
+			}
+			if run.Status != tc.want {
+				t.Errorf("run = %s %q, want %s", run.Status, run.Reason, tc.want)
+			}
+			last := tc.events[len(tc.events)-1]
+			if run.Deploy.HealthStatus != last.Health {
+				t.Errorf("deploy health = %q, want %q", run.Deploy.HealthStatus, last.Health)
+			}
+			if tc.rollback == "" {
+				if run.Deploy.Rollback != nil || run.Deploy.Status != pipeline.StatusSucceeded {
+					t.Errorf("deploy = %+v, want a succeeded deploy without rollback", run.Deploy)
+				}
+				return
+			}
+			rb := run.Deploy.Rollback
+			if rb == nil || rb.Status != tc.rollback || rb.From != "v2" || rb.To != last.Rollback.To {
+				t.Fatalf("rollback = %+v, want %s", rb, tc.rollback)
+			}
+			if run.Deploy.Status != pipeline.StatusFailed || !strings.Contains(run.Reason, "stayed Degraded") {
+				t.Errorf("deploy = %s, run reason = %q", run.Deploy.Status, run.Reason)
+			}
+			if got := rollbacks(strings.ToLower(string(tc.rollback))); got != before+1 {
+				t.Errorf("rollbacks counted = %v, want %v", got, before+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+const (
+	// historyRuns bounds the past runs whose results are sent with a test
+	// selection or failure prediction request.
+	historyRuns = 10
+	// historyScan bounds the runs listed to find them.
+	historyScan = 200
+)
+
+// History lists past runs, whose results inform test selection and failure
+// prediction. It is satisfied by store.Store.
+type History interface {
+	ListRuns(ctx context.Context, opts store.ListOptions) ([]*pipeline.Run, error)
+}
+
+// recentRuns returns the recent finished runs of run's pipeline, newest
+// first. Failing to list them only costs AI requests their history.
+func (e *Executor) recentRuns(ctx context.Context, run *pipeline.Run) []*pipeline.Run {
+	if e.history == nil {
+		return nil
+	}
+	runs, err := e.history.ListRuns(ctx, store.ListOptions{Limit: historyScan})
+	if err != nil {
+		logging.FromContext(ctx, e.logger).WithError(err).Warn("Failed to list past runs for AI requests")
+		return nil
+	}
+	var out []*pipeline.Run
+	for _, r := range runs {
+		if r.ID != run.ID && r.Spec.Name == run.Spec.Name && r.Status.Terminal() {
+			out = append(out, r)
+			if len(out) == historyRuns {
+				break
+			}
+		}
+	}
+	return out
+}
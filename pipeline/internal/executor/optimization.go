@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// BuildOptimizer advises on the build of runs. It is satisfied by
+// *ai.Client.
+type BuildOptimizer interface {
+	OptimizeBuild(ctx context.Context, req ai.BuildOptimizationRequest) (*ai.BuildOptimizationResponse, error)
+}
+
+// cacheKeyPattern matches the cache keys that are safe as a directory of the
+// cache volume.
+var cacheKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+// optimizeBuild asks for build optimization advice for run as it starts and
+// records it on the run, and the decision among its AI decisions. It returns
+// stages with the suggested build caches set; suggestions that cannot be
+// applied are logged, recorded as ignored and left out. stages itself is
+// left untouched.
+func (e *Executor) optimizeBuild(ctx context.Context, run *pipeline.Run, stages []pipeline.Stage) []pipeline.Stage {
+	if e.optimizer == nil {
+		return stages
+	}
+	log := logging.FromContext(ctx, e.logger)
+
+	var resp *ai.BuildOptimizationResponse
+	err := ai.Gated(run, ai.KindBuildOptimization)
+	if err == nil {
+		history := e.recentRuns(ctx, run)
+		resp, err = e.optimizer.OptimizeBuild(ctx, ai.BuildOptimizationRequest{
+			ProjectName:          run.Spec.Name,
+			DependencyGraph:      dependencyGraph(stages),
+			HistoricalBuildTimes: buildTimes(history),
+			CacheStats:           cacheStats(history),
+		})
+	}
+	var confidence float64
+	if resp != nil {
+		confidence = resp.ConfidenceScore
+	}
+	run.AIDecisions = append(run.AIDecisions, ai.Decide(ai.KindBuildOptimization, confidence, err))
+	if err != nil {
+		log.WithError(err).Info("Building without build optimization advice")
+		return stages
+	}
+
+	opt := &pipeline.BuildOptimization{Strategy: resp.RecommendedStrategy, EstimatedSeconds: resp.EstimatedBuildTime}
+	ignore := func(format string, args ...interface{}) {
+		reason := fmt.Sprintf(format, args...)
+		opt.Ignored = append(opt.Ignored, reason)
+		log.WithField("reason", reason).Warn("Ignoring build optimization suggestion")
+	}
+	out := slices.Clone(stages)
+	for _, s := range resp.CacheKeys {
+		i := slices.IndexFunc(out, func(st pipeline.Stage) bool { return st.Name == s.Stage })
+		if i < 0 {
+			ignore("cache %q: no stage %q", s.Key, s.Stage)
+			continue
+		}
+		if reason := cacheProblem(&out[i], s); reason != "" {
+			ignore("cache %q for stage %s: %s", s.Key, s.Stage, reason)
+			continue
+		}
+		cache := pipeline.BuildCache{Stage: s.Stage, Key: s.Key, Path: s.Path}
+		out[i].Cache = &cache
+		opt.Caches = append(opt.Caches, cache)
+	}
+	names := make([]string, 0, len(resp.Parallelization))
+	for name := range resp.Parallelization {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		n := resp.Parallelization[name]
+		switch {
+		case !slices.ContainsFunc(out, func(st pipeline.Stage) bool { return st.Name == name }):
+			ignore("parallelism for stage %q: no such stage", name)
+		case n <= 0:
+			ignore("parallelism for stage %s: %d jobs", name, n)
+		default:
+			if opt.Parallelism == nil {
+				opt.Parallelism = make(map[string]int)
+			}
+			opt.Parallelism[name] = n
+		}
+	}
+	run.BuildOptimization = opt
+	log.WithFields(logrus.Fields{
+		"strategy":          opt.Strategy,
+		"estimated_seconds": opt.EstimatedSeconds,
+		"caches":            len(opt.Caches),
+	}).Info("Applying build optimization advice")
+	return out
+}
+
+// cacheProblem says why the suggested cache cannot be given to the jobs of
+// stage, or returns "" when it can.
+func cacheProblem(stage *pipeline.Stage, s ai.CacheKeySuggestion) string {
+	switch {
+	case stage.Cache != nil:
+		return "the stage already has a cache"
+	case stage.HealthCheck != nil:
+		return "health check stages run no task"
+	case stage.TaskRef != "":
+		// Referenced tasks do not declare the cache workspace.
+		return fmt.Sprintf("the stage runs task %s", stage.TaskRef)
+	case !cacheKeyPattern.MatchString(s.Key):
+		return "the key must be letters, digits, '.', '_' and '-'"
+	case !path.IsAbs(s.Path) || path.Clean(s.Path) != s.Path || s.Path == "/":
+		return fmt.Sprintf("the path %q is not an absolute directory", s.Path)
+	}
+	return ""
+}
+
+// observeBuildTime compares how long a succeeded run took to build with
+// the estimate of its build optimization advice.
+func observeBuildTime(run *pipeline.Run, took time.Duration) {
+	if o := run.BuildOptimization; o != nil && o.EstimatedSeconds > 0 {
+		metrics.BuildTimeEstimateRatio.Observe(took.Seconds() / o.EstimatedSeconds)
+	}
+}
+
+// dependencyGraph maps each stage to the stages it depends on.
+func dependencyGraph(stages []pipeline.Stage) map[string][]string {
+	graph := make(map[string][]string, len(stages))
+	for _, st := range stages {
+		graph[st.Name] = st.DependsOn
+	}
+	return graph
+}
+
+// buildTimes returns how many seconds each succeeded run of runs took.
+func buildTimes(runs []*pipeline.Run) []float64 {
+	var out []float64
+	for _, r := range runs {
+		if r.Status == pipeline.StatusSucceeded && r.StartedAt != nil && r.FinishedAt != nil {
+			out = append(out, r.FinishedAt.Sub(*r.StartedAt).Seconds())
+		}
+	}
+	return out
+}
+
+// cacheStats counts the jobs of runs and those of them satisfied from
+// cache, or returns nil when runs ran no jobs.
+func cacheStats(runs []*pipeline.Run) *ai.CacheStats {
+	var stats ai.CacheStats
+	for _, r := range runs {
+		for _, st := range r.Stages {
+			for _, job := range st.Jobs {
+				stats.Jobs++
+				if job.Status == pipeline.StatusCached {
+					stats.Hits++
+				}
+			}
+		}
+	}
+	if stats.Jobs == 0 {
+		return nil
+	}
+	stats.HitRate = float64(stats.Hits) / float64(stats.Jobs)
+	return &stats
+}
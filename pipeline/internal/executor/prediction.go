@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+// FailurePredictor predicts how likely a run is to fail. It is satisfied by
+// *ai.Client.
+type FailurePredictor interface {
+	PredictFailure(ctx context.Context, req ai.FailurePredictionRequest) (*ai.FailurePredictionResponse, error)
+}
+
+// predictFailure asks for a failure prediction for run as it starts and
+// records it on the run, and the decision among its AI decisions. It
+// reports whether the prediction blocks the run. A run without a usable
+// prediction is never blocked.
+func (e *Executor) predictFailure(ctx context.Context, run *pipeline.Run) bool {
+	if e.predictions == nil {
+		return false
+	}
+	log := logging.FromContext(ctx, e.logger)
+
+	var resp *ai.FailurePredictionResponse
+	err := ai.Gated(run, ai.KindFailurePrediction)
+	if err == nil {
+		resp, err = e.predictions.PredictFailure(ctx, ai.FailurePredictionRequest{
+			PipelineID: run.ID,
+			CommitHash: run.Spec.Commit,
+			CodeChanges: map[string]interface{}{
+				"repo":          run.Spec.Repo,
+				"branch":        run.Spec.Branch,
+				"changed_files": run.Spec.ChangedFiles,
+			},
+			HistoricalMetrics: historicalMetrics(e.recentRuns(ctx, run)),
+		})
+	}
+	var confidence float64
+	if resp != nil {
+		confidence = resp.Confidence
+	}
+	run.AIDecisions = append(run.AIDecisions, ai.Decide(ai.KindFailurePrediction, confidence, err))
+	if err != nil {
+		log.WithError(err).Info("Starting pipeline without a failure prediction")
+		return false
+	}
+
+	factors := resp.ContributingFactors
+	if len(factors) > pipeline.MaxPredictionFactors {
+		factors = factors[:pipeline.MaxPredictionFactors]
+	}
+	run.Prediction = &pipeline.FailurePrediction{
+		Probability: resp.FailureProbability,
+		RiskLevel:   resp.RiskLevel,
+		Factors:     factors,
+		Blocked:     e.blockAbove > 0 && resp.FailureProbability > e.blockAbove,
+	}
+	log.WithFields(logrus.Fields{
+		"failure_probability": resp.FailureProbability,
+		"risk_level":          resp.RiskLevel,
+	}).Info("Predicted pipeline outcome")
+	return run.Prediction.Blocked
+}
+
+// historicalMetrics summarizes the outcomes of runs for a failure
+// prediction request.
+func historicalMetrics(runs []*pipeline.Run) map[string]interface{} {
+	if len(runs) == 0 {
+		return nil
+	}
+	failures := 0
+	for _, r := range runs {
+		if r.Status == pipeline.StatusFailed || r.Status == pipeline.StatusTimedOut {
+			failures++
+		}
+	}
+	return map[string]interface{}{
+		"recent_runs":     len(runs),
+		"recent_failures": failures,
+		"failure_rate":    float64(failures) / float64(len(runs)),
+	}
+}
@@ -0,0 +1,41 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/devmind-pipeline/pipeline/internal/artifacts"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/results"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+// parseResults runs the stage's result parser on the result file the job
+// uploaded. A missing or unparsable file never fails the job; it is
+// recorded as a warning on the run instead.
+func (e *Executor) parseResults(ctx context.Context, run *pipeline.Run, job pipeline.Job) *pipeline.Results {
+	if job.Stage.ResultParser == "" || e.artifacts == nil {
+		return nil
+	}
+	name := job.ResultArtifact()
+	res, err := e.readResults(ctx, run.ID, name, job.Stage.ResultParser)
+	if err != nil {
+		logging.FromContext(ctx, e.logger).WithError(err).WithField("artifact", name).Warn("Failed to parse job results")
+		e.Warn(run.ID, fmt.Sprintf("results of job %s not recorded: %v", job.DisplayName(), err))
+		return nil
+	}
+	return res
+}
+
+func (e *Executor) readResults(ctx context.Context, runID, name, parser string) (*pipeline.Results, error) {
+	obj, err := e.artifacts.Open(ctx, runID, name)
+	if errors.Is(err, artifacts.ErrNotFound) {
+		return nil, fmt.Errorf("result file %s was not uploaded", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	return results.Parse(parser, obj)
+}
@@ -0,0 +1,148 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// TestSelector chooses the tests of test_selection stages. It is satisfied
+// by *ai.Client.
+type TestSelector interface {
+	SelectTests(ctx context.Context, req ai.TestSelectionRequest) (*ai.TestSelectionResponse, error)
+}
+
+// selectTests returns the stages of run with the tests param of each
+// test_selection stage set: to the tests the AI service selected when its
+// selection is confident enough, and to the whole suite otherwise. Every
+// selection consulted is recorded among the run's AI decisions. The spec
+// itself is left untouched.
+func (e *Executor) selectTests(ctx context.Context, run *pipeline.Run) []pipeline.Stage {
+	stages := run.Spec.Stages
+	var out []pipeline.Stage
+	var history []*pipeline.Run
+	for i := range stages {
+		sel := stages[i].TestSelection
+		if sel == nil {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(stages)
+			if e.tests != nil {
+				history = e.recentRuns(ctx, run)
+			}
+		}
+		tests := e.selectStageTests(ctx, run, &stages[i], history)
+		metrics.TestSelectionTests.WithLabelValues("run").Add(float64(len(tests)))
+		metrics.TestSelectionTests.WithLabelValues("skipped").Add(float64(len(sel.Tests) - len(tests)))
+
+		params := maps.Clone(out[i].Params)
+		if params == nil {
+			params = make(map[string]string, 1)
+		}
+		params[sel.ParamName()] = strings.Join(tests, " ")
+		out[i].Params = params
+	}
+	if out == nil {
+		return stages
+	}
+	return out
+}
+
+// selectStageTests returns the tests stage runs, recording the decision on
+// run.
+func (e *Executor) selectStageTests(ctx context.Context, run *pipeline.Run, stage *pipeline.Stage, history []*pipeline.Run) []string {
+	suite := stage.TestSelection.Tests
+	if e.tests == nil {
+		return suite
+	}
+	log := logging.FromContext(ctx, e.logger).WithField("stage", stage.Name)
+
+	var resp *ai.TestSelectionResponse
+	err := ai.Gated(run, ai.KindTestSelection)
+	if err == nil {
+		resp, err = e.tests.SelectTests(ctx, ai.TestSelectionRequest{
+			ProjectName:  run.Spec.Name,
+			CommitHash:   run.Spec.Commit,
+			ChangedFiles: run.Spec.ChangedFiles,
+			AllTests:     suite,
+			TestHistory:  stageHistory(history, stage.Name),
+		})
+	}
+	var selected []string
+	if err == nil {
+		selected = knownTests(resp.SelectedTests, suite)
+		if len(selected) == 0 {
+			err = fmt.Errorf("%w: selection names none of the stage's tests", ai.ErrUnavailable)
+		}
+	}
+
+	var confidence float64
+	if resp != nil {
+		confidence = resp.Confidence
+	}
+	run.AIDecisions = append(run.AIDecisions, ai.Decide(ai.KindTestSelection, confidence, err))
+	if err != nil {
+		log.WithError(err).Info("Running the whole test suite")
+		return suite
+	}
+	log.WithFields(logrus.Fields{
+		"selected":   len(selected),
+		"tests":      len(suite),
+		"confidence": confidence,
+	}).Info("Running the tests selected by the AI service")
+	return selected
+}
+
+// stageHistory sums the parsed test results of the jobs of the named stage
+// in each of runs that has any.
+func stageHistory(runs []*pipeline.Run, stage string) []ai.TestHistory {
+	var out []ai.TestHistory
+	for _, r := range runs {
+		for _, st := range r.Stages {
+			if st.Name != stage {
+				continue
+			}
+			h := ai.TestHistory{CommitHash: r.Spec.Commit, Status: string(st.Status)}
+			found := false
+			for _, job := range st.Jobs {
+				if job.Results == nil {
+					continue
+				}
+				found = true
+				h.Tests += job.Results.Tests
+				h.Failed += job.Results.Failed
+				h.FailedTests = append(h.FailedTests, job.Results.FailedTests...)
+			}
+			if found {
+				out = append(out, h)
+			}
+		}
+	}
+	return out
+}
+
+// knownTests returns the tests of selected that belong to suite, in suite
+// order, so a selection can never add tests.
+func knownTests(selected, suite []string) []string {
+	want := make(map[string]bool, len(selected))
+	for _, t := range selected {
+		want[t] = true
+	}
+	var out []string
+	for _, t := range suite {
+		if want[t] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
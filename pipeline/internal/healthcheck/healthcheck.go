@@ -0,0 +1,160 @@
+// Package healthcheck runs health_check stages: it polls an HTTP or gRPC
+// endpoint until it has reported healthy enough times in a row, so deploy
+// pipelines can wait for a service to actually be up instead of sleeping.
+package healthcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+const (
+	// DefaultInterval is used when a health check sets no interval.
+	DefaultInterval = 5 * time.Second
+	// DefaultCheckTimeout is used when a health check sets no
+	// check_timeout.
+	DefaultCheckTimeout = 5 * time.Second
+)
+
+// maxBody bounds how much of an HTTP response is read to match expect_body.
+const maxBody = 64 << 10
+
+// Wait polls the endpoint of hc until it has been healthy for
+// hc.SuccessThreshold consecutive checks, or ctx is done. The error then
+// carries the outcome of the last failed check, so a timed-out stage
+// explains why the endpoint was not considered healthy. HTTP checks are sent
+// with client, or http.DefaultClient when it is nil.
+func Wait(ctx context.Context, client *http.Client, hc *pipeline.HealthCheck) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	interval := time.Duration(hc.Interval)
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	threshold := hc.SuccessThreshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+
+	var conn *grpc.ClientConn
+	if hc.GRPC != "" {
+		var err error
+		if conn, err = dial(hc); err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+
+	last := fmt.Errorf("no check completed")
+	if err := sleep(ctx, time.Duration(hc.InitialDelay)); err != nil {
+		return fmt.Errorf("health check did not start: %w", err)
+	}
+	for healthy := 0; ; {
+		if err := check(ctx, client, hc, conn); err != nil {
+			// A check aborted by ctx says nothing about the endpoint.
+			if ctx.Err() != nil {
+				return fmt.Errorf("endpoint not healthy (%v): %w", last, ctx.Err())
+			}
+			healthy, last = 0, err
+		} else if healthy++; healthy >= threshold {
+			return nil
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return fmt.Errorf("endpoint not healthy (%v): %w", last, err)
+		}
+	}
+}
+
+// check runs a single check, returning why the endpoint is unhealthy.
+func check(ctx context.Context, client *http.Client, hc *pipeline.HealthCheck, conn *grpc.ClientConn) error {
+	timeout := time.Duration(hc.CheckTimeout)
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if conn != nil {
+		return checkGRPC(ctx, hc, conn)
+	}
+	return checkHTTP(ctx, client, hc)
+}
+
+func checkHTTP(ctx context.Context, client *http.Client, hc *pipeline.HealthCheck) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.HTTP, nil)
+	if err != nil {
+		return fmt.Errorf("invalid health check URL: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch {
+	case hc.ExpectStatus != 0 && resp.StatusCode != hc.ExpectStatus:
+		return fmt.Errorf("status %d, want %d", resp.StatusCode, hc.ExpectStatus)
+	case hc.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299):
+		return fmt.Errorf("status %d, want 2xx", resp.StatusCode)
+	case hc.ExpectBody != "" && !strings.Contains(string(body), hc.ExpectBody):
+		return fmt.Errorf("response body does not contain %q", hc.ExpectBody)
+	}
+	return nil
+}
+
+func checkGRPC(ctx context.Context, hc *pipeline.HealthCheck, conn *grpc.ClientConn) error {
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: hc.Service})
+	if err != nil {
+		return err
+	}
+	if s := resp.GetStatus(); s != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status %s, want SERVING", s)
+	}
+	return nil
+}
+
+// dial creates the connection reused by every check of a gRPC health check.
+// It connects lazily, so an endpoint that is not up yet fails checks rather
+// than the stage.
+func dial(hc *pipeline.HealthCheck) (*grpc.ClientConn, error) {
+	creds := insecure.NewCredentials()
+	if hc.TLS {
+		creds = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.Dial(hc.GRPC, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up gRPC health check of %s: %w", hc.GRPC, err)
+	}
+	return conn, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestWaitRequiresConsecutiveHealthyChecks(t *testing.T) {
+	// Healthy, unhealthy, then healthy from the third check on: a threshold
+	// of two is only met by the third and fourth checks.
+	var checks atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checks.Add(1) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"status":"ok"}`)
+	}))
+	defer srv.Close()
+
+	hc := &pipeline.HealthCheck{
+		HTTP:             srv.URL,
+		ExpectBody:       `"ok"`,
+		Interval:         pipeline.Duration(time.Millisecond),
+		SuccessThreshold: 2,
+	}
+	if err := Wait(context.Background(), nil, hc); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if n := checks.Load(); n != 4 {
+		t.Fatalf("checks = %d, want 4", n)
+	}
+}
+
+func TestWaitReportsLastFailureOnTimeout(t *testing.T) {
+	// The first check fails on the body; the second hangs until the
+	// deadline aborts it, which must not mask that failure.
+	var checks atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if checks.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "starting")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	hc := &pipeline.HealthCheck{HTTP: srv.URL, ExpectStatus: http.StatusOK, ExpectBody: "ready", Interval: pipeline.Duration(5 * time.Millisecond)}
+	err := Wait(ctx, nil, hc)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), `does not contain "ready"`) {
+		t.Fatalf("Wait() error = %v, want a deadline error naming the body mismatch", err)
+	}
+}
+
+func TestWaitGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := health.NewServer()
+	hs.SetServingStatus("deploy", healthpb.HealthCheckResponse_NOT_SERVING)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	time.AfterFunc(20*time.Millisecond, func() { hs.SetServingStatus("deploy", healthpb.HealthCheckResponse_SERVING) })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hc := &pipeline.HealthCheck{GRPC: lis.Addr().String(), Service: "deploy", Interval: pipeline.Duration(5 * time.Millisecond)}
+	if err := Wait(ctx, nil, hc); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+}
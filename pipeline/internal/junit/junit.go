@@ -0,0 +1,187 @@
+// Package junit renders the results of a run as JUnit XML, the format test
+// reporting dashboards ingest.
+//
+// Each stage, finally stage and post-run hook becomes a testsuite and each of
+// its jobs a testcase, so a matrix stage reports one testcase per
+// combination. Failed and timed-out jobs are failures; skipped, cancelled and
+// never-started jobs are skipped.
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// ErrNoResults is returned for runs without a single job result to report.
+var ErrNoResults = perrors.New(perrors.ErrNotFound, "run has no results")
+
+// TestSuites is the document root.
+type TestSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     seconds     `xml:"time,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+// TestSuite holds the jobs of one stage.
+type TestSuite struct {
+	Name       string      `xml:"name,attr"`
+	Tests      int         `xml:"tests,attr"`
+	Failures   int         `xml:"failures,attr"`
+	Skipped    int         `xml:"skipped,attr"`
+	Time       seconds     `xml:"time,attr"`
+	Timestamp  string      `xml:"timestamp,attr,omitempty"`
+	Properties *Properties `xml:"properties,omitempty"`
+	Cases      []TestCase  `xml:"testcase"`
+}
+
+// Properties wraps the properties of a suite.
+type Properties struct {
+	Property []Property `xml:"property"`
+}
+
+// Property is a name/value pair attached to a suite.
+type Property struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// TestCase is one job.
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	Classname string   `xml:"classname,attr"`
+	Time      seconds  `xml:"time,attr"`
+	Failure   *Outcome `xml:"failure,omitempty"`
+	Skipped   *Outcome `xml:"skipped,omitempty"`
+	SystemOut string   `xml:"system-out,omitempty"`
+}
+
+// Outcome explains a failed or skipped testcase.
+type Outcome struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// seconds is a duration written as fractional seconds, as JUnit expects.
+type seconds time.Duration
+
+func (s seconds) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	return xml.Attr{Name: name, Value: fmt.Sprintf("%.3f", time.Duration(s).Seconds())}, nil
+}
+
+func (s *seconds) UnmarshalXMLAttr(attr xml.Attr) error {
+	v, err := strconv.ParseFloat(attr.Value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", attr.Name.Local, attr.Value, err)
+	}
+	*s = seconds(v * float64(time.Second))
+	return nil
+}
+
+// Build maps the stage results of run to JUnit test suites. It fails with
+// ErrNoResults when no job of the run ever started.
+func Build(run *pipeline.Run) (*TestSuites, error) {
+	doc := &TestSuites{Name: run.Spec.Name}
+	started := false
+	add := func(st pipeline.StageResult, kind string) {
+		suite := TestSuite{Name: st.Name}
+		if kind != "" {
+			suite.Properties = &Properties{Property: []Property{{Name: "pipeline.stage.kind", Value: kind}}}
+		}
+		var first, last *time.Time
+		for _, job := range st.Jobs {
+			tc := testCase(run.Spec.Name+"."+st.Name, job)
+			switch {
+			case tc.Failure != nil:
+				suite.Failures++
+			case tc.Skipped != nil:
+				suite.Skipped++
+			}
+			if job.StartedAt != nil {
+				started = true
+				if first == nil || job.StartedAt.Before(*first) {
+					first = job.StartedAt
+				}
+			}
+			if job.FinishedAt != nil && (last == nil || job.FinishedAt.After(*last)) {
+				last = job.FinishedAt
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		if first != nil {
+			suite.Timestamp = first.UTC().Format(time.RFC3339)
+			if last != nil {
+				suite.Time = seconds(last.Sub(*first))
+			}
+		}
+
+		doc.Tests += suite.Tests
+		doc.Failures += suite.Failures
+		doc.Skipped += suite.Skipped
+		doc.Suites = append(doc.Suites, suite)
+	}
+	for _, st := range run.Stages {
+		add(st, "")
+	}
+	for _, st := range run.Finally {
+		add(st, "finally")
+	}
+	if run.PostRun != nil {
+		add(*run.PostRun, "post_run")
+	}
+	if !started {
+		return nil, fmt.Errorf("run %s: %w", run.ID, ErrNoResults)
+	}
+	if run.StartedAt != nil && run.FinishedAt != nil {
+		doc.Time = seconds(run.FinishedAt.Sub(*run.StartedAt))
+	}
+	return doc, nil
+}
+
+// Render builds the JUnit document of run and encodes it, XML header
+// included.
+func Render(run *pipeline.Run) ([]byte, error) {
+	doc, err := Build(run)
+	if err != nil {
+		return nil, err
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode junit report: %w", err)
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
+
+func testCase(classname string, job pipeline.JobResult) TestCase {
+	tc := TestCase{Name: job.Name, Classname: classname}
+	if tc.Name == "" {
+		tc.Name = job.ID
+	}
+	if job.StartedAt != nil && job.FinishedAt != nil {
+		tc.Time = seconds(job.FinishedAt.Sub(*job.StartedAt))
+	}
+	switch job.Status {
+	case pipeline.StatusSucceeded:
+	case pipeline.StatusCached:
+		tc.SystemOut = "satisfied from cache"
+	case pipeline.StatusFailed, pipeline.StatusTimedOut:
+		tc.Failure = &Outcome{Message: job.Message, Type: string(job.Status), Text: job.Message}
+	default:
+		msg := job.Message
+		if msg == "" {
+			msg = string(job.Status)
+		}
+		tc.Skipped = &Outcome{Message: msg}
+	}
+	return tc
+}
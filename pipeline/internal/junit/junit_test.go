@@ -0,0 +1,79 @@
+package junit
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func at(base time.Time, d time.Duration) *time.Time {
+	t := base.Add(d)
+	return &t
+}
+
+func TestRenderMapsStagesAndJobs(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	run := &pipeline.Run{
+		ID:         "run-1",
+		Spec:       pipeline.Spec{Name: "build"},
+		Status:     pipeline.StatusFailed,
+		StartedAt:  at(base, 0),
+		FinishedAt: at(base, 10*time.Minute),
+		Stages: []pipeline.StageResult{
+			{Name: "test", Status: pipeline.StatusFailed, Jobs: []pipeline.JobResult{
+				{ID: "test-0", Name: "test (os=linux)", Status: pipeline.StatusSucceeded, StartedAt: at(base, time.Minute), FinishedAt: at(base, 3*time.Minute)},
+				{ID: "test-1", Name: "test (os=darwin)", Status: pipeline.StatusFailed, Message: "exit 1", StartedAt: at(base, time.Minute), FinishedAt: at(base, 4*time.Minute)},
+			}},
+			{Name: "deploy", Status: pipeline.StatusSkipped, Jobs: []pipeline.JobResult{
+				{ID: "deploy", Name: "deploy", Status: pipeline.StatusSkipped, Message: "upstream stage did not succeed"},
+			}},
+		},
+		Finally: []pipeline.StageResult{
+			{Name: "cleanup", Status: pipeline.StatusSucceeded, Jobs: []pipeline.JobResult{
+				{ID: "cleanup", Name: "cleanup", Status: pipeline.StatusSucceeded, StartedAt: at(base, 5*time.Minute), FinishedAt: at(base, 6*time.Minute)},
+			}},
+		},
+	}
+
+	out, err := Render(run)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !strings.HasPrefix(string(out), xml.Header) {
+		t.Fatalf("report does not start with the XML header:\n%s", out)
+	}
+	var doc TestSuites
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("report is not valid XML: %v\n%s", err, out)
+	}
+	if doc.Tests != 4 || doc.Failures != 1 || doc.Skipped != 1 || len(doc.Suites) != 3 {
+		t.Fatalf("totals = %d tests, %d failures, %d skipped in %d suites, want 4, 1, 1 in 3", doc.Tests, doc.Failures, doc.Skipped, len(doc.Suites))
+	}
+	for _, want := range []string{
+		`<testsuites name="build" tests="4" failures="1" skipped="1" time="600.000">`,
+		`<testsuite name="test" tests="2" failures="1" skipped="0" time="180.000" timestamp="2024-05-01T12:01:00Z">`,
+		`<testcase name="test (os=darwin)" classname="build.test" time="180.000">`,
+		`<failure message="exit 1" type="Failed">exit 1</failure>`,
+		`<skipped message="upstream stage did not succeed"></skipped>`,
+		`<property name="pipeline.stage.kind" value="finally"></property>`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("report lacks %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestRenderWithoutResults(t *testing.T) {
+	run := &pipeline.Run{
+		ID:     "run-1",
+		Status: pipeline.StatusFailed,
+		Stages: []pipeline.StageResult{{Name: "a", Jobs: []pipeline.JobResult{{ID: "a", Status: pipeline.StatusSkipped}}}},
+	}
+	if _, err := Render(run); !errors.Is(err, ErrNoResults) {
+		t.Fatalf("Render() error = %v, want ErrNoResults", err)
+	}
+}
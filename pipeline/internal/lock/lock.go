@@ -0,0 +1,286 @@
+// Package lock implements a Redis-backed distributed lock with fencing tokens
+// so that only one engine replica acts on a piece of shared state at a time.
+//
+// Every successful acquisition is assigned a fencing token taken from a
+// monotonic per-key counter. A holder that pauses past the lock TTL (GC
+// pause, network partition) and then resumes will find that the counter has
+// moved on and must not touch shared state: callers are expected to call
+// Lease.Check immediately before every mutation.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+const (
+	// DefaultTTL is used when no lock TTL is configured.
+	DefaultTTL = 30 * time.Second
+	// DefaultRefreshInterval is used when no refresh interval is configured.
+	DefaultRefreshInterval = 10 * time.Second
+
+	keyPrefix = "devmind:lock:"
+)
+
+var (
+	// ErrNotAcquired is returned when the lock is currently held by someone else.
+	ErrNotAcquired = errors.New("lock is held by another owner")
+	// ErrLockLost is returned when the lease expired or was taken over by a
+	// newer holder; the caller must stop acting on the protected state.
+	ErrLockLost = errors.New("lock lost")
+)
+
+// acquireScript sets the lock if it is free and, only then, bumps the fencing
+// counter so the token returned is strictly greater than any issued before.
+var acquireScript = redis.NewScript(`
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	return redis.call("INCR", KEYS[2])
+end
+return 0
+`)
+
+// refreshScript extends the TTL only if we still own the lock.
+var refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// checkScript confirms we still own the lock and that no newer fencing token
+// has been issued for it.
+var checkScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if tonumber(redis.call("GET", KEYS[2]) or "0") ~= tonumber(ARGV[2]) then
+	return 0
+end
+return 1
+`)
+
+// releaseScript deletes the lock only if we still own it.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Locker hands out leases on named locks.
+type Locker struct {
+	client  redis.UniversalClient
+	ttl     time.Duration
+	refresh time.Duration
+	logger  *logrus.Logger
+}
+
+// New creates a Locker using the lock timings from cfg, falling back to the
+// defaults for unset values. The refresh interval must be shorter than the
+// TTL, otherwise a healthy holder would routinely lose its lock.
+func New(client redis.UniversalClient, cfg config.RedisConfig, logger *logrus.Logger) (*Locker, error) {
+	ttl := cfg.LockTTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	refresh := cfg.LockRefreshInterval
+	if refresh <= 0 {
+		refresh = DefaultRefreshInterval
+	}
+	if refresh >= ttl {
+		return nil, fmt.Errorf("redis.lock_refresh_interval (%s) must be less than redis.lock_ttl (%s)", refresh, ttl)
+	}
+
+	return &Locker{
+		client:  client,
+		ttl:     ttl,
+		refresh: refresh,
+		logger:  logger,
+	}, nil
+}
+
+// Acquire tries once to take the named lock. It returns ErrNotAcquired if
+// another owner holds it. The returned lease is refreshed in the background
+// until Release is called or the lock is lost.
+func (l *Locker) Acquire(ctx context.Context, name string) (*Lease, error) {
+	owner, err := newOwnerID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate lock owner id: %w", err)
+	}
+
+	key := keyPrefix + name
+	start := time.Now()
+	token, err := acquireScript.Run(ctx, l.client, []string{key, key + ":fence"}, owner, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock %q: %w", name, err)
+	}
+	if token == 0 {
+		return nil, ErrNotAcquired
+	}
+
+	lease := &Lease{
+		locker:     l,
+		name:       name,
+		key:        key,
+		owner:      owner,
+		token:      token,
+		validUntil: start.Add(l.ttl),
+		lost:       make(chan struct{}),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go lease.keepAlive()
+
+	l.logger.WithFields(logrus.Fields{
+		"lock":  name,
+		"fence": token,
+	}).Debug("Acquired distributed lock")
+
+	return lease, nil
+}
+
+// Lease is a held lock together with its fencing token.
+type Lease struct {
+	locker *Locker
+	name   string
+	key    string
+	owner  string
+	token  int64
+
+	mu         sync.Mutex
+	validUntil time.Time
+
+	lostOnce sync.Once
+	lost     chan struct{}
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Token returns the fencing token issued for this lease. Tokens for the same
+// lock name are strictly increasing across holders.
+func (le *Lease) Token() int64 {
+	return le.token
+}
+
+// Lost is closed once the lease is known to be lost.
+func (le *Lease) Lost() <-chan struct{} {
+	return le.lost
+}
+
+// Check verifies that the lease is still valid and that no newer fencing
+// token has been issued. It must be called before mutating shared state;
+// a non-nil error means the caller has to abandon the mutation.
+func (le *Lease) Check(ctx context.Context) error {
+	select {
+	case <-le.lost:
+		return ErrLockLost
+	default:
+	}
+
+	// A holder that was paused may not have noticed the TTL passing. Refuse
+	// locally before even asking Redis.
+	le.mu.Lock()
+	expired := time.Now().After(le.validUntil)
+	le.mu.Unlock()
+	if expired {
+		le.markLost("lease expired before it could be refreshed")
+		return ErrLockLost
+	}
+
+	ok, err := checkScript.Run(ctx, le.locker.client, []string{le.key, le.key + ":fence"}, le.owner, le.token).Int()
+	if err != nil {
+		return fmt.Errorf("failed to check lock %q: %w", le.name, err)
+	}
+	if ok == 0 {
+		le.markLost("fencing token superseded")
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release stops refreshing the lease and deletes the lock if it is still
+// ours. Releasing an already lost lease is not an error.
+func (le *Lease) Release(ctx context.Context) error {
+	le.stopOnce.Do(func() { close(le.stop) })
+	<-le.done
+
+	if err := releaseScript.Run(ctx, le.locker.client, []string{le.key}, le.owner).Err(); err != nil {
+		return fmt.Errorf("failed to release lock %q: %w", le.name, err)
+	}
+	return nil
+}
+
+func (le *Lease) keepAlive() {
+	defer close(le.done)
+
+	ticker := time.NewTicker(le.locker.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-le.stop:
+			return
+		case <-le.lost:
+			return
+		case <-ticker.C:
+			le.extend()
+		}
+	}
+}
+
+func (le *Lease) extend() {
+	ctx, cancel := context.WithTimeout(context.Background(), le.locker.refresh)
+	defer cancel()
+
+	start := time.Now()
+	ok, err := refreshScript.Run(ctx, le.locker.client, []string{le.key}, le.owner, le.locker.ttl.Milliseconds()).Int()
+	if err != nil {
+		le.mu.Lock()
+		expired := time.Now().After(le.validUntil)
+		le.mu.Unlock()
+		if expired {
+			le.markLost(fmt.Sprintf("refresh failed past ttl: %v", err))
+			return
+		}
+		le.locker.logger.WithError(err).WithField("lock", le.name).Warn("Failed to refresh distributed lock, will retry")
+		return
+	}
+	if ok == 0 {
+		le.markLost("lock no longer owned")
+		return
+	}
+
+	le.mu.Lock()
+	le.validUntil = start.Add(le.locker.ttl)
+	le.mu.Unlock()
+}
+
+func (le *Lease) markLost(reason string) {
+	le.lostOnce.Do(func() {
+		close(le.lost)
+		le.locker.logger.WithFields(logrus.Fields{
+			"lock":   le.name,
+			"fence":  le.token,
+			"reason": reason,
+		}).Warn("Lost distributed lock")
+	})
+}
+
+func newOwnerID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
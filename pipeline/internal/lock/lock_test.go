@@ -0,0 +1,115 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func newTestLocker(t *testing.T, cfg config.RedisConfig) (*Locker, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	l, err := New(client, cfg, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return l, mr
+}
+
+func TestNewRejectsRefreshNotBelowTTL(t *testing.T) {
+	_, err := New(nil, config.RedisConfig{LockTTL: time.Second, LockRefreshInterval: time.Second}, logrus.New())
+	if err == nil {
+		t.Fatal("expected error when refresh interval equals ttl")
+	}
+}
+
+func TestAcquireIsExclusive(t *testing.T) {
+	l, _ := newTestLocker(t, config.RedisConfig{})
+	ctx := context.Background()
+
+	lease, err := l.Acquire(ctx, "repo@sha")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer lease.Release(ctx)
+
+	if _, err := l.Acquire(ctx, "repo@sha"); !errors.Is(err, ErrNotAcquired) {
+		t.Fatalf("second Acquire() error = %v, want ErrNotAcquired", err)
+	}
+}
+
+func TestFencingTokensIncrease(t *testing.T) {
+	l, _ := newTestLocker(t, config.RedisConfig{})
+	ctx := context.Background()
+
+	first, err := l.Acquire(ctx, "pipeline")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	second, err := l.Acquire(ctx, "pipeline")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer second.Release(ctx)
+
+	if second.Token() <= first.Token() {
+		t.Fatalf("token did not increase: first=%d second=%d", first.Token(), second.Token())
+	}
+}
+
+func TestStaleHolderFailsCheck(t *testing.T) {
+	l, mr := newTestLocker(t, config.RedisConfig{LockTTL: time.Minute, LockRefreshInterval: 30 * time.Second})
+	ctx := context.Background()
+
+	stale, err := l.Acquire(ctx, "pipeline")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if err := stale.Check(ctx); err != nil {
+		t.Fatalf("Check() on fresh lease error = %v", err)
+	}
+
+	// Simulate the holder pausing past the TTL while another replica takes over.
+	mr.FastForward(2 * time.Minute)
+	fresh, err := l.Acquire(ctx, "pipeline")
+	if err != nil {
+		t.Fatalf("Acquire() after expiry error = %v", err)
+	}
+	defer fresh.Release(ctx)
+
+	if err := stale.Check(ctx); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("stale Check() error = %v, want ErrLockLost", err)
+	}
+	select {
+	case <-stale.Lost():
+	default:
+		t.Fatal("Lost() channel not closed for stale lease")
+	}
+
+	// Releasing the stale lease must not delete the new holder's lock.
+	if err := stale.Release(ctx); err != nil {
+		t.Fatalf("stale Release() error = %v", err)
+	}
+	if err := fresh.Check(ctx); err != nil {
+		t.Fatalf("fresh Check() error = %v", err)
+	}
+}
@@ -0,0 +1,411 @@
+// Package logs captures pipeline output tagged by stage and serves it back,
+// either for a single stage or as the combined stream of the whole run.
+//
+// Each stage is stored in its own file (<root>/<run id>/<stage>.log, one JSON
+// line per record) so reading one branch of a parallel DAG never has to scan
+// the others. Records carry a per-run sequence number, which is what the
+// combined view is ordered by. A stage log purged by the Retention policy
+// leaves an empty <stage>.expired tombstone behind.
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+)
+
+// subscriberBuffer is how many lines a follower may fall behind before it is
+// disconnected.
+const subscriberBuffer = 256
+
+var (
+	// ErrNotFound is returned when no logs exist for the run or stage.
+	ErrNotFound = perrors.New(perrors.ErrNotFound, "logs not found")
+
+	stageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+// Line is a single captured log line.
+type Line struct {
+	Seq   int64     `json:"seq"`
+	Time  time.Time `json:"ts"`
+	Stage string    `json:"stage"`
+	Text  string    `json:"line"`
+}
+
+// Manager owns the log files of every run and fans live lines out to
+// followers.
+type Manager struct {
+	root string
+
+	mu   sync.Mutex
+	runs map[string]*runLog
+}
+
+// NewManager creates a Manager storing logs under root.
+func NewManager(root string) *Manager {
+	return &Manager{
+		root: root,
+		runs: make(map[string]*runLog),
+	}
+}
+
+// StageWriter returns a writer that captures everything written to it as
+// lines of the given stage. Partial lines are buffered until a newline or
+// Close.
+func (m *Manager) StageWriter(runID, stage string) (io.WriteCloser, error) {
+	if err := validName(runID); err != nil {
+		return nil, err
+	}
+	if err := validName(stage); err != nil {
+		return nil, err
+	}
+
+	rl, err := m.run(runID)
+	if err != nil {
+		return nil, err
+	}
+	return &stageWriter{run: rl, stage: stage}, nil
+}
+
+// Finish marks the run as complete: followers receive the remaining lines and
+// their streams end.
+func (m *Manager) Finish(runID string) {
+	m.mu.Lock()
+	rl, ok := m.runs[runID]
+	delete(m.runs, runID)
+	m.mu.Unlock()
+
+	if ok {
+		rl.finish()
+	}
+}
+
+// Read returns the stored lines of one stage, or of every stage in sequence
+// order when stage is empty. It fails with ErrExpired when the logs asked for
+// were purged by the retention policy.
+func (m *Manager) Read(runID, stage string) ([]Line, error) {
+	if !validQuery(runID, stage) {
+		return nil, ErrNotFound
+	}
+
+	m.mu.Lock()
+	rl, active := m.runs[runID]
+	m.mu.Unlock()
+	if active {
+		rl.mu.Lock()
+		defer rl.mu.Unlock()
+	}
+	return readLines(filepath.Join(m.root, runID), stage)
+}
+
+// Subscription is a live view of a run's logs.
+type Subscription struct {
+	// History holds the lines captured before the subscription started.
+	History []Line
+	// Lines delivers subsequent lines and is closed when the run finishes or
+	// the follower falls too far behind.
+	Lines <-chan Line
+
+	cancel func()
+}
+
+// Close stops delivery to the subscription.
+func (s *Subscription) Close() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// Subscribe returns the stored lines of the stage (all stages when empty)
+// together with a channel of lines captured from now on. For runs that are
+// not active in this process the channel is already closed.
+func (m *Manager) Subscribe(runID, stage string) (*Subscription, error) {
+	if !validQuery(runID, stage) {
+		return nil, ErrNotFound
+	}
+
+	m.mu.Lock()
+	rl, active := m.runs[runID]
+	m.mu.Unlock()
+
+	if !active {
+		history, err := m.Read(runID, stage)
+		if err != nil {
+			return nil, err
+		}
+		ch := make(chan Line)
+		close(ch)
+		return &Subscription{History: history, Lines: ch}, nil
+	}
+
+	// Holding the run lock while reading the history and registering the
+	// subscriber guarantees no line is missed or delivered twice.
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	history, err := readLines(rl.dir, stage)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrExpired) {
+		return nil, err
+	}
+
+	ch := make(chan Line, subscriberBuffer)
+	if rl.done {
+		close(ch)
+		return &Subscription{History: history, Lines: ch}, nil
+	}
+
+	sub := &subscriber{stage: stage, ch: ch}
+	rl.subs[sub] = struct{}{}
+	return &Subscription{
+		History: history,
+		Lines:   ch,
+		cancel:  func() { rl.unsubscribe(sub) },
+	}, nil
+}
+
+func (m *Manager) run(runID string) (*runLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if rl, ok := m.runs[runID]; ok {
+		return rl, nil
+	}
+
+	dir := filepath.Join(m.root, runID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory for run %s: %w", runID, err)
+	}
+	seq, err := lastSeq(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	rl := &runLog{
+		dir:   dir,
+		seq:   seq,
+		files: make(map[string]*os.File),
+		subs:  make(map[*subscriber]struct{}),
+	}
+	m.runs[runID] = rl
+	return rl, nil
+}
+
+type subscriber struct {
+	stage string
+	ch    chan Line
+}
+
+// runLog is the shared per-run state: open stage files, the sequence counter
+// and the followers.
+type runLog struct {
+	dir string
+
+	mu    sync.Mutex
+	seq   int64
+	files map[string]*os.File
+	subs  map[*subscriber]struct{}
+	done  bool
+}
+
+func (rl *runLog) append(stage, text string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.done {
+		return fmt.Errorf("log stream for stage %s is already finished", stage)
+	}
+
+	f, ok := rl.files[stage]
+	if !ok {
+		var err error
+		f, err = os.OpenFile(filepath.Join(rl.dir, stage+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log for stage %s: %w", stage, err)
+		}
+		rl.files[stage] = f
+	}
+
+	rl.seq++
+	line := Line{Seq: rl.seq, Time: time.Now().UTC(), Stage: stage, Text: text}
+	buf, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		return fmt.Errorf("failed to write log for stage %s: %w", stage, err)
+	}
+
+	for sub := range rl.subs {
+		if sub.stage != "" && sub.stage != stage {
+			continue
+		}
+		select {
+		case sub.ch <- line:
+		default:
+			// A follower that cannot keep up is cut off rather than
+			// allowed to stall the stage producing output.
+			delete(rl.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return nil
+}
+
+func (rl *runLog) unsubscribe(sub *subscriber) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if _, ok := rl.subs[sub]; ok {
+		delete(rl.subs, sub)
+		close(sub.ch)
+	}
+}
+
+func (rl *runLog) finish() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.done = true
+	for _, f := range rl.files {
+		f.Close()
+	}
+	for sub := range rl.subs {
+		close(sub.ch)
+	}
+	rl.subs = make(map[*subscriber]struct{})
+}
+
+type stageWriter struct {
+	run   *runLog
+	stage string
+	buf   bytes.Buffer
+}
+
+func (w *stageWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimSuffix(string(w.buf.Next(i + 1)[:i]), "\r")
+		if err := w.run.append(w.stage, line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (w *stageWriter) Close() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	line := w.buf.String()
+	w.buf.Reset()
+	return w.run.append(w.stage, line)
+}
+
+func readLines(dir, stage string) ([]Line, error) {
+	var files []string
+	if stage != "" {
+		files = []string{filepath.Join(dir, stage+".log")}
+	} else {
+		var err error
+		files, err = filepath.Glob(filepath.Join(dir, "*.log"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var lines []Line
+	found := false
+	for _, path := range files {
+		stageLines, err := readFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		lines = append(lines, stageLines...)
+	}
+	if !found {
+		if expired(dir, stage) {
+			return nil, ErrExpired
+		}
+		return nil, ErrNotFound
+	}
+
+	if stage == "" {
+		sort.Slice(lines, func(i, j int) bool { return lines[i].Seq < lines[j].Seq })
+	}
+	return lines, nil
+}
+
+func readFile(path string) ([]Line, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []Line
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var line Line
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("corrupt log record in %s: %w", path, err)
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// lastSeq finds the highest sequence number already on disk so a run resumed
+// after a restart keeps a consistent order.
+func lastSeq(dir string) (int64, error) {
+	lines, err := readLines(dir, "")
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrExpired) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+	return lines[len(lines)-1].Seq, nil
+}
+
+// validQuery reports whether runID and the optional stage filter could name
+// stored logs at all.
+func validQuery(runID, stage string) bool {
+	if validName(runID) != nil {
+		return false
+	}
+	return stage == "" || validName(stage) == nil
+}
+
+func validName(name string) error {
+	if !stageNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package logs
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func writeStage(t *testing.T, w io.Writer, s string) {
+	t.Helper()
+	if _, err := io.WriteString(w, s); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestReadPerStageAndCombined(t *testing.T) {
+	m := NewManager(t.TempDir())
+
+	build, err := m.StageWriter("run-1", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test, err := m.StageWriter("run-1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeStage(t, build, "compiling\n")
+	writeStage(t, test, "running ")
+	writeStage(t, build, "linking\n")
+	writeStage(t, test, "tests\n")
+
+	lines, err := m.Read("run-1", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Text != "compiling" || lines[1].Text != "linking" {
+		t.Fatalf("build lines = %+v", lines)
+	}
+
+	all, err := m.Read("run-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"compiling", "linking", "running tests"}
+	if len(all) != len(want) {
+		t.Fatalf("combined lines = %+v", all)
+	}
+	for i, line := range all {
+		if line.Text != want[i] {
+			t.Errorf("combined[%d] = %q, want %q", i, line.Text, want[i])
+		}
+	}
+}
+
+func TestSubscribeFiltersByStage(t *testing.T) {
+	m := NewManager(t.TempDir())
+
+	build, _ := m.StageWriter("run-1", "build")
+	test, _ := m.StageWriter("run-1", "test")
+	writeStage(t, build, "before\n")
+
+	sub, err := m.Subscribe("run-1", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if len(sub.History) != 1 || sub.History[0].Text != "before" {
+		t.Fatalf("history = %+v", sub.History)
+	}
+
+	writeStage(t, test, "ignored\n")
+	writeStage(t, build, "after\n")
+	m.Finish("run-1")
+
+	var got []string
+	for line := range sub.Lines {
+		got = append(got, line.Text)
+	}
+	if len(got) != 1 || got[0] != "after" {
+		t.Fatalf("live lines = %v, want [after]", got)
+	}
+}
+
+func TestReadUnknownStage(t *testing.T) {
+	m := NewManager(t.TempDir())
+	build, _ := m.StageWriter("run-1", "build")
+	writeStage(t, build, "x\n")
+
+	if _, err := m.Read("run-1", "deploy"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read() error = %v, want ErrNotFound", err)
+	}
+	if _, err := m.Read("run-1", "../run-1/build"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read() error = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,174 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// DefaultPurgeInterval is used when logs.purge_interval is not set.
+const DefaultPurgeInterval = time.Hour
+
+// expiredSuffix names the tombstone left behind when a stage's log is
+// purged, so a purged log can be told apart from one that never existed.
+const expiredSuffix = ".expired"
+
+// ErrExpired is returned when the requested logs existed but were purged by
+// the log retention policy.
+var ErrExpired = errors.New("logs expired")
+
+// Retention is how long stage logs are kept after their last line. It is
+// independent of how long the run itself is kept, so bulky logs can go long
+// before the run record does.
+type Retention struct {
+	// Default applies to every stage without an entry in Stages. Zero keeps
+	// logs forever.
+	Default time.Duration
+	// Stages overrides Default by stage name; zero keeps that stage's logs
+	// forever.
+	Stages map[string]time.Duration
+}
+
+// For returns the retention of stage.
+func (r Retention) For(stage string) time.Duration {
+	if d, ok := r.Stages[stage]; ok {
+		return d
+	}
+	return r.Default
+}
+
+func (r Retention) enabled() bool {
+	if r.Default > 0 {
+		return true
+	}
+	for _, d := range r.Stages {
+		if d > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Purge deletes the stage logs whose last line is older than their retention
+// and returns how many it deleted. Logs of runs active in this process are
+// left alone.
+func (m *Manager) Purge(ctx context.Context, r Retention, now time.Time) (int, error) {
+	if !r.enabled() {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(m.root)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list log directories: %w", err)
+	}
+
+	purged := 0
+	for _, e := range entries {
+		if !e.IsDir() || validName(e.Name()) != nil {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		n, err := m.purgeRun(e.Name(), r, now)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func (m *Manager) purgeRun(runID string, r Retention, now time.Time) (int, error) {
+	// Holding the manager lock keeps the run from becoming active, and new
+	// lines from being appended, while its files are removed.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, active := m.runs[runID]; active {
+		return 0, nil
+	}
+
+	dir := filepath.Join(m.root, runID)
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, path := range files {
+		stage := strings.TrimSuffix(filepath.Base(path), ".log")
+		keep := r.For(stage)
+		if keep <= 0 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return purged, fmt.Errorf("failed to stat log of stage %s of run %s: %w", stage, runID, err)
+		}
+		if now.Sub(info.ModTime()) <= keep {
+			continue
+		}
+		// The tombstone goes first: a crash in between leaves a readable log
+		// that is purged again next time, never a missing one that reads as
+		// never written.
+		if err := os.WriteFile(filepath.Join(dir, stage+expiredSuffix), nil, 0o644); err != nil {
+			return purged, fmt.Errorf("failed to mark log of stage %s of run %s expired: %w", stage, runID, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return purged, fmt.Errorf("failed to purge log of stage %s of run %s: %w", stage, runID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// RunPurger purges expired logs every interval of clk until ctx is done. A
+// nil clk is the wall clock.
+func (m *Manager) RunPurger(ctx context.Context, r Retention, interval time.Duration, clk clock.Clock, logger *logrus.Logger) {
+	if !r.enabled() {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+	clk = clock.Or(clk)
+	ticker := clk.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := m.Purge(ctx, r, clk.Now())
+		if n > 0 {
+			metrics.LogsPurged.Add(float64(n))
+			logger.WithField("stages", n).Info("Purged expired pipeline logs")
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.WithError(err).Error("Failed to purge expired pipeline logs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// expired reports whether the log of stage, or of any stage when stage is
+// empty, was purged from dir.
+func expired(dir, stage string) bool {
+	if stage != "" {
+		_, err := os.Stat(filepath.Join(dir, stage+expiredSuffix))
+		return err == nil
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"+expiredSuffix))
+	return len(matches) > 0
+}
@@ -0,0 +1,65 @@
+package logs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPurgeHonoursStageRetention(t *testing.T) {
+	m := NewManager(t.TempDir())
+	for _, stage := range []string{"build", "integration"} {
+		w, err := m.StageWriter("run-1", stage)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeStage(t, w, stage+" output\n")
+	}
+	active, _ := m.StageWriter("run-2", "integration")
+	writeStage(t, active, "still running\n")
+	m.Finish("run-1")
+
+	r := Retention{Default: 30 * 24 * time.Hour, Stages: map[string]time.Duration{"integration": 24 * time.Hour}}
+	n, err := m.Purge(context.Background(), r, time.Now().Add(48*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("Purge() = %d, want 1", n)
+	}
+
+	if _, err := m.Read("run-1", "integration"); !errors.Is(err, ErrExpired) {
+		t.Fatalf("Read(integration) error = %v, want ErrExpired", err)
+	}
+	if _, err := m.Read("run-1", "deploy"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Read(deploy) error = %v, want ErrNotFound", err)
+	}
+	lines, err := m.Read("run-1", "")
+	if err != nil || len(lines) != 1 || lines[0].Stage != "build" {
+		t.Fatalf("Read() = %+v, %v, want the build line only", lines, err)
+	}
+	if _, err := m.Read("run-2", "integration"); err != nil {
+		t.Fatalf("active run purged: %v", err)
+	}
+
+	// Once every stage is gone the whole run reads as expired.
+	if _, err := m.Purge(context.Background(), r, time.Now().Add(31*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Read("run-1", ""); !errors.Is(err, ErrExpired) {
+		t.Fatalf("Read() error = %v, want ErrExpired", err)
+	}
+}
+
+func TestPurgeWithoutRetentionKeepsLogs(t *testing.T) {
+	m := NewManager(t.TempDir())
+	w, _ := m.StageWriter("run-1", "build")
+	writeStage(t, w, "x\n")
+	m.Finish("run-1")
+
+	n, err := m.Purge(context.Background(), Retention{}, time.Now().Add(365*24*time.Hour))
+	if err != nil || n != 0 {
+		t.Fatalf("Purge() = %d, %v, want 0, nil", n, err)
+	}
+}
@@ -0,0 +1,137 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Chain lists the downstream pipelines submitted once a run ends with the
+// outcome it is declared for.
+type Chain struct {
+	Trigger []Trigger `json:"trigger"`
+}
+
+// Trigger submits a downstream pipeline.
+type Trigger struct {
+	Pipeline *Spec `json:"pipeline"`
+
+	// Params are given to the downstream run at submission, over its spec's
+	// own. Values may reference the upstream run as $(run.id), $(run.name),
+	// $(run.repo), $(run.branch), $(run.commit) and $(run.status), and its
+	// params as $(params.<name>).
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Upstream links a run submitted by a trigger to the run that triggered it.
+type Upstream struct {
+	RunID    string `json:"run_id"`
+	Pipeline string `json:"pipeline"`
+	// Depth counts the triggered runs from the first run of the chain to
+	// this one, this one included.
+	Depth int `json:"depth"`
+	// Chain names the pipelines of the runs leading to this one, the first
+	// run of the chain first and the upstream run last, for cycle
+	// detection.
+	Chain []string `json:"chain"`
+}
+
+// Triggers returns the downstream triggers for a run that ended in status:
+// those of on_success for a successful run, of on_failure for a failed or
+// timed out one, and none otherwise.
+func (s *Spec) Triggers(status Status) []Trigger {
+	var c *Chain
+	switch status {
+	case StatusSucceeded:
+		c = s.OnSuccess
+	case StatusFailed, StatusTimedOut:
+		c = s.OnFailure
+	}
+	if c == nil {
+		return nil
+	}
+	return c.Trigger
+}
+
+// triggerRef matches the references of trigger params.
+var triggerRef = regexp.MustCompile(`\$\(([^)]*)\)`)
+
+// triggerRunFields are the run fields trigger params may reference.
+var triggerRunFields = map[string]func(*Run) string{
+	"id":     func(r *Run) string { return r.ID },
+	"name":   func(r *Run) string { return r.Spec.Name },
+	"repo":   func(r *Run) string { return r.Spec.Repo },
+	"branch": func(r *Run) string { return r.Spec.Branch },
+	"commit": func(r *Run) string { return r.Spec.Commit },
+	"status": func(r *Run) string { return string(r.Status) },
+}
+
+// ExpandParams returns the trigger's params with their references to the
+// upstream run resolved.
+func (t Trigger) ExpandParams(upstream *Run) map[string]string {
+	if len(t.Params) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(t.Params))
+	for k, v := range t.Params {
+		params[k] = triggerRef.ReplaceAllStringFunc(v, func(ref string) string {
+			name := ref[2 : len(ref)-1]
+			if field, ok := strings.CutPrefix(name, "run."); ok {
+				return triggerRunFields[field](upstream)
+			}
+			p, _ := strings.CutPrefix(name, "params.")
+			return upstream.Spec.Params[p]
+		})
+	}
+	return params
+}
+
+// validateChain checks the triggers of on_success or on_failure, the
+// downstream specs included as they would be at submission.
+func validateChain(issues *Issues, path string, c *Chain, policy Policy) {
+	if c == nil {
+		return
+	}
+	if len(c.Trigger) == 0 {
+		issues.errorf(path+".trigger", "at least one trigger is required")
+	}
+	for i, t := range c.Trigger {
+		tp := fmt.Sprintf("%s.trigger[%d]", path, i)
+		for _, k := range sortedKeys(t.Params) {
+			for _, m := range triggerRef.FindAllStringSubmatch(t.Params[k], -1) {
+				if !validTriggerRef(m[1]) {
+					issues.errorf(tp+".params."+k, "unknown reference %s, want $(run.<field>) or $(params.<name>)", m[0])
+				}
+			}
+		}
+		if t.Pipeline == nil {
+			issues.errorf(tp+".pipeline", "is required")
+			continue
+		}
+		for _, is := range Validate(t.Pipeline, policy) {
+			is.Path = tp + ".pipeline." + is.Path
+			*issues = append(*issues, is)
+		}
+	}
+}
+
+func validTriggerRef(name string) bool {
+	if field, ok := strings.CutPrefix(name, "run."); ok {
+		_, known := triggerRunFields[field]
+		return known
+	}
+	p, ok := strings.CutPrefix(name, "params.")
+	return ok && p != ""
+}
+
+// normalizeChain normalizes the downstream specs of c.
+func normalizeChain(c *Chain) {
+	if c == nil {
+		return
+	}
+	for _, t := range c.Trigger {
+		if t.Pipeline != nil {
+			Normalize(t.Pipeline)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package pipeline
+
+// Coverage declares where a run's code coverage comes from and the gates it
+// must pass. A run failing a gate fails, with a reason naming the gate.
+type Coverage struct {
+	// Stage names the stage whose parsed results report the coverage, a
+	// percentage of statements. For matrix stages it is the mean of the
+	// jobs that report one.
+	Stage string `json:"stage"`
+	// Min is the lowest coverage percentage a run may report. Zero
+	// disables the gate.
+	Min float64 `json:"min,omitempty"`
+	// MaxDrop is how many percentage points a run's coverage may fall below
+	// the baseline, the coverage of the last succeeded run of the pipeline
+	// on the same branch. Zero disables the gate.
+	MaxDrop float64 `json:"max_drop,omitempty"`
+}
+
+// StageCoverage returns the coverage reported by the jobs of the named stage
+// of run, and false when none reported any.
+func StageCoverage(run *Run, stage string) (float64, bool) {
+	var sum float64
+	n := 0
+	for _, st := range run.Stages {
+		if st.Name != stage {
+			continue
+		}
+		for _, job := range st.Jobs {
+			if job.Results != nil && job.Results.Coverage != nil {
+				sum += *job.Results.Coverage
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return sum / float64(n), true
+}
+
+// validateCoverage checks that coverage names a stage that parses results
+// and that its gates are percentages.
+func validateCoverage(issues *Issues, spec *Spec) {
+	c := spec.Coverage
+	if c == nil {
+		return
+	}
+	if c.Stage == "" {
+		issues.errorf("coverage.stage", "is required")
+	} else {
+		var found *Stage
+		for i := range spec.Stages {
+			if spec.Stages[i].Name == c.Stage {
+				found = &spec.Stages[i]
+			}
+		}
+		switch {
+		case found == nil:
+			issues.errorf("coverage.stage", "unknown stage %q", c.Stage)
+		case found.ResultParser == "":
+			issues.errorf("coverage.stage", "stage %q has no result_parser to report coverage", c.Stage)
+		}
+	}
+	if c.Min < 0 || c.Min > 100 {
+		issues.errorf("coverage.min", "must be between 0 and 100, got %g", c.Min)
+	}
+	if c.MaxDrop < 0 || c.MaxDrop > 100 {
+		issues.errorf("coverage.max_drop", "must be between 0 and 100, got %g", c.MaxDrop)
+	}
+}
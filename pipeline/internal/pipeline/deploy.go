@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"strings"
+	"time"
+)
+
+// Deploy names the ArgoCD application a run syncs once its stages have
+// succeeded. A deploy that fails or does not become healthy within
+// argocd.timeout fails the run.
+type Deploy struct {
+	Application string `json:"application"`
+	// Revision is the revision to sync to. Empty syncs the application's
+	// target revision; $(run.commit) syncs the run's commit.
+	Revision string `json:"revision,omitempty"`
+	// Prune deletes resources no longer in the application's manifests.
+	Prune bool `json:"prune,omitempty"`
+}
+
+// RunCommitRef is the Revision of a deploy that syncs the run's commit.
+const RunCommitRef = "$(run.commit)"
+
+// SyncRevision returns the revision to sync for run.
+func (d *Deploy) SyncRevision(run *Run) string {
+	if d.Revision == RunCommitRef {
+		return run.Spec.Commit
+	}
+	return d.Revision
+}
+
+// DeployResult records the deploy of a run.
+type DeployResult struct {
+	Application string `json:"application"`
+	// Status is Running while waiting for the application, then Succeeded,
+	// Failed, TimedOut, or Skipped when ArgoCD is not configured.
+	Status       Status `json:"status"`
+	Revision     string `json:"revision,omitempty"`
+	SyncStatus   string `json:"sync_status,omitempty"`
+	HealthStatus string `json:"health_status,omitempty"`
+	Message      string `json:"message,omitempty"`
+
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	// Rollback is set when the application stayed Degraded after the sync
+	// and was rolled back; see argocd.rollback_enabled.
+	Rollback *DeployRollback `json:"rollback,omitempty"`
+}
+
+// DeployRollback records the rollback of a deployed application to its
+// previous synced revision.
+type DeployRollback struct {
+	// Status is Succeeded, or Failed when ArgoCD refused the rollback.
+	Status  Status    `json:"status"`
+	From    string    `json:"from,omitempty"`
+	To      string    `json:"to,omitempty"`
+	Message string    `json:"message,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// validateDeploy checks that deploy names an application.
+func validateDeploy(issues *Issues, d *Deploy) {
+	if d == nil {
+		return
+	}
+	switch {
+	case d.Application == "":
+		issues.errorf("deploy.application", "is required")
+	case strings.ContainsAny(d.Application, " \t\n/"):
+		issues.errorf("deploy.application", "must be an ArgoCD application name, got %q", d.Application)
+	}
+	if strings.Contains(d.Revision, "$(") && d.Revision != RunCommitRef {
+		issues.errorf("deploy.revision", "may only reference %s, got %q", RunCommitRef, d.Revision)
+	}
+}
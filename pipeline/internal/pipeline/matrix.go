@@ -0,0 +1,134 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Job is one unit of execution: a plain stage, or a single combination of a
+// matrix stage.
+type Job struct {
+	// ID uniquely identifies the job within the run, e.g. "test" or "test-3".
+	ID    string
+	Stage *Stage
+	// Finally is set for jobs of the spec's finally stages.
+	Finally bool
+	// PostRun is set for jobs of the spec's post-run hook.
+	PostRun bool
+	// Matrix holds this job's parameter values for matrix stages.
+	Matrix map[string]string
+	// Secrets are injected into the job's environment as secrets. They are
+	// never persisted or logged.
+	Secrets map[string]string
+	// Attempt counts the retries of the job before this run of it, zero
+	// for its first run.
+	Attempt int
+}
+
+// Params returns the stage parameters merged with the job's matrix values.
+func (j Job) Params() map[string]string {
+	params := make(map[string]string, len(j.Stage.Params)+len(j.Matrix))
+	for k, v := range j.Stage.Params {
+		params[k] = v
+	}
+	for k, v := range j.Matrix {
+		params[k] = v
+	}
+	return params
+}
+
+// DisplayName returns a human readable job name such as
+// "test (go=1.21, os=linux)".
+func (j Job) DisplayName() string {
+	if len(j.Matrix) == 0 {
+		return j.Stage.Name
+	}
+	keys := sortedKeys(j.Matrix)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + j.Matrix[k]
+	}
+	return fmt.Sprintf("%s (%s)", j.Stage.Name, strings.Join(parts, ", "))
+}
+
+// Jobs expands a stage into its jobs. Matrix combinations are generated in a
+// stable order: parameters sorted by name, values in declaration order.
+func (s *Stage) Jobs() []Job {
+	if s.Matrix == nil || len(s.Matrix.Params) == 0 {
+		return []Job{{ID: s.Name, Stage: s}}
+	}
+
+	combos := []map[string]string{{}}
+	for _, key := range sortedKeys(s.Matrix.Params) {
+		var next []map[string]string
+		for _, combo := range combos {
+			for _, v := range s.Matrix.Params[key] {
+				c := make(map[string]string, len(combo)+1)
+				for k, cv := range combo {
+					c[k] = cv
+				}
+				c[key] = v
+				next = append(next, c)
+			}
+		}
+		combos = next
+	}
+
+	jobs := make([]Job, len(combos))
+	for i, combo := range combos {
+		jobs[i] = Job{ID: fmt.Sprintf("%s-%d", s.Name, i), Stage: s, Matrix: combo}
+	}
+	return jobs
+}
+
+// JobCount returns the number of jobs the stages, finally stages and
+// post-run hook of s expand to, without expanding them. Counting stops past
+// limit, so an absurd matrix is never multiplied out; any result above limit
+// only means "more than limit".
+func (s *Spec) JobCount(limit int) int {
+	n := 0
+	count := func(st *Stage) bool {
+		n += st.jobCount(limit - n)
+		return n <= limit
+	}
+	for i := range s.Stages {
+		if !count(&s.Stages[i]) {
+			return n
+		}
+	}
+	for i := range s.Finally {
+		if !count(&s.Finally[i]) {
+			return n
+		}
+	}
+	if s.PostRun != nil {
+		count(s.PostRun)
+	}
+	return n
+}
+
+// jobCount returns the number of jobs of the stage, or limit+1 once it
+// exceeds limit.
+func (s *Stage) jobCount(limit int) int {
+	if s.Matrix == nil || len(s.Matrix.Params) == 0 {
+		return 1
+	}
+	n := 1
+	for _, values := range s.Matrix.Params {
+		n *= len(values)
+		if n > limit {
+			return limit + 1
+		}
+	}
+	return n
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
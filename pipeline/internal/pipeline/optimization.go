@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"maps"
+	"slices"
+)
+
+// BuildCache is a build cache kept across runs for the jobs of a stage: a
+// directory of the cache volume, named by Key, mounted at Path.
+type BuildCache struct {
+	Stage string `json:"stage"`
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+}
+
+// BuildOptimization records the build optimization advice of the AI service
+// for a run.
+type BuildOptimization struct {
+	Strategy string `json:"strategy,omitempty"`
+	// EstimatedSeconds is the build time the service predicted.
+	EstimatedSeconds float64 `json:"estimated_seconds"`
+	// Caches are the suggested build caches given to the run's jobs.
+	Caches []BuildCache `json:"caches,omitempty"`
+	// Parallelism holds the suggested number of concurrent jobs by stage.
+	// It is advice only; the spec's limits apply.
+	Parallelism map[string]int `json:"parallelism,omitempty"`
+	// Ignored says why each suggestion the engine could not apply was
+	// left out.
+	Ignored []string `json:"ignored,omitempty"`
+}
+
+func (o *BuildOptimization) clone() *BuildOptimization {
+	c := *o
+	c.Caches = slices.Clone(o.Caches)
+	c.Parallelism = maps.Clone(o.Parallelism)
+	c.Ignored = slices.Clone(o.Ignored)
+	return &c
+}
@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const paramsSchemaURL = "params_schema.json"
+
+// paramsSchemaShape is the part of a params schema needed to convert string
+// params to typed JSON values and to apply defaults.
+type paramsSchemaShape struct {
+	Properties map[string]struct {
+		Type    interface{} `json:"type"`
+		Default interface{} `json:"default"`
+	} `json:"properties"`
+}
+
+func compileParamsSchema(raw json.RawMessage) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(paramsSchemaURL, bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid params schema: %w", err)
+	}
+	schema, err := c.Compile(paramsSchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid params schema: %w", err)
+	}
+	return schema, nil
+}
+
+// ResolveParams merges the params given at submission over the spec's own
+// params, fills in schema defaults and validates the result against the
+// spec's params schema. Params are strings; values of properties the schema
+// types as integer, number, boolean, array or object are parsed as such
+// before validation.
+func ResolveParams(spec *Spec, submitted map[string]string) (map[string]string, Issues) {
+	params := make(map[string]string, len(spec.Params)+len(submitted))
+	for k, v := range spec.Params {
+		params[k] = v
+	}
+	for k, v := range submitted {
+		params[k] = v
+	}
+	if len(spec.ParamsSchema) == 0 {
+		return params, nil
+	}
+
+	var issues Issues
+	schema, err := compileParamsSchema(spec.ParamsSchema)
+	if err != nil {
+		issues.errorf("params_schema", "%v", err)
+		return params, issues
+	}
+	var shape paramsSchemaShape
+	// Compilation succeeded, so the schema is valid JSON; a non-object
+	// schema simply has no properties.
+	_ = json.Unmarshal(spec.ParamsSchema, &shape)
+
+	for name, prop := range shape.Properties {
+		if _, ok := params[name]; ok || prop.Default == nil {
+			continue
+		}
+		if s, ok := prop.Default.(string); ok {
+			params[name] = s
+		} else {
+			b, _ := json.Marshal(prop.Default)
+			params[name] = string(b)
+		}
+	}
+
+	doc := make(map[string]interface{}, len(params))
+	for name, v := range params {
+		typed, err := typedParam(v, shape.Properties[name].Type)
+		if err != nil {
+			issues.errorf("params."+name, "%v", err)
+			continue
+		}
+		doc[name] = typed
+	}
+	if issues.HasErrors() {
+		return params, issues
+	}
+
+	if err := schema.Validate(doc); err != nil {
+		var ve *jsonschema.ValidationError
+		if !errors.As(err, &ve) {
+			issues.errorf("params", "%v", err)
+			return params, issues
+		}
+		for _, leaf := range leafErrors(ve) {
+			path := "params"
+			if loc := strings.TrimPrefix(leaf.InstanceLocation, "/"); loc != "" {
+				path += "." + strings.ReplaceAll(loc, "/", ".")
+			}
+			issues.errorf(path, "%s", leaf.Message)
+		}
+	}
+	return params, issues
+}
+
+// typedParam converts a string param to the JSON type declared for it. A
+// property may declare several types; the first that parses wins.
+func typedParam(v string, declared interface{}) (interface{}, error) {
+	var types []string
+	switch t := declared.(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, x := range t {
+			if s, ok := x.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	if len(types) == 0 {
+		return v, nil
+	}
+
+	for _, t := range types {
+		switch t {
+		case "string":
+			return v, nil
+		case "integer", "number":
+			if n := json.Number(v); isNumber(n) {
+				return n, nil
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		case "array", "object", "null":
+			var x interface{}
+			dec := json.NewDecoder(strings.NewReader(v))
+			dec.UseNumber()
+			if err := dec.Decode(&x); err == nil {
+				return x, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%q is not a valid %s", v, strings.Join(types, " or "))
+}
+
+func isNumber(n json.Number) bool {
+	_, err := n.Float64()
+	return err == nil
+}
+
+// leafErrors flattens a validation error tree into its most specific causes,
+// which carry the useful messages.
+func leafErrors(ve *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(ve.Causes) == 0 {
+		return []*jsonschema.ValidationError{ve}
+	}
+	var out []*jsonschema.ValidationError
+	for _, c := range ve.Causes {
+		out = append(out, leafErrors(c)...)
+	}
+	return out
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"testing"
+)
+
+const paramsSpec = `
+name: deploy
+params:
+  region: eu-west-1
+params_schema:
+  type: object
+  required: [env]
+  properties:
+    env:
+      type: string
+      enum: [staging, production]
+    replicas:
+      type: integer
+      minimum: 1
+      default: 2
+    region:
+      type: string
+stages:
+- name: apply
+  image: ghcr.io/org/deploy:1.0
+`
+
+func parseSpec(t *testing.T, doc string) *Spec {
+	t.Helper()
+	spec, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	Normalize(spec)
+	return spec
+}
+
+func TestResolveParamsAppliesDefaults(t *testing.T) {
+	spec := parseSpec(t, paramsSpec)
+	if issues := Validate(spec, Policy{}); issues.HasErrors() {
+		t.Fatalf("Validate() = %v", issues)
+	}
+
+	params, issues := ResolveParams(spec, map[string]string{"env": "staging"})
+	if issues.HasErrors() {
+		t.Fatalf("ResolveParams() issues = %v", issues)
+	}
+	want := map[string]string{"env": "staging", "replicas": "2", "region": "eu-west-1"}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("params[%q] = %q, want %q", k, params[k], v)
+		}
+	}
+}
+
+func TestResolveParamsRejectsInvalidInput(t *testing.T) {
+	spec := parseSpec(t, paramsSpec)
+
+	cases := []struct {
+		name      string
+		submitted map[string]string
+		want      string
+	}{
+		{"missing required", nil, "env"},
+		{"not in enum", map[string]string{"env": "qa"}, "params.env"},
+		{"not an integer", map[string]string{"env": "staging", "replicas": "two"}, "params.replicas"},
+		{"below minimum", map[string]string{"env": "staging", "replicas": "0"}, "params.replicas"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, issues := ResolveParams(spec, tc.submitted)
+			if !hasIssue(issues, SeverityError, tc.want) {
+				t.Fatalf("issues = %v, want an error mentioning %q", issues, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsBrokenParamsSchema(t *testing.T) {
+	issues := validate(t, `
+name: p
+params_schema:
+  type: 42
+stages:
+- name: a
+  image: ghcr.io/org/a:1
+`, Policy{})
+	if !hasIssue(issues, SeverityError, "params_schema") {
+		t.Fatalf("issues = %v", issues)
+	}
+}
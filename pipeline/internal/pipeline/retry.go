@@ -0,0 +1,108 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Error classes of a failed job. A stage's retry policy picks the classes
+// worth retrying, so transient failures are retried and deterministic ones
+// fail at once.
+const (
+	// ErrorClassInfra is a job that could not run or finish for reasons
+	// outside it: its TaskRun or pod could not be created, an image could
+	// not be pulled or the cluster API kept failing.
+	ErrorClassInfra = "infra"
+	// ErrorClassTimeout is a job that exceeded its stage timeout.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassOOM is a job with a step killed for exceeding its memory
+	// limit.
+	ErrorClassOOM = "oom"
+	// ErrorClassFailed is a job that ran and failed, such as a step exiting
+	// non-zero. It is the class of every failure not classified otherwise.
+	ErrorClassFailed = "failed"
+)
+
+// ErrorClasses lists the valid error classes.
+var ErrorClasses = []string{ErrorClassInfra, ErrorClassTimeout, ErrorClassOOM, ErrorClassFailed}
+
+// MaxRetryAttempts bounds the retries of a job.
+const MaxRetryAttempts = 10
+
+// RetryPolicy runs the failed jobs of a stage again.
+type RetryPolicy struct {
+	// Attempts is how many times a failed job is retried.
+	Attempts int `json:"attempts"`
+	// On lists the error classes retried. Empty retries infra failures
+	// only.
+	On []string `json:"on,omitempty"`
+}
+
+// Retries reports whether the policy retries failures of class.
+func (p *RetryPolicy) Retries(class string) bool {
+	if p == nil || p.Attempts <= 0 {
+		return false
+	}
+	if len(p.On) == 0 {
+		return class == ErrorClassInfra
+	}
+	for _, c := range p.On {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// JobError is a job failure its runner classified.
+type JobError struct {
+	Class string
+	Err   error
+}
+
+func (e *JobError) Error() string { return e.Err.Error() }
+
+func (e *JobError) Unwrap() error { return e.Err }
+
+// ErrorClass returns the class a runner gave err with a JobError, and
+// ErrorClassFailed for an unclassified err.
+func ErrorClass(err error) string {
+	var jerr *JobError
+	if errors.As(err, &jerr) && jerr.Class != "" {
+		return jerr.Class
+	}
+	return ErrorClassFailed
+}
+
+// normalizeRetry de-duplicates and sorts the classes of a retry policy.
+func normalizeRetry(p *RetryPolicy) {
+	if p == nil {
+		return
+	}
+	seen := make(map[string]bool, len(p.On))
+	on := p.On[:0]
+	for _, c := range p.On {
+		if !seen[c] {
+			seen[c] = true
+			on = append(on, c)
+		}
+	}
+	sort.Strings(on)
+	p.On = on
+}
+
+func validateRetry(issues *Issues, path string, p *RetryPolicy) {
+	if p.Attempts < 1 || p.Attempts > MaxRetryAttempts {
+		issues.errorf(path+".attempts", "must be between 1 and %d, got %d", MaxRetryAttempts, p.Attempts)
+	}
+	for i, c := range p.On {
+		known := false
+		for _, k := range ErrorClasses {
+			known = known || c == k
+		}
+		if !known {
+			issues.errorf(fmt.Sprintf("%s.on[%d]", path, i), "unknown error class %q (infra, timeout, oom, failed)", c)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package pipeline
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInsufficientCapacity is returned by admission checks when the cluster
+// clearly cannot run a pipeline's resource requests.
+var ErrInsufficientCapacity = errors.New("insufficient capacity")
+
+// Status is the state of a run, stage or job.
+type Status string
+
+const (
+	StatusQueued    Status = "Queued"
+	StatusPending   Status = "Pending"
+	StatusRunning   Status = "Running"
+	StatusSucceeded Status = "Succeeded"
+	StatusFailed    Status = "Failed"
+	StatusSkipped   Status = "Skipped"
+	StatusCancelled Status = "Cancelled"
+	// StatusCached marks a job satisfied from cache without executing.
+	StatusCached Status = "Cached"
+	// StatusTimedOut marks a job that exceeded its stage timeout, or a run
+	// that exceeded the engine's hard timeout.
+	StatusTimedOut Status = "TimedOut"
+	// StatusOrphaned marks a run whose replica shut down before it
+	// finished. It is not terminal: the run's TaskRuns may still be
+	// executing, and a restarted replica is expected to reconcile it.
+	StatusOrphaned Status = "Orphaned"
+	// StatusDebounced marks a run superseded by a newer run of its
+	// pipeline and branch during its debounce period. It never started.
+	StatusDebounced Status = "Debounced"
+	// StatusPredictedFailure marks a run that was never started because
+	// the AI service predicted it would fail; see
+	// ai_service.block_on_prediction.
+	StatusPredictedFailure Status = "PredictedFailure"
+)
+
+// Terminal reports whether the status is final.
+func (s Status) Terminal() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusSkipped, StatusCancelled, StatusCached, StatusTimedOut, StatusDebounced, StatusPredictedFailure:
+		return true
+	}
+	return false
+}
+
+// Successful reports whether the status lets dependent stages proceed.
+func (s Status) Successful() bool {
+	return s == StatusSucceeded || s == StatusCached
+}
+
+// Run is a single execution of a Spec.
+type Run struct {
+	ID     string        `json:"id"`
+	Spec   Spec          `json:"spec"`
+	Status Status        `json:"status"`
+	Reason string        `json:"reason,omitempty"`
+	Stages []StageResult `json:"stages,omitempty"`
+	// Finally holds the results of the spec's finally stages.
+	Finally []StageResult `json:"finally,omitempty"`
+	// PostRun holds the result of the spec's post-run hook.
+	PostRun *StageResult `json:"post_run,omitempty"`
+	// Warnings are problems noticed while the run executed that did not
+	// fail it, such as rejected artifact uploads.
+	Warnings []string `json:"warnings,omitempty"`
+	// AIDecisions records each AI recommendation consulted for the run and
+	// whether it was acted on.
+	AIDecisions []AIDecision `json:"ai_decisions,omitempty"`
+	// AIGates records, by decision kind, which AI features were enabled
+	// for the run when it was admitted.
+	AIGates map[string]bool `json:"ai_gates,omitempty"`
+	// Coverage is the code coverage percentage the spec's coverage stage
+	// reported, when it reported one.
+	Coverage *float64 `json:"coverage,omitempty"`
+	// Prediction is the AI service's failure prediction made as the run
+	// started, when one was made.
+	Prediction *FailurePrediction `json:"prediction,omitempty"`
+	// BuildOptimization is the AI service's build optimization advice taken
+	// as the run started, when advice was given.
+	BuildOptimization *BuildOptimization `json:"build_optimization,omitempty"`
+	// Deploy records the sync of the spec's ArgoCD application, for runs
+	// that got that far.
+	Deploy *DeployResult `json:"deploy,omitempty"`
+	// Replica is the advertised address of the engine replica executing, or
+	// last to execute, the run; it is where the run's logs stream from.
+	Replica string `json:"replica,omitempty"`
+	// Schedule is set for runs started by a schedule.
+	Schedule *ScheduleTrigger `json:"schedule,omitempty"`
+	// TriggeredBy names who or what started the run: the submitter given at
+	// submission, or schedule:<name> for scheduled runs.
+	TriggeredBy string `json:"triggered_by,omitempty"`
+	// TraceParent is the W3C traceparent of the request that submitted the
+	// run, if it carried one; the run's spans join that trace.
+	TraceParent string `json:"trace_parent,omitempty"`
+	// RequestID is the correlation ID of the request that submitted the run;
+	// the run's log lines carry it.
+	RequestID string `json:"request_id,omitempty"`
+	// Upstream is set for runs submitted by another run's on_success or
+	// on_failure trigger.
+	Upstream *Upstream `json:"upstream,omitempty"`
+	// RerunOf is the ID of the finished run this run repeats, for runs
+	// submitted by a rerun.
+	RerunOf string `json:"rerun_of,omitempty"`
+	// ReusedStages are the results of the stages of the RerunOf run that
+	// succeeded, for failed-only reruns; those stages are not run again.
+	ReusedStages []StageResult `json:"reused_stages,omitempty"`
+	CreatedAt    time.Time     `json:"created_at"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	FinishedAt   *time.Time    `json:"finished_at,omitempty"`
+}
+
+// ScheduleTrigger records the schedule firing that started a run.
+type ScheduleTrigger struct {
+	Name string `json:"name"`
+	// NominalTime is when the schedule was due; FiredAt is when it actually
+	// fired once jitter was applied.
+	NominalTime time.Time `json:"nominal_time"`
+	FiredAt     time.Time `json:"fired_at"`
+}
+
+// StageResult is the outcome of a stage and its jobs.
+type StageResult struct {
+	Name   string      `json:"name"`
+	Status Status      `json:"status"`
+	Jobs   []JobResult `json:"jobs"`
+}
+
+// JobResult is the outcome of a single job.
+type JobResult struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Matrix     map[string]string `json:"matrix,omitempty"`
+	Status     Status            `json:"status"`
+	Message    string            `json:"message,omitempty"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	// Results are the structured results parsed from the job's result
+	// file, for stages with a result_parser.
+	Results *Results `json:"results,omitempty"`
+	// Retries counts the times the job was run again after failing.
+	Retries int `json:"retries,omitempty"`
+	// ErrorClass is the class of the failure of a failed or timed-out job.
+	ErrorClass string `json:"error_class,omitempty"`
+}
+
+// Results summarise the tool output of a job.
+type Results struct {
+	// Parser is the result_parser that produced them.
+	Parser  string `json:"parser"`
+	Tests   int    `json:"tests"`
+	Passed  int    `json:"passed"`
+	Failed  int    `json:"failed"`
+	Skipped int    `json:"skipped"`
+	// Coverage is the percentage of statements covered, for parsers that
+	// report coverage.
+	Coverage *float64 `json:"coverage,omitempty"`
+	// FailedTests names the failed tests, up to MaxFailedTests of them.
+	FailedTests []string `json:"failed_tests,omitempty"`
+}
+
+// MaxFailedTests bounds Results.FailedTests so a broken suite cannot bloat
+// the run record.
+const MaxFailedTests = 100
+
+// MaxPredictionFactors bounds the contributing factors recorded with a
+// failure prediction.
+const MaxPredictionFactors = 5
+
+// FailurePrediction is how likely the AI service found a run to fail.
+type FailurePrediction struct {
+	Probability float64 `json:"probability"`
+	RiskLevel   string  `json:"risk_level,omitempty"`
+	// Factors are the top contributing factors, as reported by the
+	// service, up to MaxPredictionFactors of them.
+	Factors []map[string]interface{} `json:"factors,omitempty"`
+	// Blocked is set when the prediction kept the run from starting.
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// AIDecision records whether an AI recommendation was applied to a run.
+type AIDecision struct {
+	// Kind names the recommendation, e.g. "test_selection".
+	Kind       string  `json:"kind"`
+	Confidence float64 `json:"confidence"`
+	Applied    bool    `json:"applied"`
+	// Reason explains a recommendation that was not applied.
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// AIExchange is one call a run made to the AI service as sent and
+// answered, recorded under ai_service.audit_payloads with secrets redacted.
+// Exchanges are kept apart from the run, so they never appear in its API
+// representation.
+type AIExchange struct {
+	// Endpoint is the AI service path called.
+	Endpoint string `json:"endpoint"`
+	Request  string `json:"request"`
+	// Response is empty when the call failed without an answer.
+	Response string `json:"response,omitempty"`
+	// Error is why the call failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Truncated reports that Request or Response was cut at
+	// ai_service.audit_max_bytes.
+	Truncated bool      `json:"truncated,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// Clone returns a deep copy of the run's mutable state so it can be handed to
+// other goroutines while execution continues.
+func (r *Run) Clone() *Run {
+	c := *r
+	c.AIDecisions = append([]AIDecision(nil), r.AIDecisions...)
+	c.Warnings = append([]string(nil), r.Warnings...)
+	if r.Schedule != nil {
+		sched := *r.Schedule
+		c.Schedule = &sched
+	}
+	if r.Upstream != nil {
+		up := *r.Upstream
+		c.Upstream = &up
+	}
+	if r.Coverage != nil {
+		cov := *r.Coverage
+		c.Coverage = &cov
+	}
+	if r.Prediction != nil {
+		p := *r.Prediction
+		c.Prediction = &p
+	}
+	if r.BuildOptimization != nil {
+		c.BuildOptimization = r.BuildOptimization.clone()
+	}
+	if r.Deploy != nil {
+		d := *r.Deploy
+		if d.Rollback != nil {
+			rb := *d.Rollback
+			d.Rollback = &rb
+		}
+		c.Deploy = &d
+	}
+	c.Stages = cloneStages(r.Stages)
+	if r.ReusedStages != nil {
+		c.ReusedStages = cloneStages(r.ReusedStages)
+	}
+	if r.Finally != nil {
+		c.Finally = cloneStages(r.Finally)
+	}
+	if r.PostRun != nil {
+		post := cloneStages([]StageResult{*r.PostRun})[0]
+		c.PostRun = &post
+	}
+	return &c
+}
+
+func cloneStages(stages []StageResult) []StageResult {
+	out := make([]StageResult, len(stages))
+	for i, st := range stages {
+		st.Jobs = append([]JobResult(nil), st.Jobs...)
+		out[i] = st
+	}
+	return out
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Secret scan modes.
+const (
+	SecretScanOff    = "off"
+	SecretScanWarn   = "warn"
+	SecretScanReject = "reject"
+)
+
+// AllowSecretsAnnotation lists, comma-separated, the spec paths whose values
+// the secret scan must accept, e.g. "params.FIXTURE_KEY,stages[1].script",
+// for values that only look like secrets.
+const AllowSecretsAnnotation = "pipeline.devmind.io/allow-secrets"
+
+// These decide when a token is random enough to be a credential: at least
+// secretMinLength characters mixing upper- and lower-case letters and
+// digits, with secretMinEntropy bits of Shannon entropy per character, and
+// changing between those classes at secretMinClassChanges of its characters.
+// The last tells keys apart from long identifiers such as
+// TestSubmitPipelineWithMatrix2, which are mostly runs of lower case.
+const (
+	secretMinLength       = 24
+	secretMinEntropy      = 3.5
+	secretMinClassChanges = 0.4
+)
+
+var secretPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"an AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"a GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"a GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`)},
+	{"a Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"a Stripe key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"a JSON web token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"a password in a URL", regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`)},
+}
+
+// secretTokenSeparators split a value into the tokens checked for entropy.
+var secretTokenSeparators = regexp.MustCompile(`[\s"'=:,;?&@()\[\]{}<>` + "`" + `]+`)
+
+var hexPattern = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// scanSecrets reports the string fields of spec that look like inlined
+// secrets, as errors or warnings depending on policy.SecretScan. Messages
+// name the kind of secret but never the value.
+func scanSecrets(issues *Issues, spec *Spec, policy Policy) {
+	if policy.SecretScan == "" || policy.SecretScan == SecretScanOff {
+		return
+	}
+	s := secretScanner{issues: issues, mode: policy.SecretScan, allowed: allowedSecretPaths(spec)}
+
+	s.params("params", spec.Params)
+	for _, k := range sortedKeys(spec.Labels) {
+		s.check("labels."+k, spec.Labels[k])
+	}
+	for _, k := range sortedKeys(spec.Annotations) {
+		if k != AllowSecretsAnnotation {
+			s.check("annotations."+k, spec.Annotations[k])
+		}
+	}
+	for i := range spec.Stages {
+		s.stage(fmt.Sprintf("stages[%d]", i), &spec.Stages[i])
+	}
+	for i := range spec.Finally {
+		s.stage(fmt.Sprintf("finally[%d]", i), &spec.Finally[i])
+	}
+	if spec.PostRun != nil {
+		s.stage("post_run", spec.PostRun)
+	}
+}
+
+// ScanParams runs the secret scan over the params given at submission. Values
+// equal to the spec's own were already scanned with the spec.
+func ScanParams(spec *Spec, params map[string]string, policy Policy) Issues {
+	if policy.SecretScan == "" || policy.SecretScan == SecretScanOff {
+		return nil
+	}
+	var issues Issues
+	s := secretScanner{issues: &issues, mode: policy.SecretScan, allowed: allowedSecretPaths(spec)}
+	for _, k := range sortedKeys(params) {
+		if v, ok := spec.Params[k]; !ok || v != params[k] {
+			s.check("params."+k, params[k])
+		}
+	}
+	return issues
+}
+
+func allowedSecretPaths(spec *Spec) map[string]bool {
+	allowed := make(map[string]bool)
+	for _, p := range strings.Split(spec.Annotations[AllowSecretsAnnotation], ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			allowed[p] = true
+		}
+	}
+	return allowed
+}
+
+type secretScanner struct {
+	issues  *Issues
+	mode    string
+	allowed map[string]bool
+}
+
+func (s *secretScanner) stage(path string, st *Stage) {
+	s.check(path+".script", st.Script)
+	s.params(path+".params", st.Params)
+	if st.Matrix != nil {
+		for _, k := range sortedKeys(st.Matrix.Params) {
+			for i, v := range st.Matrix.Params[k] {
+				s.check(fmt.Sprintf("%s.matrix.params.%s[%d]", path, k, i), v)
+			}
+		}
+	}
+	if hc := st.HealthCheck; hc != nil {
+		s.check(path+".health_check.http", hc.HTTP)
+	}
+}
+
+func (s *secretScanner) params(path string, params map[string]string) {
+	for _, k := range sortedKeys(params) {
+		s.check(path+"."+k, params[k])
+	}
+}
+
+func (s *secretScanner) check(path, value string) {
+	if value == "" || s.allowed[path] {
+		return
+	}
+	kind := secretKind(value)
+	if kind == "" {
+		return
+	}
+	msg := "looks like %s; pass it through a credential or a secret instead, or list %q in the %s annotation if it is not one"
+	if s.mode == SecretScanReject {
+		s.issues.errorf(path, msg, kind, path, AllowSecretsAnnotation)
+	} else {
+		s.issues.warnf(path, msg, kind, path, AllowSecretsAnnotation)
+	}
+}
+
+// secretKind describes the secret value appears to contain, or returns ""
+// when it contains none.
+func secretKind(value string) string {
+	for _, p := range secretPatterns {
+		if p.pattern.MatchString(value) {
+			return p.kind
+		}
+	}
+	for _, token := range secretTokenSeparators.Split(value, -1) {
+		if highEntropy(token) {
+			return "a random token such as an API key"
+		}
+	}
+	return ""
+}
+
+// highEntropy reports whether token looks randomly generated. Hex strings
+// are left out: commit SHAs and image digests are hex and belong in specs.
+func highEntropy(token string) bool {
+	if len(token) < secretMinLength || hexPattern.MatchString(token) {
+		return false
+	}
+	var seen [4]bool
+	changes, prev := 0, -1
+	counts := make(map[rune]int)
+	for _, r := range token {
+		class := 3
+		switch {
+		case r >= 'A' && r <= 'Z':
+			class = 0
+		case r >= 'a' && r <= 'z':
+			class = 1
+		case r >= '0' && r <= '9':
+			class = 2
+		}
+		seen[class] = true
+		if prev >= 0 && class != prev {
+			changes++
+		}
+		prev = class
+		counts[r]++
+	}
+	if !seen[0] || !seen[1] || !seen[2] || float64(changes) < secretMinClassChanges*float64(len(token)-1) {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(token))
+	for _, c := range counts {
+		p := float64(c) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= secretMinEntropy
+}
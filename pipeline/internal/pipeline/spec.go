@@ -0,0 +1,252 @@
+// Package pipeline defines pipeline specifications and the runs created from
+// them.
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Spec is a pipeline definition as submitted to the engine.
+type Spec struct {
+	Name   string            `json:"name"`
+	Repo   string            `json:"repo,omitempty"`
+	Branch string            `json:"branch,omitempty"`
+	Commit string            `json:"commit,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+
+	// Labels tag the run with arbitrary dimensions (team, service, release
+	// train) for filtering run history with a label selector. They are
+	// stored and queried without limit but never become metric labels.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations carry free-form metadata about the run. The admission
+	// policy may add to them; they are never used for selection.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ChangedFiles lists the files changed by the commit, from which the AI
+	// service selects the tests of test_selection stages.
+	ChangedFiles []string `json:"changed_files,omitempty"`
+
+	// ParamsSchema is a JSON Schema the run's params must satisfy once the
+	// values given at submission are merged in. Defaults it declares for
+	// top-level properties are applied to missing params.
+	ParamsSchema json.RawMessage `json:"params_schema,omitempty"`
+
+	// Debounce is a quiet period each run waits before it starts. A newer
+	// run of the pipeline on the same repo branch submitted meanwhile
+	// supersedes it, and it ends as Debounced, so a flurry of commits runs
+	// only the latest. Zero starts runs at once.
+	Debounce Duration `json:"debounce,omitempty"`
+
+	// Parallelism caps how many jobs of the run execute at once across all
+	// stages, matrix jobs included. Zero means unlimited.
+	Parallelism int `json:"parallelism,omitempty"`
+
+	// Credential requests a short-lived credential minted at pipeline start
+	// and revoked when the pipeline ends.
+	Credential *CredentialRequest `json:"credential,omitempty"`
+
+	Stages []Stage `json:"stages"`
+
+	// Finally lists cleanup stages, like Tekton finally tasks: they run
+	// once every stage has finished, whatever its outcome, and are reported
+	// separately from the stages. They cannot depend on other stages.
+	Finally []Stage `json:"finally,omitempty"`
+
+	// PostRun is a teardown hook that runs once the stages and finally
+	// stages are over, even when the run was cancelled. It is bounded by its
+	// own timeout, and its failure is reported on the run without changing
+	// the run's outcome.
+	PostRun *Stage `json:"post_run,omitempty"`
+
+	// Coverage records the run's code coverage and gates the run on it.
+	Coverage *Coverage `json:"coverage,omitempty"`
+
+	// Deploy syncs an ArgoCD application once the run's stages and finally
+	// stages have succeeded.
+	Deploy *Deploy `json:"deploy,omitempty"`
+
+	// OnSuccess and OnFailure submit downstream pipelines once the run has
+	// succeeded, or failed or timed out, up to pipeline.max_chain_depth
+	// triggered runs deep. A pipeline is never triggered again by a run it
+	// triggered itself, directly or not.
+	OnSuccess *Chain `json:"on_success,omitempty"`
+	OnFailure *Chain `json:"on_failure,omitempty"`
+}
+
+// CredentialRequest describes the pipeline-scoped credential to mint.
+type CredentialRequest struct {
+	Scope string `json:"scope"`
+}
+
+// Stage is a single step of the pipeline DAG.
+type Stage struct {
+	Name      string            `json:"name"`
+	TaskRef   string            `json:"task_ref,omitempty"`
+	Image     string            `json:"image,omitempty"`
+	Script    string            `json:"script,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+	DependsOn []string          `json:"depends_on,omitempty"`
+	Matrix    *Matrix           `json:"matrix,omitempty"`
+
+	// Timeout bounds each job of the stage. Zero means no limit.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// Resources are the compute requests of each job of the stage.
+	Resources *Resources `json:"resources,omitempty"`
+
+	// ServiceAccount is the Kubernetes service account the stage's TaskRuns
+	// run as. It must be allowlisted by policy; empty uses the namespace
+	// default.
+	ServiceAccount string `json:"service_account,omitempty"`
+
+	// HealthCheck makes the stage wait for an endpoint to become healthy
+	// instead of running a task. Such stages are executed by the engine
+	// itself, so they take no task_ref, image or script.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
+	// ResultParser names the parser that turns ResultFile into structured
+	// results once each job finishes, e.g. "gotest-json". ResultFile is the
+	// artifact the job uploads its tool output as; matrix jobs upload it
+	// under their job ID, as "<job id>/<result_file>".
+	ResultParser string `json:"result_parser,omitempty"`
+	ResultFile   string `json:"result_file,omitempty"`
+
+	// Retry runs failed jobs again when they failed with an error class
+	// worth retrying.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// TestSelection lets the AI service choose which of the stage's tests
+	// its jobs run.
+	TestSelection *TestSelection `json:"test_selection,omitempty"`
+
+	// Cache is the build cache the engine gives the stage's jobs, from the
+	// AI service's build optimization advice. It is never part of a
+	// submitted spec.
+	Cache *BuildCache `json:"-"`
+}
+
+// DefaultTestSelectionParam is the stage param given the selected tests when
+// test_selection sets no param.
+const DefaultTestSelectionParam = "tests"
+
+// TestSelection declares the test suite of a stage. When the AI service
+// selects tests for the run's changed files with enough confidence, the jobs
+// run only those; otherwise they run the whole suite.
+type TestSelection struct {
+	// Tests is the whole suite.
+	Tests []string `json:"tests"`
+	// Param is the stage param given the tests to run, separated by spaces.
+	// Empty uses DefaultTestSelectionParam.
+	Param string `json:"param,omitempty"`
+}
+
+// ParamName returns the stage param given the tests to run.
+func (t *TestSelection) ParamName() string {
+	if t.Param == "" {
+		return DefaultTestSelectionParam
+	}
+	return t.Param
+}
+
+// ResultArtifact returns the name of the artifact job uploads its result
+// file as.
+func (j Job) ResultArtifact() string {
+	if len(j.Matrix) == 0 {
+		return j.Stage.ResultFile
+	}
+	return j.ID + "/" + j.Stage.ResultFile
+}
+
+// HealthCheck polls an HTTP or gRPC endpoint until it has reported healthy
+// SuccessThreshold times in a row. The stage timeout bounds the whole wait.
+type HealthCheck struct {
+	// HTTP is the URL to GET. Exactly one of HTTP and GRPC is set.
+	HTTP string `json:"http,omitempty"`
+	// GRPC is the host:port of a server implementing grpc.health.v1.
+	GRPC string `json:"grpc,omitempty"`
+	// Service is the service checked over gRPC; empty checks the server
+	// as a whole.
+	Service string `json:"service,omitempty"`
+	// TLS dials the gRPC endpoint over TLS instead of plaintext.
+	TLS bool `json:"tls,omitempty"`
+
+	// ExpectStatus is the HTTP status of a healthy response. Zero accepts
+	// any 2xx status.
+	ExpectStatus int `json:"expect_status,omitempty"`
+	// ExpectBody is a substring a healthy HTTP response body must contain.
+	ExpectBody string `json:"expect_body,omitempty"`
+
+	// InitialDelay is waited before the first check.
+	InitialDelay Duration `json:"initial_delay,omitempty"`
+	// Interval separates consecutive checks.
+	Interval Duration `json:"interval,omitempty"`
+	// CheckTimeout bounds each single check.
+	CheckTimeout Duration `json:"check_timeout,omitempty"`
+	// SuccessThreshold is the number of consecutive healthy checks
+	// required. Zero means one.
+	SuccessThreshold int `json:"success_threshold,omitempty"`
+}
+
+// Resources holds compute requests as Kubernetes quantities ("500m", "1Gi").
+type Resources struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+// Matrix fans a stage out into one job per combination of parameter values.
+type Matrix struct {
+	// Params maps a parameter name to the values it takes.
+	Params map[string][]string `json:"params"`
+
+	// FailFast cancels the remaining combinations as soon as one fails.
+	FailFast bool `json:"fail_fast,omitempty"`
+
+	// MaxParallel caps how many combinations run at once. It applies on top
+	// of the pipeline-wide Parallelism limit. Zero means unlimited.
+	MaxParallel int `json:"max_parallel,omitempty"`
+}
+
+// Stage returns the stage, finally stage or post-run hook with the given
+// name.
+func (s *Spec) Stage(name string) (*Stage, bool) {
+	for i := range s.Stages {
+		if s.Stages[i].Name == name {
+			return &s.Stages[i], true
+		}
+	}
+	for i := range s.Finally {
+		if s.Finally[i].Name == name {
+			return &s.Finally[i], true
+		}
+	}
+	if s.PostRun != nil && s.PostRun.Name == name {
+		return s.PostRun, true
+	}
+	return nil, false
+}
+
+// Duration is a time.Duration written as a Go duration string ("90s", "5m")
+// in specs.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts a duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
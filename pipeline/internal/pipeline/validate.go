@@ -0,0 +1,518 @@
+package pipeline
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Severity classifies a validation issue.
+type Severity string
+
+const (
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Issue is a single validation finding.
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+// Issues is a list of validation findings.
+type Issues []Issue
+
+// HasErrors reports whether any issue is an error.
+func (is Issues) HasErrors() bool {
+	for _, i := range is {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the error issues combined into one error, or nil.
+func (is Issues) Err() error {
+	var msgs []string
+	for _, i := range is {
+		if i.Severity == SeverityError {
+			msgs = append(msgs, i.Path+": "+i.Message)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid pipeline spec: %s", strings.Join(msgs, "; "))
+}
+
+func (is *Issues) errorf(path, format string, args ...interface{}) {
+	*is = append(*is, Issue{Severity: SeverityError, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (is *Issues) warnf(path, format string, args ...interface{}) {
+	*is = append(*is, Issue{Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Policy holds the organisation-wide rules a spec is checked against.
+type Policy struct {
+	// AllowedRegistries restricts stage images to these registry prefixes.
+	// Empty allows any registry.
+	AllowedRegistries []string
+
+	// AllowedServiceAccounts lists the service accounts stages may run as.
+	// Empty forbids stages from choosing one.
+	AllowedServiceAccounts []string
+
+	// MaxStages caps the number of jobs a spec expands to, counting every
+	// matrix combination and the finally stages and post-run hook. Zero
+	// means no limit.
+	MaxStages int
+
+	// ResultParsers lists the result_parser names stages may use. Empty
+	// forbids result parsers.
+	ResultParsers []string
+
+	// SecretScan is SecretScanOff, SecretScanWarn or SecretScanReject: how
+	// string fields that look like inlined secrets are reported.
+	SecretScan string
+}
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Parse decodes a YAML or JSON spec. Unknown fields are rejected so typos do
+// not silently disappear.
+func Parse(data []byte) (*Spec, error) {
+	var spec Spec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline spec: %w", err)
+	}
+	return &spec, nil
+}
+
+// Normalize applies defaults in place: names are trimmed and dependency
+// lists are de-duplicated and sorted so equivalent specs compare equal.
+func Normalize(spec *Spec) {
+	spec.Name = strings.TrimSpace(spec.Name)
+	for i := range spec.Finally {
+		spec.Finally[i].Name = strings.TrimSpace(spec.Finally[i].Name)
+		spec.Finally[i].Image = strings.TrimSpace(spec.Finally[i].Image)
+	}
+	if spec.PostRun != nil {
+		spec.PostRun.Name = strings.TrimSpace(spec.PostRun.Name)
+		spec.PostRun.Image = strings.TrimSpace(spec.PostRun.Image)
+	}
+	for i := range spec.Stages {
+		st := &spec.Stages[i]
+		st.Name = strings.TrimSpace(st.Name)
+		st.Image = strings.TrimSpace(st.Image)
+
+		seen := make(map[string]bool, len(st.DependsOn))
+		deps := st.DependsOn[:0]
+		for _, d := range st.DependsOn {
+			d = strings.TrimSpace(d)
+			if d == "" || seen[d] {
+				continue
+			}
+			seen[d] = true
+			deps = append(deps, d)
+		}
+		sort.Strings(deps)
+		st.DependsOn = deps
+		normalizeRetry(st.Retry)
+	}
+	for i := range spec.Finally {
+		normalizeRetry(spec.Finally[i].Retry)
+	}
+	if spec.PostRun != nil {
+		normalizeRetry(spec.PostRun.Retry)
+	}
+	normalizeChain(spec.OnSuccess)
+	normalizeChain(spec.OnFailure)
+}
+
+// Validate checks a normalized spec for structural problems, broken
+// references, dependency cycles and image policy violations. It has no side
+// effects.
+func Validate(spec *Spec, policy Policy) Issues {
+	var issues Issues
+
+	if spec.Name == "" {
+		issues.errorf("name", "is required")
+	} else if !namePattern.MatchString(spec.Name) {
+		issues.errorf("name", "%q must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", spec.Name)
+	}
+	if spec.Parallelism < 0 {
+		issues.errorf("parallelism", "must not be negative")
+	}
+	if spec.Debounce < 0 {
+		issues.errorf("debounce", "must not be negative")
+	}
+	if spec.Credential != nil && spec.Credential.Scope == "" {
+		issues.errorf("credential.scope", "is required when a credential is requested")
+	}
+	if len(spec.Stages) == 0 {
+		issues.errorf("stages", "at least one stage is required")
+	}
+	for _, k := range sortedKeys(spec.Labels) {
+		for _, msg := range validation.IsQualifiedName(k) {
+			issues.errorf("labels."+k, "invalid label key: %s", msg)
+		}
+		for _, msg := range validation.IsValidLabelValue(spec.Labels[k]) {
+			issues.errorf("labels."+k, "invalid label value: %s", msg)
+		}
+	}
+	if len(spec.ParamsSchema) > 0 {
+		if _, err := compileParamsSchema(spec.ParamsSchema); err != nil {
+			issues.errorf("params_schema", "%v", err)
+		}
+	}
+
+	index := make(map[string]int, len(spec.Stages))
+	for i := range spec.Stages {
+		validateStage(&issues, fmt.Sprintf("stages[%d]", i), &spec.Stages[i], policy)
+		if name := spec.Stages[i].Name; namePattern.MatchString(name) {
+			if prev, dup := index[name]; dup {
+				issues.errorf(fmt.Sprintf("stages[%d].name", i), "duplicate stage name %q (also stages[%d])", name, prev)
+			} else {
+				index[name] = i
+			}
+		}
+	}
+
+	finally := make(map[string]int, len(spec.Finally))
+	for i := range spec.Finally {
+		path := fmt.Sprintf("finally[%d]", i)
+		st := &spec.Finally[i]
+		validateStage(&issues, path, st, policy)
+		if len(st.DependsOn) > 0 {
+			issues.errorf(path+".depends_on", "finally stages run after every stage and cannot depend on other stages")
+		}
+		if !namePattern.MatchString(st.Name) {
+			continue
+		}
+		if prev, dup := index[st.Name]; dup {
+			issues.errorf(path+".name", "duplicate stage name %q (also stages[%d])", st.Name, prev)
+		} else if prev, dup := finally[st.Name]; dup {
+			issues.errorf(path+".name", "duplicate stage name %q (also finally[%d])", st.Name, prev)
+		} else {
+			finally[st.Name] = i
+		}
+	}
+
+	postRun := ""
+	if st := spec.PostRun; st != nil {
+		validateStage(&issues, "post_run", st, policy)
+		if len(st.DependsOn) > 0 {
+			issues.errorf("post_run.depends_on", "the post-run hook runs after every stage and cannot depend on other stages")
+		}
+		if namePattern.MatchString(st.Name) {
+			if prev, dup := index[st.Name]; dup {
+				issues.errorf("post_run.name", "duplicate stage name %q (also stages[%d])", st.Name, prev)
+			} else if prev, dup := finally[st.Name]; dup {
+				issues.errorf("post_run.name", "duplicate stage name %q (also finally[%d])", st.Name, prev)
+			} else {
+				postRun = st.Name
+			}
+		}
+	}
+
+	for i, st := range spec.Stages {
+		for _, dep := range st.DependsOn {
+			path := fmt.Sprintf("stages[%d].depends_on", i)
+			if dep == st.Name {
+				issues.errorf(path, "stage %q depends on itself", st.Name)
+			} else if _, ok := finally[dep]; ok {
+				issues.errorf(path, "stage %q is a finally stage and cannot be depended on", dep)
+			} else if dep == postRun {
+				issues.errorf(path, "stage %q is the post-run hook and cannot be depended on", dep)
+			} else if _, ok := index[dep]; !ok {
+				issues.errorf(path, "unknown stage %q", dep)
+			}
+		}
+	}
+
+	if cycle := findCycle(spec, index); cycle != nil {
+		issues.errorf("stages", "dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	if policy.MaxStages > 0 {
+		if n := spec.JobCount(policy.MaxStages); n > policy.MaxStages {
+			issues.errorf("stages", "pipeline expands to more than %d stages once matrices are expanded, the maximum allowed by pipeline.max_stages", policy.MaxStages)
+		}
+	}
+	validateCoverage(&issues, spec)
+	validateDeploy(&issues, spec.Deploy)
+	validateChain(&issues, "on_success", spec.OnSuccess, policy)
+	validateChain(&issues, "on_failure", spec.OnFailure, policy)
+	scanSecrets(&issues, spec, policy)
+
+	return issues
+}
+
+// validateStage checks the fields of a single stage, finally stage or
+// post-run hook.
+func validateStage(issues *Issues, path string, st *Stage, policy Policy) {
+	switch {
+	case st.Name == "":
+		issues.errorf(path+".name", "is required")
+	case !namePattern.MatchString(st.Name):
+		issues.errorf(path+".name", "%q must start with a letter or digit and contain only letters, digits, '.', '_' and '-'", st.Name)
+	}
+
+	if st.HealthCheck != nil {
+		validateHealthCheck(issues, path, st)
+		if st.ResultParser != "" {
+			issues.errorf(path+".result_parser", "health_check stages produce no result file")
+		}
+	} else if st.TaskRef == "" && st.Image == "" {
+		issues.errorf(path, "one of task_ref, image or health_check is required")
+	}
+	if st.TaskRef != "" && st.Image != "" {
+		issues.errorf(path, "task_ref and image are mutually exclusive")
+	}
+	if st.Image != "" {
+		validateImage(issues, path+".image", st.Image, policy)
+	}
+	if st.Matrix != nil {
+		validateMatrix(issues, path+".matrix", st.Matrix)
+	}
+	if st.Timeout < 0 {
+		issues.errorf(path+".timeout", "must not be negative")
+	}
+	if st.ServiceAccount != "" {
+		validateServiceAccount(issues, path+".service_account", st.ServiceAccount, policy)
+	}
+	if st.Resources != nil {
+		validateQuantity(issues, path+".resources.cpu", st.Resources.CPU)
+		validateQuantity(issues, path+".resources.memory", st.Resources.Memory)
+	}
+	if st.ResultParser != "" || st.ResultFile != "" {
+		validateResultParser(issues, path, st, policy)
+	}
+	if st.Retry != nil {
+		validateRetry(issues, path+".retry", st.Retry)
+	}
+	if st.TestSelection != nil {
+		if st.HealthCheck != nil {
+			issues.errorf(path+".test_selection", "health_check stages run no tests")
+		}
+		if len(st.TestSelection.Tests) == 0 {
+			issues.errorf(path+".test_selection.tests", "at least one test is required")
+		}
+		for i, test := range st.TestSelection.Tests {
+			if test == "" || strings.ContainsAny(test, " \t\n") {
+				issues.errorf(fmt.Sprintf("%s.test_selection.tests[%d]", path, i), "%q must be a non-empty name without whitespace", test)
+			}
+		}
+	}
+}
+
+// validateResultParser checks that a stage's result parser is registered and
+// that its result file is a plain artifact name.
+func validateResultParser(issues *Issues, path string, st *Stage, policy Policy) {
+	known := false
+	for _, name := range policy.ResultParsers {
+		known = known || name == st.ResultParser
+	}
+	switch {
+	case st.ResultParser == "":
+		issues.errorf(path+".result_parser", "is required with result_file")
+	case !known:
+		issues.errorf(path+".result_parser", "unknown parser %q (%s)", st.ResultParser, strings.Join(policy.ResultParsers, ", "))
+	}
+
+	if st.ResultFile == "" {
+		issues.errorf(path+".result_file", "is required with result_parser")
+		return
+	}
+	for _, seg := range strings.Split(st.ResultFile, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			issues.errorf(path+".result_file", "%q must be a relative artifact name without empty, '.' or '..' segments", st.ResultFile)
+			break
+		}
+	}
+}
+
+// validateHealthCheck checks a health_check stage, which the engine runs
+// itself and so cannot carry anything meant for a TaskRun.
+func validateHealthCheck(issues *Issues, path string, st *Stage) {
+	if st.TaskRef != "" || st.Image != "" || st.Script != "" {
+		issues.errorf(path, "health_check stages take no task_ref, image or script")
+	}
+	if st.Resources != nil || st.ServiceAccount != "" {
+		issues.errorf(path, "health_check stages run in the engine and take no resources or service_account")
+	}
+
+	hc := st.HealthCheck
+	path += ".health_check"
+	switch {
+	case hc.HTTP == "" && hc.GRPC == "":
+		issues.errorf(path, "one of http or grpc is required")
+	case hc.HTTP != "" && hc.GRPC != "":
+		issues.errorf(path, "http and grpc are mutually exclusive")
+	case hc.HTTP != "":
+		if u, err := url.Parse(hc.HTTP); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			issues.errorf(path+".http", "%q is not an http or https URL", hc.HTTP)
+		}
+		if hc.Service != "" || hc.TLS {
+			issues.errorf(path, "service and tls only apply to grpc checks")
+		}
+	case hc.GRPC != "":
+		if _, _, err := net.SplitHostPort(hc.GRPC); err != nil {
+			issues.errorf(path+".grpc", "%q is not a host:port address", hc.GRPC)
+		}
+		if hc.ExpectStatus != 0 || hc.ExpectBody != "" {
+			issues.errorf(path, "expect_status and expect_body only apply to http checks")
+		}
+	}
+	if hc.ExpectStatus != 0 && (hc.ExpectStatus < 100 || hc.ExpectStatus > 599) {
+		issues.errorf(path+".expect_status", "%d is not an HTTP status", hc.ExpectStatus)
+	}
+	if hc.InitialDelay < 0 {
+		issues.errorf(path+".initial_delay", "must not be negative")
+	}
+	if hc.Interval < 0 {
+		issues.errorf(path+".interval", "must not be negative")
+	}
+	if hc.CheckTimeout < 0 {
+		issues.errorf(path+".check_timeout", "must not be negative")
+	}
+	if hc.SuccessThreshold < 0 {
+		issues.errorf(path+".success_threshold", "must not be negative")
+	}
+	if st.Timeout == 0 {
+		issues.warnf(path, "stage has no timeout; the engine default applies")
+	}
+}
+
+func validateImage(issues *Issues, path, image string, policy Policy) {
+	if len(policy.AllowedRegistries) > 0 {
+		allowed := false
+		for _, prefix := range policy.AllowedRegistries {
+			if strings.HasPrefix(image, strings.TrimSuffix(prefix, "/")+"/") {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			issues.errorf(path, "image %q is not from an allowed registry (%s)", image, strings.Join(policy.AllowedRegistries, ", "))
+		}
+	}
+
+	if strings.Contains(image, "@sha256:") {
+		return
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		tag = name[i+1:]
+	}
+	if tag == "" || tag == "latest" {
+		issues.warnf(path, "image %q is not pinned to a tag or digest", image)
+	}
+}
+
+func validateServiceAccount(issues *Issues, path, name string, policy Policy) {
+	if msgs := validation.IsDNS1123Subdomain(name); len(msgs) > 0 {
+		issues.errorf(path, "%q is not a valid service account name: %s", name, strings.Join(msgs, "; "))
+		return
+	}
+	for _, allowed := range policy.AllowedServiceAccounts {
+		if name == allowed {
+			return
+		}
+	}
+	if len(policy.AllowedServiceAccounts) == 0 {
+		issues.errorf(path, "service account %q is not allowed: no service accounts are allowlisted", name)
+		return
+	}
+	issues.errorf(path, "service account %q is not allowed (%s)", name, strings.Join(policy.AllowedServiceAccounts, ", "))
+}
+
+func validateQuantity(issues *Issues, path, v string) {
+	if v == "" {
+		return
+	}
+	q, err := resource.ParseQuantity(v)
+	if err != nil {
+		issues.errorf(path, "%q is not a valid quantity", v)
+		return
+	}
+	if q.Sign() <= 0 {
+		issues.errorf(path, "must be positive")
+	}
+}
+
+func validateMatrix(issues *Issues, path string, m *Matrix) {
+	if len(m.Params) == 0 {
+		issues.errorf(path+".params", "at least one parameter is required")
+	}
+	for name, values := range m.Params {
+		if len(values) == 0 {
+			issues.errorf(path+".params."+name, "must list at least one value")
+		}
+	}
+	if m.MaxParallel < 0 {
+		issues.errorf(path+".max_parallel", "must not be negative")
+	}
+}
+
+// findCycle returns the stage names forming a dependency cycle, or nil.
+func findCycle(spec *Spec, index map[string]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(spec.Stages))
+	var stack []string
+
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		stack = append(stack, spec.Stages[i].Name)
+		for _, dep := range spec.Stages[i].DependsOn {
+			d, ok := index[dep]
+			if !ok || d == i {
+				continue
+			}
+			switch state[d] {
+			case visiting:
+				for k, name := range stack {
+					if name == dep {
+						return append(append([]string(nil), stack[k:]...), dep)
+					}
+				}
+			case unvisited:
+				if c := visit(d); c != nil {
+					return c
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i := range spec.Stages {
+		if state[i] == unvisited {
+			if c := visit(i); c != nil {
+				return c
+			}
+		}
+	}
+	return nil
+}
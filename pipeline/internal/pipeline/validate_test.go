@@ -0,0 +1,440 @@
+package pipeline
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func validate(t *testing.T, doc string, policy Policy) Issues {
+	t.Helper()
+	spec, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	Normalize(spec)
+	return Validate(spec, policy)
+}
+
+func hasIssue(issues Issues, severity Severity, substr string) bool {
+	for _, i := range issues {
+		if i.Severity == severity && strings.Contains(i.String(), substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	_, err := Parse([]byte("name: p\nstages:\n- name: a\n  dependz_on: [b]\n"))
+	if err == nil {
+		t.Fatal("expected unknown field to be rejected")
+	}
+}
+
+func TestValidateValidSpec(t *testing.T) {
+	issues := validate(t, `
+name: build
+stages:
+- name: compile
+  image: ghcr.io/org/go:1.21
+- name: test
+  image: ghcr.io/org/go:1.21
+  depends_on: [compile, compile]
+  matrix:
+    params:
+      os: [linux, darwin]
+`, Policy{AllowedRegistries: []string{"ghcr.io/org"}})
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+}
+
+func TestValidateDetectsCycle(t *testing.T) {
+	issues := validate(t, `
+name: p
+stages:
+- {name: a, task_ref: t, depends_on: [c]}
+- {name: b, task_ref: t, depends_on: [a]}
+- {name: c, task_ref: t, depends_on: [b]}
+`, Policy{})
+	if !hasIssue(issues, SeverityError, "dependency cycle") {
+		t.Fatalf("cycle not reported: %v", issues)
+	}
+}
+
+func TestValidateReferencesAndDuplicates(t *testing.T) {
+	issues := validate(t, `
+name: p
+stages:
+- {name: a, task_ref: t, depends_on: [missing]}
+- {name: a, task_ref: t}
+- {name: b}
+`, Policy{})
+	for _, want := range []string{`unknown stage "missing"`, `duplicate stage name "a"`, "one of task_ref, image or health_check"} {
+		if !hasIssue(issues, SeverityError, want) {
+			t.Errorf("missing issue %q in %v", want, issues)
+		}
+	}
+}
+
+func TestValidateImagePolicy(t *testing.T) {
+	issues := validate(t, `
+name: p
+stages:
+- {name: a, image: docker.io/library/alpine:latest}
+`, Policy{AllowedRegistries: []string{"ghcr.io/org"}})
+	if !issues.HasErrors() || !hasIssue(issues, SeverityError, "not from an allowed registry") {
+		t.Errorf("registry violation not reported: %v", issues)
+	}
+	if !hasIssue(issues, SeverityWarning, "not pinned") {
+		t.Errorf("unpinned image not warned: %v", issues)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	issues := validate(t, `
+name: p
+labels:
+  team: payments
+  release/train: "2024.10"
+  bad key: x
+  env: "not a valid value!"
+stages:
+- {name: a, task_ref: t}
+`, Policy{})
+	for _, want := range []string{"labels.bad key: invalid label key", "labels.env: invalid label value"} {
+		if !hasIssue(issues, SeverityError, want) {
+			t.Errorf("missing issue %q in %v", want, issues)
+		}
+	}
+	if hasIssue(issues, SeverityError, "labels.team") || hasIssue(issues, SeverityError, "labels.release/train") {
+		t.Errorf("valid labels reported: %v", issues)
+	}
+}
+
+func TestValidateServiceAccounts(t *testing.T) {
+	doc := `
+name: p
+stages:
+- {name: test, task_ref: t, service_account: ci-runner}
+- {name: deploy, task_ref: t, service_account: cluster-admin}
+- {name: bad, task_ref: t, service_account: "Not_Valid"}
+`
+	issues := validate(t, doc, Policy{AllowedServiceAccounts: []string{"ci-runner", "deployer"}})
+	if hasIssue(issues, SeverityError, "stages[0]") {
+		t.Errorf("allowlisted service account rejected: %v", issues)
+	}
+	if !hasIssue(issues, SeverityError, `stages[1].service_account: service account "cluster-admin" is not allowed`) {
+		t.Errorf("non-allowlisted service account accepted: %v", issues)
+	}
+	if !hasIssue(issues, SeverityError, "stages[2].service_account: \"Not_Valid\" is not a valid service account name") {
+		t.Errorf("invalid name accepted: %v", issues)
+	}
+
+	issues = validate(t, doc, Policy{})
+	if !hasIssue(issues, SeverityError, "no service accounts are allowlisted") {
+		t.Errorf("service account accepted without an allowlist: %v", issues)
+	}
+}
+
+func TestValidateFinally(t *testing.T) {
+	spec := &Spec{
+		Name: "p",
+		Stages: []Stage{
+			{Name: "build", Image: "ghcr.io/org/build:1"},
+			{Name: "deploy", Image: "ghcr.io/org/deploy:1", DependsOn: []string{"cleanup"}},
+		},
+		Finally: []Stage{
+			{Name: "cleanup", Image: "ghcr.io/org/cleanup:1", DependsOn: []string{"build"}},
+			{Name: "build", Image: "ghcr.io/org/cleanup:1"},
+		},
+	}
+	issues := Validate(spec, Policy{})
+
+	want := map[string]string{
+		"stages[1].depends_on":  `stage "cleanup" is a finally stage and cannot be depended on`,
+		"finally[0].depends_on": "finally stages run after every stage and cannot depend on other stages",
+		"finally[1].name":       `duplicate stage name "build" (also stages[0])`,
+	}
+	for _, i := range issues {
+		if msg, ok := want[i.Path]; ok && i.Message == msg {
+			delete(want, i.Path)
+		}
+	}
+	if len(want) > 0 {
+		t.Fatalf("Validate() = %v, missing %v", issues, want)
+	}
+}
+
+func TestValidatePostRun(t *testing.T) {
+	spec := &Spec{
+		Name: "p",
+		Stages: []Stage{
+			{Name: "build", Image: "ghcr.io/org/build:1"},
+			{Name: "deploy", Image: "ghcr.io/org/deploy:1", DependsOn: []string{"unlock"}},
+		},
+		PostRun: &Stage{Name: "unlock", Image: "ghcr.io/org/unlock:1", DependsOn: []string{"build"}},
+	}
+	issues := Validate(spec, Policy{})
+
+	want := map[string]string{
+		"stages[1].depends_on": `stage "unlock" is the post-run hook and cannot be depended on`,
+		"post_run.depends_on":  "the post-run hook runs after every stage and cannot depend on other stages",
+	}
+	for _, i := range issues {
+		if msg, ok := want[i.Path]; ok && i.Message == msg {
+			delete(want, i.Path)
+		}
+	}
+	if len(want) > 0 {
+		t.Fatalf("Validate() = %v, missing %v", issues, want)
+	}
+}
+
+func TestValidateHealthCheck(t *testing.T) {
+	issues := validate(t, `
+name: deploy
+stages:
+- name: wait
+  timeout: 5m
+  health_check: {http: "https://svc.example/healthz", expect_status: 200, success_threshold: 3, interval: 10s}
+- name: wait-grpc
+  timeout: 5m
+  health_check: {grpc: "svc:9090", service: api}
+`, Policy{})
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+
+	issues = validate(t, `
+name: deploy
+stages:
+- name: both
+  image: ghcr.io/org/kubectl:1.28
+  health_check: {http: "svc/healthz", grpc: "svc:9090"}
+- name: body
+  health_check: {grpc: "svc", expect_body: ok}
+`, Policy{})
+	for _, want := range []string{
+		"health_check stages take no task_ref, image or script",
+		"http and grpc are mutually exclusive",
+		`"svc" is not a host:port address`,
+		"expect_status and expect_body only apply to http checks",
+	} {
+		if !hasIssue(issues, SeverityError, want) {
+			t.Errorf("missing issue %q in %v", want, issues)
+		}
+	}
+	if !hasIssue(issues, SeverityWarning, "no timeout") {
+		t.Errorf("missing timeout warning in %v", issues)
+	}
+}
+
+func TestValidateMaxStagesCountsExpandedJobs(t *testing.T) {
+	doc := `
+name: p
+stages:
+- name: test
+  task_ref: t
+  matrix:
+    params:
+      os: [linux, darwin]
+      go: ["1.20", "1.21"]
+finally:
+- {name: cleanup, task_ref: t}
+`
+	if issues := validate(t, doc, Policy{MaxStages: 5}); issues.HasErrors() {
+		t.Fatalf("5 jobs rejected at max_stages 5: %v", issues)
+	}
+	if issues := validate(t, doc, Policy{MaxStages: 4}); !hasIssue(issues, SeverityError, "more than 4 stages") {
+		t.Fatalf("5 jobs not rejected at max_stages 4: %v", issues)
+	}
+
+	// A matrix far too large to expand is still counted cheaply.
+	values := make([]string, 1000)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	spec := &Spec{Stages: []Stage{{Name: "huge", Matrix: &Matrix{Params: map[string][]string{"a": values, "b": values, "c": values}}}}}
+	if n := spec.JobCount(100); n != 101 {
+		t.Fatalf("JobCount(100) = %d, want 101", n)
+	}
+}
+
+func TestValidateResultParser(t *testing.T) {
+	policy := Policy{ResultParsers: []string{"gotest-json", "junit"}}
+	issues := validate(t, `
+name: test
+stages:
+- {name: unit, image: golang:1.21, result_parser: gotest-json, result_file: reports/unit.json}
+`, policy)
+	if len(issues) != 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+
+	issues = validate(t, `
+name: test
+stages:
+- {name: unknown, image: golang:1.21, result_parser: nunit, result_file: out.xml}
+- {name: nofile, image: golang:1.21, result_parser: junit}
+- {name: escape, image: golang:1.21, result_parser: junit, result_file: ../out.xml}
+`, policy)
+	for _, want := range []string{
+		`unknown parser "nunit" (gotest-json, junit)`,
+		"result_file: is required with result_parser",
+		`"../out.xml" must be a relative artifact name`,
+	} {
+		if !hasIssue(issues, SeverityError, want) {
+			t.Errorf("missing issue %q in %v", want, issues)
+		}
+	}
+}
+
+func TestValidateRetryPolicy(t *testing.T) {
+	spec := &Spec{
+		Name: "p",
+		Stages: []Stage{
+			{Name: "build", Image: "ghcr.io/org/build:1", Retry: &RetryPolicy{Attempts: 2, On: []string{"timeout", "infra", "timeout"}}},
+			{Name: "test", Image: "ghcr.io/org/test:1", Retry: &RetryPolicy{On: []string{"flaky"}}},
+		},
+	}
+	Normalize(spec)
+	if got := spec.Stages[0].Retry.On; len(got) != 2 || got[0] != "infra" || got[1] != "timeout" {
+		t.Errorf("normalized retry classes = %v, want [infra timeout]", got)
+	}
+	issues := Validate(spec, Policy{})
+
+	want := map[string]string{
+		"stages[1].retry.attempts": "must be between 1 and 10, got 0",
+		"stages[1].retry.on[0]":    `unknown error class "flaky" (infra, timeout, oom, failed)`,
+	}
+	for _, i := range issues {
+		if msg, ok := want[i.Path]; ok && i.Message == msg {
+			delete(want, i.Path)
+		}
+	}
+	if len(want) > 0 || len(issues) != 2 {
+		t.Fatalf("Validate() = %v, missing %v", issues, want)
+	}
+}
+
+func TestValidateTestSelection(t *testing.T) {
+	spec := &Spec{
+		Name: "p",
+		Stages: []Stage{
+			{Name: "unit", Image: "golang:1.22", TestSelection: &TestSelection{Tests: []string{"TestA", "Test B"}}},
+			{Name: "it", Image: "golang:1.22", TestSelection: &TestSelection{}},
+		},
+	}
+	issues := Validate(spec, Policy{})
+
+	want := map[string]string{
+		"stages[0].test_selection.tests[1]": `"Test B" must be a non-empty name without whitespace`,
+		"stages[1].test_selection.tests":    "at least one test is required",
+	}
+	for _, i := range issues {
+		if msg, ok := want[i.Path]; ok && i.Message == msg {
+			delete(want, i.Path)
+		}
+	}
+	if len(want) > 0 || len(issues) != 2 {
+		t.Fatalf("Validate() = %v, missing %v", issues, want)
+	}
+	if got := spec.Stages[0].TestSelection.ParamName(); got != DefaultTestSelectionParam {
+		t.Errorf("ParamName() = %q, want %q", got, DefaultTestSelectionParam)
+	}
+}
+
+func TestValidateCoverage(t *testing.T) {
+	for _, tc := range []struct {
+		coverage *Coverage
+		path     string
+		want     string
+	}{
+		{&Coverage{Stage: "unit", Min: 80}, "", ""},
+		{&Coverage{Stage: "lint"}, "coverage.stage", `stage "lint" has no result_parser to report coverage`},
+		{&Coverage{Stage: "e2e"}, "coverage.stage", `unknown stage "e2e"`},
+		{&Coverage{Stage: "unit", MaxDrop: -1}, "coverage.max_drop", "must be between 0 and 100, got -1"},
+	} {
+		spec := &Spec{Name: "p", Coverage: tc.coverage, Stages: []Stage{
+			{Name: "unit", Image: "golang:1.22", ResultParser: "go-cover", ResultFile: "cover.out"},
+			{Name: "lint", Image: "golang:1.22"},
+		}}
+		issues := Validate(spec, Policy{ResultParsers: []string{"go-cover"}})
+		if tc.want == "" {
+			if len(issues) != 0 {
+				t.Errorf("Validate(%+v) = %v, want no issues", tc.coverage, issues)
+			}
+			continue
+		}
+		if len(issues) != 1 || issues[0].Path != tc.path || issues[0].Message != tc.want {
+			t.Errorf("Validate(%+v) = %v, want %s: %s", tc.coverage, issues, tc.path, tc.want)
+		}
+	}
+}
+
+func TestValidateDeploy(t *testing.T) {
+	for _, tc := range []struct {
+		deploy *Deploy
+		path   string
+		want   string
+	}{
+		{&Deploy{Application: "web-prod", Revision: RunCommitRef}, "", ""},
+		{&Deploy{}, "deploy.application", "is required"},
+		{&Deploy{Application: "team/web"}, "deploy.application", `must be an ArgoCD application name, got "team/web"`},
+		{&Deploy{Application: "web", Revision: "$(run.branch)"}, "deploy.revision", `may only reference $(run.commit), got "$(run.branch)"`},
+	} {
+		spec := &Spec{Name: "p", Deploy: tc.deploy, Stages: []Stage{{Name: "build", Image: "golang:1.22"}}}
+		issues := Validate(spec, Policy{})
+		if tc.want == "" {
+			if len(issues) != 0 {
+				t.Errorf("Validate(%+v) = %v, want no issues", tc.deploy, issues)
+			}
+			continue
+		}
+		if len(issues) != 1 || issues[0].Path != tc.path || issues[0].Message != tc.want {
+			t.Errorf("Validate(%+v) = %v, want %s: %s", tc.deploy, issues, tc.path, tc.want)
+		}
+	}
+}
+
+func TestValidateChain(t *testing.T) {
+	spec := &Spec{
+		Name:   "p",
+		Stages: []Stage{{Name: "build", Image: "ghcr.io/org/build:1"}},
+		OnSuccess: &Chain{Trigger: []Trigger{
+			{Pipeline: &Spec{Name: "it"}, Params: map[string]string{"sha": "$(run.commit)", "bad": "$(run.owner)"}},
+			{},
+		}},
+		OnFailure: &Chain{},
+	}
+	Normalize(spec)
+	issues := Validate(spec, Policy{})
+
+	want := map[string]string{
+		"on_success.trigger[0].params.bad":      "unknown reference $(run.owner), want $(run.<field>) or $(params.<name>)",
+		"on_success.trigger[0].pipeline.stages": "at least one stage is required",
+		"on_success.trigger[1].pipeline":        "is required",
+		"on_failure.trigger":                    "at least one trigger is required",
+	}
+	for _, i := range issues {
+		if msg, ok := want[i.Path]; ok && i.Message == msg {
+			delete(want, i.Path)
+		}
+	}
+	if len(want) > 0 || len(issues) != 4 {
+		t.Fatalf("Validate() = %v, missing %v", issues, want)
+	}
+}
+
+func TestTriggerExpandParams(t *testing.T) {
+	run := &Run{ID: "r1", Status: StatusSucceeded, Spec: Spec{Name: "build", Commit: "abc", Params: map[string]string{"env": "qa"}}}
+	got := Trigger{Params: map[string]string{"from": "$(run.name)/$(run.id)", "env": "$(params.env)-$(params.missing)", "plain": "x"}}.ExpandParams(run)
+	want := map[string]string{"from": "build/r1", "env": "qa-", "plain": "x"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("param %s = %q, want %q", k, got[k], v)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Package plan describes the execution plan of a run, the DAG of its stages
+// and jobs with their current status, and the changes between two states of
+// it, so clients can draw a live DAG from one snapshot and a stream of
+// deltas instead of polling the whole run.
+package plan
+
+import (
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// Stage kinds.
+const (
+	KindStage   = "stage"
+	KindFinally = "finally"
+	KindPostRun = "post_run"
+)
+
+// Plan is the DAG of a run with the status of every node.
+type Plan struct {
+	PipelineID string          `json:"pipeline_id"`
+	Status     pipeline.Status `json:"status"`
+	Stages     []Stage         `json:"stages"`
+}
+
+// Stage is a node of the DAG.
+type Stage struct {
+	Name      string          `json:"name"`
+	Kind      string          `json:"kind"`
+	DependsOn []string        `json:"depends_on,omitempty"`
+	Status    pipeline.Status `json:"status"`
+	Jobs      []Job           `json:"jobs"`
+}
+
+// Job is one job of a stage, one per matrix combination.
+type Job struct {
+	ID     string          `json:"id"`
+	Name   string          `json:"name"`
+	Status pipeline.Status `json:"status"`
+}
+
+// Update is a single change between two plans of a run: the run's status
+// when Stage is empty, a stage's when Job is empty, otherwise a job's.
+type Update struct {
+	Kind   string          `json:"kind,omitempty"`
+	Stage  string          `json:"stage,omitempty"`
+	Job    string          `json:"job,omitempty"`
+	Status pipeline.Status `json:"status"`
+}
+
+// Build returns the plan of run. Stages that have not started yet are
+// planned from the spec as pending.
+func Build(run *pipeline.Run) *Plan {
+	p := &Plan{PipelineID: run.ID, Status: run.Status}
+	add := func(kind string, specs []pipeline.Stage, results []pipeline.StageResult) {
+		for i := range specs {
+			st := &specs[i]
+			node := Stage{Name: st.Name, Kind: kind, DependsOn: st.DependsOn, Status: pipeline.StatusPending}
+			if i < len(results) {
+				node.Status = results[i].Status
+				for _, job := range results[i].Jobs {
+					node.Jobs = append(node.Jobs, Job{ID: job.ID, Name: job.Name, Status: job.Status})
+				}
+			} else {
+				for _, job := range st.Jobs() {
+					node.Jobs = append(node.Jobs, Job{ID: job.ID, Name: job.DisplayName(), Status: pipeline.StatusPending})
+				}
+			}
+			p.Stages = append(p.Stages, node)
+		}
+	}
+	add(KindStage, run.Spec.Stages, run.Stages)
+	add(KindFinally, run.Spec.Finally, run.Finally)
+	if run.Spec.PostRun != nil {
+		var results []pipeline.StageResult
+		if run.PostRun != nil {
+			results = []pipeline.StageResult{*run.PostRun}
+		}
+		add(KindPostRun, []pipeline.Stage{*run.Spec.PostRun}, results)
+	}
+	return p
+}
+
+// Diff returns the changes from prev to next, two plans of the same run:
+// jobs first, then their stage, and the run itself last, so a client
+// applying them in order never sees a stage finish before its jobs.
+func Diff(prev, next *Plan) []Update {
+	var updates []Update
+	for i, st := range next.Stages {
+		var old *Stage
+		if i < len(prev.Stages) {
+			old = &prev.Stages[i]
+		}
+		for j, job := range st.Jobs {
+			if old != nil && j < len(old.Jobs) && old.Jobs[j].Status == job.Status {
+				continue
+			}
+			updates = append(updates, Update{Kind: st.Kind, Stage: st.Name, Job: job.ID, Status: job.Status})
+		}
+		if old == nil || old.Status != st.Status {
+			updates = append(updates, Update{Kind: st.Kind, Stage: st.Name, Status: st.Status})
+		}
+	}
+	if prev.Status != next.Status {
+		updates = append(updates, Update{Status: next.Status})
+	}
+	return updates
+}
@@ -0,0 +1,53 @@
+package plan
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestBuildPlansPendingStagesFromSpec(t *testing.T) {
+	run := &pipeline.Run{ID: "r", Status: pipeline.StatusQueued, Spec: pipeline.Spec{
+		Stages: []pipeline.Stage{
+			{Name: "build"},
+			{Name: "test", DependsOn: []string{"build"}, Matrix: &pipeline.Matrix{Params: map[string][]string{"go": {"1.20", "1.21"}}}},
+		},
+		PostRun: &pipeline.Stage{Name: "notify"},
+	}}
+	p := Build(run)
+	if len(p.Stages) != 3 || p.Stages[2].Kind != KindPostRun {
+		t.Fatalf("stages = %+v", p.Stages)
+	}
+	test := p.Stages[1]
+	if test.Status != pipeline.StatusPending || len(test.Jobs) != 2 || test.Jobs[1].ID != "test-1" || test.DependsOn[0] != "build" {
+		t.Fatalf("test stage = %+v", test)
+	}
+}
+
+func TestDiffOrdersJobsBeforeStagesAndRun(t *testing.T) {
+	run := &pipeline.Run{ID: "r", Status: pipeline.StatusRunning, Spec: pipeline.Spec{
+		Stages: []pipeline.Stage{{Name: "build"}, {Name: "test", DependsOn: []string{"build"}}},
+	}}
+	prev := Build(run)
+
+	run.Status = pipeline.StatusFailed
+	run.Stages = []pipeline.StageResult{
+		{Name: "build", Status: pipeline.StatusFailed, Jobs: []pipeline.JobResult{{ID: "build", Name: "build", Status: pipeline.StatusFailed}}},
+		{Name: "test", Status: pipeline.StatusSkipped, Jobs: []pipeline.JobResult{{ID: "test", Name: "test", Status: pipeline.StatusSkipped}}},
+	}
+	got := Diff(prev, Build(run))
+	want := []Update{
+		{Kind: KindStage, Stage: "build", Job: "build", Status: pipeline.StatusFailed},
+		{Kind: KindStage, Stage: "build", Status: pipeline.StatusFailed},
+		{Kind: KindStage, Stage: "test", Job: "test", Status: pipeline.StatusSkipped},
+		{Kind: KindStage, Stage: "test", Status: pipeline.StatusSkipped},
+		{Status: pipeline.StatusFailed},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Diff() = %+v, want %+v", got, want)
+	}
+	if updates := Diff(Build(run), Build(run)); len(updates) != 0 {
+		t.Fatalf("unchanged plan produced updates: %+v", updates)
+	}
+}
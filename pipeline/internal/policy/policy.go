@@ -0,0 +1,231 @@
+// Package policy evaluates submitted pipelines against an OPA/Rego admission
+// policy, either embedded from a file or served by an OPA server.
+//
+// The policy document named by policy.query (data.devmind.admission by
+// default) is evaluated with the input
+//
+//	{"spec": <normalized spec>, "params": <resolved params>}
+//
+// and must produce an object with any of these members:
+//
+//	deny        set or array of reasons; any reason denies the pipeline
+//	allow       boolean; false denies the pipeline when no reason is given
+//	annotations object of strings merged into the spec's annotations
+package policy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+const (
+	// DefaultQuery is used when policy.query is not configured.
+	DefaultQuery = "data.devmind.admission"
+	// DefaultTimeout is used when policy.timeout is not configured.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Input is what the policy sees of a submission.
+type Input struct {
+	Spec   *pipeline.Spec    `json:"spec"`
+	Params map[string]string `json:"params"`
+}
+
+// Decision is the outcome of evaluating a submission.
+type Decision struct {
+	Allowed bool
+	// Reasons explain a denial.
+	Reasons []string
+	// Annotations are added to the spec of an allowed pipeline.
+	Annotations map[string]string
+}
+
+// Evaluator decides whether a submission may run.
+type Evaluator interface {
+	Evaluate(ctx context.Context, in Input) (Decision, error)
+}
+
+// New returns the Evaluator configured by cfg, or nil when policy.enabled is
+// off. Exactly one of cfg.File and cfg.URL must be set; an OPA server at URL
+// is reached through the proxy network configures for the policy client.
+func New(ctx context.Context, cfg config.PolicyConfig, network egress.Config) (Evaluator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	query := cfg.Query
+	if query == "" {
+		query = DefaultQuery
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	switch {
+	case cfg.File != "" && cfg.URL != "":
+		return nil, fmt.Errorf("policy.file and policy.url are mutually exclusive")
+	case cfg.File != "":
+		src, err := os.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy: %w", err)
+		}
+		return NewRego(ctx, cfg.File, string(src), query, timeout)
+	case cfg.URL != "":
+		if !strings.HasPrefix(query, "data.") {
+			return nil, fmt.Errorf("policy.query %q must start with \"data.\" to be evaluated by an OPA server", query)
+		}
+		return &server{
+			url:     strings.TrimSuffix(cfg.URL, "/") + "/v1/data/" + strings.ReplaceAll(strings.TrimPrefix(query, "data."), ".", "/"),
+			timeout: timeout,
+			client:  network.Client(egress.ClientPolicy, timeout),
+		}, nil
+	default:
+		return nil, fmt.Errorf("policy.enabled requires policy.file or policy.url")
+	}
+}
+
+// embedded evaluates a Rego module in process.
+type embedded struct {
+	query   rego.PreparedEvalQuery
+	timeout time.Duration
+}
+
+// NewRego compiles the Rego module src and prepares query against it.
+func NewRego(ctx context.Context, name, src, query string, timeout time.Duration) (Evaluator, error) {
+	prepared, err := rego.New(rego.Query(query), rego.Module(name, src)).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile policy: %w", err)
+	}
+	return &embedded{query: prepared, timeout: timeout}, nil
+}
+
+func (e *embedded) Evaluate(ctx context.Context, in Input) (Decision, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	input, err := toValue(in)
+	if err != nil {
+		return Decision{}, err
+	}
+	rs, err := e.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to evaluate policy: %w", err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return Decision{}, fmt.Errorf("policy produced no decision")
+	}
+	return decode(rs[0].Expressions[0].Value)
+}
+
+// server evaluates the policy through the OPA REST data API.
+type server struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func (s *server) Evaluate(ctx context.Context, in Input) (Decision, error) {
+	body, err := json.Marshal(map[string]interface{}{"input": in})
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to build policy request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return Decision{}, fmt.Errorf("failed to query policy server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Decision{}, fmt.Errorf("policy server returned %s", resp.Status)
+	}
+
+	var out struct {
+		Result interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return Decision{}, fmt.Errorf("failed to decode policy response: %w", err)
+	}
+	if out.Result == nil {
+		return Decision{}, fmt.Errorf("policy produced no decision")
+	}
+	return decode(out.Result)
+}
+
+// toValue converts in to plain JSON values so the policy sees exactly the
+// documented JSON shape.
+func toValue(in Input) (interface{}, error) {
+	buf, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+	return v, nil
+}
+
+func decode(v interface{}) (Decision, error) {
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return Decision{}, fmt.Errorf("policy decision must be an object, got %T", v)
+	}
+
+	d := Decision{Allowed: true}
+	if allow, ok := doc["allow"]; ok {
+		b, ok := allow.(bool)
+		if !ok {
+			return Decision{}, fmt.Errorf("policy allow must be a boolean, got %T", allow)
+		}
+		d.Allowed = b
+	}
+	if deny, ok := doc["deny"]; ok {
+		reasons, ok := deny.([]interface{})
+		if !ok {
+			return Decision{}, fmt.Errorf("policy deny must be a set or array, got %T", deny)
+		}
+		for _, r := range reasons {
+			d.Reasons = append(d.Reasons, fmt.Sprint(r))
+		}
+		sort.Strings(d.Reasons)
+	}
+	if len(d.Reasons) > 0 {
+		d.Allowed = false
+	} else if !d.Allowed {
+		d.Reasons = []string{"denied by policy"}
+	}
+
+	if ann, ok := doc["annotations"]; ok {
+		m, ok := ann.(map[string]interface{})
+		if !ok {
+			return Decision{}, fmt.Errorf("policy annotations must be an object, got %T", ann)
+		}
+		d.Annotations = make(map[string]string, len(m))
+		for k, v := range m {
+			s, ok := v.(string)
+			if !ok {
+				s = fmt.Sprint(v)
+			}
+			d.Annotations[k] = s
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+const testPolicy = `
+package devmind.admission
+
+import future.keywords.contains
+import future.keywords.if
+import future.keywords.in
+
+deny contains msg if {
+	some stage in input.spec.stages
+	not startswith(stage.image, "ghcr.io/org/")
+	msg := sprintf("stage %s uses an untrusted image", [stage.name])
+}
+
+annotations["policy.devmind.io/team"] := input.spec.labels.team if input.spec.labels.team
+`
+
+func testInput(image string) Input {
+	return Input{
+		Spec: &pipeline.Spec{
+			Name:   "build",
+			Labels: map[string]string{"team": "payments"},
+			Stages: []pipeline.Stage{{Name: "compile", Image: image}},
+		},
+	}
+}
+
+func TestRegoFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admission.rego")
+	if err := os.WriteFile(path, []byte(testPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	eval, err := New(context.Background(), config.PolicyConfig{Enabled: true, File: path}, egress.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	d, err := eval.Evaluate(context.Background(), testInput("ghcr.io/org/go:1.21"))
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if !d.Allowed || d.Annotations["policy.devmind.io/team"] != "payments" {
+		t.Fatalf("decision = %+v, want allowed with team annotation", d)
+	}
+
+	d, err = eval.Evaluate(context.Background(), testInput("docker.io/library/golang"))
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if d.Allowed || !reflect.DeepEqual(d.Reasons, []string{"stage compile uses an untrusted image"}) {
+		t.Fatalf("decision = %+v, want denied for the untrusted image", d)
+	}
+}
+
+func TestServer(t *testing.T) {
+	var gotPath string
+	var gotInput Input
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		var body struct {
+			Input Input `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		gotInput = body.Input
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]interface{}{"allow": false}})
+	}))
+	defer srv.Close()
+
+	eval, err := New(context.Background(), config.PolicyConfig{Enabled: true, URL: srv.URL, Query: "data.ci.gate", Timeout: time.Second}, egress.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	d, err := eval.Evaluate(context.Background(), testInput("ghcr.io/org/go:1.21"))
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if gotPath != "/v1/data/ci/gate" || gotInput.Spec == nil || gotInput.Spec.Name != "build" {
+		t.Fatalf("request path %q input %+v, want the spec posted to the query's data path", gotPath, gotInput)
+	}
+	if d.Allowed || !reflect.DeepEqual(d.Reasons, []string{"denied by policy"}) {
+		t.Fatalf("decision = %+v, want denied with the default reason", d)
+	}
+}
+
+func TestServerUndefinedDecision(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	eval, err := New(context.Background(), config.PolicyConfig{Enabled: true, URL: srv.URL}, egress.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := eval.Evaluate(context.Background(), testInput("ghcr.io/org/go:1.21")); err == nil {
+		t.Fatal("Evaluate() succeeded for an undefined decision, want an error")
+	}
+}
+
+func TestNewDisabled(t *testing.T) {
+	eval, err := New(context.Background(), config.PolicyConfig{File: "/does/not/exist.rego"}, egress.Config{})
+	if err != nil || eval != nil {
+		t.Fatalf("New() = %v, %v, want nil evaluator when disabled", eval, err)
+	}
+}
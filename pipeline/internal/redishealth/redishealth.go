@@ -0,0 +1,134 @@
+// Package redishealth detects Redis outages so the engine can keep running in
+// local-only mode instead of going down with Redis.
+//
+// A Monitor pings Redis on an interval. While pings fail the engine is
+// degraded: the Monitor, installed as a hook on the Redis client, fails every
+// other command at once with ErrDegraded instead of letting it wait on an
+// unreachable server, and each Redis-backed feature falls back on its own.
+// The status cache serves from memory, run events are dropped, cancel
+// requests for runs on other replicas are refused, and so are distributed
+// locks and schedule claims, since granting them locally is only correct for
+// a single replica. redis.assume_single_replica opts schedule claims into
+// being granted locally.
+package redishealth
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// DefaultInterval is used when redis.health_interval is not configured.
+const DefaultInterval = 5 * time.Second
+
+// ErrDegraded is returned for Redis commands issued while Redis is
+// unreachable.
+var ErrDegraded = perrors.New(perrors.ErrUnavailable, "redis unavailable, running in local-only mode")
+
+type probeKey struct{}
+
+// Monitor tracks whether Redis is reachable.
+type Monitor struct {
+	client   redis.UniversalClient
+	interval time.Duration
+	logger   *logrus.Logger
+
+	degraded atomic.Bool
+}
+
+// New creates a Monitor for client and installs it as a hook on client.
+// Redis is assumed reachable until the first check says otherwise.
+func New(client redis.UniversalClient, cfg config.RedisConfig, logger *logrus.Logger) *Monitor {
+	m := &Monitor{client: client, interval: cfg.HealthInterval, logger: logger}
+	if m.interval <= 0 {
+		m.interval = DefaultInterval
+	}
+	client.AddHook(m)
+	metrics.RedisDegraded.Set(0)
+	return m
+}
+
+// Degraded reports whether Redis was unreachable at the last check.
+func (m *Monitor) Degraded() bool {
+	return m.degraded.Load()
+}
+
+// Check pings Redis once and updates the degraded state, warning loudly on
+// every transition.
+func (m *Monitor) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, probeKey{}, true), m.interval)
+	defer cancel()
+
+	err := m.client.Ping(ctx).Err()
+	switch degraded := err != nil; {
+	case degraded && !m.degraded.Swap(true):
+		metrics.RedisDegraded.Set(1)
+		m.logger.WithError(err).Error("Redis is unreachable, running degraded in local-only mode: " +
+			"status cache in memory, run events dropped, cross-replica cancellation, locks and schedule claims refused")
+	case !degraded && m.degraded.Swap(false):
+		metrics.RedisDegraded.Set(0)
+		m.logger.Warn("Redis is reachable again, leaving local-only mode")
+	}
+	return err
+}
+
+// Run checks Redis every interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// shed reports whether a command issued with ctx must fail fast.
+func (m *Monitor) shed(ctx context.Context) bool {
+	return m.degraded.Load() && ctx.Value(probeKey{}) == nil
+}
+
+// DialHook implements redis.Hook.
+func (m *Monitor) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if m.shed(ctx) {
+			return nil, ErrDegraded
+		}
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook implements redis.Hook.
+func (m *Monitor) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if m.shed(ctx) {
+			cmd.SetErr(ErrDegraded)
+			return ErrDegraded
+		}
+		return next(ctx, cmd)
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook.
+func (m *Monitor) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if m.shed(ctx) {
+			for _, cmd := range cmds {
+				cmd.SetErr(ErrDegraded)
+			}
+			return ErrDegraded
+		}
+		return next(ctx, cmds)
+	}
+}
@@ -0,0 +1,66 @@
+package redishealth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+func TestMonitorDegradesAndRecovers(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	m := New(client, config.RedisConfig{HealthInterval: time.Second}, logger)
+
+	if err := m.Check(ctx); err != nil || m.Degraded() {
+		t.Fatalf("Check() = %v, degraded = %v; want healthy", err, m.Degraded())
+	}
+
+	mr.Close()
+	if err := m.Check(ctx); err == nil || !m.Degraded() {
+		t.Fatalf("Check() = %v, degraded = %v; want degraded", err, m.Degraded())
+	}
+	if got := testutil.ToFloat64(metrics.RedisDegraded); got != 1 {
+		t.Errorf("redis_degraded = %v, want 1", got)
+	}
+	if err := client.Get(ctx, "k").Err(); !errors.Is(err, ErrDegraded) {
+		t.Errorf("Get() error = %v, want ErrDegraded", err)
+	}
+	if _, err := client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Publish(ctx, "c", "m")
+		return nil
+	}); !errors.Is(err, ErrDegraded) {
+		t.Errorf("pipeline error = %v, want ErrDegraded", err)
+	}
+	sub := client.Subscribe(ctx, "c")
+	if _, err := sub.Receive(ctx); !errors.Is(err, ErrDegraded) {
+		t.Errorf("Subscribe error = %v, want ErrDegraded", err)
+	}
+	sub.Close()
+
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(ctx); err != nil || m.Degraded() {
+		t.Fatalf("Check() = %v, degraded = %v; want recovered", err, m.Degraded())
+	}
+	if got := testutil.ToFloat64(metrics.RedisDegraded); got != 0 {
+		t.Errorf("redis_degraded = %v, want 0", got)
+	}
+	if err := client.Set(ctx, "k", "v", 0).Err(); err != nil {
+		t.Errorf("Set() after recovery error = %v", err)
+	}
+}
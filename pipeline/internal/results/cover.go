@@ -0,0 +1,74 @@
+package results
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// parseGoCover computes statement coverage from a Go coverage profile
+// (go test -coverprofile). A block listed more than once, as happens with
+// -coverpkg, counts as covered if any listing covered it. The profile holds
+// no test outcomes, so only Coverage is set.
+func parseGoCover(r io.Reader) (*pipeline.Results, error) {
+	type block struct {
+		stmts   int
+		covered bool
+	}
+	blocks := make(map[string]*block)
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		if line == 1 {
+			if !strings.HasPrefix(text, "mode: ") {
+				return nil, fmt.Errorf("line 1: expected a \"mode:\" header")
+			}
+			continue
+		}
+		// file.go:1.2,3.4 <statements> <count>
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: malformed profile entry", line)
+		}
+		stmts, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid statement count: %w", line, err)
+		}
+		count, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid hit count: %w", line, err)
+		}
+		b, ok := blocks[fields[0]]
+		if !ok {
+			b = &block{stmts: stmts}
+			blocks[fields[0]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read coverage profile: %w", err)
+	}
+
+	var total, covered int
+	for _, b := range blocks {
+		total += b.stmts
+		if b.covered {
+			covered += b.stmts
+		}
+	}
+	res := &pipeline.Results{}
+	if total > 0 {
+		cov := 100 * float64(covered) / float64(total)
+		res.Coverage = &cov
+	}
+	return res, nil
+}
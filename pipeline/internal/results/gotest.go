@@ -0,0 +1,83 @@
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// testEvent is a line of `go test -json` output.
+type testEvent struct {
+	Action  string `json:"Action"`
+	Package string `json:"Package"`
+	Test    string `json:"Test"`
+	Output  string `json:"Output"`
+}
+
+var coverageLine = regexp.MustCompile(`coverage: ([0-9.]+)% of statements`)
+
+// parseGoTestJSON counts the test outcomes of `go test -json` output. Each
+// test is counted once by its final action, so reruns with -count do not
+// inflate the totals. Coverage reported by `go test -cover` is averaged
+// over the packages that report it.
+func parseGoTestJSON(r io.Reader) (*pipeline.Results, error) {
+	type key struct{ pkg, test string }
+	outcomes := make(map[key]string)
+	var order []key
+	var coverSum float64
+	var coverPkgs int
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var ev testEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if ev.Test == "" {
+			if m := coverageLine.FindStringSubmatch(ev.Output); m != nil {
+				pct, _ := strconv.ParseFloat(m[1], 64)
+				coverSum += pct
+				coverPkgs++
+			}
+			continue
+		}
+		switch ev.Action {
+		case "pass", "fail", "skip":
+			k := key{ev.Package, ev.Test}
+			if _, seen := outcomes[k]; !seen {
+				order = append(order, k)
+			}
+			outcomes[k] = ev.Action
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read go test output: %w", err)
+	}
+
+	res := &pipeline.Results{}
+	for _, k := range order {
+		res.Tests++
+		switch outcomes[k] {
+		case "pass":
+			res.Passed++
+		case "skip":
+			res.Skipped++
+		case "fail":
+			failed(res, k.pkg+"."+k.test)
+		}
+	}
+	if coverPkgs > 0 {
+		cov := coverSum / float64(coverPkgs)
+		res.Coverage = &cov
+	}
+	return res, nil
+}
@@ -0,0 +1,57 @@
+package results
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+type junitCase struct {
+	Name      string    `xml:"name,attr"`
+	Classname string    `xml:"classname,attr"`
+	Failure   *struct{} `xml:"failure"`
+	Error     *struct{} `xml:"error"`
+	Skipped   *struct{} `xml:"skipped"`
+}
+
+type junitSuite struct {
+	Cases  []junitCase  `xml:"testcase"`
+	Suites []junitSuite `xml:"testsuite"`
+}
+
+// parseJUnit counts the testcases of a JUnit XML report, as written by
+// pytest --junitxml and most other test runners. The root may be either
+// <testsuites> or a single <testsuite>; errors count as failures.
+func parseJUnit(r io.Reader) (*pipeline.Results, error) {
+	var root junitSuite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("failed to decode junit report: %w", err)
+	}
+
+	res := &pipeline.Results{}
+	var walk func(s junitSuite)
+	walk = func(s junitSuite) {
+		for _, tc := range s.Cases {
+			res.Tests++
+			switch {
+			case tc.Failure != nil || tc.Error != nil:
+				name := tc.Name
+				if tc.Classname != "" {
+					name = tc.Classname + "." + tc.Name
+				}
+				failed(res, name)
+			case tc.Skipped != nil:
+				res.Skipped++
+			default:
+				res.Passed++
+			}
+		}
+		for _, child := range s.Suites {
+			walk(child)
+		}
+	}
+	walk(root)
+	return res, nil
+}
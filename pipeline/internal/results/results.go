@@ -0,0 +1,87 @@
+// Package results parses the output files of test and coverage tools into
+// structured pipeline results.
+//
+// A stage selects a parser by name with result_parser and declares the
+// artifact its jobs upload with result_file. Once a job finishes, the
+// executor opens that artifact and runs the parser on it, recording the
+// outcome on the job's result.
+package results
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// MaxFileBytes bounds how much of a result file is parsed.
+const MaxFileBytes = 32 << 20
+
+// ErrUnknownParser is returned for a parser name that is not registered.
+var ErrUnknownParser = errors.New("unknown result parser")
+
+// Parser turns a tool's output into results. Parsers set every field of
+// pipeline.Results but Parser, which Parse fills in.
+type Parser interface {
+	Parse(r io.Reader) (*pipeline.Results, error)
+}
+
+// ParserFunc adapts a function to Parser.
+type ParserFunc func(r io.Reader) (*pipeline.Results, error)
+
+// Parse calls f(r).
+func (f ParserFunc) Parse(r io.Reader) (*pipeline.Results, error) { return f(r) }
+
+var parsers = map[string]Parser{
+	"gotest-json": ParserFunc(parseGoTestJSON),
+	"junit":       ParserFunc(parseJUnit),
+	"go-cover":    ParserFunc(parseGoCover),
+}
+
+// Register makes p available as result_parser name. It is meant to be
+// called from init functions and panics on a duplicate name.
+func Register(name string, p Parser) {
+	if _, dup := parsers[name]; dup {
+		panic(fmt.Sprintf("results: parser %q registered twice", name))
+	}
+	parsers[name] = p
+}
+
+// Names returns the registered parser names, sorted.
+func Names() []string {
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse runs the named parser on r, reading at most MaxFileBytes of it.
+func Parse(name string, r io.Reader) (*pipeline.Results, error) {
+	p, ok := parsers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownParser, name)
+	}
+	lr := &io.LimitedReader{R: r, N: MaxFileBytes + 1}
+	res, err := p.Parse(lr)
+	if lr.N == 0 {
+		return nil, fmt.Errorf("result file exceeds %d bytes", MaxFileBytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	res.Parser = name
+	return res, nil
+}
+
+// failed records a failed test, keeping at most pipeline.MaxFailedTests
+// names.
+func failed(res *pipeline.Results, name string) {
+	res.Failed++
+	if len(res.FailedTests) < pipeline.MaxFailedTests {
+		res.FailedTests = append(res.FailedTests, name)
+	}
+}
@@ -0,0 +1,81 @@
+package results
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseGoTestJSON(t *testing.T) {
+	out := strings.Join([]string{
+		`{"Action":"run","Package":"a","Test":"TestOne"}`,
+		`{"Action":"pass","Package":"a","Test":"TestOne"}`,
+		`{"Action":"fail","Package":"a","Test":"TestTwo"}`,
+		`{"Action":"pass","Package":"a","Test":"TestTwo"}`,
+		`{"Action":"skip","Package":"b","Test":"TestThree"}`,
+		`{"Action":"fail","Package":"b","Test":"TestFour"}`,
+		`{"Action":"output","Package":"a","Output":"coverage: 80.0% of statements\n"}`,
+		`{"Action":"output","Package":"b","Output":"coverage: 60.0% of statements\n"}`,
+	}, "\n")
+	res, err := Parse("gotest-json", strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Parser != "gotest-json" || res.Tests != 4 || res.Passed != 2 || res.Skipped != 1 || res.Failed != 1 {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	if len(res.FailedTests) != 1 || res.FailedTests[0] != "b.TestFour" {
+		t.Fatalf("failed tests = %v", res.FailedTests)
+	}
+	if res.Coverage == nil || *res.Coverage != 70 {
+		t.Fatalf("coverage = %v, want 70", res.Coverage)
+	}
+
+	if _, err := Parse("gotest-json", strings.NewReader("PASS\n")); err == nil {
+		t.Fatal("expected plain text output to be rejected")
+	}
+}
+
+func TestParseJUnit(t *testing.T) {
+	report := `<?xml version="1.0"?>
+<testsuites>
+  <testsuite name="pytest">
+    <testcase classname="tests.test_api" name="test_ok"/>
+    <testcase classname="tests.test_api" name="test_fail"><failure message="assert"/></testcase>
+    <testcase classname="tests.test_api" name="test_error"><error message="boom"/></testcase>
+    <testcase classname="tests.test_api" name="test_skip"><skipped/></testcase>
+  </testsuite>
+</testsuites>`
+	res, err := Parse("junit", strings.NewReader(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Tests != 4 || res.Passed != 1 || res.Failed != 2 || res.Skipped != 1 {
+		t.Fatalf("unexpected results %+v", res)
+	}
+	if res.FailedTests[0] != "tests.test_api.test_fail" {
+		t.Fatalf("failed tests = %v", res.FailedTests)
+	}
+}
+
+func TestParseGoCover(t *testing.T) {
+	profile := `mode: set
+a/a.go:1.1,3.2 3 1
+a/a.go:4.1,6.2 1 0
+a/a.go:4.1,6.2 1 1
+a/b.go:1.1,2.2 4 0
+`
+	res, err := Parse("go-cover", strings.NewReader(profile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Coverage == nil || *res.Coverage != 50 {
+		t.Fatalf("coverage = %v, want 50", res.Coverage)
+	}
+}
+
+func TestParseUnknownParser(t *testing.T) {
+	if _, err := Parse("nunit", strings.NewReader("")); !errors.Is(err, ErrUnknownParser) {
+		t.Fatalf("err = %v, want ErrUnknownParser", err)
+	}
+}
@@ -0,0 +1,197 @@
+// Package scheduler submits pipelines on cron schedules.
+//
+// Each schedule may declare a jitter window. Its firings are shifted by an
+// offset within that window derived from the schedule name, so schedules
+// that share a cron expression spread out instead of stampeding the
+// cluster, while every replica computes the same fire time for a schedule.
+// When several replicas run the scheduler, a Claimer makes sure only one of
+// them submits a given firing.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// Submitter starts runs; *engine.Engine implements it.
+type Submitter interface {
+	Submit(ctx context.Context, req engine.SubmitRequest) (*pipeline.Run, error)
+}
+
+// Claimer grants a firing to exactly one replica. Claim reports whether the
+// caller won key.
+type Claimer interface {
+	Claim(ctx context.Context, key string) (bool, error)
+}
+
+type entry struct {
+	name     string
+	schedule cron.Schedule
+	spec     []byte
+	params   map[string]string
+	offset   time.Duration
+}
+
+// Scheduler fires the configured schedules.
+type Scheduler struct {
+	entries []*entry
+	submit  Submitter
+	claimer Claimer
+	clock   clock.Clock
+	logger  *logrus.Logger
+}
+
+// New parses the schedules in cfg and loads their spec files. claimer may be
+// nil for a single replica, and clk nil for the wall clock.
+func New(cfg config.SchedulerConfig, submit Submitter, claimer Claimer, clk clock.Clock, logger *logrus.Logger) (*Scheduler, error) {
+	s := &Scheduler{submit: submit, claimer: claimer, clock: clock.Or(clk), logger: logger}
+	seen := make(map[string]bool, len(cfg.Schedules))
+	for i, sc := range cfg.Schedules {
+		if sc.Name == "" {
+			return nil, fmt.Errorf("scheduler.schedules[%d]: name is required", i)
+		}
+		if seen[sc.Name] {
+			return nil, fmt.Errorf("scheduler.schedules[%d]: duplicate name %q", i, sc.Name)
+		}
+		seen[sc.Name] = true
+		if sc.Jitter < 0 {
+			return nil, fmt.Errorf("schedule %s: jitter must not be negative", sc.Name)
+		}
+
+		sched, err := cron.ParseStandard(sc.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: invalid cron expression %q: %w", sc.Name, sc.Cron, err)
+		}
+		spec, err := os.ReadFile(sc.SpecFile)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: failed to read spec: %w", sc.Name, err)
+		}
+		s.entries = append(s.entries, &entry{
+			name:     sc.Name,
+			schedule: sched,
+			spec:     spec,
+			params:   sc.Params,
+			offset:   Offset(sc.Name, sc.Jitter),
+		})
+	}
+	return s, nil
+}
+
+// Offset is the delay within window applied to every firing of the named
+// schedule. It depends only on its arguments, so all replicas agree on it.
+func Offset(name string, window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return time.Duration(h.Sum64() % uint64(window))
+}
+
+// Run fires schedules until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	if len(s.entries) == 0 {
+		return
+	}
+	nominal := make([]time.Time, len(s.entries))
+	now := s.clock.Now()
+	for i, e := range s.entries {
+		nominal[i] = e.next(now)
+	}
+
+	for {
+		i := 0
+		for j := range s.entries {
+			if nominal[j].Add(s.entries[j].offset).Before(nominal[i].Add(s.entries[i].offset)) {
+				i = j
+			}
+		}
+		e := s.entries[i]
+		fireAt := nominal[i].Add(e.offset)
+
+		timer := s.clock.NewTimer(fireAt.Sub(s.clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		s.fire(ctx, e, nominal[i], fireAt)
+		nominal[i] = e.schedule.Next(nominal[i])
+	}
+}
+
+// next returns the first nominal time after now whose jittered firing is
+// still ahead.
+func (e *entry) next(now time.Time) time.Time {
+	return e.schedule.Next(now.Add(-e.offset))
+}
+
+func (s *Scheduler) fire(ctx context.Context, e *entry, nominal, fireAt time.Time) {
+	log := s.logger.WithFields(logrus.Fields{
+		"schedule":     e.name,
+		"nominal_time": nominal.UTC().Format(time.RFC3339),
+		"fired_at":     fireAt.UTC().Format(time.RFC3339),
+	})
+
+	if s.claimer != nil {
+		won, err := s.claimer.Claim(ctx, fmt.Sprintf("%s:%d", e.name, nominal.Unix()))
+		if err != nil {
+			log.WithError(err).Error("Failed to claim scheduled firing, skipping it")
+			return
+		}
+		if !won {
+			log.Debug("Scheduled firing claimed by another replica")
+			return
+		}
+	}
+
+	run, err := s.submit.Submit(ctx, engine.SubmitRequest{
+		Spec:   e.spec,
+		Params: e.params,
+		Schedule: &pipeline.ScheduleTrigger{
+			Name:        e.name,
+			NominalTime: nominal.UTC(),
+			FiredAt:     fireAt.UTC(),
+		},
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to submit scheduled pipeline")
+		return
+	}
+	log.WithField("pipeline_id", run.ID).Info("Scheduled pipeline submitted")
+}
+
+// claimTTL outlives any plausible clock skew between replicas.
+const claimTTL = 24 * time.Hour
+
+// RedisClaimer claims firings with SET NX so each goes to one replica.
+type RedisClaimer struct {
+	client redis.UniversalClient
+}
+
+// NewRedisClaimer creates a RedisClaimer.
+func NewRedisClaimer(client redis.UniversalClient) *RedisClaimer {
+	return &RedisClaimer{client: client}
+}
+
+// Claim implements Claimer.
+func (c *RedisClaimer) Claim(ctx context.Context, key string) (bool, error) {
+	ok, err := c.client.SetNX(ctx, "devmind:schedule:"+key, 1, claimTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim %s: %w", key, err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+type fakeSubmitter struct {
+	mu   sync.Mutex
+	reqs []engine.SubmitRequest
+}
+
+func (f *fakeSubmitter) Submit(ctx context.Context, req engine.SubmitRequest) (*pipeline.Run, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reqs = append(f.reqs, req)
+	return &pipeline.Run{ID: "run"}, nil
+}
+
+func newTestScheduler(t *testing.T, jitter time.Duration, submit Submitter, claimer Claimer, clk clock.Clock) *Scheduler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nightly.yaml")
+	if err := os.WriteFile(path, []byte("name: nightly\nstages:\n- {name: a, task_ref: t}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s, err := New(config.SchedulerConfig{Schedules: []config.ScheduleConfig{{
+		Name: "nightly", Cron: "0 2 * * *", SpecFile: path, Jitter: jitter,
+	}}}, submit, claimer, clk, logger)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s
+}
+
+func TestOffsetIsStableAndWithinWindow(t *testing.T) {
+	window := 30 * time.Minute
+	a, b := Offset("nightly-build", window), Offset("nightly-build", window)
+	if a != b {
+		t.Fatalf("Offset() not deterministic: %s vs %s", a, b)
+	}
+	if a < 0 || a >= window {
+		t.Fatalf("Offset() = %s, want within [0, %s)", a, window)
+	}
+	if Offset("nightly-build", 0) != 0 {
+		t.Fatal("Offset() without a window must be zero")
+	}
+	if Offset("nightly-build", window) == Offset("nightly-test", window) {
+		t.Fatal("different schedules should land on different offsets")
+	}
+}
+
+func TestFireRecordsJitteredTime(t *testing.T) {
+	submit := &fakeSubmitter{}
+	s := newTestScheduler(t, time.Hour, submit, nil, nil)
+	e := s.entries[0]
+
+	now := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	nominal := e.next(now)
+	if want := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC); !nominal.Equal(want) {
+		t.Fatalf("next() = %s", nominal)
+	}
+	if !nominal.Add(e.offset).After(now) {
+		t.Fatalf("next firing %s is not after %s", nominal.Add(e.offset), now)
+	}
+
+	s.fire(context.Background(), e, nominal, nominal.Add(e.offset))
+	if len(submit.reqs) != 1 {
+		t.Fatalf("got %d submissions, want 1", len(submit.reqs))
+	}
+	trig := submit.reqs[0].Schedule
+	if trig.Name != "nightly" || !trig.NominalTime.Equal(nominal) || trig.FiredAt.Sub(trig.NominalTime) != e.offset {
+		t.Fatalf("trigger = %+v, want fired %s after nominal", trig, e.offset)
+	}
+}
+
+func TestRedisClaimerGrantsFiringOnce(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	submit := &fakeSubmitter{}
+	nominal := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		s := newTestScheduler(t, 0, submit, NewRedisClaimer(client), nil)
+		s.fire(context.Background(), s.entries[0], nominal, nominal)
+	}
+	if len(submit.reqs) != 1 {
+		t.Fatalf("got %d submissions across replicas, want 1", len(submit.reqs))
+	}
+}
+
+func TestRunFiresOnTheClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC))
+	submit := &fakeSubmitter{}
+	s := newTestScheduler(t, 0, submit, nil, clk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	// Nothing fires before 02:00; each day's firing follows once reached.
+	clk.BlockUntil(1)
+	clk.Advance(59 * time.Minute)
+	clk.Advance(time.Minute)
+	clk.BlockUntil(1)
+	clk.Advance(24 * time.Hour)
+	clk.BlockUntil(1)
+	cancel()
+	<-done
+
+	if len(submit.reqs) != 2 {
+		t.Fatalf("got %d submissions, want 2", len(submit.reqs))
+	}
+	for i, req := range submit.reqs {
+		if want := time.Date(2024, 5, 1+i, 2, 0, 0, 0, time.UTC); !req.Schedule.FiredAt.Equal(want) {
+			t.Errorf("firing %d at %s, want %s", i, req.Schedule.FiredAt, want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+// withAccessLog logs every HTTP request once it is served, at info for 2xx
+// and 3xx responses, warn for 4xx and error for 5xx. Authenticated requests
+// are logged with their subject.
+func (s *Server) withAccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		ctx, c := withCaller(r.Context())
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		log := logging.FromContext(r.Context(), s.logger).WithFields(logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"bytes":       rec.bytes,
+			"duration_ms": durationMillis(time.Since(start)),
+		})
+		if c.subject != "" {
+			log = log.WithField("subject", c.subject)
+		}
+		switch {
+		case rec.status >= 500:
+			log.Error("HTTP request")
+		case rec.status >= 400:
+			log.Warn("HTTP request")
+		default:
+			log.Info("HTTP request")
+		}
+	})
+}
+
+// statusRecorder records the status and size of a response. It unwraps to
+// the underlying writer, so http.ResponseController still reaches it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+// unaryAccessLog is withAccessLog for unary gRPC calls; the size logged is
+// that of the response message.
+func (s *Server) unaryAccessLog(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx, c := withCaller(ctx)
+	resp, err := handler(ctx, req)
+
+	var size int
+	if m, ok := resp.(proto.Message); ok && err == nil {
+		size = proto.Size(m)
+	}
+	s.logCall(ctx, info.FullMethod, c, err, time.Since(start), logrus.Fields{"bytes": size})
+	return resp, err
+}
+
+// streamAccessLog is withAccessLog for streaming gRPC calls; it logs the
+// number of messages sent instead of a size.
+func (s *Server) streamAccessLog(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, c := withCaller(ss.Context())
+	counted := &countingStream{ServerStream: ss, ctx: ctx}
+	err := handler(srv, counted)
+	s.logCall(ctx, info.FullMethod, c, err, time.Since(start), logrus.Fields{"messages": counted.sent})
+	return err
+}
+
+// logCall logs a gRPC call at the level of its status code: error for
+// server-side failures, warn for the caller's errors and info otherwise.
+func (s *Server) logCall(ctx context.Context, method string, c *caller, err error, d time.Duration, fields logrus.Fields) {
+	code := status.Code(err)
+	log := logging.FromContext(ctx, s.logger).WithFields(fields).WithFields(logrus.Fields{
+		"method":      method,
+		"code":        code.String(),
+		"duration_ms": durationMillis(d),
+	})
+	if c.subject != "" {
+		log = log.WithField("subject", c.subject)
+	}
+	switch code {
+	case codes.OK:
+		log.Info("gRPC call")
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		log.Error("gRPC call")
+	default:
+		log.Warn("gRPC call")
+	}
+}
+
+type countingStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent int
+}
+
+func (s *countingStream) Context() context.Context { return s.ctx }
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+	}
+	return err
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
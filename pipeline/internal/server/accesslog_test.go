@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+func TestAccessLogLevelFollowsStatus(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	s := &Server{logger: logger}
+	h := withRequestID(s.withAccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	})))
+
+	for path, want := range map[string]logrus.Level{
+		"/ok":      logrus.InfoLevel,
+		"/missing": logrus.WarnLevel,
+		"/broken":  logrus.ErrorLevel,
+	} {
+		hook.Reset()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(logging.RequestIDHeader, "req-"+path[1:])
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get(logging.RequestIDHeader); got != "req-"+path[1:] {
+			t.Errorf("%s: response request ID = %q", path, got)
+		}
+		e := hook.LastEntry()
+		if e == nil {
+			t.Fatalf("%s: no access log entry", path)
+		}
+		if e.Level != want || e.Data["path"] != path || e.Data["status"] != rec.Code || e.Data["request_id"] != "req-"+path[1:] {
+			t.Errorf("%s: logged %s %v, want level %s", path, e.Level, e.Data, want)
+		}
+	}
+	if e := hook.AllEntries(); len(e) != 1 {
+		t.Errorf("logged %d entries for one request", len(e))
+	}
+
+	hook.Reset()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if id := rec.Header().Get(logging.RequestIDHeader); id == "" || hook.LastEntry().Data["request_id"] != id {
+		t.Errorf("generated request ID %q not logged: %v", id, hook.LastEntry().Data)
+	}
+	if got := hook.LastEntry().Data["bytes"]; got != int64(2) {
+		t.Errorf("bytes = %v, want 2", got)
+	}
+}
+
+func TestUnaryAccessLog(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	s := &Server{logger: logger}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(logging.RequestIDHeader, "abc"))
+	info := &grpc.UnaryServerInfo{FullMethod: "/devmind.pipeline.v1.PipelineService/GetPipeline"}
+
+	_, _ = unaryRequestID(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.unaryAccessLog(ctx, req, info, func(context.Context, interface{}) (interface{}, error) {
+			return nil, status.Error(codes.NotFound, "no such run")
+		})
+	})
+	e := hook.LastEntry()
+	if e.Level != logrus.WarnLevel || e.Data["code"] != "NotFound" || e.Data["request_id"] != "abc" || e.Data["method"] != info.FullMethod {
+		t.Errorf("logged %s %v", e.Level, e.Data)
+	}
+
+	_, _ = s.unaryAccessLog(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	})
+	if e := hook.LastEntry(); e.Level != logrus.ErrorLevel {
+		t.Errorf("Internal logged at %s, want error", e.Level)
+	}
+}
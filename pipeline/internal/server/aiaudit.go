@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// aiExchangePurgeInterval is how often AI exchanges older than
+// ai_service.audit_retention are deleted.
+const aiExchangePurgeInterval = time.Hour
+
+type aiExchangesResponse struct {
+	Exchanges []pipeline.AIExchange `json:"exchanges"`
+}
+
+// handleListAIExchanges returns the raw AI exchanges recorded for a run
+// under ai_service.audit_payloads, in the order they were made.
+func (s *Server) handleListAIExchanges(w http.ResponseWriter, r *http.Request) {
+	exchanges, err := s.aiExchanges.ListAIExchanges(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if exchanges == nil {
+		exchanges = []pipeline.AIExchange{}
+	}
+	s.writeJSON(w, http.StatusOK, aiExchangesResponse{Exchanges: exchanges})
+}
+
+// purgeAIExchanges deletes the AI exchanges older than
+// ai_service.audit_retention, at startup and then every
+// aiExchangePurgeInterval. It runs even with auditing off so exchanges
+// recorded before it was turned off still expire.
+func (s *Server) purgeAIExchanges(ctx context.Context) {
+	retention := s.cfg.AIService.AuditRetention
+	if retention <= 0 {
+		retention = ai.DefaultAuditRetention
+	}
+	ticker := time.NewTicker(aiExchangePurgeInterval)
+	defer ticker.Stop()
+	for {
+		n, err := s.aiExchanges.PurgeAIExchanges(ctx, time.Now().Add(-retention))
+		if err != nil && ctx.Err() == nil {
+			s.logger.WithError(err).Error("Failed to purge expired AI exchanges")
+		}
+		if n > 0 {
+			s.logger.WithField("exchanges", n).Info("Purged expired AI exchanges")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/database"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestAdminListsAIExchanges(t *testing.T) {
+	db, err := database.Open(config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "runs.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	s := newArtifactTestServer(t)
+	s.cfg.Server.AdminToken = "secret"
+	s.aiExchanges = store.NewSQL(db)
+	x := pipeline.AIExchange{Endpoint: "/api/v1/predict/failure", Request: `{"pipeline_id":"run-1"}`, Response: `{"failure_probability":0.2}`, At: time.Now().UTC()}
+	if err := s.aiExchanges.SaveAIExchange(context.Background(), "run-1", x); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(id, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/pipelines/"+id+"/ai-exchanges", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := list("run-1", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status = %d, want 401", rec.Code)
+	}
+
+	var got aiExchangesResponse
+	rec := list("run-1", "secret")
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, %v", rec.Code, err)
+	}
+	if len(got.Exchanges) != 1 || got.Exchanges[0].Request != x.Request || got.Exchanges[0].Response != x.Response {
+		t.Errorf("exchanges = %+v", got.Exchanges)
+	}
+	if rec := list("run-2", "secret"); rec.Code != http.StatusOK || rec.Body.String() != "{\"exchanges\":[]}\n" {
+		t.Errorf("run without exchanges: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
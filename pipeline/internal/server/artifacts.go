@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/artifacts"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+type artifactEntry struct {
+	artifacts.Artifact
+	DownloadURL string `json:"download_url"`
+}
+
+type listArtifactsResponse struct {
+	PipelineID string          `json:"pipeline_id"`
+	Artifacts  []artifactEntry `json:"artifacts"`
+}
+
+// handleListArtifacts lists a run's artifacts together with a download URL
+// for each: presigned when the store supports it, otherwise a link back to
+// the engine's streaming endpoint.
+func (s *Server) handleListArtifacts(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+
+	list, err := s.artifacts.List(r.Context(), runID)
+	if errors.Is(err, artifacts.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("no artifacts for pipeline %s", runID))
+		return
+	}
+	if err != nil {
+		s.log(r.Context()).WithError(err).WithField("pipeline_id", runID).Error("Failed to list artifacts")
+		s.writeError(w, http.StatusInternalServerError, "failed to list artifacts")
+		return
+	}
+
+	presigner, canPresign := s.artifacts.(artifacts.Presigner)
+
+	resp := listArtifactsResponse{PipelineID: runID, Artifacts: make([]artifactEntry, 0, len(list))}
+	for _, a := range list {
+		entry := artifactEntry{Artifact: a}
+		if canPresign {
+			entry.DownloadURL, err = presigner.PresignGet(r.Context(), runID, a.Name, s.requestConfig(r.Context()).Artifacts.PresignExpiry)
+			if err != nil {
+				s.log(r.Context()).WithError(err).WithField("pipeline_id", runID).Error("Failed to presign artifact")
+				s.writeError(w, http.StatusInternalServerError, "failed to generate download url")
+				return
+			}
+		} else {
+			entry.DownloadURL = artifactDownloadPath(runID, a.Name)
+		}
+		resp.Artifacts = append(resp.Artifacts, entry)
+	}
+
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDownloadArtifact streams a single artifact through the engine.
+// http.ServeContent takes care of Range, If-Range and HEAD requests.
+func (s *Server) handleDownloadArtifact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	runID, name := vars["id"], vars["name"]
+
+	obj, err := s.artifacts.Open(r.Context(), runID, name)
+	if errors.Is(err, artifacts.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("artifact %s not found for pipeline %s", name, runID))
+		return
+	}
+	if err != nil {
+		s.log(r.Context()).WithError(err).WithField("pipeline_id", runID).Error("Failed to open artifact")
+		s.writeError(w, http.StatusInternalServerError, "failed to open artifact")
+		return
+	}
+	defer obj.Close()
+
+	info := obj.Info()
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(info.Name)))
+	http.ServeContent(w, r, info.Name, info.ModifiedAt, obj)
+}
+
+// handleUploadArtifact stores the request body as an artifact of a run.
+// Uploads that would take the run's artifacts past pipeline.max_artifact_bytes
+// are aborted with 413 as soon as they cross it, and the rejection is
+// recorded among the run's warnings.
+func (s *Server) handleUploadArtifact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	runID, name := vars["id"], vars["name"]
+	log := s.log(r.Context()).WithField("pipeline_id", runID)
+
+	writer, ok := s.artifacts.(artifacts.Writer)
+	if !ok {
+		s.writeError(w, http.StatusNotImplemented, "the artifact store does not accept uploads")
+		return
+	}
+	if _, err := s.engine.Get(r.Context(), runID); errors.Is(err, store.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, "pipeline not found")
+		return
+	} else if errors.Is(err, store.ErrUnavailable) {
+		s.writeUnavailable(w, r, err)
+		return
+	} else if err != nil {
+		log.WithError(err).Error("Failed to get pipeline")
+		s.writeError(w, http.StatusInternalServerError, "failed to get pipeline")
+		return
+	}
+
+	limit := s.requestConfig(r.Context()).Pipeline.MaxArtifactBytes
+	a, err := artifacts.PutLimited(r.Context(), writer, runID, name, r.Header.Get("Content-Type"), r.Body, r.ContentLength, limit)
+	var limitErr *artifacts.LimitError
+	switch {
+	case errors.As(err, &limitErr):
+		log.WithField("artifact", name).Warn("Artifact upload exceeds the run's artifact limit")
+		if err := s.engine.Warn(r.Context(), runID, limitErr.Error()); err != nil {
+			log.WithError(err).Warn("Failed to record rejected artifact upload on the run")
+		}
+		s.writeError(w, http.StatusRequestEntityTooLarge, limitErr.Error())
+	case errors.Is(err, artifacts.ErrNotFound):
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid artifact name %q", name))
+	case err != nil:
+		log.WithError(err).Error("Failed to store artifact")
+		s.writeError(w, http.StatusInternalServerError, "failed to store artifact")
+	default:
+		s.writeJSON(w, http.StatusCreated, artifactEntry{Artifact: a, DownloadURL: artifactDownloadPath(runID, a.Name)})
+	}
+}
+
+func artifactDownloadPath(runID, name string) string {
+	segments := strings.Split(name, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return "/pipelines/" + url.PathEscape(runID) + "/artifacts/" + strings.Join(segments, "/")
+}
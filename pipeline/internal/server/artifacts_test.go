@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/artifacts"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func newArtifactTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "run-1", "dist"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "run-1", "dist", "app.txt"), []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	s := &Server{
+		cfg:       &config.Config{},
+		logger:    logger,
+		artifacts: artifacts.NewFilesystemStore(root),
+		router:    mux.NewRouter(),
+	}
+	s.routes()
+	return s
+}
+
+func TestListArtifacts(t *testing.T) {
+	s := newArtifactTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines/run-1/artifacts", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var resp listArtifactsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Artifacts) != 1 {
+		t.Fatalf("got %d artifacts, want 1", len(resp.Artifacts))
+	}
+	got := resp.Artifacts[0]
+	if got.Name != "dist/app.txt" || got.Size != 10 {
+		t.Errorf("unexpected artifact %+v", got)
+	}
+	if got.DownloadURL != "/pipelines/run-1/artifacts/dist/app.txt" {
+		t.Errorf("download url = %q", got.DownloadURL)
+	}
+}
+
+func TestListArtifactsUnknownRun(t *testing.T) {
+	s := newArtifactTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines/missing/artifacts", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDownloadArtifactRange(t *testing.T) {
+	s := newArtifactTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/pipelines/run-1/artifacts/dist/app.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want 206", rec.Code)
+	}
+	if body := rec.Body.String(); body != "2345" {
+		t.Errorf("body = %q, want %q", body, "2345")
+	}
+}
+
+func TestDownloadArtifactRejectsTraversal(t *testing.T) {
+	s := newArtifactTestServer(t)
+
+	_, err := s.artifacts.Open(context.Background(), "run-1", "../../../../etc/passwd")
+	if !errors.Is(err, artifacts.ErrNotFound) {
+		t.Fatalf("Open() error = %v, want ErrNotFound", err)
+	}
+}
+
+// nopRunner succeeds every job without running it.
+type nopRunner struct{}
+
+func (nopRunner) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error { return nil }
+
+func TestUploadArtifactEnforcesRunLimit(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Pipeline.MaxArtifactBytes = 15
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+	if err := runs.SaveRun(context.Background(), &pipeline.Run{ID: "run-1", Status: pipeline.StatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/pipelines/run-1/artifacts/report.txt", strings.NewReader("1234")))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload within limit: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	// Unknown length, so the limit can only be caught while streaming.
+	req := httptest.NewRequest(http.MethodPut, "/pipelines/run-1/artifacts/big.bin", io.MultiReader(strings.NewReader("12345678")))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over limit: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if _, err := s.artifacts.Open(context.Background(), "run-1", "big.bin"); !errors.Is(err, artifacts.ErrNotFound) {
+		t.Fatalf("rejected upload left an artifact behind: %v", err)
+	}
+	run, err := runs.GetRun(context.Background(), "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Warnings) != 1 || !strings.Contains(run.Warnings[0], "big.bin") {
+		t.Fatalf("warnings = %q, want the rejected upload recorded", run.Warnings)
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// authExempt are the HTTP paths served without authentication: the health
+// probes, and the webhooks and admin endpoints, which check credentials of
+// their own. The metrics endpoint has a listener of its own and is never
+// authenticated either.
+var authExempt = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+var authExemptPrefixes = []string{"/webhooks/", "/admin/"}
+
+func isAuthExempt(path string) bool {
+	if authExempt[path] {
+		return true
+	}
+	for _, p := range authExemptPrefixes {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// caller is where the authentication of a request records its subject for
+// the access log, which wraps it and so cannot see the context it adds.
+type caller struct {
+	subject string
+}
+
+type callerKey struct{}
+
+func withCaller(ctx context.Context) (context.Context, *caller) {
+	c := &caller{}
+	return context.WithValue(ctx, callerKey{}, c), c
+}
+
+// withSubject attaches the authenticated subject to ctx, as the subject log
+// field and for the access log.
+func withSubject(ctx context.Context, subject string) context.Context {
+	if c, ok := ctx.Value(callerKey{}).(*caller); ok {
+		c.subject = subject
+	}
+	return logging.WithFields(ctx, logrus.Fields{"subject": subject})
+}
+
+// authenticate returns the subject of the bearer token given, or an
+// error of kind ErrUnauthenticated when there is none.
+func (s *Server) authenticate(ctx context.Context, authorization string) (string, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return "", perrors.New(perrors.ErrUnauthenticated, "missing bearer token")
+	}
+	return s.auth.Authenticate(ctx, token)
+}
+
+// withAuth refuses the requests without a valid bearer token under
+// auth.mode with 401, and attaches the subject of the others to their
+// context.
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil || isAuthExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		subject, err := s.authenticate(r.Context(), r.Header.Get("Authorization"))
+		if err != nil {
+			if perrors.Kind(err) == perrors.ErrUnauthenticated {
+				metrics.APIUnauthenticated.WithLabelValues("http").Inc()
+				w.Header().Set("WWW-Authenticate", `Bearer realm="devmind-pipeline"`)
+			}
+			s.writeFailure(w, r, err, "failed to authenticate")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withSubject(r.Context(), subject)))
+	})
+}
+
+// authStatus is the status of a gRPC call that failed to authenticate.
+func (s *Server) authStatus(ctx context.Context, err error) error {
+	if perrors.Kind(err) == perrors.ErrUnauthenticated {
+		metrics.APIUnauthenticated.WithLabelValues("grpc").Inc()
+	}
+	return s.statusError(ctx, err, "failed to authenticate")
+}
+
+func incomingAuthorization(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// unaryAuth is withAuth for unary gRPC calls, reading the token from the
+// authorization metadata.
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if s.auth == nil {
+		return handler(ctx, req)
+	}
+	subject, err := s.authenticate(ctx, incomingAuthorization(ctx))
+	if err != nil {
+		return nil, s.authStatus(ctx, err)
+	}
+	return handler(withSubject(ctx, subject), req)
+}
+
+// streamAuth is withAuth for streaming gRPC calls.
+func (s *Server) streamAuth(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if s.auth == nil {
+		return handler(srv, ss)
+	}
+	ctx := ss.Context()
+	subject, err := s.authenticate(ctx, incomingAuthorization(ctx))
+	if err != nil {
+		return s.authStatus(ctx, err)
+	}
+	return handler(srv, &authStream{ServerStream: ss, ctx: withSubject(ctx, subject)})
+}
+
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/devmind-pipeline/pipeline/internal/auth"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+func newAPIKeyAuth(t *testing.T) auth.Authenticator {
+	t.Helper()
+	a, err := auth.New(config.AuthConfig{Mode: auth.ModeAPIKey, APIKeys: []config.AuthAPIKeyConfig{{Name: "ci", Key: "secret"}}}, egress.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAuthRequiresBearerToken(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.auth = newAPIKeyAuth(t)
+	logger, hook := test.NewNullLogger()
+	s.logger = logger
+	h := s.withAccessLog(s.withAuth(s.router))
+	get := func(path, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong", "Basic c2VjcmV0"} {
+		rec := get("/pipelines/run-1/artifacts", authorization)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q: status = %d, WWW-Authenticate = %q", authorization, rec.Code, rec.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	hook.Reset()
+	if rec := get("/pipelines/run-1/artifacts", "Bearer secret"); rec.Code != http.StatusOK {
+		t.Errorf("valid key: status = %d: %s", rec.Code, rec.Body)
+	}
+	if e := hook.LastEntry(); e == nil || e.Data["subject"] != "ci" {
+		t.Errorf("access log entry = %v, want subject ci", e)
+	}
+
+	for _, path := range []string{"/healthz", "/admin/maintenance"} {
+		if rec := get(path, ""); rec.Code == http.StatusUnauthorized {
+			t.Errorf("%s required authentication", path)
+		}
+	}
+}
+
+func TestUnaryAuth(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	s := &Server{logger: logger, auth: newAPIKeyAuth(t)}
+	info := &grpc.UnaryServerInfo{FullMethod: "/devmind.pipeline.v1.PipelineService/GetPipeline"}
+	call := func(md metadata.MD) (string, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		var subject string
+		_, err := s.unaryAccessLog(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return s.unaryAuth(ctx, req, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				subject, _ = logging.Fields(ctx)["subject"].(string)
+				return nil, nil
+			})
+		})
+		return subject, err
+	}
+
+	if _, err := call(metadata.Pairs("authorization", "Bearer wrong")); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong key: code = %s", status.Code(err))
+	}
+	if _, err := call(metadata.MD{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("no token: code = %s", status.Code(err))
+	}
+	hook.Reset()
+	subject, err := call(metadata.Pairs("authorization", "Bearer secret"))
+	if err != nil || subject != "ci" {
+		t.Errorf("valid key: subject = %q, %v", subject, err)
+	}
+	if e := hook.LastEntry(); e == nil || e.Level != logrus.InfoLevel || e.Data["subject"] != "ci" {
+		t.Errorf("access log entry = %v, want subject ci", e)
+	}
+}
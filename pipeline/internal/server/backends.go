@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/argocd"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/database"
+	"github.com/devmind-pipeline/pipeline/internal/tekton"
+)
+
+// DefaultDatabaseProbeTimeout bounds the database check, which has no
+// timeout setting of its own.
+const DefaultDatabaseProbeTimeout = 5 * time.Second
+
+// defaultProbeTimeout bounds a check whose configured timeout is zero.
+const defaultProbeTimeout = 10 * time.Second
+
+// BackendCheck is the outcome of probing one backend.
+type BackendCheck struct {
+	Name string
+	// Required reports that the configuration depends on the backend, so a
+	// failed check means the server would not work as configured.
+	Required bool
+	// Skipped explains why the backend was not probed; Err and Latency are
+	// then unset.
+	Skipped string
+	Err     error
+	Latency time.Duration
+}
+
+// OK reports whether the check passed or was skipped.
+func (c BackendCheck) OK() bool {
+	return c.Err == nil
+}
+
+// backendProbe is a check of one backend bounded by timeout.
+type backendProbe struct {
+	name     string
+	required bool
+	skipped  string
+	timeout  time.Duration
+	check    func(ctx context.Context) error
+}
+
+// CheckBackends probes every backend cfg configures, in parallel, each bound
+// by its own configured timeout: Tekton through API discovery, ArgoCD by
+// opening a session, the ai-service through its /health endpoint, the
+// database and Redis by a ping. Nothing is started or modified.
+func CheckBackends(ctx context.Context, cfg *config.Config, logger *logrus.Logger) []BackendCheck {
+	return runProbes(ctx, backendProbes(cfg, logger))
+}
+
+func backendProbes(cfg *config.Config, logger *logrus.Logger) []backendProbe {
+	probes := []backendProbe{{
+		name:     "tekton",
+		required: true,
+		timeout:  tektonCheckTimeout,
+		check: func(ctx context.Context) error {
+			runner, err := tekton.New(cfg.Tekton, logger)
+			if err != nil {
+				return err
+			}
+			return runner.CheckCRDs(ctx)
+		},
+	}}
+
+	argo := backendProbe{name: "argocd", timeout: cfg.ArgoCD.Timeout}
+	if !cfg.ArgoCD.Configured() {
+		argo.skipped = "no argocd credentials configured"
+	} else {
+		argo.required = true
+		argo.check = func(ctx context.Context) error {
+			var secrets argocd.SecretReader
+			if cfg.ArgoCD.TokenSecret != "" {
+				runner, err := tekton.New(cfg.Tekton, logger)
+				if err != nil {
+					return err
+				}
+				secrets = runner
+			}
+			client, err := argocd.New(cfg.ArgoCD, cfg.Network, secrets, logger)
+			if err != nil {
+				return err
+			}
+			return client.Ping(ctx)
+		}
+	}
+	probes = append(probes, argo)
+
+	probes = append(probes, backendProbe{
+		name:     "ai_service",
+		required: cfg.AIService.Enabled,
+		timeout:  cfg.AIService.Timeout,
+		check: func(ctx context.Context) error {
+			return ai.New(cfg.AIService, cfg.Network, logger).Health(ctx)
+		},
+	})
+
+	// Runs are kept in the database, so the engine cannot work without it.
+	probes = append(probes, backendProbe{
+		name:     "database",
+		required: true,
+		timeout:  DefaultDatabaseProbeTimeout,
+		check: func(ctx context.Context) error {
+			db, err := database.Open(cfg.Database)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return db.PingContext(ctx)
+		},
+	})
+
+	// Redis backs optional features only; unless one is on, an unreachable
+	// Redis is reported but does not fail the check.
+	probes = append(probes, backendProbe{
+		name:     "redis",
+		required: cfg.Database.StatusCache.Enabled || cfg.Redis.CancelBroadcast || cfg.Scheduler.Distributed || cfg.Redis.RecordOrphans,
+		timeout:  cfg.Redis.HealthInterval,
+		check: func(ctx context.Context) error {
+			rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr(), DB: cfg.Redis.DB, Password: cfg.Redis.Password})
+			defer rdb.Close()
+			return rdb.Ping(ctx).Err()
+		},
+	})
+	return probes
+}
+
+func runProbes(ctx context.Context, probes []backendProbe) []BackendCheck {
+	checks := make([]BackendCheck, len(probes))
+	var wg sync.WaitGroup
+	for i, p := range probes {
+		checks[i] = BackendCheck{Name: p.name, Required: p.required, Skipped: p.skipped}
+		if p.skipped != "" {
+			continue
+		}
+		wg.Add(1)
+		go func(c *BackendCheck, p backendProbe) {
+			defer wg.Done()
+			timeout := p.timeout
+			if timeout <= 0 {
+				timeout = defaultProbeTimeout
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := p.check(ctx)
+			c.Latency = time.Since(start)
+			if err != nil && ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("no answer within %s: %w", timeout, err)
+			}
+			c.Err = err
+		}(&checks[i], p)
+	}
+	wg.Wait()
+	return checks
+}
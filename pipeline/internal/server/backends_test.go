@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func TestCheckBackendsProbesConfiguredBackends(t *testing.T) {
+	ml := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ml.Close()
+	mr := miniredis.RunT(t)
+	redisPort, _ := strconv.Atoi(mr.Port())
+
+	cfg := &config.Config{}
+	cfg.AIService.URL = []string{ml.URL}
+	cfg.Database.Type = "sqlite"
+	cfg.Database.Path = ":memory:"
+	cfg.Redis.Host = mr.Host()
+	cfg.Redis.Port = redisPort
+	cfg.Redis.CancelBroadcast = true
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// The first probe is Tekton's, which needs a cluster.
+	probes := backendProbes(cfg, logger)
+	checks := make(map[string]BackendCheck)
+	for _, c := range runProbes(context.Background(), probes[1:]) {
+		checks[c.Name] = c
+	}
+
+	if c := checks["argocd"]; c.Skipped == "" || c.Required {
+		t.Errorf("argocd without credentials = %+v, want skipped", c)
+	}
+	if c := checks["ai_service"]; c.Err != nil || c.Required {
+		t.Errorf("disabled ai_service = %+v, want optional and passing", c)
+	}
+	if c := checks["database"]; c.Err != nil || !c.Required {
+		t.Errorf("database = %+v, want required and passing", c)
+	}
+	if c := checks["redis"]; c.Err != nil || !c.Required {
+		t.Errorf("redis with cancel_broadcast = %+v, want required and passing", c)
+	}
+
+	mr.Close()
+	cfg.Redis.CancelBroadcast = false
+	cfg.Database.Path = ""
+	for _, c := range runProbes(context.Background(), backendProbes(cfg, logger)[3:4]) { // database
+		if c.Err == nil || !c.Required {
+			t.Errorf("sqlite without a path = %+v, want required and failing", c)
+		}
+	}
+	for _, c := range runProbes(context.Background(), backendProbes(cfg, logger)[4:]) { // redis
+		if c.Err == nil || c.Required {
+			t.Errorf("unused unreachable redis = %+v, want optional and failing", c)
+		}
+	}
+}
+
+func TestRunProbesHonorsTimeout(t *testing.T) {
+	checks := runProbes(context.Background(), []backendProbe{{
+		name:    "slow",
+		timeout: 20 * time.Millisecond,
+		check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}})
+	if c := checks[0]; c.Err == nil || c.Latency >= time.Second {
+		t.Errorf("slow check = %+v, want a timeout after 20ms", c)
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+)
+
+// Backpressure levels, from the run slots of this replica.
+const (
+	// BackpressureOK means submissions start without waiting.
+	BackpressureOK = "ok"
+	// BackpressureBusy means most slots are taken or runs are queued.
+	BackpressureBusy = "busy"
+	// BackpressureOverloaded means the queue is long enough that clients
+	// should hold back submissions that can wait.
+	BackpressureOverloaded = "overloaded"
+)
+
+// backpressureHeader carries the backpressure level on submission
+// responses, as an HTTP header and as gRPC header metadata.
+const backpressureHeader = "X-Backpressure"
+
+type backpressureResponse struct {
+	Level string `json:"level"`
+	engine.Load
+}
+
+// backpressureLevel derives the level of load from the thresholds of cfg.
+// Unlimited slots never push back.
+func backpressureLevel(load engine.Load, cfg config.BackpressureConfig) string {
+	if load.Slots <= 0 {
+		return BackpressureOK
+	}
+	busy := cfg.BusyUtilization
+	if busy <= 0 {
+		busy = 0.8
+	}
+	ratio := cfg.OverloadedQueueRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	slots := float64(load.Slots)
+	switch {
+	case load.Queued > 0 && float64(load.Queued) >= math.Ceil(ratio*slots):
+		return BackpressureOverloaded
+	case load.Queued > 0 || float64(load.Running) >= busy*slots:
+		return BackpressureBusy
+	}
+	return BackpressureOK
+}
+
+// backpressure returns the current load of the engine and its level under
+// the configuration of ctx.
+func (s *Server) backpressure(ctx context.Context) backpressureResponse {
+	load := s.engine.Load()
+	return backpressureResponse{
+		Level: backpressureLevel(load, s.requestConfig(ctx).Queue.Backpressure),
+		Load:  load,
+	}
+}
+
+// handleBackpressure reports how loaded this replica is, so clients and load
+// balancers can slow down before submissions start queueing for long.
+func (s *Server) handleBackpressure(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, s.backpressure(r.Context()))
+}
+
+// setBackpressureHeader tells a submitting HTTP client the level after its
+// submission.
+func (s *Server) setBackpressureHeader(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(backpressureHeader, s.backpressure(r.Context()).Level)
+}
+
+// sendBackpressureHeader tells a submitting gRPC client the level after its
+// submission.
+func (s *Server) sendBackpressureHeader(ctx context.Context) {
+	md := metadata.Pairs(backpressureHeader, s.backpressure(ctx).Level)
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		s.log(ctx).WithError(err).Debug("Failed to set the backpressure header")
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestBackpressureLevel(t *testing.T) {
+	defaults := config.BackpressureConfig{}
+	for _, tc := range []struct {
+		name string
+		load engine.Load
+		cfg  config.BackpressureConfig
+		want string
+	}{
+		{"unlimited slots", engine.Load{Running: 100, Queued: 100}, defaults, BackpressureOK},
+		{"idle", engine.Load{Slots: 10}, defaults, BackpressureOK},
+		{"below busy utilization", engine.Load{Running: 7, Slots: 10}, defaults, BackpressureOK},
+		{"at busy utilization", engine.Load{Running: 8, Slots: 10}, defaults, BackpressureBusy},
+		{"runs queued", engine.Load{Running: 10, Queued: 9, Slots: 10}, defaults, BackpressureBusy},
+		{"queue as long as the slots", engine.Load{Running: 10, Queued: 10, Slots: 10}, defaults, BackpressureOverloaded},
+		{"custom thresholds busy", engine.Load{Running: 5, Slots: 10}, config.BackpressureConfig{BusyUtilization: 0.5}, BackpressureBusy},
+		{"custom thresholds overloaded", engine.Load{Running: 4, Queued: 2, Slots: 4}, config.BackpressureConfig{OverloadedQueueRatio: 0.5}, BackpressureOverloaded},
+	} {
+		if got := backpressureLevel(tc.load, tc.cfg); got != tc.want {
+			t.Errorf("%s: backpressureLevel(%+v) = %q, want %q", tc.name, tc.load, got, tc.want)
+		}
+	}
+}
+
+func TestBackpressureEndpointAndSubmitHeader(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor:          executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:             runs,
+		Logger:            s.logger,
+		MaxConcurrentRuns: 4,
+	})
+	t.Cleanup(s.engine.Close)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/backpressure", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `{"level":"ok","running":0,"queued":0,"slots":4}`) {
+		t.Errorf("backpressure: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	spec := `{"spec": "name: deploy\nstages:\n- name: apply\n  image: ghcr.io/org/deploy:1.0\n"}`
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(spec)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("submit: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Backpressure"); got != BackpressureOK {
+		t.Errorf("X-Backpressure = %q, want %q", got, BackpressureOK)
+	}
+}
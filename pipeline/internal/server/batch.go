@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// maxBatchBytes bounds the size of a batch request body.
+const maxBatchBytes = 64 << 20
+
+// Rejection codes reported per batch item.
+const (
+	batchCodeInvalid           = "invalid"
+	batchCodeDenied            = "policy_denied"
+	batchCodePolicyUnavailable = "policy_unavailable"
+	batchCodeTooSoon           = "too_soon"
+	batchCodeCapacity          = "insufficient_capacity"
+	batchCodeTenantPaused      = "tenant_paused"
+	batchCodeDraining          = "draining"
+	batchCodeDuplicate         = "duplicate"
+	batchCodeInternal          = "internal"
+)
+
+type submitBatchRequest struct {
+	Items []submitPipelineRequest `json:"items"`
+}
+
+type batchItemResult struct {
+	Index    int             `json:"index"`
+	Accepted bool            `json:"accepted"`
+	Run      *pipeline.Run   `json:"run,omitempty"`
+	Code     string          `json:"code,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Issues   pipeline.Issues `json:"issues,omitempty"`
+}
+
+type submitBatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []batchItemResult `json:"results"`
+}
+
+// handleSubmitBatch submits many pipelines at once. The response is 200
+// whenever the batch itself was well-formed; each result says whether its
+// item was accepted.
+func (s *Server) handleSubmitBatch(w http.ResponseWriter, r *http.Request) {
+	var req submitBatchRequest
+	if !s.decodeBody(w, r, maxBatchBytes, &req) {
+		return
+	}
+	reqs := make([]engine.SubmitRequest, len(req.Items))
+	for i, item := range req.Items {
+		reqs[i] = engine.SubmitRequest{Spec: specBytes(item.Spec), Params: item.Params, TriggeredBy: item.TriggeredBy}
+	}
+	s.submitBatch(w, r, reqs)
+}
+
+// submitBatch submits reqs and writes the batch response.
+func (s *Server) submitBatch(w http.ResponseWriter, r *http.Request, reqs []engine.SubmitRequest) {
+	results, err := s.engine.SubmitBatch(r.Context(), reqs)
+	s.setBackpressureHeader(w, r)
+	if errors.Is(err, engine.ErrBatchTooLarge) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		s.log(r.Context()).WithError(err).Error("Failed to submit pipeline batch")
+		s.writeError(w, http.StatusInternalServerError, "failed to submit pipeline batch")
+		return
+	}
+
+	resp := submitBatchResponse{Results: make([]batchItemResult, len(results))}
+	for i, res := range results {
+		item := batchItemResult{Index: i, Accepted: res.Err == nil, Run: res.Run}
+		if res.Err != nil {
+			resp.Rejected++
+			item.Code, item.Error, item.Issues = s.batchRejection(r.Context(), res.Err)
+		} else {
+			resp.Accepted++
+		}
+		resp.Results[i] = item
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// SubmitBatch implements the gRPC method of the same name.
+func (g *grpcService) SubmitBatch(ctx context.Context, req *pipelinev1.SubmitBatchRequest) (*pipelinev1.SubmitBatchResponse, error) {
+	reqs := make([]engine.SubmitRequest, len(req.GetItems()))
+	for i, item := range req.GetItems() {
+		reqs[i] = engine.SubmitRequest{Spec: []byte(item.GetSpec()), Params: item.GetParams(), TriggeredBy: item.GetTriggeredBy()}
+	}
+
+	results, err := g.s.engine.SubmitBatch(ctx, reqs)
+	g.s.sendBackpressureHeader(ctx)
+	if errors.Is(err, engine.ErrBatchTooLarge) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		g.s.log(ctx).WithError(err).Error("Failed to submit pipeline batch")
+		return nil, status.Error(codes.Internal, "failed to submit pipeline batch")
+	}
+
+	resp := &pipelinev1.SubmitBatchResponse{}
+	for i, res := range results {
+		item := &pipelinev1.SubmitBatchResult{Index: int32(i), Accepted: res.Err == nil}
+		if res.Err != nil {
+			resp.Rejected++
+			var issues pipeline.Issues
+			item.Code, item.Error, issues = g.s.batchRejection(ctx, res.Err)
+			item.Issues = issuesToProto(issues)
+		} else {
+			resp.Accepted++
+			item.Run = runToProto(res.Run)
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	return resp, nil
+}
+
+// batchRejection classifies the error of a rejected batch item.
+func (s *Server) batchRejection(ctx context.Context, err error) (code, msg string, issues pipeline.Issues) {
+	var verr *engine.ValidationError
+	var perr *engine.PolicyError
+	var soon *engine.TooSoonError
+	var paused *engine.TenantPausedError
+	var dup *engine.DuplicateRunError
+	switch {
+	case errors.As(err, &verr):
+		return batchCodeInvalid, verr.Error(), verr.Issues
+	case errors.As(err, &dup):
+		return batchCodeDuplicate, dup.Error(), nil
+	case errors.As(err, &soon):
+		return batchCodeTooSoon, soon.Error(), nil
+	case errors.As(err, &paused):
+		return batchCodeTenantPaused, paused.Error(), nil
+	case errors.Is(err, engine.ErrDraining):
+		return batchCodeDraining, err.Error(), nil
+	case errors.As(err, &perr):
+		return batchCodeDenied, perr.Error(), nil
+	case errors.Is(err, engine.ErrPolicyUnavailable):
+		return batchCodePolicyUnavailable, err.Error(), nil
+	case errors.Is(err, pipeline.ErrInsufficientCapacity):
+		return batchCodeCapacity, err.Error(), nil
+	default:
+		s.log(ctx).WithError(err).Error("Failed to submit batch item")
+		return batchCodeInternal, "failed to submit pipeline", nil
+	}
+}
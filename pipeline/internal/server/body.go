@@ -0,0 +1,101 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultReadHeaderTimeout is used when server.read_header_timeout is
+	// not configured.
+	DefaultReadHeaderTimeout = 10 * time.Second
+	// DefaultBodyReadTimeout is used when server.body_read_timeout is not
+	// configured.
+	DefaultBodyReadTimeout = 30 * time.Second
+)
+
+// bodyError is a request body that could not be read, with the status to
+// answer it with.
+type bodyError struct {
+	status int
+	msg    string
+}
+
+func (e *bodyError) Error() string { return e.msg }
+
+// readBody reads the request body, refusing bodies larger than limit with
+// 413 and clients that take longer than server.body_read_timeout to send
+// theirs with 408, so a slow or oversized request cannot hold the handler
+// or be buffered whole.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	timeout := s.requestConfig(r.Context()).Server.BodyReadTimeout
+	if timeout <= 0 {
+		timeout = DefaultBodyReadTimeout
+	}
+	rc := http.NewResponseController(w)
+	// Not every ResponseWriter supports deadlines (test recorders do not);
+	// the body is then read without one.
+	deadline := rc.SetReadDeadline(time.Now().Add(timeout)) == nil
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, &bodyError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("request body exceeds %s", byteSize(limit))}
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		// The deadline is left in place so the server gives up on the
+		// rest of the body instead of waiting for it before answering.
+		w.Header().Set("Connection", "close")
+		return nil, &bodyError{status: http.StatusRequestTimeout, msg: fmt.Sprintf("request body not received within %s", timeout)}
+	case err != nil:
+		return nil, &bodyError{status: http.StatusBadRequest, msg: "failed to read request body: " + err.Error()}
+	}
+	if deadline {
+		rc.SetReadDeadline(time.Time{})
+	}
+	return data, nil
+}
+
+// decodeBody reads the request body as readBody does and decodes it as JSON
+// into v. It writes the error response itself and reports whether the
+// handler may go on.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, limit int64, v interface{}) bool {
+	data, err := s.readBody(w, r, limit)
+	if err != nil {
+		s.writeBodyError(w, err)
+		return false
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) writeBodyError(w http.ResponseWriter, err error) {
+	var berr *bodyError
+	if errors.As(err, &berr) {
+		s.writeError(w, berr.status, berr.msg)
+		return
+	}
+	s.writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// byteSize formats a power-of-two byte count the way the limits are
+// documented, e.g. "1MiB".
+func byteSize(n int64) string {
+	for _, u := range []struct {
+		unit string
+		size int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if n >= u.size && n%u.size == 0 {
+			return fmt.Sprintf("%d%s", n/u.size, u.unit)
+		}
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func newBodyTestServer(t *testing.T, timeout time.Duration) *httptest.Server {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := &config.Config{}
+	cfg.Server.BodyReadTimeout = timeout
+	s := &Server{cfg: cfg, logger: logger, router: mux.NewRouter()}
+	s.routes()
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRequestBodyReadTimeout(t *testing.T) {
+	srv := newBodyTestServer(t, 50*time.Millisecond)
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Announce a body and then stall, as a slow client would.
+	fmt.Fprintf(conn, "POST /pipelines/validate HTTP/1.1\r\nHost: engine\r\nContent-Length: 100\r\n\r\nname: p\n")
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("no response to a stalled body: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("status = %d, want 408", resp.StatusCode)
+	}
+}
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	srv := newBodyTestServer(t, time.Second)
+
+	for _, path := range []string{"/pipelines", "/pipelines/validate"} {
+		body := strings.NewReader(`{"spec": "` + strings.Repeat("x", maxSpecBytes) + `"}`)
+		resp, err := http.Post(srv.URL+path, "application/json", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(string(msg), "exceeds 1MiB") {
+			t.Errorf("POST %s: status = %d, body = %s, want 413", path, resp.StatusCode, msg)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+const (
+	// DefaultCoverageTrendPoints is the number of runs a coverage trend
+	// covers when the request sets no limit.
+	DefaultCoverageTrendPoints = 50
+	// coverageTrendScan bounds the recent runs searched for a trend.
+	coverageTrendScan = 1000
+)
+
+// coveragePoint is the coverage one run reported.
+type coveragePoint struct {
+	PipelineID string    `json:"pipeline_id"`
+	Commit     string    `json:"commit,omitempty"`
+	Branch     string    `json:"branch,omitempty"`
+	Status     string    `json:"status"`
+	Coverage   float64   `json:"coverage"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type coverageTrendResponse struct {
+	Pipeline string          `json:"pipeline"`
+	Branch   string          `json:"branch,omitempty"`
+	Points   []coveragePoint `json:"points"`
+}
+
+// handleCoverageTrend returns the coverage reported by the recent runs of a
+// pipeline, newest first, optionally on one branch only.
+func (s *Server) handleCoverageTrend(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("pipeline")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "pipeline is required")
+		return
+	}
+	limit := DefaultCoverageTrendPoints
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid limit "+strconv.Quote(v))
+			return
+		}
+		limit = n
+	}
+	branch := q.Get("branch")
+
+	runs, err := s.engine.List(r.Context(), store.ListOptions{Limit: coverageTrendScan})
+	if errors.Is(err, store.ErrUnavailable) {
+		s.writeUnavailable(w, r, err)
+		return
+	}
+	if err != nil {
+		s.log(r.Context()).WithError(err).Error("Failed to list pipelines")
+		s.writeError(w, http.StatusInternalServerError, "failed to list pipelines")
+		return
+	}
+
+	resp := coverageTrendResponse{Pipeline: name, Branch: branch, Points: []coveragePoint{}}
+	for _, run := range runs {
+		if run.Spec.Name != name || run.Coverage == nil || (branch != "" && run.Spec.Branch != branch) {
+			continue
+		}
+		resp.Points = append(resp.Points, coveragePoint{
+			PipelineID: run.ID,
+			Commit:     run.Spec.Commit,
+			Branch:     run.Spec.Branch,
+			Status:     string(run.Status),
+			Coverage:   *run.Coverage,
+			CreatedAt:  run.CreatedAt,
+		})
+		if len(resp.Points) == limit {
+			break
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
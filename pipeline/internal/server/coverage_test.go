@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestCoverageTrend(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	cov := func(v float64) *float64 { return &v }
+	start := time.Now().UTC()
+	for i, run := range []*pipeline.Run{
+		{ID: "main-1", Spec: pipeline.Spec{Name: "app", Branch: "main"}, Coverage: cov(71.5)},
+		{ID: "dev-1", Spec: pipeline.Spec{Name: "app", Branch: "dev"}, Coverage: cov(60)},
+		{ID: "main-2", Spec: pipeline.Spec{Name: "app", Branch: "main"}, Coverage: cov(73)},
+		{ID: "none", Spec: pipeline.Spec{Name: "app", Branch: "main"}},
+		{ID: "other", Spec: pipeline.Spec{Name: "lib", Branch: "main"}, Coverage: cov(90)},
+	} {
+		run.Status = pipeline.StatusSucceeded
+		run.CreatedAt = start.Add(time.Duration(i) * time.Second)
+		if err := runs.SaveRun(context.Background(), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(query string) (int, coverageTrendResponse) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines/coverage?"+query, nil))
+		var resp coverageTrendResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := get("pipeline=app&branch=main")
+	if code != http.StatusOK || len(resp.Points) != 2 || resp.Points[0].PipelineID != "main-2" || resp.Points[1].Coverage != 71.5 {
+		t.Errorf("main trend = %d %+v", code, resp)
+	}
+	if _, resp := get("pipeline=app&limit=1"); len(resp.Points) != 1 || resp.Points[0].PipelineID != "main-2" {
+		t.Errorf("limited trend = %+v", resp)
+	}
+	if code, _ := get("branch=main"); code != http.StatusBadRequest {
+		t.Errorf("trend without pipeline = %d, want 400", code)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/redishealth"
+	"github.com/devmind-pipeline/pipeline/internal/scheduler"
+)
+
+// degradedClaimer claims schedule firings through Redis, and grants them
+// outright while Redis is unreachable, as a single replica without a
+// claimer would. It is only used with redis.assume_single_replica.
+type degradedClaimer struct {
+	next scheduler.Claimer
+}
+
+func (c *degradedClaimer) Claim(ctx context.Context, key string) (bool, error) {
+	won, err := c.next.Claim(ctx, key)
+	if errors.Is(err, redishealth.ErrDegraded) {
+		return true, nil
+	}
+	return won, err
+}
+
+// listenCancels serves cancel requests from other replicas until ctx is
+// done. Losing the subscription, for instance to a Redis outage, is retried
+// rather than taking the server down: runs on this replica stay
+// cancellable through its own API meanwhile.
+func (s *Server) listenCancels(ctx context.Context) {
+	retry := redishealth.DefaultInterval
+	if s.cfg.Redis.HealthInterval > 0 {
+		retry = s.cfg.Redis.HealthInterval
+	}
+	for {
+		err := s.cancels.Listen(ctx, s.engine.CancelLocal)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.logger.WithError(err).Warn("Cancellation bus unavailable, retrying")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
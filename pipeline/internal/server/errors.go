@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+)
+
+// writeFailure answers a failed request with the HTTP status of err's kind.
+// An internal error is logged and answered with msg instead of its own
+// message, which may tell more than clients should know.
+func (s *Server) writeFailure(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	code := perrors.HTTPStatus(err)
+	switch code {
+	case http.StatusServiceUnavailable:
+		s.writeUnavailable(w, r, err)
+	case http.StatusInternalServerError:
+		s.log(r.Context()).WithError(err).Error(capitalize(msg))
+		s.writeError(w, code, msg)
+	default:
+		s.writeError(w, code, err.Error())
+	}
+}
+
+// statusError is writeFailure for gRPC: it returns the status of err's
+// kind.
+func (s *Server) statusError(ctx context.Context, err error, msg string) error {
+	code := perrors.Code(err)
+	if code == codes.Internal {
+		s.log(ctx).WithError(err).Error(capitalize(msg))
+		return status.Error(code, msg)
+	}
+	return status.Error(code, err.Error())
+}
+
+// unaryErrorStatus gives the errors gRPC methods return without a status
+// the code of their kind, rather than the Unknown gRPC would answer.
+func unaryErrorStatus(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, errorStatus(err)
+}
+
+// streamErrorStatus is unaryErrorStatus for streaming gRPC calls.
+func streamErrorStatus(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return errorStatus(handler(srv, ss))
+}
+
+func errorStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(perrors.Code(err), err.Error())
+}
+
+func capitalize(msg string) string {
+	if msg == "" {
+		return msg
+	}
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
@@ -0,0 +1,11 @@
+package server
+
+import (
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+)
+
+// grpcService implements pipelinev1.PipelineServiceServer on top of Server.
+type grpcService struct {
+	pipelinev1.UnimplementedPipelineServiceServer
+	s *Server
+}
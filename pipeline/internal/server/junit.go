@@ -0,0 +1,48 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/junit"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+// handleJUnitReport renders a finished run's results as JUnit XML for test
+// reporting dashboards.
+func (s *Server) handleJUnitReport(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	run, err := s.engine.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "pipeline not found")
+		return
+	case errors.Is(err, store.ErrUnavailable):
+		s.writeUnavailable(w, r, err)
+		return
+	case err != nil:
+		s.log(r.Context()).WithError(err).Error("Failed to get pipeline")
+		s.writeError(w, http.StatusInternalServerError, "failed to get pipeline")
+		return
+	}
+	if !run.Status.Terminal() {
+		s.writeError(w, http.StatusConflict, "pipeline has not finished")
+		return
+	}
+
+	report, err := junit.Render(run)
+	switch {
+	case errors.Is(err, junit.ErrNoResults):
+		s.writeError(w, http.StatusNotFound, "pipeline has no results")
+		return
+	case err != nil:
+		s.log(r.Context()).WithError(err).WithField("pipeline_id", id).Error("Failed to render JUnit report")
+		s.writeError(w, http.StatusInternalServerError, "failed to render junit report")
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(report)
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/logs"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// logStreamWriteTimeout bounds every write to a log client. Without it a
+// client that stops reading pins the handler goroutine and its subscription
+// until the run ends.
+const logStreamWriteTimeout = 10 * time.Second
+
+// handleLogs returns a run's logs as newline-delimited JSON. By default all
+// stages are combined in capture order; ?stage=<name> restricts the output to
+// one stage and ?follow=true keeps the response open for live lines until the
+// run finishes.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	runID := mux.Vars(r)["id"]
+	stage := r.URL.Query().Get("stage")
+
+	follow := false
+	if v := r.URL.Query().Get("follow"); v != "" {
+		var err error
+		if follow, err = strconv.ParseBool(v); err != nil {
+			s.writeError(w, http.StatusBadRequest, "follow must be a boolean")
+			return
+		}
+	}
+
+	if !follow {
+		lines, err := s.logs.Read(runID, stage)
+		if !s.checkLogsErr(w, r, runID, stage, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		stream := newLogStream(w)
+		defer stream.close()
+		if err := stream.send(lines...); err != nil {
+			s.logStreamFailed(r.Context(), runID, err)
+		}
+		return
+	}
+
+	sub, err := s.logs.Subscribe(runID, stage)
+	if !s.checkLogsErr(w, r, runID, stage, err) {
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	stream := newLogStream(w)
+	defer stream.close()
+	if err := stream.send(sub.History...); err != nil {
+		s.logStreamFailed(r.Context(), runID, err)
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-sub.Lines:
+			if !ok {
+				return
+			}
+			// Send whatever else is already queued in the same write so a
+			// busy stage costs one flush rather than one per line.
+			batch := []logs.Line{line}
+		drain:
+			for len(batch) < cap(sub.Lines) {
+				select {
+				case next, ok := <-sub.Lines:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, next)
+				default:
+					break drain
+				}
+			}
+			if err := stream.send(batch...); err != nil {
+				s.logStreamFailed(r.Context(), runID, err)
+				return
+			}
+		}
+	}
+}
+
+// logStream writes NDJSON lines under a per-write deadline and surfaces
+// flush errors, which http.Flusher would swallow.
+type logStream struct {
+	rc  *http.ResponseController
+	enc *json.Encoder
+}
+
+func newLogStream(w http.ResponseWriter) *logStream {
+	return &logStream{rc: http.NewResponseController(w), enc: json.NewEncoder(w)}
+}
+
+func (ls *logStream) send(lines ...logs.Line) error {
+	values := make([]interface{}, len(lines))
+	for i := range lines {
+		values[i] = lines[i]
+	}
+	return ls.encode(values...)
+}
+
+// encode writes each value as a line and flushes them in one write.
+func (ls *logStream) encode(values ...interface{}) error {
+	if err := ls.rc.SetWriteDeadline(time.Now().Add(logStreamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	for _, v := range values {
+		if err := ls.enc.Encode(v); err != nil {
+			return err
+		}
+	}
+	if err := ls.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// close clears the write deadline so it cannot leak into the next request
+// served on the same connection.
+func (ls *logStream) close() {
+	ls.rc.SetWriteDeadline(time.Time{})
+}
+
+func (s *Server) logStreamFailed(ctx context.Context, runID string, err error) {
+	reason := "error"
+	var netErr net.Error
+	if errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		reason = "timeout"
+	}
+	metrics.LogStreamWriteFailures.WithLabelValues(reason).Inc()
+	s.log(ctx).WithError(err).WithField("pipeline_id", runID).Debug("Closing log stream after failed write")
+}
+
+func (s *Server) checkLogsErr(w http.ResponseWriter, r *http.Request, runID, stage string, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, logs.ErrExpired) {
+		// 410 rather than 404: the run and its logs existed, and the run may
+		// still be readable, but the logs are gone for good.
+		if stage != "" {
+			s.writeError(w, http.StatusGone, fmt.Sprintf("logs for stage %s of pipeline %s expired", stage, runID))
+		} else {
+			s.writeError(w, http.StatusGone, fmt.Sprintf("logs for pipeline %s expired", runID))
+		}
+		return false
+	}
+	if errors.Is(err, logs.ErrNotFound) {
+		if stage != "" {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("no logs for stage %s of pipeline %s", stage, runID))
+		} else {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("no logs for pipeline %s", runID))
+		}
+		return false
+	}
+	s.log(r.Context()).WithError(err).WithField("pipeline_id", runID).Error("Failed to read logs")
+	s.writeError(w, http.StatusInternalServerError, "failed to read logs")
+	return false
+}
+
+// logRetention converts the day-based logs configuration to a retention
+// policy.
+func logRetention(cfg config.LogsConfig) logs.Retention {
+	const day = 24 * time.Hour
+	r := logs.Retention{Default: time.Duration(cfg.RetentionDays) * day}
+	if len(cfg.StageRetentionDays) > 0 {
+		r.Stages = make(map[string]time.Duration, len(cfg.StageRetentionDays))
+		for stage, days := range cfg.StageRetentionDays {
+			r.Stages[stage] = time.Duration(days) * day
+		}
+	}
+	return r
+}
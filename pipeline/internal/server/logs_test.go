@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/logs"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// brokenWriter accepts the first write and fails every later one, like a
+// client whose connection drops mid-stream.
+type brokenWriter struct {
+	header http.Header
+	writes int
+}
+
+func (b *brokenWriter) Header() http.Header { return b.header }
+func (b *brokenWriter) WriteHeader(int)     {}
+func (b *brokenWriter) Write(p []byte) (int, error) {
+	b.writes++
+	if b.writes > 1 {
+		return 0, errors.New("connection reset by peer")
+	}
+	return len(p), nil
+}
+
+func TestFollowClosesStreamOnWriteFailure(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{
+		cfg:    &config.Config{},
+		logger: logger,
+		logs:   logs.NewManager(t.TempDir()),
+		router: mux.NewRouter(),
+	}
+	s.routes()
+
+	out, err := s.logs.StageWriter("run-1", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.logs.Finish("run-1")
+	io.WriteString(out, "first\n")
+
+	// A healthy follower on the same run must be unaffected.
+	other, err := s.logs.Subscribe("run-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	before := testutil.ToFloat64(metrics.LogStreamWriteFailures.WithLabelValues("error"))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "/pipelines/run-1/logs?follow=true", nil)
+		s.router.ServeHTTP(&brokenWriter{header: http.Header{}}, req)
+	}()
+
+	// The history write succeeds; the next line hits the broken connection.
+	time.Sleep(20 * time.Millisecond)
+	io.WriteString(out, "second\n")
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after a failed write")
+	}
+	if got := testutil.ToFloat64(metrics.LogStreamWriteFailures.WithLabelValues("error")) - before; got != 1 {
+		t.Errorf("write failures = %v, want 1", got)
+	}
+
+	io.WriteString(out, "third\n")
+	var texts []string
+	for len(texts) < 2 {
+		select {
+		case line := <-other.Lines:
+			texts = append(texts, line.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("healthy follower got %v", texts)
+		}
+	}
+	if texts[0] != "second" || texts[1] != "third" {
+		t.Errorf("healthy follower got %v", texts)
+	}
+}
+
+func TestLogsOfPurgedRunAreGone(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{
+		cfg:    &config.Config{},
+		logger: logger,
+		logs:   logs.NewManager(t.TempDir()),
+		router: mux.NewRouter(),
+	}
+	s.routes()
+
+	out, err := s.logs.StageWriter("run-1", "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(out, "compiling\n")
+	s.logs.Finish("run-1")
+
+	r := logRetention(config.LogsConfig{RetentionDays: 1})
+	if _, err := s.logs.Purge(context.Background(), r, time.Now().Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/pipelines/run-1/logs", "/pipelines/run-1/logs?stage=build", "/pipelines/run-1/logs?follow=true"} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusGone {
+			t.Errorf("GET %s = %d, want 410", path, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines/run-2/logs", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET logs of unknown run = %d, want 404", rec.Code)
+	}
+}
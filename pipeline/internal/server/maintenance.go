@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+const (
+	// DefaultMaintenanceMessage is used when server.maintenance.message is
+	// not configured.
+	DefaultMaintenanceMessage = "the pipeline engine is under maintenance, please retry later"
+	// DefaultMaintenanceRetryAfter is used when
+	// server.maintenance.retry_after is not configured.
+	DefaultMaintenanceRetryAfter = 5 * time.Minute
+)
+
+// maintenanceMode returns the maintenance settings in force: those set
+// through the admin API, or else the configured ones.
+func (s *Server) maintenanceMode(ctx context.Context) config.MaintenanceConfig {
+	if m := s.maintenance.Load(); m != nil {
+		return *m
+	}
+	return s.requestConfig(ctx).Server.Maintenance
+}
+
+// maintenanceRefusal reports whether maintenance mode is on, with the
+// message and retry delay to refuse submissions with.
+func (s *Server) maintenanceRefusal(ctx context.Context) (msg string, retry time.Duration, on bool) {
+	m := s.maintenanceMode(ctx)
+	if !m.Enabled {
+		return "", 0, false
+	}
+	msg, retry = m.Message, m.RetryAfter
+	if msg == "" {
+		msg = DefaultMaintenanceMessage
+	}
+	if retry <= 0 {
+		retry = DefaultMaintenanceRetryAfter
+	}
+	return msg, retry, true
+}
+
+// unlessMaintenance answers 503 with the maintenance message and a
+// Retry-After header instead of calling next while maintenance mode is on.
+// It wraps the submission endpoints only: status reads, logs, artifacts and
+// cancellation keep working during maintenance.
+func (s *Server) unlessMaintenance(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		msg, retry, on := s.maintenanceRefusal(r.Context())
+		if !on {
+			next(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+		s.writeError(w, http.StatusServiceUnavailable, msg)
+	}
+}
+
+// maintenanceMethods are the gRPC methods refused during maintenance, the
+// counterparts of the HTTP endpoints wrapped by unlessMaintenance.
+var maintenanceMethods = map[string]bool{
+	pipelinev1.PipelineService_SubmitPipeline_FullMethodName: true,
+	pipelinev1.PipelineService_SubmitBatch_FullMethodName:    true,
+	pipelinev1.PipelineService_RerunPipeline_FullMethodName:  true,
+}
+
+// unaryMaintenance is unlessMaintenance for gRPC: the submission methods
+// fail with Unavailable and the maintenance message, and a retry-after
+// trailer says when to retry.
+func (s *Server) unaryMaintenance(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !maintenanceMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	msg, retry, on := s.maintenanceRefusal(ctx)
+	if !on {
+		return handler(ctx, req)
+	}
+	_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(retry.Seconds())))))
+	return nil, status.Error(codes.Unavailable, msg)
+}
+
+// admin restricts next to requests bearing server.admin_token. Without a
+// token configured the admin endpoints do not exist.
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.requestConfig(r.Context()).Server.AdminToken
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			s.writeError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+type maintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	// RetryAfter is a Go duration such as "15m".
+	RetryAfter string `json:"retry_after,omitempty"`
+}
+
+type maintenanceResponse struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message,omitempty"`
+	RetryAfter string `json:"retry_after,omitempty"`
+	// Source is "admin" while the admin API overrides the configuration,
+	// otherwise "config".
+	Source string `json:"source"`
+}
+
+func (s *Server) writeMaintenance(w http.ResponseWriter, r *http.Request) {
+	m := s.maintenanceMode(r.Context())
+	resp := maintenanceResponse{Enabled: m.Enabled, Message: m.Message, Source: "config"}
+	if m.RetryAfter > 0 {
+		resp.RetryAfter = m.RetryAfter.String()
+	}
+	if s.maintenance.Load() != nil {
+		resp.Source = "admin"
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGetMaintenance reports the maintenance mode in force.
+func (s *Server) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	s.writeMaintenance(w, r)
+}
+
+// handleSetMaintenance turns maintenance mode on or off on this replica,
+// overriding server.maintenance until cleared.
+func (s *Server) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if !s.decodeBody(w, r, maxSpecBytes, &req) {
+		return
+	}
+	m := &config.MaintenanceConfig{Enabled: req.Enabled, Message: req.Message}
+	if req.RetryAfter != "" {
+		d, err := time.ParseDuration(req.RetryAfter)
+		if err != nil || d < 0 {
+			s.writeError(w, http.StatusBadRequest, "retry_after must be a non-negative duration such as \"15m\"")
+			return
+		}
+		m.RetryAfter = d
+	}
+	s.maintenance.Store(m)
+	s.log(r.Context()).WithField("enabled", m.Enabled).Warn("Maintenance mode set through the admin API")
+	s.writeMaintenance(w, r)
+}
+
+// handleClearMaintenance drops the admin override, so server.maintenance
+// applies again.
+func (s *Server) handleClearMaintenance(w http.ResponseWriter, r *http.Request) {
+	s.maintenance.Store(nil)
+	s.log(r.Context()).Info("Maintenance mode override cleared")
+	s.writeMaintenance(w, r)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func newMaintenanceTestServer(cfg *config.Config) *Server {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{cfg: cfg, logger: logger, router: mux.NewRouter()}
+	s.routes()
+	return s
+}
+
+func TestMaintenanceRefusesSubmissions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Maintenance = config.MaintenanceConfig{Enabled: true, Message: "upgrading to v2", RetryAfter: 90 * time.Second}
+	s := newMaintenanceTestServer(cfg)
+
+	for _, path := range []string{"/pipelines", "/pipelines/batch"} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}")))
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "90" || !strings.Contains(rec.Body.String(), "upgrading to v2") {
+			t.Fatalf("POST %s: status = %d, Retry-After = %q, body = %s", path, rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+		}
+	}
+
+	// Validation is read-only and keeps working.
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pipelines/validate", strings.NewReader("name: p\nstages: []\n")))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("validate during maintenance: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestAdminMaintenanceOverride(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.AdminToken = "secret"
+	s := newMaintenanceTestServer(cfg)
+
+	admin := func(method, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := admin(http.MethodPut, `{"enabled":true}`, "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong token: status = %d", rec.Code)
+	}
+	if rec := admin(http.MethodPut, `{"enabled":true,"retry_after":"2m"}`, "secret"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"source":"admin"`) {
+		t.Fatalf("enable: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader("{}")))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "120" || !strings.Contains(rec.Body.String(), DefaultMaintenanceMessage) {
+		t.Fatalf("submit under admin maintenance: status = %d, Retry-After = %q, body = %s", rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+	}
+
+	if rec := admin(http.MethodDelete, "", "secret"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"enabled":false`) {
+		t.Fatalf("clear: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	cfg.Server.AdminToken = ""
+	if rec := admin(http.MethodGet, "", "secret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("admin without a token configured: status = %d", rec.Code)
+	}
+}
+
+// trailerStream records the trailer set by a unary interceptor.
+type trailerStream struct {
+	grpc.ServerTransportStream
+	trailer metadata.MD
+}
+
+func (s *trailerStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
+
+func TestMaintenanceRefusesGRPCSubmissions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Maintenance = config.MaintenanceConfig{Enabled: true, Message: "upgrading to v2", RetryAfter: 90 * time.Second}
+	s := newMaintenanceTestServer(cfg)
+	call := func(method string) (*trailerStream, error) {
+		stream := &trailerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+		_, err := s.unaryMaintenance(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		return stream, err
+	}
+
+	for _, method := range []string{
+		pipelinev1.PipelineService_SubmitPipeline_FullMethodName,
+		pipelinev1.PipelineService_SubmitBatch_FullMethodName,
+		pipelinev1.PipelineService_RerunPipeline_FullMethodName,
+	} {
+		stream, err := call(method)
+		if st, _ := status.FromError(err); st.Code() != codes.Unavailable || st.Message() != "upgrading to v2" {
+			t.Errorf("%s: error = %v, want Unavailable with the maintenance message", method, err)
+		}
+		if got := stream.trailer.Get("retry-after"); len(got) != 1 || got[0] != "90" {
+			t.Errorf("%s: retry-after trailer = %v, want 90", method, got)
+		}
+	}
+
+	// Reads and cancellation keep working.
+	for _, method := range []string{
+		pipelinev1.PipelineService_GetPipeline_FullMethodName,
+		pipelinev1.PipelineService_CancelPipeline_FullMethodName,
+	} {
+		if _, err := call(method); err != nil {
+			t.Errorf("%s during maintenance: %v", method, err)
+		}
+	}
+
+	cfg.Server.Maintenance.Enabled = false
+	if _, err := call(pipelinev1.PipelineService_SubmitPipeline_FullMethodName); err != nil {
+		t.Errorf("submit outside maintenance: %v", err)
+	}
+}
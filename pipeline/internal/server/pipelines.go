@@ -0,0 +1,434 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/labels"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/cancellation"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+type submitPipelineRequest struct {
+	// Spec is either a YAML/JSON document in a string or an inline object.
+	Spec   json.RawMessage   `json:"spec"`
+	Params map[string]string `json:"params,omitempty"`
+	// TriggeredBy names the user or system submitting the run.
+	TriggeredBy string `json:"triggered_by,omitempty"`
+}
+
+type validationErrorResponse struct {
+	Error  string          `json:"error"`
+	Issues pipeline.Issues `json:"issues"`
+}
+
+// handleSubmitPipeline starts a run from a JSON body holding the spec and
+// the params for this run.
+func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
+	var req submitPipelineRequest
+	if !s.decodeBody(w, r, maxSpecBytes, &req) {
+		return
+	}
+	run, err := s.engine.Submit(r.Context(), engine.SubmitRequest{Spec: specBytes(req.Spec), Params: req.Params, TriggeredBy: req.TriggeredBy})
+	s.setBackpressureHeader(w, r)
+	if err != nil {
+		s.writeSubmitError(w, r, err)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, run)
+}
+
+// writeSubmitError answers a refused or failed submission.
+func (s *Server) writeSubmitError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *engine.ValidationError
+	var perr *engine.PolicyError
+	var soon *engine.TooSoonError
+	var paused *engine.TenantPausedError
+	var dup *engine.DuplicateRunError
+	switch {
+	case errors.As(err, &verr):
+		s.writeJSON(w, http.StatusUnprocessableEntity, validationErrorResponse{Error: verr.Error(), Issues: verr.Issues})
+	case errors.As(err, &dup):
+		s.writeError(w, http.StatusConflict, dup.Error())
+	case errors.As(err, &soon):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(soon.RetryAfter.Seconds()))))
+		s.writeError(w, http.StatusTooManyRequests, soon.Error())
+	case errors.As(err, &paused):
+		s.writeError(w, http.StatusServiceUnavailable, paused.Error())
+	case errors.Is(err, engine.ErrDraining):
+		s.writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.As(err, &perr):
+		s.writeError(w, http.StatusForbidden, perr.Error())
+	case errors.Is(err, engine.ErrPolicyUnavailable):
+		s.writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, pipeline.ErrInsufficientCapacity):
+		s.writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.writeFailure(w, r, err, "failed to submit pipeline")
+	}
+}
+
+// specBytes returns the spec document of a request: the string's contents
+// when the spec was sent as a string, the inline object otherwise.
+func specBytes(raw json.RawMessage) []byte {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []byte(text)
+	}
+	return []byte(raw)
+}
+
+func (s *Server) handleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	run, err := s.engine.Get(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		s.writeFailure(w, r, err, "failed to get pipeline")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, run)
+}
+
+type cancelPipelineResponse struct {
+	ID string `json:"id"`
+	// Status is "cancelling", or the final status of a run that had
+	// already finished.
+	Status          string `json:"status"`
+	AlreadyFinished bool   `json:"already_finished,omitempty"`
+}
+
+// handleCancelPipeline cancels a run. It answers 202 once the replica
+// running the pipeline has acknowledged; the run records its final state
+// shortly after. A run that already finished is answered with 200 and its
+// final status, so retried cancels are harmless.
+func (s *Server) handleCancelPipeline(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	err := s.engine.Cancel(r.Context(), id)
+	var finished *engine.RunFinishedError
+	switch {
+	case errors.As(err, &finished):
+		s.writeJSON(w, http.StatusOK, cancelPipelineResponse{ID: id, Status: string(finished.Status), AlreadyFinished: true})
+	case errors.Is(err, cancellation.ErrNotAcknowledged):
+		s.writeError(w, http.StatusGatewayTimeout, err.Error())
+	case err != nil:
+		s.writeFailure(w, r, err, "failed to cancel pipeline")
+	default:
+		s.writeJSON(w, http.StatusAccepted, cancelPipelineResponse{ID: id, Status: "cancelling"})
+	}
+}
+
+const (
+	// defaultPageSize is the page size of run listings without a limit.
+	defaultPageSize = 50
+	// maxPageSize caps the page size of run listings.
+	maxPageSize = 500
+)
+
+type listPipelinesResponse struct {
+	Runs []*pipeline.Run `json:"runs"`
+	// Total counts the runs matching the filters, across all pages.
+	Total int `json:"total"`
+}
+
+// handleListPipelines lists runs, newest first. The labels query parameter
+// takes a label selector ("team=payments,env=prod"); repo, branch, status
+// (a comma-separated list) and the RFC 3339 created_after and
+// created_before narrow the history further. offset skips that many
+// matching runs and limit sets the page size; see listPage.
+func (s *Server) handleListPipelines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts, err := listOptions(q.Get("labels"), q.Get("limit"))
+	if err == nil {
+		err = historyFilters(&opts, q.Get("created_after"), q.Get("created_before"))
+	}
+	var offset int
+	if err == nil {
+		offset, err = listOffset(q.Get("offset"))
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts.Repo, opts.Branch = q.Get("repo"), q.Get("branch")
+	if v := q.Get("status"); v != "" {
+		for _, st := range strings.Split(v, ",") {
+			opts.Statuses = append(opts.Statuses, pipeline.Status(strings.TrimSpace(st)))
+		}
+	}
+
+	runs, total, err := s.listPage(r.Context(), opts, offset)
+	if err != nil {
+		s.writeFailure(w, r, err, "failed to list pipelines")
+		return
+	}
+	if runs == nil {
+		runs = []*pipeline.Run{}
+	}
+	s.writeJSON(w, http.StatusOK, listPipelinesResponse{Runs: runs, Total: total})
+}
+
+// listPage returns the page of the runs matching opts that starts offset
+// runs in, newest first and at most opts.Limit long, along with how many
+// runs match in all. A zero limit pages by defaultPageSize and none goes
+// past maxPageSize, so no listing reads the whole history.
+func (s *Server) listPage(ctx context.Context, opts store.ListOptions, offset int) ([]*pipeline.Run, int, error) {
+	switch {
+	case opts.Limit <= 0:
+		opts.Limit = defaultPageSize
+	case opts.Limit > maxPageSize:
+		opts.Limit = maxPageSize
+	}
+	opts.Offset = offset
+	runs, err := s.engine.List(ctx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	total, err := s.engine.Count(ctx, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+// writeUnavailable tells the client a shed read is worth retrying.
+func (s *Server) writeUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	retry := store.DefaultReadOpenDuration
+	if cfg := s.requestConfig(r.Context()); cfg != nil && cfg.Database.ReadBreaker.OpenDuration > 0 {
+		retry = cfg.Database.ReadBreaker.OpenDuration
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(retry.Seconds())))
+	s.writeError(w, http.StatusServiceUnavailable, err.Error())
+}
+
+func listOptions(selector, limit string) (store.ListOptions, error) {
+	var opts store.ListOptions
+	if selector != "" {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return opts, fmt.Errorf("invalid label selector: %w", err)
+		}
+		opts.Selector = sel
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid limit %q", limit)
+		}
+		opts.Limit = n
+	}
+	return opts, nil
+}
+
+// historyFilters sets the creation time range of opts from RFC 3339 query
+// values; an empty value leaves its end of the range open.
+func historyFilters(opts *store.ListOptions, after, before string) error {
+	for _, f := range []struct {
+		name, value string
+		to          *time.Time
+	}{
+		{"created_after", after, &opts.CreatedAfter},
+		{"created_before", before, &opts.CreatedBefore},
+	} {
+		if f.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, f.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: want an RFC 3339 time", f.name, f.value)
+		}
+		*f.to = t
+	}
+	return nil
+}
+
+func listOffset(offset string) (int, error) {
+	if offset == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(offset)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid offset %q", offset)
+	}
+	return n, nil
+}
+
+// SubmitPipeline implements the gRPC method of the same name.
+func (g *grpcService) SubmitPipeline(ctx context.Context, req *pipelinev1.SubmitPipelineRequest) (*pipelinev1.SubmitPipelineResponse, error) {
+	run, err := g.s.engine.Submit(ctx, engine.SubmitRequest{Spec: []byte(req.GetSpec()), Params: req.GetParams(), TriggeredBy: req.GetTriggeredBy()})
+	g.s.sendBackpressureHeader(ctx)
+	if err != nil {
+		return nil, g.submitError(ctx, err)
+	}
+	return &pipelinev1.SubmitPipelineResponse{Run: runToProto(run)}, nil
+}
+
+// submitError returns the gRPC status of a refused or failed submission.
+func (g *grpcService) submitError(ctx context.Context, err error) error {
+	var verr *engine.ValidationError
+	var perr *engine.PolicyError
+	var soon *engine.TooSoonError
+	var paused *engine.TenantPausedError
+	var dup *engine.DuplicateRunError
+	switch {
+	case errors.As(err, &verr):
+		return status.Error(codes.InvalidArgument, verr.Error())
+	case errors.As(err, &dup):
+		return status.Error(codes.AlreadyExists, dup.Error())
+	case errors.As(err, &soon):
+		return status.Error(codes.ResourceExhausted, soon.Error())
+	case errors.As(err, &paused):
+		return status.Error(codes.Unavailable, paused.Error())
+	case errors.Is(err, engine.ErrDraining):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.As(err, &perr):
+		return status.Error(codes.PermissionDenied, perr.Error())
+	case errors.Is(err, engine.ErrPolicyUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, pipeline.ErrInsufficientCapacity):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return g.s.statusError(ctx, err, "failed to submit pipeline")
+	}
+}
+
+// GetPipeline implements the gRPC method of the same name.
+func (g *grpcService) GetPipeline(ctx context.Context, req *pipelinev1.GetPipelineRequest) (*pipelinev1.GetPipelineResponse, error) {
+	run, err := g.s.engine.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, g.s.statusError(ctx, err, "failed to get pipeline")
+	}
+	return &pipelinev1.GetPipelineResponse{Run: runToProto(run)}, nil
+}
+
+// ListPipelines implements the gRPC method of the same name.
+func (g *grpcService) ListPipelines(ctx context.Context, req *pipelinev1.ListPipelinesRequest) (*pipelinev1.ListPipelinesResponse, error) {
+	opts, err := listOptions(req.GetLabelSelector(), "")
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	if req.GetOffset() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "offset must not be negative")
+	}
+	opts.Limit = int(req.GetLimit())
+	opts.Repo, opts.Branch = req.GetRepo(), req.GetBranch()
+	for _, st := range req.GetStatuses() {
+		opts.Statuses = append(opts.Statuses, pipeline.Status(st))
+	}
+	if req.GetCreatedAfter() != nil {
+		opts.CreatedAfter = req.GetCreatedAfter().AsTime()
+	}
+	if req.GetCreatedBefore() != nil {
+		opts.CreatedBefore = req.GetCreatedBefore().AsTime()
+	}
+
+	runs, total, err := g.s.listPage(ctx, opts, int(req.GetOffset()))
+	if err != nil {
+		return nil, g.s.statusError(ctx, err, "failed to list pipelines")
+	}
+	resp := &pipelinev1.ListPipelinesResponse{Total: int32(total)}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, runToProto(run))
+	}
+	return resp, nil
+}
+
+// CancelPipeline implements the gRPC method of the same name.
+func (g *grpcService) CancelPipeline(ctx context.Context, req *pipelinev1.CancelPipelineRequest) (*pipelinev1.CancelPipelineResponse, error) {
+	err := g.s.engine.Cancel(ctx, req.GetId())
+	var finished *engine.RunFinishedError
+	switch {
+	case errors.As(err, &finished):
+		return &pipelinev1.CancelPipelineResponse{Status: string(finished.Status), AlreadyFinished: true}, nil
+	case errors.Is(err, cancellation.ErrNotAcknowledged):
+		return nil, status.Error(codes.DeadlineExceeded, err.Error())
+	case err != nil:
+		return nil, g.s.statusError(ctx, err, "failed to cancel pipeline")
+	}
+	return &pipelinev1.CancelPipelineResponse{Status: "cancelling"}, nil
+}
+
+func runToProto(run *pipeline.Run) *pipelinev1.Run {
+	out := &pipelinev1.Run{
+		Id:          run.ID,
+		Name:        run.Spec.Name,
+		Status:      string(run.Status),
+		Reason:      run.Reason,
+		Params:      run.Spec.Params,
+		Labels:      run.Spec.Labels,
+		Annotations: run.Spec.Annotations,
+		Warnings:    run.Warnings,
+		Replica:     run.Replica,
+		TriggeredBy: run.TriggeredBy,
+		RerunOf:     run.RerunOf,
+		CreatedAt:   timestamppb.New(run.CreatedAt),
+		StartedAt:   timestampOrNil(run.StartedAt),
+		FinishedAt:  timestampOrNil(run.FinishedAt),
+	}
+	out.Stages = stagesToProto(run.Stages)
+	out.Finally = stagesToProto(run.Finally)
+	if run.PostRun != nil {
+		out.PostRun = stagesToProto([]pipeline.StageResult{*run.PostRun})[0]
+	}
+	return out
+}
+
+func stagesToProto(stages []pipeline.StageResult) []*pipelinev1.StageResult {
+	var out []*pipelinev1.StageResult
+	for _, st := range stages {
+		ps := &pipelinev1.StageResult{Name: st.Name, Status: string(st.Status)}
+		for _, j := range st.Jobs {
+			ps.Jobs = append(ps.Jobs, &pipelinev1.JobResult{
+				Id:         j.ID,
+				Name:       j.Name,
+				Matrix:     j.Matrix,
+				Status:     string(j.Status),
+				Message:    j.Message,
+				StartedAt:  timestampOrNil(j.StartedAt),
+				FinishedAt: timestampOrNil(j.FinishedAt),
+				Results:    testResultsToProto(j.Results),
+				Retries:    int32(j.Retries),
+				ErrorClass: j.ErrorClass,
+			})
+		}
+		out = append(out, ps)
+	}
+	return out
+}
+
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func testResultsToProto(r *pipeline.Results) *pipelinev1.TestResults {
+	if r == nil {
+		return nil
+	}
+	return &pipelinev1.TestResults{
+		Parser:      r.Parser,
+		Tests:       int32(r.Tests),
+		Passed:      int32(r.Passed),
+		Failed:      int32(r.Failed),
+		Skipped:     int32(r.Skipped),
+		Coverage:    r.Coverage,
+		FailedTests: r.FailedTests,
+	}
+}
@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestCancelFinishedPipelineIsIdempotent(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+	if err := runs.SaveRun(context.Background(), &pipeline.Run{ID: "run-9", Status: pipeline.StatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pipelines/run-9/cancel", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"Succeeded","already_finished":true`) {
+		t.Errorf("HTTP cancel of a finished run: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	resp, err := (&grpcService{s: s}).CancelPipeline(context.Background(), &pipelinev1.CancelPipelineRequest{Id: "run-9"})
+	if err != nil || !resp.GetAlreadyFinished() || resp.GetStatus() != string(pipeline.StatusSucceeded) {
+		t.Errorf("gRPC cancel of a finished run = %v, %v", resp, err)
+	}
+}
+
+func TestSubmitWhileDrainingIsUnavailable(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+	s.engine.Drain(context.Background())
+
+	spec := `{"spec": "name: deploy\nstages:\n- name: apply\n  image: ghcr.io/org/deploy:1.0\n"}`
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(spec)))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "shutting down") {
+		t.Errorf("submit while draining: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"status":"draining"`) {
+		t.Errorf("readyz while draining: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSubmitRecordsCallersTraceParent(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	spec := `{"spec": "name: deploy\nstages:\n- name: apply\n  image: ghcr.io/org/deploy:1.0\n"}`
+	req := httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(spec))
+	req.Header.Set("traceparent", tp)
+	rec := httptest.NewRecorder()
+	withTraceContext(s.router).ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"trace_parent":"`+tp+`"`) {
+		t.Errorf("submit with traceparent: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
+
+func TestSubmitRecordsRequestID(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	spec := `{"spec": "name: deploy\nstages:\n- name: apply\n  image: ghcr.io/org/deploy:1.0\n"}`
+	req := httptest.NewRequest(http.MethodPost, "/pipelines", strings.NewReader(spec))
+	req.Header.Set("X-Request-Id", "req-7")
+	rec := httptest.NewRecorder()
+	withRequestID(s.router).ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || !strings.Contains(rec.Body.String(), `"request_id":"req-7"`) {
+		t.Errorf("submit with request ID: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "req-7" {
+		t.Errorf("response request ID = %q, want req-7", got)
+	}
+}
+
+func TestListPipelinesFiltersAndPages(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	for i, st := range []pipeline.Status{pipeline.StatusFailed, pipeline.StatusSucceeded, pipeline.StatusFailed, pipeline.StatusFailed, pipeline.StatusFailed} {
+		run := &pipeline.Run{
+			ID:        fmt.Sprintf("run-%d", i),
+			Spec:      pipeline.Spec{Name: "build", Repo: "org/api", Branch: "main"},
+			Status:    st,
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+		}
+		if err := runs.SaveRun(context.Background(), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines?repo=org/api&status=Failed&created_before=2026-01-02T06:30:00Z&offset=1&limit=1", nil))
+	var resp listPipelinesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	// Failed runs created before 06:30 are run-3, run-2 and run-0.
+	if resp.Total != 3 || len(resp.Runs) != 1 || resp.Runs[0].ID != "run-2" {
+		t.Errorf("list = %d runs starting %v, want run-2 of 3", resp.Total, resp.Runs)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines?created_after=yesterday", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("list with a bad time: status = %d, want 400", rec.Code)
+	}
+
+	g := &grpcService{s: s}
+	got, err := g.ListPipelines(context.Background(), &pipelinev1.ListPipelinesRequest{
+		Branch:       "main",
+		Statuses:     []string{"Failed"},
+		CreatedAfter: timestamppb.New(start),
+		Offset:       2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetTotal() != 3 || len(got.GetRuns()) != 1 || got.GetRuns()[0].GetId() != "run-2" {
+		t.Errorf("gRPC list = %v", got)
+	}
+	if _, err := g.ListPipelines(context.Background(), &pipelinev1.ListPipelinesRequest{Offset: -1}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("gRPC list with a negative offset: error = %v", err)
+	}
+}
+
+func TestListPipelinesBoundsPageSize(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+	start := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	for i := 0; i < maxPageSize+10; i++ {
+		run := &pipeline.Run{ID: fmt.Sprintf("run-%d", i), Status: pipeline.StatusSucceeded, CreatedAt: start.Add(time.Duration(i) * time.Second)}
+		if err := runs.SaveRun(context.Background(), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  int
+	}{
+		{"", defaultPageSize},
+		{"?limit=0", defaultPageSize},
+		{"?limit=20", 20},
+		{"?limit=100000", maxPageSize},
+	} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines"+tc.query, nil))
+		var resp listPipelinesResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+			t.Fatalf("list%s: status = %d, body = %s", tc.query, rec.Code, rec.Body)
+		}
+		if len(resp.Runs) != tc.want || resp.Total != maxPageSize+10 {
+			t.Errorf("list%s = %d runs of %d, want %d of %d", tc.query, len(resp.Runs), resp.Total, tc.want, maxPageSize+10)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines?limit=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("list with a negative limit: status = %d, want 400", rec.Code)
+	}
+}
+
+func TestUnknownPipelineIsNotFound(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("HTTP get: status = %d, want 404", rec.Code)
+	}
+	g := &grpcService{s: s}
+	if _, err := g.GetPipeline(context.Background(), &pipelinev1.GetPipelineRequest{Id: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("gRPC get: error = %v, want NotFound", err)
+	}
+	if _, err := g.CancelPipeline(context.Background(), &pipelinev1.CancelPipelineRequest{Id: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("gRPC cancel: error = %v, want NotFound", err)
+	}
+}
+
+func TestErrorStatusInterceptorMapsKinds(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("failed to read run: %w", store.ErrNotFound), codes.NotFound},
+		{engine.ErrRunNotFinished, codes.FailedPrecondition},
+		{status.Error(codes.ResourceExhausted, "slow down"), codes.ResourceExhausted},
+		{fmt.Errorf("boom"), codes.Internal},
+	} {
+		_, err := unaryErrorStatus(context.Background(), nil, nil, func(context.Context, interface{}) (interface{}, error) {
+			return nil, tc.err
+		})
+		if status.Code(err) != tc.want {
+			t.Errorf("%v answered with %s, want %s", tc.err, status.Code(err), tc.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/plan"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+// planPollInterval is how often a followed plan is re-read from the store.
+// Reading the store rather than the local executor lets any replica serve
+// the stream of a run executing on another.
+var planPollInterval = time.Second
+
+// planEvent is a line of the plan stream: the whole plan first, then one
+// line per update.
+type planEvent struct {
+	Type   string       `json:"type"`
+	Plan   *plan.Plan   `json:"plan,omitempty"`
+	Update *plan.Update `json:"update,omitempty"`
+}
+
+// handlePlan returns a run's execution plan as newline-delimited JSON.
+// ?follow=true keeps the response open and streams an update line for every
+// status change of the run, a stage or a job until the run finishes. Every
+// request starts with the current plan, so a client that reconnects resumes
+// from a fresh snapshot.
+func (s *Server) handlePlan(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	follow := false
+	if v := r.URL.Query().Get("follow"); v != "" {
+		var err error
+		if follow, err = strconv.ParseBool(v); err != nil {
+			s.writeError(w, http.StatusBadRequest, "follow must be a boolean")
+			return
+		}
+	}
+
+	run, err := s.engine.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "pipeline not found")
+		return
+	case errors.Is(err, store.ErrUnavailable):
+		s.writeUnavailable(w, r, err)
+		return
+	case err != nil:
+		s.log(r.Context()).WithError(err).Error("Failed to get pipeline")
+		s.writeError(w, http.StatusInternalServerError, "failed to get pipeline")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	stream := newLogStream(w)
+	defer stream.close()
+	current := plan.Build(run)
+	if err := stream.encode(planEvent{Type: "plan", Plan: current}); err != nil {
+		s.logStreamFailed(r.Context(), id, err)
+		return
+	}
+	if !follow {
+		return
+	}
+
+	ticker := time.NewTicker(planPollInterval)
+	defer ticker.Stop()
+	for !current.Status.Terminal() {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		run, err := s.engine.Get(r.Context(), id)
+		if errors.Is(err, store.ErrUnavailable) {
+			// Keep the stream open; the next poll may succeed.
+			continue
+		}
+		if err != nil {
+			s.log(r.Context()).WithError(err).WithField("pipeline_id", id).Warn("Closing plan stream after failed read")
+			return
+		}
+		next := plan.Build(run)
+		updates := plan.Diff(current, next)
+		current = next
+		if len(updates) == 0 {
+			continue
+		}
+		events := make([]interface{}, len(updates))
+		for i := range updates {
+			events[i] = planEvent{Type: "update", Update: &updates[i]}
+		}
+		if err := stream.encode(events...); err != nil {
+			s.logStreamFailed(r.Context(), id, err)
+			return
+		}
+	}
+}
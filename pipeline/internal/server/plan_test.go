@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestPlanFollowStreamsUpdatesUntilTerminal(t *testing.T) {
+	defer func(d time.Duration) { planPollInterval = d }(planPollInterval)
+	planPollInterval = 5 * time.Millisecond
+
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	ctx := context.Background()
+	run := &pipeline.Run{ID: "run-1", Status: pipeline.StatusRunning, Spec: pipeline.Spec{
+		Name:   "p",
+		Stages: []pipeline.Stage{{Name: "build"}},
+	}}
+	if err := runs.SaveRun(ctx, run); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/pipelines/run-1/plan?follow=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	lines := bufio.NewScanner(resp.Body)
+
+	var first planEvent
+	if !lines.Scan() || json.Unmarshal(lines.Bytes(), &first) != nil || first.Type != "plan" || first.Plan.Stages[0].Status != pipeline.StatusPending {
+		t.Fatalf("first line = %s, want the pending plan", lines.Bytes())
+	}
+
+	run.Status = pipeline.StatusSucceeded
+	run.Stages = []pipeline.StageResult{{Name: "build", Status: pipeline.StatusSucceeded, Jobs: []pipeline.JobResult{{ID: "build", Status: pipeline.StatusSucceeded}}}}
+	if err := runs.SaveRun(ctx, run); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []string
+	for lines.Scan() {
+		var ev planEvent
+		if err := json.Unmarshal(lines.Bytes(), &ev); err != nil || ev.Type != "update" {
+			t.Fatalf("line = %s, want an update", lines.Bytes())
+		}
+		updates = append(updates, ev.Update.Stage+"/"+ev.Update.Job+"="+string(ev.Update.Status))
+	}
+	want := []string{"build/build=Succeeded", "build/=Succeeded", "/=Succeeded"}
+	if len(updates) != len(want) {
+		t.Fatalf("updates = %v, want %v", updates, want)
+	}
+	for i := range want {
+		if updates[i] != want[i] {
+			t.Fatalf("updates = %v, want %v", updates, want)
+		}
+	}
+}
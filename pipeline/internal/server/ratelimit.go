@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	// clientIdle is how long a client may send nothing before its bucket is
+	// forgotten. A forgotten client starts again with a full burst.
+	clientIdle = 10 * time.Minute
+	// clientSweep is how often idle buckets are looked for.
+	clientSweep = time.Minute
+)
+
+// rateLimitExempt are the HTTP paths never rate limited, so probes keep
+// working however busy a client is. The metrics endpoint has a listener of
+// its own and is never limited either.
+var rateLimitExempt = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	"/backpressure": true,
+}
+
+// clientLimits keeps a token bucket per client under server.rate_limit_rps
+// and server.rate_limit_burst. Its zero value is ready to use; buckets are
+// started afresh when a reload changes the limits.
+type clientLimits struct {
+	mu      sync.Mutex
+	rps     float64
+	burst   int
+	clients map[string]*clientBucket
+	swept   time.Time
+}
+
+type clientBucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// reserve takes a token of client's bucket under the limits of cfg. It
+// returns zero when the request may go ahead, or else how long the client
+// should wait before retrying.
+func (l *clientLimits) reserve(cfg config.ServerConfig, client string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.clients == nil || l.rps != cfg.RateLimitRPS || l.burst != cfg.RateLimitBurst {
+		l.rps, l.burst = cfg.RateLimitRPS, cfg.RateLimitBurst
+		l.clients = make(map[string]*clientBucket)
+	}
+	if now.Sub(l.swept) > clientSweep {
+		for c, b := range l.clients {
+			if now.Sub(b.seen) > clientIdle {
+				delete(l.clients, c)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.clients[client]
+	if !ok {
+		b = &clientBucket{limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst)}
+		l.clients[client] = b
+	}
+	b.seen = now
+	r := b.limiter.ReserveN(now, 1)
+	if !r.OK() {
+		return time.Second
+	}
+	if d := r.DelayFrom(now); d > 0 {
+		// Refused requests do not spend the tokens of later ones.
+		r.CancelAt(now)
+		return d
+	}
+	return 0
+}
+
+// limited reports how long the client of a request must wait before
+// retrying, or zero when server.rate_limit_enabled is off or the client is
+// within its limits.
+func (s *Server) limited(ctx context.Context, client string) time.Duration {
+	cfg := s.requestConfig(ctx).Server
+	if !cfg.RateLimitEnabled {
+		return 0
+	}
+	return s.limits.reserve(cfg, client, time.Now())
+}
+
+// retryAfterSeconds rounds a wait up to the whole seconds of a Retry-After
+// header, at least one.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds()))))
+}
+
+// withRateLimit answers 429 with a Retry-After header to the requests of
+// clients, by IP, over their rate limit.
+func (s *Server) withRateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimitExempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if wait := s.limited(r.Context(), client); wait > 0 {
+			metrics.APIRateLimited.WithLabelValues("http").Inc()
+			w.Header().Set("Retry-After", retryAfterSeconds(wait))
+			s.writeError(w, http.StatusTooManyRequests, "rate limit exceeded, retry later")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// peerHost returns the host of the peer of a gRPC call.
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// rateLimitStatus is the status of a refused gRPC call, whose retry-after
+// header says when to retry.
+func rateLimitStatus(wait time.Duration, setHeader func(metadata.MD) error) error {
+	metrics.APIRateLimited.WithLabelValues("grpc").Inc()
+	_ = setHeader(metadata.Pairs("retry-after", retryAfterSeconds(wait)))
+	return status.Error(codes.ResourceExhausted, "rate limit exceeded, retry later")
+}
+
+// unaryRateLimit is withRateLimit for unary gRPC calls, by peer address.
+func (s *Server) unaryRateLimit(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if wait := s.limited(ctx, peerHost(ctx)); wait > 0 {
+		return nil, rateLimitStatus(wait, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+	}
+	return handler(ctx, req)
+}
+
+// streamRateLimit is withRateLimit for streaming gRPC calls, by peer
+// address. A stream takes a single token however long it lasts.
+func (s *Server) streamRateLimit(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if wait := s.limited(ss.Context(), peerHost(ss.Context())); wait > 0 {
+		return rateLimitStatus(wait, ss.SetHeader)
+	}
+	return handler(srv, ss)
+}
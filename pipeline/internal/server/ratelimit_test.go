@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+func TestRateLimitPerClientIP(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Server = config.ServerConfig{RateLimitEnabled: true, RateLimitRPS: 0.001, RateLimitBurst: 2}
+	h := s.withRateLimit(s.router)
+	get := func(path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get("/pipelines/run-1/artifacts", "10.0.0.1:4000"); rec.Code == http.StatusTooManyRequests {
+			t.Fatalf("request %d within the burst refused", i)
+		}
+	}
+	rec := get("/pipelines/run-1/artifacts", "10.0.0.1:4001")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("request over the limit: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get("/pipelines/run-1/artifacts", "10.0.0.2:4000"); rec.Code == http.StatusTooManyRequests {
+		t.Error("another client was limited")
+	}
+	if rec := get("/healthz", "10.0.0.1:4000"); rec.Code == http.StatusTooManyRequests {
+		t.Error("/healthz was limited")
+	}
+
+	s.cfg.Server.RateLimitEnabled = false
+	if rec := get("/pipelines/run-1/artifacts", "10.0.0.1:4000"); rec.Code == http.StatusTooManyRequests {
+		t.Error("limited with server.rate_limit_enabled off")
+	}
+}
+
+func TestUnaryRateLimitPerPeer(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Server = config.ServerConfig{RateLimitEnabled: true, RateLimitRPS: 0.001, RateLimitBurst: 1}
+	call := func(ip string) error {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 5000}})
+		_, err := s.unaryRateLimit(ctx, nil, nil, func(context.Context, interface{}) (interface{}, error) { return nil, nil })
+		return err
+	}
+
+	if err := call("10.0.0.1"); err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	if err := call("10.0.0.1"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("call over the limit: error = %v, want ResourceExhausted", err)
+	}
+	if err := call("10.0.0.2"); err != nil {
+		t.Errorf("another peer: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/database"
+	"github.com/devmind-pipeline/pipeline/internal/tekton"
+)
+
+// DefaultReadinessInterval is used when server.readiness.interval is not
+// set.
+const DefaultReadinessInterval = 5 * time.Second
+
+// readiness tracks which required dependencies have been reached. A
+// dependency that answered once stays ready: readiness gates the first
+// traffic to a replica, and later outages are handled by each client's own
+// degraded mode rather than by pulling the replica out of rotation.
+type readiness struct {
+	probes   []backendProbe
+	interval time.Duration
+	logger   *logrus.Logger
+
+	mu    sync.Mutex
+	ready map[string]bool
+	// errs holds the last failure of each dependency not ready yet.
+	errs map[string]string
+}
+
+// newReadiness returns the readiness of the dependencies cfg requires: those
+// of server.readiness.required, or by default those the enabled features
+// depend on. The Tekton and database probes reuse runner and db rather than
+// connecting anew per check.
+func newReadiness(cfg *config.Config, runner *tekton.Client, db *database.DB, logger *logrus.Logger) (*readiness, error) {
+	all := backendProbes(cfg, logger)
+	byName := make(map[string]backendProbe, len(all))
+	for _, p := range all {
+		byName[p.name] = p
+	}
+	if runner != nil {
+		p := byName["tekton"]
+		p.check = runner.CheckCRDs
+		byName["tekton"] = p
+	}
+	if db != nil {
+		p := byName["database"]
+		p.check = db.PingContext
+		byName["database"] = p
+	}
+
+	r := &readiness{
+		interval: cfg.Server.Readiness.Interval,
+		logger:   logger,
+		ready:    make(map[string]bool),
+		errs:     make(map[string]string),
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultReadinessInterval
+	}
+	required := cfg.Server.Readiness.Required
+	if len(required) == 0 {
+		for _, p := range all {
+			if p.required {
+				required = append(required, p.name)
+			}
+		}
+	}
+	for _, name := range required {
+		p, ok := byName[name]
+		if !ok {
+			names := make([]string, 0, len(all))
+			for _, p := range all {
+				names = append(names, p.name)
+			}
+			return nil, fmt.Errorf("server.readiness.required: unknown dependency %q (%s)", name, strings.Join(names, ", "))
+		}
+		if r.ready[name] || r.errs[name] != "" {
+			continue
+		}
+		// A dependency that is not configured can never be reached, so
+		// listing it keeps the replica unready and says why.
+		if msg := p.skipped; msg != "" {
+			p.check = func(context.Context) error { return fmt.Errorf("%s", msg) }
+			p.skipped = ""
+		}
+		r.probes = append(r.probes, p)
+		r.errs[name] = "not checked yet"
+	}
+	return r, nil
+}
+
+// check probes every dependency not ready yet and reports whether all are.
+func (r *readiness) check(ctx context.Context) bool {
+	var pending []backendProbe
+	for _, p := range r.probes {
+		if !r.isReady(p.name) {
+			pending = append(pending, p)
+		}
+	}
+	if len(pending) == 0 {
+		return true
+	}
+
+	all := true
+	for _, c := range runProbes(ctx, pending) {
+		r.mu.Lock()
+		if c.Err == nil {
+			r.ready[c.Name] = true
+			delete(r.errs, c.Name)
+		} else {
+			r.errs[c.Name] = c.Err.Error()
+			all = false
+		}
+		r.mu.Unlock()
+		if c.Err == nil {
+			r.logger.WithFields(logrus.Fields{"dependency": c.Name, "latency": c.Latency}).Info("Dependency reached")
+		} else {
+			r.logger.WithError(c.Err).WithField("dependency", c.Name).Warn("Dependency not reachable yet, not ready for traffic")
+		}
+	}
+	if all {
+		r.logger.Info("Every required dependency reached, ready for traffic")
+	}
+	return all
+}
+
+func (r *readiness) isReady(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ready[name]
+}
+
+// run checks the dependencies every interval until all are ready or ctx is
+// done.
+func (r *readiness) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for !r.check(ctx) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type dependencyStatus struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	// Error is the last failure of a dependency not reached yet.
+	Error string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	// Status is "ready", "not_ready" or "draining".
+	Status       string             `json:"status"`
+	Dependencies []dependencyStatus `json:"dependencies"`
+	// NotReady names the dependencies not reached yet.
+	NotReady []string `json:"not_ready,omitempty"`
+}
+
+func (r *readiness) status() readinessResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp := readinessResponse{Status: "ready", Dependencies: []dependencyStatus{}}
+	for _, p := range r.probes {
+		d := dependencyStatus{Name: p.name, Ready: r.ready[p.name], Error: r.errs[p.name]}
+		if !d.Ready {
+			resp.NotReady = append(resp.NotReady, p.name)
+		}
+		resp.Dependencies = append(resp.Dependencies, d)
+	}
+	sort.Strings(resp.NotReady)
+	if len(resp.NotReady) > 0 {
+		resp.Status = "not_ready"
+	}
+	return resp
+}
+
+// handleHealthz reports liveness: the process is up and serving HTTP,
+// whatever the state of its dependencies.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports readiness: 200 once every dependency listed in
+// server.readiness.required has been reached, 503 naming the others until
+// then, and 503 again once shutdown has started draining pipelines.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := readinessResponse{Status: "ready", Dependencies: []dependencyStatus{}}
+	if s.readiness != nil {
+		resp = s.readiness.status()
+	}
+	status := http.StatusOK
+	if len(resp.NotReady) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	if s.engine != nil && s.engine.Draining() {
+		resp.Status = "draining"
+		status = http.StatusServiceUnavailable
+	}
+	s.writeJSON(w, status, resp)
+}
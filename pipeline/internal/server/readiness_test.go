@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestReadyzWaitsForRequiredDependencies(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var err error
+
+	s := newArtifactTestServer(t)
+	s.cfg.Database.Type = "sqlite"
+	s.cfg.Database.Path = ":memory:"
+	s.cfg.Redis.Host = mr.Host()
+	s.cfg.Redis.Port, _ = strconv.Atoi(mr.Port())
+	s.cfg.Server.Readiness.Required = []string{"database", "redis", "argocd"}
+	if s.readiness, err = newReadiness(s.cfg, nil, nil, s.logger); err != nil {
+		t.Fatal(err)
+	}
+
+	readyz := func() (int, readinessResponse) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp readinessResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, resp
+	}
+
+	if code, resp := readyz(); code != http.StatusServiceUnavailable || len(resp.NotReady) != 3 {
+		t.Fatalf("before any check: %d %+v, want 503 with every dependency pending", code, resp)
+	}
+
+	// ArgoCD is listed but not configured, so it can never be reached.
+	if s.readiness.check(context.Background()) {
+		t.Fatal("check() = true with argocd unconfigured")
+	}
+	code, resp := readyz()
+	if code != http.StatusServiceUnavailable || len(resp.NotReady) != 1 || resp.NotReady[0] != "argocd" {
+		t.Fatalf("after check: %d %+v, want 503 naming argocd only", code, resp)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz status = %d, want 200 while not ready", rec.Code)
+	}
+
+	// Readiness is sticky: a dependency lost after it was reached once
+	// does not take the replica out of rotation.
+	s.cfg.Server.Readiness.Required = []string{"database", "redis"}
+	if s.readiness, err = newReadiness(s.cfg, nil, nil, s.logger); err != nil {
+		t.Fatal(err)
+	}
+	if !s.readiness.check(context.Background()) {
+		t.Fatalf("check() = false, status %+v", s.readiness.status())
+	}
+	mr.Close()
+	if code, resp := readyz(); code != http.StatusOK || resp.Status != "ready" {
+		t.Errorf("after every dependency was reached: %d %+v, want 200", code, resp)
+	}
+}
+
+func TestDefaultReadinessFollowsEnabledFeatures(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Redis.CancelBroadcast = true
+	r, err := newReadiness(s.cfg, nil, nil, s.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range r.probes {
+		names = append(names, p.name)
+	}
+	// Runs are kept in the database, so it is always waited for.
+	if len(names) != 3 || names[0] != "tekton" || names[1] != "database" || names[2] != "redis" {
+		t.Errorf("required dependencies = %v, want tekton, database and redis", names)
+	}
+}
+
+func TestUnknownReadinessDependencyIsRejected(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Server.Readiness.Required = []string{"postgres"}
+	if _, err := newReadiness(s.cfg, nil, nil, s.logger); err == nil {
+		t.Fatal("newReadiness() accepted an unknown dependency")
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+// DefaultReloadGrace is used when server.reload_grace is not configured.
+const DefaultReloadGrace = 10 * time.Second
+
+// snapshot is one generation of the configuration. A request pins the
+// snapshot current at its entry and reads only from it, so a reload that
+// lands mid-request never splits the request across two configurations.
+type snapshot struct {
+	cfg      *config.Config
+	inflight atomic.Int64
+}
+
+type snapshotKey struct{}
+
+// pin returns the current snapshot with its in-flight count taken. The
+// count is re-checked against the current snapshot so a reload waiting on
+// the old generation can never miss a request that pinned it.
+func (s *Server) pin() *snapshot {
+	for {
+		snap := s.snapshot.Load()
+		snap.inflight.Add(1)
+		if s.snapshot.Load() == snap {
+			return snap
+		}
+		snap.inflight.Add(-1)
+	}
+}
+
+// requestConfig returns the configuration pinned by the request of ctx, or the
+// current one outside requests.
+func (s *Server) requestConfig(ctx context.Context) *config.Config {
+	if snap, ok := ctx.Value(snapshotKey{}).(*snapshot); ok {
+		return snap.cfg
+	}
+	if snap := s.snapshot.Load(); snap != nil {
+		return snap.cfg
+	}
+	return s.cfg
+}
+
+// withSnapshot pins a configuration snapshot for the duration of each HTTP
+// request.
+func (s *Server) withSnapshot(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snap := s.pin()
+		defer snap.inflight.Add(-1)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), snapshotKey{}, snap)))
+	})
+}
+
+// unarySnapshot pins a configuration snapshot for the duration of each unary
+// gRPC call.
+func (s *Server) unarySnapshot(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	snap := s.pin()
+	defer snap.inflight.Add(-1)
+	return handler(context.WithValue(ctx, snapshotKey{}, snap), req)
+}
+
+// streamSnapshot pins a configuration snapshot for the duration of each
+// streaming gRPC call.
+func (s *Server) streamSnapshot(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	snap := s.pin()
+	defer snap.inflight.Add(-1)
+	return handler(srv, &snapshotStream{ServerStream: ss, ctx: context.WithValue(ss.Context(), snapshotKey{}, snap)})
+}
+
+type snapshotStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *snapshotStream) Context() context.Context { return s.ctx }
+
+// Reload makes cfg the configuration of every request that starts from now
+// on, then waits up to server.reload_grace of the new configuration for the
+// requests still running on the previous one to finish. It returns the
+// number of requests that outlived the grace; they keep their snapshot until
+// they end.
+//
+// An invalid cfg is rejected with an error and the current configuration
+// stays in force. Besides the settings read per request, the log level,
+// server.max_concurrent_pipelines and the AI gates take effect at once. Other
+// components built at startup from the configuration (listeners, stores and
+// clients) keep their startup settings; changes to them are logged as
+// requiring a restart.
+func (s *Server) Reload(ctx context.Context, cfg *config.Config) (int64, error) {
+	if err := cfg.Validate(); err != nil {
+		return 0, err
+	}
+	gates, err := ai.NewGates(cfg.AIService)
+	if err != nil {
+		return 0, err
+	}
+
+	prev := s.requestConfig(context.Background())
+	if keys := restartRequired(prev, cfg); len(keys) > 0 {
+		s.logger.WithField("settings", strings.Join(keys, ", ")).Warn("Configuration changes require a restart to take effect")
+	}
+	if level, err := logrus.ParseLevel(cfg.Logging.Level); err == nil && level != s.logger.GetLevel() {
+		s.logger.SetLevel(level)
+	}
+	if s.engine != nil {
+		s.engine.SetMaxConcurrentRuns(cfg.Server.MaxConcurrentPipelines)
+		s.engine.SetAIGates(gates)
+	}
+
+	old := s.snapshot.Swap(&snapshot{cfg: cfg})
+
+	grace := cfg.Server.ReloadGrace
+	if grace <= 0 {
+		grace = DefaultReloadGrace
+	}
+	deadline := time.NewTimer(grace)
+	defer deadline.Stop()
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		n := old.inflight.Load()
+		if n == 0 {
+			s.logger.Info("Configuration reloaded")
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return n, nil
+		case <-deadline.C:
+			s.logger.WithField("requests", n).Warn("Configuration reloaded; requests on the previous configuration outlived the reload grace")
+			return n, nil
+		case <-tick.C:
+		}
+	}
+}
+
+// startupSettings are read once when the server starts, so changing them
+// only takes effect after a restart.
+var startupSettings = []struct {
+	key string
+	get func(*config.Config) interface{}
+}{
+	{"server.grpc_port", func(c *config.Config) interface{} { return c.Server.GRPCPort }},
+	{"server.http_port", func(c *config.Config) interface{} { return c.Server.HTTPPort }},
+	{"server.metrics_port", func(c *config.Config) interface{} { return c.Server.MetricsPort }},
+	{"server.advertise_address", func(c *config.Config) interface{} { return c.Server.AdvertiseAddress }},
+	{"server.readiness", func(c *config.Config) interface{} { return c.Server.Readiness }},
+	{"pipeline.hard_timeout", func(c *config.Config) interface{} { return c.Pipeline.HardTimeout }},
+	{"pipeline.max_chain_depth", func(c *config.Config) interface{} { return c.Pipeline.MaxChainDepth }},
+	{"tekton", func(c *config.Config) interface{} { return c.Tekton }},
+	{"argocd", func(c *config.Config) interface{} { return c.ArgoCD }},
+	{"database", func(c *config.Config) interface{} { return c.Database }},
+	{"redis", func(c *config.Config) interface{} { return c.Redis }},
+	{"artifacts", func(c *config.Config) interface{} { return c.Artifacts }},
+	{"logs", func(c *config.Config) interface{} { return c.Logs }},
+	{"logging.redact", func(c *config.Config) interface{} { return c.Logging.Redact }},
+	{"scheduler", func(c *config.Config) interface{} { return c.Scheduler }},
+	{"auth", func(c *config.Config) interface{} { return c.Auth }},
+	// Only the gates of the AI client are reloaded.
+	{"ai_service", func(c *config.Config) interface{} {
+		svc := c.AIService
+		svc.Gates = nil
+		return svc
+	}},
+}
+
+// restartRequired returns the startup settings that differ between prev and
+// next.
+func restartRequired(prev, next *config.Config) []string {
+	var keys []string
+	for _, st := range startupSettings {
+		if !reflect.DeepEqual(st.get(prev), st.get(next)) {
+			keys = append(keys, st.key)
+		}
+	}
+	return keys
+}
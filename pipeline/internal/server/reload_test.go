@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+// reloadConfig returns a valid configuration told apart by its admin token.
+func reloadConfig(token string) *config.Config {
+	return &config.Config{
+		Server:  config.ServerConfig{GRPCPort: "8080", HTTPPort: "8081", AdminToken: token},
+		Redis:   config.RedisConfig{Port: 6379},
+		Logging: config.LoggingConfig{Level: "info"},
+	}
+}
+
+func TestReloadKeepsInFlightRequestsOnTheirSnapshot(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{logger: logger}
+	old := reloadConfig("old")
+	s.snapshot.Store(&snapshot{cfg: old})
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	seen := make(chan [2]string, 1)
+	h := s.withSnapshot(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before := s.requestConfig(r.Context()).Server.AdminToken
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-release
+		}
+		seen <- [2]string{before, s.requestConfig(r.Context()).Server.AdminToken}
+	}))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	<-entered
+
+	reloaded := make(chan int64, 1)
+	next := reloadConfig("new")
+	next.Server.ReloadGrace = 5 * time.Second
+	go func() {
+		n, err := s.Reload(context.Background(), next)
+		if err != nil {
+			t.Error(err)
+		}
+		reloaded <- n
+	}()
+
+	// Wait for the swap, then check a new request sees the new config.
+	for s.snapshot.Load().cfg != next {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-reloaded:
+		t.Fatal("Reload returned while a request was still on the previous configuration")
+	default:
+	}
+
+	close(release)
+	if got := <-seen; got != [2]string{"old", "old"} {
+		t.Fatalf("in-flight request saw %v, want the old configuration throughout", got)
+	}
+	if n := <-reloaded; n != 0 {
+		t.Fatalf("Reload() = %d requests outliving the grace, want 0", n)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if got := <-seen; got != [2]string{"new", "new"} {
+		t.Fatalf("new request saw %v, want the new configuration", got)
+	}
+}
+
+func TestReloadGraceExpires(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{logger: logger}
+	s.snapshot.Store(&snapshot{cfg: reloadConfig("")})
+
+	snap := s.pin()
+	defer snap.inflight.Add(-1)
+	next := reloadConfig("")
+	next.Server.ReloadGrace = 20 * time.Millisecond
+	if n, err := s.Reload(context.Background(), next); err != nil || n != 1 {
+		t.Fatalf("Reload() = %d, %v, want 1 request outliving the grace", n, err)
+	}
+}
+
+func TestReloadRejectsInvalidConfiguration(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{logger: logger}
+	current := reloadConfig("current")
+	s.snapshot.Store(&snapshot{cfg: current})
+
+	bad := reloadConfig("bad")
+	bad.Server.HTTPPort = "99999"
+	bad.Logging.Level = "debug"
+	if _, err := s.Reload(context.Background(), bad); err == nil {
+		t.Fatal("Reload() accepted an invalid configuration")
+	}
+	if s.requestConfig(context.Background()) != current {
+		t.Error("invalid configuration replaced the current one")
+	}
+	if logger.GetLevel() != logrus.InfoLevel {
+		t.Errorf("log level = %s, want it unchanged", logger.GetLevel())
+	}
+}
+
+func TestReloadAppliesLiveSettings(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	s := &Server{logger: logger}
+	s.engine = engine.New(engine.Options{Store: store.NewMemory(), Logger: logger, MaxConcurrentRuns: 1})
+	t.Cleanup(s.engine.Close)
+	s.snapshot.Store(&snapshot{cfg: reloadConfig("")})
+
+	next := reloadConfig("")
+	next.Logging.Level = "debug"
+	next.Server.GRPCPort = "9443"
+	next.Server.MaxConcurrentPipelines = 4
+	if _, err := s.Reload(context.Background(), next); err != nil {
+		t.Fatal(err)
+	}
+	if logger.GetLevel() != logrus.DebugLevel {
+		t.Errorf("log level = %s, want debug", logger.GetLevel())
+	}
+	warned := false
+	for _, e := range hook.AllEntries() {
+		warned = warned || (e.Level == logrus.WarnLevel && e.Data["settings"] == "server.grpc_port")
+	}
+	if !warned {
+		t.Error("no restart warning for the changed gRPC port")
+	}
+}
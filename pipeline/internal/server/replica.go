@@ -0,0 +1,58 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+// replicaResponse tells a client which replica to stream a run from.
+type replicaResponse struct {
+	PipelineID string `json:"pipeline_id"`
+	// Replica is empty while the run has not started on any replica.
+	Replica string `json:"replica,omitempty"`
+	// GRPCEndpoint and HTTPEndpoint join Replica with this replica's ports,
+	// which every replica of a deployment shares.
+	GRPCEndpoint string `json:"grpc_endpoint,omitempty"`
+	HTTPEndpoint string `json:"http_endpoint,omitempty"`
+	// Active reports that the run is still executing there.
+	Active bool `json:"active"`
+	// Local reports that the replica answering is the one named.
+	Local bool `json:"local"`
+}
+
+// handleReplica returns the replica executing a run, or that last executed
+// it, so clients of a scaled deployment can open log and progress streams
+// on it directly rather than be proxied.
+func (s *Server) handleReplica(w http.ResponseWriter, r *http.Request) {
+	run, err := s.engine.Get(r.Context(), mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "pipeline not found")
+		return
+	case errors.Is(err, store.ErrUnavailable):
+		s.writeUnavailable(w, r, err)
+		return
+	case err != nil:
+		s.log(r.Context()).WithError(err).Error("Failed to get pipeline")
+		s.writeError(w, http.StatusInternalServerError, "failed to get pipeline")
+		return
+	}
+
+	resp := replicaResponse{
+		PipelineID: run.ID,
+		Replica:    run.Replica,
+		Active:     run.Replica != "" && !run.Status.Terminal(),
+		Local:      run.Replica != "" && run.Replica == s.replica,
+	}
+	if run.Replica != "" {
+		cfg := s.requestConfig(r.Context())
+		resp.GRPCEndpoint = net.JoinHostPort(run.Replica, cfg.Server.GRPCPort)
+		resp.HTTPEndpoint = net.JoinHostPort(run.Replica, cfg.Server.HTTPPort)
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestReplicaLookup(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Server.GRPCPort = "8080"
+	s.cfg.Server.HTTPPort = "8081"
+	s.replica = "engine-0.engine"
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	ctx := context.Background()
+	for _, run := range []*pipeline.Run{
+		{ID: "remote", Status: pipeline.StatusRunning, Replica: "engine-1.engine"},
+		{ID: "local", Status: pipeline.StatusSucceeded, Replica: "engine-0.engine"},
+		{ID: "queued", Status: pipeline.StatusQueued},
+	} {
+		if err := runs.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get := func(id string) (int, replicaResponse) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/pipelines/"+id+"/replica", nil))
+		var resp replicaResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	code, resp := get("remote")
+	if code != http.StatusOK || resp.GRPCEndpoint != "engine-1.engine:8080" || resp.HTTPEndpoint != "engine-1.engine:8081" || !resp.Active || resp.Local {
+		t.Errorf("remote = %d %+v", code, resp)
+	}
+	if _, resp := get("local"); resp.Replica != "engine-0.engine" || resp.Active || !resp.Local {
+		t.Errorf("local = %+v", resp)
+	}
+	if _, resp := get("queued"); resp.Replica != "" || resp.GRPCEndpoint != "" || resp.Active {
+		t.Errorf("queued = %+v", resp)
+	}
+	if code, _ := get("missing"); code != http.StatusNotFound {
+		t.Errorf("missing = %d, want 404", code)
+	}
+}
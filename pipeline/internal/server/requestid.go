@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+// maxRequestIDLen bounds the length of a caller's request ID.
+const maxRequestIDLen = 128
+
+// requestID returns the caller's request ID when it is usable, or a new one.
+func requestID(id string) string {
+	if id == "" || len(id) > maxRequestIDLen {
+		return uuid.NewString()
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return uuid.NewString()
+		}
+	}
+	return id
+}
+
+// withRequestID gives every HTTP request a correlation ID: the caller's
+// X-Request-Id, or a new one. It is echoed on the response and attached to
+// the request context, so every log line of the request, the runs it
+// submits and the ml-service calls it makes carry it.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r.Header.Get(logging.RequestIDHeader))
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// unaryRequestID is withRequestID for unary gRPC calls, reading and echoing
+// the ID as metadata.
+func unaryRequestID(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := incomingRequestID(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(logging.RequestIDHeader, id))
+	return handler(logging.WithRequestID(ctx, id), req)
+}
+
+// streamRequestID is withRequestID for streaming gRPC calls.
+func streamRequestID(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	id := incomingRequestID(ss.Context())
+	_ = ss.SetHeader(metadata.Pairs(logging.RequestIDHeader, id))
+	return handler(srv, &requestIDStream{ServerStream: ss, ctx: logging.WithRequestID(ss.Context(), id)})
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(logging.RequestIDHeader); len(v) > 0 {
+		return requestID(v[0])
+	}
+	return requestID("")
+}
+
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *requestIDStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+type rerunPipelineResponse struct {
+	// ID is the new run's.
+	ID      string `json:"id"`
+	RerunOf string `json:"rerun_of"`
+	// ReusedStages names the stages of the original run whose results the
+	// new run reuses. It is empty for a full rerun.
+	ReusedStages    []string `json:"reused_stages,omitempty"`
+	FullRerunReason string   `json:"full_rerun_reason,omitempty"`
+}
+
+// handleRerunPipeline submits a fresh run of a finished run's definition.
+// The failed_only query parameter reuses the stages that succeeded, and
+// triggered_by names who asks for the rerun.
+func (s *Server) handleRerunPipeline(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := engine.RerunRequest{ID: mux.Vars(r)["id"], TriggeredBy: q.Get("triggered_by")}
+	if v := q.Get("failed_only"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid failed_only "+strconv.Quote(v))
+			return
+		}
+		req.FailedOnly = b
+	}
+
+	res, err := s.engine.Rerun(r.Context(), req)
+	s.setBackpressureHeader(w, r)
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrUnavailable), errors.Is(err, engine.ErrRunNotFinished):
+		s.writeFailure(w, r, err, "failed to rerun pipeline")
+	case err != nil:
+		s.writeSubmitError(w, r, err)
+	default:
+		s.writeJSON(w, http.StatusCreated, rerunPipelineResponse{
+			ID:              res.Run.ID,
+			RerunOf:         res.Run.RerunOf,
+			ReusedStages:    stageNames(res.Run.ReusedStages),
+			FullRerunReason: res.FullRerunReason,
+		})
+	}
+}
+
+func stageNames(stages []pipeline.StageResult) []string {
+	var out []string
+	for _, st := range stages {
+		out = append(out, st.Name)
+	}
+	return out
+}
+
+// RerunPipeline implements the gRPC method of the same name.
+func (g *grpcService) RerunPipeline(ctx context.Context, req *pipelinev1.RerunPipelineRequest) (*pipelinev1.RerunPipelineResponse, error) {
+	res, err := g.s.engine.Rerun(ctx, engine.RerunRequest{ID: req.GetId(), FailedOnly: req.GetFailedOnly(), TriggeredBy: req.GetTriggeredBy()})
+	g.s.sendBackpressureHeader(ctx)
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, store.ErrUnavailable), errors.Is(err, engine.ErrRunNotFinished):
+		return nil, g.s.statusError(ctx, err, "failed to rerun pipeline")
+	case err != nil:
+		return nil, g.submitError(ctx, err)
+	}
+	return &pipelinev1.RerunPipelineResponse{
+		Id:              res.Run.ID,
+		RerunOf:         res.Run.RerunOf,
+		ReusedStages:    stageNames(res.Run.ReusedStages),
+		FullRerunReason: res.FullRerunReason,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestRerunPipeline(t *testing.T) {
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+	spec := pipeline.Spec{Name: "build", Stages: []pipeline.Stage{
+		{Name: "compile", Image: "golang:1.22"},
+		{Name: "test", Image: "golang:1.22", DependsOn: []string{"compile"}},
+	}}
+	for _, run := range []*pipeline.Run{
+		{ID: "run-1", Spec: spec, Status: pipeline.StatusFailed, Stages: []pipeline.StageResult{
+			{Name: "compile", Status: pipeline.StatusSucceeded},
+			{Name: "test", Status: pipeline.StatusFailed},
+		}},
+		{ID: "run-2", Spec: spec, Status: pipeline.StatusRunning},
+	} {
+		if err := runs.SaveRun(context.Background(), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/pipelines/run-1/rerun?failed_only=true", nil))
+	var resp rerunPipelineResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("rerun: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if resp.ID == "" || resp.ID == "run-1" || resp.RerunOf != "run-1" || len(resp.ReusedStages) != 1 || resp.ReusedStages[0] != "compile" {
+		t.Errorf("rerun response = %+v", resp)
+	}
+
+	for path, want := range map[string]int{
+		"/pipelines/run-2/rerun":                http.StatusConflict,
+		"/pipelines/missing/rerun":              http.StatusNotFound,
+		"/pipelines/run-1/rerun?failed_only=no": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != want {
+			t.Errorf("POST %s: status = %d, want %d", path, rec.Code, want)
+		}
+	}
+
+	g := &grpcService{s: s}
+	got, err := g.RerunPipeline(context.Background(), &pipelinev1.RerunPipelineRequest{Id: "run-1"})
+	if err != nil || got.GetRerunOf() != "run-1" || len(got.GetReusedStages()) != 0 {
+		t.Errorf("gRPC full rerun = %v, %v", got, err)
+	}
+	if _, err := g.RerunPipeline(context.Background(), &pipelinev1.RerunPipelineRequest{Id: "run-2"}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("gRPC rerun of a running run: error = %v", err)
+	}
+}
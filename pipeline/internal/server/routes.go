@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+)
+
+func (s *Server) routes() {
+	s.router.HandleFunc("/healthz", s.handleHealthz).Methods(http.MethodGet)
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods(http.MethodGet)
+	s.router.HandleFunc("/backpressure", s.handleBackpressure).Methods(http.MethodGet)
+
+	s.router.HandleFunc("/pipelines", s.unlessMaintenance(s.handleSubmitPipeline)).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines", s.handleListPipelines).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/validate", s.handleValidateSpec).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines/batch", s.unlessMaintenance(s.handleSubmitBatch)).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines/coverage", s.handleCoverageTrend).Methods(http.MethodGet)
+	s.router.HandleFunc("/webhooks/{provider}", s.unlessMaintenance(s.handleWebhook)).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines/{id}", s.handleGetPipeline).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/{id}/cancel", s.handleCancelPipeline).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines/{id}/rerun", s.unlessMaintenance(s.handleRerunPipeline)).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines/{id}/trace", s.handleExportTrace).Methods(http.MethodPost)
+	s.router.HandleFunc("/pipelines/{id}/logs", s.handleLogs).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/{id}/junit", s.handleJUnitReport).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/{id}/plan", s.handlePlan).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/{id}/replica", s.handleReplica).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/{id}/artifacts", s.handleListArtifacts).Methods(http.MethodGet)
+	s.router.HandleFunc("/pipelines/{id}/artifacts/{name:.+}", s.handleDownloadArtifact).Methods(http.MethodGet, http.MethodHead)
+	s.router.HandleFunc("/pipelines/{id}/artifacts/{name:.+}", s.handleUploadArtifact).Methods(http.MethodPut)
+
+	s.router.HandleFunc("/admin/maintenance", s.admin(s.handleGetMaintenance)).Methods(http.MethodGet)
+	s.router.HandleFunc("/admin/maintenance", s.admin(s.handleSetMaintenance)).Methods(http.MethodPut)
+	s.router.HandleFunc("/admin/maintenance", s.admin(s.handleClearMaintenance)).Methods(http.MethodDelete)
+	s.router.HandleFunc("/admin/tenants/paused", s.admin(s.handleListPausedTenants)).Methods(http.MethodGet)
+	s.router.HandleFunc("/admin/tenants/paused", s.admin(s.handlePauseTenant)).Methods(http.MethodPut)
+	s.router.HandleFunc("/admin/tenants/paused", s.admin(s.handleResumeTenant)).Methods(http.MethodDelete)
+	s.router.HandleFunc("/admin/pipelines/{id}/ai-exchanges", s.admin(s.handleListAIExchanges)).Methods(http.MethodGet)
+}
+
+// log returns the logger of a request, carrying its request ID.
+func (s *Server) log(ctx context.Context) *logrus.Entry {
+	return logging.FromContext(ctx, s.logger)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.WithError(err).Warn("Failed to encode response")
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, msg string) {
+	s.writeJSON(w, status, errorResponse{Error: msg})
+}
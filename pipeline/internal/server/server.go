@@ -0,0 +1,514 @@
+// Package server wires the engine components together and exposes them over
+// gRPC and HTTP.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/ai"
+	"github.com/devmind-pipeline/pipeline/internal/argocd"
+	"github.com/devmind-pipeline/pipeline/internal/artifacts"
+	"github.com/devmind-pipeline/pipeline/internal/auth"
+	"github.com/devmind-pipeline/pipeline/internal/cancellation"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/credentials"
+	"github.com/devmind-pipeline/pipeline/internal/database"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/lock"
+	"github.com/devmind-pipeline/pipeline/internal/logs"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/policy"
+	"github.com/devmind-pipeline/pipeline/internal/redishealth"
+	"github.com/devmind-pipeline/pipeline/internal/scheduler"
+	"github.com/devmind-pipeline/pipeline/internal/stats"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/internal/tekton"
+	"github.com/devmind-pipeline/pipeline/internal/timeline"
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+// tektonCheckTimeout bounds the startup check of the Tekton installation.
+const tektonCheckTimeout = 15 * time.Second
+
+// databaseInitTimeout bounds migrating the database at startup.
+const databaseInitTimeout = 30 * time.Second
+
+// databaseStatsInterval is how often the database connection gauges are
+// sampled.
+const databaseStatsInterval = 10 * time.Second
+
+// Server is the pipeline engine API server.
+type Server struct {
+	cfg    *config.Config
+	logger *logrus.Logger
+
+	engine    *engine.Engine
+	cancels   *cancellation.Bus
+	redis     *redishealth.Monitor
+	timeline  *timeline.Exporter
+	scheduler *scheduler.Scheduler
+	// snapshot is the configuration pinned by new requests; see Reload.
+	snapshot atomic.Pointer[snapshot]
+	archiver *store.Tiered
+	// db holds the runs; it is closed once the server shut down.
+	db *database.DB
+	// aiExchanges keeps the AI exchanges of runs; see
+	// ai_service.audit_payloads.
+	aiExchanges *store.SQL
+	stats       *stats.Recorder
+	artifacts   artifacts.Store
+	logs        *logs.Manager
+
+	// maintenance, when set through the admin API, overrides
+	// server.maintenance.
+	maintenance atomic.Pointer[config.MaintenanceConfig]
+	// limits are the token buckets of server.rate_limit_enabled.
+	limits clientLimits
+	// auth verifies the bearer tokens of API calls; nil in auth.mode none.
+	auth auth.Authenticator
+
+	// replica is the address this replica advertises; see
+	// server.advertise_address.
+	replica string
+	// readiness tracks the dependencies /readyz waits for.
+	readiness *readiness
+
+	router        *mux.Router
+	httpServer    *http.Server
+	metricsServer *http.Server
+	grpcServer    *grpc.Server
+}
+
+// New creates a Server from cfg. Nothing is started until Start is called.
+func New(cfg *config.Config, logger *logrus.Logger) (_ *Server, err error) {
+	if err := cfg.Network.Validate(); err != nil {
+		return nil, err
+	}
+	artifactStore, err := artifacts.New(cfg.Artifacts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create artifact store: %w", err)
+	}
+
+	runner, err := tekton.New(cfg.Tekton, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tekton client: %w", err)
+	}
+	if err := checkTekton(runner, cfg.Tekton, logger); err != nil {
+		return nil, err
+	}
+	admission, err := policy.New(context.Background(), cfg.Policy, cfg.Network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admission policy: %w", err)
+	}
+	aiGates, err := ai.NewGates(cfg.AIService)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Scheduler.Mode {
+	case "", engine.SchedulingFIFO, engine.SchedulingFair:
+	default:
+		return nil, fmt.Errorf("scheduler.mode: unknown mode %q (%s, %s)", cfg.Scheduler.Mode, engine.SchedulingFIFO, engine.SchedulingFair)
+	}
+	switch cfg.Pipeline.SecretScan {
+	case "", pipeline.SecretScanOff, pipeline.SecretScanWarn, pipeline.SecretScanReject:
+	default:
+		return nil, fmt.Errorf("pipeline.secret_scan: unknown mode %q (%s, %s, %s)", cfg.Pipeline.SecretScan, pipeline.SecretScanOff, pipeline.SecretScanWarn, pipeline.SecretScanReject)
+	}
+	replica := cfg.Server.AdvertiseAddress
+	if replica == "" {
+		if replica, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to determine the advertise address: %w", err)
+		}
+	}
+	credProvider, err := credentials.New(cfg.Credentials, cfg.Network)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credentials provider: %w", err)
+	}
+	var rdb *redis.Client
+	var health *redishealth.Monitor
+	redisClient := func() *redis.Client {
+		if rdb == nil {
+			rdb = redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr(), DB: cfg.Redis.DB, Password: cfg.Redis.Password})
+			health = redishealth.New(rdb, cfg.Redis, logger)
+		}
+		return rdb
+	}
+
+	db, err := openDatabase(cfg.Database, logger)
+	if err != nil {
+		return nil, err
+	}
+	// Only a server that was created closes the database on shutdown.
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	hot := store.NewSQL(db)
+	var runs store.Store = hot
+	var archiver *store.Tiered
+	if cfg.Database.Archive.Enabled {
+		archive, err := store.NewDir(cfg.Database.Archive.Path)
+		if err != nil {
+			return nil, err
+		}
+		archiver = store.NewTiered(hot, archive, cfg.Database.Archive, nil, logger)
+		runs = archiver
+	}
+	// Behind the breaker so a read waiting for a connection beyond its
+	// timeout counts as failed.
+	if cfg.Database.PoolSize > 0 || len(cfg.Database.PoolPartitions) > 0 {
+		runs = store.NewPool(runs, cfg.Database.PoolSize, cfg.Database.PoolPartitions)
+	}
+	if cfg.Database.ReadBreaker.Enabled {
+		runs = store.NewReadBreaker(runs, cfg.Database.ReadBreaker)
+	}
+	// In front of the breaker so cache hits never count against the store.
+	if cfg.Database.StatusCache.Enabled {
+		runs = store.NewCache(runs, redisClient(), cfg.Database.StatusCache, logger)
+	}
+	var aiAudit executor.AIAuditor
+	if cfg.AIService.AuditPayloads {
+		aiAudit = hot
+	}
+	aiClient := ai.New(cfg.AIService, cfg.Network, logger)
+	var deployer executor.Deployer
+	if cfg.ArgoCD.Configured() {
+		if deployer, err = argocd.New(cfg.ArgoCD, cfg.Network, runner, logger); err != nil {
+			return nil, fmt.Errorf("failed to create argocd client: %w", err)
+		}
+	}
+	var healthWatch time.Duration
+	if deployer != nil && cfg.ArgoCD.RollbackEnabled {
+		healthWatch = cfg.ArgoCD.HealthWatchWindow
+	}
+	var optimizer executor.BuildOptimizer
+	if cfg.AIService.BuildOptimization {
+		optimizer = aiClient
+	}
+	var blockThreshold float64
+	if cfg.AIService.BlockOnPrediction {
+		blockThreshold = cfg.AIService.FailureBlockThreshold
+	}
+	exec := executor.New(executor.Options{
+		Runner:            runner,
+		Recorder:          runs,
+		Credentials:       credProvider,
+		PropagatedParams:  cfg.Pipeline.PropagatedParams,
+		HealthChecks:      cfg.Network.Client(egress.ClientHealthCheck, 0),
+		Artifacts:         artifactStore,
+		Replica:           replica,
+		Tests:             aiClient,
+		Predictions:       aiClient,
+		BlockThreshold:    blockThreshold,
+		Optimizer:         optimizer,
+		AIAudit:           aiAudit,
+		History:           runs,
+		Deployer:          deployer,
+		HealthWatchWindow: healthWatch,
+		Logger:            logger,
+	})
+
+	s := &Server{
+		cfg:         cfg,
+		logger:      logger,
+		artifacts:   artifactStore,
+		logs:        logs.NewManager(cfg.Logs.Path),
+		archiver:    archiver,
+		db:          db,
+		aiExchanges: hot,
+		replica:     replica,
+		router:      mux.NewRouter(),
+	}
+	if s.auth, err = auth.New(cfg.Auth, cfg.Network); err != nil {
+		return nil, err
+	}
+	if s.readiness, err = newReadiness(cfg, runner, db, logger); err != nil {
+		return nil, err
+	}
+	if cfg.Stats.Enabled {
+		s.stats = stats.New(cfg.Stats, runs, logger)
+	}
+	if cfg.Tracing.TimelineEndpoint != "" {
+		s.timeline = timeline.NewExporter(cfg.Tracing.TimelineEndpoint, cfg.Tracing.ServiceName, cfg.Network.Client(egress.ClientTimeline, cfg.Tracing.TimelineTimeout))
+	}
+	var relay engine.CancelRelay
+	if cfg.Redis.CancelBroadcast {
+		if s.cancels, err = cancellation.New(redisClient(), cfg.Redis, logger); err != nil {
+			return nil, fmt.Errorf("failed to create cancellation bus: %w", err)
+		}
+		relay = s.cancels
+	}
+	var orphans engine.OrphanLedger
+	if cfg.Redis.RecordOrphans {
+		orphans = store.NewOrphanLedger(redisClient())
+	}
+	var locker engine.RunLocker
+	if cfg.Redis.DedupRuns {
+		if locker, err = lock.New(redisClient(), cfg.Redis, logger); err != nil {
+			return nil, fmt.Errorf("failed to create run locker: %w", err)
+		}
+	}
+	s.engine = engine.New(engine.Options{
+		Executor:          exec,
+		Store:             runs,
+		Policy:            s.policy(),
+		Logger:            logger,
+		Capacity:          runner,
+		Preflight:         cfg.Pipeline.Preflight,
+		PreflightTimeout:  cfg.Pipeline.PreflightTimeout,
+		PreflightInterval: cfg.Pipeline.PreflightInterval,
+		CancelRelay:       relay,
+		Orphans:           orphans,
+		TaskRuns:          runner,
+		Admission:         admission,
+		AdmissionFailOpen: cfg.Policy.FailOpen,
+		Locker:            locker,
+
+		MinResubmitInterval: cfg.Pipeline.MinResubmitInterval,
+		QueueMaxAge:         cfg.Queue.MaxAge,
+		HardTimeout:         cfg.Pipeline.HardTimeout,
+		MaxChainDepth:       cfg.Pipeline.MaxChainDepth,
+		AIGates:             aiGates,
+		MaxConcurrentRuns:   cfg.Server.MaxConcurrentPipelines,
+		SchedulingMode:      cfg.Scheduler.Mode,
+		TenantLabel:         cfg.Scheduler.TenantLabel,
+		PriorityLabel:       cfg.Scheduler.PriorityLabel,
+	})
+	if len(cfg.Scheduler.Schedules) > 0 {
+		var claimer scheduler.Claimer
+		if cfg.Scheduler.Distributed {
+			claimer = scheduler.NewRedisClaimer(redisClient())
+			if cfg.Redis.AssumeSingleReplica {
+				claimer = &degradedClaimer{next: claimer}
+			}
+		}
+		if s.scheduler, err = scheduler.New(cfg.Scheduler, s.engine, claimer, nil, logger); err != nil {
+			return nil, fmt.Errorf("failed to create scheduler: %w", err)
+		}
+	}
+	s.redis = health
+	s.snapshot.Store(&snapshot{cfg: cfg})
+	s.routes()
+
+	readHeaderTimeout := cfg.Server.ReadHeaderTimeout
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	s.httpServer = &http.Server{
+		Addr:              net.JoinHostPort("", cfg.Server.HTTPPort),
+		Handler:           withRequestID(s.withAccessLog(withTraceContext(s.withSnapshot(s.withRateLimit(s.withAuth(s.router)))))),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	s.grpcServer = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryRequestID, s.unaryAccessLog, unaryErrorStatus, unaryTraceContext, s.unarySnapshot, s.unaryRateLimit, s.unaryAuth, s.unaryMaintenance),
+		grpc.ChainStreamInterceptor(streamRequestID, s.streamAccessLog, streamErrorStatus, streamTraceContext, s.streamSnapshot, s.streamRateLimit, s.streamAuth),
+	)
+	pipelinev1.RegisterPipelineServiceServer(s.grpcServer, &grpcService{s: s})
+
+	if cfg.Metrics.Enabled {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(cfg.Metrics.Path, promhttp.Handler())
+		s.metricsServer = &http.Server{
+			Addr:    net.JoinHostPort("", cfg.Server.MetricsPort),
+			Handler: metricsMux,
+		}
+	}
+
+	return s, nil
+}
+
+// Start serves the gRPC and HTTP APIs and the metrics endpoint and blocks
+// until a listener fails or ctx is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	lis, err := net.Listen("tcp", net.JoinHostPort("", s.cfg.Server.GRPCPort))
+	if err != nil {
+		return fmt.Errorf("failed to listen for grpc: %w", err)
+	}
+
+	errCh := make(chan error, 3)
+	go func() {
+		s.logger.WithField("addr", lis.Addr().String()).Info("grpc server listening")
+		if err := s.grpcServer.Serve(lis); err != nil {
+			errCh <- fmt.Errorf("grpc server: %w", err)
+		}
+	}()
+	s.serve("http", s.httpServer, errCh)
+	go s.readiness.run(ctx)
+	go s.db.ReportStats(ctx, databaseStatsInterval)
+	go s.purgeAIExchanges(ctx)
+	if s.scheduler != nil {
+		go s.scheduler.Run(ctx)
+	}
+	if s.archiver != nil {
+		go s.archiver.Run(ctx)
+	}
+	go s.logs.RunPurger(ctx, logRetention(s.cfg.Logs), s.cfg.Logs.PurgeInterval, nil, s.logger)
+	if s.stats != nil {
+		go s.stats.Run(ctx)
+	}
+	if s.redis != nil {
+		go s.redis.Run(ctx)
+	}
+	if s.cancels != nil {
+		go s.listenCancels(ctx)
+	}
+	go s.reconcileOrphans(ctx)
+	if s.metricsServer != nil {
+		s.serve("metrics", s.metricsServer, errCh)
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// reconcileOrphans cancels the runs replicas left orphaned at shutdown, at
+// startup and then every redis.orphan_reconcile_interval: in a rolling
+// deploy the replicas orphaning runs usually stop after their successors
+// started.
+func (s *Server) reconcileOrphans(ctx context.Context) {
+	if !s.cfg.Redis.RecordOrphans {
+		return
+	}
+	interval := s.cfg.Redis.OrphanReconcileInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := s.engine.ReconcileOrphans(ctx)
+		if err != nil {
+			s.logger.WithError(err).Error("Failed to reconcile orphaned pipelines")
+		}
+		if n > 0 {
+			s.logger.WithField("cancelled", n).Warn("Cancelled pipelines orphaned by replicas that shut down")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Shutdown stops accepting pipelines and waits for those in flight to
+// finish, then gracefully stops the listeners, waiting for in-flight
+// requests, all until ctx expires. The APIs keep serving while pipelines
+// drain so their status can still be followed. Pipelines still running at
+// the deadline are recorded as Orphaned and the listeners are closed at
+// once.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.db != nil {
+		defer s.db.Close()
+	}
+	res := s.engine.Drain(ctx)
+	log := s.logger.WithFields(logrus.Fields{"drained": res.Drained, "orphaned": res.Orphaned})
+	if res.Orphaned > 0 {
+		log.Warn("Shutdown timeout reached with pipelines still running, recorded them as orphaned")
+	} else {
+		log.Info("Drained in-flight pipelines")
+	}
+	if ctx.Err() != nil {
+		s.grpcServer.Stop()
+		s.httpServer.Close()
+		if s.metricsServer != nil {
+			s.metricsServer.Close()
+		}
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown http server: %w", err)
+	}
+	if s.metricsServer != nil {
+		if err := s.metricsServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to shutdown metrics server: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) serve(name string, srv *http.Server, errCh chan<- error) {
+	go func() {
+		s.logger.WithField("addr", srv.Addr).Infof("%s server listening", name)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- fmt.Errorf("%s server: %w", name, err)
+		}
+	}()
+}
+
+// openDatabase opens the database runs are kept in and brings its schema up
+// to date, or with database.auto_migrate off checks that it is. Startup fails
+// rather than serve from a database that is unreachable or not migrated.
+func openDatabase(cfg config.DatabaseConfig, logger *logrus.Logger) (*database.DB, error) {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), databaseInitTimeout)
+	defer cancel()
+	if !cfg.AutoMigrate {
+		err = db.CheckSchema(ctx)
+	} else {
+		var applied []database.Migration
+		applied, err = db.MigrateUp(ctx)
+		for _, m := range applied {
+			logger.WithFields(logrus.Fields{"version": m.Version, "name": m.Name}).Info("Applied database migration")
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// checkTekton verifies the Tekton installation before serving. A failed
+// check only fails startup when tekton.require_crds is set.
+func checkTekton(runner *tekton.Client, cfg config.TektonConfig, logger *logrus.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tektonCheckTimeout)
+	defer cancel()
+
+	err := runner.CheckCRDs(ctx)
+	if err == nil {
+		logger.WithField("namespace", cfg.Namespace).Info("Tekton CRDs verified")
+		return nil
+	}
+	if cfg.RequireCRDs {
+		return fmt.Errorf("tekton check failed: %w", err)
+	}
+	logger.WithError(err).Error("Tekton check failed, pipelines will fail until Tekton is installed")
+	return nil
+}
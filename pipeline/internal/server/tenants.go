@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+)
+
+type pauseTenantRequest struct {
+	engine.TenantSelector
+	Reason string `json:"reason,omitempty"`
+	// CancelRunning also cancels the matching runs queued or executing on
+	// this replica.
+	CancelRunning bool `json:"cancel_running,omitempty"`
+}
+
+type pausedTenantsResponse struct {
+	Paused []engine.TenantPause `json:"paused"`
+	// Cancelled is the number of runs the request cancelled.
+	Cancelled int `json:"cancelled,omitempty"`
+}
+
+// handleListPausedTenants reports the tenants whose submissions this replica
+// refuses.
+func (s *Server) handleListPausedTenants(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, pausedTenantsResponse{Paused: s.engine.PausedTenants()})
+}
+
+// handlePauseTenant refuses the submissions of a tenant or repo on this
+// replica, optionally cancelling its runs, until the pause is deleted.
+func (s *Server) handlePauseTenant(w http.ResponseWriter, r *http.Request) {
+	var req pauseTenantRequest
+	if !s.decodeBody(w, r, maxSpecBytes, &req) {
+		return
+	}
+	cancelled, err := s.engine.PauseTenant(req.TenantSelector, req.Reason, req.CancelRunning)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, pausedTenantsResponse{Paused: s.engine.PausedTenants(), Cancelled: cancelled})
+}
+
+// handleResumeTenant lifts the pause given by the tenant and repo query
+// parameters.
+func (s *Server) handleResumeTenant(w http.ResponseWriter, r *http.Request) {
+	sel := engine.TenantSelector{Tenant: r.URL.Query().Get("tenant"), Repo: r.URL.Query().Get("repo")}
+	if sel == (engine.TenantSelector{}) {
+		s.writeError(w, http.StatusBadRequest, engine.ErrEmptySelector.Error())
+		return
+	}
+	if !s.engine.ResumeTenant(sel) {
+		s.writeError(w, http.StatusNotFound, "no pause for "+sel.String())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, pausedTenantsResponse{Paused: s.engine.PausedTenants()})
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func TestAdminPausesTenant(t *testing.T) {
+	s := newArtifactTestServer(t)
+	s.cfg.Server.AdminToken = "secret"
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if strings.HasPrefix(path, "/admin/") {
+			req.Header.Set("Authorization", "Bearer secret")
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	submit := func(repo string) *httptest.ResponseRecorder {
+		spec, _ := json.Marshal("name: build\nrepo: " + repo + "\nstages:\n- name: compile\n  image: golang:1.21\n")
+		return do(http.MethodPost, "/pipelines", `{"spec":`+string(spec)+`}`)
+	}
+
+	if rec := do(http.MethodPut, "/admin/tenants/paused", `{"repo":"org/payments","reason":"offboarding"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"repo":"org/payments"`) {
+		t.Fatalf("pause: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := submit("org/payments"); rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "offboarding") {
+		t.Fatalf("submit for paused repo: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := submit("org/search"); rec.Code != http.StatusCreated {
+		t.Fatalf("submit for another repo: status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var listed pausedTenantsResponse
+	rec := do(http.MethodGet, "/admin/tenants/paused", "")
+	if err := json.NewDecoder(rec.Body).Decode(&listed); err != nil || len(listed.Paused) != 1 {
+		t.Fatalf("list: %+v, %v", listed, err)
+	}
+
+	if rec := do(http.MethodDelete, "/admin/tenants/paused?repo=org/search", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("resume of a repo never paused: status = %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/admin/tenants/paused?repo=org/payments", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"paused":[]`) {
+		t.Fatalf("resume: status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := submit("org/payments"); rec.Code != http.StatusCreated {
+		t.Fatalf("submit after resume: status = %d, body = %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+type exportTraceResponse struct {
+	TraceID string `json:"trace_id"`
+	Spans   int    `json:"spans"`
+}
+
+// handleExportTrace rebuilds a run's timeline from its stored timings and
+// exports it to tracing.timeline_endpoint, answering with the trace ID to look
+// it up by.
+func (s *Server) handleExportTrace(w http.ResponseWriter, r *http.Request) {
+	if s.timeline == nil {
+		s.writeError(w, http.StatusNotImplemented, "tracing.timeline_endpoint is not configured")
+		return
+	}
+	id := mux.Vars(r)["id"]
+	run, err := s.engine.Get(r.Context(), id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		s.writeError(w, http.StatusNotFound, "pipeline not found")
+		return
+	case errors.Is(err, store.ErrUnavailable):
+		s.writeUnavailable(w, r, err)
+		return
+	case err != nil:
+		s.log(r.Context()).WithError(err).Error("Failed to get pipeline")
+		s.writeError(w, http.StatusInternalServerError, "failed to get pipeline")
+		return
+	}
+	if run.StartedAt == nil {
+		s.writeError(w, http.StatusConflict, "pipeline has not started")
+		return
+	}
+
+	tr, err := s.timeline.Export(r.Context(), run)
+	if err != nil {
+		s.log(r.Context()).WithError(err).WithField("pipeline_id", id).Error("Failed to export run timeline")
+		s.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, exportTraceResponse{TraceID: tr.TraceID, Spans: len(tr.Spans)})
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+// withTraceContext continues the caller's trace: the span context of an
+// incoming traceparent header is put on the request context, so pipelines
+// submitted by the request record it and their spans join that trace.
+func withTraceContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// unaryTraceContext is withTraceContext for unary gRPC calls, reading the
+// traceparent from the call's metadata.
+func unaryTraceContext(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(extractMetadata(ctx), req)
+}
+
+// streamTraceContext is withTraceContext for streaming gRPC calls.
+func streamTraceContext(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &traceContextStream{ServerStream: ss, ctx: extractMetadata(ss.Context())})
+}
+
+func extractMetadata(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return tracing.Extract(ctx, metadataCarrier(md))
+}
+
+type traceContextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *traceContextStream) Context() context.Context { return s.ctx }
+
+// metadataCarrier adapts gRPC metadata to a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) { metadata.MD(c).Set(key, value) }
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	pipelinev1 "github.com/devmind-pipeline/pipeline/api/v1"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/results"
+)
+
+// maxSpecBytes bounds the size of a submitted spec.
+const maxSpecBytes = 1 << 20
+
+type validateSpecResponse struct {
+	Valid          bool            `json:"valid"`
+	NormalizedSpec *pipeline.Spec  `json:"normalized_spec,omitempty"`
+	Issues         pipeline.Issues `json:"issues"`
+}
+
+// validateSpec parses, normalizes and validates a spec. The returned spec is
+// nil when parsing failed.
+func (s *Server) validateSpec(data []byte) (*pipeline.Spec, pipeline.Issues) {
+	spec, err := pipeline.Parse(data)
+	if err != nil {
+		return nil, pipeline.Issues{{Severity: pipeline.SeverityError, Path: "", Message: err.Error()}}
+	}
+	pipeline.Normalize(spec)
+	return spec, pipeline.Validate(spec, s.policy())
+}
+
+func (s *Server) policy() pipeline.Policy {
+	return pipeline.Policy{
+		AllowedRegistries:      s.cfg.Pipeline.AllowedRegistries,
+		AllowedServiceAccounts: s.cfg.Pipeline.AllowedServiceAccounts,
+		MaxStages:              s.cfg.Pipeline.MaxStages,
+		ResultParsers:          results.Names(),
+		SecretScan:             s.cfg.Pipeline.SecretScan,
+	}
+}
+
+// handleValidateSpec lints a spec given as a YAML or JSON request body.
+func (s *Server) handleValidateSpec(w http.ResponseWriter, r *http.Request) {
+	data, err := s.readBody(w, r, maxSpecBytes)
+	if err != nil {
+		s.writeBodyError(w, err)
+		return
+	}
+
+	spec, issues := s.validateSpec(data)
+	if issues == nil {
+		issues = pipeline.Issues{}
+	}
+	s.writeJSON(w, http.StatusOK, validateSpecResponse{
+		Valid:          !issues.HasErrors(),
+		NormalizedSpec: spec,
+		Issues:         issues,
+	})
+}
+
+// ValidateSpec implements the gRPC method of the same name.
+func (g *grpcService) ValidateSpec(ctx context.Context, req *pipelinev1.ValidateSpecRequest) (*pipelinev1.ValidateSpecResponse, error) {
+	spec, issues := g.s.validateSpec([]byte(req.GetSpec()))
+
+	resp := &pipelinev1.ValidateSpecResponse{Valid: !issues.HasErrors()}
+	if spec != nil {
+		buf, err := json.Marshal(spec)
+		if err != nil {
+			return nil, err
+		}
+		resp.NormalizedSpec = string(buf)
+	}
+	resp.Issues = issuesToProto(issues)
+	return resp, nil
+}
+
+func issuesToProto(issues pipeline.Issues) []*pipelinev1.Issue {
+	var out []*pipelinev1.Issue
+	for _, i := range issues {
+		severity := pipelinev1.Issue_SEVERITY_WARNING
+		if i.Severity == pipeline.SeverityError {
+			severity = pipelinev1.Issue_SEVERITY_ERROR
+		}
+		out = append(out, &pipelinev1.Issue{Severity: severity, Path: i.Path, Message: i.Message})
+	}
+	return out
+}
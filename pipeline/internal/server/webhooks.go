@@ -0,0 +1,331 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+)
+
+// maxWebhookBytes bounds the size of a webhook delivery.
+const maxWebhookBytes = 25 << 20
+
+// Webhook event kinds, as named by webhooks.triggers[].events.
+const (
+	WebhookPush        = "push"
+	WebhookPullRequest = "pull_request"
+)
+
+var (
+	// errBadSignature is a delivery whose signature or token does not match
+	// the provider's secret.
+	errBadSignature = errors.New("webhook signature does not match")
+	// errUnsupportedEvent is a valid delivery of an event that triggers no
+	// pipeline, such as a ping, a tag push or a closed pull request.
+	errUnsupportedEvent = errors.New("unsupported webhook event")
+)
+
+// WebhookEvent is a source control event that may trigger pipelines.
+type WebhookEvent struct {
+	// Kind is WebhookPush or WebhookPullRequest.
+	Kind string
+	// Repo is the repository as host/path, e.g. github.com/org/app. For
+	// pull requests it is the target repository.
+	Repo string
+	// Branch is the pushed branch, or the source branch of a pull request.
+	Branch string
+	Commit string
+	// Sender is the account that caused the event.
+	Sender string
+}
+
+// WebhookParser verifies and decodes the deliveries of one source control
+// provider.
+type WebhookParser interface {
+	// Secret returns the configured secret deliveries are verified with;
+	// empty when the provider is not configured.
+	Secret(cfg config.WebhooksConfig) string
+	// Parse verifies the delivery against secret and extracts its event. It
+	// fails with errBadSignature when verification fails and with
+	// errUnsupportedEvent for events that trigger no pipeline.
+	Parse(header http.Header, body []byte, secret string) (*WebhookEvent, error)
+}
+
+// webhookParsers are the providers served on /webhooks/{provider}.
+var webhookParsers = map[string]WebhookParser{
+	"github": githubParser{},
+	"gitlab": gitlabParser{},
+}
+
+// handleWebhook submits the pipelines whose triggers match a source control
+// event. Deliveries of unsupported events, or matching no trigger, are
+// acknowledged with 204 so the provider does not retry them; otherwise the
+// response is that of a batch submission.
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := mux.Vars(r)["provider"]
+	parser, ok := webhookParsers[provider]
+	if !ok {
+		s.writeError(w, http.StatusNotFound, fmt.Sprintf("unknown webhook provider %q", provider))
+		return
+	}
+	cfg := s.requestConfig(r.Context()).Webhooks
+	secret := parser.Secret(cfg)
+	if secret == "" {
+		s.writeError(w, http.StatusForbidden, fmt.Sprintf("webhooks.%s_secret is not configured", provider))
+		return
+	}
+	body, err := s.readBody(w, r, maxWebhookBytes)
+	if err != nil {
+		s.writeBodyError(w, err)
+		return
+	}
+
+	log := s.log(r.Context()).WithField("provider", provider)
+	ev, err := parser.Parse(r.Header, body, secret)
+	switch {
+	case errors.Is(err, errBadSignature):
+		log.Warn("Rejected webhook with an invalid signature")
+		s.writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, errUnsupportedEvent):
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case err != nil:
+		s.writeError(w, http.StatusBadRequest, "invalid webhook payload: "+err.Error())
+		return
+	}
+
+	var reqs []engine.SubmitRequest
+	for _, t := range cfg.Triggers {
+		if !triggerMatches(t, ev) {
+			continue
+		}
+		spec, err := os.ReadFile(t.SpecFile)
+		if err != nil {
+			log.WithError(err).WithField("spec_file", t.SpecFile).Error("Failed to read webhook trigger spec")
+			s.writeError(w, http.StatusInternalServerError, "failed to read pipeline spec")
+			return
+		}
+		reqs = append(reqs, engine.SubmitRequest{
+			Spec:        spec,
+			Params:      t.Params,
+			TriggeredBy: "webhook:" + provider + ":" + ev.Sender,
+			Repo:        ev.Repo,
+			Branch:      ev.Branch,
+			Commit:      ev.Commit,
+		})
+	}
+	if len(reqs) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	log.WithFields(logrus.Fields{
+		"event":    ev.Kind,
+		"repo":     ev.Repo,
+		"branch":   ev.Branch,
+		"commit":   ev.Commit,
+		"triggers": len(reqs),
+	}).Info("Webhook triggered pipelines")
+	s.submitBatch(w, r, reqs)
+}
+
+// triggerMatches reports whether t submits a pipeline for ev.
+func triggerMatches(t config.WebhookTriggerConfig, ev *WebhookEvent) bool {
+	if !strings.EqualFold(t.Repo, ev.Repo) {
+		return false
+	}
+	events := t.Events
+	if len(events) == 0 {
+		events = []string{WebhookPush}
+	}
+	kind := false
+	for _, e := range events {
+		kind = kind || e == ev.Kind
+	}
+	if !kind {
+		return false
+	}
+	if len(t.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range t.Branches {
+		if ok, _ := path.Match(pattern, ev.Branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// repoFromURL turns a repository web URL into host/path.
+func repoFromURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid repository URL %q", raw)
+	}
+	return u.Host + strings.TrimSuffix(u.Path, ".git"), nil
+}
+
+// branchFromRef returns the branch of a refs/heads/ ref; other refs, such as
+// tags, push no branch.
+func branchFromRef(ref string) (string, bool) {
+	branch := strings.TrimPrefix(ref, "refs/heads/")
+	return branch, branch != ref && branch != ""
+}
+
+// zeroCommit is the commit pushed when a branch is deleted.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// githubParser handles GitHub deliveries, signed with an HMAC-SHA256 of the
+// body in X-Hub-Signature-256.
+type githubParser struct{}
+
+func (githubParser) Secret(cfg config.WebhooksConfig) string { return cfg.GitHubSecret }
+
+type githubPayload struct {
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+	Action  string `json:"action"`
+
+	Repository struct {
+		HTMLURL string `json:"html_url"`
+	} `json:"repository"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Sender struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+func (githubParser) Parse(header http.Header, body []byte, secret string) (*WebhookEvent, error) {
+	sig, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+	got, err := hex.DecodeString(sig)
+	if !ok || err != nil {
+		return nil, errBadSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return nil, errBadSignature
+	}
+
+	event := header.Get("X-GitHub-Event")
+	if event != "push" && event != "pull_request" {
+		return nil, errUnsupportedEvent
+	}
+	var p githubPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	repo, err := repoFromURL(p.Repository.HTMLURL)
+	if err != nil {
+		return nil, err
+	}
+	ev := &WebhookEvent{Repo: repo, Sender: p.Sender.Login}
+
+	if event == "push" {
+		branch, ok := branchFromRef(p.Ref)
+		if !ok || p.Deleted || p.After == zeroCommit {
+			return nil, errUnsupportedEvent
+		}
+		ev.Kind, ev.Branch, ev.Commit = WebhookPush, branch, p.After
+		return ev, nil
+	}
+	switch p.Action {
+	case "opened", "synchronize", "reopened":
+	default:
+		return nil, errUnsupportedEvent
+	}
+	ev.Kind, ev.Branch, ev.Commit = WebhookPullRequest, p.PullRequest.Head.Ref, p.PullRequest.Head.SHA
+	return ev, nil
+}
+
+// gitlabParser handles GitLab deliveries, which carry the webhook's secret
+// token in X-Gitlab-Token.
+type gitlabParser struct{}
+
+func (gitlabParser) Secret(cfg config.WebhooksConfig) string { return cfg.GitLabSecret }
+
+type gitlabPayload struct {
+	ObjectKind   string `json:"object_kind"`
+	Ref          string `json:"ref"`
+	After        string `json:"after"`
+	CheckoutSHA  string `json:"checkout_sha"`
+	UserUsername string `json:"user_username"`
+
+	Project struct {
+		WebURL string `json:"web_url"`
+	} `json:"project"`
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ObjectAttributes struct {
+		Action       string `json:"action"`
+		SourceBranch string `json:"source_branch"`
+		LastCommit   struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+}
+
+func (gitlabParser) Parse(header http.Header, body []byte, secret string) (*WebhookEvent, error) {
+	if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+		return nil, errBadSignature
+	}
+
+	var p gitlabPayload
+	switch header.Get("X-Gitlab-Event") {
+	case "Push Hook", "Merge Request Hook":
+	default:
+		return nil, errUnsupportedEvent
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	repo, err := repoFromURL(p.Project.WebURL)
+	if err != nil {
+		return nil, err
+	}
+	ev := &WebhookEvent{Repo: repo}
+
+	switch p.ObjectKind {
+	case "push":
+		branch, ok := branchFromRef(p.Ref)
+		if !ok || p.After == zeroCommit {
+			return nil, errUnsupportedEvent
+		}
+		commit := p.CheckoutSHA
+		if commit == "" {
+			commit = p.After
+		}
+		ev.Kind, ev.Branch, ev.Commit, ev.Sender = WebhookPush, branch, commit, p.UserUsername
+	case "merge_request":
+		switch p.ObjectAttributes.Action {
+		case "open", "reopen", "update":
+		default:
+			return nil, errUnsupportedEvent
+		}
+		ev.Kind, ev.Branch, ev.Commit, ev.Sender = WebhookPullRequest, p.ObjectAttributes.SourceBranch, p.ObjectAttributes.LastCommit.ID, p.User.Username
+	default:
+		return nil, errUnsupportedEvent
+	}
+	return ev, nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/engine"
+	"github.com/devmind-pipeline/pipeline/internal/executor"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+)
+
+func newWebhookTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := newArtifactTestServer(t)
+	runs := store.NewMemory()
+	s.engine = engine.New(engine.Options{
+		Executor: executor.New(executor.Options{Runner: nopRunner{}, Recorder: runs, Logger: s.logger}),
+		Store:    runs,
+		Logger:   s.logger,
+	})
+	t.Cleanup(s.engine.Close)
+
+	specFile := filepath.Join(t.TempDir(), "deploy.yaml")
+	spec := "name: deploy\nrepo: github.com/org/other\nstages:\n- name: apply\n  image: ghcr.io/org/deploy:1.0\n"
+	if err := os.WriteFile(specFile, []byte(spec), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.cfg.Webhooks = config.WebhooksConfig{
+		GitHubSecret: "gh-secret",
+		GitLabSecret: "gl-secret",
+		Triggers: []config.WebhookTriggerConfig{
+			{Repo: "github.com/org/app", Branches: []string{"main"}, Events: []string{"push", "pull_request"}, SpecFile: specFile},
+			{Repo: "gitlab.com/org/app", SpecFile: specFile},
+		},
+	}
+	return s
+}
+
+func githubDelivery(event, body, secret string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(body))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestGitHubPushWebhookSubmitsPipeline(t *testing.T) {
+	s := newWebhookTestServer(t)
+	push := `{"ref": "refs/heads/main", "after": "abc123", "repository": {"html_url": "https://github.com/org/app"}, "sender": {"login": "octocat"}}`
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, githubDelivery("push", push, "gh-secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	var resp submitBatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 1 || len(resp.Results) != 1 {
+		t.Fatalf("response = %+v, want one accepted run", resp)
+	}
+	run := resp.Results[0].Run
+	if run.Spec.Repo != "github.com/org/app" || run.Spec.Branch != "main" || run.Spec.Commit != "abc123" {
+		t.Errorf("run at %s@%s %s, want github.com/org/app@main abc123", run.Spec.Repo, run.Spec.Branch, run.Spec.Commit)
+	}
+	if run.TriggeredBy != "webhook:github:octocat" {
+		t.Errorf("TriggeredBy = %q", run.TriggeredBy)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, githubDelivery("push", push, "wrong"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad signature: status = %d, want 401", rec.Code)
+	}
+}
+
+func TestWebhookAcknowledgesUnsupportedEvents(t *testing.T) {
+	s := newWebhookTestServer(t)
+	for name, req := range map[string]*http.Request{
+		"ping":           githubDelivery("ping", `{"zen": "Keep it logically awesome."}`, "gh-secret"),
+		"tag push":       githubDelivery("push", `{"ref": "refs/tags/v1", "after": "abc123", "repository": {"html_url": "https://github.com/org/app"}}`, "gh-secret"),
+		"closed pr":      githubDelivery("pull_request", `{"action": "closed", "repository": {"html_url": "https://github.com/org/app"}}`, "gh-secret"),
+		"no trigger":     githubDelivery("push", `{"ref": "refs/heads/feature", "after": "abc123", "repository": {"html_url": "https://github.com/org/app"}}`, "gh-secret"),
+		"deleted branch": githubDelivery("push", `{"ref": "refs/heads/main", "after": "0000000000000000000000000000000000000000", "deleted": true, "repository": {"html_url": "https://github.com/org/app"}}`, "gh-secret"),
+	} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s: status = %d, want 204, body = %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestGitLabPushWebhook(t *testing.T) {
+	s := newWebhookTestServer(t)
+	push := `{"object_kind": "push", "ref": "refs/heads/dev", "after": "def456", "checkout_sha": "def456", "user_username": "jdoe", "project": {"web_url": "https://gitlab.com/org/app"}}`
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/gitlab", strings.NewReader(push))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "gl-secret")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"accepted":1`) {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/webhooks/gitlab", strings.NewReader(push))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "wrong")
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("bad token: status = %d, want 401", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/webhooks/bitbucket", strings.NewReader("{}")))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown provider: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,210 @@
+// Package stats periodically aggregates recent runs into per-pipeline
+// statistics (run count, success rate, p95 duration), exposes them as gauges
+// and optionally appends each snapshot to a history file for trend queries.
+//
+// Dashboards read the gauges instead of listing raw runs, so the cost of the
+// aggregation is paid once per interval rather than once per panel refresh.
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	// DefaultInterval is used when stats.interval is not configured.
+	DefaultInterval = time.Minute
+	// DefaultWindow is used when stats.window is not configured.
+	DefaultWindow = 24 * time.Hour
+)
+
+// PipelineStats aggregates the runs of one pipeline within the window.
+type PipelineStats struct {
+	Pipeline string `json:"pipeline"`
+	// Runs counts finished runs; cancelled runs count here but in neither
+	// Succeeded nor Failed.
+	Runs      int `json:"runs"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// SuccessRate is Succeeded over Succeeded plus Failed.
+	SuccessRate float64 `json:"success_rate"`
+	// P95Duration is the 95th percentile duration of succeeded and failed
+	// runs, in seconds.
+	P95Duration float64 `json:"p95_duration_seconds"`
+}
+
+// Snapshot is one aggregation over the runs created within Window before At.
+type Snapshot struct {
+	At        time.Time       `json:"at"`
+	Window    string          `json:"window"`
+	Pipelines []PipelineStats `json:"pipelines"`
+}
+
+// Recorder computes snapshots on an interval.
+type Recorder struct {
+	runs     store.Store
+	interval time.Duration
+	window   time.Duration
+	history  string
+	logger   *logrus.Logger
+	now      func() time.Time
+
+	// mu serializes appends to the history file.
+	mu sync.Mutex
+}
+
+// New creates a Recorder reading runs from runs.
+func New(cfg config.StatsConfig, runs store.Store, logger *logrus.Logger) *Recorder {
+	r := &Recorder{
+		runs:     runs,
+		interval: cfg.Interval,
+		window:   cfg.Window,
+		history:  cfg.HistoryFile,
+		logger:   logger,
+		now:      time.Now,
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultInterval
+	}
+	if r.window <= 0 {
+		r.window = DefaultWindow
+	}
+	return r
+}
+
+// Snapshot aggregates the finished runs created within the window. Pipelines
+// beyond the metric label limit are aggregated together under
+// metrics.OverflowLabel.
+func (r *Recorder) Snapshot(ctx context.Context) (*Snapshot, error) {
+	now := r.now().UTC()
+	runs, err := r.runs.ListRuns(ctx, store.ListOptions{CreatedAfter: now.Add(-r.window)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+
+	byPipeline := make(map[string]*PipelineStats)
+	durations := make(map[string][]float64)
+	for _, run := range runs {
+		if !run.Status.Terminal() {
+			continue
+		}
+		name := metrics.PipelineLabel(run.Spec.Name)
+		ps, ok := byPipeline[name]
+		if !ok {
+			ps = &PipelineStats{Pipeline: name}
+			byPipeline[name] = ps
+		}
+		ps.Runs++
+		switch run.Status {
+		case pipeline.StatusSucceeded:
+			ps.Succeeded++
+		case pipeline.StatusFailed:
+			ps.Failed++
+		default:
+			continue
+		}
+		if run.StartedAt != nil && run.FinishedAt != nil {
+			durations[name] = append(durations[name], run.FinishedAt.Sub(*run.StartedAt).Seconds())
+		}
+	}
+
+	snap := &Snapshot{At: now, Window: r.window.String()}
+	for name, ps := range byPipeline {
+		if decided := ps.Succeeded + ps.Failed; decided > 0 {
+			ps.SuccessRate = float64(ps.Succeeded) / float64(decided)
+		}
+		ps.P95Duration = percentile(durations[name], 0.95)
+		snap.Pipelines = append(snap.Pipelines, *ps)
+	}
+	sort.Slice(snap.Pipelines, func(i, j int) bool { return snap.Pipelines[i].Pipeline < snap.Pipelines[j].Pipeline })
+	return snap, nil
+}
+
+// Record computes a snapshot, publishes it as gauges and appends it to the
+// history file when one is configured.
+func (r *Recorder) Record(ctx context.Context) error {
+	snap, err := r.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Reset so pipelines that left the window stop being reported.
+	metrics.PipelineRuns.Reset()
+	metrics.PipelineSuccessRate.Reset()
+	metrics.PipelineDurationP95.Reset()
+	for _, ps := range snap.Pipelines {
+		metrics.PipelineRuns.WithLabelValues(ps.Pipeline).Set(float64(ps.Runs))
+		metrics.PipelineSuccessRate.WithLabelValues(ps.Pipeline).Set(ps.SuccessRate)
+		metrics.PipelineDurationP95.WithLabelValues(ps.Pipeline).Set(ps.P95Duration)
+	}
+
+	if r.history == "" {
+		return nil
+	}
+	return r.append(snap)
+}
+
+// Run records a snapshot every interval until ctx is done.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Record(ctx); err != nil && ctx.Err() == nil {
+			r.logger.WithError(err).Error("Failed to record pipeline stats snapshot")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// append writes snap as one JSON line to the history file.
+func (r *Recorder) append(snap *Snapshot) error {
+	line, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to encode stats snapshot: %w", err)
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.history, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open stats history: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write stats history: %w", err)
+	}
+	return f.Close()
+}
+
+// percentile returns the nearest-rank p-th percentile of values, or 0 when
+// there are none.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
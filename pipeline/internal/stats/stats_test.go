@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/internal/store"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+func TestRecordAggregatesRecentRuns(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	runs := store.NewMemory()
+	save := func(id, name string, status pipeline.Status, age, took time.Duration) {
+		created := now.Add(-age)
+		finished := created.Add(took)
+		run := &pipeline.Run{ID: id, Spec: pipeline.Spec{Name: name}, Status: status, CreatedAt: created, StartedAt: &created}
+		if status.Terminal() {
+			run.FinishedAt = &finished
+		}
+		if err := runs.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("1", "deploy", pipeline.StatusSucceeded, time.Hour, 60*time.Second)
+	save("2", "deploy", pipeline.StatusSucceeded, time.Hour, 90*time.Second)
+	save("3", "deploy", pipeline.StatusFailed, time.Hour, 30*time.Second)
+	save("4", "deploy", pipeline.StatusCancelled, time.Hour, 5*time.Second)
+	save("5", "deploy", pipeline.StatusRunning, time.Minute, 0)
+	save("6", "deploy", pipeline.StatusFailed, 48*time.Hour, time.Hour)
+	save("7", "lint", pipeline.StatusSucceeded, time.Hour, 10*time.Second)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	history := filepath.Join(t.TempDir(), "stats.jsonl")
+	r := New(config.StatsConfig{Window: 24 * time.Hour, HistoryFile: history}, runs, logger)
+	r.now = func() time.Time { return now }
+
+	if err := r.Record(ctx); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	want := []PipelineStats{
+		{Pipeline: "deploy", Runs: 4, Succeeded: 2, Failed: 1, SuccessRate: 2.0 / 3, P95Duration: 90},
+		{Pipeline: "lint", Runs: 1, Succeeded: 1, SuccessRate: 1, P95Duration: 10},
+	}
+	if got := testutil.ToFloat64(metrics.PipelineSuccessRate.WithLabelValues("deploy")); got != 2.0/3 {
+		t.Errorf("success ratio gauge = %v, want %v", got, 2.0/3)
+	}
+	if got := testutil.ToFloat64(metrics.PipelineDurationP95.WithLabelValues("deploy")); got != 90 {
+		t.Errorf("p95 gauge = %v, want 90", got)
+	}
+
+	f, err := os.Open(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		t.Fatal("history file is empty")
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(sc.Bytes(), &snap); err != nil {
+		t.Fatal(err)
+	}
+	if !snap.At.Equal(now) || !reflect.DeepEqual(snap.Pipelines, want) {
+		t.Fatalf("snapshot = %+v, want %+v at %s", snap, want, now)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   float64
+	}{
+		{nil, 0},
+		{[]float64{7}, 7},
+		{[]float64{5, 1, 4, 2, 3}, 5},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}, 19},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, 0.95); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.values, got, tt.want)
+		}
+	}
+}
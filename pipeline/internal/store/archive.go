@@ -0,0 +1,330 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	// DefaultArchiveMaxAge is used when database.archive.max_age is not set.
+	DefaultArchiveMaxAge = 7 * 24 * time.Hour
+	// DefaultArchiveInterval is used when database.archive.interval is not
+	// set.
+	DefaultArchiveInterval = 10 * time.Minute
+)
+
+// Pruner is a Store runs can be removed from.
+type Pruner interface {
+	Store
+	DeleteRuns(ctx context.Context, ids []string) error
+}
+
+// DeleteRuns removes the runs with the given IDs. Unknown IDs are ignored.
+func (m *Memory) DeleteRuns(ctx context.Context, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		delete(m.runs, id)
+	}
+	return nil
+}
+
+// Dir is a Store that keeps one JSON document per run in a directory. It is
+// meant for cold history: listing reads every document.
+type Dir struct {
+	root string
+}
+
+// NewDir creates a Dir rooted at root, creating the directory if needed.
+func NewDir(root string) (*Dir, error) {
+	if err := os.MkdirAll(root, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &Dir{root: root}, nil
+}
+
+// SaveRun implements Store. The document is replaced atomically.
+func (d *Dir) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run %s: %w", run.ID, err)
+	}
+	tmp, err := os.CreateTemp(d.root, ".run-*")
+	if err != nil {
+		return fmt.Errorf("failed to archive run %s: %w", run.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to archive run %s: %w", run.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to archive run %s: %w", run.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), d.path(run.ID)); err != nil {
+		return fmt.Errorf("failed to archive run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// SaveRuns implements Store.
+func (d *Dir) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	for _, run := range runs {
+		if err := d.SaveRun(ctx, run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRun implements Store.
+func (d *Dir) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, ErrNotFound
+	}
+	return d.read(d.path(id))
+}
+
+// ListRuns implements Store.
+func (d *Dir) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	entries, err := os.ReadDir(d.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archived runs: %w", err)
+	}
+	var out []*pipeline.Run
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		run, err := d.read(filepath.Join(d.root, e.Name()))
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if opts.matches(run) {
+			out = append(out, run)
+		}
+	}
+	sortNewestFirst(out)
+	return opts.page(out), nil
+}
+
+// CountRuns implements Store.
+func (d *Dir) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	opts.Offset, opts.Limit = 0, 0
+	runs, err := d.ListRuns(ctx, opts)
+	return len(runs), err
+}
+
+func (d *Dir) path(id string) string {
+	return filepath.Join(d.root, id+".json")
+}
+
+func (d *Dir) read(path string) (*pipeline.Run, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archived run: %w", err)
+	}
+	var run pipeline.Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to decode archived run %s: %w", filepath.Base(path), err)
+	}
+	return &run, nil
+}
+
+// Tiered keeps recent runs in a fast hot store and moves finished runs older
+// than MaxAge into an archive store. Reads fall back to the archive, so the
+// history API sees one store while the hot store stays small.
+//
+// A run is written to the archive before it is removed from the hot store,
+// so it is always readable from at least one of them.
+type Tiered struct {
+	hot      Pruner
+	archive  Store
+	maxAge   time.Duration
+	interval time.Duration
+	logger   *logrus.Logger
+	clock    clock.Clock
+}
+
+// NewTiered combines hot and archive with the policy configured by cfg. A
+// nil clk is the wall clock.
+func NewTiered(hot Pruner, archive Store, cfg config.ArchiveConfig, clk clock.Clock, logger *logrus.Logger) *Tiered {
+	t := &Tiered{
+		hot:      hot,
+		archive:  archive,
+		maxAge:   cfg.MaxAge,
+		interval: cfg.Interval,
+		logger:   logger,
+		clock:    clock.Or(clk),
+	}
+	if t.maxAge <= 0 {
+		t.maxAge = DefaultArchiveMaxAge
+	}
+	if t.interval <= 0 {
+		t.interval = DefaultArchiveInterval
+	}
+	return t
+}
+
+// SaveRun implements Store. Runs are always saved to the hot store.
+func (t *Tiered) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	return t.hot.SaveRun(ctx, run)
+}
+
+// SaveRuns implements Store.
+func (t *Tiered) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	return t.hot.SaveRuns(ctx, runs)
+}
+
+// GetRun implements Store.
+func (t *Tiered) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	run, err := t.hot.GetRun(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return t.archive.GetRun(ctx, id)
+	}
+	return run, err
+}
+
+// ListRuns implements Store. The archive is only consulted when it could hold
+// runs that belong in the result: archived runs finished, and so were
+// created, before the archive cutoff.
+func (t *Tiered) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	if !t.consultArchive(opts) {
+		return t.hot.ListRuns(ctx, opts)
+	}
+	// The page can only be cut from the merge of both tiers, so each
+	// lists everything up to its end.
+	tier := opts
+	tier.Offset = 0
+	if opts.Limit > 0 {
+		tier.Limit = opts.Offset + opts.Limit
+	}
+	hot, err := t.hot.ListRuns(ctx, tier)
+	if err != nil {
+		return nil, err
+	}
+	if tier.Limit > 0 && len(hot) >= tier.Limit && hot[len(hot)-1].CreatedAt.After(t.cutoff()) {
+		return opts.page(hot), nil
+	}
+
+	cold, err := t.archive.ListRuns(ctx, tier)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(hot))
+	for _, run := range hot {
+		seen[run.ID] = true
+	}
+	out := hot
+	for _, run := range cold {
+		if !seen[run.ID] {
+			out = append(out, run)
+		}
+	}
+	sortNewestFirst(out)
+	return opts.page(out), nil
+}
+
+// CountRuns implements Store. A run counted while it is being archived may
+// be counted in both tiers.
+func (t *Tiered) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	n, err := t.hot.CountRuns(ctx, opts)
+	if err != nil || !t.consultArchive(opts) {
+		return n, err
+	}
+	cold, err := t.archive.CountRuns(ctx, opts)
+	return n + cold, err
+}
+
+// consultArchive reports whether opts reaches back past the archive cutoff.
+func (t *Tiered) consultArchive(opts ListOptions) bool {
+	return opts.CreatedAfter.IsZero() || opts.CreatedAfter.Before(t.cutoff())
+}
+
+// Archive moves every finished run older than MaxAge from the hot store to
+// the archive and returns how many it moved.
+func (t *Tiered) Archive(ctx context.Context) (int, error) {
+	runs, err := t.hot.ListRuns(ctx, ListOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list runs to archive: %w", err)
+	}
+	cutoff := t.cutoff()
+	var due []*pipeline.Run
+	for _, run := range runs {
+		if run.Status.Terminal() && run.FinishedAt != nil && run.FinishedAt.Before(cutoff) {
+			due = append(due, run)
+		}
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	if err := t.archive.SaveRuns(ctx, due); err != nil {
+		return 0, fmt.Errorf("failed to archive runs: %w", err)
+	}
+	ids := make([]string, len(due))
+	for i, run := range due {
+		ids[i] = run.ID
+	}
+	if err := t.hot.DeleteRuns(ctx, ids); err != nil {
+		return 0, fmt.Errorf("failed to remove archived runs: %w", err)
+	}
+	metrics.RunsArchived.Add(float64(len(due)))
+	return len(due), nil
+}
+
+// Run archives due runs every Interval until ctx is done.
+func (t *Tiered) Run(ctx context.Context) {
+	ticker := t.clock.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		n, err := t.Archive(ctx)
+		if err != nil && ctx.Err() == nil {
+			t.logger.WithError(err).Error("Failed to archive finished runs")
+		} else if n > 0 {
+			t.logger.WithField("runs", n).Info("Archived finished runs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+func (t *Tiered) cutoff() time.Time {
+	return t.clock.Now().Add(-t.maxAge)
+}
+
+func sortNewestFirst(runs []*pipeline.Run) {
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].CreatedAt.Equal(runs[j].CreatedAt) {
+			return runs[i].CreatedAt.After(runs[j].CreatedAt)
+		}
+		return runs[i].ID < runs[j].ID
+	})
+}
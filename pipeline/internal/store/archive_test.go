@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/clock"
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func newTestTiered(t *testing.T, now time.Time) (*Tiered, *Memory, *Dir) {
+	t.Helper()
+	archive, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	hot := NewMemory()
+	tiered := NewTiered(hot, archive, config.ArchiveConfig{MaxAge: 24 * time.Hour}, clock.NewFake(now), logger)
+	return tiered, hot, archive
+}
+
+func TestTieredArchivesOldFinishedRuns(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tiered, hot, archive := newTestTiered(t, now)
+
+	at := func(d time.Duration) *time.Time { ts := now.Add(-d); return &ts }
+	runs := []*pipeline.Run{
+		{ID: "old-done", Status: pipeline.StatusSucceeded, CreatedAt: *at(72 * time.Hour), FinishedAt: at(48 * time.Hour)},
+		{ID: "old-running", Status: pipeline.StatusRunning, CreatedAt: *at(96 * time.Hour)},
+		{ID: "recent-done", Status: pipeline.StatusFailed, CreatedAt: *at(2 * time.Hour), FinishedAt: at(time.Hour)},
+	}
+	if err := tiered.SaveRuns(ctx, runs); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := tiered.Archive(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Archive() = %d, %v, want 1 run moved", n, err)
+	}
+	if _, err := hot.GetRun(ctx, "old-done"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("hot store still holds the archived run: %v", err)
+	}
+	if _, err := archive.GetRun(ctx, "old-done"); err != nil {
+		t.Fatalf("archive GetRun() error = %v", err)
+	}
+
+	run, err := tiered.GetRun(ctx, "old-done")
+	if err != nil || run.Status != pipeline.StatusSucceeded {
+		t.Fatalf("GetRun() = %v, %v, want the archived run", run, err)
+	}
+
+	all, err := tiered.ListRuns(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runIDs(all); !reflect.DeepEqual(got, []string{"recent-done", "old-done", "old-running"}) {
+		t.Fatalf("ListRuns() = %v, want hot and archived runs newest first", got)
+	}
+	limited, err := tiered.ListRuns(ctx, ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runIDs(limited); !reflect.DeepEqual(got, []string{"recent-done", "old-done"}) {
+		t.Fatalf("ListRuns(limit 2) = %v, want the archived run ahead of the older hot run", got)
+	}
+	paged, err := tiered.ListRuns(ctx, ListOptions{Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runIDs(paged); !reflect.DeepEqual(got, []string{"old-done"}) {
+		t.Fatalf("ListRuns(offset 1, limit 1) = %v, want the archived run", got)
+	}
+	if n, err := tiered.CountRuns(ctx, ListOptions{Limit: 1}); err != nil || n != 3 {
+		t.Fatalf("CountRuns() = %d, %v, want both tiers counted", n, err)
+	}
+}
+
+func TestTieredGetRunMissing(t *testing.T) {
+	tiered, _, _ := newTestTiered(t, time.Now())
+	for _, id := range []string{"missing", "../etc/passwd"} {
+		if _, err := tiered.GetRun(context.Background(), id); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("GetRun(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func runIDs(runs []*pipeline.Run) []string {
+	ids := make([]string, len(runs))
+	for i, run := range runs {
+		ids[i] = run.ID
+	}
+	return ids
+}
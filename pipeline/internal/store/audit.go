@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// SaveAIExchange records an AI exchange of the run with the given ID.
+func (s *SQL) SaveAIExchange(ctx context.Context, runID string, x pipeline.AIExchange) error {
+	_, err := s.db.ExecContext(ctx, s.db.Rebind(`INSERT INTO ai_exchanges
+	(run_id, endpoint, request, response, error, truncated, at) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		runID, x.Endpoint, x.Request, x.Response, x.Error, x.Truncated, s.db.Time(x.At))
+	if err != nil {
+		return fmt.Errorf("failed to save AI exchange of run %s: %w", runID, err)
+	}
+	return nil
+}
+
+// ListAIExchanges returns the AI exchanges recorded for the run with the
+// given ID, in the order they were made.
+func (s *SQL) ListAIExchanges(ctx context.Context, runID string) ([]pipeline.AIExchange, error) {
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(`SELECT endpoint, request, response, error, truncated, at
+	FROM ai_exchanges WHERE run_id = ? ORDER BY id`), runID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list AI exchanges of run %s: %w", runID, err)
+	}
+	defer rows.Close()
+	var out []pipeline.AIExchange
+	for rows.Next() {
+		var x pipeline.AIExchange
+		var at string
+		if err := rows.Scan(&x.Endpoint, &x.Request, &x.Response, &x.Error, &x.Truncated, &at); err != nil {
+			return nil, fmt.Errorf("failed to list AI exchanges of run %s: %w", runID, err)
+		}
+		if x.At, err = time.Parse(time.RFC3339Nano, at); err != nil {
+			return nil, fmt.Errorf("AI exchange of run %s has a malformed time %q", runID, at)
+		}
+		out = append(out, x)
+	}
+	return out, rows.Err()
+}
+
+// PurgeAIExchanges deletes the AI exchanges made before cutoff and returns
+// how many there were.
+func (s *SQL) PurgeAIExchanges(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(`DELETE FROM ai_exchanges WHERE at < ?`), s.db.Time(cutoff))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge AI exchanges: %w", err)
+	}
+	return res.RowsAffected()
+}
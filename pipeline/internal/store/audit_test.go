@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestSQLiteAIExchanges(t *testing.T) {
+	testSQLAIExchanges(t, newTestSQL(t, config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "runs.db")}))
+}
+
+// testSQLAIExchanges runs the AI exchange tests against s, which must hold
+// no exchanges.
+func testSQLAIExchanges(t *testing.T, s *SQL) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for _, x := range []struct {
+		run string
+		x   pipeline.AIExchange
+	}{
+		{"run-1", pipeline.AIExchange{Endpoint: "/predict", Request: `{"a":1}`, Response: `{"b":2}`, At: now.Add(-48 * time.Hour)}},
+		{"run-1", pipeline.AIExchange{Endpoint: "/select", Request: `{"c":3}`, Error: "ai service unavailable", Truncated: true, At: now}},
+		{"run-2", pipeline.AIExchange{Endpoint: "/optimize", Request: `{}`, At: now}},
+	} {
+		if err := s.SaveAIExchange(ctx, x.run, x.x); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.ListAIExchanges(ctx, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Endpoint != "/predict" || got[0].Response != `{"b":2}` || !got[1].Truncated || got[1].Error == "" || !got[1].At.Equal(now) {
+		t.Errorf("ListAIExchanges(run-1) = %+v", got)
+	}
+
+	n, err := s.PurgeAIExchanges(ctx, now.Add(-24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeAIExchanges() = %d, %v; want 1", n, err)
+	}
+	if got, err := s.ListAIExchanges(ctx, "run-1"); err != nil || len(got) != 1 || got[0].Endpoint != "/select" {
+		t.Errorf("after purging: ListAIExchanges(run-1) = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// ErrUnavailable is returned by a ReadBreaker while it sheds reads. Callers
+// should retry later.
+var ErrUnavailable = perrors.New(perrors.ErrUnavailable, "run store temporarily unavailable")
+
+const (
+	// DefaultReadFailureThreshold is used when
+	// database.read_breaker.failure_threshold is not set.
+	DefaultReadFailureThreshold = 5
+	// DefaultReadOpenDuration is used when
+	// database.read_breaker.open_duration is not set.
+	DefaultReadOpenDuration = 30 * time.Second
+
+	// maxStaleRuns bounds the last-known copies kept for ServeStale.
+	maxStaleRuns = 10000
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// ReadBreaker wraps a Store with a circuit breaker on its reads. After
+// FailureThreshold consecutive failed reads it sheds every read with
+// ErrUnavailable for OpenDuration, then lets a single probe through to decide
+// whether to close again. Writes always go straight to the wrapped store:
+// they are on the critical path of every run and are never shed.
+//
+// With ServeStale, GetRun answers from the last copy of the run it saw while
+// the breaker is open.
+type ReadBreaker struct {
+	next       Store
+	threshold  int
+	openFor    time.Duration
+	timeout    time.Duration
+	serveStale bool
+	now        func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+
+	staleMu sync.Mutex
+	stale   map[string]*pipeline.Run
+	order   []string
+}
+
+// NewReadBreaker wraps next with the breaker configured by cfg.
+func NewReadBreaker(next Store, cfg config.ReadBreakerConfig) *ReadBreaker {
+	b := &ReadBreaker{
+		next:       next,
+		threshold:  cfg.FailureThreshold,
+		openFor:    cfg.OpenDuration,
+		timeout:    cfg.Timeout,
+		serveStale: cfg.ServeStale,
+		now:        time.Now,
+		stale:      make(map[string]*pipeline.Run),
+	}
+	if b.threshold <= 0 {
+		b.threshold = DefaultReadFailureThreshold
+	}
+	if b.openFor <= 0 {
+		b.openFor = DefaultReadOpenDuration
+	}
+	return b
+}
+
+// SaveRun implements Store. It is never shed.
+func (b *ReadBreaker) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	if err := b.next.SaveRun(ctx, run); err != nil {
+		return err
+	}
+	b.remember(run)
+	return nil
+}
+
+// SaveRuns implements Store. It is never shed.
+func (b *ReadBreaker) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	if err := b.next.SaveRuns(ctx, runs); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		b.remember(run)
+	}
+	return nil
+}
+
+// GetRun implements Store.
+func (b *ReadBreaker) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	var run *pipeline.Run
+	err := b.read(ctx, func(ctx context.Context) error {
+		var err error
+		run, err = b.next.GetRun(ctx, id)
+		return err
+	})
+	if errors.Is(err, ErrUnavailable) && b.serveStale {
+		if cached := b.lastKnown(id); cached != nil {
+			metrics.StoreReadsShed.WithLabelValues("stale").Inc()
+			return cached, nil
+		}
+	}
+	if errors.Is(err, ErrUnavailable) {
+		metrics.StoreReadsShed.WithLabelValues("unavailable").Inc()
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.remember(run)
+	return run, nil
+}
+
+// ListRuns implements Store. Listings are never served stale because the
+// cache holds an arbitrary subset of runs.
+func (b *ReadBreaker) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	var runs []*pipeline.Run
+	err := b.read(ctx, func(ctx context.Context) error {
+		var err error
+		runs, err = b.next.ListRuns(ctx, opts)
+		return err
+	})
+	if errors.Is(err, ErrUnavailable) {
+		metrics.StoreReadsShed.WithLabelValues("unavailable").Inc()
+	}
+	return runs, err
+}
+
+// CountRuns implements Store like ListRuns.
+func (b *ReadBreaker) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	var n int
+	err := b.read(ctx, func(ctx context.Context) error {
+		var err error
+		n, err = b.next.CountRuns(ctx, opts)
+		return err
+	})
+	if errors.Is(err, ErrUnavailable) {
+		metrics.StoreReadsShed.WithLabelValues("unavailable").Inc()
+	}
+	return n, err
+}
+
+func (b *ReadBreaker) read(ctx context.Context, fn func(context.Context) error) error {
+	if !b.allow() {
+		return ErrUnavailable
+	}
+
+	callCtx := ctx
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+	err := fn(callCtx)
+	b.record(ctx, err)
+	return err
+}
+
+func (b *ReadBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.openFor {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a read. Missing runs are
+// answers, not failures, and reads abandoned by the caller say nothing about
+// the store's health.
+func (b *ReadBreaker) record(ctx context.Context, err error) {
+	failed := err != nil && !errors.Is(err, ErrNotFound) && ctx.Err() == nil
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+		if failed {
+			b.state = breakerOpen
+			b.openedAt = b.now()
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *ReadBreaker) remember(run *pipeline.Run) {
+	if !b.serveStale || run == nil {
+		return
+	}
+	b.staleMu.Lock()
+	defer b.staleMu.Unlock()
+
+	if _, ok := b.stale[run.ID]; !ok {
+		if len(b.order) >= maxStaleRuns {
+			delete(b.stale, b.order[0])
+			b.order = b.order[1:]
+		}
+		b.order = append(b.order, run.ID)
+	}
+	b.stale[run.ID] = run.Clone()
+}
+
+func (b *ReadBreaker) lastKnown(id string) *pipeline.Run {
+	b.staleMu.Lock()
+	defer b.staleMu.Unlock()
+	if run, ok := b.stale[id]; ok {
+		return run.Clone()
+	}
+	return nil
+}
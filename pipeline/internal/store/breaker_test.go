@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// flakyStore fails reads while failing is set.
+type flakyStore struct {
+	*Memory
+	failing bool
+	reads   int
+}
+
+func (f *flakyStore) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	f.reads++
+	if f.failing {
+		return nil, errors.New("too many connections")
+	}
+	return f.Memory.GetRun(ctx, id)
+}
+
+func (f *flakyStore) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	f.reads++
+	if f.failing {
+		return nil, errors.New("too many connections")
+	}
+	return f.Memory.ListRuns(ctx, opts)
+}
+
+func TestReadBreakerShedsReadsButNotWrites(t *testing.T) {
+	ctx := context.Background()
+	db := &flakyStore{Memory: NewMemory()}
+	b := NewReadBreaker(db, config.ReadBreakerConfig{FailureThreshold: 2, OpenDuration: time.Minute, ServeStale: true})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	if err := b.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetRun(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetRun(missing) error = %v, want ErrNotFound", err)
+	}
+
+	db.failing = true
+	for i := 0; i < 2; i++ {
+		if _, err := b.ListRuns(ctx, ListOptions{}); err == nil || errors.Is(err, ErrUnavailable) {
+			t.Fatalf("read %d error = %v, want the store error", i, err)
+		}
+	}
+
+	reads := db.reads
+	if _, err := b.ListRuns(ctx, ListOptions{}); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("ListRuns() error = %v, want ErrUnavailable", err)
+	}
+	run, err := b.GetRun(ctx, "a")
+	if err != nil || run.Status != pipeline.StatusRunning {
+		t.Fatalf("GetRun() = %v, %v, want the last known copy", run, err)
+	}
+	if db.reads != reads {
+		t.Fatalf("open breaker still queried the store")
+	}
+	if err := b.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusSucceeded}); err != nil {
+		t.Fatalf("SaveRun() error = %v while the breaker is open", err)
+	}
+
+	// After the open period a single successful probe closes the breaker.
+	db.failing = false
+	now = now.Add(time.Minute)
+	if run, err := b.GetRun(ctx, "a"); err != nil || run.Status != pipeline.StatusSucceeded {
+		t.Fatalf("probe GetRun() = %v, %v", run, err)
+	}
+	if _, err := b.ListRuns(ctx, ListOptions{}); err != nil {
+		t.Fatalf("ListRuns() after recovery error = %v", err)
+	}
+}
+
+func TestReadBreakerReopensOnFailedProbe(t *testing.T) {
+	ctx := context.Background()
+	db := &flakyStore{Memory: NewMemory(), failing: true}
+	b := NewReadBreaker(db, config.ReadBreakerConfig{FailureThreshold: 1, OpenDuration: time.Minute})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	b.GetRun(ctx, "a")
+	now = now.Add(time.Minute)
+	if _, err := b.GetRun(ctx, "a"); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("probe error = %v, want the store error", err)
+	}
+	if _, err := b.GetRun(ctx, "a"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("GetRun() after failed probe error = %v, want ErrUnavailable", err)
+	}
+}
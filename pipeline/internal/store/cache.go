@@ -0,0 +1,260 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	// DefaultCacheTTL is used when database.status_cache.ttl is not set.
+	DefaultCacheTTL = 2 * time.Second
+	// DefaultCacheTerminalTTL is used when
+	// database.status_cache.terminal_ttl is not set.
+	DefaultCacheTerminalTTL = time.Hour
+
+	// RunEventsChannel carries a RunEvent for every saved run state.
+	RunEventsChannel = "devmind:run:events"
+
+	cacheKeyPrefix = "devmind:run:"
+	eventKeyPrefix = "devmind:run:event:"
+
+	// maxLocalRuns bounds the in-process fallback cache.
+	maxLocalRuns = 10000
+)
+
+// RunEvent announces a state change of a run.
+type RunEvent struct {
+	// ID identifies the state announced: replicas that save the same state
+	// of a run publish events with the same ID, so subscribers can drop
+	// duplicates by ID.
+	ID     string          `json:"id"`
+	RunID  string          `json:"run_id"`
+	Status pipeline.Status `json:"status"`
+}
+
+// EventID returns the RunEvent ID of the current state of run, derived from
+// its status and the status of each stage and job.
+func EventID(run *pipeline.Run) string {
+	h := sha256.New()
+	write := func(parts ...string) {
+		for _, p := range parts {
+			h.Write([]byte(p))
+			h.Write([]byte{0})
+		}
+	}
+	write(run.ID, string(run.Status))
+	stages := append(append([]pipeline.StageResult(nil), run.Stages...), run.Finally...)
+	if run.PostRun != nil {
+		stages = append(stages, *run.PostRun)
+	}
+	for _, st := range stages {
+		write(st.Name, string(st.Status))
+		for _, j := range st.Jobs {
+			write(j.ID, string(j.Status))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Cache is a Redis read-through cache in front of a Store for single-run
+// status reads. Unfinished runs are cached for TTL only, since they change;
+// finished runs never change again and are kept for TerminalTTL.
+//
+// Every save evicts the cached copy and then publishes a RunEvent on
+// RunEventsChannel, so no replica keeps serving a state that was replaced.
+// With a dedup window, an event whose ID was already published within the
+// window is dropped, so a state observed by several replicas is announced
+// once. Redis failures never fail a read or a write: reads fall back to an
+// in-process cache with the same TTLs, and events are dropped.
+type Cache struct {
+	next        Store
+	client      redis.UniversalClient
+	ttl         time.Duration
+	terminalTTL time.Duration
+	dedup       time.Duration
+	logger      *logrus.Logger
+	now         func() time.Time
+
+	localMu sync.Mutex
+	local   map[string]localRun
+}
+
+type localRun struct {
+	run     *pipeline.Run
+	expires time.Time
+}
+
+// NewCache wraps next with the cache configured by cfg.
+func NewCache(next Store, client redis.UniversalClient, cfg config.StatusCacheConfig, logger *logrus.Logger) *Cache {
+	c := &Cache{
+		next:        next,
+		client:      client,
+		ttl:         cfg.TTL,
+		terminalTTL: cfg.TerminalTTL,
+		dedup:       cfg.EventDedupWindow,
+		logger:      logger,
+		now:         time.Now,
+		local:       make(map[string]localRun),
+	}
+	if c.ttl <= 0 {
+		c.ttl = DefaultCacheTTL
+	}
+	if c.terminalTTL <= 0 {
+		c.terminalTTL = DefaultCacheTerminalTTL
+	}
+	return c
+}
+
+// SaveRun implements Store.
+func (c *Cache) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	return c.SaveRuns(ctx, []*pipeline.Run{run})
+}
+
+// SaveRuns implements Store.
+func (c *Cache) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	if len(runs) == 1 {
+		if err := c.next.SaveRun(ctx, runs[0]); err != nil {
+			return err
+		}
+	} else if err := c.next.SaveRuns(ctx, runs); err != nil {
+		return err
+	}
+
+	keys := make([]string, len(runs))
+	c.localMu.Lock()
+	for i, run := range runs {
+		keys[i] = cacheKeyPrefix + run.ID
+		delete(c.local, run.ID)
+	}
+	c.localMu.Unlock()
+	if err := c.client.Del(ctx, keys...).Err(); err != nil {
+		logging.FromContext(ctx, c.logger).WithError(err).Warn("Failed to evict cached runs")
+	}
+	c.publish(ctx, runs)
+	return nil
+}
+
+// publish announces the saved state of runs on RunEventsChannel, claiming
+// each event ID for the dedup window first when one is configured. An
+// unreachable Redis publishes nothing either way.
+func (c *Cache) publish(ctx context.Context, runs []*pipeline.Run) {
+	events := make([]RunEvent, len(runs))
+	for i, run := range runs {
+		events[i] = RunEvent{ID: EventID(run), RunID: run.ID, Status: run.Status}
+	}
+
+	if c.dedup > 0 {
+		pipe := c.client.Pipeline()
+		claims := make([]*redis.BoolCmd, len(events))
+		for i, ev := range events {
+			claims[i] = pipe.SetNX(ctx, eventKeyPrefix+ev.ID, 1, c.dedup)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			logging.FromContext(ctx, c.logger).WithError(err).Debug("Failed to claim run events")
+			return
+		}
+		fresh := events[:0]
+		for i, ev := range events {
+			if claims[i].Val() {
+				fresh = append(fresh, ev)
+			} else {
+				metrics.RunEventsDeduplicated.Inc()
+			}
+		}
+		events = fresh
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	pipe := c.client.Pipeline()
+	for _, ev := range events {
+		payload, _ := json.Marshal(ev)
+		pipe.Publish(ctx, RunEventsChannel, payload)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.FromContext(ctx, c.logger).WithError(err).Debug("Failed to publish run events")
+	}
+}
+
+// GetRun implements Store.
+func (c *Cache) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	key := cacheKeyPrefix + id
+	data, err := c.client.Get(ctx, key).Bytes()
+	down := err != nil && !errors.Is(err, redis.Nil)
+	if err == nil {
+		var run pipeline.Run
+		if err := json.Unmarshal(data, &run); err == nil {
+			metrics.StatusCacheRequests.WithLabelValues("hit").Inc()
+			return &run, nil
+		}
+	} else if down {
+		if run := c.getLocal(id); run != nil {
+			metrics.StatusCacheRequests.WithLabelValues("local_hit").Inc()
+			return run, nil
+		}
+		logging.FromContext(ctx, c.logger).WithError(err).Debug("Status cache unavailable, reading through")
+	}
+	metrics.StatusCacheRequests.WithLabelValues("miss").Inc()
+
+	run, err := c.next.GetRun(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	ttl := c.ttl
+	if run.Status.Terminal() {
+		ttl = c.terminalTTL
+	}
+	if down {
+		c.setLocal(run, ttl)
+		return run, nil
+	}
+	if data, err := json.Marshal(run); err == nil {
+		if err := c.client.Set(ctx, key, data, ttl).Err(); err != nil {
+			logging.FromContext(ctx, c.logger).WithError(err).Debug("Failed to cache run")
+		}
+	}
+	return run, nil
+}
+
+func (c *Cache) getLocal(id string) *pipeline.Run {
+	c.localMu.Lock()
+	defer c.localMu.Unlock()
+	e, ok := c.local[id]
+	if !ok || !c.now().Before(e.expires) {
+		return nil
+	}
+	return e.run.Clone()
+}
+
+func (c *Cache) setLocal(run *pipeline.Run, ttl time.Duration) {
+	c.localMu.Lock()
+	defer c.localMu.Unlock()
+	if len(c.local) >= maxLocalRuns {
+		c.local = make(map[string]localRun)
+	}
+	c.local[run.ID] = localRun{run: run.Clone(), expires: c.now().Add(ttl)}
+}
+
+// ListRuns implements Store. Listings are not cached.
+func (c *Cache) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	return c.next.ListRuns(ctx, opts)
+}
+
+// CountRuns implements Store. Counts are not cached.
+func (c *Cache) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	return c.next.CountRuns(ctx, opts)
+}
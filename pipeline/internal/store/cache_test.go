@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// countingReads counts reads reaching the wrapped store.
+type countingReads struct {
+	*Memory
+	reads int
+}
+
+func (c *countingReads) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	c.reads++
+	return c.Memory.GetRun(ctx, id)
+}
+
+func newTestCache(t *testing.T) (*Cache, *countingReads, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	db := &countingReads{Memory: NewMemory()}
+	cfg := config.StatusCacheConfig{TTL: 2 * time.Second, TerminalTTL: time.Hour}
+	return NewCache(db, client, cfg, logger), db, mr
+}
+
+func TestCacheServesRepeatedPolls(t *testing.T) {
+	ctx := context.Background()
+	c, db, mr := newTestCache(t)
+
+	if err := c.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		run, err := c.GetRun(ctx, "a")
+		if err != nil || run.Status != pipeline.StatusRunning {
+			t.Fatalf("GetRun() = %v, %v", run, err)
+		}
+	}
+	if db.reads != 1 {
+		t.Fatalf("store read %d times, want 1", db.reads)
+	}
+	if ttl := mr.TTL(cacheKeyPrefix + "a"); ttl != 2*time.Second {
+		t.Errorf("running run cached for %s, want 2s", ttl)
+	}
+
+	// A state change evicts the cached copy.
+	if err := c.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+	run, err := c.GetRun(ctx, "a")
+	if err != nil || run.Status != pipeline.StatusSucceeded {
+		t.Fatalf("GetRun() after save = %v, %v", run, err)
+	}
+	if ttl := mr.TTL(cacheKeyPrefix + "a"); ttl != time.Hour {
+		t.Errorf("finished run cached for %s, want 1h", ttl)
+	}
+}
+
+func TestCacheReadsThroughWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	c, db, mr := newTestCache(t)
+	if err := db.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	mr.Close()
+
+	if _, err := c.GetRun(ctx, "a"); err != nil {
+		t.Fatalf("GetRun() error = %v with redis down", err)
+	}
+	if err := c.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusFailed}); err != nil {
+		t.Fatalf("SaveRun() error = %v with redis down", err)
+	}
+}
+
+func TestCacheDeduplicatesEventsAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg := config.StatusCacheConfig{EventDedupWindow: time.Minute}
+	replica := func() *Cache {
+		client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewCache(NewMemory(), client, cfg, logger)
+	}
+	a, b := replica(), replica()
+
+	sub := redis.NewClient(&redis.Options{Addr: mr.Addr()}).Subscribe(ctx, RunEventsChannel)
+	t.Cleanup(func() { sub.Close() })
+	if _, err := sub.Receive(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	running := &pipeline.Run{ID: "r", Status: pipeline.StatusRunning}
+	for _, c := range []*Cache{a, b, a} {
+		if err := c.SaveRun(ctx, running); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.SaveRun(ctx, &pipeline.Run{ID: "r", Status: pipeline.StatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []RunEvent
+	for len(got) < 2 {
+		msg, err := sub.ReceiveTimeout(ctx, time.Second)
+		if err != nil {
+			t.Fatalf("received %v, then %v", got, err)
+		}
+		var ev RunEvent
+		if err := json.Unmarshal([]byte(msg.(*redis.Message).Payload), &ev); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ev)
+	}
+	if got[0].Status != pipeline.StatusRunning || got[1].Status != pipeline.StatusSucceeded || got[0].ID == got[1].ID {
+		t.Fatalf("events = %+v, want one per distinct state", got)
+	}
+	if msg, err := sub.ReceiveTimeout(ctx, 100*time.Millisecond); err == nil {
+		t.Fatalf("unexpected duplicate event %v", msg)
+	}
+}
+
+func TestCacheFallsBackToMemoryWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	c, db, mr := newTestCache(t)
+	if err := db.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusRunning}); err != nil {
+		t.Fatal(err)
+	}
+	mr.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetRun(ctx, "a"); err != nil {
+			t.Fatalf("GetRun() error = %v with redis down", err)
+		}
+	}
+	if db.reads != 1 {
+		t.Fatalf("store read %d times with redis down, want 1", db.reads)
+	}
+
+	// Saves evict the in-process copy too.
+	if err := c.SaveRun(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+	run, err := c.GetRun(ctx, "a")
+	if err != nil || run.Status != pipeline.StatusSucceeded {
+		t.Fatalf("GetRun() after save = %v, %v", run, err)
+	}
+}
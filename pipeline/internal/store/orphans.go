@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// orphansKey is the Redis hash of orphaned runs, by run ID.
+const orphansKey = "devmind:run:orphaned"
+
+// claimOrphanScript takes a run out of the ledger if it is still recorded
+// as read, so that of several replicas claiming at once only one gets it.
+var claimOrphanScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("HDEL", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+// OrphanLedger keeps the runs a replica left behind at shutdown in Redis,
+// where whichever replica starts next finds them; the run store of the
+// replica that recorded them is gone with its process.
+type OrphanLedger struct {
+	client *redis.Client
+}
+
+// NewOrphanLedger returns a ledger kept in client.
+func NewOrphanLedger(client *redis.Client) *OrphanLedger {
+	return &OrphanLedger{client: client}
+}
+
+// Record adds run to the ledger.
+func (l *OrphanLedger) Record(ctx context.Context, run *pipeline.Run) error {
+	b, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	if err := l.client.HSet(ctx, orphansKey, run.ID, b).Err(); err != nil {
+		return fmt.Errorf("failed to record orphaned run: %w", err)
+	}
+	return nil
+}
+
+// Claim takes every run out of the ledger and returns them. Runs another
+// replica claimed first are not returned. Entries that cannot be decoded
+// are left in the ledger and reported in the error, along with the runs
+// that could be claimed.
+func (l *OrphanLedger) Claim(ctx context.Context) ([]*pipeline.Run, error) {
+	entries, err := l.client.HGetAll(ctx, orphansKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orphaned runs: %w", err)
+	}
+	var runs []*pipeline.Run
+	var errs []error
+	for id, b := range entries {
+		var run pipeline.Run
+		if err := json.Unmarshal([]byte(b), &run); err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode orphaned run %s: %w", id, err))
+			continue
+		}
+		claimed, err := claimOrphanScript.Run(ctx, l.client, []string{orphansKey}, id, b).Int()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to claim orphaned run %s: %w", id, err))
+			continue
+		}
+		if claimed == 1 {
+			runs = append(runs, &run)
+		}
+	}
+	return runs, errors.Join(errs...)
+}
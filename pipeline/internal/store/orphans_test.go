@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestOrphanLedgerClaimsEachRunOnce(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	l := NewOrphanLedger(client)
+
+	for _, id := range []string{"a", "b"} {
+		if err := l.Record(ctx, &pipeline.Run{ID: id, Status: pipeline.StatusOrphaned}); err != nil {
+			t.Fatalf("Record(%s) error = %v", id, err)
+		}
+	}
+	runs, err := l.Claim(ctx)
+	if err != nil {
+		t.Fatalf("Claim() error = %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("Claim() = %d runs, want 2", len(runs))
+	}
+	for _, run := range runs {
+		if run.Status != pipeline.StatusOrphaned {
+			t.Errorf("run %s: status = %s, want %s", run.ID, run.Status, pipeline.StatusOrphaned)
+		}
+	}
+	if runs, err := NewOrphanLedger(client).Claim(ctx); err != nil || len(runs) != 0 {
+		t.Errorf("second Claim() = %d runs, %v; want none", len(runs), err)
+	}
+}
+
+func TestOrphanLedgerKeepsUndecodableRuns(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	l := NewOrphanLedger(client)
+
+	if err := l.Record(ctx, &pipeline.Run{ID: "a", Status: pipeline.StatusOrphaned}); err != nil {
+		t.Fatal(err)
+	}
+	mr.HSet(orphansKey, "b", "{not json")
+
+	runs, err := l.Claim(ctx)
+	if err == nil {
+		t.Error("Claim() error = nil, want the undecodable run reported")
+	}
+	if len(runs) != 1 || runs[0].ID != "a" {
+		t.Fatalf("Claim() = %v, want run a", runs)
+	}
+	if got := mr.HGet(orphansKey, "b"); got != "{not json" {
+		t.Errorf("undecodable entry = %q, want it left in the ledger", got)
+	}
+}
@@ -0,0 +1,176 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// Operation classes of database.pool_partitions.
+const (
+	// PoolWrite is SaveRun and SaveRuns: run state, on the critical path of
+	// every run.
+	PoolWrite = "write"
+	// PoolRead is GetRun: status lookups.
+	PoolRead = "read"
+	// PoolList is ListRuns and CountRuns: history listings and stats.
+	PoolList = "list"
+)
+
+var poolClasses = []string{PoolWrite, PoolRead, PoolList}
+
+// Pool wraps a Store with a connection budget of database.pool_size,
+// partitioned by operation class. A partition may reserve connections that
+// no other class can take, and cap how many it holds itself, so a burst of
+// history reads cannot take the connections status writes need. Operations
+// wait for a connection until their context is done.
+type Pool struct {
+	next Store
+	size int
+
+	mu    sync.Mutex
+	inUse int
+	parts map[string]*poolPartition
+	// freed is closed and replaced whenever a connection is returned.
+	freed chan struct{}
+}
+
+type poolPartition struct {
+	reserved int
+	max      int
+	inUse    int
+}
+
+// NewPool wraps next with a pool of size connections split by partitions.
+// A size of zero leaves the pool unbounded, so only the partitions' caps
+// apply.
+func NewPool(next Store, size int, partitions map[string]config.PoolPartitionConfig) *Pool {
+	p := &Pool{
+		next:  next,
+		size:  size,
+		parts: make(map[string]*poolPartition, len(poolClasses)),
+		freed: make(chan struct{}),
+	}
+	for _, class := range poolClasses {
+		cfg := partitions[class]
+		p.parts[class] = &poolPartition{reserved: cfg.Reserved, max: cfg.Max}
+		metrics.StorePoolInUse.WithLabelValues(class).Set(0)
+	}
+	return p
+}
+
+// SaveRun implements Store as a write.
+func (p *Pool) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	release, err := p.acquire(ctx, PoolWrite)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.next.SaveRun(ctx, run)
+}
+
+// SaveRuns implements Store as a write.
+func (p *Pool) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	release, err := p.acquire(ctx, PoolWrite)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return p.next.SaveRuns(ctx, runs)
+}
+
+// GetRun implements Store as a read.
+func (p *Pool) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	release, err := p.acquire(ctx, PoolRead)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.next.GetRun(ctx, id)
+}
+
+// ListRuns implements Store as a list.
+func (p *Pool) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	release, err := p.acquire(ctx, PoolList)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return p.next.ListRuns(ctx, opts)
+}
+
+// CountRuns implements Store as a list.
+func (p *Pool) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	release, err := p.acquire(ctx, PoolList)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return p.next.CountRuns(ctx, opts)
+}
+
+// acquire takes a connection for class, waiting for one until ctx is done,
+// and returns the function that gives it back.
+func (p *Pool) acquire(ctx context.Context, class string) (func(), error) {
+	part := p.parts[class]
+	var waitStart time.Time
+	for {
+		p.mu.Lock()
+		if p.availableLocked(part) {
+			part.inUse++
+			p.inUse++
+			p.mu.Unlock()
+			metrics.StorePoolInUse.WithLabelValues(class).Inc()
+			if !waitStart.IsZero() {
+				metrics.StorePoolWait.WithLabelValues(class).Observe(time.Since(waitStart).Seconds())
+			}
+			return func() { p.release(class, part) }, nil
+		}
+		freed := p.freed
+		p.mu.Unlock()
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+			metrics.StorePoolWaits.WithLabelValues(class).Inc()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to get a %s connection from the pool: %w", class, ctx.Err())
+		case <-freed:
+		}
+	}
+}
+
+// availableLocked reports whether part may take a connection: it is below
+// its cap, and one is left once the unused reservations of the other
+// partitions are set aside.
+func (p *Pool) availableLocked(part *poolPartition) bool {
+	if part.max > 0 && part.inUse >= part.max {
+		return false
+	}
+	if p.size <= 0 {
+		return true
+	}
+	held := 0
+	for _, other := range p.parts {
+		if other != part && other.inUse < other.reserved {
+			held += other.reserved - other.inUse
+		}
+	}
+	return p.inUse+held < p.size
+}
+
+func (p *Pool) release(class string, part *poolPartition) {
+	p.mu.Lock()
+	part.inUse--
+	p.inUse--
+	close(p.freed)
+	p.freed = make(chan struct{})
+	p.mu.Unlock()
+	metrics.StorePoolInUse.WithLabelValues(class).Dec()
+}
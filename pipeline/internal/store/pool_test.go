@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// slowListStore holds every ListRuns until release is closed.
+type slowListStore struct {
+	*Memory
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (s *slowListStore) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	s.listing <- struct{}{}
+	<-s.release
+	return s.Memory.ListRuns(ctx, opts)
+}
+
+func TestPoolKeepsReservedConnectionsForWrites(t *testing.T) {
+	db := &slowListStore{Memory: NewMemory(), listing: make(chan struct{}, 3), release: make(chan struct{})}
+	p := NewPool(db, 3, map[string]config.PoolPartitionConfig{
+		PoolWrite: {Reserved: 1},
+		PoolList:  {Max: 2},
+	})
+
+	listed := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := p.ListRuns(context.Background(), ListOptions{})
+			listed <- err
+		}()
+	}
+	<-db.listing
+	<-db.listing
+	if got := testutil.ToFloat64(metrics.StorePoolInUse.WithLabelValues(PoolList)); got != 2 {
+		t.Errorf("list connections in use = %v, want 2", got)
+	}
+
+	// The lists hold two connections and the third is the writes' own.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetRun(ctx, "run-1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetRun() with the pool exhausted = %v, want a timeout", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.SaveRun(ctx, &pipeline.Run{ID: "run-1"}); err != nil {
+		t.Errorf("SaveRun() with reads exhausting the pool = %v, want it to use its reserve", err)
+	}
+
+	select {
+	case <-db.listing:
+		t.Fatal("third list ran beyond the list cap")
+	default:
+	}
+	close(db.release)
+	for i := 0; i < 3; i++ {
+		if err := <-listed; err != nil {
+			t.Errorf("ListRuns() error = %v", err)
+		}
+	}
+	if _, err := p.GetRun(context.Background(), "run-1"); err != nil {
+		t.Errorf("GetRun() once the lists finished = %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+
+	"github.com/devmind-pipeline/pipeline/internal/database"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// SQL is a Store that keeps runs in a PostgreSQL or SQLite database. A run
+// is stored as a JSON document next to the columns it is filtered and
+// ordered by; label selectors are matched against the document's labels.
+type SQL struct {
+	db *database.DB
+}
+
+// NewSQL creates a store over db, whose schema must already exist.
+func NewSQL(db *database.DB) *SQL {
+	return &SQL{db: db}
+}
+
+const upsertRun = `INSERT INTO pipelines
+	(id, name, repo, branch, commit_sha, triggered_by, status, created_at, started_at, finished_at, run)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+	name = excluded.name, repo = excluded.repo, branch = excluded.branch,
+	commit_sha = excluded.commit_sha, triggered_by = excluded.triggered_by,
+	status = excluded.status, created_at = excluded.created_at,
+	started_at = excluded.started_at, finished_at = excluded.finished_at,
+	run = excluded.run`
+
+// execer is what SaveRun and SaveRuns write through: the database or a
+// transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// SaveRun stores run, replacing any previous version.
+func (s *SQL) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	return s.save(ctx, s.db, run)
+}
+
+// SaveRuns stores runs in one transaction.
+func (s *SQL) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin saving runs: %w", err)
+	}
+	defer tx.Rollback()
+	for _, run := range runs {
+		if err := s.save(ctx, tx, run); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save runs: %w", err)
+	}
+	return nil
+}
+
+func (s *SQL) save(ctx context.Context, ex execer, run *pipeline.Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to encode run %s: %w", run.ID, err)
+	}
+	var started, finished interface{}
+	if run.StartedAt != nil {
+		started = s.db.Time(*run.StartedAt)
+	}
+	if run.FinishedAt != nil {
+		finished = s.db.Time(*run.FinishedAt)
+	}
+	_, err = ex.ExecContext(ctx, s.db.Rebind(upsertRun),
+		run.ID, run.Spec.Name, run.Spec.Repo, run.Spec.Branch, run.Spec.Commit, run.TriggeredBy,
+		string(run.Status), s.db.Time(run.CreatedAt), started, finished, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// GetRun returns the run with the given ID.
+func (s *SQL) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	var data []byte
+	err := s.db.QueryRowContext(ctx, s.db.Rebind(`SELECT run FROM pipelines WHERE id = ?`), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run %s: %w", id, err)
+	}
+	return decodeRun(id, data)
+}
+
+// ListRuns returns the runs matching opts, newest first.
+func (s *SQL) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	where, args := s.where(opts)
+	query := "SELECT id, run FROM pipelines" + where + " ORDER BY created_at DESC, id"
+	if opts.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+	if opts.Offset > 0 {
+		if opts.Limit <= 0 && s.db.Type == database.SQLite {
+			// SQLite only takes an OFFSET after a LIMIT.
+			query += " LIMIT -1"
+		}
+		query += " OFFSET ?"
+		args = append(args, opts.Offset)
+	}
+	rows, err := s.db.QueryContext(ctx, s.db.Rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var out []*pipeline.Run
+	for rows.Next() {
+		var id string
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, fmt.Errorf("failed to list runs: %w", err)
+		}
+		run, err := decodeRun(id, data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return out, nil
+}
+
+// CountRuns returns how many runs match opts.
+func (s *SQL) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	where, args := s.where(opts)
+	var n int
+	if err := s.db.QueryRowContext(ctx, s.db.Rebind("SELECT COUNT(*) FROM pipelines"+where), args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count runs: %w", err)
+	}
+	return n, nil
+}
+
+// where is the WHERE clause of every condition of opts.
+func (s *SQL) where(opts ListOptions) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if !opts.CreatedAfter.IsZero() {
+		where = append(where, "created_at > ?")
+		args = append(args, s.db.Time(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, s.db.Time(opts.CreatedBefore))
+	}
+	if opts.Repo != "" {
+		where = append(where, "repo = ?")
+		args = append(args, opts.Repo)
+	}
+	if opts.Branch != "" {
+		where = append(where, "branch = ?")
+		args = append(args, opts.Branch)
+	}
+	if len(opts.Statuses) > 0 {
+		where = append(where, "status IN ("+placeholders(len(opts.Statuses))+")")
+		for _, st := range opts.Statuses {
+			args = append(args, string(st))
+		}
+	}
+	if opts.Selector != nil {
+		conds, condArgs := s.selector(opts.Selector)
+		where, args = append(where, conds...), append(args, condArgs...)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// selector returns the conditions of the requirements of sel, with the
+// semantics of labels.Selector.Matches: a label a run lacks only satisfies
+// !=, notin and !.
+func (s *SQL) selector(sel labels.Selector) ([]string, []interface{}) {
+	reqs, selectable := sel.Requirements()
+	if !selectable {
+		return []string{"1 = 0"}, nil
+	}
+	var conds []string
+	var args []interface{}
+	for _, req := range reqs {
+		label := s.label(req.Key())
+		values := req.Values().List()
+		switch req.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+			conds = append(conds, label+" IN ("+placeholders(len(values))+")")
+		case selection.NotEquals, selection.NotIn:
+			conds = append(conds, "("+label+" IS NULL OR "+label+" NOT IN ("+placeholders(len(values))+"))")
+		case selection.Exists:
+			conds, values = append(conds, label+" IS NOT NULL"), nil
+		case selection.DoesNotExist:
+			conds, values = append(conds, label+" IS NULL"), nil
+		case selection.GreaterThan, selection.LessThan:
+			op := " > ?"
+			if req.Operator() == selection.LessThan {
+				op = " < ?"
+			}
+			// labels.Parse checked the value is an integer.
+			n, _ := strconv.ParseInt(values[0], 10, 64)
+			conds, args = append(conds, s.integer(label)+op), append(args, n)
+			continue
+		default:
+			return []string{"1 = 0"}, nil
+		}
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	return conds, args
+}
+
+// label is the expression of the value of a spec label, NULL for a run
+// without it. The key is inlined: labels.Parse only accepts qualified
+// names, which never contain a quote.
+func (s *SQL) label(key string) string {
+	if s.db.Type == database.SQLite {
+		return `json_extract(run, '$.spec.labels."` + key + `"')`
+	}
+	return `(run->'spec'->'labels'->>'` + key + `')`
+}
+
+// integer is the expression of label as an integer, NULL unless it is one:
+// gt and lt never match other values.
+func (s *SQL) integer(label string) string {
+	if s.db.Type == database.SQLite {
+		digits := "ltrim(" + label + ", '+-')"
+		return "CASE WHEN length(" + label + ") - length(" + digits + ") <= 1 AND " + digits + " <> '' AND " +
+			digits + " NOT GLOB '*[^0-9]*' THEN CAST(" + label + " AS INTEGER) END"
+	}
+	return "CASE WHEN " + label + " ~ '^[+-]?[0-9]{1,18}$' THEN CAST(" + label + " AS BIGINT) END"
+}
+
+// DeleteRuns removes the runs with the given IDs, ignoring unknown ones.
+func (s *SQL) DeleteRuns(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := s.db.Rebind("DELETE FROM pipelines WHERE id IN (" + placeholders(len(ids)) + ")")
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete runs: %w", err)
+	}
+	return nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func decodeRun(id string, data []byte) (*pipeline.Run, error) {
+	var run pipeline.Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to decode run %s: %w", id, err)
+	}
+	return &run, nil
+}
@@ -0,0 +1,47 @@
+//go:build postgres
+
+package store
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+// TestPostgresStore needs a disposable PostgreSQL database, given by the
+// PIPELINE_TEST_POSTGRES_* variables; its tables are emptied:
+//
+//	PIPELINE_TEST_POSTGRES_HOST=localhost go test -tags postgres ./internal/store
+func TestPostgresStore(t *testing.T) {
+	host := os.Getenv("PIPELINE_TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("PIPELINE_TEST_POSTGRES_HOST is not set")
+	}
+	port, _ := strconv.Atoi(os.Getenv("PIPELINE_TEST_POSTGRES_PORT"))
+	s := newTestSQL(t, config.DatabaseConfig{
+		Type:     "postgresql",
+		Host:     host,
+		Port:     port,
+		Name:     envOr("PIPELINE_TEST_POSTGRES_DB", "postgres"),
+		User:     envOr("PIPELINE_TEST_POSTGRES_USER", "postgres"),
+		Password: os.Getenv("PIPELINE_TEST_POSTGRES_PASSWORD"),
+		SSLMode:  "disable",
+	})
+	for _, table := range []string{"pipelines", "ai_exchanges"} {
+		if _, err := s.db.ExecContext(context.Background(), "DELETE FROM "+table); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testSQLStore(t, s)
+	testSQLAIExchanges(t, s)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
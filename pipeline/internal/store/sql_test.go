@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/database"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func newTestSQL(t *testing.T, cfg config.DatabaseConfig) *SQL {
+	t.Helper()
+	db, err := database.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQL(db)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testSQLStore(t, newTestSQL(t, config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "runs.db")}))
+}
+
+// testSQLStore runs the SQL store tests against s, which must be empty.
+func testSQLStore(t *testing.T, s *SQL) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+	var ids []string
+	for i, r := range []struct {
+		repo, branch string
+		status       pipeline.Status
+		labels       map[string]string
+	}{
+		{"org/api", "main", pipeline.StatusSucceeded, map[string]string{"team": "payments", "shard": "2"}},
+		{"org/api", "main", pipeline.StatusFailed, map[string]string{"team": "search", "shard": "10"}},
+		{"org/api", "dev", pipeline.StatusFailed, map[string]string{"team": "payments", "shard": "1x"}},
+		{"org/web", "main", pipeline.StatusRunning, nil},
+	} {
+		started := now.Add(time.Duration(i) * time.Minute)
+		run := &pipeline.Run{
+			ID:        string(rune('a' + i)),
+			Spec:      pipeline.Spec{Name: "p", Repo: r.repo, Branch: r.branch, Labels: r.labels},
+			Status:    pipeline.StatusPending,
+			Stages:    []pipeline.StageResult{{Name: "build", Status: r.status}},
+			CreatedAt: started,
+			StartedAt: &started,
+		}
+		if err := s.SaveRun(ctx, run); err != nil {
+			t.Fatal(err)
+		}
+		run.Status = r.status
+		if err := s.SaveRuns(ctx, []*pipeline.Run{run}); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, run.ID)
+	}
+
+	got, err := s.GetRun(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != pipeline.StatusFailed || len(got.Stages) != 1 || !got.CreatedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("GetRun(b) = %+v, want the failed run with its stage", got)
+	}
+	if _, err := s.GetRun(ctx, "z"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRun(z) error = %v, want ErrNotFound", err)
+	}
+
+	team, _ := labels.Parse("team=payments")
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		{"all", ListOptions{}, []string{"d", "c", "b", "a"}},
+		{"limit", ListOptions{Limit: 2}, []string{"d", "c"}},
+		{"repo and branch", ListOptions{Repo: "org/api", Branch: "main"}, []string{"b", "a"}},
+		{"statuses", ListOptions{Statuses: []pipeline.Status{pipeline.StatusFailed, pipeline.StatusRunning}}, []string{"d", "c", "b"}},
+		{"created window", ListOptions{CreatedAfter: now, CreatedBefore: now.Add(3 * time.Minute)}, []string{"c", "b"}},
+		{"selector and limit", ListOptions{Selector: team, Limit: 1}, []string{"c"}},
+		{"page", ListOptions{Offset: 1, Limit: 2}, []string{"c", "b"}},
+		{"offset", ListOptions{Offset: 3}, []string{"a"}},
+		{"selector and offset", ListOptions{Selector: team, Offset: 1}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		runs, err := s.ListRuns(ctx, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := runIDs(runs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ListRuns() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Selectors are matched in the database exactly as in memory.
+	all, err := s.ListRuns(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expr := range []string{"team=payments", "team!=payments", "team in (payments,search)", "team notin (search)", "team", "!team", "shard>3", "shard<3", "team=payments,shard<5"} {
+		sel, err := labels.Parse(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for _, run := range all {
+			if sel.Matches(labels.Set(run.Spec.Labels)) {
+				want = append(want, run.ID)
+			}
+		}
+		runs, err := s.ListRuns(ctx, ListOptions{Selector: sel})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := runIDs(runs); !reflect.DeepEqual(got, want) {
+			t.Errorf("ListRuns(%s) = %v, want %v", expr, got, want)
+		}
+		if n, err := s.CountRuns(ctx, ListOptions{Selector: sel}); err != nil || n != len(want) {
+			t.Errorf("CountRuns(%s) = %d, %v; want %d", expr, n, err, len(want))
+		}
+	}
+
+	for _, tt := range []struct {
+		opts ListOptions
+		want int
+	}{
+		{ListOptions{Limit: 1, Offset: 1}, 4},
+		{ListOptions{Repo: "org/api"}, 3},
+		{ListOptions{Selector: team}, 2},
+	} {
+		if n, err := s.CountRuns(ctx, tt.opts); err != nil || n != tt.want {
+			t.Errorf("CountRuns(%+v) = %d, %v; want %d", tt.opts, n, err, tt.want)
+		}
+	}
+
+	if err := s.DeleteRuns(ctx, []string{"a", "c", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := s.ListRuns(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := runIDs(runs); !reflect.DeepEqual(got, []string{"d", "b"}) {
+		t.Errorf("after DeleteRuns: ListRuns() = %v, want [d b]", got)
+	}
+}
+
+func TestSQLiteStoreKeepsRunsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DatabaseConfig{Type: "sqlite", Path: filepath.Join(t.TempDir(), "runs.db")}
+	first := newTestSQL(t, cfg)
+	if err := first.SaveRun(ctx, &pipeline.Run{ID: "run-1", Status: pipeline.StatusSucceeded, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	first.db.Close()
+
+	run, err := newTestSQL(t, cfg).GetRun(ctx, "run-1")
+	if err != nil || run.Status != pipeline.StatusSucceeded {
+		t.Errorf("GetRun() after reopening = %v, %v; want the saved run", run, err)
+	}
+}
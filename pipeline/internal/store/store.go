@@ -0,0 +1,150 @@
+// Package store persists pipeline runs.
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	perrors "github.com/devmind-pipeline/pipeline/internal/errors"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// ErrNotFound is returned when no run has the requested ID.
+var ErrNotFound = perrors.New(perrors.ErrNotFound, "run not found")
+
+// Store persists runs. It satisfies executor.Recorder.
+type Store interface {
+	SaveRun(ctx context.Context, run *pipeline.Run) error
+	// SaveRuns stores several runs in one write.
+	SaveRuns(ctx context.Context, runs []*pipeline.Run) error
+	GetRun(ctx context.Context, id string) (*pipeline.Run, error)
+	ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error)
+	// CountRuns returns how many runs match opts, regardless of its Offset
+	// and Limit.
+	CountRuns(ctx context.Context, opts ListOptions) (int, error)
+}
+
+// ListOptions filters and bounds ListRuns.
+type ListOptions struct {
+	// Selector matches against the spec labels of a run. Nil matches every
+	// run.
+	Selector labels.Selector
+	// Limit caps the number of runs returned. Zero means no limit.
+	Limit int
+	// Offset skips that many of the newest matching runs, for paging.
+	Offset int
+	// CreatedAfter, when set, only matches runs created after it.
+	CreatedAfter time.Time
+	// CreatedBefore, when set, only matches runs created before it.
+	CreatedBefore time.Time
+	// Repo and Branch, when set, only match runs of that repository and
+	// branch.
+	Repo   string
+	Branch string
+	// Statuses, when not empty, only matches runs in one of them.
+	Statuses []pipeline.Status
+}
+
+func (o ListOptions) matches(run *pipeline.Run) bool {
+	if !o.CreatedAfter.IsZero() && !run.CreatedAt.After(o.CreatedAfter) {
+		return false
+	}
+	if !o.CreatedBefore.IsZero() && !run.CreatedAt.Before(o.CreatedBefore) {
+		return false
+	}
+	if o.Repo != "" && run.Spec.Repo != o.Repo || o.Branch != "" && run.Spec.Branch != o.Branch {
+		return false
+	}
+	if len(o.Statuses) > 0 && !slices.Contains(o.Statuses, run.Status) {
+		return false
+	}
+	return o.Selector == nil || o.Selector.Matches(labels.Set(run.Spec.Labels))
+}
+
+// page returns the runs of sorted that Offset and Limit select.
+func (o ListOptions) page(sorted []*pipeline.Run) []*pipeline.Run {
+	if o.Offset >= len(sorted) {
+		return nil
+	}
+	sorted = sorted[o.Offset:]
+	if o.Limit > 0 && len(sorted) > o.Limit {
+		sorted = sorted[:o.Limit]
+	}
+	return sorted
+}
+
+// Memory is a Store that keeps runs in process memory.
+type Memory struct {
+	mu   sync.RWMutex
+	runs map[string]*pipeline.Run
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{runs: make(map[string]*pipeline.Run)}
+}
+
+// SaveRun stores a copy of run, replacing any previous version.
+func (m *Memory) SaveRun(ctx context.Context, run *pipeline.Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[run.ID] = run.Clone()
+	return nil
+}
+
+// SaveRuns stores copies of runs.
+func (m *Memory) SaveRuns(ctx context.Context, runs []*pipeline.Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, run := range runs {
+		m.runs[run.ID] = run.Clone()
+	}
+	return nil
+}
+
+// GetRun returns a copy of the run with the given ID.
+func (m *Memory) GetRun(ctx context.Context, id string) (*pipeline.Run, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	run, ok := m.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return run.Clone(), nil
+}
+
+// ListRuns returns copies of the runs matching opts, newest first.
+func (m *Memory) ListRuns(ctx context.Context, opts ListOptions) ([]*pipeline.Run, error) {
+	m.mu.RLock()
+	var out []*pipeline.Run
+	for _, run := range m.runs {
+		if opts.matches(run) {
+			out = append(out, run)
+		}
+	}
+	m.mu.RUnlock()
+
+	sortNewestFirst(out)
+	out = opts.page(out)
+	for i, run := range out {
+		out[i] = run.Clone()
+	}
+	return out, nil
+}
+
+// CountRuns returns how many runs match opts.
+func (m *Memory) CountRuns(ctx context.Context, opts ListOptions) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n := 0
+	for _, run := range m.runs {
+		if opts.matches(run) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func TestMemoryListRunsFiltersByLabels(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	for i, l := range []map[string]string{
+		{"team": "payments", "env": "prod"},
+		{"team": "payments", "env": "staging"},
+		{"team": "search", "env": "prod"},
+		nil,
+	} {
+		run := &pipeline.Run{
+			ID:        string(rune('a' + i)),
+			Spec:      pipeline.Spec{Name: "p", Labels: l},
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		}
+		if err := m.SaveRun(context.Background(), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		selector string
+		limit    int
+		want     []string
+	}{
+		{"", 0, []string{"d", "c", "b", "a"}},
+		{"team=payments,env=prod", 0, []string{"a"}},
+		{"env in (prod,staging)", 0, []string{"c", "b", "a"}},
+		{"team!=payments", 0, []string{"d", "c"}},
+		{"team", 1, []string{"c"}},
+	}
+	for _, tt := range tests {
+		sel, err := labels.Parse(tt.selector)
+		if err != nil {
+			t.Fatalf("labels.Parse(%q) error = %v", tt.selector, err)
+		}
+		runs, err := m.ListRuns(context.Background(), ListOptions{Selector: sel, Limit: tt.limit})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, r := range runs {
+			got = append(got, r.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ListRuns(%q) = %v, want %v", tt.selector, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ListRuns(%q) = %v, want %v", tt.selector, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMemoryListRunsFiltersHistory(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	for i, r := range []struct {
+		repo, branch string
+		status       pipeline.Status
+	}{
+		{"org/api", "main", pipeline.StatusSucceeded},
+		{"org/api", "main", pipeline.StatusFailed},
+		{"org/api", "dev", pipeline.StatusFailed},
+		{"org/web", "main", pipeline.StatusTimedOut},
+	} {
+		run := &pipeline.Run{
+			ID:        string(rune('a' + i)),
+			Spec:      pipeline.Spec{Name: "p", Repo: r.repo, Branch: r.branch},
+			Status:    r.status,
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		}
+		if err := m.SaveRun(context.Background(), run); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want string
+	}{
+		{"repo", ListOptions{Repo: "org/api"}, "cba"},
+		{"repo and branch", ListOptions{Repo: "org/api", Branch: "main"}, "ba"},
+		{"statuses", ListOptions{Statuses: []pipeline.Status{pipeline.StatusFailed, pipeline.StatusTimedOut}}, "dcb"},
+		{"time range", ListOptions{CreatedAfter: now, CreatedBefore: now.Add(3 * time.Minute)}, "cb"},
+		{"page", ListOptions{Repo: "org/api", Offset: 1, Limit: 1}, "b"},
+		{"offset past the end", ListOptions{Offset: 4}, ""},
+	}
+	for _, tt := range tests {
+		runs, err := m.ListRuns(context.Background(), tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for _, r := range runs {
+			got += r.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: ListRuns() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if n, err := m.CountRuns(context.Background(), ListOptions{Repo: "org/api", Limit: 1}); err != nil || n != 3 {
+		t.Errorf("CountRuns() = %d, %v; want 3", n, err)
+	}
+}
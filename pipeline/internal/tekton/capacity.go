@@ -0,0 +1,128 @@
+package tekton
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// stageDemand is the concurrent request of one stage.
+type stageDemand struct {
+	stage string
+	cpu   resource.Quantity
+	mem   resource.Quantity
+}
+
+// CheckCapacity compares the spec's resource requests with what is left of
+// every ResourceQuota in the namespace. It fails with an error wrapping
+// pipeline.ErrInsufficientCapacity when a single stage, running as many of
+// its jobs side by side as its limits allow, would not fit. Stages that may
+// overlap are not added up, so a pipeline that could run is never refused.
+func (c *Client) CheckCapacity(ctx context.Context, spec *pipeline.Spec) error {
+	demands, err := stageDemands(spec)
+	if err != nil || len(demands) == 0 {
+		return err
+	}
+
+	quotas, err := c.kube.CoreV1().ResourceQuotas(c.cfg.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+
+	for _, q := range quotas.Items {
+		for _, d := range demands {
+			if err := fits(q, d.stage, "cpu", d.cpu, corev1.ResourceRequestsCPU, corev1.ResourceCPU); err != nil {
+				return err
+			}
+			if err := fits(q, d.stage, "memory", d.mem, corev1.ResourceRequestsMemory, corev1.ResourceMemory); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func fits(q corev1.ResourceQuota, stage, kind string, need resource.Quantity, names ...corev1.ResourceName) error {
+	if need.IsZero() {
+		return nil
+	}
+	for _, name := range names {
+		hard, ok := q.Status.Hard[name]
+		if !ok {
+			continue
+		}
+		left := hard.DeepCopy()
+		if used, ok := q.Status.Used[name]; ok {
+			left.Sub(used)
+		}
+		if need.Cmp(left) > 0 {
+			return fmt.Errorf("%w: stage %s requests %s %s but quota %s has %s left",
+				pipeline.ErrInsufficientCapacity, stage, need.String(), kind, q.Name, left.String())
+		}
+	}
+	return nil
+}
+
+func stageDemands(spec *pipeline.Spec) ([]stageDemand, error) {
+	var out []stageDemand
+	stages := append(append([]pipeline.Stage(nil), spec.Stages...), spec.Finally...)
+	if spec.PostRun != nil {
+		stages = append(stages, *spec.PostRun)
+	}
+	for i := range stages {
+		st := &stages[i]
+		if st.Resources == nil {
+			continue
+		}
+
+		parallel := int64(len(st.Jobs()))
+		if st.Matrix != nil && st.Matrix.MaxParallel > 0 && int64(st.Matrix.MaxParallel) < parallel {
+			parallel = int64(st.Matrix.MaxParallel)
+		}
+		if spec.Parallelism > 0 && int64(spec.Parallelism) < parallel {
+			parallel = int64(spec.Parallelism)
+		}
+
+		d := stageDemand{stage: st.Name}
+		var err error
+		if d.cpu, err = scaled(st.Resources.CPU, parallel); err != nil {
+			return nil, fmt.Errorf("stage %s: %w", st.Name, err)
+		}
+		if d.mem, err = scaled(st.Resources.Memory, parallel); err != nil {
+			return nil, fmt.Errorf("stage %s: %w", st.Name, err)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func scaled(v string, n int64) (resource.Quantity, error) {
+	if v == "" {
+		return resource.Quantity{}, nil
+	}
+	q, err := resource.ParseQuantity(v)
+	if err != nil {
+		return resource.Quantity{}, err
+	}
+	return *resource.NewMilliQuantity(q.MilliValue()*n, q.Format), nil
+}
+
+// computeResources converts stage resources to container requests.
+func computeResources(r *pipeline.Resources) *corev1.ResourceRequirements {
+	if r == nil || (r.CPU == "" && r.Memory == "") {
+		return nil
+	}
+	req := corev1.ResourceList{}
+	if q, err := resource.ParseQuantity(r.CPU); err == nil && r.CPU != "" {
+		req[corev1.ResourceCPU] = q
+	}
+	if q, err := resource.ParseQuantity(r.Memory); err == nil && r.Memory != "" {
+		req[corev1.ResourceMemory] = q
+	}
+	return &corev1.ResourceRequirements{Requests: req}
+}
@@ -0,0 +1,100 @@
+// Package tekton runs pipeline jobs as Tekton TaskRuns.
+//
+// The engine orchestrates the DAG itself; this package only turns a single
+// job into a TaskRun, waits for it to finish and reports the outcome. All
+// Kubernetes API calls go through one client-side rate limiter so bursts of
+// runs cannot exceed the budget configured by tekton.api_qps and
+// tekton.api_burst, and every call but a watch is abandoned after
+// tekton.api_timeout. Creating, getting and watching TaskRuns is retried
+// with backoff on timeouts, throttling and server errors, up to
+// tekton.retry_count times. With tekton.build_metadata, TaskRun pods get
+// the run's commit, branch, ID and trigger in the DEVMIND_* variables
+// documented in metadata.go.
+package tekton
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+)
+
+const (
+	// DefaultAPIQPS is used when tekton.api_qps is not configured.
+	DefaultAPIQPS = 20
+	// DefaultAPIBurst is used when tekton.api_burst is not configured.
+	DefaultAPIBurst = 40
+	// DefaultAPITimeout is used when tekton.api_timeout is not configured.
+	DefaultAPITimeout = 30 * time.Second
+	// DefaultConnectTimeout is used when tekton.connect_timeout is not
+	// configured.
+	DefaultConnectTimeout = 10 * time.Second
+)
+
+// Client creates and watches TaskRuns in the configured namespace.
+type Client struct {
+	tekton tektonclient.Interface
+	kube   kubernetes.Interface
+	cfg    config.TektonConfig
+	logger *logrus.Logger
+}
+
+// New creates a Client using the in-cluster configuration, falling back to
+// the local kubeconfig when running outside a cluster.
+func New(cfg config.TektonConfig, logger *logrus.Logger) (*Client, error) {
+	restCfg, err := rest.InClusterConfig()
+	if err != nil {
+		restCfg, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(),
+			&clientcmd.ConfigOverrides{},
+		).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+		}
+	}
+
+	qps, burst := cfg.APIQPS, cfg.APIBurst
+	if qps <= 0 {
+		qps = DefaultAPIQPS
+	}
+	if burst <= 0 {
+		burst = DefaultAPIBurst
+	}
+	// Shared by both clientsets so together they stay within one budget.
+	restCfg.RateLimiter = newThrottleLimiter(qps, burst)
+
+	apiTimeout, connectTimeout := cfg.APITimeout, cfg.ConnectTimeout
+	if apiTimeout <= 0 {
+		apiTimeout = DefaultAPITimeout
+	}
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	restCfg.Dial = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	restCfg.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return &timeoutTransport{next: rt, timeout: apiTimeout, logger: logger}
+	})
+
+	tc, err := tektonclient.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tekton client: %w", err)
+	}
+	kc, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	return NewForClients(tc, kc, cfg, logger), nil
+}
+
+// NewForClients creates a Client from existing clientsets.
+func NewForClients(tc tektonclient.Interface, kc kubernetes.Interface, cfg config.TektonConfig, logger *logrus.Logger) *Client {
+	return &Client{tekton: tc, kube: kc, cfg: cfg, logger: logger}
+}
@@ -0,0 +1,44 @@
+package tekton
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// tektonGroupVersion is the Tekton API the client speaks.
+const tektonGroupVersion = "tekton.dev/v1"
+
+// requiredResources are the tektonGroupVersion resources the engine uses.
+var requiredResources = []string{"taskruns", "tasks"}
+
+// CheckCRDs verifies at startup that the Tekton CRDs are installed at the
+// API version the engine uses and that TaskRuns in the namespace can be
+// listed, so a missing or outdated Tekton installation is reported up front
+// rather than when the first pipeline runs.
+func (c *Client) CheckCRDs(ctx context.Context) error {
+	list, err := c.tekton.Discovery().ServerResourcesForGroupVersion(tektonGroupVersion)
+	if err != nil {
+		return fmt.Errorf("tekton API %s is not served, check that Tekton Pipelines is installed and up to date: %w", tektonGroupVersion, err)
+	}
+	served := make(map[string]bool, len(list.APIResources))
+	for _, r := range list.APIResources {
+		served[r.Name] = true
+	}
+	var missing []string
+	for _, name := range requiredResources {
+		if !served[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("tekton API %s does not serve %s, check the installed Tekton Pipelines version", tektonGroupVersion, strings.Join(missing, ", "))
+	}
+
+	if _, err := c.tekton.TektonV1().TaskRuns(c.cfg.Namespace).List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return fmt.Errorf("failed to list taskruns in namespace %s: %w", c.cfg.Namespace, err)
+	}
+	return nil
+}
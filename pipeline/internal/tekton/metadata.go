@@ -0,0 +1,42 @@
+package tekton
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+// Build metadata environment variables, set in every TaskRun's pods when
+// tekton.build_metadata is enabled so build scripts can stamp artifacts
+// with their provenance. The set is stable: variables are only ever added,
+// and each is present, possibly empty, whether or not the run has a value
+// for it.
+const (
+	// EnvCommit is the commit the run builds, from the spec's commit.
+	EnvCommit = "DEVMIND_COMMIT"
+	// EnvBranch is the branch the run builds, from the spec's branch.
+	EnvBranch = "DEVMIND_BRANCH"
+	// EnvRunID is the ID of the run.
+	EnvRunID = "DEVMIND_RUN_ID"
+	// EnvTriggeredBy names who or what started the run: the submitter given
+	// at submission, or schedule:<name> for scheduled runs.
+	EnvTriggeredBy = "DEVMIND_TRIGGERED_BY"
+)
+
+// buildMetadataEnv returns the build metadata variables of run, leaving out
+// those a job secret of the same name sets.
+func buildMetadataEnv(run *pipeline.Run, secrets map[string]string) []corev1.EnvVar {
+	vars := []corev1.EnvVar{
+		{Name: EnvCommit, Value: run.Spec.Commit},
+		{Name: EnvBranch, Value: run.Spec.Branch},
+		{Name: EnvRunID, Value: run.ID},
+		{Name: EnvTriggeredBy, Value: run.TriggeredBy},
+	}
+	env := make([]corev1.EnvVar, 0, len(vars))
+	for _, v := range vars {
+		if _, ok := secrets[v.Name]; !ok {
+			env = append(env, v)
+		}
+	}
+	return env
+}
@@ -0,0 +1,34 @@
+package tekton
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+// throttleLimiter is the standard client-go token bucket, instrumented so
+// that requests delayed by it show up in metrics.
+type throttleLimiter struct {
+	flowcontrol.RateLimiter
+}
+
+func newThrottleLimiter(qps float32, burst int) *throttleLimiter {
+	return &throttleLimiter{RateLimiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst)}
+}
+
+// Wait takes a token immediately when one is available and otherwise
+// records the request as throttled and waits for one.
+func (l *throttleLimiter) Wait(ctx context.Context) error {
+	if l.RateLimiter.TryAccept() {
+		return nil
+	}
+
+	metrics.TektonAPIThrottled.Inc()
+	start := time.Now()
+	err := l.RateLimiter.Wait(ctx)
+	metrics.TektonAPIThrottleWait.Observe(time.Since(start).Seconds())
+	return err
+}
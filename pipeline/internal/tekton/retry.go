@@ -0,0 +1,94 @@
+package tekton
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+)
+
+const (
+	// DefaultRetryBaseDelay is used when tekton.retry_base_delay is not
+	// configured.
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	// DefaultRetryMaxDelay is used when tekton.retry_max_delay is not
+	// configured.
+	DefaultRetryMaxDelay = 10 * time.Second
+)
+
+// retry calls fn until it succeeds, fails with an error that is not worth
+// retrying, or has been retried tekton.retry_count times. Attempts are
+// spaced by an exponential backoff from tekton.retry_base_delay, capped at
+// tekton.retry_max_delay, with each delay jittered down by up to half so
+// jobs that failed together do not retry together. op names the call in
+// the retry metric and logs.
+func (c *Client) retry(ctx context.Context, op string, fn func() error) error {
+	base, max := c.cfg.RetryBaseDelay, c.cfg.RetryMaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+
+	delay := base
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > c.cfg.RetryCount || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		wait := jitter(delay)
+		metrics.TektonAPIRetries.WithLabelValues(op).Inc()
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"operation": op,
+			"attempt":   attempt,
+			"backoff":   wait,
+		}).Warn("Kubernetes API call failed, retrying")
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		if delay *= 2; delay > max {
+			delay = max
+		}
+	}
+}
+
+// jitter returns a random duration in [d/2, d].
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryable reports whether a failed API call may succeed if repeated:
+// timeouts, throttling and server errors. Client errors such as a rejected
+// or conflicting object fail the same way every time.
+func retryable(err error) bool {
+	if apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	var status apierrors.APIStatus
+	if errors.As(err, &status) {
+		return status.Status().Code >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,496 @@
+package tekton
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/pod"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"knative.dev/pkg/apis"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/logging"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+// Labels set on every object the engine creates.
+const (
+	LabelPipelineID = "devmind.io/pipeline-id"
+	LabelStage      = "devmind.io/stage"
+	LabelJob        = "devmind.io/job"
+	// LabelFinally marks the TaskRuns of finally stages.
+	LabelFinally = "devmind.io/finally"
+	// LabelPostRun marks the TaskRuns of the post-run hook.
+	LabelPostRun = "devmind.io/post-run"
+	// LabelTraceID is the ID of the trace the run's spans belong to, to go
+	// from a trace to its TaskRuns and back.
+	LabelTraceID = "devmind.io/trace-id"
+	// LabelAttempt counts the retries of the job before this TaskRun, on
+	// the TaskRuns of retried jobs.
+	LabelAttempt = "devmind.io/attempt"
+)
+
+// AnnotationFailureProbability carries the run's predicted failure
+// probability on its TaskRuns, when a prediction was made.
+const AnnotationFailureProbability = "devmind.io/predicted-failure-probability"
+
+// CacheWorkspace is the workspace that mounts the build cache of jobs
+// given one, a directory of the tekton.cache_claim volume.
+const CacheWorkspace = "build-cache"
+
+// cleanupTimeout bounds cancelling a TaskRun and deleting its secret once the
+// job's context is gone.
+const cleanupTimeout = 30 * time.Second
+
+// RunJob creates a TaskRun for job and blocks until it finishes. It
+// implements executor.Runner. Cancelling ctx cancels the TaskRun. Failures
+// are returned as a pipeline.JobError classifying them for retry policies.
+// Each retry of a job gets a TaskRun of its own.
+func (c *Client) RunJob(ctx context.Context, run *pipeline.Run, job pipeline.Job) error {
+	name := resourceName(run.ID, job.ID)
+	if job.Attempt > 0 {
+		name = resourceName(run.ID, job.ID, "retry", strconv.Itoa(job.Attempt))
+	}
+	log := logging.FromContext(ctx, c.logger).WithField("taskrun", name)
+	labels := map[string]string{
+		LabelPipelineID: labelValue(run.ID),
+		LabelStage:      labelValue(job.Stage.Name),
+		LabelJob:        labelValue(job.ID),
+	}
+	if job.Finally {
+		labels[LabelFinally] = "true"
+	}
+	if job.PostRun {
+		labels[LabelPostRun] = "true"
+	}
+	if job.Attempt > 0 {
+		labels[LabelAttempt] = strconv.Itoa(job.Attempt)
+	}
+	if id := tracing.TraceID(ctx); id != "" {
+		labels[LabelTraceID] = id
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tekton.taskrun", name))
+
+	if len(job.Secrets) > 0 {
+		if err := c.createSecret(ctx, name, labels, job.Secrets); err != nil {
+			return apiFailure(err)
+		}
+		defer c.deleteSecret(ctx, name, log)
+	}
+
+	taskRuns := c.tekton.TektonV1().TaskRuns(c.cfg.Namespace)
+	var tr *tektonv1.TaskRun
+	err := c.retry(ctx, "create_taskrun", func() (err error) {
+		tr, err = taskRuns.Create(ctx, c.taskRun(name, labels, run, job), metav1.CreateOptions{})
+		return err
+	})
+	if apierrors.IsAlreadyExists(err) {
+		// A previous owner of this run, or an attempt whose response was
+		// lost, already created it; pick it up.
+		err = c.retry(ctx, "get_taskrun", func() (err error) {
+			tr, err = taskRuns.Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+	}
+	if err != nil {
+		return apiFailure(fmt.Errorf("failed to create taskrun %s: %w", name, err))
+	}
+	log.Info("Created TaskRun")
+
+	tr, err = c.wait(ctx, tr)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.cancel(ctx, name, log)
+			return ctx.Err()
+		}
+		return apiFailure(err)
+	}
+
+	cond := tr.Status.GetCondition(apis.ConditionSucceeded)
+	if cond.IsTrue() {
+		return nil
+	}
+	return &pipeline.JobError{
+		Class: failureClass(tr, cond.Reason),
+		Err:   fmt.Errorf("taskrun %s %s: %s", name, cond.Reason, cond.Message),
+	}
+}
+
+// infraReasons are the TaskRun failure reasons of jobs whose pod could not
+// be created or started.
+var infraReasons = map[string]bool{
+	tektonv1.TaskRunReasonImagePullFailed.String(): true,
+	"PodCreationFailed":                            true,
+	"CreateContainerConfigError":                   true,
+	"ExceededNodeResources":                        true,
+	"ExceededResourceQuota":                        true,
+	tektonv1.TaskRunReasonStopSidecarFailed:        true,
+}
+
+// failureClass classifies a failed TaskRun by its reason and the termination
+// reasons of its steps.
+func failureClass(tr *tektonv1.TaskRun, reason string) string {
+	for _, step := range tr.Status.Steps {
+		if t := step.Terminated; t != nil && t.Reason == "OOMKilled" {
+			return pipeline.ErrorClassOOM
+		}
+	}
+	switch {
+	case reason == tektonv1.TaskRunReasonTimedOut.String():
+		return pipeline.ErrorClassTimeout
+	case infraReasons[reason]:
+		return pipeline.ErrorClassInfra
+	}
+	return pipeline.ErrorClassFailed
+}
+
+// apiFailure classifies a Kubernetes API call that failed even after its
+// retries: as infra when it failed for lack of a healthy API server,
+// otherwise as a job that can never be created.
+func apiFailure(err error) error {
+	class := pipeline.ErrorClassFailed
+	if retryable(err) {
+		class = pipeline.ErrorClassInfra
+	}
+	return &pipeline.JobError{Class: class, Err: err}
+}
+
+func (c *Client) taskRun(name string, labels map[string]string, run *pipeline.Run, job pipeline.Job) *tektonv1.TaskRun {
+	tr := &tektonv1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.cfg.Namespace,
+			Labels:    labels,
+		},
+	}
+	if run.Prediction != nil {
+		tr.Annotations = map[string]string{AnnotationFailureProbability: strconv.FormatFloat(run.Prediction.Probability, 'f', 2, 64)}
+	}
+
+	params := job.Params()
+	for _, k := range sortedKeys(params) {
+		tr.Spec.Params = append(tr.Spec.Params, tektonv1.Param{
+			Name:  k,
+			Value: *tektonv1.NewStructuredValues(params[k]),
+		})
+	}
+
+	if job.Stage.TaskRef != "" {
+		tr.Spec.TaskRef = &tektonv1.TaskRef{Name: job.Stage.TaskRef}
+	} else {
+		tr.Spec.TaskSpec = &tektonv1.TaskSpec{Steps: []tektonv1.Step{{
+			Name:   "run",
+			Image:  job.Stage.Image,
+			Script: job.Stage.Script,
+		}}}
+		if cache := job.Stage.Cache; cache != nil && c.cfg.CacheClaim != "" {
+			tr.Spec.TaskSpec.Workspaces = []tektonv1.WorkspaceDeclaration{{Name: CacheWorkspace, MountPath: cache.Path}}
+			tr.Spec.Workspaces = []tektonv1.WorkspaceBinding{{
+				Name:                  CacheWorkspace,
+				SubPath:               cache.Key,
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: c.cfg.CacheClaim},
+			}}
+		}
+	}
+
+	tr.Spec.ComputeResources = computeResources(job.Stage.Resources)
+	tr.Spec.ServiceAccountName = job.Stage.ServiceAccount
+
+	timeout := time.Duration(job.Stage.Timeout)
+	if timeout <= 0 {
+		timeout = c.cfg.Timeout
+	}
+	if timeout > 0 {
+		tr.Spec.Timeout = &metav1.Duration{Duration: timeout}
+	}
+
+	var env []corev1.EnvVar
+	if c.cfg.BuildMetadata {
+		env = buildMetadataEnv(run, job.Secrets)
+	}
+	// Secret values live in a Secret, never in the TaskRun itself.
+	for _, k := range sortedKeys(job.Secrets) {
+		env = append(env, corev1.EnvVar{
+			Name: k,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Key:                  k,
+			}},
+		})
+	}
+	if len(env) > 0 {
+		tr.Spec.PodTemplate = &pod.PodTemplate{Env: env}
+	}
+	return tr
+}
+
+// wait follows the TaskRun until it is done, re-establishing the watch when
+// the API server closes it. Each watch resumes from the latest state seen,
+// so events already applied are not replayed.
+func (c *Client) wait(ctx context.Context, tr *tektonv1.TaskRun) (*tektonv1.TaskRun, error) {
+	taskRuns := c.tekton.TektonV1().TaskRuns(c.cfg.Namespace)
+	for !tr.IsDone() {
+		var w watch.Interface
+		err := c.retry(ctx, "watch_taskrun", func() (err error) {
+			w, err = taskRuns.Watch(ctx, metav1.ListOptions{
+				FieldSelector:   fields.OneTermEqualSelector("metadata.name", tr.Name).String(),
+				ResourceVersion: tr.ResourceVersion,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to watch taskrun %s: %w", tr.Name, err)
+		}
+		next, ended, err := c.follow(ctx, w, tr)
+		w.Stop()
+		if err != nil {
+			return nil, err
+		}
+		if ended {
+			// The watch ended or expired; resync before watching again.
+			var fresh *tektonv1.TaskRun
+			err := c.retry(ctx, "get_taskrun", func() (err error) {
+				fresh, err = taskRuns.Get(ctx, tr.Name, metav1.GetOptions{})
+				return err
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get taskrun %s: %w", tr.Name, err)
+			}
+			next = c.reconcile(next, fresh)
+		}
+		tr = next
+	}
+	return tr, nil
+}
+
+// follow applies watch events to tr until the TaskRun is done or the watch
+// ends. It returns the latest state and whether the watch ended first, in
+// which case the caller resyncs.
+func (c *Client) follow(ctx context.Context, w watch.Interface, tr *tektonv1.TaskRun) (*tektonv1.TaskRun, bool, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return tr, true, nil
+			}
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				obj, ok := ev.Object.(*tektonv1.TaskRun)
+				if !ok || obj.Name != tr.Name {
+					continue
+				}
+				if tr = c.reconcile(tr, obj); tr.IsDone() {
+					return tr, false, nil
+				}
+			case watch.Deleted:
+				return nil, false, fmt.Errorf("taskrun %s was deleted before it finished", tr.Name)
+			case watch.Error:
+				return tr, true, nil
+			}
+		}
+	}
+}
+
+// reconcile returns the state of a TaskRun to go on from when next is
+// observed after cur. Observations only move forward: next is ignored when
+// it is older than cur by resource version, or would take a finished
+// TaskRun back to running, so a duplicate or late event never reverts a
+// terminal state. tekton.accept_stale_events turns the check off.
+func (c *Client) reconcile(cur, next *tektonv1.TaskRun) *tektonv1.TaskRun {
+	if c.cfg.AcceptStaleEvents {
+		return next
+	}
+	reason := ""
+	switch {
+	case cur.IsDone() && !next.IsDone():
+		reason = "regressed"
+	case olderVersion(next.ResourceVersion, cur.ResourceVersion):
+		reason = "stale"
+	default:
+		return next
+	}
+	metrics.TektonWatchEventsIgnored.WithLabelValues(reason).Inc()
+	c.logger.WithFields(logrus.Fields{
+		"taskrun":          cur.Name,
+		"resource_version": next.ResourceVersion,
+		"latest":           cur.ResourceVersion,
+		"reason":           reason,
+	}).Debug("Ignored out-of-order TaskRun event")
+	return cur
+}
+
+// olderVersion reports whether resource version a precedes b. Resource
+// versions are opaque to clients, but the API server hands out increasing
+// integers for a given object; anything else is never considered older.
+func olderVersion(a, b string) bool {
+	av, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return false
+	}
+	bv, err := strconv.ParseUint(b, 10, 64)
+	if err != nil {
+		return false
+	}
+	return av < bv
+}
+
+func (c *Client) cancel(ctx context.Context, name string, log *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	patch := []byte(`{"spec":{"status":"` + tektonv1.TaskRunSpecStatusCancelled + `"}}`)
+	if _, err := c.tekton.TektonV1().TaskRuns(c.cfg.Namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.WithError(err).Warn("Failed to cancel TaskRun")
+		return
+	}
+	log.Info("Cancelled TaskRun")
+}
+
+// CancelTaskRuns cancels the unfinished TaskRuns of the pipeline run
+// pipelineID, found by their LabelPipelineID label, and returns how many
+// it cancelled. It satisfies engine.TaskRunCanceller.
+func (c *Client) CancelTaskRuns(ctx context.Context, pipelineID string) (int, error) {
+	taskRuns := c.tekton.TektonV1().TaskRuns(c.cfg.Namespace)
+	var list *tektonv1.TaskRunList
+	err := c.retry(ctx, "list_taskruns", func() (err error) {
+		list, err = taskRuns.List(ctx, metav1.ListOptions{LabelSelector: LabelPipelineID + "=" + labelValue(pipelineID)})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list taskruns of pipeline %s: %w", pipelineID, err)
+	}
+
+	patch := []byte(`{"spec":{"status":"` + tektonv1.TaskRunSpecStatusCancelled + `"}}`)
+	cancelled := 0
+	for _, tr := range list.Items {
+		if tr.IsDone() || tr.Spec.Status == tektonv1.TaskRunSpecStatusCancelled {
+			continue
+		}
+		err := c.retry(ctx, "cancel_taskrun", func() error {
+			_, err := taskRuns.Patch(ctx, tr.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+			return err
+		})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return cancelled, fmt.Errorf("failed to cancel taskrun %s: %w", tr.Name, err)
+		}
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+func (c *Client) createSecret(ctx context.Context, name string, labels, data map[string]string) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.cfg.Namespace, Labels: labels},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: data,
+	}
+	err := c.retry(ctx, "create_secret", func() error {
+		_, err := c.kube.CoreV1().Secrets(c.cfg.Namespace).Create(ctx, secret, metav1.CreateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create secret for taskrun %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *Client) deleteSecret(ctx context.Context, name string, log *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	if err := c.kube.CoreV1().Secrets(c.cfg.Namespace).Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		log.WithError(err).Warn("Failed to delete TaskRun secret")
+	}
+}
+
+// SecretValue returns the value stored under key in the named secret. It
+// satisfies argocd.SecretReader.
+func (c *Client) SecretValue(ctx context.Context, namespace, name, key string) (string, error) {
+	var secret *corev1.Secret
+	err := c.retry(ctx, "get_secret", func() (err error) {
+		secret, err = c.kube.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s/%s: %w", namespace, name, err)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %q", namespace, name, key)
+	}
+	return string(value), nil
+}
+
+// maxNameLen keeps names usable as label values, which Tekton copies them
+// into.
+const maxNameLen = 63
+
+// resourceName builds a DNS-1123 compliant name from parts. Names that would
+// be too long are truncated and suffixed with a hash of the full name so
+// they stay unique.
+func resourceName(parts ...string) string {
+	full := strings.Join(parts, "-")
+	name := sanitize(strings.ToLower(full), func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-'
+	})
+	if len(name) <= maxNameLen && name == full {
+		return name
+	}
+	sum := sha256.Sum256([]byte(full))
+	suffix := hex.EncodeToString(sum[:4])
+	if len(name) > maxNameLen-len(suffix)-1 {
+		name = strings.TrimRight(name[:maxNameLen-len(suffix)-1], "-")
+	}
+	return name + "-" + suffix
+}
+
+// labelValue makes v a valid label value, truncating it if needed.
+func labelValue(v string) string {
+	v = sanitize(v, func(r rune) bool {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.'
+	})
+	if len(v) > maxNameLen {
+		v = v[:maxNameLen]
+	}
+	return strings.TrimRight(v, "-_.")
+}
+
+func sanitize(s string, valid func(rune) bool) string {
+	s = strings.Map(func(r rune) rune {
+		if valid(r) {
+			return r
+		}
+		return '-'
+	}, s)
+	return strings.Trim(s, "-_.")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
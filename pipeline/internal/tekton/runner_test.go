@@ -0,0 +1,446 @@
+package tekton
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	tektonv1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/apis"
+
+	"github.com/devmind-pipeline/pipeline/internal/config"
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+	"github.com/devmind-pipeline/pipeline/pkg/metrics"
+	"github.com/devmind-pipeline/pipeline/pkg/tracing"
+)
+
+const testNamespace = "ci"
+
+func newTestClient() (*Client, *tektonfake.Clientset, *kubefake.Clientset) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	tc := tektonfake.NewSimpleClientset()
+	kc := kubefake.NewSimpleClientset()
+	return NewForClients(tc, kc, config.TektonConfig{Namespace: testNamespace, Timeout: time.Hour}, logger), tc, kc
+}
+
+// finish marks the named TaskRun done once it exists.
+func finish(t *testing.T, tc *tektonfake.Clientset, name string, status corev1.ConditionStatus, reason string) {
+	t.Helper()
+	taskRuns := tc.TektonV1().TaskRuns(testNamespace)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tr, err := taskRuns.Get(context.Background(), name, metav1.GetOptions{})
+		if err == nil {
+			tr.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: status, Reason: reason})
+			if _, err := taskRuns.UpdateStatus(context.Background(), tr, metav1.UpdateOptions{}); err != nil {
+				t.Errorf("UpdateStatus() error = %v", err)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("taskrun %s was never created", name)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func testJob(secrets map[string]string) (*pipeline.Run, pipeline.Job) {
+	stage := &pipeline.Stage{Name: "build", Image: "golang:1.21", Script: "go build ./...", Params: map[string]string{"target": "linux"}}
+	run := &pipeline.Run{ID: "run-1"}
+	return run, pipeline.Job{ID: "build", Stage: stage, Secrets: secrets}
+}
+
+func TestRunJobSucceeds(t *testing.T) {
+	c, tc, kc := newTestClient()
+	run, job := testJob(map[string]string{"TOKEN": "s3cret"})
+	job.Stage.ServiceAccount = "builder"
+
+	go finish(t, tc, "run-1-build", corev1.ConditionTrue, "Succeeded")
+	if err := c.RunJob(context.Background(), run, job); err != nil {
+		t.Fatalf("RunJob() error = %v", err)
+	}
+
+	tr, err := tc.TektonV1().TaskRuns(testNamespace).Get(context.Background(), "run-1-build", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if tr.Labels[LabelPipelineID] != "run-1" || tr.Labels[LabelStage] != "build" {
+		t.Errorf("labels = %v", tr.Labels)
+	}
+	if len(tr.Spec.Params) != 1 || tr.Spec.Params[0].Name != "target" {
+		t.Errorf("params = %v", tr.Spec.Params)
+	}
+	if tr.Spec.ServiceAccountName != "builder" {
+		t.Errorf("service account = %q, want builder", tr.Spec.ServiceAccountName)
+	}
+	if tr.Spec.PodTemplate == nil || tr.Spec.PodTemplate.Env[0].ValueFrom == nil {
+		t.Fatalf("secret not injected by reference: %+v", tr.Spec.PodTemplate)
+	}
+	if raw, _ := json.Marshal(tr); strings.Contains(string(raw), "s3cret") {
+		t.Error("secret value stored in the TaskRun")
+	}
+
+	// The per-job secret is deleted once the job is over.
+	if _, err := kc.CoreV1().Secrets(testNamespace).Get(context.Background(), "run-1-build", metav1.GetOptions{}); err == nil {
+		t.Error("job secret not deleted")
+	}
+}
+
+func TestTaskRunInjectsBuildMetadata(t *testing.T) {
+	c, _, _ := newTestClient()
+	c.cfg.BuildMetadata = true
+	run, job := testJob(map[string]string{EnvBranch: "from-secret"})
+	run.Spec.Commit = "4f2a9c1"
+	run.TriggeredBy = "schedule:nightly"
+
+	env := map[string]corev1.EnvVar{}
+	for _, v := range c.taskRun("run-1-build", nil, run, job).Spec.PodTemplate.Env {
+		env[v.Name] = v
+	}
+	for name, want := range map[string]string{EnvCommit: "4f2a9c1", EnvRunID: "run-1", EnvTriggeredBy: "schedule:nightly"} {
+		if got := env[name].Value; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	// A job secret of the same name takes the variable over.
+	if env[EnvBranch].ValueFrom == nil {
+		t.Errorf("%s = %+v, want the secret reference", EnvBranch, env[EnvBranch])
+	}
+	if len(c.taskRun("run-1-build", nil, run, job).Spec.PodTemplate.Env) != 4 {
+		t.Errorf("env = %v, want each variable once", env)
+	}
+
+	run.Prediction = &pipeline.FailurePrediction{Probability: 0.42}
+	if got := c.taskRun("run-1-build", nil, run, job).Annotations[AnnotationFailureProbability]; got != "0.42" {
+		t.Errorf("%s = %q, want the run's prediction", AnnotationFailureProbability, got)
+	}
+}
+
+func TestTaskRunMountsBuildCache(t *testing.T) {
+	c, _, _ := newTestClient()
+	run, job := testJob(nil)
+	job.Stage.Cache = &pipeline.BuildCache{Stage: "build", Key: "go-mod-v1", Path: "/go/pkg/mod"}
+
+	if tr := c.taskRun("run-1-build", nil, run, job); len(tr.Spec.Workspaces) != 0 {
+		t.Errorf("workspaces without tekton.cache_claim = %+v", tr.Spec.Workspaces)
+	}
+	c.cfg.CacheClaim = "build-caches"
+	tr := c.taskRun("run-1-build", nil, run, job)
+	decl := tr.Spec.TaskSpec.Workspaces
+	if len(decl) != 1 || decl[0].Name != CacheWorkspace || decl[0].MountPath != "/go/pkg/mod" {
+		t.Errorf("declared workspaces = %+v", decl)
+	}
+	bind := tr.Spec.Workspaces
+	if len(bind) != 1 || bind[0].Name != CacheWorkspace || bind[0].SubPath != "go-mod-v1" || bind[0].PersistentVolumeClaim == nil || bind[0].PersistentVolumeClaim.ClaimName != "build-caches" {
+		t.Errorf("workspace bindings = %+v", bind)
+	}
+}
+
+func TestRunJobLabelsTaskRunWithTraceID(t *testing.T) {
+	c, tc, _ := newTestClient()
+	run, job := testJob(nil)
+	ctx := tracing.WithTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	go finish(t, tc, "run-1-build", corev1.ConditionTrue, "Succeeded")
+	if err := c.RunJob(ctx, run, job); err != nil {
+		t.Fatalf("RunJob() error = %v", err)
+	}
+	tr, err := tc.TektonV1().TaskRuns(testNamespace).Get(context.Background(), "run-1-build", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := tr.Labels[LabelTraceID]; got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID label = %q", got)
+	}
+}
+
+func TestRunJobReportsFailure(t *testing.T) {
+	c, tc, _ := newTestClient()
+	run, job := testJob(nil)
+
+	go finish(t, tc, "run-1-build", corev1.ConditionFalse, "Failed")
+	err := c.RunJob(context.Background(), run, job)
+	if err == nil || !strings.Contains(err.Error(), "Failed") {
+		t.Fatalf("RunJob() error = %v, want failure", err)
+	}
+	if class := pipeline.ErrorClass(err); class != pipeline.ErrorClassFailed {
+		t.Errorf("error class = %q, want failed", class)
+	}
+
+	// A retry gets a TaskRun of its own.
+	job.Attempt = 1
+	go finish(t, tc, "run-1-build-retry-1", corev1.ConditionFalse, tektonv1.TaskRunReasonImagePullFailed.String())
+	err = c.RunJob(context.Background(), run, job)
+	if class := pipeline.ErrorClass(err); class != pipeline.ErrorClassInfra {
+		t.Errorf("retry error = %v, class %q; want class infra", err, class)
+	}
+}
+
+func TestFailureClass(t *testing.T) {
+	oom := &tektonv1.TaskRun{}
+	oom.Status.Steps = []tektonv1.StepState{{ContainerState: corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"},
+	}}}
+	for _, tc := range []struct {
+		tr     *tektonv1.TaskRun
+		reason string
+		want   string
+	}{
+		{oom, "Failed", pipeline.ErrorClassOOM},
+		{&tektonv1.TaskRun{}, tektonv1.TaskRunReasonTimedOut.String(), pipeline.ErrorClassTimeout},
+		{&tektonv1.TaskRun{}, "ExceededNodeResources", pipeline.ErrorClassInfra},
+		{&tektonv1.TaskRun{}, "Failed", pipeline.ErrorClassFailed},
+	} {
+		if got := failureClass(tc.tr, tc.reason); got != tc.want {
+			t.Errorf("failureClass(%s) = %q, want %q", tc.reason, got, tc.want)
+		}
+	}
+}
+
+func TestRunJobCancelsTaskRun(t *testing.T) {
+	c, tc, _ := newTestClient()
+	run, job := testJob(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := c.RunJob(ctx, run, job); err != context.Canceled {
+		t.Fatalf("RunJob() error = %v, want context.Canceled", err)
+	}
+
+	tr, err := tc.TektonV1().TaskRuns(testNamespace).Get(context.Background(), "run-1-build", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if tr.Spec.Status != tektonv1.TaskRunSpecStatusCancelled {
+		t.Fatalf("spec.status = %q, want cancelled", tr.Spec.Status)
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	if got := resourceName("run-1", "test-0"); got != "run-1-test-0" {
+		t.Errorf("resourceName() = %q", got)
+	}
+	// Names that had to be altered get a hash so "Build" and "build" differ.
+	a, b := resourceName("r", "Build"), resourceName("r", "build")
+	if a == b {
+		t.Errorf("resourceName() collided: %q", a)
+	}
+	long := resourceName("r", strings.Repeat("x", 100))
+	if len(long) > maxNameLen {
+		t.Errorf("resourceName() length = %d", len(long))
+	}
+}
+
+func TestThrottleLimiterRecordsWaits(t *testing.T) {
+	before := testutil.ToFloat64(metrics.TektonAPIThrottled)
+	l := newThrottleLimiter(100, 1)
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.TektonAPIThrottled) - before; got != 2 {
+		t.Fatalf("throttled = %v, want 2", got)
+	}
+}
+
+func TestCheckCapacityAgainstQuota(t *testing.T) {
+	c, _, kc := newTestClient()
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "ci-quota", Namespace: testNamespace},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("4")},
+			Used: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1")},
+		},
+	}
+	if _, err := kc.CoreV1().ResourceQuotas(testNamespace).Create(context.Background(), quota, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &pipeline.Spec{Stages: []pipeline.Stage{{
+		Name:      "test",
+		Resources: &pipeline.Resources{CPU: "1"},
+		Matrix:    &pipeline.Matrix{Params: map[string][]string{"shard": {"1", "2", "3", "4"}}, MaxParallel: 3},
+	}}}
+	// Three shards at a time need exactly the three CPUs left.
+	if err := c.CheckCapacity(context.Background(), spec); err != nil {
+		t.Fatalf("CheckCapacity() error = %v", err)
+	}
+
+	spec.Stages[0].Matrix.MaxParallel = 4
+	if err := c.CheckCapacity(context.Background(), spec); !errors.Is(err, pipeline.ErrInsufficientCapacity) {
+		t.Fatalf("CheckCapacity() error = %v, want ErrInsufficientCapacity", err)
+	}
+}
+
+func TestCheckCRDs(t *testing.T) {
+	c, tc, _ := newTestClient()
+	fake := tc.Discovery().(*fakediscovery.FakeDiscovery)
+
+	if err := c.CheckCRDs(context.Background()); err == nil {
+		t.Fatal("CheckCRDs() succeeded without the tekton API")
+	}
+
+	fake.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "tekton.dev/v1",
+		APIResources: []metav1.APIResource{{Name: "taskruns"}},
+	}}
+	err := c.CheckCRDs(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "does not serve tasks") {
+		t.Fatalf("CheckCRDs() error = %v, want missing tasks", err)
+	}
+
+	fake.Resources[0].APIResources = append(fake.Resources[0].APIResources, metav1.APIResource{Name: "tasks"})
+	if err := c.CheckCRDs(context.Background()); err != nil {
+		t.Fatalf("CheckCRDs() error = %v", err)
+	}
+}
+
+func TestFollowIgnoresOutOfOrderEvents(t *testing.T) {
+	c, _, _ := newTestClient()
+	taskRun := func(rv string, done bool) *tektonv1.TaskRun {
+		tr := &tektonv1.TaskRun{ObjectMeta: metav1.ObjectMeta{Name: "tr", ResourceVersion: rv}}
+		status := corev1.ConditionUnknown
+		if done {
+			status = corev1.ConditionTrue
+		}
+		tr.Status.SetCondition(&apis.Condition{Type: apis.ConditionSucceeded, Status: status})
+		return tr
+	}
+	before := testutil.ToFloat64(metrics.TektonWatchEventsIgnored.WithLabelValues("stale"))
+
+	w := watch.NewFakeWithChanSize(4, false)
+	w.Modify(taskRun("3", true)) // replayed from before the current state
+	w.Modify(taskRun("7", false))
+	w.Modify(taskRun("7", false)) // duplicate
+	w.Stop()
+
+	tr, ended, err := c.follow(context.Background(), w, taskRun("5", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ended || tr.ResourceVersion != "7" || tr.IsDone() {
+		t.Fatalf("follow() = rv %s done %v ended %v, want rv 7 still running", tr.ResourceVersion, tr.IsDone(), ended)
+	}
+	if got := testutil.ToFloat64(metrics.TektonWatchEventsIgnored.WithLabelValues("stale")) - before; got != 1 {
+		t.Fatalf("stale events counted = %v, want 1", got)
+	}
+
+	if got := c.reconcile(taskRun("9", true), taskRun("10", false)); !got.IsDone() {
+		t.Fatal("a later event reverted a finished TaskRun")
+	}
+}
+
+func TestRunJobRetriesRetryableErrors(t *testing.T) {
+	c, tc, _ := newTestClient()
+	c.cfg.RetryCount = 3
+	c.cfg.RetryBaseDelay = time.Millisecond
+	c.cfg.RetryMaxDelay = 2 * time.Millisecond
+	before := testutil.ToFloat64(metrics.TektonAPIRetries.WithLabelValues("create_taskrun"))
+
+	failures := 2
+	tc.PrependReactor("create", "taskruns", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if failures == 0 {
+			return false, nil, nil
+		}
+		failures--
+		return true, nil, apierrors.NewServiceUnavailable("etcd leader changed")
+	})
+
+	run, job := testJob(nil)
+	go finish(t, tc, "run-1-build", corev1.ConditionTrue, "Succeeded")
+	if err := c.RunJob(context.Background(), run, job); err != nil {
+		t.Fatalf("RunJob() error = %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.TektonAPIRetries.WithLabelValues("create_taskrun")) - before; got != 2 {
+		t.Errorf("create_taskrun retries = %v, want 2", got)
+	}
+}
+
+func TestRunJobDoesNotRetryClientErrors(t *testing.T) {
+	c, tc, _ := newTestClient()
+	c.cfg.RetryCount = 3
+	c.cfg.RetryBaseDelay = time.Millisecond
+
+	calls := 0
+	tc.PrependReactor("create", "taskruns", func(k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		return true, nil, apierrors.NewInvalid(schema.GroupKind{Group: "tekton.dev", Kind: "TaskRun"}, "run-1-build", nil)
+	})
+
+	run, job := testJob(nil)
+	if err := c.RunJob(context.Background(), run, job); !apierrors.IsInvalid(err) {
+		t.Fatalf("RunJob() error = %v, want the validation failure", err)
+	}
+	if calls != 1 {
+		t.Errorf("create attempts = %d, want 1", calls)
+	}
+}
+
+func TestRetryGivesUpAfterRetryCount(t *testing.T) {
+	c, _, _ := newTestClient()
+	c.cfg.RetryCount = 2
+	c.cfg.RetryBaseDelay = time.Millisecond
+
+	calls := 0
+	err := c.retry(context.Background(), "get_taskrun", func() error {
+		calls++
+		return apierrors.NewTooManyRequests("slow down", 0)
+	})
+	if !apierrors.IsTooManyRequests(err) || calls != 3 {
+		t.Errorf("retry() = %v after %d calls, want the last error after 3", err, calls)
+	}
+}
+
+func TestCancelTaskRunsOfAPipeline(t *testing.T) {
+	c, tc, _ := newTestClient()
+	taskRuns := tc.TektonV1().TaskRuns(testNamespace)
+	create := func(name, pipelineID string) {
+		tr := &tektonv1.TaskRun{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace, Labels: map[string]string{LabelPipelineID: pipelineID}}}
+		if _, err := taskRuns.Create(context.Background(), tr, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create("run-1-build", "run-1")
+	create("run-1-test", "run-1")
+	create("run-2-build", "run-2")
+	finish(t, tc, "run-1-test", corev1.ConditionTrue, "Succeeded")
+
+	n, err := c.CancelTaskRuns(context.Background(), "run-1")
+	if err != nil || n != 1 {
+		t.Fatalf("CancelTaskRuns() = %d, %v; want 1", n, err)
+	}
+	for name, want := range map[string]tektonv1.TaskRunSpecStatus{
+		"run-1-build": tektonv1.TaskRunSpecStatusCancelled,
+		"run-1-test":  "",
+		"run-2-build": "",
+	} {
+		tr, err := taskRuns.Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr.Spec.Status != want {
+			t.Errorf("%s: spec.status = %q, want %q", name, tr.Spec.Status, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package tekton
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// timeoutTransport bounds every Kubernetes API call but watches by
+// tekton.api_timeout, so a slow API server fails the call instead of hanging
+// the job that made it. Watches are long-lived by design and are bounded by
+// the job's context instead. rest.Config.Timeout is not used because it
+// applies to watches as well.
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+	logger  *logrus.Logger
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if watching(req) {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		t.abandoned(ctx, req)
+		cancel()
+		return nil, err
+	}
+	// The deadline covers reading the body too, so it is only released once
+	// the caller is done with it.
+	resp.Body = &timeoutBody{ReadCloser: resp.Body, ctx: ctx, cancel: cancel, t: t, req: req}
+	return resp, nil
+}
+
+// abandoned logs req when it was cut short by the API timeout rather than by
+// its caller.
+func (t *timeoutTransport) abandoned(ctx context.Context, req *http.Request) {
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) || req.Context().Err() != nil {
+		return
+	}
+	t.logger.WithFields(logrus.Fields{
+		"method":  req.Method,
+		"path":    req.URL.Path,
+		"timeout": t.timeout,
+	}).Warn("Abandoned Kubernetes API call after tekton.api_timeout")
+}
+
+type timeoutBody struct {
+	io.ReadCloser
+	ctx    context.Context
+	cancel context.CancelFunc
+	t      *timeoutTransport
+	req    *http.Request
+	failed bool
+}
+
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && !b.failed {
+		b.failed = true
+		b.t.abandoned(b.ctx, b.req)
+	}
+	return n, err
+}
+
+func (b *timeoutBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func watching(req *http.Request) bool {
+	switch req.URL.Query().Get("watch") {
+	case "true", "1":
+		return true
+	}
+	return false
+}
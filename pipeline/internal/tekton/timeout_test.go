@@ -0,0 +1,63 @@
+package tekton
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTimeoutTransportAbandonsSlowCalls(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	logger, hook := test.NewNullLogger()
+	client := &http.Client{Transport: &timeoutTransport{next: http.DefaultTransport, timeout: 50 * time.Millisecond, logger: logger}}
+
+	start := time.Now()
+	if _, err := client.Get(srv.URL + "/apis/tekton.dev/v1/namespaces/ci/taskruns/x"); err == nil {
+		t.Fatal("expected the slow call to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("call took %s, want it abandoned after the timeout", elapsed)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.WarnLevel || entry.Data["path"] != "/apis/tekton.dev/v1/namespaces/ci/taskruns/x" {
+		t.Fatalf("expected a warning for the abandoned call, got %+v", entry)
+	}
+}
+
+func TestTimeoutTransportLeavesWatchesOpen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	logger, hook := test.NewNullLogger()
+	client := &http.Client{Transport: &timeoutTransport{next: http.DefaultTransport, timeout: 50 * time.Millisecond, logger: logger}}
+
+	resp, err := client.Get(srv.URL + "/apis/tekton.dev/v1/namespaces/ci/taskruns?watch=true")
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatalf("failed to read watch: %v", err)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Fatalf("unexpected log entries: %v", hook.AllEntries())
+	}
+}
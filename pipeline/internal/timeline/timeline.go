@@ -0,0 +1,203 @@
+// Package timeline reconstructs a finished run as an OpenTelemetry trace from
+// its recorded timings and exports it over OTLP/HTTP on demand.
+//
+// This gives a trace of any stored run, including runs executed while live
+// tracing was disabled. Trace and span IDs are derived from the run, stage
+// and job IDs, so exporting the same run twice yields the same trace rather
+// than a duplicate.
+package timeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+const scopeName = "github.com/devmind-pipeline/pipeline/timeline"
+
+// Trace is a reconstructed run.
+type Trace struct {
+	// TraceID is the hex trace ID to look the run up by in the backend.
+	TraceID string
+	Spans   []*tracepb.Span
+}
+
+// Build reconstructs run as a trace: one root span for the run, a child per
+// stage, finally stage or post-run hook spanning its jobs and a grandchild
+// per job. Jobs that never started have no span. Build fails for runs that have not started.
+func Build(run *pipeline.Run) (*Trace, error) {
+	if run.StartedAt == nil {
+		return nil, fmt.Errorf("run %s has not started", run.ID)
+	}
+	traceID := derive(16, "trace", run.ID)
+	rootID := derive(8, "run", run.ID)
+
+	end := time.Now().UTC()
+	if run.FinishedAt != nil {
+		end = *run.FinishedAt
+	}
+	root := span(traceID, rootID, nil, "pipeline.run", *run.StartedAt, end, run.Status, run.Reason)
+	root.Attributes = append(root.Attributes,
+		stringKV("pipeline.id", run.ID),
+		stringKV("pipeline.name", run.Spec.Name),
+	)
+	spans := []*tracepb.Span{root}
+
+	all := append(append([]pipeline.StageResult(nil), run.Stages...), run.Finally...)
+	if run.PostRun != nil {
+		all = append(all, *run.PostRun)
+	}
+	for i, st := range all {
+		finally := i >= len(run.Stages) && i < len(run.Stages)+len(run.Finally)
+		postRun := i == len(run.Stages)+len(run.Finally)
+		stageID := derive(8, "stage", run.ID, st.Name)
+		var jobs []*tracepb.Span
+		var first, last time.Time
+		for _, j := range st.Jobs {
+			if j.StartedAt == nil {
+				continue
+			}
+			jobEnd := end
+			if j.FinishedAt != nil {
+				jobEnd = *j.FinishedAt
+			}
+			if first.IsZero() || j.StartedAt.Before(first) {
+				first = *j.StartedAt
+			}
+			if jobEnd.After(last) {
+				last = jobEnd
+			}
+
+			js := span(traceID, derive(8, "job", run.ID, j.ID), stageID, "pipeline.job", *j.StartedAt, jobEnd, j.Status, j.Message)
+			js.Attributes = append(js.Attributes, stringKV("pipeline.stage", st.Name), stringKV("pipeline.job", j.ID))
+			for _, k := range sortedKeys(j.Matrix) {
+				js.Attributes = append(js.Attributes, stringKV("pipeline.matrix."+k, j.Matrix[k]))
+			}
+			jobs = append(jobs, js)
+		}
+		if len(jobs) == 0 {
+			continue
+		}
+		ss := span(traceID, stageID, rootID, "pipeline.stage", first, last, st.Status, "")
+		ss.Attributes = append(ss.Attributes, stringKV("pipeline.stage", st.Name))
+		if finally {
+			ss.Attributes = append(ss.Attributes, &commonpb.KeyValue{Key: "pipeline.stage.finally", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}})
+		}
+		if postRun {
+			ss.Attributes = append(ss.Attributes, &commonpb.KeyValue{Key: "pipeline.stage.post_run", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}})
+		}
+		spans = append(spans, ss)
+		spans = append(spans, jobs...)
+	}
+
+	return &Trace{TraceID: hex.EncodeToString(traceID), Spans: spans}, nil
+}
+
+// Exporter sends reconstructed traces to an OTLP/HTTP collector.
+type Exporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+}
+
+// NewExporter creates an Exporter posting to endpoint + "/v1/traces" over
+// client.
+func NewExporter(endpoint, serviceName string, client *http.Client) *Exporter {
+	return &Exporter{
+		url:         strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName: serviceName,
+		client:      client,
+	}
+}
+
+// Export reconstructs run and sends it to the collector.
+func (e *Exporter) Export(ctx context.Context, run *pipeline.Run) (*Trace, error) {
+	tr, err := Build(run)
+	if err != nil {
+		return nil, err
+	}
+	body, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringKV("service.name", e.serviceName)}},
+			ScopeSpans: []*tracepb.ScopeSpans{{
+				Scope: &commonpb.InstrumentationScope{Name: scopeName},
+				Spans: tr.Spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode trace: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export trace: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("failed to export trace: collector returned %s", resp.Status)
+	}
+	return tr, nil
+}
+
+func span(traceID, spanID, parentID []byte, name string, start, end time.Time, status pipeline.Status, message string) *tracepb.Span {
+	s := &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		ParentSpanId:      parentID,
+		Name:              name,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes:        []*commonpb.KeyValue{stringKV("pipeline.status", string(status))},
+		Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK},
+	}
+	switch status {
+	case pipeline.StatusFailed, pipeline.StatusTimedOut:
+		s.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: message}
+	case pipeline.StatusSucceeded, pipeline.StatusCached:
+	default:
+		s.Status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_UNSET, Message: message}
+	}
+	return s
+}
+
+// derive returns n bytes of an ID determined by parts alone.
+func derive(n int, parts ...string) []byte {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return sum[:n]
+}
+
+func stringKV(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,95 @@
+package timeline
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/devmind-pipeline/pipeline/internal/pipeline"
+)
+
+func at(base time.Time, d time.Duration) *time.Time {
+	t := base.Add(d)
+	return &t
+}
+
+func testRun() *pipeline.Run {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	return &pipeline.Run{
+		ID:         "run-1",
+		Spec:       pipeline.Spec{Name: "build"},
+		Status:     pipeline.StatusFailed,
+		StartedAt:  at(base, 0),
+		FinishedAt: at(base, 10*time.Minute),
+		Stages: []pipeline.StageResult{
+			{Name: "test", Status: pipeline.StatusFailed, Jobs: []pipeline.JobResult{
+				{ID: "test-linux", Status: pipeline.StatusSucceeded, Matrix: map[string]string{"os": "linux"}, StartedAt: at(base, time.Minute), FinishedAt: at(base, 4*time.Minute)},
+				{ID: "test-darwin", Status: pipeline.StatusFailed, Message: "exit 1", StartedAt: at(base, 2*time.Minute), FinishedAt: at(base, 6*time.Minute)},
+			}},
+			{Name: "deploy", Status: pipeline.StatusSkipped, Jobs: []pipeline.JobResult{{ID: "deploy", Status: pipeline.StatusSkipped}}},
+		},
+	}
+}
+
+func TestBuildReconstructsHierarchy(t *testing.T) {
+	tr, err := Build(testRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Root, one stage and its two jobs; the skipped stage never ran.
+	if len(tr.Spans) != 4 {
+		t.Fatalf("got %d spans, want 4", len(tr.Spans))
+	}
+	root, stage, failed := tr.Spans[0], tr.Spans[1], tr.Spans[3]
+	if len(root.ParentSpanId) != 0 || !bytes.Equal(stage.ParentSpanId, root.SpanId) || !bytes.Equal(failed.ParentSpanId, stage.SpanId) {
+		t.Fatal("spans are not parented run -> stage -> job")
+	}
+	if got := time.Duration(stage.EndTimeUnixNano - stage.StartTimeUnixNano); got != 5*time.Minute {
+		t.Errorf("stage span lasts %s, want it to cover its jobs (5m)", got)
+	}
+	if failed.Status.Code != tracepb.Status_STATUS_CODE_ERROR || failed.Status.Message != "exit 1" {
+		t.Errorf("failed job status = %v", failed.Status)
+	}
+
+	again, _ := Build(testRun())
+	if again.TraceID != tr.TraceID || !bytes.Equal(again.Spans[2].SpanId, tr.Spans[2].SpanId) {
+		t.Error("IDs are not deterministic")
+	}
+}
+
+func TestBuildRejectsUnstartedRun(t *testing.T) {
+	if _, err := Build(&pipeline.Run{ID: "queued"}); err == nil {
+		t.Fatal("expected an error for a run that never started")
+	}
+}
+
+func TestExportPostsToCollector(t *testing.T) {
+	var got coltracepb.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+	}))
+	defer collector.Close()
+
+	tr, err := NewExporter(collector.URL, "pipeline-engine", &http.Client{Timeout: time.Second}).Export(context.Background(), testRun())
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	spans := got.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != len(tr.Spans) {
+		t.Fatalf("collector got %d spans, want %d", len(spans), len(tr.Spans))
+	}
+}
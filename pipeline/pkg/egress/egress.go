@@ -0,0 +1,151 @@
+// Package egress builds the transports of the engine's outbound HTTP
+// clients, so every one of them reaches the outside world the same way.
+//
+// With network.http_proxy set, HTTP and HTTPS requests go through that proxy
+// except to the hosts listed in network.no_proxy. Without it, the standard
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply. A client
+// listed in network.overrides uses its own proxy instead, or connects
+// directly when the override is "direct".
+package egress
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Direct, as a proxy override, makes a client bypass every proxy.
+const Direct = "direct"
+
+// Names of the outbound clients, as used for network.overrides.
+const (
+	ClientAIService   = "ai_service"
+	ClientArgoCD      = "argocd"
+	ClientCredentials = "credentials"
+	ClientPolicy      = "policy"
+	ClientTimeline    = "timeline"
+	ClientLogging     = "logging"
+	ClientTracing     = "tracing"
+	ClientHealthCheck = "health_check"
+	ClientAuth        = "auth"
+)
+
+var clients = []string{
+	ClientAIService, ClientArgoCD, ClientCredentials, ClientPolicy,
+	ClientTimeline, ClientLogging, ClientTracing, ClientHealthCheck,
+	ClientAuth,
+}
+
+// Config holds the outbound proxy settings.
+type Config struct {
+	// HTTPProxy is the proxy URL outbound requests go through. Empty
+	// defers to the proxy environment variables.
+	HTTPProxy string `mapstructure:"http_proxy"`
+	// NoProxy lists the hosts, domains (".example.com") and CIDRs reached
+	// without HTTPProxy, in the NO_PROXY format.
+	NoProxy []string `mapstructure:"no_proxy"`
+	// Overrides maps a client name to the proxy URL it uses instead of
+	// HTTPProxy, or to "direct".
+	Overrides map[string]string `mapstructure:"overrides"`
+}
+
+// FromViper decodes the network settings registered with viper, for the
+// packages configured from viper directly.
+func FromViper() (Config, error) {
+	var cfg Config
+	if err := viper.UnmarshalKey("network", &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to decode network configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// Validate checks the proxy URLs and override names of cfg.
+func (cfg Config) Validate() error {
+	if err := checkProxy("network.http_proxy", cfg.HTTPProxy); err != nil {
+		return err
+	}
+	for name, proxy := range cfg.Overrides {
+		if !known(name) {
+			return fmt.Errorf("network.overrides.%s: unknown client (%s)", name, strings.Join(clients, ", "))
+		}
+		if proxy == Direct {
+			continue
+		}
+		if err := checkProxy("network.overrides."+name, proxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transport returns a transport for the named client that goes through the
+// proxy configured for it. An invalid proxy URL fails every request; call
+// Validate at startup to catch it earlier.
+func (cfg Config) Transport(client string) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = cfg.proxyFunc(client)
+	return t
+}
+
+// Client returns an HTTP client for the named client with the given
+// timeout, sending through Transport.
+func (cfg Config) Client(client string, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: cfg.Transport(client)}
+}
+
+func (cfg Config) proxyFunc(client string) func(*http.Request) (*url.URL, error) {
+	proxy, overridden := cfg.Overrides[client]
+	if !overridden {
+		proxy = cfg.HTTPProxy
+	}
+	switch {
+	case proxy == Direct:
+		return nil
+	case proxy == "":
+		return http.ProxyFromEnvironment
+	}
+
+	pc := &httpproxy.Config{HTTPProxy: proxy, HTTPSProxy: proxy}
+	if !overridden {
+		// An override is the client's own decision, so no_proxy only
+		// carves exceptions out of the shared proxy.
+		pc.NoProxy = strings.Join(cfg.NoProxy, ",")
+	}
+	fn := pc.ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return fn(req.URL)
+	}
+}
+
+func checkProxy(key, proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("%s: invalid proxy URL: %w", key, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("%s: proxy URL %q must use http, https or socks5", key, proxy)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%s: proxy URL %q has no host", key, proxy)
+	}
+	return nil
+}
+
+func known(client string) bool {
+	for _, c := range clients {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
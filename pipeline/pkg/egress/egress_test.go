@@ -0,0 +1,77 @@
+package egress
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func proxyFor(t *testing.T, cfg Config, client, target string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cfg.Transport(client).Proxy
+	if p == nil {
+		return ""
+	}
+	u, err := p(req)
+	if err != nil {
+		t.Fatalf("proxy(%s) error = %v", target, err)
+	}
+	if u == nil {
+		return ""
+	}
+	return u.String()
+}
+
+func TestTransportHonorsProxyNoProxyAndOverrides(t *testing.T) {
+	cfg := Config{
+		HTTPProxy: "http://proxy.corp:3128",
+		NoProxy:   []string{".svc.cluster.local", "10.0.0.0/8"},
+		Overrides: map[string]string{
+			ClientArgoCD: Direct,
+			ClientPolicy: "http://opa-proxy.corp:8080",
+		},
+	}
+	for _, tc := range []struct {
+		client, target, want string
+	}{
+		{ClientAIService, "https://ml.example.com/select", "http://proxy.corp:3128"},
+		{ClientAIService, "http://ml-service.devmind.svc.cluster.local/select", ""},
+		{ClientHealthCheck, "http://10.1.2.3/healthz", ""},
+		{ClientArgoCD, "https://argocd.example.com/api", ""},
+		{ClientPolicy, "https://opa.example.com/v1/data", "http://opa-proxy.corp:8080"},
+	} {
+		if got := proxyFor(t, cfg, tc.client, tc.target); got != tc.want {
+			t.Errorf("%s %s: proxy = %q, want %q", tc.client, tc.target, got, tc.want)
+		}
+	}
+}
+
+func TestTransportDefersToEnvironment(t *testing.T) {
+	if p := (Config{}).Transport(ClientTimeline).Proxy; p == nil {
+		t.Fatal("no proxy func without network.http_proxy, want the environment's")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{HTTPProxy: "proxy.corp:3128"}, "must use http, https or socks5"},
+		{Config{HTTPProxy: "http://"}, "has no host"},
+		{Config{Overrides: map[string]string{"notifier": Direct}}, "unknown client"},
+		{Config{Overrides: map[string]string{ClientArgoCD: "ftp://proxy"}}, "network.overrides.argocd"},
+	} {
+		if err := tc.cfg.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Validate(%+v) = %v, want %q", tc.cfg, err, tc.want)
+		}
+	}
+	ok := Config{HTTPProxy: "http://proxy.corp:3128", Overrides: map[string]string{ClientArgoCD: Direct}}
+	if err := ok.Validate(); err != nil {
+		t.Errorf("Validate(%+v) = %v", ok, err)
+	}
+}
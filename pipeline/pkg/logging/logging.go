@@ -0,0 +1,140 @@
+// Package logging builds the engine logger and carries per-request log
+// fields through a context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+// stderr receives diagnostics about the logging pipeline itself.
+var stderr io.Writer = os.Stderr
+
+var exporter *OTLPHook
+
+// NewLogger returns a logger configured from logging.level and
+// logging.format. Unknown levels fall back to info. Every entry is redacted
+// as configured by logging.redact before it is written. With logging.exporter
+// set to "otlp", entries are also shipped to logging.otlp.endpoint; stdout
+// output is kept so the pod logs stay usable when the collector is down.
+func NewLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+
+	level, err := logrus.ParseLevel(viper.GetString("logging.level"))
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+
+	if viper.GetString("logging.format") == "text" {
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	} else {
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	}
+
+	// First, so no other hook sees an entry before it is redacted.
+	fields := viper.GetStringSlice("logging.redact.fields")
+	redact, err := NewRedactHook(fields, viper.GetStringSlice("logging.redact.patterns"))
+	if err != nil {
+		logger.WithError(err).Warn("Invalid redaction pattern, redacting the default patterns only")
+		redact, _ = NewRedactHook(fields, nil)
+	}
+	logger.AddHook(redact)
+
+	switch exp := viper.GetString("logging.exporter"); exp {
+	case "", "stdout":
+	case "otlp":
+		network, err := egress.FromViper()
+		if err != nil {
+			logger.WithError(err).Warn("Failed to start OTLP log exporter, logging to stdout only")
+			break
+		}
+		hook, err := NewOTLPHook(OTLPOptions{
+			Endpoint:    viper.GetString("logging.otlp.endpoint"),
+			Headers:     viper.GetStringMapString("logging.otlp.headers"),
+			Timeout:     viper.GetDuration("logging.otlp.timeout"),
+			ServiceName: viper.GetString("tracing.service_name"),
+			Transport:   network.Transport(egress.ClientLogging),
+		})
+		if err != nil {
+			logger.WithError(err).Warn("Failed to start OTLP log exporter, logging to stdout only")
+			break
+		}
+		exporter = hook
+		logger.AddHook(hook)
+	default:
+		logger.WithField("exporter", exp).Warn("Unknown log exporter, logging to stdout only")
+	}
+	return logger
+}
+
+// Shutdown flushes log records buffered for the OTLP exporter. It is a no-op
+// when the exporter is not in use.
+func Shutdown(ctx context.Context) error {
+	if exporter == nil {
+		return nil
+	}
+	if err := exporter.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to flush log records: %w", err)
+	}
+	return nil
+}
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields in addition to any
+// already attached. Later values win on key conflicts.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	parent := Fields(ctx)
+	merged := make(logrus.Fields, len(parent)+len(fields))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Fields returns the log fields attached to ctx. The result must not be
+// modified.
+func Fields(ctx context.Context) logrus.Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return fields
+}
+
+// FromContext returns an entry of logger carrying the fields attached to ctx.
+// The entry keeps ctx too, so exporters can pick up the active span.
+func FromContext(ctx context.Context, logger *logrus.Logger) *logrus.Entry {
+	return logger.WithContext(ctx).WithFields(Fields(ctx))
+}
+
+// RequestIDHeader carries the correlation ID of a request, on HTTP and as
+// gRPC metadata, across the services handling it.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the correlation ID id, both
+// for RequestID and as the request_id log field.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	return WithFields(ctx, logrus.Fields{"request_id": id})
+}
+
+// RequestID returns the correlation ID attached to ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
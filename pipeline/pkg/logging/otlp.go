@@ -0,0 +1,309 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	otlpBatchSize     = 512
+	otlpQueueSize     = 4096
+	otlpFlushInterval = time.Second
+	otlpScopeName     = "github.com/devmind-pipeline/pipeline"
+)
+
+// OTLPOptions configures an OTLPHook.
+type OTLPOptions struct {
+	// Endpoint is the collector base URL; records are posted to
+	// Endpoint + "/v1/logs".
+	Endpoint    string
+	Headers     map[string]string
+	Timeout     time.Duration
+	ServiceName string
+	// Transport sends the export requests. Nil uses
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// OTLPHook is a logrus hook that ships every entry as an OTLP log record
+// over HTTP. Entries logged with a context carrying a span (see FromContext)
+// get its trace and span IDs, so the backend can correlate logs with traces.
+//
+// Records are batched and sent in the background. When the collector falls
+// behind, new records are dropped rather than blocking the logging caller.
+type OTLPHook struct {
+	url      string
+	headers  map[string]string
+	client   *http.Client
+	resource *resourcepb.Resource
+
+	queue chan *logspb.LogRecord
+	flush chan chan error
+	done  chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewOTLPHook starts the background exporter. Call Shutdown to flush it.
+func NewOTLPHook(opts OTLPOptions) (*OTLPHook, error) {
+	if opts.Endpoint == "" {
+		return nil, fmt.Errorf("logging.otlp.endpoint is required for the otlp exporter")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	h := &OTLPHook{
+		url:     strings.TrimSuffix(opts.Endpoint, "/") + "/v1/logs",
+		headers: opts.Headers,
+		client:  &http.Client{Timeout: opts.Timeout, Transport: opts.Transport},
+		resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringKV("service.name", opts.ServiceName),
+		}},
+		queue: make(chan *logspb.LogRecord, otlpQueueSize),
+		flush: make(chan chan error),
+		done:  make(chan struct{}),
+	}
+	h.wg.Add(1)
+	go h.loop()
+	return h, nil
+}
+
+// Levels implements logrus.Hook.
+func (h *OTLPHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. Fatal and panic entries are flushed before
+// returning because the process is about to stop.
+func (h *OTLPHook) Fire(entry *logrus.Entry) error {
+	select {
+	case h.queue <- record(entry):
+	default:
+		h.mu.Lock()
+		h.dropped++
+		h.mu.Unlock()
+	}
+	if entry.Level <= logrus.FatalLevel {
+		ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+		defer cancel()
+		return h.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends every queued record.
+func (h *OTLPHook) Flush(ctx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case h.flush <- reply:
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-reply:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown flushes queued records and stops the exporter.
+func (h *OTLPHook) Shutdown(ctx context.Context) error {
+	err := h.Flush(ctx)
+	h.once.Do(func() { close(h.done) })
+	h.wg.Wait()
+	return err
+}
+
+func (h *OTLPHook) loop() {
+	defer h.wg.Done()
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	var batch []*logspb.LogRecord
+	send := func() error {
+		drained := h.drain(batch)
+		batch = nil
+		if len(drained) == 0 {
+			return nil
+		}
+		return h.export(drained)
+	}
+
+	for {
+		select {
+		case rec := <-h.queue:
+			batch = append(batch, rec)
+			if len(batch) >= otlpBatchSize {
+				h.report(send())
+			}
+		case <-ticker.C:
+			h.report(send())
+		case reply := <-h.flush:
+			reply <- send()
+		case <-h.done:
+			h.report(send())
+			return
+		}
+	}
+}
+
+// drain appends whatever is queued without blocking.
+func (h *OTLPHook) drain(batch []*logspb.LogRecord) []*logspb.LogRecord {
+	for {
+		select {
+		case rec := <-h.queue:
+			batch = append(batch, rec)
+		default:
+			return batch
+		}
+	}
+}
+
+func (h *OTLPHook) export(records []*logspb.LogRecord) error {
+	body, err := proto.Marshal(&collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: h.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: otlpScopeName},
+				LogRecords: records,
+			}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode log records: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build OTLP request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export log records: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to export log records: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// report writes export failures to stderr; logging them through logrus
+// would feed them straight back into the failing exporter.
+func (h *OTLPHook) report(err error) {
+	h.mu.Lock()
+	dropped := h.dropped
+	h.dropped = 0
+	h.mu.Unlock()
+
+	if err != nil {
+		fmt.Fprintf(stderr, "otlp log exporter: %v\n", err)
+	}
+	if dropped > 0 {
+		fmt.Fprintf(stderr, "otlp log exporter: dropped %d records, queue full\n", dropped)
+	}
+}
+
+func record(entry *logrus.Entry) *logspb.LogRecord {
+	rec := &logspb.LogRecord{
+		TimeUnixNano:         uint64(entry.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severity(entry.Level),
+		SeverityText:         strings.ToUpper(entry.Level.String()),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: entry.Message}},
+	}
+
+	keys := make([]string, 0, len(entry.Data))
+	for k := range entry.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rec.Attributes = append(rec.Attributes, &commonpb.KeyValue{Key: k, Value: anyValue(entry.Data[k])})
+	}
+
+	if entry.Context != nil {
+		if sc := trace.SpanContextFromContext(entry.Context); sc.IsValid() {
+			traceID, spanID := sc.TraceID(), sc.SpanID()
+			rec.TraceId = traceID[:]
+			rec.SpanId = spanID[:]
+			rec.Flags = uint32(sc.TraceFlags())
+		}
+	}
+	return rec
+}
+
+func severity(level logrus.Level) logspb.SeverityNumber {
+	switch level {
+	case logrus.TraceLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_TRACE
+	case logrus.DebugLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case logrus.InfoLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case logrus.WarnLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case logrus.ErrorLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case logrus.FatalLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4
+	}
+}
+
+func anyValue(v interface{}) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+	case uint32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case error:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.Error()}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(v)}}
+	}
+}
+
+func stringKV(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
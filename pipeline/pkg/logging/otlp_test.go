@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLPHookExportsRecordsWithTraceContext(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		records []*logspb.LogRecord
+		auth    string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" {
+			t.Errorf("path = %s, want /v1/logs", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req collogspb.ExportLogsServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("failed to decode export request: %v", err)
+		}
+		mu.Lock()
+		auth = r.Header.Get("Authorization")
+		for _, rl := range req.ResourceLogs {
+			for _, sl := range rl.ScopeLogs {
+				records = append(records, sl.LogRecords...)
+			}
+		}
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	hook, err := NewOTLPHook(OTLPOptions{
+		Endpoint:    collector.URL,
+		Headers:     map[string]string{"Authorization": "Bearer t"},
+		ServiceName: "pipeline-engine",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(hook)
+
+	traceID := trace.TraceID{1, 2, 3}
+	spanID := trace.SpanID{4, 5, 6}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = WithFields(ctx, logrus.Fields{"pipeline_id": "run-1"})
+	FromContext(ctx, logger).WithField("attempt", 2).Warn("Stage failed")
+
+	if err := hook.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if auth != "Bearer t" {
+		t.Errorf("Authorization = %q, want configured header", auth)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	rec := records[0]
+	if rec.Body.GetStringValue() != "Stage failed" || rec.SeverityNumber != logspb.SeverityNumber_SEVERITY_NUMBER_WARN {
+		t.Errorf("record = %q %v, want warn %q", rec.Body.GetStringValue(), rec.SeverityNumber, "Stage failed")
+	}
+	if string(rec.TraceId) != string(traceID[:]) || string(rec.SpanId) != string(spanID[:]) {
+		t.Errorf("trace context = %x/%x, want %x/%x", rec.TraceId, rec.SpanId, traceID, spanID)
+	}
+	attrs := map[string]string{}
+	for _, kv := range rec.Attributes {
+		attrs[kv.Key] = kv.Value.String()
+	}
+	if _, ok := attrs["pipeline_id"]; !ok {
+		t.Errorf("context fields not exported: %v", attrs)
+	}
+	if _, ok := attrs["attempt"]; !ok {
+		t.Errorf("entry fields not exported: %v", attrs)
+	}
+}
@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces every value the RedactHook removes.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactFields are the field names always redacted;
+// logging.redact.fields adds to them.
+var DefaultRedactFields = []string{"password", "token", "secret", "authorization"}
+
+// tokenPatterns match the credential formats always redacted, those
+// pipeline.secret_scan looks for and bearer credentials;
+// logging.redact.patterns adds to them.
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`),
+	regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}\b`),
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}\b`),
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`),
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`),
+	regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`),
+}
+
+// RedactHook is a logrus hook that removes secrets from every entry before
+// it is written or exported, so it must be added before any other hook.
+//
+// A field is redacted whole when its name contains a sensitive name as a
+// word: names split at underscores, dashes, dots and case changes, so
+// db_password and accessToken are redacted along with password and token.
+// Structs and maps logged as a field have their sensitive keys redacted the
+// same way. Matches of the token patterns are replaced in the message and
+// in every string value.
+type RedactHook struct {
+	fields   [][]string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactHook returns a hook redacting the default fields and token
+// formats in addition to fields and the regular expressions of patterns.
+func NewRedactHook(fields, patterns []string) (*RedactHook, error) {
+	h := &RedactHook{patterns: append([]*regexp.Regexp(nil), tokenPatterns...)}
+	for _, name := range append(append([]string(nil), DefaultRedactFields...), fields...) {
+		if words := nameWords(name); len(words) > 0 {
+			h.fields = append(h.fields, words)
+		}
+	}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile redaction pattern %q: %w", p, err)
+		}
+		h.patterns = append(h.patterns, re)
+	}
+	return h, nil
+}
+
+// Levels implements logrus.Hook.
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook. The entry's fields are its own copy, so they
+// are redacted in place.
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactString(entry.Message)
+	for k, v := range entry.Data {
+		if h.sensitive(k) {
+			entry.Data[k] = Redacted
+			continue
+		}
+		if r, changed := h.redactValue(v); changed {
+			entry.Data[k] = r
+		}
+	}
+	return nil
+}
+
+// redactValue returns v with its secrets removed and whether there were
+// any. Composite values are walked through their JSON form, which is also
+// how the JSON formatter renders them.
+func (h *RedactHook) redactValue(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case string:
+		r := h.redactString(v)
+		return r, r != v
+	case error:
+		msg := v.Error()
+		r := h.redactString(msg)
+		return r, r != msg
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Pointer:
+	default:
+		return v, false
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v, false
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return v, false
+	}
+	if r, changed := h.redactJSON(doc); changed {
+		return r, true
+	}
+	return v, false
+}
+
+// RedactJSON returns the JSON document data with its secrets removed the way
+// they are from fields. Data that is not JSON is redacted as a message is.
+func (h *RedactHook) RedactJSON(data []byte) string {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return h.redactString(string(data))
+	}
+	doc, _ = h.redactJSON(doc)
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return h.redactString(string(data))
+	}
+	return string(out)
+}
+
+// RedactString returns s with the matches of the token patterns removed.
+func (h *RedactHook) RedactString(s string) string {
+	return h.redactString(s)
+}
+
+func (h *RedactHook) redactJSON(v interface{}) (interface{}, bool) {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if val != nil && h.sensitive(k) {
+				v[k], changed = Redacted, true
+				continue
+			}
+			if r, c := h.redactJSON(val); c {
+				v[k], changed = r, true
+			}
+		}
+	case []interface{}:
+		for i, val := range v {
+			if r, c := h.redactJSON(val); c {
+				v[i], changed = r, true
+			}
+		}
+	case string:
+		r := h.redactString(v)
+		return r, r != v
+	}
+	return v, changed
+}
+
+func (h *RedactHook) redactString(s string) string {
+	for _, re := range h.patterns {
+		s = re.ReplaceAllLiteralString(s, Redacted)
+	}
+	return s
+}
+
+// sensitive reports whether the words of a sensitive name appear in order
+// among those of name.
+func (h *RedactHook) sensitive(name string) bool {
+	words := nameWords(name)
+	for _, field := range h.fields {
+		for i := 0; i+len(field) <= len(words); i++ {
+			if equalWords(words[i:i+len(field)], field) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// nameWords splits name into lowercase words at non-alphanumeric characters
+// and case changes: "DBPassword" is "db" and "password".
+func nameWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := -1
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if start >= 0 {
+				words = append(words, strings.ToLower(string(runes[start:i])))
+			}
+			start = -1
+		case start < 0:
+			start = i
+		case unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])):
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, strings.ToLower(string(runes[start:])))
+	}
+	return words
+}
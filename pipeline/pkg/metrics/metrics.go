@@ -0,0 +1,630 @@
+// Package metrics defines the Prometheus collectors exported by the engine.
+//
+// Collectors are usable as soon as the package is loaded so that code paths
+// exercised in tests never have to nil-check them. Initialize rebuilds them
+// under the configured namespace and registers them with the default
+// registry.
+package metrics
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+const (
+	// DefaultNamespace is used when metrics.namespace is not configured.
+	DefaultNamespace = "devmind_pipeline"
+	// DefaultMaxStageLabels is used when metrics.max_stage_labels is not
+	// configured.
+	DefaultMaxStageLabels = 200
+	// DefaultMaxPipelineLabels is used when metrics.max_pipeline_labels is
+	// not configured.
+	DefaultMaxPipelineLabels = 200
+	// DefaultMaxTenantLabels is used when metrics.max_tenant_labels is not
+	// configured.
+	DefaultMaxTenantLabels = 200
+	// MaxPriorityLabels caps the distinct run priorities used as metric
+	// labels. Priorities are meant to be a handful of levels.
+	MaxPriorityLabels = 10
+	// NoPriorityLabel is the priority label of runs without a priority.
+	NoPriorityLabel = "none"
+
+	// OverflowLabel replaces label values beyond the cardinality limit.
+	OverflowLabel = "other"
+)
+
+var (
+	// AISchemaMismatches counts ai-service responses whose schema version or
+	// shape the engine could not accept, labelled by endpoint and reason.
+	AISchemaMismatches *prometheus.CounterVec
+
+	// AILowConfidence counts AI recommendations ignored because their
+	// confidence was below ai_service.min_confidence, by endpoint.
+	AILowConfidence *prometheus.CounterVec
+
+	// AIEndpointFailures counts failed requests to an ai-service endpoint,
+	// by endpoint URL. Each failure fails over to the next endpoint.
+	AIEndpointFailures *prometheus.CounterVec
+
+	// AIRateLimited counts requests an ai-service endpoint answered with
+	// 429, by endpoint URL. They are not counted as failures.
+	AIRateLimited *prometheus.CounterVec
+
+	// APIRateLimited counts API requests refused by
+	// server.rate_limit_enabled, by api: http or grpc.
+	APIRateLimited *prometheus.CounterVec
+
+	// APIUnauthenticated counts API requests refused for want of valid
+	// credentials under auth.mode, by api: http or grpc.
+	APIUnauthenticated *prometheus.CounterVec
+
+	// AIBreakerState is the circuit breaker state of each ai-service
+	// endpoint, by endpoint URL: 0 closed, 1 open, 2 half-open. While every
+	// endpoint is open, pipelines run without AI enhancements.
+	AIBreakerState *prometheus.GaugeVec
+
+	// TestSelectionTests counts the tests of test_selection stages by
+	// outcome: "run" or "skipped" by AI test selection. Their sum is the
+	// size of the suites.
+	TestSelectionTests *prometheus.CounterVec
+
+	// BuildTimeEstimateRatio observes the actual build time of succeeded
+	// runs over the time the AI service's build optimization advice
+	// estimated for them: 1 is a perfect estimate, above 1 a build slower
+	// than predicted.
+	BuildTimeEstimateRatio prometheus.Histogram
+
+	// StageTotal counts finished stages by stage name and outcome. Use
+	// StageLabel for the stage label.
+	StageTotal *prometheus.CounterVec
+
+	// StageDuration observes how long each job of a stage, one TaskRun,
+	// ran, by stage name and outcome. Use StageLabel for the stage label.
+	StageDuration *prometheus.HistogramVec
+
+	// JobRetries counts the jobs run again after failing, by stage name and
+	// the error class of the failure. Use StageLabel for the stage label.
+	JobRetries *prometheus.CounterVec
+
+	// ChainTriggers counts on_success and on_failure triggers by outcome:
+	// submitted, rejected, loop or too_deep.
+	ChainTriggers *prometheus.CounterVec
+
+	// ArgoCDSyncs counts the ArgoCD application syncs of succeeded runs by
+	// result: succeeded, failed, timed_out or skipped.
+	ArgoCDSyncs *prometheus.CounterVec
+
+	// ArgoCDRollbacks counts the rollbacks of applications that stayed
+	// Degraded after a pipeline deployed them, by result: succeeded or
+	// failed.
+	ArgoCDRollbacks *prometheus.CounterVec
+
+	// Reruns counts runs submitted again from a finished run's definition,
+	// by mode: full, or failed_only when the stages that succeeded are
+	// reused.
+	Reruns *prometheus.CounterVec
+
+	// TektonAPIThrottled counts Kubernetes API requests from the Tekton
+	// client that had to wait for the client-side rate limiter.
+	TektonAPIThrottled prometheus.Counter
+
+	// TektonAPIThrottleWait observes how long throttled requests waited.
+	TektonAPIThrottleWait prometheus.Histogram
+
+	// TektonWatchEventsIgnored counts TaskRun watch events ignored for
+	// arriving out of order, by reason ("stale" for an older resource
+	// version, "regressed" for one that would un-finish a TaskRun).
+	TektonWatchEventsIgnored *prometheus.CounterVec
+
+	// TektonAPIRetries counts retried Kubernetes API calls of the Tekton
+	// client, by operation (e.g. "create_taskrun", "watch_taskrun").
+	TektonAPIRetries *prometheus.CounterVec
+
+	// LogStreamWriteFailures counts log streams aborted because writing to
+	// the client failed, by reason ("timeout" or "error").
+	LogStreamWriteFailures *prometheus.CounterVec
+
+	// StoreReadsShed counts run store reads refused by the read circuit
+	// breaker, by result ("stale" when a last-known copy was served,
+	// "unavailable" otherwise).
+	StoreReadsShed *prometheus.CounterVec
+
+	// StorePoolInUse is the number of run store connections held, by pool
+	// partition ("write", "read" or "list"). StorePoolWaits counts the
+	// operations that had to wait for one and StorePoolWait observes how
+	// long they waited.
+	StorePoolInUse *prometheus.GaugeVec
+	StorePoolWaits *prometheus.CounterVec
+	StorePoolWait  *prometheus.HistogramVec
+
+	// StatusCacheRequests counts run status reads by cache result ("hit",
+	// "local_hit" while Redis is unreachable, or "miss").
+	StatusCacheRequests *prometheus.CounterVec
+
+	// PolicyDecisions counts admission policy evaluations by result
+	// ("allowed", "denied" or "error").
+	PolicyDecisions *prometheus.CounterVec
+
+	// RunsArchived counts finished runs moved from the primary run store to
+	// the archive.
+	RunsArchived prometheus.Counter
+
+	// LogsPurged counts stage logs deleted by the log retention policy.
+	LogsPurged prometheus.Counter
+
+	// RunsQueueStale counts runs dropped for waiting in the queue longer
+	// than queue.max_age.
+	RunsQueueStale prometheus.Counter
+
+	// RunsDebounced counts runs superseded by a newer submission during
+	// their debounce period.
+	RunsDebounced prometheus.Counter
+
+	// QueueWait observes how long runs waited between submission and
+	// starting to execute, by tenant and priority. Use TenantLabel and
+	// PriorityLabel for the labels.
+	QueueWait *prometheus.HistogramVec
+
+	// RunsHardTimeout counts runs force-cancelled for running longer than
+	// pipeline.hard_timeout.
+	RunsHardTimeout prometheus.Counter
+
+	// RunsOrphaned counts runs still executing when their replica's
+	// shutdown drain ran out of time.
+	RunsOrphaned prometheus.Counter
+
+	// RunEventsDeduplicated counts run events not published because an
+	// identical event was published within the dedup window.
+	RunEventsDeduplicated prometheus.Counter
+
+	// RedisDegraded is 1 while Redis is unreachable and the engine runs in
+	// local-only mode, 0 otherwise.
+	RedisDegraded prometheus.Gauge
+
+	// RunSlotsActive is the number of runs holding one of the
+	// server.max_concurrent_pipelines run slots, and RunSlotsQueued the
+	// number waiting for one.
+	RunSlotsActive prometheus.Gauge
+	RunSlotsQueued prometheus.Gauge
+
+	// DatabaseConnectionsInUse and DatabaseConnectionsIdle are the open
+	// connections to the run database that are in use and idle, sampled
+	// from its connection pool.
+	DatabaseConnectionsInUse prometheus.Gauge
+	DatabaseConnectionsIdle  prometheus.Gauge
+
+	// PipelineRuns, PipelineSuccessRate and PipelineDurationP95 publish the
+	// latest stats snapshot of finished runs per pipeline: the run count,
+	// the share of succeeded among succeeded and failed runs, and the 95th
+	// percentile duration in seconds.
+	PipelineRuns        *prometheus.GaugeVec
+	PipelineSuccessRate *prometheus.GaugeVec
+	PipelineDurationP95 *prometheus.GaugeVec
+
+	// PipelineCoverage is the code coverage percentage of the latest run of
+	// each pipeline that reported one. Use PipelineLabel for the pipeline
+	// label.
+	PipelineCoverage *prometheus.GaugeVec
+
+	stageLabels    = newLabelGuard(DefaultMaxStageLabels)
+	pipelineLabels = newLabelGuard(DefaultMaxPipelineLabels)
+	tenantLabels   = newLabelGuard(DefaultMaxTenantLabels)
+	priorityLabels = newLabelGuard(MaxPriorityLabels)
+)
+
+func init() {
+	build(DefaultNamespace)
+}
+
+// Initialize creates the collectors under the configured namespace and
+// registers them.
+func Initialize() error {
+	namespace := viper.GetString("metrics.namespace")
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	build(namespace)
+
+	maxStages := viper.GetInt("metrics.max_stage_labels")
+	if maxStages <= 0 {
+		maxStages = DefaultMaxStageLabels
+	}
+	stageLabels = newLabelGuard(maxStages)
+
+	maxPipelines := viper.GetInt("metrics.max_pipeline_labels")
+	if maxPipelines <= 0 {
+		maxPipelines = DefaultMaxPipelineLabels
+	}
+	pipelineLabels = newLabelGuard(maxPipelines)
+
+	maxTenants := viper.GetInt("metrics.max_tenant_labels")
+	if maxTenants <= 0 {
+		maxTenants = DefaultMaxTenantLabels
+	}
+	tenantLabels = newLabelGuard(maxTenants)
+
+	for _, c := range collectors() {
+		if err := prometheus.Register(c); err != nil {
+			return fmt.Errorf("failed to register collector: %w", err)
+		}
+	}
+	return nil
+}
+
+func build(namespace string) {
+	AISchemaMismatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_schema_mismatch_total",
+		Help:      "AI service responses rejected because of an incompatible schema.",
+	}, []string{"endpoint", "reason"})
+
+	AILowConfidence = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_low_confidence_total",
+		Help:      "AI recommendations ignored for falling below the minimum confidence.",
+	}, []string{"endpoint"})
+
+	AIEndpointFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_endpoint_failures_total",
+		Help:      "Failed requests to an AI service endpoint.",
+	}, []string{"url"})
+
+	AIRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ai_rate_limited_total",
+		Help:      "Requests an AI service endpoint rejected with 429 Too Many Requests.",
+	}, []string{"url"})
+
+	APIRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_rate_limited_total",
+		Help:      "API requests refused for exceeding the client's rate limit, by API.",
+	}, []string{"api"})
+
+	APIUnauthenticated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_unauthenticated_total",
+		Help:      "API requests refused for missing or invalid credentials, by API.",
+	}, []string{"api"})
+
+	AIBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ai_breaker_state",
+		Help:      "Circuit breaker state of an AI service endpoint: 0 closed, 1 open, 2 half-open.",
+	}, []string{"url"})
+
+	TestSelectionTests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "test_selection_tests_total",
+		Help:      "Tests of test_selection stages, run or skipped by AI test selection.",
+	}, []string{"outcome"})
+
+	BuildTimeEstimateRatio = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "build_time_estimate_ratio",
+		Help:      "Actual over AI-estimated build time of succeeded runs.",
+		Buckets:   []float64{.25, .5, .75, .9, 1.1, 1.25, 1.5, 2, 4},
+	})
+
+	StageTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stage_total",
+		Help:      "Finished pipeline stages by stage name and outcome.",
+	}, []string{"stage", "outcome"})
+
+	StageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "stage_duration_seconds",
+		Help:      "Time pipeline stage jobs ran, by stage name and outcome.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 900, 1200, 1800},
+	}, []string{"stage", "status"})
+
+	JobRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "job_retries_total",
+		Help:      "Pipeline stage jobs run again after failing, by stage name and error class.",
+	}, []string{"stage", "class"})
+
+	ChainTriggers = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chain_triggers_total",
+		Help:      "Downstream pipeline triggers of finished runs, by outcome.",
+	}, []string{"result"})
+
+	ArgoCDSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "argocd_syncs_total",
+		Help:      "ArgoCD application syncs of succeeded runs, by result.",
+	}, []string{"result"})
+
+	ArgoCDRollbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "argocd_rollbacks_total",
+		Help:      "Rollbacks of applications that stayed degraded after a pipeline deployed them, by result.",
+	}, []string{"result"})
+
+	Reruns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reruns_total",
+		Help:      "Runs submitted again from a finished run's definition, by mode.",
+	}, []string{"mode"})
+
+	LogStreamWriteFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "log_stream_write_failures_total",
+		Help:      "Log streams closed because a write to the client failed.",
+	}, []string{"reason"})
+
+	StoreReadsShed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_reads_shed_total",
+		Help:      "Run store reads refused by the read circuit breaker.",
+	}, []string{"result"})
+
+	StorePoolInUse = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_pool_in_use",
+		Help:      "Run store connections held, by pool partition.",
+	}, []string{"partition"})
+
+	StorePoolWaits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "store_pool_waits_total",
+		Help:      "Run store operations that waited for a pool connection.",
+	}, []string{"partition"})
+
+	StorePoolWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_pool_wait_seconds",
+		Help:      "Time run store operations waited for a pool connection.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"partition"})
+
+	StatusCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "status_cache_requests_total",
+		Help:      "Run status reads by status cache result.",
+	}, []string{"result"})
+
+	PolicyDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "policy_decisions_total",
+		Help:      "Admission policy evaluations by result.",
+	}, []string{"result"})
+
+	RunsArchived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_archived_total",
+		Help:      "Finished runs moved from the primary run store to the archive.",
+	})
+
+	LogsPurged = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logs_purged_total",
+		Help:      "Stage logs deleted by the log retention policy.",
+	})
+
+	RunsQueueStale = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_queue_stale_total",
+		Help:      "Queued runs dropped for exceeding the maximum queue age.",
+	})
+
+	RunsDebounced = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_debounced_total",
+		Help:      "Queued runs superseded by a newer submission during their debounce period.",
+	})
+
+	QueueWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_wait_seconds",
+		Help:      "Time runs waited from submission until they started executing.",
+		Buckets:   []float64{.1, .5, 1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"tenant", "priority"})
+
+	RunsHardTimeout = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_hard_timeout_total",
+		Help:      "Runs force-cancelled for exceeding the hard timeout.",
+	})
+
+	RunsOrphaned = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "runs_orphaned_total",
+		Help:      "Runs left unfinished by a replica's shutdown drain.",
+	})
+
+	RunEventsDeduplicated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "run_events_deduplicated_total",
+		Help:      "Run events suppressed as duplicates within the dedup window.",
+	})
+
+	RedisDegraded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "redis_degraded",
+		Help:      "Whether Redis is unreachable and the engine runs in local-only mode.",
+	})
+
+	RunSlotsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_slots_active",
+		Help:      "Runs executing in one of the concurrent run slots.",
+	})
+
+	RunSlotsQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "run_slots_queued",
+		Help:      "Runs queued for a concurrent run slot.",
+	})
+
+	DatabaseConnectionsInUse = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_connections_in_use",
+		Help:      "Open run database connections in use.",
+	})
+
+	DatabaseConnectionsIdle = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "database_connections_idle",
+		Help:      "Open run database connections idle in the pool.",
+	})
+
+	PipelineRuns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pipeline_window_runs",
+		Help:      "Finished runs per pipeline in the stats window.",
+	}, []string{"pipeline"})
+
+	PipelineSuccessRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pipeline_window_success_ratio",
+		Help:      "Share of succeeded among succeeded and failed runs per pipeline in the stats window.",
+	}, []string{"pipeline"})
+
+	PipelineCoverage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pipeline_coverage_percent",
+		Help:      "Code coverage percentage of the latest run of a pipeline that reported one.",
+	}, []string{"pipeline"})
+
+	PipelineDurationP95 = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pipeline_window_duration_p95_seconds",
+		Help:      "95th percentile run duration per pipeline in the stats window.",
+	}, []string{"pipeline"})
+
+	TektonAPIThrottled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tekton_api_throttled_total",
+		Help:      "Kubernetes API requests delayed by the client-side rate limiter.",
+	})
+
+	TektonAPIThrottleWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tekton_api_throttle_wait_seconds",
+		Help:      "Time Kubernetes API requests spent waiting for the client-side rate limiter.",
+		Buckets:   []float64{.005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	TektonWatchEventsIgnored = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tekton_watch_events_ignored_total",
+		Help:      "TaskRun watch events ignored for arriving out of order.",
+	}, []string{"reason"})
+
+	TektonAPIRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tekton_api_retries_total",
+		Help:      "Kubernetes API calls retried after a retryable failure.",
+	}, []string{"operation"})
+}
+
+func collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		AISchemaMismatches,
+		AILowConfidence,
+		AIEndpointFailures,
+		AIRateLimited,
+		APIRateLimited,
+		APIUnauthenticated,
+		AIBreakerState,
+		TestSelectionTests,
+		BuildTimeEstimateRatio,
+		StageTotal,
+		StageDuration,
+		JobRetries,
+		ChainTriggers,
+		ArgoCDSyncs,
+		ArgoCDRollbacks,
+		Reruns,
+		TektonAPIThrottled,
+		TektonAPIThrottleWait,
+		TektonWatchEventsIgnored,
+		TektonAPIRetries,
+		LogStreamWriteFailures,
+		StoreReadsShed,
+		StorePoolInUse,
+		StorePoolWaits,
+		StorePoolWait,
+		StatusCacheRequests,
+		PolicyDecisions,
+		RunsArchived,
+		LogsPurged,
+		RunsQueueStale,
+		RunsDebounced,
+		QueueWait,
+		RunsHardTimeout,
+		RunsOrphaned,
+		RunEventsDeduplicated,
+		RedisDegraded,
+		RunSlotsActive,
+		RunSlotsQueued,
+		DatabaseConnectionsInUse,
+		DatabaseConnectionsIdle,
+		PipelineRuns,
+		PipelineCoverage,
+		PipelineSuccessRate,
+		PipelineDurationP95,
+	}
+}
+
+// StageLabel returns name if it is one of the first metrics.max_stage_labels
+// stage names seen, and OverflowLabel otherwise. Stage names come from user
+// specs, so without this guard a generated name per run would grow the
+// series count without bound.
+func StageLabel(name string) string {
+	return stageLabels.label(name)
+}
+
+// PipelineLabel returns name if it is one of the first
+// metrics.max_pipeline_labels pipeline names seen, and OverflowLabel
+// otherwise.
+func PipelineLabel(name string) string {
+	return pipelineLabels.label(name)
+}
+
+// TenantLabel returns tenant if it is one of the first
+// metrics.max_tenant_labels tenants seen, and OverflowLabel otherwise.
+func TenantLabel(tenant string) string {
+	return tenantLabels.label(tenant)
+}
+
+// PriorityLabel returns priority if it is one of the first
+// MaxPriorityLabels priorities seen, and OverflowLabel otherwise. An empty
+// priority is NoPriorityLabel.
+func PriorityLabel(priority string) string {
+	if priority == "" {
+		return NoPriorityLabel
+	}
+	return priorityLabels.label(priority)
+}
+
+type labelGuard struct {
+	mu    sync.Mutex
+	max   int
+	known map[string]struct{}
+}
+
+func newLabelGuard(max int) *labelGuard {
+	return &labelGuard{max: max, known: make(map[string]struct{})}
+}
+
+func (g *labelGuard) label(v string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.known[v]; ok {
+		return v
+	}
+	if len(g.known) >= g.max {
+		return OverflowLabel
+	}
+	g.known[v] = struct{}{}
+	return v
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import "testing"
+
+func TestLabelGuardCapsCardinality(t *testing.T) {
+	g := newLabelGuard(2)
+
+	if got := g.label("build"); got != "build" {
+		t.Fatalf("label(build) = %q", got)
+	}
+	if got := g.label("test"); got != "test" {
+		t.Fatalf("label(test) = %q", got)
+	}
+	if got := g.label("deploy"); got != OverflowLabel {
+		t.Fatalf("label(deploy) = %q, want %q", got, OverflowLabel)
+	}
+	if got := g.label("build"); got != "build" {
+		t.Fatalf("known label must keep mapping to itself, got %q", got)
+	}
+}
@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator carries trace context in W3C traceparent headers.
+var propagator = propagation.TraceContext{}
+
+const traceParentKey = "traceparent"
+
+// Extract returns a copy of ctx carrying the remote span context found in
+// carrier, such as the headers of an incoming request.
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	return propagator.Extract(ctx, carrier)
+}
+
+// Inject writes the span context of ctx into carrier, such as the headers
+// of an outgoing request.
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+}
+
+// TraceParent returns the W3C traceparent of the span context of ctx, or ""
+// when ctx has none.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier[traceParentKey]
+}
+
+// WithTraceParent returns a copy of ctx carrying the remote span context
+// traceparent describes, so spans started from it join that trace. An empty
+// or malformed traceparent leaves ctx as it is.
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{traceParentKey: traceParent})
+}
+
+// TraceID returns the hex trace ID of the span context of ctx, or "" when
+// ctx has none.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
@@ -0,0 +1,152 @@
+// Package tracing sets up the OpenTelemetry tracer provider and carries
+// per-request span attributes through a context.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/devmind-pipeline/pipeline/pkg/egress"
+)
+
+const instrumentationName = "github.com/devmind-pipeline/pipeline"
+
+// Initialize installs a tracer provider when tracing.enabled is set. It
+// exports to tracing.jaeger_endpoint, or with tracing.exporter set to
+// "otlp" over OTLP/gRPC to tracing.otlp_endpoint. Otherwise the global
+// no-op provider is kept and spans cost next to nothing.
+//
+// The returned function flushes buffered spans and stops the exporter; call
+// it before exiting so the last spans are not dropped. It is never nil.
+func Initialize() (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+	if !viper.GetBool("tracing.enabled") {
+		return shutdown, nil
+	}
+
+	exporter, err := newExporter(context.Background())
+	if err != nil {
+		return shutdown, err
+	}
+
+	// The semconv version must match the SDK's, or the schema URLs
+	// conflict and the merge fails.
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(viper.GetString("tracing.service_name")),
+	))
+	if err != nil {
+		return shutdown, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(contextAttributes{}),
+		sdktrace.WithBatcher(exporter),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// newExporter creates the span exporter tracing.exporter selects.
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch exporter := viper.GetString("tracing.exporter"); exporter {
+	case "", "jaeger":
+		network, err := egress.FromViper()
+		if err != nil {
+			return nil, err
+		}
+		exp, err := jaeger.New(jaeger.WithCollectorEndpoint(
+			jaeger.WithEndpoint(viper.GetString("tracing.jaeger_endpoint")),
+			jaeger.WithHTTPClient(&http.Client{Transport: network.Transport(egress.ClientTracing)}),
+		))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create jaeger exporter: %w", err)
+		}
+		return exp, nil
+	case "otlp":
+		opts, err := otlpOptions(viper.GetString("tracing.otlp_endpoint"))
+		if err != nil {
+			return nil, err
+		}
+		// The connection is established lazily, so an unreachable collector
+		// does not fail startup; spans are dropped until it can be reached.
+		exp, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+		}
+		return exp, nil
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+}
+
+// otlpOptions turns an endpoint URL into OTLP/gRPC client options: the
+// scheme selects plaintext (http) or TLS (https).
+func otlpOptions(endpoint string) ([]otlptracegrpc.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid tracing.otlp_endpoint %q: want http://host:port or https://host:port", endpoint)
+	}
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid tracing.otlp_endpoint %q: scheme must be http or https", endpoint)
+	}
+	return opts, nil
+}
+
+// Tracer returns the engine's tracer.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+type attributesKey struct{}
+
+// WithAttributes returns a copy of ctx whose attributes are set on every
+// span started from it, including spans started by descendants.
+func WithAttributes(ctx context.Context, attrs ...attribute.KeyValue) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	parent := Attributes(ctx)
+	merged := make([]attribute.KeyValue, 0, len(parent)+len(attrs))
+	merged = append(merged, parent...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, attributesKey{}, merged)
+}
+
+// Attributes returns the span attributes attached to ctx.
+func Attributes(ctx context.Context) []attribute.KeyValue {
+	attrs, _ := ctx.Value(attributesKey{}).([]attribute.KeyValue)
+	return attrs
+}
+
+// contextAttributes copies the attributes attached to a span's parent
+// context onto the span when it starts.
+type contextAttributes struct{}
+
+func (contextAttributes) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if attrs := Attributes(parent); len(attrs) > 0 {
+		s.SetAttributes(attrs...)
+	}
+}
+
+func (contextAttributes) OnEnd(sdktrace.ReadOnlySpan)      {}
+func (contextAttributes) Shutdown(context.Context) error   { return nil }
+func (contextAttributes) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestContextAttributesReachDescendantSpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(contextAttributes{}),
+		sdktrace.WithSpanProcessor(rec),
+	)
+	tracer := tp.Tracer("test")
+
+	ctx := WithAttributes(context.Background(), attribute.String("pipeline.param.env", "staging"))
+	ctx, parent := tracer.Start(ctx, "run")
+	ctx = WithAttributes(ctx, attribute.String("pipeline.stage", "build"))
+	_, child := tracer.Start(ctx, "job")
+	child.End()
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %d, want 2", len(spans))
+	}
+	want := map[string]int{"job": 2, "run": 1}
+	for _, s := range spans {
+		if got := len(s.Attributes()); got != want[s.Name()] {
+			t.Errorf("span %q has %d attributes, want %d: %v", s.Name(), got, want[s.Name()], s.Attributes())
+		}
+	}
+}
+
+func TestInitializeSelectsExporter(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("tracing.enabled", true)
+
+	viper.Set("tracing.exporter", "zipkin")
+	if _, err := Initialize(); err == nil {
+		t.Error("Initialize() accepted an unknown exporter")
+	}
+	viper.Set("tracing.exporter", "otlp")
+	viper.Set("tracing.otlp_endpoint", "otel-collector:4317")
+	if _, err := Initialize(); err == nil {
+		t.Error("Initialize() accepted an OTLP endpoint without a scheme")
+	}
+
+	// The collector is only dialled on export, so none need be listening.
+	viper.Set("tracing.otlp_endpoint", "http://127.0.0.1:4317")
+	shutdown, err := Initialize()
+	if err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	const tp = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := WithTraceParent(context.Background(), tp)
+	if got := TraceParent(ctx); got != tp {
+		t.Errorf("TraceParent() = %q, want %q", got, tp)
+	}
+	if got := TraceID(ctx); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceID() = %q", got)
+	}
+	if got := TraceParent(WithTraceParent(context.Background(), "garbage")); got != "" {
+		t.Errorf("TraceParent() of a malformed traceparent = %q, want none", got)
+	}
+}